@@ -18,7 +18,11 @@
 package main
 
 import (
-	"crypto/ecdsa"
+	"context"
+	"crypto"
+	"crypto/tls"
+	"encoding/json"
+	"encoding/pem"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -26,6 +30,9 @@ import (
 	"net/http"
 	"net/url"
 	_ "net/http/pprof"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/pkg/errors"
@@ -34,11 +41,11 @@ import (
 	"github.com/prometheus/common/version"
 
 	"github.com/ampproject/amppackager/packager/certcache"
-	"github.com/ampproject/amppackager/packager/certloader"
 	"github.com/ampproject/amppackager/packager/healthz"
 	"github.com/ampproject/amppackager/packager/mux"
 	"github.com/ampproject/amppackager/packager/rtv"
 	"github.com/ampproject/amppackager/packager/signer"
+	"github.com/ampproject/amppackager/packager/transform"
 	"github.com/ampproject/amppackager/packager/util"
 	"github.com/ampproject/amppackager/packager/validitymap"
 )
@@ -46,11 +53,17 @@ import (
 var flagConfig = flag.String("config", "amppkg.toml", "Path to the config toml file.")
 var flagDevelopment = flag.Bool("development", false, "True if this is a development server.")
 var flagInvalidCert = flag.Bool("invalidcert", false, "True if invalid certificate intentionally used in production.")
+var flagValidateConfig = flag.Bool("validateconfig", false, "Check the config toml file, and the files it references, then exit without starting servers.")
+var flagPrewarmOCSP = flag.Bool("prewarmocsp", false, "Fetch the OCSP response into the cache, and verify it is fresh, then exit without starting servers. Exits nonzero if it is missing, expired, or past its refresh time.")
 var flagStaging = flag.String("staging", "", "URL that overrides the base URL used to host certs, used for testing. Can only be used with -development flag.")
 
 // IMPORTANT: do not turn on this flag for now, it's still under development.
 var flagAutoRenewCert = flag.Bool("autorenewcert", false, "True if amppackager is to attempt cert auto-renewal.")
 
+// How long to wait for in-flight requests when shutting down, if
+// ShutdownGracePeriodSeconds is unset.
+const defaultShutdownGracePeriod = 30 * time.Second
+
 // Prints errors returned by pkg/errors with stack traces.
 func die(err interface{}) { log.Fatalf("%+v", err) }
 
@@ -88,27 +101,47 @@ func main() {
 	if err != nil {
 		die(errors.Wrapf(err, "parsing config at %s", *flagConfig))
 	}
+	if *flagValidateConfig {
+		if err := config.Validate(); err != nil {
+			die(errors.Wrapf(err, "validating config at %s", *flagConfig))
+		}
+		fmt.Println("Config at", *flagConfig, "is valid.")
+		return
+	}
 
 	validityMap, err := validitymap.New()
 	if err != nil {
 		die(errors.Wrap(err, "building validity map"))
 	}
 
-	key, err := certloader.LoadKeyFromFile(config)
+	key, err := util.LoadKey(config)
 	if err != nil {
-		die(errors.Wrap(err, "loading key file"))
+		die(errors.Wrap(err, "loading key"))
 	}
 
 	var responder certcache.OCSPResponder = nil
 	if *flagDevelopment {
-		// Key is guaranteed to be ECDSA by signedexchange.ParsePrivateKey. This may change in future versions of SXG.
-		responder = fakeOCSPResponder{key: key.(*ecdsa.PrivateKey)}.Respond
+		// Key is guaranteed to be an ECDSA crypto.Signer by util.LoadKey. This may change in future versions of SXG.
+		responder = fakeOCSPResponder{key: key.(crypto.Signer)}.Respond
 	}
-	certCache, err := certcache.PopulateCertCache(config, key, responder, *flagDevelopment || *flagInvalidCert, *flagAutoRenewCert)
+	certCache, err := certcache.PopulateCertCache(config, key, responder, *flagDevelopment || *flagInvalidCert, *flagAutoRenewCert, nil)
 	if err != nil {
 		die(errors.Wrap(err, "building cert cache"))
 	}
 
+	if *flagPrewarmOCSP {
+		status, err := certCache.PrewarmOCSP(context.Background())
+		if status != nil {
+			statusJSON, _ := json.MarshalIndent(status, "", "  ")
+			fmt.Println(string(statusJSON))
+		}
+		if err != nil {
+			die(errors.Wrap(err, "prewarming OCSP"))
+		}
+		fmt.Println("OCSP response is fresh.")
+		return
+	}
+
 	if err = certCache.Init(); err != nil {
 		if *flagDevelopment {
 			fmt.Println("WARNING:", err)
@@ -117,7 +150,16 @@ func main() {
 		}
 	}
 
-	healthz, err := healthz.New(certCache)
+	healthzDetail, err := healthz.NewDetail(certCache)
+	if err != nil {
+		die(errors.Wrap(err, "building healthz detail"))
+	}
+
+	healthzChecks := []healthz.Check{healthz.CertExpiryCheck(certCache, time.Duration(config.HealthzCertExpiryDays)*24*time.Hour, time.Now)}
+	if config.HealthzUpstreamURL != "" {
+		healthzChecks = append(healthzChecks, healthz.UpstreamCheck(&http.Client{Timeout: 10 * time.Second}, config.HealthzUpstreamURL))
+	}
+	healthz, err := healthz.New(certCache, healthzChecks...)
 	if err != nil {
 		die(errors.Wrap(err, "building healthz"))
 	}
@@ -143,14 +185,53 @@ func main() {
 	}
 
 	signerRequireHeaders := !*flagDevelopment
-	signer, err := signer.New(certCache, key, config.URLSet, rtvCache, certCache.IsHealthy,
+	signer, err := signer.New(certCache, key, config.URLSet, rtvCache, certCache.IsOCSPHealthy,
 		overrideBaseURL, signerRequireHeaders, config.ForwardedRequestHeaders, time.Now)
 	if err != nil {
 		die(errors.Wrap(err, "building signer"))
 	}
+	signer.SetReferrerPolicy(config.ReferrerPolicy)
+	signer.SetNonHTMLPolicy(config.ErrorOnNonHTML, config.NonHTMLProxyTypes)
+	signer.SetURLSetMatch(config.URLSetMatch)
+	signer.SetUnmatchedURLPolicy(config.UnmatchedURL)
+	signer.SetCanonicalLinkHeader(config.CanonicalLinkHeader)
+	signer.SetSignatureDuration(time.Duration(config.SignatureDurationSeconds) * time.Second)
+	signer.SetMIRecordSize(config.MIRecordSize)
+	signer.SetMaxBodyLength(config.MaxSignableBodyLength, config.ErrorOnOversizedBody)
+	signer.SetOuterCacheControl(config.OuterCacheControl, time.Duration(config.OuterMaxAgeSeconds)*time.Second)
+	signer.SetRequestTimeout(time.Duration(config.RequestTimeoutSeconds) * time.Second)
+	signer.SetAMPValidation(config.ValidateAMP, config.SignInvalidAMP, config.ValidatorFailOpen)
+	signer.SetResponseHeaderPolicy(config.SignedResponseHeaders, config.StrippedResponseHeaders)
+	signer.SetSignContentLanguage(config.SignContentLanguage)
+	signer.SetTransformerOptions(config.TransformerOptions)
 
 	// TODO(twifkak): Make log output configurable.
 
+	var transformHandler http.Handler
+	if config.ServeTransform {
+		transformer, err := transform.New(rtvCache)
+		if err != nil {
+			die(errors.Wrap(err, "building transform handler"))
+		}
+		transformer.SetMaxBodyLength(config.MaxSignableBodyLength)
+		transformer.SetOptions(config.TransformerOptions)
+		transformHandler = transformer
+	}
+
+	handler := mux.New(mux.Handlers{
+		CertCache:     certCache,
+		Signer:        signer,
+		ValidityMap:   validityMap,
+		Healthz:       healthz,
+		HealthzDetail: healthzDetail,
+		Metrics:       promhttp.Handler(),
+		ACMEChallenge: certCache.ACMEChallengeHandler(),
+		Transform:     transformHandler,
+	})
+	if config.NoSniff {
+		handler = mux.NoSniff(handler)
+	}
+
 	addr := ""
 	if config.LocalOnly {
 		addr = "localhost"
@@ -160,7 +241,7 @@ func main() {
 		Addr: addr,
 		// Don't use DefaultServeMux, per
 		// https://blog.cloudflare.com/exposing-go-on-the-internet/.
-		Handler:           logIntercept{mux.New(certCache, signer, validityMap, healthz, promhttp.Handler())},
+		Handler:           logIntercept{handler},
 		ReadTimeout:       10 * time.Second,
 		ReadHeaderTimeout: 5 * time.Second,
 		// If needing to stream the response, disable WriteTimeout and
@@ -179,13 +260,86 @@ func main() {
 	// TCP keep-alive timeout on ListenAndServe is 3 minutes. To shorten,
 	// follow the above Cloudflare blog.
 
+	switch config.SIGHUPAction {
+	case util.SIGHUPRefreshOCSP:
+		go func() {
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, syscall.SIGHUP)
+			for range signals {
+				log.Println("Received SIGHUP - refreshing OCSP")
+				if err := certCache.RefreshOCSP(context.Background()); err != nil {
+					log.Println("Error refreshing OCSP:", err)
+				} else {
+					log.Println("Refreshed OCSP")
+				}
+			}
+		}()
+	case util.SIGHUPIgnore:
+		signal.Ignore(syscall.SIGHUP)
+	}
+
+	// On SIGINT or SIGTERM, e.g. when redeploying, stop accepting
+	// connections and let in-flight requests finish, so that clients don't
+	// get truncated SXGs.
+	shutdown := make(chan struct{})
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		log.Println("Received", <-signals, "- shutting down")
+		gracePeriod := defaultShutdownGracePeriod
+		if config.ShutdownGracePeriodSeconds > 0 {
+			gracePeriod = time.Duration(config.ShutdownGracePeriodSeconds) * time.Second
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Println("Error draining in-flight requests:", err)
+		}
+		certCache.Stop()
+		close(shutdown)
+	}()
+
 	if *flagDevelopment {
 		log.Println("WARNING: Running in development, using SXG key for TLS. This won't work in production.")
-		log.Fatal(server.ListenAndServeTLS(config.CertFile, config.KeyFile))
+		if config.KeyFile != "" {
+			err = server.ListenAndServeTLS(config.CertFile, config.KeyFile)
+		} else {
+			// The key isn't on disk, so hand it to the server directly.
+			var cert tls.Certificate
+			if cert, err = devTLSCertificate(config.CertFile, key); err != nil {
+				die(errors.Wrap(err, "loading TLS certificate"))
+			}
+			server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+			err = server.ListenAndServeTLS("", "")
+		}
 	} else if *flagInvalidCert {
 		log.Println("WARNING: Running in production without valid signing certificate. Signed exchanges will not be valid.")
-		log.Fatal(server.ListenAndServe())
+		err = server.ListenAndServe()
 	} else {
-		log.Fatal(server.ListenAndServe())
+		err = server.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-shutdown
+	log.Println("Shut down")
+}
+
+// Returns the TLS certificate for the cert chain in certFile, and the SXG key,
+// for development mode when the key isn't in a file.
+func devTLSCertificate(certFile string, key crypto.PrivateKey) (tls.Certificate, error) {
+	certPem, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return tls.Certificate{}, errors.Wrapf(err, "reading %s", certFile)
+	}
+	cert := tls.Certificate{PrivateKey: key}
+	for block, rest := pem.Decode(certPem); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			cert.Certificate = append(cert.Certificate, block.Bytes)
+		}
+	}
+	if len(cert.Certificate) == 0 {
+		return tls.Certificate{}, errors.Errorf("no certificates in %s", certFile)
 	}
+	return cert, nil
 }
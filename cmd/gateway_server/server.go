@@ -39,7 +39,7 @@ type gatewayServer struct {
 	rtvCache *rtv.RTVCache
 }
 
-func shouldPackage() error {
+func shouldPackage(context.Context) error {
 	return nil
 }
 
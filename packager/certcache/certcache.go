@@ -18,13 +18,14 @@ import (
 	"bytes"
 	"context"
 	"crypto"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
+	"os"
 	"strconv"
 	"sync"
 	"time"
@@ -54,14 +55,41 @@ const maxOCSPResponseBytes = 1024 * 1024
 // How often to check if OCSP stapling needs updating.
 const ocspCheckInterval = 1 * time.Hour
 
-// How often to check if certs needs updating.
-const certCheckInterval = 24 * time.Hour
+// If the OCSP response is due to be refreshed sooner than ocspCheckInterval, it
+// is checked then instead, but no sooner than this.
+const ocspMinCheckInterval = 1 * time.Minute
+
+// The default fraction of an OCSP response's validity period after which it is
+// refreshed: the midpoint, per sleevi requirement #3 (see below).
+const defaultOCSPRefreshFraction = 0.5
+
+// How far in the future an OCSP response's producedAt may be, by default.
+const defaultOCSPClockSkew = 5 * time.Minute
+
+// How often to check if certs needs updating, by default.
+const defaultCertCheckInterval = 24 * time.Hour
+
+// The default fraction of a cert's lifetime after which it is renewed.
+const defaultCertRenewalFraction = 2.0 / 3
+
+// The maximum size of a CRL to download. Some CAs' CRLs are as large as several
+// MB.
+const maxCRLBytes = 20 * 1024 * 1024
+
+// The format of the OCSP cache file: a marker line naming this format and
+// version, followed by the DER-encoded OCSP response. Files of any other
+// version, or without the marker (as written before it was introduced), are
+// refetched. Increment the version whenever the contents or their validation
+// change incompatibly.
+const ocspFileFormat = "amppkg-ocsp-cache"
+const ocspFileFormatVersion = 1
 
 // Max number of OCSP request tries.
 // This will timeout after 1 + 2 + 4 + 8 + 10 * 6 = 75 minutes.
 const maxOCSPTries = 10
 
 // Recommended renewal duration for certs. This is duration before next cert expiry.
+// Certs are renewed no later than this, regardless of SetCertRenewalPolicy.
 // 8 days is recommended duration to start requesting new certs to allow for ACME server outages.
 // It's 6 days + 2 days renewal grace period.
 // 6 days so that generated SXGs are valid for their full lifetime, plus 2 days in front of that to allow time for the new cert
@@ -73,6 +101,9 @@ type OCSPResponder func(*x509.Certificate) ([]byte, error)
 
 type CertHandler interface {
 	GetLatestCert() *x509.Certificate
+	// Returns the NextUpdate of the OCSP response for the latest cert, or
+	// the zero time if unknown. Signatures should not be valid past it.
+	GetOCSPExpiry() time.Time
 	IsHealthy() error
 }
 
@@ -82,15 +113,30 @@ type CertCache struct {
 	certsMu  sync.RWMutex
 	certs    []*x509.Certificate
 	// If certFetcher is not set, that means cert auto-renewal is not available.
-	certFetcher       *certfetcher.CertFetcher
-	renewedCertsMu    sync.RWMutex
-	renewedCertName   string
-	renewedCerts      []*x509.Certificate
-	ocspUpdateAfterMu sync.RWMutex
-	ocspUpdateAfter   time.Time
-	stop              chan struct{}
+	certFetcher     *certfetcher.CertFetcher
+	renewedCertsMu  sync.RWMutex
+	renewedCertName string
+	renewedCerts    []*x509.Certificate
+	// The cert chain last replaced by renewedCerts, and its final OCSP
+	// response, which are served under its certName until the response's
+	// NextUpdate (previousCertsUntil), for the SXGs still referencing it. Guarded
+	// by certsMu. See keepPreviousCerts.
+	previousCertName   string
+	previousCerts      []*x509.Certificate
+	previousOCSP       []byte
+	previousCertsUntil time.Time
+	ocspUpdateAfterMu  sync.RWMutex
+	ocspUpdateAfter    time.Time
+	// Done once Stop is called, cancelling the background refreshes.
+	stopped    context.Context
+	cancelStop context.CancelFunc
+	stopMu     sync.Mutex
+	// The goroutines spawned by Init, for which Stop waits.
+	goroutines sync.WaitGroup
 	// TODO(twifkak): Implement a registry of Updateable instances which can be configured in the toml.
+	// Built from the options, on first use; see getOCSPFile.
 	ocspFile     Updateable
+	ocspFileOnce sync.Once
 	ocspFilePath string
 	client       http.Client
 	// Given a certificate, returns a current OCSP response for the cert;
@@ -103,10 +149,55 @@ type CertCache struct {
 	NewCertFile string
 	// Is CertCache initialized to do cert renewal or OCSP refreshes?
 	isInitialized bool
+	// If non-zero, how often to check CertFile for rotation. See WatchCertFile.
+	certFileWatchInterval time.Duration
+	certFileRequireSign   bool
+	certFileModTime       time.Time
+	// If true, consult the cert's CRL when no valid OCSP response is
+	// available. See SetCRLFallback.
+	crlFallback bool
+	crlMu       sync.Mutex
+	// If in the future, the most recent CRL confirmed that the cert was not
+	// revoked, and will not be rechecked until then.
+	crlValidUntil time.Time
+	// When to refresh the OCSP response. See SetOCSPRefreshPolicy.
+	ocspRefreshFraction    float64
+	ocspMinRefreshInterval time.Duration
+	ocspMaxRefreshInterval time.Duration
+	// If non-zero, the OCSP response is instead refreshed this long after its
+	// ThisUpdate. See SetOCSPRefreshStrategy.
+	ocspFixedRefreshInterval time.Duration
+	// If non-nil, a SignedCertificateTimestampList to serve in the cert-chain
+	// for the cert named sctCertName. See SetSCTList.
+	sctList     []byte
+	sctCertName string
+	// If true, OCSP requests include a nonce, which must match the one in the
+	// response, if any. If ocspNonceRequired, the response must include it.
+	// See SetOCSPNonce.
+	ocspNonce         bool
+	ocspNonceRequired bool
+	// How far in the future an OCSP response's thisUpdate and producedAt may
+	// be. See SetOCSPClockSkew.
+	ocspClockSkew time.Duration
+	// How the OCSP response of renewedCerts is obtained. See
+	// SetRenewalOCSPBootstrap.
+	renewalOCSPBootstrap string
+	// Bounds the concurrent requests to each OCSP responder host, across all
+	// the cert chains fetched for. See SetOCSPMaxHostFetches.
+	ocspHostSemaphores *hostSemaphores
+	// When to renew the cert, and how often to check. See
+	// SetCertRenewalPolicy.
+	certRenewalFraction float64
+	certCheckInterval   time.Duration
+	// Receives diagnostics. See SetLogger.
+	logger          Logger
+	ocspLockTimeout time.Duration
 
 	// "Virtual methods", exposed for testing.
 	// Given a certificate, returns the OCSP responder URL for that cert.
 	extractOCSPServer func(*x509.Certificate) (string, error)
+	// Given a certificate, returns the CRL distribution point for that cert.
+	extractCRLServer func(*x509.Certificate) (string, error)
 	// Given an HTTP request/response, returns its cache expiry.
 	httpExpiry func(*http.Request, *http.Response) time.Time
 	timeNow    func() time.Time
@@ -127,6 +218,7 @@ func New(certs []*x509.Certificate, certFetcher *certfetcher.CertFetcher, domain
 	if len(certs) > 0 && certs[0] != nil {
 		certName = util.CertName(certs[0])
 	}
+	stopped, cancelStop := context.WithCancel(context.Background())
 	return &CertCache{
 		certName:        certName,
 		certs:           certs,
@@ -141,9 +233,9 @@ func New(certs []*x509.Certificate, certFetcher *certfetcher.CertFetcher, domain
 		//    certificate, all needing to staple an OCSP response. You don't
 		//    want to have all of them hammering the OCSP server - ideally,
 		//    you'd have one request, in the backend, and updating them all.
-		ocspFile:             &Chained{first: &InMemory{}, second: &LocalFile{path: ocspCache}},
 		ocspFilePath:         ocspCache,
-		stop:                 make(chan struct{}),
+		stopped:              stopped,
+		cancelStop:           cancelStop,
 		generateOCSPResponse: generateOCSPResponse,
 		client:               http.Client{Timeout: 60 * time.Second},
 		extractOCSPServer: func(cert *x509.Certificate) (string, error) {
@@ -153,6 +245,12 @@ func New(certs []*x509.Certificate, certFetcher *certfetcher.CertFetcher, domain
 			// This is a URI, per https://tools.ietf.org/html/rfc5280#section-4.2.2.1.
 			return cert.OCSPServer[0], nil
 		},
+		extractCRLServer: func(cert *x509.Certificate) (string, error) {
+			if cert == nil || len(cert.CRLDistributionPoints) < 1 {
+				return "", errors.New("Cert missing CRLDistributionPoints.")
+			}
+			return cert.CRLDistributionPoints[0], nil
+		},
 		httpExpiry: func(req *http.Request, resp *http.Response) time.Time {
 			reasons, expiry, err := cachecontrol.CachableResponse(req, resp, cachecontrol.Options{PrivateCache: true})
 			if len(reasons) > 0 || err != nil {
@@ -165,15 +263,192 @@ func New(certs []*x509.Certificate, certFetcher *certfetcher.CertFetcher, domain
 		CertFile:      certFile,
 		NewCertFile:   newCertFile,
 		isInitialized: false,
+		ocspClockSkew: defaultOCSPClockSkew,
+		logger:        StdLogger{},
 		timeNow:       timeNow,
 	}
 }
 
+// Returns the Updateable in which the OCSP response is cached: an in-memory
+// copy backed by the shared file at ocspFilePath. It's built on first use
+// (normally by Init), from the options set before then.
+func (this *CertCache) getOCSPFile() Updateable {
+	this.ocspFileOnce.Do(func() {
+		if this.ocspFile != nil {
+			return
+		}
+		disk := newVersioned(&LocalFile{path: this.ocspFilePath, leaseTimeout: this.ocspLockTimeout, logger: this.logger}, ocspFileFormat, ocspFileFormatVersion, this.logger)
+		this.ocspFile = &Chained{first: &InMemory{}, second: disk, logger: this.logger}
+	})
+	return this.ocspFile
+}
+
+// Sets how long a replica may hold the lock on the shared OCSP cache while
+// refreshing it, before other replicas consider it abandoned. Must be called
+// before Init().
+func (this *CertCache) SetOCSPLockTimeout(lockTimeout time.Duration) {
+	this.ocspLockTimeout = lockTimeout
+}
+
+// If enabled, includes a random nonce in each OCSP request, and rejects (and
+// keeps the previously cached response in place of) any response that echoes a
+// different nonce. Responses that omit the nonce, as many do when served from a
+// cache, are accepted unless required is also set. Must be called before
+// Init().
+func (this *CertCache) SetOCSPNonce(enabled, required bool) {
+	this.ocspNonce = enabled || required
+	this.ocspNonceRequired = required
+}
+
+// Sets how far in the future the thisUpdate and producedAt of a fetched OCSP
+// response may be, to tolerate clock skew between the packager and the OCSP
+// responder. Responses further in the future are rejected. Zero tolerates no
+// skew; if this isn't called, the default is 5 minutes. Must be called before
+// Init().
+func (this *CertCache) SetOCSPClockSkew(skew time.Duration) {
+	this.ocspClockSkew = skew
+}
+
+// Sets how the OCSP response of a renewed cert chain (i.e. NewCertFile) is
+// obtained before it replaces the current one: util.RenewalOCSPReuse (the
+// default, if empty) or util.RenewalOCSPFetch. Must be called before Init().
+func (this *CertCache) SetRenewalOCSPBootstrap(policy string) {
+	this.renewalOCSPBootstrap = policy
+}
+
+// Limits how many OCSP requests may be in flight to any one responder host at
+// once, so that fetches for several cert chains (e.g. the current and the
+// renewed one) don't open too many simultaneous connections to it. Further
+// fetches wait their turn. Zero (the default) is unlimited. Must be called
+// before Init().
+func (this *CertCache) SetOCSPMaxHostFetches(limit int) {
+	this.ocspHostSemaphores = newHostSemaphores(limit)
+}
+
+// Trusts the certificates in the given PEM bundle, in addition to the system
+// roots, when verifying HTTPS connections to the OCSP responder and CRL server,
+// e.g. for a responder fronted by a proxy with a cert from an internal CA. Must
+// be called before Init().
+func (this *CertCache) SetOCSPCABundle(bundle []byte) error {
+	roots, err := x509.SystemCertPool()
+	if err != nil || roots == nil {
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(bundle) {
+		return errors.New("no certificates found in OCSP CA bundle")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	this.client.Transport = transport
+	return nil
+}
+
+// Sets the Logger to which diagnostics are written, in place of the default
+// StdLogger. Must be called before Init().
+func (this *CertCache) SetLogger(logger Logger) {
+	if logger == nil {
+		logger = StdLogger{}
+	}
+	this.logger = logger
+}
+
+// If enabled, then when no valid OCSP response is available, IsHealthy falls
+// back to checking the CRL named in the cert's CRLDistributionPoints, and
+// reports healthy if it confirms the cert is not revoked. Must be called before
+// Init().
+func (this *CertCache) SetCRLFallback(enabled bool) {
+	this.crlFallback = enabled
+}
+
+// Sets when the OCSP response is refreshed: once the given fraction of its
+// validity period (ThisUpdate to NextUpdate) has elapsed, but no sooner than
+// minInterval and no later than maxInterval after its ThisUpdate, and never
+// later than its NextUpdate. minInterval also applies to refreshes requested by
+// the OCSP responder's HTTP cache headers. Zero values select the defaults:
+// refresh at the midpoint, with no minimum or maximum interval. Must be called
+// before Init().
+func (this *CertCache) SetOCSPRefreshPolicy(fraction float64, minInterval, maxInterval time.Duration) {
+	this.ocspRefreshFraction = fraction
+	this.ocspMinRefreshInterval = minInterval
+	this.ocspMaxRefreshInterval = maxInterval
+}
+
+// Sets the strategy by which the OCSP response refresh time is computed:
+// util.OCSPRefreshMidpoint (the default), per SetOCSPRefreshPolicy, or
+// util.OCSPRefreshFixed, the given interval after its ThisUpdate, but never
+// later than its NextUpdate. The minInterval of SetOCSPRefreshPolicy applies
+// to both. Must be called before Init().
+func (this *CertCache) SetOCSPRefreshStrategy(strategy string, interval time.Duration) {
+	if strategy == util.OCSPRefreshFixed {
+		this.ocspFixedRefreshInterval = interval
+	} else {
+		this.ocspFixedRefreshInterval = 0
+	}
+}
+
+// Sets when the cert is renewed: once the given fraction of its lifetime
+// (NotBefore to NotAfter) has elapsed, but no later than certRenewalInterval
+// before its NotAfter. The cert is checked every checkInterval. Zero values
+// select the defaults: renew at 2/3 of its lifetime, checking daily. Must be
+// called before Init().
+func (this *CertCache) SetCertRenewalPolicy(fraction float64, checkInterval time.Duration) {
+	this.certRenewalFraction = fraction
+	this.certCheckInterval = checkInterval
+}
+
+// Sets a SignedCertificateTimestampList (Section 3.3 of RFC6962), to be served
+// in the "sct" field of the cert-chain for the current cert, for CAs that don't
+// embed SCTs in the cert or staple them to the OCSP response. It is not served
+// for any cert that replaces the current one (e.g. on renewal), since SCTs are
+// specific to a cert. Must be called before Init().
+func (this *CertCache) SetSCTList(sct []byte) error {
+	if err := validateSCTList(sct); err != nil {
+		return err
+	}
+	this.sctList = sct
+	this.sctCertName = this.certName
+	return nil
+}
+
+// Checks that sct is a well-formed SignedCertificateTimestampList: a non-empty
+// list of non-empty SerializedSCTs, each prefixed (as is the whole list) by its
+// 2-byte length.
+func validateSCTList(sct []byte) error {
+	if len(sct) < 2 || int(sct[0])<<8|int(sct[1]) != len(sct)-2 {
+		return errors.New("SCT list has invalid length")
+	}
+	rest := sct[2:]
+	if len(rest) == 0 {
+		return errors.New("SCT list is empty")
+	}
+	for len(rest) > 0 {
+		if len(rest) < 2 {
+			return errors.New("SCT list has truncated entry")
+		}
+		n := int(rest[0])<<8 | int(rest[1])
+		if n == 0 || n > len(rest)-2 {
+			return errors.New("SCT list has invalid entry length")
+		}
+		rest = rest[2+n:]
+	}
+	return nil
+}
+
+// Configures the CertCache to check CertFile for modifications every interval,
+// and when it has been replaced with a new cert chain, to start serving that
+// instead. See reloadCertFileIfChanged. If requireSign is true, the new cert
+// must have the CanSignHttpExchanges extension. Must be called before Init().
+func (this *CertCache) WatchCertFile(interval time.Duration, requireSign bool) {
+	this.certFileWatchInterval = interval
+	this.certFileRequireSign = requireSign
+}
+
 func (this *CertCache) Init() error {
+	this.getOCSPFile()
 	this.updateCertIfNecessary()
 
 	// Prime the OCSP disk and memory cache, so we can start serving immediately.
-	_, _, err := this.readOCSP(true)
+	_, _, err := this.readOCSPWithContext(this.stopped, true)
 	if err != nil {
 		return errors.Wrap(err, "initializing CertCache")
 	}
@@ -185,29 +460,40 @@ func (this *CertCache) Init() error {
 	//    like the OCSP responder giving you junk, but also sufficient time
 	//    to raise an alert if something has gone really wrong.
 	// 7. The ability to serve old responses while fetching new responses.
-	go this.maintainOCSP()
+	// The first check is scheduled before the goroutine starts, so that it
+	// reads the freshly primed cache rather than racing with the caller.
+	this.goroutines.Add(1)
+	go this.maintainOCSP(this.scheduleOCSPCheck())
 
 	if this.certFetcher != nil {
 		// Update Certs in the background.
+		this.goroutines.Add(1)
 		go this.maintainCerts()
 	}
 
+	if this.certFileWatchInterval > 0 {
+		if stat, err := os.Stat(this.CertFile); err == nil {
+			this.certFileModTime = stat.ModTime()
+		}
+		this.goroutines.Add(1)
+		go this.watchCertFile()
+	}
+
 	this.isInitialized = true
 
 	return nil
 }
 
-// Stop stops the goroutines spawned in Init, which are automatically updating the certificate and the OCSP response.
-// It returns true if the call actually stops them, false if they have already been stopped.
+// Stop stops the goroutines spawned in Init, which are automatically updating the certificate and the OCSP response,
+// abandoning any refresh in progress, and blocks until they have exited. It is safe to call more than once, and
+// concurrently. It returns true if the call actually stops them, false if they have already been stopped.
 func (this *CertCache) Stop() bool {
-	select {
-	// this.stop will never be used for sending a value. Thus this case matches only when it has already been closed.
-	case <-this.stop:
-		return false
-	default:
-		close(this.stop)
-		return true
-	}
+	this.stopMu.Lock()
+	first := this.stopped.Err() == nil
+	this.cancelStop()
+	this.stopMu.Unlock()
+	this.goroutines.Wait()
+	return first
 }
 
 // Gets the latest cert.
@@ -225,33 +511,83 @@ func (this *CertCache) GetLatestCert() *x509.Certificate {
 		return nil
 	}
 
-	d, err := util.GetDurationToExpiry(this.getCert(), this.timeNow())
+	now := this.timeNow()
+	_, err := util.GetDurationToExpiry(this.getCert(), now)
 	if err != nil {
 		// Current cert is already invalid. Check if renewal is available.
-		log.Println("Current cert is expired, attempting to renew: ", err)
+		this.logger.Warn("Current cert is expired, attempting to renew", "err", err)
 		this.updateCertIfNecessary()
 		return this.getCert()
 	}
-	if d >= time.Duration(certRenewalInterval) {
-		// Cert is still valid.
-		return this.getCert()
-	} else if d < time.Duration(certRenewalInterval) {
+	if this.isCertDueForRenewal(this.getCert(), now) {
 		// Cert is still valid, but we need to start process of requesting new cert.
-		log.Println("Current cert is close to expiry threshold, attempting to renew in the background.")
-		return this.getCert()
+		this.logger.Info("Current cert crossed threshold for renewal, attempting to renew in the background")
 	}
-	return nil
+	return this.getCert()
+}
+
+// Returns the time at which the given cert should be renewed, per
+// SetCertRenewalPolicy.
+func (this *CertCache) certRenewalTime(cert *x509.Certificate) time.Time {
+	fraction := this.certRenewalFraction
+	if fraction == 0 {
+		fraction = defaultCertRenewalFraction
+	}
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	renewalTime := cert.NotBefore.Add(time.Duration(fraction * float64(lifetime)))
+	if latest := cert.NotAfter.Add(-certRenewalInterval); renewalTime.After(latest) {
+		return latest
+	}
+	return renewalTime
+}
+
+// Returns true if the given (valid) cert has reached its renewal time as of now.
+func (this *CertCache) isCertDueForRenewal(cert *x509.Certificate, now time.Time) bool {
+	return !now.Before(this.certRenewalTime(cert))
+}
+
+// Returns the NextUpdate of the current OCSP response. Returns the zero time if
+// the cache has not been initialized (and thus isn't maintaining an OCSP
+// response) or the OCSP response is unavailable.
+func (this *CertCache) GetOCSPExpiry() time.Time {
+	if !this.isInitialized {
+		return time.Time{}
+	}
+	ocsp, _, err := this.readOCSP(false)
+	if err != nil {
+		this.logger.Error("Error reading OCSP", "err", err)
+		return time.Time{}
+	}
+	ocspResp, err := this.parseOCSP(ocsp, this.findIssuer())
+	if err != nil {
+		this.logger.Warn("Invalid OCSP", "err", err)
+		return time.Time{}
+	}
+	return ocspResp.NextUpdate
 }
 
 func (this *CertCache) createCertChainCBOR(ocsp []byte) ([]byte, error) {
 	this.certsMu.RLock()
 	defer this.certsMu.RUnlock()
 
-	certChain := make(certurl.CertChain, len(this.certs))
-	for i, cert := range this.certs {
+	var sctList []byte
+	if this.certName == this.sctCertName {
+		sctList = this.sctList
+	}
+	return certChainCBOR(this.certs, ocsp, sctList)
+}
+
+// Returns the application/cert-chain+cbor encoding of certs, with the given
+// OCSP response and (if non-nil) SignedCertificateTimestampList for the leaf.
+func certChainCBOR(certs []*x509.Certificate, ocsp []byte, sctList []byte) ([]byte, error) {
+	certChain := make(certurl.CertChain, len(certs))
+	for i, cert := range certs {
 		certChain[i] = &certurl.AugmentedCertificate{Cert: cert}
 	}
 	certChain[0].OCSPResponse = ocsp
+	if sctList != nil {
+		certChain[0].SCTList = sctList
+	}
 
 	var buf bytes.Buffer
 	err := certChain.Write(&buf)
@@ -269,8 +605,49 @@ func (this *CertCache) parseOCSP(bytes []byte, issuer *x509.Certificate) (*ocsp.
 	return resp, nil
 }
 
-func (this *CertCache) ocspMidpoint(resp *ocsp.Response) time.Time {
-	return resp.ThisUpdate.Add(resp.NextUpdate.Sub(resp.ThisUpdate) / 2)
+// Returns the time after which resp should be refreshed, per the policy set by
+// SetOCSPRefreshPolicy and SetOCSPRefreshStrategy.
+func (this *CertCache) ocspRefreshTime(resp *ocsp.Response) time.Time {
+	validity := resp.NextUpdate.Sub(resp.ThisUpdate)
+	var interval time.Duration
+	if this.ocspFixedRefreshInterval > 0 {
+		interval = this.ocspFixedRefreshInterval
+	} else {
+		fraction := this.ocspRefreshFraction
+		if fraction == 0 {
+			fraction = defaultOCSPRefreshFraction
+		}
+		interval = time.Duration(float64(validity) * fraction)
+		if this.ocspMaxRefreshInterval > 0 && interval > this.ocspMaxRefreshInterval {
+			interval = this.ocspMaxRefreshInterval
+		}
+	}
+	if interval < this.ocspMinRefreshInterval {
+		interval = this.ocspMinRefreshInterval
+	}
+	if interval > validity {
+		interval = validity
+	}
+	return resp.ThisUpdate.Add(interval)
+}
+
+// Returns the cached OCSP response, without refreshing it (or even reading it
+// from disk, if it's in memory).
+func (this *CertCache) readCachedOCSP() ([]byte, error) {
+	ocsp, err := this.getOCSPFile().Read(context.Background(), func([]byte) bool { return false }, nil)
+	if err == nil && len(ocsp) == 0 {
+		err = errors.New("Missing OCSP response.")
+	}
+	return ocsp, err
+}
+
+// ACMEChallengeHandler returns the handler for ACME HTTP-01 challenges that
+// the cert fetcher expects amppkg's server to route, or nil if there is none.
+func (this *CertCache) ACMEChallengeHandler() http.Handler {
+	if this.certFetcher == nil || this.certFetcher.HTTPChallengeHandler == nil {
+		return nil
+	}
+	return this.certFetcher.HTTPChallengeHandler
 }
 
 func (this *CertCache) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
@@ -286,21 +663,18 @@ func (this *CertCache) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 		resp.Header().Set("Content-Type", "application/cert-chain+cbor")
 		// Instruct the intermediary to reload this cert-chain at the
 		// OCSP midpoint, in case it cannot parse it.
-		ocsp, _, err := this.readOCSP(false)
+		ocsp, expiry, err := this.readOCSPAndExpiry()
 		if err != nil {
-			util.NewHTTPError(http.StatusInternalServerError, "Error reading OCSP: ", err).LogAndRespond(resp)
-			return
-		}
-		ocspResp, err := this.parseOCSP(ocsp, this.findIssuer())
-		if err != nil {
-			log.Println("Invalid OCSP:", err)
-			util.NewHTTPError(http.StatusInternalServerError, "Invalid OCSP: ", err).LogAndRespond(resp)
-			return
-		}
-		midpoint := this.ocspMidpoint(ocspResp)
-		// int is large enough to represent 24855 days in seconds.
-		expiry := int(midpoint.Sub(this.timeNow()).Seconds())
-		if expiry < 0 {
+			if crlErr := this.checkCRL(); crlErr != nil {
+				util.NewHTTPError(http.StatusInternalServerError, err.Error()).LogAndRespond(resp)
+				return
+			}
+			// The CRL confirms the cert is still good, but there is no
+			// OCSP response to serve in its place. Serve what we have,
+			// but instruct the intermediary to reload it ASAP.
+			if ocsp == nil {
+				ocsp = []byte{}
+			}
 			expiry = 0
 		}
 		resp.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(expiry))
@@ -311,21 +685,78 @@ func (this *CertCache) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 			return
 		}
 		http.ServeContent(resp, req, "", time.Time{}, bytes.NewReader(cbor))
+	} else if this.previousCertName != "" && params["certName"] == this.previousCertName && this.timeNow().Before(this.previousCertsUntil) {
+		// SXGs signed before the last renewal still reference the previous
+		// cert chain. It is no longer refreshed, so instruct the
+		// intermediary to keep it only until its OCSP response expires.
+		resp.Header().Set("Content-Type", "application/cert-chain+cbor")
+		resp.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(this.previousCertsUntil.Sub(this.timeNow()).Seconds())))
+		resp.Header().Set("X-Content-Type-Options", "nosniff")
+		var sctList []byte
+		if this.previousCertName == this.sctCertName {
+			sctList = this.sctList
+		}
+		cbor, err := certChainCBOR(this.previousCerts, this.previousOCSP, sctList)
+		if err != nil {
+			util.NewHTTPError(http.StatusInternalServerError, "Error building cert chain: ", err).LogAndRespond(resp)
+			return
+		}
+		http.ServeContent(resp, req, "", time.Time{}, bytes.NewReader(cbor))
 	} else {
 		http.NotFound(resp, req)
 	}
 }
 
+// Returns the current OCSP response and the number of seconds until it is due
+// to be refreshed, or expires, whichever is sooner. On error, returns whatever OCSP response is cached, if any.
+func (this *CertCache) readOCSPAndExpiry() ([]byte, int, error) {
+	ocsp, _, err := this.readOCSP(false)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "Error reading OCSP")
+	}
+	ocspResp, err := this.parseOCSP(ocsp, this.findIssuer())
+	if err != nil {
+		return ocsp, 0, errors.Wrap(err, "Invalid OCSP")
+	}
+	refreshTime := this.ocspRefreshTime(ocspResp)
+	// Never instruct the intermediary to keep the response past its
+	// NextUpdate, e.g. for a short-lived responder.
+	if refreshTime.After(ocspResp.NextUpdate) {
+		refreshTime = ocspResp.NextUpdate
+	}
+	// int is large enough to represent 24855 days in seconds.
+	expiry := int(refreshTime.Sub(this.timeNow()).Seconds())
+	if expiry < 0 {
+		expiry = 0
+	}
+	return ocsp, expiry, nil
+}
+
 // If we've been unable to fetch a fresh OCSP response before expiry of the old
 // one, or, at server start-up, if we're unable to fetch a valid OCSP request at
 // all (either from disk or network), then return false. This signals to the
 // packager that it should not try to package anything; just proxy the content
 // unsigned. This is per sleevi requirement:
-// 8. Some idea of what to do when "things go bad".
-//    What happens when it's been 7 days, no new OCSP response can be obtained,
-//    and the current response is about to expire?
+//  8. Some idea of what to do when "things go bad".
+//     What happens when it's been 7 days, no new OCSP response can be obtained,
+//     and the current response is about to expire?
 func (this *CertCache) IsHealthy() error {
-	ocsp, _, errorOCSP := this.readOCSP(false)
+	err := this.IsOCSPHealthy(context.Background())
+	if err == nil || !this.crlFallback {
+		return err
+	}
+	if crlErr := this.checkCRL(); crlErr != nil {
+		return errors.Wrapf(err, "CRL fallback failed: %v", crlErr)
+	}
+	return nil
+}
+
+// Like IsHealthy, but without CRL fallback. SXGs can only be verified with an
+// OCSP response, so this should be used when deciding whether to sign. ctx
+// bounds any OCSP fetch this makes, e.g. to the lifetime of the request being
+// signed.
+func (this *CertCache) IsOCSPHealthy(ctx context.Context) error {
+	ocsp, _, errorOCSP := this.readOCSPWithContext(ctx, false)
 	if errorOCSP != nil {
 		return errorOCSP
 	}
@@ -336,15 +767,202 @@ func (this *CertCache) IsHealthy() error {
 	return nil
 }
 
+// A snapshot of the state of the current cert and OCSP response, for
+// diagnostics. Times are omitted when unknown.
+type Status struct {
+	Subject   string    `json:"subject"`
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+	// Describes why the OCSP fields are missing, if they are.
+	OCSPError       string     `json:"ocspError,omitempty"`
+	OCSPThisUpdate  *time.Time `json:"ocspThisUpdate,omitempty"`
+	OCSPNextUpdate  *time.Time `json:"ocspNextUpdate,omitempty"`
+	OCSPProducedAt  *time.Time `json:"ocspProducedAt,omitempty"`
+	OCSPUpdateAfter *time.Time `json:"ocspUpdateAfter,omitempty"`
+	// True if the response is past the time the refresh policy (see
+	// SetOCSPRefreshPolicy) would have it refreshed.
+	OCSPPastRefreshTime bool `json:"ocspPastRefreshTime"`
+}
+
+// Returns a snapshot of the current cert and OCSP response. Reads only from
+// memory, so never triggers an OCSP fetch (or even a disk read). Returns nil if
+// there is no cert.
+func (this *CertCache) Status() *Status {
+	this.certsMu.RLock()
+	certs := this.certs
+	this.certsMu.RUnlock()
+	if len(certs) == 0 || certs[0] == nil {
+		return nil
+	}
+	cert := certs[0]
+	status := Status{
+		Subject:   cert.Subject.String(),
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+	}
+	this.ocspUpdateAfterMu.RLock()
+	if !this.ocspUpdateAfter.Equal(infiniteFuture) {
+		updateAfter := this.ocspUpdateAfter
+		status.OCSPUpdateAfter = &updateAfter
+	}
+	this.ocspUpdateAfterMu.RUnlock()
+
+	ocspBytes, err := this.readCachedOCSP()
+	if err != nil {
+		status.OCSPError = err.Error()
+		return &status
+	}
+	ocspResp, err := ocsp.ParseResponseForCert(ocspBytes, cert, this.findIssuerUsingCerts(certs))
+	if err != nil {
+		status.OCSPError = errors.Wrap(err, "Parsing OCSP").Error()
+		return &status
+	}
+	status.OCSPThisUpdate = &ocspResp.ThisUpdate
+	status.OCSPNextUpdate = &ocspResp.NextUpdate
+	status.OCSPProducedAt = &ocspResp.ProducedAt
+	status.OCSPPastRefreshTime = this.timeNow().After(this.ocspRefreshTime(ocspResp))
+	return &status
+}
+
+// Synchronously reads the OCSP response into the cache, fetching a new one if
+// none is cached, or the cached one is due for refresh, and checks that the
+// result is fresh: present, valid for the current cert, unexpired, and not
+// past its refresh time. Unlike Init, this doesn't retry failed fetches, or start
+// the background goroutines that maintain the response, so it can be used to
+// pre-warm the cache and verify it before a new instance goes live. Returns
+// the resulting Status, for diagnostics (nil if there is no cert), and an error
+// describing why the response isn't fresh, if it isn't.
+func (this *CertCache) PrewarmOCSP(ctx context.Context) (*Status, error) {
+	// readOCSP rejects missing, invalid, and expired responses.
+	_, _, err := this.readOCSPWithContext(ctx, false)
+	status := this.Status()
+	if err != nil {
+		return status, errors.Wrap(err, "reading OCSP")
+	}
+	if status == nil {
+		return nil, errors.New("no cert")
+	}
+	if status.OCSPError != "" {
+		return status, errors.New(status.OCSPError)
+	}
+	if status.OCSPPastRefreshTime {
+		return status, errors.Errorf("OCSP response is past its refresh time, and could not be refreshed, ThisUpdate: %v, NextUpdate: %v", *status.OCSPThisUpdate, *status.OCSPNextUpdate)
+	}
+	return status, nil
+}
+
+// Fetches a new OCSP response for the current cert chain, even if the cached
+// one isn't due for refresh, e.g. when an operator sends SIGHUP. If the fetch
+// fails, or its response is rejected, the cached response continues to be
+// served, and an error is returned.
+func (this *CertCache) RefreshOCSP(ctx context.Context) error {
+	var ocspUpdateAfter time.Time
+	refreshed := false
+	var unhealthy error
+	this.certsMu.RLock()
+	_, err := this.getOCSPFile().Read(ctx, func([]byte) bool { return true }, func(orig []byte) []byte {
+		resp := this.fetchOCSP(ctx, orig, this.certs, &ocspUpdateAfter, false)
+		if len(resp) == 0 || bytes.Equal(resp, orig) {
+			return orig
+		}
+		// Check the new response before it's persisted, so that a bad one
+		// doesn't replace the cached response.
+		if unhealthy = this.isHealthyUsingCerts(resp, this.certs); unhealthy != nil {
+			return orig
+		}
+		refreshed = true
+		return resp
+	})
+	this.certsMu.RUnlock()
+	if err != nil {
+		return errors.Wrap(err, "Updating OCSP cache")
+	}
+	if unhealthy != nil {
+		return errors.Wrap(unhealthy, "OCSP failed health check; serving the cached response")
+	}
+	if !ocspUpdateAfter.Equal(time.Time{}) {
+		this.ocspUpdateAfterMu.Lock()
+		this.ocspUpdateAfter = ocspUpdateAfter
+		this.ocspUpdateAfterMu.Unlock()
+	}
+	if !refreshed {
+		return errors.New("OCSP refresh failed; serving the cached response")
+	}
+	return nil
+}
+
+// Confirms, via the CRL named in the current cert's CRLDistributionPoints,
+// that the cert has not been revoked. This is a fallback for CAs with flaky
+// OCSP responders, used when no valid OCSP response is available. A successful
+// result is cached until the CRL's NextUpdate.
+func (this *CertCache) checkCRL() error {
+	if !this.crlFallback {
+		return errors.New("CRL fallback is disabled.")
+	}
+	this.crlMu.Lock()
+	defer this.crlMu.Unlock()
+	if this.timeNow().Before(this.crlValidUntil) {
+		return nil
+	}
+	cert := this.getCert()
+	issuer := this.findIssuer()
+	if cert == nil || issuer == nil {
+		return errors.New("Cannot find issuer certificate in CertFile.")
+	}
+	crlServer, err := this.extractCRLServer(cert)
+	if err != nil {
+		return err
+	}
+	httpResp, err := this.client.Get(crlServer)
+	if err != nil {
+		return errors.Wrap(err, "Error issuing CRL request")
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return errors.Errorf("CRL request returned status %d", httpResp.StatusCode)
+	}
+	der, err := ioutil.ReadAll(io.LimitReader(httpResp.Body, maxCRLBytes))
+	if err != nil {
+		return errors.Wrap(err, "Error reading CRL")
+	}
+	crl, err := x509.ParseCRL(der)
+	if err != nil {
+		return errors.Wrap(err, "Error parsing CRL")
+	}
+	if err := issuer.CheckCRLSignature(crl); err != nil {
+		return errors.Wrap(err, "Invalid CRL signature")
+	}
+	if crl.HasExpired(this.timeNow()) {
+		return errors.Errorf("CRL is stale, NextUpdate: %v", crl.TBSCertList.NextUpdate)
+	}
+	for _, revoked := range crl.TBSCertList.RevokedCertificates {
+		if revoked.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			return errors.Errorf("Cert revoked at %v, per CRL", revoked.RevocationTime)
+		}
+	}
+	this.logger.Warn("No valid OCSP response; in CRL-fallback mode. CRL confirms cert is not revoked", "crlServer", crlServer)
+	this.crlValidUntil = crl.TBSCertList.NextUpdate
+	return nil
+}
+
 func (this *CertCache) isHealthy(ocspResp []byte) error {
+	this.certsMu.RLock()
+	certs := this.certs
+	this.certsMu.RUnlock()
+	return this.isHealthyUsingCerts(ocspResp, certs)
+}
+
+// Like isHealthy, but checks that the OCSP response is valid for the
+// specified cert chain (rather than the current one).
+func (this *CertCache) isHealthyUsingCerts(ocspResp []byte, certs []*x509.Certificate) error {
 	if ocspResp == nil {
 		return errors.New("OCSP response not yet fetched.")
 	}
-	issuer := this.findIssuer()
+	issuer := this.findIssuerUsingCerts(certs)
 	if issuer == nil {
 		return errors.New("Cannot find issuer certificate in CertFile.")
 	}
-	resp, err := ocsp.ParseResponseForCert(ocspResp, this.getCert(), issuer)
+	resp, err := ocsp.ParseResponseForCert(ocspResp, certs[0], issuer)
 	if err != nil {
 		return errors.Wrap(err, "Error parsing OCSP response")
 	}
@@ -354,13 +972,13 @@ func (this *CertCache) isHealthy(ocspResp []byte) error {
 	return nil
 }
 
-func (this *CertCache) readOCSPHelper(numTries int, exhaustedRetries bool) ([]byte, time.Time, error) {
+func (this *CertCache) readOCSPHelper(ctx context.Context, numTries int, exhaustedRetries bool) ([]byte, time.Time, error) {
 	var ocspUpdateAfter time.Time
 
 	this.certsMu.RLock()
 	defer this.certsMu.RUnlock()
-	ocsp, err := this.ocspFile.Read(context.Background(), this.shouldUpdateOCSP, func(orig []byte) []byte {
-		return this.fetchOCSP(orig, this.certs, &ocspUpdateAfter, numTries > 0)
+	ocsp, err := this.getOCSPFile().Read(ctx, this.shouldUpdateOCSP, func(orig []byte) []byte {
+		return this.fetchOCSP(ctx, orig, this.certs, &ocspUpdateAfter, numTries > 0)
 	})
 	if err != nil {
 		if exhaustedRetries {
@@ -389,6 +1007,11 @@ func (this *CertCache) readOCSPHelper(numTries int, exhaustedRetries bool) ([]by
 
 // Returns the OCSP response and expiry, refreshing if necessary.
 func (this *CertCache) readOCSP(allowRetries bool) ([]byte, time.Time, error) {
+	return this.readOCSPWithContext(context.Background(), allowRetries)
+}
+
+// Like readOCSP, but any refresh is abandoned once ctx is done.
+func (this *CertCache) readOCSPWithContext(ctx context.Context, allowRetries bool) ([]byte, time.Time, error) {
 	var ocspUpdateAfter time.Time
 	var err error
 	var maxTries int
@@ -403,7 +1026,7 @@ func (this *CertCache) readOCSP(allowRetries bool) ([]byte, time.Time, error) {
 	}
 
 	for numTries := 0; numTries < maxTries; {
-		ocsp, ocspUpdateAfter, err = this.readOCSPHelper(numTries, numTries >= maxTries-1)
+		ocsp, ocspUpdateAfter, err = this.readOCSPHelper(ctx, numTries, numTries >= maxTries-1)
 		if err != nil {
 			return nil, ocspUpdateAfter, err
 		}
@@ -412,7 +1035,10 @@ func (this *CertCache) readOCSP(allowRetries bool) ([]byte, time.Time, error) {
 		}
 		// Wait only if are not on our last try.
 		if numTries < maxTries-1 {
-			waitTimeInMinutes = waitForSpecifiedTime(waitTimeInMinutes, numTries)
+			waitTimeInMinutes = this.waitForSpecifiedTime(ctx, waitTimeInMinutes, numTries)
+			if ctx.Err() != nil {
+				return nil, ocspUpdateAfter, errors.Wrap(ctx.Err(), "retrying OCSP")
+			}
 		}
 		numTries++
 	}
@@ -428,24 +1054,30 @@ func (this *CertCache) readOCSP(allowRetries bool) ([]byte, time.Time, error) {
 }
 
 // Print # of retries, wait for specified time and returned updated wait time.
-func waitForSpecifiedTime(waitTimeInMinutes int, numRetries int) int {
-	log.Printf("Retrying OCSP server: retry #%d", numRetries)
+// The wait is cut short if ctx is done.
+func (this *CertCache) waitForSpecifiedTime(ctx context.Context, waitTimeInMinutes int, numRetries int) int {
 	// Wait using exponential backoff.
-	log.Printf("Waiting for %d minute(s)", waitTimeInMinutes)
 	waitTimeDuration := time.Duration(waitTimeInMinutes) * time.Minute
+	this.logger.Info("Retrying OCSP server", "retry", numRetries, "wait", waitTimeDuration)
 	// For exponential backoff.
 	newWaitTimeInMinutes := 2 * waitTimeInMinutes
 	if newWaitTimeInMinutes > 10 {
 		// Cap the wait time at 10 minutes.
 		newWaitTimeInMinutes = 10
 	}
-	time.Sleep(waitTimeDuration)
+	timer := time.NewTimer(waitTimeDuration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
 	return newWaitTimeInMinutes
 }
 
-// Checks for OCSP updates every hour. Terminates only when stop receives
-// a message.
-func (this *CertCache) maintainOCSP() {
+// Checks for OCSP updates after firstWait, then every hour, or sooner if the
+// response is due to be refreshed sooner. Terminates only when stopped.
+func (this *CertCache) maintainOCSP(firstWait time.Duration) {
+	defer this.goroutines.Done()
 	// Only make one request per ocspCheckInterval, to minimize the impact
 	// on OCSP servers that are buckling under load, per sleevi requirement:
 	// 5. As with any system doing background requests on a remote server,
@@ -454,32 +1086,65 @@ func (this *CertCache) maintainOCSP() {
 	//    has trouble getting a request, hopefully it does something
 	//    smarter than just retry in a busy loop, hammering the OCSP server
 	//    into further oblivion.
-	ticker := time.NewTicker(ocspCheckInterval)
+	timer := time.NewTimer(firstWait)
 
 	for {
 		select {
-		case <-ticker.C:
-			_, _, err := this.readOCSP(true)
+		case <-timer.C:
+			_, _, err := this.readOCSPWithContext(this.stopped, true)
 			if err != nil {
-				log.Println("Warning: OCSP update failed. Cached response may expire:", err)
+				this.logger.Warn("OCSP update failed; cached response may expire", "err", err)
 			}
-		case <-this.stop:
-			ticker.Stop()
+			timer.Reset(this.scheduleOCSPCheck())
+		case <-this.stopped.Done():
+			timer.Stop()
 			return
 		}
 	}
 }
 
+// Returns nextOCSPCheck(), logging it. The wait is computed from a snapshot
+// of the real clock, which the timer runs on, rather than from timeNow, so
+// that scheduling has no effect on a fake clock used by tests.
+func (this *CertCache) scheduleOCSPCheck() time.Duration {
+	wait := this.nextOCSPCheck(time.Now())
+	this.logger.Debug("OCSP refresh check scheduled", "in", wait)
+	return wait
+}
+
+// Returns how long, as of now, maintainOCSP should wait before checking for
+// OCSP updates: ocspCheckInterval, or if the cached response is due to be
+// refreshed before then, until that time (but at least ocspMinCheckInterval).
+// If it is already due, e.g. because the last update failed, it waits the
+// full ocspCheckInterval, so as not to hammer a struggling OCSP responder.
+func (this *CertCache) nextOCSPCheck(now time.Time) time.Duration {
+	ocsp, err := this.readCachedOCSP()
+	if err != nil {
+		return ocspCheckInterval
+	}
+	ocspResp, err := this.parseOCSP(ocsp, this.findIssuer())
+	if err != nil {
+		return ocspCheckInterval
+	}
+	wait := this.ocspRefreshTime(ocspResp).Sub(now)
+	if wait <= 0 || wait > ocspCheckInterval {
+		return ocspCheckInterval
+	}
+	if wait < ocspMinCheckInterval {
+		return ocspMinCheckInterval
+	}
+	return wait
+}
+
 // Returns true if OCSP is expired (or near enough).
 func (this *CertCache) shouldUpdateOCSP(ocsp []byte) bool {
 	if len(ocsp) == 0 {
-		// TODO(twifkak): Use a logging framework with support for debug-only statements.
-		log.Println("Updating OCSP; none cached yet.")
+		this.logger.Info("Updating OCSP; none cached yet")
 		return true
 	}
 	issuer := this.findIssuer()
 	if issuer == nil {
-		log.Println("Cannot find issuer certificate in CertFile.")
+		this.logger.Error("Cannot find issuer certificate in CertFile")
 		// This is a permanent error; do not attempt OCSP update.
 		return false
 	}
@@ -487,17 +1152,21 @@ func (this *CertCache) shouldUpdateOCSP(ocsp []byte) bool {
 	if err != nil {
 		// An old ocsp cache causes a parse error in case of cert renewal. Do not log it.
 		if this.isInitialized {
-			log.Println("Invalid OCSP:", err)
+			this.logger.Warn("Invalid OCSP", "err", err)
 		}
 		return true
 	}
-	// Compute the midpoint per sleevi #3 (see above).
-	midpoint := this.ocspMidpoint(ocspResp)
-	if this.timeNow().After(midpoint) {
-		// TODO(twifkak): Use a logging framework with support for debug-only statements.
-		log.Println("Updating OCSP; after midpoint: ", midpoint)
+	// Compute the refresh time (by default, the midpoint) per sleevi #3 (see
+	// above).
+	refreshTime := this.ocspRefreshTime(ocspResp)
+	if this.timeNow().After(refreshTime) {
+		this.logger.Info("Updating OCSP; after refresh time", "refreshTime", refreshTime)
 		return true
 	}
+	if this.ocspMinRefreshInterval > 0 && this.timeNow().Before(ocspResp.ThisUpdate.Add(this.ocspMinRefreshInterval)) {
+		this.logger.Debug("No OCSP update necessary; within minimum refresh interval")
+		return false
+	}
 	// Allow cache-control headers to indicate an earlier update time, per
 	// https://tools.ietf.org/html/rfc5019#section-6.1, per sleevi requirement:
 	// 4. ... such a system should observe the Lightweight OCSP Profile of
@@ -506,12 +1175,10 @@ func (this *CertCache) shouldUpdateOCSP(ocsp []byte) bool {
 	this.ocspUpdateAfterMu.RLock()
 	defer this.ocspUpdateAfterMu.RUnlock()
 	if this.timeNow().After(this.ocspUpdateAfter) {
-		// TODO(twifkak): Use a logging framework with support for debug-only statements.
-		log.Println("Updating OCSP; expired by HTTP cache headers: ", this.ocspUpdateAfter)
+		this.logger.Info("Updating OCSP; expired by HTTP cache headers", "updateAfter", this.ocspUpdateAfter)
 		return true
 	}
-	// TODO(twifkak): Use a logging framework with support for debug-only statements.
-	log.Println("No OCSP update necessary.")
+	this.logger.Debug("No OCSP update necessary")
 	return false
 }
 
@@ -555,31 +1222,38 @@ func (this *CertCache) findIssuerUsingCerts(certs []*x509.Certificate) *x509.Cer
 }
 
 // Queries the OCSP responder for this cert and return the OCSP response.
-func (this *CertCache) fetchOCSP(orig []byte, certs []*x509.Certificate, ocspUpdateAfter *time.Time, isRetry bool) []byte {
+func (this *CertCache) fetchOCSP(ctx context.Context, orig []byte, certs []*x509.Certificate, ocspUpdateAfter *time.Time, isRetry bool) []byte {
 	issuer := this.findIssuerUsingCerts(certs)
 	if issuer == nil {
-		log.Println("Cannot find issuer certificate in CertFile.")
-		return orig
+		this.logger.Error("Cannot find issuer certificate in CertFile")
+		return this.fallBackToCachedOCSP(orig)
 	}
 	// The default SHA1 hash function is mandated by the Lightweight OCSP
 	// Profile, https://tools.ietf.org/html/rfc5019 2.1.1 (sleevi #4, see above).
 	req, err := ocsp.CreateRequest(certs[0], issuer, nil)
 	if err != nil {
-		log.Println("Error creating OCSP request:", err)
-		return orig
+		this.logger.Error("Error creating OCSP request", "err", err)
+		return this.fallBackToCachedOCSP(orig)
+	}
+	var nonce []byte
+	if this.ocspNonce {
+		if req, nonce, err = addOCSPNonce(req); err != nil {
+			this.logger.Error("Error adding OCSP nonce", "err", err)
+			return this.fallBackToCachedOCSP(orig)
+		}
 	}
 
 	ocspServer, err := this.extractOCSPServer(certs[0])
 	if err != nil {
 		if this.generateOCSPResponse == nil {
-			log.Println("Error extracting OCSP server:", err)
-			return orig
+			this.logger.Error("Error extracting OCSP server", "err", err)
+			return this.fallBackToCachedOCSP(orig)
 		}
-		log.Println("Cert lacks OCSP URL; using fake OCSP in development mode.")
+		this.logger.Info("Cert lacks OCSP URL; using fake OCSP in development mode")
 		resp, err := this.generateOCSPResponse(certs[0])
 		if err != nil {
-			log.Println("error generating fake OCSP response:", err)
-			return orig
+			this.logger.Error("Error generating fake OCSP response", "err", err)
+			return this.fallBackToCachedOCSP(orig)
 		}
 		return resp
 	}
@@ -595,24 +1269,30 @@ func (this *CertCache) fetchOCSP(orig []byte, certs []*x509.Certificate, ocspUpd
 	var httpReq *http.Request
 	// Logic is a fallback, due to some CAs not responding as expected to a GET.
 	if len(getURL) <= 255 && !isRetry {
-		httpReq, err = http.NewRequest("GET", getURL, nil)
+		httpReq, err = http.NewRequestWithContext(ctx, "GET", getURL, nil)
 		if err != nil {
-			log.Println("Error creating OCSP response:", err)
-			return orig
+			this.logger.Error("Error creating OCSP request", "err", err)
+			return this.fallBackToCachedOCSP(orig)
 		}
 	} else {
-		httpReq, err = http.NewRequest("POST", ocspServer, bytes.NewReader(req))
+		httpReq, err = http.NewRequestWithContext(ctx, "POST", ocspServer, bytes.NewReader(req))
 		if err != nil {
-			log.Println("Error creating OCSP response:", err)
-			return orig
+			this.logger.Error("Error creating OCSP request", "err", err)
+			return this.fallBackToCachedOCSP(orig)
 		}
 		httpReq.Header.Set("Content-Type", "application/ocsp-request")
 	}
 
+	release := this.ocspHostSemaphores.acquire(ctx, httpReq.URL.Host, this.stopped.Done())
+	if release == nil {
+		this.logger.Warn("Stopped or cancelled while waiting to issue OCSP request", "server", ocspServer)
+		return this.fallBackToCachedOCSP(orig)
+	}
+	defer release()
 	httpResp, err := this.client.Do(httpReq)
 	if err != nil {
-		log.Println("Error issuing OCSP request:", err)
-		return orig
+		this.logger.Error("Error issuing OCSP request", "server", ocspServer, "err", err)
+		return this.fallBackToCachedOCSP(orig)
 	}
 	if httpResp.Body != nil {
 		defer httpResp.Body.Close()
@@ -625,8 +1305,8 @@ func (this *CertCache) fetchOCSP(orig []byte, certs []*x509.Certificate, ocspUpd
 
 	respBytes, err := ioutil.ReadAll(io.LimitReader(httpResp.Body, maxOCSPResponseBytes))
 	if err != nil {
-		log.Println("Error reading OCSP response:", err)
-		return orig
+		this.logger.Error("Error reading OCSP response", "server", ocspServer, "err", err)
+		return this.fallBackToCachedOCSP(orig)
 	}
 
 	// Validate the response, per sleevi requirement:
@@ -635,20 +1315,32 @@ func (this *CertCache) fetchOCSP(orig []byte, certs []*x509.Certificate, ocspUpd
 	// https://tools.ietf.org/html/rfc5019#section-2.2.2.
 	resp, err := ocsp.ParseResponseForCert(respBytes, certs[0], issuer)
 	if err != nil {
-		log.Println("Error parsing OCSP response:", err)
-		return orig
+		return this.rejectOCSP(orig, "unparseable", "err", err)
 	}
 	if resp.Status != ocsp.Good {
-		log.Println("Invalid OCSP status:", resp.Status)
-		return orig
+		return this.rejectOCSP(orig, "status not good", "status", resp.Status)
 	}
-	if resp.ThisUpdate.After(this.timeNow()) {
-		log.Println("OCSP thisUpdate in the future:", resp.ThisUpdate)
-		return orig
+	if nonce != nil {
+		echoed, ok, err := ocspResponseNonce(resp)
+		if err != nil {
+			return this.rejectOCSP(orig, "unparseable", "err", err)
+		}
+		if ok && !bytes.Equal(echoed, nonce) {
+			return this.rejectOCSP(orig, "nonce mismatch")
+		}
+		if !ok && this.ocspNonceRequired {
+			return this.rejectOCSP(orig, "nonce missing")
+		}
+	}
+	now := this.timeNow()
+	if resp.ThisUpdate.After(now.Add(this.ocspClockSkew)) {
+		return this.rejectOCSP(orig, "thisUpdate in the future", "thisUpdate", resp.ThisUpdate)
+	}
+	if resp.ProducedAt.After(now.Add(this.ocspClockSkew)) {
+		return this.rejectOCSP(orig, "producedAt in the future", "producedAt", resp.ProducedAt)
 	}
 	if resp.NextUpdate.Before(this.timeNow()) {
-		log.Println("OCSP nextUpdate in the past:", resp.NextUpdate)
-		return orig
+		return this.rejectOCSP(orig, "nextUpdate in the past", "nextUpdate", resp.NextUpdate)
 	}
 	for _, test := range []struct {
 		name  string
@@ -659,36 +1351,149 @@ func (this *CertCache) fetchOCSP(orig []byte, certs []*x509.Certificate, ocspUpd
 		{"producedAt", resp.ProducedAt},
 	} {
 		if test.value.Before(certs[0].NotBefore) {
-			log.Printf("OCSP %s %+v before certificate notBefore %+v", test.name, test.value, certs[0].NotBefore)
-			return orig
+			return this.rejectOCSP(orig, test.name+" before certificate notBefore", test.name, test.value, "notBefore", certs[0].NotBefore)
 		}
 		if test.value.After(certs[0].NotAfter) {
-			log.Printf("OCSP %s %+v after certificate notAfter %+v", test.name, test.value, certs[0].NotAfter)
-			return orig
+			return this.rejectOCSP(orig, test.name+" after certificate notAfter", test.name, test.value, "notAfter", certs[0].NotAfter)
 		}
 	}
 	// OCSP duration must be <=7 days, per
 	// https://wicg.github.io/webpackage/draft-yasskin-httpbis-origin-signed-exchanges-impl.html#cross-origin-trust.
 	// Serving these responses may cause UAs to reject the SXG.
 	if resp.NextUpdate.Sub(resp.ThisUpdate) > time.Hour*24*7 {
-		log.Printf("OCSP nextUpdate %+v too far ahead of thisUpdate %+v", resp.NextUpdate, resp.ThisUpdate)
-		return orig
+		return this.rejectOCSP(orig, "nextUpdate too far ahead of thisUpdate", "thisUpdate", resp.ThisUpdate, "nextUpdate", resp.NextUpdate)
 	}
+	this.logger.Info("OCSP fetched", "server", ocspServer, "thisUpdate", resp.ThisUpdate, "nextUpdate", resp.NextUpdate)
 	return respBytes
 }
 
-// Checks for cert updates every certCheckInterval hours. Terminates only when stop
-// receives a message.
+// Logs that the OCSP response fetched from the responder was rejected, and
+// returns fallBackToCachedOCSP(orig).
+func (this *CertCache) rejectOCSP(orig []byte, reason string, keysAndValues ...interface{}) []byte {
+	this.logger.Warn("OCSP rejected", append([]interface{}{"reason", reason}, keysAndValues...)...)
+	return this.fallBackToCachedOCSP(orig)
+}
+
+// Returns orig, the previously cached OCSP response, if any, to keep serving
+// after a failed fetch.
+func (this *CertCache) fallBackToCachedOCSP(orig []byte) []byte {
+	if len(orig) > 0 {
+		this.logger.Warn("Falling back to cached OCSP response")
+	}
+	return orig
+}
+
+// Checks CertFile for modifications every certFileWatchInterval. Terminates
+// only when stopped.
+func (this *CertCache) watchCertFile() {
+	defer this.goroutines.Done()
+	ticker := time.NewTicker(this.certFileWatchInterval)
+
+	for {
+		select {
+		case <-ticker.C:
+			this.reloadCertFileIfChanged()
+		case <-this.stopped.Done():
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+// If CertFile has been modified since last checked, and contains a new cert
+// chain valid for Domains, fetches an OCSP response for it and then swaps it in
+// for the current chain. The current chain continues to be served until the
+// new OCSP response is healthy, so that there's no gap in service; if any step
+// fails, the swap is retried on the next check.
+func (this *CertCache) reloadCertFileIfChanged() {
+	stat, err := os.Stat(this.CertFile)
+	if err != nil {
+		this.logger.Error("Can't stat cert file", "file", this.CertFile, "err", err)
+		return
+	}
+	if stat.ModTime().Equal(this.certFileModTime) {
+		return
+	}
+	certs, err := certloader.LoadAndValidateCertsFromFile(this.CertFile, this.certFileRequireSign)
+	if err != nil {
+		this.logger.Error("Can't load cert file", "file", this.CertFile, "err", err)
+		return
+	}
+	certName := util.CertName(certs[0])
+	this.certsMu.RLock()
+	unchanged := certName == this.certName
+	this.certsMu.RUnlock()
+	if unchanged {
+		this.certFileModTime = stat.ModTime()
+		return
+	}
+	for _, domain := range this.Domains {
+		if domain == "" {
+			continue
+		}
+		if err := certs[0].VerifyHostname(domain); err != nil {
+			this.logger.Warn("Not reloading cert", "cert", certName, "file", this.CertFile, "err", err)
+			return
+		}
+	}
+
+	var ocspUpdateAfter time.Time
+	newOCSP := this.fetchOCSP(this.stopped, nil, certs, &ocspUpdateAfter, false)
+	if err := this.isHealthyUsingCerts(newOCSP, certs); err != nil {
+		this.logger.Warn("Not reloading cert until its OCSP is healthy", "cert", certName, "file", this.CertFile, "err", err)
+		return
+	}
+
+	this.logger.Info("Reloading cert", "cert", certName, "file", this.CertFile)
+	// Write the new OCSP response without holding certsMu, as the write may
+	// wait on another replica's lease. Then swap in the cert chain, but only if
+	// the cache holds the response validated above, e.g. not one that another
+	// replica wrote for the old chain in the meantime.
+	written, err := this.getOCSPFile().Read(this.stopped, func(contents []byte) bool {
+		return !bytes.Equal(contents, newOCSP)
+	}, func([]byte) []byte {
+		return newOCSP
+	})
+	if err != nil {
+		this.logger.Error("Error writing OCSP for reloaded cert", "err", err)
+		return
+	}
+	if !bytes.Equal(written, newOCSP) {
+		this.logger.Warn("Not reloading cert; its OCSP response was replaced in the cache", "cert", certName, "file", this.CertFile)
+		return
+	}
+	this.certsMu.Lock()
+	this.certs = certs
+	this.certName = certName
+	this.certsMu.Unlock()
+	this.certFileModTime = stat.ModTime()
+
+	this.ocspUpdateAfterMu.Lock()
+	defer this.ocspUpdateAfterMu.Unlock()
+	if !ocspUpdateAfter.Equal(time.Time{}) {
+		this.ocspUpdateAfter = ocspUpdateAfter
+	} else {
+		this.ocspUpdateAfter = infiniteFuture
+	}
+}
+
+// Checks for cert updates every certCheckInterval (by default, daily).
+// Terminates only when stopped.
 func (this *CertCache) maintainCerts() {
+	defer this.goroutines.Done()
 	// Only make one request per certCheckInterval, to minimize the impact
 	// on servers that are buckling under load.
-	ticker := time.NewTicker(certCheckInterval)
+	interval := this.certCheckInterval
+	if interval == 0 {
+		interval = defaultCertCheckInterval
+	}
+	ticker := time.NewTicker(interval)
 
 	for {
 		select {
 		case <-ticker.C:
 			this.updateCertIfNecessary()
-		case <-this.stop:
+		case <-this.stopped.Done():
 			ticker.Stop()
 			return
 		}
@@ -711,6 +1516,16 @@ func (this *CertCache) getCert() *x509.Certificate {
 	return this.certs[0]
 }
 
+// Returns the current cert chain, or nil if there is none.
+func (this *CertCache) getCerts() []*x509.Certificate {
+	if !this.hasCert() {
+		return nil
+	}
+	this.certsMu.RLock()
+	defer this.certsMu.RUnlock()
+	return this.certs
+}
+
 // Returns true iff cert cache renewal contains at least 1 cert.
 func (this *CertCache) hasRenewalCert() bool {
 	this.renewedCertsMu.RLock()
@@ -727,17 +1542,23 @@ func (this *CertCache) getRenewalCert() *x509.Certificate {
 	return this.renewedCerts[0]
 }
 
-// Set current cert with mutex protection.
-func (this *CertCache) setCerts(certs []*x509.Certificate) {
+// Set current cert with mutex protection. If ocspWritten is true, the OCSP
+// cache already holds the response for certs; otherwise it is purged, to be
+// refetched for certs on the next read.
+func (this *CertCache) setCerts(certs []*x509.Certificate, ocspWritten bool) {
 	this.certsMu.Lock()
 	defer this.certsMu.Unlock()
 	this.certs = certs
 	this.certName = util.CertName(certs[0])
 
-	log.Printf("Writing cert %s to file %v", this.certName, this.CertFile)
+	this.logger.Info("Writing cert to file", "cert", this.certName, "file", this.CertFile)
 	err := certloader.WriteCertsToFile(this.certs, this.CertFile)
 	if err != nil {
-		log.Printf("Unable to write certs to file: %s", this.CertFile)
+		this.logger.Error("Unable to write certs to file", "file", this.CertFile, "err", err)
+	}
+
+	if ocspWritten {
+		return
 	}
 
 	// Purge OCSP cache
@@ -748,13 +1569,18 @@ func (this *CertCache) setCerts(certs []*x509.Certificate) {
 func (this *CertCache) setNewCerts(certs []*x509.Certificate) {
 	this.renewedCertsMu.Lock()
 	defer this.renewedCertsMu.Unlock()
+	this.setNewCertsLocked(certs)
+}
+
+// Like setNewCerts, but must be called with renewedCertsMu held.
+func (this *CertCache) setNewCertsLocked(certs []*x509.Certificate) {
 	this.renewedCerts = certs
 
 	if this.renewedCerts == nil {
 		this.renewedCertName = ""
 		err := certloader.RemoveFile(this.NewCertFile)
 		if err != nil {
-			log.Printf("Unable to remove file: %s", this.NewCertFile)
+			this.logger.Error("Unable to remove file", "file", this.NewCertFile, "err", err)
 		}
 		return
 	}
@@ -762,25 +1588,25 @@ func (this *CertCache) setNewCerts(certs []*x509.Certificate) {
 
 	err := certloader.WriteCertsToFile(this.renewedCerts, this.NewCertFile)
 	if err != nil {
-		log.Printf("Unable to write certs to file: %s", this.NewCertFile)
+		this.logger.Error("Unable to write certs to file", "file", this.NewCertFile, "err", err)
 	}
 }
 
 // Update the cert in the cache if necessary.
 func (this *CertCache) updateCertIfNecessary() {
-	log.Println("Updating cert if necessary")
+	this.logger.Debug("Updating cert if necessary")
 	if this.certFetcher == nil {
 		// Don't request new certs from CA if certFetcher is not set. This means this instance of the amppackager
 		// is not in autorenewcert mode. Just make an attempt at reading the cert saved on disk to see if
 		// another amppackager instance that is in autorenewcert mode actually updated it with a valid cert.
-		log.Println("Certfetcher is not set, skipping cert updates. Checking cert on disk if updated.")
+		this.logger.Debug("Certfetcher is not set, skipping cert updates. Checking cert on disk if updated")
 		this.reloadCertIfExpired()
 		return
 	}
-	d := time.Duration(0)
+	now := this.timeNow()
 	err := errors.New("")
 	if this.hasCert() {
-		d, err = util.GetDurationToExpiry(this.getCert(), this.timeNow())
+		_, err = util.GetDurationToExpiry(this.getCert(), now)
 	}
 	if err != nil {
 		this.renewedCertsMu.Lock()
@@ -790,68 +1616,162 @@ func (this *CertCache) updateCertIfNecessary() {
 		if this.renewedCerts != nil {
 			// If renewedCerts is set, copy that over to certs
 			// and set renewedCerts to nil.
-			this.setCerts(this.renewedCerts)
-			this.setNewCerts(nil)
+			this.setCerts(this.renewedCerts, false)
+			this.setNewCertsLocked(nil)
 			return
 		}
-		// Current cert is already invalid. Try refreshing.
-		log.Println("Warning current cert is expired, attempting to renew: ", err)
-		certs, err := this.certFetcher.FetchNewCert()
+		// Current cert is already invalid (or missing). Try refreshing.
+		var certs []*x509.Certificate
+		if current := this.getCerts(); current != nil {
+			this.logger.Warn("Current cert is expired, attempting to renew", "err", err)
+			certs, err = this.certFetcher.RenewCert(current)
+		} else {
+			this.logger.Warn("No current cert, attempting to obtain one")
+			certs, err = this.certFetcher.FetchNewCert()
+		}
 		if err != nil {
-			log.Println("Error trying to fetch new certificates from CA: ", err)
+			this.logger.Error("Error trying to fetch new certificates from CA", "err", err)
 			return
 		}
-		this.setCerts(certs)
+		this.setCerts(certs, false)
 		return
 	}
-	if d >= time.Duration(certRenewalInterval) {
-		// Cert is still valid, don't do anything.
-	} else if d < time.Duration(certRenewalInterval) {
+	if this.isCertDueForRenewal(this.getCert(), now) {
 		this.renewedCertsMu.Lock()
-		defer this.renewedCertsMu.Unlock()
-
 		// Check if we already have a renewal cert waiting, fetch a new cert if not.
 		if this.renewedCerts == nil {
 			// Cert is still valid, but we need to start process of requesting new cert.
-			log.Println("Warning: Current cert crossed threshold for renewal, attempting to renew.")
-			certs, err := this.certFetcher.FetchNewCert()
+			this.logger.Warn("Current cert crossed threshold for renewal, attempting to renew")
+			certs, err := this.certFetcher.RenewCert(this.getCerts())
 			if err != nil {
-				log.Println("Error trying to fetch new certificates from CA: ", err)
+				this.renewedCertsMu.Unlock()
+				this.logger.Error("Error trying to fetch new certificates from CA", "err", err)
 				return
 			}
-			this.setNewCerts(certs)
+			this.setNewCertsLocked(certs)
+			this.renewedCertsMu.Unlock()
+			// Switch to it now, if possible, rather than waiting for the
+			// next check.
+			this.switchToRenewedCerts()
 		} else {
+			this.renewedCertsMu.Unlock()
 			// TODO(banaag) from twifkak comments:
-			// Note that this logic works, albeit might fail to fetch OCSP the first try, but will succeed 24 hours later.
-			//
-			// I realize it's difficult to use readOCSP here, since it's hard-coded to use this.certs and friends, rather than
-			// this.renewedCerts and friends. That makes me think two things:
-			//
-			// The extraction of the retry logic from readOCSP would be useful.
 			// We should bundle certName, certs, certsMu, ocspFile, ocspFilePath, ocspUpdateAfter, and ocspUpdateAfterMu into
 			// a new struct type, and then have two copies of that in certcache - one for current certs and one for new certs.
-			var ocspUpdateAfter time.Time
-
-			ocsp, _, errorOCSP := this.readOCSP(true)
-			if errorOCSP != nil {
-				newOCSP := this.fetchOCSP(ocsp, this.renewedCerts, &ocspUpdateAfter, false)
-				// Check if newOCSP != ocsp and that there are no errors, health-wise with new ocsp.
-				if !bytes.Equal(newOCSP, ocsp) && this.isHealthy(newOCSP) == nil {
-					// We were able to fetch new OCSP with renewal cert, time to switch to new certs.
-					this.setCerts(this.renewedCerts)
-					this.setNewCerts(nil)
-				}
-			}
+			//
+			// Until then, the renewal certs have no OCSP cache of their own, so one is bootstrapped here on each check, and
+			// the certs are swapped in (along with their OCSP response) as soon as it is healthy. If it can't be obtained,
+			// the current certs continue to be served, and the swap is retried on the next check.
+			this.switchToRenewedCerts()
+		}
+	}
+}
+
+// Obtains an OCSP response for renewedCerts, per bootstrapRenewalOCSP, and if
+// it is healthy, replaces the current certs and their OCSP response with them.
+// The current certs remain available, per keepPreviousCerts. The OCSP response
+// is obtained and written without holding renewedCertsMu or certsMu, as it may
+// take minutes of retries, or of waiting on another replica's lease; the swap
+// is skipped if renewedCerts changed in the meantime.
+func (this *CertCache) switchToRenewedCerts() {
+	this.renewedCertsMu.RLock()
+	renewedCerts := this.renewedCerts
+	renewedCertName := this.renewedCertName
+	this.renewedCertsMu.RUnlock()
+	if len(renewedCerts) == 0 {
+		return
+	}
+
+	current, _, _ := this.readOCSPWithContext(this.stopped, true)
+	var ocspUpdateAfter time.Time
+	ocsp := this.bootstrapRenewalOCSP(current, renewedCerts, &ocspUpdateAfter)
+	if err := this.isHealthyUsingCerts(ocsp, renewedCerts); err != nil {
+		this.logger.Warn("Not switching to renewed cert until its OCSP is healthy", "cert", renewedCertName, "err", err)
+		return
+	}
+
+	// As in reloadCertFileIfChanged, the response only counts as written if
+	// the cache holds it afterwards, e.g. not one that another replica wrote
+	// in the meantime. Otherwise, the cache is purged by setCerts.
+	written, err := this.getOCSPFile().Read(this.stopped, func(contents []byte) bool {
+		return !bytes.Equal(contents, ocsp)
+	}, func([]byte) []byte {
+		return ocsp
+	})
+	if err != nil {
+		this.logger.Error("Error writing OCSP for renewed cert", "err", err)
+	}
+	ocspWritten := err == nil && bytes.Equal(written, ocsp)
+
+	this.renewedCertsMu.Lock()
+	defer this.renewedCertsMu.Unlock()
+	if this.renewedCertName != renewedCertName {
+		this.logger.Info("Not switching to renewed cert; superseded while fetching its OCSP", "cert", renewedCertName)
+		if ocspWritten {
+			// The cache holds the response for a chain that isn't served.
+			certloader.RemoveFile(this.ocspFilePath)
+		}
+		return
+	}
+	this.keepPreviousCerts(current)
+	this.setCerts(renewedCerts, ocspWritten)
+	this.setNewCertsLocked(nil)
+
+	this.ocspUpdateAfterMu.Lock()
+	defer this.ocspUpdateAfterMu.Unlock()
+	if !ocspUpdateAfter.Equal(time.Time{}) {
+		this.ocspUpdateAfter = ocspUpdateAfter
+	} else {
+		this.ocspUpdateAfter = infiniteFuture
+	}
+}
+
+// Keeps the current cert chain, along with ocspBytes, its OCSP response, to be
+// served under its certName once replaced: SXGs signed with it reference it by
+// that name. They are valid no later than the response's NextUpdate (see
+// GetOCSPExpiry), so it is served until then. If ocspBytes isn't valid for the
+// current chain, nothing is kept, as the chain couldn't be served without it.
+func (this *CertCache) keepPreviousCerts(ocspBytes []byte) {
+	certs := this.getCerts()
+	var until time.Time
+	if certs != nil && ocspBytes != nil {
+		if resp, err := ocsp.ParseResponseForCert(ocspBytes, certs[0], this.findIssuerUsingCerts(certs)); err == nil {
+			until = resp.NextUpdate
 		}
 	}
+	this.certsMu.Lock()
+	defer this.certsMu.Unlock()
+	if until.IsZero() {
+		this.previousCertName, this.previousCerts, this.previousOCSP, this.previousCertsUntil = "", nil, nil, time.Time{}
+		return
+	}
+	this.previousCertName = util.CertName(certs[0])
+	this.previousCerts = certs
+	this.previousOCSP = ocspBytes
+	this.previousCertsUntil = until
+}
+
+// Returns an OCSP response for the renewed certs, given current, the OCSP
+// response for the current certs (if any). If it also applies to the renewed
+// certs (i.e. they have the same issuer and leaf serial number, as when
+// NewCertFile merely rebundles the current leaf), it is reused, unless the
+// policy set by SetRenewalOCSPBootstrap is util.RenewalOCSPFetch. Otherwise,
+// a fresh response is fetched.
+func (this *CertCache) bootstrapRenewalOCSP(current []byte, renewedCerts []*x509.Certificate, ocspUpdateAfter *time.Time) []byte {
+	if this.renewalOCSPBootstrap != util.RenewalOCSPFetch && current != nil && this.isHealthyUsingCerts(current, renewedCerts) == nil {
+		this.logger.Info("Reusing current OCSP response for renewed cert", "cert", util.CertName(renewedCerts[0]))
+		return current
+	}
+	return this.fetchOCSP(this.stopped, nil, renewedCerts, ocspUpdateAfter, false)
 }
 
 func (this *CertCache) doesCertNeedReloading() bool {
 	if !this.hasCert() {
 		return true
 	}
-	d, err := util.GetDurationToExpiry(this.getCert(), this.timeNow())
-	return err != nil || d < certRenewalInterval
+	now := this.timeNow()
+	_, err := util.GetDurationToExpiry(this.getCert(), now)
+	return err != nil || this.isCertDueForRenewal(this.getCert(), now)
 }
 
 func (this *CertCache) reloadCertIfExpired() {
@@ -864,16 +1784,16 @@ func (this *CertCache) reloadCertIfExpired() {
 	// it doesn't matter because the old certs won't be overridden (and the old certs are probably invalid, too).
 	certs, err := certloader.LoadAndValidateCertsFromFile(this.CertFile, true)
 	if err != nil {
-		log.Println(errors.Wrap(err, "Can't load cert file"))
+		this.logger.Error("Can't load cert file", "file", this.CertFile, "err", err)
 		certs = nil
 	}
 	if certs != nil {
-		this.setCerts(certs)
+		this.setCerts(certs, false)
 	}
 
 	newCerts, err := certloader.LoadAndValidateCertsFromFile(this.NewCertFile, true)
 	if err != nil {
-		log.Println(errors.Wrap(err, "Can't load new cert file"))
+		this.logger.Error("Can't load new cert file", "file", this.NewCertFile, "err", err)
 		newCerts = nil
 	}
 	if newCerts != nil {
@@ -884,8 +1804,12 @@ func (this *CertCache) reloadCertIfExpired() {
 // Creates cert cache by loading certs and keys from disk, doing validation
 // and populating the cert cache with current set of certificate related information.
 // If development mode is true, prints a warning for certs that can't sign HTTP exchanges.
+// Diagnostics are logged to logger, or if nil, to StdLogger.
 func PopulateCertCache(config *util.Config, key crypto.PrivateKey, generateOCSPResponse OCSPResponder,
-	developmentMode bool, autoRenewCert bool) (*CertCache, error) {
+	developmentMode bool, autoRenewCert bool, logger Logger) (*CertCache, error) {
+	if logger == nil {
+		logger = StdLogger{}
+	}
 
 	if config.CertFile == "" {
 		return nil, errors.New("Missing cert file path in config.")
@@ -897,7 +1821,7 @@ func PopulateCertCache(config *util.Config, key crypto.PrivateKey, generateOCSPR
 
 	certs, err := certloader.LoadCertsFromFile(config, developmentMode)
 	if err != nil {
-		log.Println(errors.Wrap(err, "Can't load cert file"))
+		logger.Error("Can't load cert file", "file", config.CertFile, "err", err)
 		certs = nil
 	}
 	domain := ""
@@ -915,6 +1839,43 @@ func PopulateCertCache(config *util.Config, key crypto.PrivateKey, generateOCSPR
 		return nil, errors.Wrap(err, "creating cert fetcher from config")
 	}
 	certCache := New(certs, certFetcher, []string{domain}, config.CertFile, config.NewCertFile, config.OCSPCache, generateOCSPResponse, time.Now)
+	certCache.SetLogger(logger)
+	if config.OCSPLockTimeoutSeconds > 0 {
+		certCache.SetOCSPLockTimeout(time.Duration(config.OCSPLockTimeoutSeconds) * time.Second)
+	}
+	certCache.SetCRLFallback(config.CRLFallback)
+	certCache.SetOCSPNonce(config.OCSPNonce, config.OCSPNonceRequired)
+	certCache.SetOCSPMaxHostFetches(config.OCSPMaxHostFetches)
+	if config.OCSPClockSkewSeconds != nil {
+		certCache.SetOCSPClockSkew(time.Duration(*config.OCSPClockSkewSeconds) * time.Second)
+	}
+	certCache.SetRenewalOCSPBootstrap(config.RenewalOCSPBootstrap)
+	certCache.SetCertRenewalPolicy(config.CertRenewalFraction, time.Duration(config.CertRenewalCheckIntervalSeconds)*time.Second)
+	certCache.SetOCSPRefreshPolicy(config.OCSPRefreshFraction,
+		time.Duration(config.OCSPMinRefreshIntervalSeconds)*time.Second,
+		time.Duration(config.OCSPMaxRefreshIntervalSeconds)*time.Second)
+	certCache.SetOCSPRefreshStrategy(config.OCSPRefreshStrategy, time.Duration(config.OCSPRefreshIntervalSeconds)*time.Second)
+	if config.CertFileWatchIntervalSeconds > 0 {
+		certCache.WatchCertFile(time.Duration(config.CertFileWatchIntervalSeconds)*time.Second, !developmentMode)
+	}
+	if config.OCSPCABundle != "" {
+		bundle, err := ioutil.ReadFile(config.OCSPCABundle)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading %s", config.OCSPCABundle)
+		}
+		if err := certCache.SetOCSPCABundle(bundle); err != nil {
+			return nil, errors.Wrapf(err, "parsing %s", config.OCSPCABundle)
+		}
+	}
+	if config.SCTFile != "" {
+		sct, err := ioutil.ReadFile(config.SCTFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading %s", config.SCTFile)
+		}
+		if err := certCache.SetSCTList(sct); err != nil {
+			return nil, errors.Wrapf(err, "parsing %s", config.SCTFile)
+		}
+	}
 
 	return certCache, nil
 }
@@ -15,21 +15,41 @@
 package certcache
 
 import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/WICG/webpackage/go/signedexchange/cbor"
+	"github.com/ampproject/amppackager/packager/certfetcher"
+	"github.com/ampproject/amppackager/packager/certloader"
 	"github.com/ampproject/amppackager/packager/mux"
 	pkgt "github.com/ampproject/amppackager/packager/testing"
 	"github.com/ampproject/amppackager/packager/util"
+	"github.com/gofrs/flock"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/suite"
 	ocsptest "github.com/twifkak/crypto/ocsp"
 	"golang.org/x/crypto/ocsp"
@@ -40,17 +60,92 @@ import (
 // of rounding down, so that calls to this function with producedAt ==
 // thisUpdate return a valid response.
 func FakeOCSPResponse(thisUpdate, producedAt time.Time) ([]byte, error) {
+	return fakeOCSPResponseForCert(pkgt.B3Certs[0], thisUpdate, producedAt)
+}
+
+// Like FakeOCSPResponse, but for the given leaf cert (issued by pkgt.CACert).
+func fakeOCSPResponseForCert(cert *x509.Certificate, thisUpdate, producedAt time.Time) ([]byte, error) {
+	return fakeOCSPResponseUntil(cert, thisUpdate, thisUpdate.Add(7*24*time.Hour), producedAt)
+}
+
+// Like fakeOCSPResponseForCert, but valid only until nextUpdate.
+func fakeOCSPResponseUntil(cert *x509.Certificate, thisUpdate, nextUpdate, producedAt time.Time) ([]byte, error) {
 	template := ocsptest.Response{
 		Status:           ocsp.Good,
-		SerialNumber:     pkgt.B3Certs[0].SerialNumber,
+		SerialNumber:     cert.SerialNumber,
 		ThisUpdate:       thisUpdate,
-		NextUpdate:       thisUpdate.Add(7 * 24 * time.Hour),
+		NextUpdate:       nextUpdate,
 		RevokedAt:        thisUpdate.AddDate( /*years=*/ 0 /*months=*/, 0 /*days=*/, 365),
 		RevocationReason: ocsp.Unspecified,
 	}
 	return ocsptest.CreateResponse(pkgt.CACert, pkgt.CACert, template, pkgt.CAKey, producedAt.Add(1*time.Minute))
 }
 
+// Returns the DER-encoded OCSP response, re-signed by pkgt.CAKey with the given
+// responseExtensions added. (The ocsp package can only produce
+// singleExtensions.)
+func withOCSPResponseExtensions(der []byte, exts []pkix.Extension) ([]byte, error) {
+	var outer struct {
+		Status   asn1.Enumerated
+		Response struct {
+			ResponseType asn1.ObjectIdentifier
+			Response     []byte
+		} `asn1:"explicit,tag:0,optional"`
+	}
+	if _, err := asn1.Unmarshal(der, &outer); err != nil {
+		return nil, err
+	}
+	var basic struct {
+		TBSResponseData    asn1.RawValue
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Signature          asn1.BitString
+		Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+	}
+	if _, err := asn1.Unmarshal(outer.Response.Response, &basic); err != nil {
+		return nil, err
+	}
+	var data ocspResponseDataASN1
+	if _, err := asn1.Unmarshal(basic.TBSResponseData.FullBytes, &data); err != nil {
+		return nil, err
+	}
+	data.ResponseExtensions = exts
+	tbs, err := asn1.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(tbs)
+	signature, err := pkgt.CAKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	basic.TBSResponseData = asn1.RawValue{FullBytes: tbs}
+	basic.Signature = asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)}
+	if outer.Response.Response, err = asn1.Marshal(basic); err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(outer)
+}
+
+// Returns the nonce in the given OCSP request, sent via GET, or nil if none.
+func ocspRequestNonce(req *http.Request) ([]byte, error) {
+	der, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(req.URL.Path, "/"))
+	if err != nil {
+		return nil, err
+	}
+	var parsed ocspRequestASN1
+	if _, err := asn1.Unmarshal(der, &parsed); err != nil {
+		return nil, err
+	}
+	for _, ext := range parsed.TBSRequest.RequestExtensions {
+		if ext.Id.Equal(ocspNonceOID) {
+			var nonce []byte
+			_, err := asn1.Unmarshal(ext.Value, &nonce)
+			return nonce, err
+		}
+	}
+	return nil, nil
+}
+
 type CertCacheSuite struct {
 	suite.Suite
 	fakeOCSP            []byte
@@ -61,6 +156,77 @@ type CertCacheSuite struct {
 	tempDir             string
 	handler             *CertCache
 	fakeClock           *pkgt.FakeClock
+	logger              *recordingLogger
+	// Every CertCache created by New, so that TearDownTest can stop any
+	// that the test didn't.
+	certCachesMu sync.Mutex
+	certCaches   []*CertCache
+	// Held for reading by each call to ocspHandler, so that TearDownTest can
+	// wait for those the test abandoned (e.g. hanging ones) to return.
+	ocspHandlerMu sync.RWMutex
+}
+
+// A Logger that records the messages logged at each level.
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []string
+	// Closed once an entry with the given prefix is logged. See await.
+	awaited map[string]chan struct{}
+}
+
+func (this *recordingLogger) log(level, msg string, keysAndValues []interface{}) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	entry := strings.TrimSuffix(fmt.Sprintln(append([]interface{}{level, msg}, keysAndValues...)...), "\n")
+	this.entries = append(this.entries, entry)
+	for prefix, logged := range this.awaited {
+		if strings.HasPrefix(entry, prefix) {
+			close(logged)
+			delete(this.awaited, prefix)
+		}
+	}
+}
+
+// Returns a channel that is closed once an entry with the given level and
+// message prefix is logged.
+func (this *recordingLogger) await(level, msg string) <-chan struct{} {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.awaited == nil {
+		this.awaited = map[string]chan struct{}{}
+	}
+	logged := make(chan struct{})
+	this.awaited[level+" "+msg] = logged
+	return logged
+}
+
+func (this *recordingLogger) Debug(msg string, keysAndValues ...interface{}) {
+	this.log("DEBUG", msg, keysAndValues)
+}
+
+func (this *recordingLogger) Info(msg string, keysAndValues ...interface{}) {
+	this.log("INFO", msg, keysAndValues)
+}
+
+func (this *recordingLogger) Warn(msg string, keysAndValues ...interface{}) {
+	this.log("WARN", msg, keysAndValues)
+}
+
+func (this *recordingLogger) Error(msg string, keysAndValues ...interface{}) {
+	this.log("ERROR", msg, keysAndValues)
+}
+
+// Returns the recorded entries with the given level and message prefix.
+func (this *recordingLogger) find(level, msg string) []string {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	var found []string
+	for _, entry := range this.entries {
+		if strings.HasPrefix(entry, level+" "+msg) {
+			found = append(found, entry)
+		}
+	}
+	return found
 }
 
 func stringPtr(s string) *string {
@@ -68,13 +234,20 @@ func stringPtr(s string) *string {
 }
 
 func (this *CertCacheSuite) New() (*CertCache, error) {
-	// TODO(twifkak): Stop the old CertCache's goroutine.
-	// TODO(banaag): Consider adding a test with certfetcher set.
-	//  For now, this tests certcache without worrying about certfetcher.
-	// certCache := New(pkgt.B3Certs, nil, []string{"example.com"}, "cert.crt", "newcert.crt",
-	// 	filepath.Join(this.tempDir, "ocsp"), nil, time.Now)
+	certCache := this.newUninitialized()
+	err := certCache.Init()
+	return certCache, err
+}
+
+// Like New, but doesn't call Init.
+func (this *CertCacheSuite) newUninitialized() *CertCache {
+	// This tests certcache without a certfetcher; see newWithFetcher for
+	// tests with one.
 	certCache := New(pkgt.B3Certs, nil, []string{"example.com"}, "cert.crt", "newcert.crt",
 		filepath.Join(this.tempDir, "ocsp"), nil, this.fakeClock.Now)
+	if this.logger != nil {
+		certCache.SetLogger(this.logger)
+	}
 	certCache.extractOCSPServer = func(*x509.Certificate) (string, error) {
 		return this.ocspServer.URL, nil
 	}
@@ -86,12 +259,16 @@ func (this *CertCacheSuite) New() (*CertCache, error) {
 			return defaultHttpExpiry(req, resp)
 		}
 	}
-	err := certCache.Init()
-	return certCache, err
+	this.certCachesMu.Lock()
+	this.certCaches = append(this.certCaches, certCache)
+	this.certCachesMu.Unlock()
+	return certCache
 }
 
 func (this *CertCacheSuite) SetupSuite() {
 	this.ocspServer = httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		this.ocspHandlerMu.RLock()
+		defer this.ocspHandlerMu.RUnlock()
 		this.ocspHandler(resp, req)
 	}))
 }
@@ -105,7 +282,7 @@ func (this *CertCacheSuite) SetupTest() {
 	// our tests can backdate OCSPs to test expiry logic, without
 	// accidentally hitting the requirement that OCSPs must postdate certs.
 	this.fakeClock = pkgt.NewFakeClock()
-	this.fakeClock.SecondsSince0 = pkgt.B3Certs[0].NotBefore.Add(8 * 24 * time.Hour).Sub(time.Unix(0, 0))
+	this.fakeClock.Set(pkgt.B3Certs[0].NotBefore.Add(8 * 24 * time.Hour))
 	now := this.fakeClock.Now()
 	var err error
 	this.fakeOCSP, err = FakeOCSPResponse(now, now)
@@ -127,9 +304,16 @@ func (this *CertCacheSuite) SetupTest() {
 func (this *CertCacheSuite) TearDownTest() {
 	// Reset any variables that may have been overridden in test and won't be rewritten in SetupTest.
 	this.fakeOCSPExpiry = nil
+	this.logger = nil
 
-	// Reverse SetupTest.
+	// Reverse SetupTest, and stop any other CertCaches the test created.
 	this.handler.Stop()
+	for _, certCache := range this.certCaches {
+		certCache.Stop()
+	}
+	this.certCaches = nil
+	this.ocspHandlerMu.Lock()
+	this.ocspHandlerMu.Unlock()
 
 	err := os.RemoveAll(this.tempDir)
 	if err != nil {
@@ -138,7 +322,7 @@ func (this *CertCacheSuite) TearDownTest() {
 }
 
 func (this *CertCacheSuite) mux() http.Handler {
-	return mux.New(this.handler, nil, nil, nil, nil)
+	return mux.New(mux.Handlers{CertCache: this.handler})
 }
 
 func (this *CertCacheSuite) ocspServerCalled(f func()) bool {
@@ -160,9 +344,10 @@ func (this *CertCacheSuite) DecodeCBOR(r io.Reader) map[string][]byte {
 	this.Require().Equal("📜⛓", magic)
 
 	// Decode and return the first one.
+	// The keys are cert, ocsp, and optionally sct.
 	numKeys, err := decoder.DecodeMapHeader()
 	this.Require().NoError(err, "decoding map header")
-	this.Require().EqualValues(2, numKeys)
+	this.Require().Contains([]uint64{2, 3}, numKeys)
 
 	ret := map[string][]byte{}
 	for i := 0; uint64(i) < numKeys; i++ {
@@ -185,15 +370,249 @@ func (this *CertCacheSuite) TestServesCertificate() {
 	this.Assert().NotContains(cbor, "sct")
 }
 
+// A SignedCertificateTimestampList containing two (fake) SerializedSCTs.
+var fakeSCTList = []byte{0, 9, 0, 3, 1, 2, 3, 0, 2, 4, 5}
+
+func (this *CertCacheSuite) TestServesSCTList() {
+	this.Require().NoError(this.handler.SetSCTList(fakeSCTList))
+	resp := pkgt.NewRequest(this.T(), this.mux(), "/amppkg/cert/"+pkgt.CertName).Do()
+	this.Assert().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+	cbor := this.DecodeCBOR(resp.Body)
+	this.Assert().Contains(cbor, "cert")
+	this.Assert().Contains(cbor, "ocsp")
+	this.Assert().Equal(fakeSCTList, cbor["sct"])
+}
+
+func (this *CertCacheSuite) TestDoesNotServeSCTListForOtherCert() {
+	this.Require().NoError(this.handler.SetSCTList(fakeSCTList))
+	this.handler.certsMu.Lock()
+	this.handler.certs = pkgt.B3Certs2
+	this.handler.certName = util.CertName(pkgt.B3Certs2[0])
+	this.handler.certsMu.Unlock()
+
+	certChain, err := this.handler.createCertChainCBOR(this.fakeOCSP)
+	this.Require().NoError(err)
+	cbor := this.DecodeCBOR(bytes.NewReader(certChain))
+	this.Assert().Contains(cbor, "cert")
+	this.Assert().NotContains(cbor, "sct")
+}
+
+func (this *CertCacheSuite) TestSetSCTListInvalid() {
+	for _, sct := range [][]byte{
+		{},
+		{0, 0},
+		{0, 6, 0, 3, 1, 2, 3},
+		{0, 3, 0, 2, 1},
+		{0, 4, 0, 0, 0, 0},
+	} {
+		this.Assert().Error(this.handler.SetSCTList(sct), "%v", sct)
+	}
+	this.Assert().Nil(this.handler.sctList)
+}
+
 func (this *CertCacheSuite) TestCertCacheIsHealthy() {
 	this.Assert().NoError(this.handler.IsHealthy())
 }
 
+func (this *CertCacheSuite) TestGetOCSPExpiry() {
+	ocspResp, err := ocsp.ParseResponse(this.fakeOCSP, pkgt.CACert)
+	this.Require().NoError(err, "parsing fake OCSP response")
+	this.Assert().Equal(ocspResp.NextUpdate, this.handler.GetOCSPExpiry())
+}
+
+func (this *CertCacheSuite) TestGetOCSPExpiryUninitialized() {
+	certCache := New(pkgt.B3Certs, nil, []string{"example.com"}, "cert.crt", "newcert.crt",
+		filepath.Join(this.tempDir, "ocsp"), nil, this.fakeClock.Now)
+	this.Assert().True(certCache.GetOCSPExpiry().IsZero())
+}
+
+func (this *CertCacheSuite) TestStatus() {
+	ocspResp, err := ocsp.ParseResponse(this.fakeOCSP, pkgt.CACert)
+	this.Require().NoError(err, "parsing fake OCSP response")
+
+	var status *Status
+	this.Require().False(this.ocspServerCalled(func() {
+		status = this.handler.Status()
+	}))
+	this.Require().NotNil(status)
+	this.Assert().Equal(pkgt.B3Certs[0].Subject.String(), status.Subject)
+	this.Assert().Equal(pkgt.B3Certs[0].NotBefore, status.NotBefore)
+	this.Assert().Equal(pkgt.B3Certs[0].NotAfter, status.NotAfter)
+	this.Assert().Empty(status.OCSPError)
+	this.Require().NotNil(status.OCSPThisUpdate)
+	this.Assert().Equal(ocspResp.ThisUpdate, *status.OCSPThisUpdate)
+	this.Require().NotNil(status.OCSPNextUpdate)
+	this.Assert().Equal(ocspResp.NextUpdate, *status.OCSPNextUpdate)
+	this.Require().NotNil(status.OCSPProducedAt)
+	this.Assert().Equal(ocspResp.ProducedAt, *status.OCSPProducedAt)
+	// No HTTP cache headers were served.
+	this.Assert().Nil(status.OCSPUpdateAfter)
+	this.Assert().False(status.OCSPPastRefreshTime)
+
+	this.fakeClock.Advance(4 * 24 * time.Hour)
+	this.Require().False(this.ocspServerCalled(func() {
+		status = this.handler.Status()
+	}))
+	this.Assert().True(status.OCSPPastRefreshTime)
+}
+
+func (this *CertCacheSuite) TestStatusWithoutOCSP() {
+	certCache := New(pkgt.B3Certs, nil, []string{"example.com"}, "cert.crt", "newcert.crt",
+		filepath.Join(this.tempDir, "ocsp"), nil, this.fakeClock.Now)
+	status := certCache.Status()
+	this.Require().NotNil(status)
+	this.Assert().Equal(pkgt.B3Certs[0].Subject.String(), status.Subject)
+	this.Assert().Equal("Missing OCSP response.", status.OCSPError)
+	this.Assert().Nil(status.OCSPNextUpdate)
+	this.Assert().Nil(status.OCSPUpdateAfter)
+}
+
+func (this *CertCacheSuite) TestPrewarmOCSPFresh() {
+	this.Require().NoError(os.Remove(filepath.Join(this.tempDir, "ocsp")))
+	certCache := this.newUninitialized()
+	var status *Status
+	var err error
+	this.Require().True(this.ocspServerCalled(func() {
+		status, err = certCache.PrewarmOCSP(context.Background())
+	}))
+	this.Require().NoError(err)
+	this.Require().NotNil(status)
+	this.Assert().Empty(status.OCSPError)
+	this.Assert().False(status.OCSPPastRefreshTime)
+	// The response was cached, for the instance to serve.
+	cached, err := ioutil.ReadFile(filepath.Join(this.tempDir, "ocsp"))
+	this.Require().NoError(err)
+	this.Assert().Equal(ocspFileContents(this.fakeOCSP), cached)
+	this.Assert().False(certCache.isInitialized)
+
+	// A fresh cached response is verified without a fetch.
+	this.Assert().False(this.ocspServerCalled(func() {
+		_, err = this.newUninitialized().PrewarmOCSP(context.Background())
+	}))
+	this.Assert().NoError(err)
+}
+
+func (this *CertCacheSuite) TestPrewarmOCSPPastRefreshTime() {
+	this.Require().NoError(os.Remove(filepath.Join(this.tempDir, "ocsp")))
+	var err error
+	this.fakeOCSP, err = FakeOCSPResponse(this.fakeClock.Now().Add(-4*24*time.Hour), this.fakeClock.Now())
+	this.Require().NoError(err, "creating past-midpoint OCSP response")
+	status, err := this.newUninitialized().PrewarmOCSP(context.Background())
+	this.Require().Error(err)
+	this.Assert().Contains(err.Error(), "past its refresh time")
+	this.Require().NotNil(status)
+	this.Assert().True(status.OCSPPastRefreshTime)
+}
+
+func (this *CertCacheSuite) TestPrewarmOCSPUsesRefreshPolicy() {
+	this.Require().NoError(os.Remove(filepath.Join(this.tempDir, "ocsp")))
+	var err error
+	// Two days into a seven day response: before its midpoint, but past a
+	// quarter of its validity.
+	this.fakeOCSP, err = FakeOCSPResponse(this.fakeClock.Now().Add(-2*24*time.Hour), this.fakeClock.Now())
+	this.Require().NoError(err, "creating OCSP response")
+	certCache := this.newUninitialized()
+	status, err := certCache.PrewarmOCSP(context.Background())
+	this.Require().NoError(err)
+	this.Assert().False(status.OCSPPastRefreshTime)
+
+	certCache.SetOCSPRefreshPolicy(0.25, 0, 0)
+	this.Assert().True(certCache.Status().OCSPPastRefreshTime)
+	status, err = certCache.PrewarmOCSP(context.Background())
+	this.Require().Error(err)
+	this.Assert().Contains(err.Error(), "past its refresh time")
+	this.Require().NotNil(status)
+	this.Assert().True(status.OCSPPastRefreshTime)
+}
+
+func (this *CertCacheSuite) TestPrewarmOCSPStale() {
+	this.Require().NoError(os.Remove(filepath.Join(this.tempDir, "ocsp")))
+	var err error
+	this.fakeOCSP, err = FakeOCSPResponse(this.fakeClock.Now().Add(-8*24*time.Hour), this.fakeClock.Now().Add(-8*24*time.Hour))
+	this.Require().NoError(err, "creating stale OCSP response")
+	status, err := this.newUninitialized().PrewarmOCSP(context.Background())
+	this.Require().Error(err)
+	this.Assert().Contains(err.Error(), "reading OCSP")
+	this.Require().NotNil(status)
+	this.Assert().NotEmpty(status.OCSPError)
+}
+
+func (this *CertCacheSuite) TestPrewarmOCSPMissing() {
+	this.Require().NoError(os.Remove(filepath.Join(this.tempDir, "ocsp")))
+	this.ocspHandler = func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusInternalServerError)
+	}
+	status, err := this.newUninitialized().PrewarmOCSP(context.Background())
+	this.Require().Error(err)
+	this.Assert().Contains(err.Error(), "Missing OCSP response")
+	this.Require().NotNil(status)
+	this.Assert().NotEmpty(status.OCSPError)
+}
+
+func (this *CertCacheSuite) TestRefreshOCSP() {
+	// The cached response is fresh, but RefreshOCSP fetches a new one anyway.
+	orig := this.fakeOCSP
+	now := this.fakeClock.Now()
+	var err error
+	this.fakeOCSP, err = FakeOCSPResponse(now.Add(-time.Minute), now)
+	this.Require().NoError(err, "creating fake OCSP response")
+	this.Require().NotEqual(orig, this.fakeOCSP)
+	this.Require().True(this.ocspServerCalled(func() {
+		this.Require().NoError(this.handler.RefreshOCSP(context.Background()))
+	}))
+	ocsp, _, err := this.handler.readOCSP(false)
+	this.Require().NoError(err)
+	this.Assert().Equal(this.fakeOCSP, ocsp)
+}
+
+func (this *CertCacheSuite) TestRefreshOCSPFailure() {
+	orig := this.fakeOCSP
+	called := false
+	this.ocspHandler = func(resp http.ResponseWriter, req *http.Request) {
+		called = true
+		resp.WriteHeader(http.StatusInternalServerError)
+	}
+	err := this.handler.RefreshOCSP(context.Background())
+	this.Assert().True(called)
+	this.Require().Error(err)
+	this.Assert().Contains(err.Error(), "serving the cached response")
+	// The cached response is still served.
+	ocsp, _, err := this.handler.readOCSP(false)
+	this.Require().NoError(err)
+	this.Assert().Equal(orig, ocsp)
+	this.Assert().NoError(this.handler.IsHealthy())
+}
+
+func (this *CertCacheSuite) TestRefreshOCSPDoesNotPersistUnhealthyResponse() {
+	orig := this.fakeOCSP
+	now := this.fakeClock.Now()
+	// Valid when fetched, but stale by the time it's health checked: from
+	// here on, the clock advances an hour per reading.
+	unhealthy, err := fakeOCSPResponseUntil(pkgt.B3Certs[0], now, now.Add(90*time.Minute), now)
+	this.Require().NoError(err, "creating fake OCSP response")
+	this.ocspHandler = func(resp http.ResponseWriter, req *http.Request) {
+		this.fakeClock.SetDelta(time.Hour)
+		_, err := resp.Write(unhealthy)
+		this.Require().NoError(err, "writing fake OCSP response")
+	}
+	err = this.handler.RefreshOCSP(context.Background())
+	this.fakeClock.SetDelta(time.Second)
+	this.Require().Error(err)
+	this.Assert().Contains(err.Error(), "health check")
+	// The cached response was not replaced, in memory or on disk.
+	ocsp, err := this.handler.readCachedOCSP()
+	this.Require().NoError(err)
+	this.Assert().Equal(orig, ocsp)
+	cached, err := ioutil.ReadFile(filepath.Join(this.tempDir, "ocsp"))
+	this.Require().NoError(err)
+	this.Assert().Equal(ocspFileContents(orig), cached)
+}
+
 func (this *CertCacheSuite) TestOCSPInvalidThisUpdate() {
 	// Set fake clock equal to cert NotBefore, so we can produce an OCSP
 	// where "now" is within its ThisUpdate/NextUpdate window, but the OCSP
 	// is itself outside of the cert's NotBefore/NotAfter window.
-	this.fakeClock.SecondsSince0 = pkgt.B3Certs[0].NotBefore.Sub(time.Unix(0, 0))
+	this.fakeClock.Set(pkgt.B3Certs[0].NotBefore)
 
 	err := os.Remove(filepath.Join(this.tempDir, "ocsp"))
 	this.Require().NoError(err, "deleting OCSP tempfile")
@@ -208,6 +627,57 @@ func (this *CertCacheSuite) TestOCSPInvalidThisUpdate() {
 	}))
 }
 
+func (this *CertCacheSuite) TestLogsOCSPFetched() {
+	this.handler.Stop()
+	err := os.Remove(filepath.Join(this.tempDir, "ocsp"))
+	this.Require().NoError(err, "deleting OCSP tempfile")
+
+	this.logger = &recordingLogger{}
+	this.handler, err = this.New()
+	this.Require().NoError(err)
+	this.Assert().Len(this.logger.find("INFO", "OCSP fetched"), 1)
+	this.Assert().Empty(this.logger.find("WARN", "OCSP rejected"))
+}
+
+func (this *CertCacheSuite) TestLogsOCSPRejected() {
+	// As in TestOCSPInvalidThisUpdate, build an OCSP response that predates
+	// the cert.
+	this.fakeClock.Set(pkgt.B3Certs[0].NotBefore)
+	this.handler.Stop()
+	err := os.Remove(filepath.Join(this.tempDir, "ocsp"))
+	this.Require().NoError(err, "deleting OCSP tempfile")
+	this.fakeOCSP, err = FakeOCSPResponse(this.fakeClock.Now().Add(-1*24*time.Hour), this.fakeClock.Now())
+	this.Require().NoError(err, "creating invalid OCSP response")
+
+	this.logger = &recordingLogger{}
+	this.handler, err = this.New()
+	this.Require().Error(err)
+	rejected := this.logger.find("WARN", "OCSP rejected")
+	if this.Assert().NotEmpty(rejected) {
+		this.Assert().Contains(rejected[0], "reason thisUpdate before certificate notBefore")
+	}
+	// There was no cached response to fall back to.
+	this.Assert().Empty(this.logger.find("WARN", "Falling back to cached OCSP response"))
+}
+
+func (this *CertCacheSuite) TestLogsFallbackToCachedOCSP() {
+	this.handler.Stop()
+	// Past the midpoint of the cached response's validity, but before its
+	// expiry, the responder returns garbage.
+	this.fakeClock.Advance(4 * 24 * time.Hour)
+	this.fakeOCSP = []byte("garbage")
+
+	this.logger = &recordingLogger{}
+	var err error
+	this.handler, err = this.New()
+	this.Require().NoError(err)
+	rejected := this.logger.find("WARN", "OCSP rejected")
+	if this.Assert().NotEmpty(rejected) {
+		this.Assert().Contains(rejected[0], "reason unparseable")
+	}
+	this.Assert().NotEmpty(this.logger.find("WARN", "Falling back to cached OCSP response"))
+}
+
 func (this *CertCacheSuite) TestCertCacheIsNotHealthy() {
 	// Prime memory cache with a past-midpoint OCSP:
 	err := os.Remove(filepath.Join(this.tempDir, "ocsp"))
@@ -232,6 +702,74 @@ func (this *CertCacheSuite) TestCertCacheIsNotHealthy() {
 	this.Assert().Error(this.handler.IsHealthy())
 }
 
+// Makes the cached OCSP response unusable, and configures the fake server to
+// serve a CRL, revoking the given serials, at /crl. Returns a pointer to the
+// number of CRL requests served.
+func (this *CertCacheSuite) setUpCRLFallback(revoked ...*big.Int) *int {
+	now := this.fakeClock.Now()
+	revokedCerts := []pkix.RevokedCertificate{}
+	for _, serial := range revoked {
+		revokedCerts = append(revokedCerts, pkix.RevokedCertificate{SerialNumber: serial, RevocationTime: now})
+	}
+	crl, err := pkgt.CACert.CreateCRL(rand.Reader, pkgt.CAKey, revokedCerts, now, now.Add(24*time.Hour))
+	this.Require().NoError(err, "creating CRL")
+
+	this.fakeOCSP = []byte("0xdeadbeef")
+	numCRLRequests := 0
+	this.ocspHandler = func(resp http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/crl" {
+			numCRLRequests++
+			_, err = resp.Write(crl)
+		} else {
+			_, err = resp.Write(this.fakeOCSP)
+		}
+		this.Require().NoError(err, "writing fake response")
+	}
+	err = os.Remove(filepath.Join(this.tempDir, "ocsp"))
+	this.Require().NoError(err, "deleting OCSP tempfile")
+	this.handler = New(pkgt.B3Certs, nil, []string{"example.com"}, "cert.crt", "newcert.crt",
+		filepath.Join(this.tempDir, "ocsp"), nil, this.fakeClock.Now)
+	this.handler.extractOCSPServer = func(*x509.Certificate) (string, error) {
+		return this.ocspServer.URL, nil
+	}
+	this.handler.extractCRLServer = func(*x509.Certificate) (string, error) {
+		return this.ocspServer.URL + "/crl", nil
+	}
+	this.handler.SetCRLFallback(true)
+	this.Require().Error(this.handler.Init())
+	return &numCRLRequests
+}
+
+func (this *CertCacheSuite) TestCRLFallbackHealthy() {
+	numCRLRequests := this.setUpCRLFallback(big.NewInt(1234))
+	this.Assert().Error(this.handler.IsOCSPHealthy(context.Background()))
+	this.Assert().NoError(this.handler.IsHealthy())
+	this.Assert().Equal(1, *numCRLRequests)
+
+	// The result is cached until the CRL's NextUpdate.
+	this.Assert().NoError(this.handler.IsHealthy())
+	this.Assert().Equal(1, *numCRLRequests)
+
+	resp := pkgt.NewRequest(this.T(), this.mux(), "/amppkg/cert/"+pkgt.CertName).Do()
+	this.Assert().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+	this.Assert().Equal("public, max-age=0", resp.Header.Get("Cache-Control"))
+}
+
+func (this *CertCacheSuite) TestCRLFallbackRevoked() {
+	this.setUpCRLFallback(big.NewInt(1234), pkgt.B3Certs[0].SerialNumber)
+	this.Assert().Error(this.handler.IsHealthy())
+
+	resp := pkgt.NewRequest(this.T(), this.mux(), "/amppkg/cert/"+pkgt.CertName).Do()
+	this.Assert().Equal(http.StatusInternalServerError, resp.StatusCode, "incorrect status: %#v", resp)
+}
+
+func (this *CertCacheSuite) TestCRLFallbackDisabled() {
+	numCRLRequests := this.setUpCRLFallback()
+	this.handler.SetCRLFallback(false)
+	this.Assert().Error(this.handler.IsHealthy())
+	this.Assert().Equal(0, *numCRLRequests)
+}
+
 func (this *CertCacheSuite) TestServes404OnMissingCertificate() {
 	resp := pkgt.NewRequest(this.T(), this.mux(), "/amppkg/cert/lalala").Do()
 	this.Assert().Equal(http.StatusNotFound, resp.StatusCode, "incorrect status: %#v", resp)
@@ -250,6 +788,36 @@ func (this *CertCacheSuite) TestOCSP() {
 	this.Assert().Equal(this.fakeOCSP, cbor["ocsp"])
 }
 
+func (this *CertCacheSuite) TestOCSPMaxAgeShortLived() {
+	this.setTime(this.fakeClock.Now())
+	now := this.fakeClock.Now()
+	for _, test := range []struct {
+		desc                   string
+		thisUpdate, nextUpdate time.Time
+		minRefreshInterval     time.Duration
+		expectedCacheControl   string
+	}{
+		// The midpoint of a 2-hour response is an hour away.
+		{"midpoint", now, now.Add(2 * time.Hour), 0, "public, max-age=3600"},
+		// The minimum refresh interval would put the refresh time past
+		// NextUpdate, 30 minutes away.
+		{"min refresh interval", now.Add(-time.Hour), now.Add(30 * time.Minute), 4 * time.Hour, "public, max-age=1800"},
+	} {
+		this.Require().NoError(os.Remove(filepath.Join(this.tempDir, "ocsp")), test.desc)
+		var err error
+		this.fakeOCSP, err = fakeOCSPResponseUntil(pkgt.B3Certs[0], test.thisUpdate, test.nextUpdate, now)
+		this.Require().NoError(err, test.desc)
+		this.handler = this.newUninitialized()
+		this.handler.SetOCSPRefreshPolicy(0, test.minRefreshInterval, 0)
+		this.Require().NoError(this.handler.Init(), test.desc)
+
+		resp := pkgt.NewRequest(this.T(), this.mux(), "/amppkg/cert/"+pkgt.CertName).Do()
+		this.Assert().Equal(http.StatusOK, resp.StatusCode, test.desc)
+		this.Assert().Equal(test.expectedCacheControl, resp.Header.Get("Cache-Control"), test.desc)
+		this.Assert().Equal(this.fakeOCSP, this.DecodeCBOR(resp.Body)["ocsp"], test.desc)
+	}
+}
+
 func (this *CertCacheSuite) TestOCSPCached() {
 	// Verify it is in the memory cache:
 	this.Assert().False(this.ocspServerCalled(func() {
@@ -301,7 +869,7 @@ func (this *CertCacheSuite) TestOCSPUpdateFromDisk() {
 	now := this.fakeClock.Now()
 	freshOCSP, err := FakeOCSPResponse(now, now)
 	this.Require().NoError(err, "creating fresh OCSP response")
-	err = ioutil.WriteFile(filepath.Join(this.tempDir, "ocsp"), freshOCSP, 0644)
+	err = ioutil.WriteFile(filepath.Join(this.tempDir, "ocsp"), ocspFileContents(freshOCSP), 0644)
 	this.Require().NoError(err, "writing fresh OCSP response to disk")
 
 	// On update, verify network is not called (fresh OCSP from disk is used):
@@ -311,67 +879,775 @@ func (this *CertCacheSuite) TestOCSPUpdateFromDisk() {
 	}))
 }
 
-func (this *CertCacheSuite) TestOCSPExpiredViaHTTPHeaders() {
-	// Prime memory and disk cache with a fresh OCSP but soon-to-expire HTTP headers:
-	err := os.Remove(filepath.Join(this.tempDir, "ocsp"))
-	this.Require().NoError(err, "deleting OCSP tempfile")
-	this.fakeOCSPExpiry = new(time.Time)
-	*this.fakeOCSPExpiry = time.Unix(0, 1) // Infinite past. time.Time{} is used as a sentinel value to mean no update.
-	this.Require().True(this.ocspServerCalled(func() {
+// Returns the contents of an OCSP cache file of the current format.
+func ocspFileContents(ocsp []byte) []byte {
+	return append([]byte(ocspFileFormat+"/"+strconv.Itoa(ocspFileFormatVersion)+"\n"), ocsp...)
+}
+
+func (this *CertCacheSuite) TestOCSPRefreshesUnversionedFile() {
+	// Prime disk cache with a fresh OCSP, in the unversioned format of
+	// older amppkgs.
+	now := this.fakeClock.Now()
+	legacyOCSP, err := FakeOCSPResponse(now, now)
+	this.Require().NoError(err, "creating fresh OCSP response")
+	ocspPath := filepath.Join(this.tempDir, "ocsp")
+	this.Require().NoError(ioutil.WriteFile(ocspPath, legacyOCSP, 0644), "writing legacy OCSP response to disk")
+
+	// It is refetched rather than trusted, and rewritten in the current
+	// format.
+	this.Assert().True(this.ocspServerCalled(func() {
 		this.handler, err = this.New()
-		this.Require().NoError(err, "reinitializing CertCache")
+		this.Require().NoError(err, "reinstantiating CertCache")
 	}))
-	this.Require().Equal(time.Unix(0, 1), this.handler.ocspUpdateAfter)
+	contents, err := ioutil.ReadFile(ocspPath)
+	this.Require().NoError(err, "reading OCSP cache file")
+	this.Assert().Equal(ocspFileContents(this.fakeOCSP), contents)
 
-	// Verify that, 2 seconds later, a new fetch is attempted.
-	this.Assert().True(this.ocspServerCalled(func() {
-		_, _, err := this.handler.readOCSP(true)
-		this.Require().NoError(err, "updating OCSP")
+	// Once rewritten, it is used by other replicas.
+	this.Assert().False(this.ocspServerCalled(func() {
+		replica, err := this.New()
+		this.Require().NoError(err, "instantiating second CertCache")
+		replica.Stop()
 	}))
 }
 
-func (this *CertCacheSuite) TestOCSPIgnoreExpiredNextUpdate() {
-	// Prime memory and disk cache with a past-midpoint OCSP:
-	err := os.Remove(filepath.Join(this.tempDir, "ocsp"))
-	this.Require().NoError(err, "deleting OCSP tempfile")
-	staleOCSP, err := FakeOCSPResponse(this.fakeClock.Now().Add(-4*24*time.Hour), this.fakeClock.Now())
-	this.Require().NoError(err, "creating stale OCSP response")
-	this.fakeOCSP = staleOCSP
-	this.Require().True(this.ocspServerCalled(func() {
-		this.handler, err = this.New()
-		this.Require().NoError(err, "reinstantiating CertCache")
-	}))
+func (this *CertCacheSuite) TestOCSPRefreshesIncompatibleVersion() {
+	now := this.fakeClock.Now()
+	ocsp, err := FakeOCSPResponse(now, now)
+	this.Require().NoError(err, "creating fresh OCSP response")
+	ocspPath := filepath.Join(this.tempDir, "ocsp")
+	futureVersion := append([]byte(ocspFileFormat+"/"+strconv.Itoa(ocspFileFormatVersion+1)+"\n"), ocsp...)
+	this.Require().NoError(ioutil.WriteFile(ocspPath, futureVersion, 0644), "writing OCSP response to disk")
 
-	// Try to update with an invalid OCSP:
-	this.fakeOCSP, err = FakeOCSPResponse(this.fakeClock.Now().Add(-8*24*time.Hour), this.fakeClock.Now())
-	this.Require().NoError(err, "creating expired OCSP response")
 	this.Assert().True(this.ocspServerCalled(func() {
-		_, _, err := this.handler.readOCSP(true)
-		this.Require().NoError(err, "updating OCSP")
+		this.handler, err = this.New()
+		this.Require().NoError(err, "reinstantiating CertCache")
 	}))
-
-	// Verify that the invalid update doesn't squash the valid cache entry.
-	ocsp, _, err := this.handler.readOCSP(true)
-	this.Require().NoError(err, "reading OCSP")
-	this.Assert().Equal(staleOCSP, ocsp)
 }
 
-func (this *CertCacheSuite) TestOCSPIgnoreInvalidProducedAt() {
-	// Prime memory and disk cache with a past-midpoint OCSP:
+func (this *CertCacheSuite) TestOCSPLockSharedAcrossReplicas() {
+	// Both replicas start with empty memory and disk caches.
 	err := os.Remove(filepath.Join(this.tempDir, "ocsp"))
 	this.Require().NoError(err, "deleting OCSP tempfile")
-	staleOCSP, err := FakeOCSPResponse(this.fakeClock.Now().Add(-4*24*time.Hour), this.fakeClock.Now())
-	this.Require().NoError(err, "creating stale OCSP response")
-	this.fakeOCSP = staleOCSP
-	this.Require().True(this.ocspServerCalled(func() {
-		this.handler, err = this.New()
-		this.Require().NoError(err, "reinstantiating CertCache")
-	}))
 
-	// Try to update with an OCSP with an invalid ProducedAt:
-	this.fakeOCSP, err = FakeOCSPResponse(this.fakeClock.Now().Add(-4*24*time.Hour), time.Unix(0, 0))
-	this.Require().NoError(err, "creating invalid OCSP response")
-	this.Assert().True(this.ocspServerCalled(func() {
+	// Hold the first fetch open until the second replica is waiting on it.
+	var numFetches int32
+	fetching := make(chan struct{})
+	release := make(chan struct{})
+	this.ocspHandler = func(resp http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&numFetches, 1) == 1 {
+			close(fetching)
+		}
+		<-release
+		_, err := resp.Write(this.fakeOCSP)
+		this.Require().NoError(err, "writing fake OCSP response")
+	}
+
+	type replica struct {
+		certCache *CertCache
+		err       error
+	}
+	replicas := make(chan replica, 2)
+	newReplica := func() {
+		certCache, err := this.New()
+		replicas <- replica{certCache, err}
+	}
+	go newReplica()
+	<-fetching
+	this.logger = &recordingLogger{}
+	waiting := this.logger.await("DEBUG", "Waiting for another replica to update")
+	go newReplica()
+	<-waiting
+	close(release)
+
+	for i := 0; i < 2; i++ {
+		r := <-replicas
+		this.Require().NoError(r.err, "instantiating CertCache")
+		defer r.certCache.Stop()
+		ocsp, _, err := r.certCache.readOCSP(false)
+		this.Require().NoError(err, "reading OCSP")
+		this.Assert().Equal(this.fakeOCSP, ocsp)
+	}
+	this.Assert().EqualValues(1, atomic.LoadInt32(&numFetches))
+}
+
+func (this *CertCacheSuite) TestOCSPUpdateReturnedIfFileLocked() {
+	file := &LocalFile{path: filepath.Join(this.tempDir, "locked"), logger: StdLogger{}}
+	other := flock.New(file.path + ".lock")
+	defer other.Unlock()
+	contents, err := file.Read(context.Background(), func([]byte) bool { return true }, func([]byte) []byte {
+		// Another process takes the lock before the update can be written.
+		locked, err := other.TryLock()
+		this.Require().NoError(err, "locking")
+		this.Require().True(locked, "locking")
+		return []byte("updated")
+	})
+	this.Require().NoError(err)
+	this.Assert().Equal([]byte("updated"), contents)
+}
+
+func (this *CertCacheSuite) TestOCSPLeaseReleasedOnlyByOwner() {
+	file := &LocalFile{path: filepath.Join(this.tempDir, "leased"), logger: StdLogger{}}
+	token, leased, err := file.acquireLease()
+	this.Require().NoError(err)
+	this.Require().True(leased)
+
+	// The lease expires, and another replica takes it over.
+	this.Require().NoError(ioutil.WriteFile(file.leasePath(), []byte("other"), 0600))
+	file.releaseLease(token)
+	this.Assert().FileExists(file.leasePath())
+
+	this.Require().NoError(ioutil.WriteFile(file.leasePath(), []byte(token), 0600))
+	file.releaseLease(token)
+	this.Assert().NoFileExists(file.leasePath())
+}
+
+// Returns a CertCache for B3Certs, whose cert file is in tempDir and is watched
+// for modifications.
+func (this *CertCacheSuite) newWatchingCertFile() *CertCache {
+	certFile := filepath.Join(this.tempDir, "cert.crt")
+	this.Require().NoError(certloader.WriteCertsToFile(pkgt.B3Certs, certFile), "writing cert file")
+	certCache := New(pkgt.B3Certs, nil, []string{"amppackageexample.com"}, certFile, "",
+		filepath.Join(this.tempDir, "ocsp"), nil, this.fakeClock.Now)
+	if this.logger != nil {
+		certCache.SetLogger(this.logger)
+	}
+	certCache.extractOCSPServer = func(*x509.Certificate) (string, error) {
+		return this.ocspServer.URL, nil
+	}
+	// Use a long interval so that the test, not the ticker, triggers reloads.
+	certCache.WatchCertFile(time.Hour, false)
+	this.Require().NoError(certCache.Init(), "initializing CertCache")
+	return certCache
+}
+
+// Replaces the cert file with the given chain, and bumps its mtime.
+func (this *CertCacheSuite) rotateCertFile(certCache *CertCache, certs []*x509.Certificate) {
+	this.Require().NoError(certloader.WriteCertsToFile(certs, certCache.CertFile), "rewriting cert file")
+	modTime := certCache.certFileModTime.Add(time.Second)
+	this.Require().NoError(os.Chtimes(certCache.CertFile, modTime, modTime), "touching cert file")
+}
+
+func (this *CertCacheSuite) TestReloadsRotatedCertFile() {
+	certCache := this.newWatchingCertFile()
+	defer certCache.Stop()
+	this.Require().Equal(pkgt.B3Certs[0], certCache.GetLatestCert())
+
+	now := this.fakeClock.Now()
+	newOCSP, err := fakeOCSPResponseForCert(pkgt.B3Certs91Days[0], now, now)
+	this.Require().NoError(err, "creating OCSP response for new cert")
+	this.fakeOCSP = newOCSP
+	this.rotateCertFile(certCache, pkgt.B3Certs91Days)
+
+	this.Assert().True(this.ocspServerCalled(certCache.reloadCertFileIfChanged))
+	this.Assert().Equal(pkgt.B3Certs91Days[0], certCache.GetLatestCert())
+	ocsp, _, err := certCache.readOCSP(false)
+	this.Require().NoError(err, "reading OCSP")
+	this.Assert().Equal(newOCSP, ocsp)
+
+	// No further fetches until the file changes again.
+	this.Assert().False(this.ocspServerCalled(certCache.reloadCertFileIfChanged))
+}
+
+func (this *CertCacheSuite) TestKeepsOldCertUntilNewOCSPIsHealthy() {
+	certCache := this.newWatchingCertFile()
+	defer certCache.Stop()
+
+	// The OCSP server still serves a response for the old cert.
+	this.rotateCertFile(certCache, pkgt.B3Certs91Days)
+	this.Assert().True(this.ocspServerCalled(certCache.reloadCertFileIfChanged))
+	this.Assert().Equal(pkgt.B3Certs[0], certCache.GetLatestCert())
+	this.Assert().NoError(certCache.IsHealthy())
+
+	// Retries on the next check, once the OCSP server is caught up.
+	now := this.fakeClock.Now()
+	this.fakeOCSP, _ = fakeOCSPResponseForCert(pkgt.B3Certs91Days[0], now, now)
+	this.Assert().True(this.ocspServerCalled(certCache.reloadCertFileIfChanged))
+	this.Assert().Equal(pkgt.B3Certs91Days[0], certCache.GetLatestCert())
+	this.Assert().NoError(certCache.IsHealthy())
+}
+
+// An Updateable that calls intercept on each Read, before delegating it.
+func (this *CertCacheSuite) TestOCSPFileUsesOptionsSetBeforeInit() {
+	certCache := this.newUninitialized()
+	logger := &recordingLogger{}
+	// In either order, the options apply to the cache Init builds.
+	certCache.SetOCSPLockTimeout(time.Minute)
+	certCache.SetLogger(logger)
+	this.Require().NoError(certCache.Init())
+	defer certCache.Stop()
+
+	chained, ok := certCache.ocspFile.(*Chained)
+	this.Require().True(ok, "OCSP cache is %T", certCache.ocspFile)
+	this.Assert().Equal(logger, chained.logger)
+	versioned, ok := chained.second.(*Versioned)
+	this.Require().True(ok, "OCSP disk cache is %T", chained.second)
+	this.Assert().Equal(logger, versioned.logger)
+	local, ok := versioned.inner.(*LocalFile)
+	this.Require().True(ok, "OCSP file is %T", versioned.inner)
+	this.Assert().Equal(time.Minute, local.leaseTimeout)
+	this.Assert().Equal(logger, local.logger)
+	this.Assert().Equal(filepath.Join(this.tempDir, "ocsp"), local.path)
+}
+
+type interceptedUpdateable struct {
+	Updateable
+	intercept func(update func([]byte) []byte) func([]byte) []byte
+}
+
+func (this *interceptedUpdateable) Read(ctx context.Context, isExpired func([]byte) bool, update func([]byte) []byte) ([]byte, error) {
+	return this.Updateable.Read(ctx, isExpired, this.intercept(update))
+}
+
+func (this *CertCacheSuite) TestReloadsCertFileWithoutHoldingCertsMu() {
+	certCache := this.newWatchingCertFile()
+	defer certCache.Stop()
+	now := this.fakeClock.Now()
+	newOCSP, err := fakeOCSPResponseForCert(pkgt.B3Certs91Days[0], now, now)
+	this.Require().NoError(err, "creating OCSP response for new cert")
+	this.fakeOCSP = newOCSP
+	certCache.ocspFile = &interceptedUpdateable{certCache.ocspFile, func(update func([]byte) []byte) func([]byte) []byte {
+		if update == nil {
+			return nil
+		}
+		return func(orig []byte) []byte {
+			this.Assert().True(certCache.certsMu.TryLock(), "certsMu held while writing OCSP")
+			certCache.certsMu.Unlock()
+			return update(orig)
+		}
+	}}
+
+	this.rotateCertFile(certCache, pkgt.B3Certs91Days)
+	certCache.reloadCertFileIfChanged()
+	this.Assert().Equal(pkgt.B3Certs91Days[0], certCache.GetLatestCert())
+}
+
+func (this *CertCacheSuite) TestDoesNotReloadCertIfOCSPReplaced() {
+	certCache := this.newWatchingCertFile()
+	defer certCache.Stop()
+	current, _, err := certCache.readOCSP(false)
+	this.Require().NoError(err, "reading OCSP")
+	now := this.fakeClock.Now()
+	this.fakeOCSP, err = fakeOCSPResponseForCert(pkgt.B3Certs91Days[0], now, now)
+	this.Require().NoError(err, "creating OCSP response for new cert")
+	// Another replica refreshes the old chain's response instead, as the new
+	// one is written.
+	certCache.ocspFile = &interceptedUpdateable{certCache.ocspFile, func(update func([]byte) []byte) func([]byte) []byte {
+		if update == nil {
+			return nil
+		}
+		return func([]byte) []byte { return current }
+	}}
+
+	this.rotateCertFile(certCache, pkgt.B3Certs91Days)
+	certCache.reloadCertFileIfChanged()
+	this.Assert().Equal(pkgt.B3Certs[0], certCache.GetLatestCert())
+	this.Assert().NoError(certCache.IsHealthy())
+}
+
+func (this *CertCacheSuite) TestDoesNotReloadCertForOtherDomain() {
+	certCache := this.newWatchingCertFile()
+	defer certCache.Stop()
+
+	this.rotateCertFile(certCache, pkgt.B3Certs2)
+	this.Assert().False(this.ocspServerCalled(certCache.reloadCertFileIfChanged))
+	this.Assert().Equal(pkgt.B3Certs[0], certCache.GetLatestCert())
+}
+
+func (this *CertCacheSuite) TestStopAbandonsCertFileReload() {
+	certCache := this.newWatchingCertFile()
+	fetching := make(chan struct{})
+	this.ocspHandler = func(resp http.ResponseWriter, req *http.Request) {
+		close(fetching)
+		// The OCSP responder hangs until the client gives up.
+		<-req.Context().Done()
+	}
+	this.rotateCertFile(certCache, pkgt.B3Certs91Days)
+	reloaded := make(chan struct{})
+	go func() {
+		certCache.reloadCertFileIfChanged()
+		close(reloaded)
+	}()
+	<-fetching
+
+	certCache.Stop()
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		this.Fail("reload not abandoned by Stop")
+	}
+	this.Assert().Equal(pkgt.B3Certs[0], certCache.GetLatestCert())
+}
+
+// Returns a CertCache for B3Certs, as by newWatchingCertFile, with the given
+// renewal certs pending.
+func (this *CertCacheSuite) newWithRenewedCerts(renewedCerts []*x509.Certificate) *CertCache {
+	certCache := this.newWatchingCertFile()
+	certCache.NewCertFile = filepath.Join(this.tempDir, "newcert.crt")
+	certCache.setNewCerts(renewedCerts)
+	return certCache
+}
+
+func (this *CertCacheSuite) TestBootstrapsRenewalOCSPByReuse() {
+	// The renewed chain shares the current leaf, so the current OCSP
+	// response applies to it.
+	renewedCerts := append([]*x509.Certificate{}, pkgt.B3Certs...)
+	certCache := this.newWithRenewedCerts(renewedCerts)
+	defer certCache.Stop()
+	current, _, err := certCache.readOCSP(false)
+	this.Require().NoError(err, "reading OCSP")
+
+	this.Assert().False(this.ocspServerCalled(certCache.switchToRenewedCerts))
+	this.Assert().False(certCache.hasRenewalCert())
+	ocsp, _, err := certCache.readOCSP(false)
+	this.Require().NoError(err, "reading OCSP")
+	this.Assert().Equal(current, ocsp)
+}
+
+func (this *CertCacheSuite) TestBootstrapsRenewalOCSPByFetch() {
+	certCache := this.newWithRenewedCerts(pkgt.B3Certs91Days)
+	defer certCache.Stop()
+
+	// The current OCSP response doesn't apply to the new leaf, and the OCSP
+	// server still serves a response for the old cert, so the current certs
+	// are kept.
+	this.Assert().True(this.ocspServerCalled(certCache.switchToRenewedCerts))
+	this.Assert().Equal(pkgt.B3Certs[0], certCache.GetLatestCert())
+	this.Assert().True(certCache.hasRenewalCert())
+	this.Assert().NoError(certCache.IsHealthy())
+
+	// Once the OCSP server is caught up, the renewed certs are swapped in,
+	// along with the fetched response.
+	now := this.fakeClock.Now()
+	newOCSP, err := fakeOCSPResponseForCert(pkgt.B3Certs91Days[0], now, now)
+	this.Require().NoError(err, "creating OCSP response for new cert")
+	this.fakeOCSP = newOCSP
+	this.Assert().True(this.ocspServerCalled(certCache.switchToRenewedCerts))
+	this.Assert().Equal(pkgt.B3Certs91Days[0], certCache.GetLatestCert())
+	this.Assert().False(certCache.hasRenewalCert())
+	this.Assert().False(this.ocspServerCalled(func() {
+		ocsp, _, err := certCache.readOCSP(false)
+		this.Require().NoError(err, "reading OCSP")
+		this.Assert().Equal(newOCSP, ocsp)
+	}))
+	this.Assert().NoError(certCache.IsHealthy())
+}
+
+func (this *CertCacheSuite) TestSwitchesToRenewedCertsWithoutHoldingLocks() {
+	certCache := this.newWithRenewedCerts(pkgt.B3Certs91Days)
+	defer certCache.Stop()
+	now := this.fakeClock.Now()
+	newOCSP, err := fakeOCSPResponseForCert(pkgt.B3Certs91Days[0], now, now)
+	this.Require().NoError(err, "creating OCSP response for new cert")
+	this.fakeOCSP = newOCSP
+	// Writing the response may wait on another replica's lease, so it must
+	// not block GetLatestCert or the renewal.
+	certCache.ocspFile = &interceptedUpdateable{certCache.ocspFile, func(update func([]byte) []byte) func([]byte) []byte {
+		if update == nil {
+			return nil
+		}
+		return func(orig []byte) []byte {
+			this.Assert().True(certCache.certsMu.TryLock(), "certsMu held while writing OCSP")
+			certCache.certsMu.Unlock()
+			this.Assert().True(certCache.renewedCertsMu.TryLock(), "renewedCertsMu held while writing OCSP")
+			certCache.renewedCertsMu.Unlock()
+			return update(orig)
+		}
+	}}
+
+	this.Assert().True(this.ocspServerCalled(certCache.switchToRenewedCerts))
+	this.Assert().Equal(pkgt.B3Certs91Days[0], certCache.GetLatestCert())
+	ocsp, err := certCache.readCachedOCSP()
+	this.Require().NoError(err, "reading cached OCSP")
+	this.Assert().Equal(newOCSP, ocsp)
+}
+
+func (this *CertCacheSuite) TestSwitchToRenewedCertsPurgesReplacedOCSP() {
+	certCache := this.newWithRenewedCerts(pkgt.B3Certs91Days)
+	defer certCache.Stop()
+	current, _, err := certCache.readOCSP(false)
+	this.Require().NoError(err, "reading OCSP")
+	now := this.fakeClock.Now()
+	this.fakeOCSP, err = fakeOCSPResponseForCert(pkgt.B3Certs91Days[0], now, now)
+	this.Require().NoError(err, "creating OCSP response for new cert")
+	// Another replica refreshes the old chain's response instead, as the new
+	// one is written.
+	certCache.ocspFile = &interceptedUpdateable{certCache.ocspFile, func(update func([]byte) []byte) func([]byte) []byte {
+		if update == nil {
+			return nil
+		}
+		return func([]byte) []byte { return current }
+	}}
+
+	this.Assert().True(this.ocspServerCalled(certCache.switchToRenewedCerts))
+	this.Assert().Equal(pkgt.B3Certs91Days[0], certCache.GetLatestCert())
+	// The old chain's response is purged, to be refetched for the new one.
+	_, err = os.Stat(certCache.ocspFilePath)
+	this.Assert().True(os.IsNotExist(err), "OCSP cache not purged: %v", err)
+}
+
+func (this *CertCacheSuite) TestServesPreviousCertAfterRenewal() {
+	certCache := this.newWithRenewedCerts(pkgt.B3Certs91Days)
+	defer certCache.Stop()
+	oldOCSP, _, err := certCache.readOCSP(false)
+	this.Require().NoError(err, "reading OCSP")
+	now := this.fakeClock.Now()
+	this.fakeOCSP, err = fakeOCSPResponseForCert(pkgt.B3Certs91Days[0], now, now)
+	this.Require().NoError(err, "creating OCSP response for new cert")
+	// The renewal isn't locked while its OCSP response is fetched.
+	defaultHandler := this.ocspHandler
+	this.ocspHandler = func(resp http.ResponseWriter, req *http.Request) {
+		this.Assert().True(certCache.renewedCertsMu.TryLock(), "renewedCertsMu held while fetching OCSP")
+		certCache.renewedCertsMu.Unlock()
+		defaultHandler(resp, req)
+	}
+	this.Require().True(this.ocspServerCalled(certCache.switchToRenewedCerts))
+	this.Require().Equal(pkgt.B3Certs91Days[0], certCache.GetLatestCert())
+	certMux := mux.New(mux.Handlers{CertCache: certCache})
+
+	resp := pkgt.NewRequest(this.T(), certMux, "/amppkg/cert/"+util.CertName(pkgt.B3Certs91Days[0])).Do()
+	this.Assert().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+
+	// SXGs signed before the switch reference the old cert, which is served
+	// with its last OCSP response until that expires.
+	oldCertURL := "/amppkg/cert/" + util.CertName(pkgt.B3Certs[0])
+	resp = pkgt.NewRequest(this.T(), certMux, oldCertURL).Do()
+	this.Assert().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+	maxAge, err := strconv.Atoi(strings.TrimPrefix(resp.Header.Get("Cache-Control"), "public, max-age="))
+	this.Require().NoError(err, "parsing Cache-Control")
+	this.Assert().InDelta(7*24*60*60, maxAge, 60)
+	cbor := this.DecodeCBOR(resp.Body)
+	this.Assert().Equal(pkgt.B3Certs[0].Raw, cbor["cert"])
+	this.Assert().Equal(oldOCSP, cbor["ocsp"])
+
+	this.fakeClock.Advance(7 * 24 * time.Hour)
+	resp = pkgt.NewRequest(this.T(), certMux, oldCertURL).Do()
+	this.Assert().Equal(http.StatusNotFound, resp.StatusCode, "incorrect status: %#v", resp)
+}
+
+func (this *CertCacheSuite) TestBootstrapsRenewalOCSPByFetchPolicy() {
+	renewedCerts := append([]*x509.Certificate{}, pkgt.B3Certs...)
+	certCache := this.newWithRenewedCerts(renewedCerts)
+	defer certCache.Stop()
+	certCache.SetRenewalOCSPBootstrap(util.RenewalOCSPFetch)
+
+	// Even though the current response applies, a fresh one is fetched.
+	now := this.fakeClock.Now()
+	freshOCSP, err := FakeOCSPResponse(now, now)
+	this.Require().NoError(err, "creating fresh OCSP response")
+	this.fakeOCSP = freshOCSP
+	this.Assert().True(this.ocspServerCalled(certCache.switchToRenewedCerts))
+	this.Assert().False(certCache.hasRenewalCert())
+	ocsp, _, err := certCache.readOCSP(false)
+	this.Require().NoError(err, "reading OCSP")
+	this.Assert().Equal(freshOCSP, ocsp)
+}
+
+func (this *CertCacheSuite) TestOCSPExpiredViaHTTPHeaders() {
+	// Prime memory and disk cache with a fresh OCSP but soon-to-expire HTTP headers:
+	err := os.Remove(filepath.Join(this.tempDir, "ocsp"))
+	this.Require().NoError(err, "deleting OCSP tempfile")
+	this.fakeOCSPExpiry = new(time.Time)
+	*this.fakeOCSPExpiry = time.Unix(0, 1) // Infinite past. time.Time{} is used as a sentinel value to mean no update.
+	this.Require().True(this.ocspServerCalled(func() {
+		this.handler, err = this.New()
+		this.Require().NoError(err, "reinitializing CertCache")
+	}))
+	this.Require().Equal(time.Unix(0, 1), this.handler.ocspUpdateAfter)
+
+	// Verify that, 2 seconds later, a new fetch is attempted.
+	this.Assert().True(this.ocspServerCalled(func() {
+		_, _, err := this.handler.readOCSP(true)
+		this.Require().NoError(err, "updating OCSP")
+	}))
+}
+
+// Sets the fake clock to the given time, and stops it from advancing.
+// Returns an initialized CertCache for certs, whose certfetcher requests certs
+// from acmeClient.
+func (this *CertCacheSuite) newWithFetcher(certs []*x509.Certificate, acmeClient certfetcher.ACMEClient) *CertCache {
+	certCache := New(certs, certfetcher.NewWithClient(acmeClient, nil, nil), []string{"amppackageexample.com"},
+		filepath.Join(this.tempDir, "cert.crt"), filepath.Join(this.tempDir, "newcert.crt"),
+		filepath.Join(this.tempDir, "ocsp"), nil, this.fakeClock.Now)
+	if this.logger != nil {
+		certCache.SetLogger(this.logger)
+	}
+	certCache.extractOCSPServer = func(*x509.Certificate) (string, error) {
+		return this.ocspServer.URL, nil
+	}
+	this.certCachesMu.Lock()
+	this.certCaches = append(this.certCaches, certCache)
+	this.certCachesMu.Unlock()
+	this.Require().NoError(certCache.Init(), "initializing CertCache")
+	return certCache
+}
+
+// Serves, for whichever of certs is requested, an OCSP response produced now.
+func (this *CertCacheSuite) serveOCSPFor(certs ...*x509.Certificate) {
+	this.ocspHandler = func(resp http.ResponseWriter, req *http.Request) {
+		this.ocspServerWasCalled = true
+		der, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(req.URL.Path, "/"))
+		this.Require().NoError(err, "decoding OCSP request")
+		ocspReq, err := ocsp.ParseRequest(der)
+		this.Require().NoError(err, "parsing OCSP request")
+		for _, cert := range certs {
+			if cert.SerialNumber.Cmp(ocspReq.SerialNumber) == 0 {
+				now := this.fakeClock.Now()
+				ocspResp, err := fakeOCSPResponseForCert(cert, now, now)
+				this.Require().NoError(err, "creating fake OCSP response")
+				_, err = resp.Write(ocspResp)
+				this.Require().NoError(err, "writing fake OCSP response")
+				return
+			}
+		}
+		resp.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (this *CertCacheSuite) TestFetcherObtainsMissingCert() {
+	acmeClient := &pkgt.FakeACMEClient{Certs: pkgt.B3Certs}
+	certCache := this.newWithFetcher(nil, acmeClient)
+
+	this.Assert().Equal(1, acmeClient.Obtains())
+	renewals, _ := acmeClient.Renewals()
+	this.Assert().Equal(0, renewals)
+	this.Assert().Equal(pkgt.B3Certs[0], certCache.GetLatestCert())
+	this.Assert().NoError(certCache.IsHealthy())
+	onDisk, err := certloader.LoadAndValidateCertsFromFile(certCache.CertFile, false)
+	this.Require().NoError(err, "reading cert file")
+	this.Assert().Equal(pkgt.B3Certs[0].Raw, onDisk[0].Raw)
+}
+
+func (this *CertCacheSuite) TestFetcherRenewsCertDueForRenewal() {
+	acmeClient := &pkgt.FakeACMEClient{Certs: pkgt.B3Certs91Days}
+	certCache := this.newWithFetcher(pkgt.B3Certs, acmeClient)
+	renewals, _ := acmeClient.Renewals()
+	this.Require().Equal(0, renewals)
+
+	this.setTime(certCache.certRenewalTime(pkgt.B3Certs[0]))
+	this.serveOCSPFor(pkgt.B3Certs[0], pkgt.B3Certs91Days[0])
+	certCache.updateCertIfNecessary()
+
+	renewals, renewedCerts := acmeClient.Renewals()
+	this.Assert().Equal(1, renewals)
+	this.Assert().Equal(pkgt.B3Certs, renewedCerts)
+	this.Assert().Equal(0, acmeClient.Obtains())
+	this.Assert().Equal(pkgt.B3Certs91Days[0], certCache.GetLatestCert())
+	this.Assert().False(certCache.hasRenewalCert())
+	this.Assert().NoError(certCache.IsHealthy())
+}
+
+func (this *CertCacheSuite) TestFetcherRenewsExpiredCert() {
+	acmeClient := &pkgt.FakeACMEClient{Certs: pkgt.B3Certs91Days}
+	certCache := this.newWithFetcher(pkgt.B3Certs, acmeClient)
+
+	this.setTime(pkgt.B3Certs[0].NotAfter.Add(time.Minute))
+
+	// GetLatestCert renews it synchronously.
+	this.Assert().Equal(pkgt.B3Certs91Days[0], certCache.GetLatestCert())
+	renewals, renewedCerts := acmeClient.Renewals()
+	this.Assert().Equal(1, renewals)
+	this.Assert().Equal(pkgt.B3Certs, renewedCerts)
+}
+
+func (this *CertCacheSuite) TestFetcherKeepsCertOnError() {
+	acmeClient := &pkgt.FakeACMEClient{Err: errors.New("CA unavailable")}
+	certCache := this.newWithFetcher(pkgt.B3Certs, acmeClient)
+
+	this.setTime(certCache.certRenewalTime(pkgt.B3Certs[0]))
+	certCache.updateCertIfNecessary()
+
+	renewals, _ := acmeClient.Renewals()
+	this.Assert().Equal(1, renewals)
+	this.Assert().Equal(pkgt.B3Certs[0], certCache.GetLatestCert())
+	this.Assert().False(certCache.hasRenewalCert())
+}
+
+func (this *CertCacheSuite) setTime(t time.Time) {
+	this.fakeClock.Set(t)
+	this.fakeClock.SetDelta(0)
+}
+
+func (this *CertCacheSuite) TestOCSPRefreshDefaultsToMidpoint() {
+	ocspResp, err := ocsp.ParseResponse(this.fakeOCSP, pkgt.CACert)
+	this.Require().NoError(err, "parsing fake OCSP response")
+	this.Assert().Equal(ocspResp.ThisUpdate.Add(84*time.Hour), this.handler.ocspRefreshTime(ocspResp))
+}
+
+func (this *CertCacheSuite) TestOCSPRefreshFraction() {
+	ocspResp, err := ocsp.ParseResponse(this.fakeOCSP, pkgt.CACert)
+	this.Require().NoError(err, "parsing fake OCSP response")
+	this.handler.SetOCSPRefreshPolicy(0.25, 0, 0)
+	// A quarter of 7 days.
+	refreshTime := ocspResp.ThisUpdate.Add(42 * time.Hour)
+	this.Assert().Equal(refreshTime, this.handler.ocspRefreshTime(ocspResp))
+
+	// Long before the refresh time, the next check is at the usual interval.
+	this.setTime(refreshTime.Add(-24 * time.Hour))
+	this.Assert().Equal(ocspCheckInterval, this.handler.nextOCSPCheck(this.fakeClock.Now()))
+
+	// Shortly before, the next check is scheduled for the refresh time.
+	this.setTime(refreshTime.Add(-30 * time.Minute))
+	this.Assert().Equal(30*time.Minute, this.handler.nextOCSPCheck(this.fakeClock.Now()))
+	this.setTime(refreshTime.Add(-10 * time.Second))
+	this.Assert().Equal(ocspMinCheckInterval, this.handler.nextOCSPCheck(this.fakeClock.Now()))
+	this.Assert().False(this.ocspServerCalled(func() {
+		_, _, err := this.handler.readOCSP(true)
+		this.Require().NoError(err, "reading OCSP")
+	}))
+
+	// After, the response is refreshed.
+	this.setTime(refreshTime.Add(time.Second))
+	this.Assert().True(this.ocspServerCalled(func() {
+		_, _, err := this.handler.readOCSP(true)
+		this.Require().NoError(err, "updating OCSP")
+	}))
+	// The fake server didn't serve a fresher response, so the refresh is
+	// overdue, and retried at the usual interval.
+	this.Assert().Equal(ocspCheckInterval, this.handler.nextOCSPCheck(this.fakeClock.Now()))
+}
+
+func (this *CertCacheSuite) TestOCSPRefreshFixedInterval() {
+	ocspResp, err := ocsp.ParseResponse(this.fakeOCSP, pkgt.CACert)
+	this.Require().NoError(err, "parsing fake OCSP response")
+	this.handler.SetOCSPRefreshStrategy(util.OCSPRefreshFixed, 6*time.Hour)
+	refreshTime := ocspResp.ThisUpdate.Add(6 * time.Hour)
+	this.Assert().Equal(refreshTime, this.handler.ocspRefreshTime(ocspResp))
+
+	// Before the refresh time, the response is kept.
+	this.setTime(refreshTime.Add(-30 * time.Minute))
+	this.Assert().Equal(30*time.Minute, this.handler.nextOCSPCheck(this.fakeClock.Now()))
+	this.Assert().False(this.ocspServerCalled(func() {
+		_, _, err := this.handler.readOCSP(true)
+		this.Require().NoError(err, "reading OCSP")
+	}))
+
+	// After, it is refreshed.
+	this.setTime(refreshTime.Add(time.Second))
+	this.Assert().True(this.ocspServerCalled(func() {
+		_, _, err := this.handler.readOCSP(true)
+		this.Require().NoError(err, "updating OCSP")
+	}))
+
+	// Never later than NextUpdate.
+	this.handler.SetOCSPRefreshStrategy(util.OCSPRefreshFixed, 30*24*time.Hour)
+	this.Assert().Equal(ocspResp.NextUpdate, this.handler.ocspRefreshTime(ocspResp))
+
+	// The midpoint strategy ignores the interval.
+	this.handler.SetOCSPRefreshStrategy(util.OCSPRefreshMidpoint, 6*time.Hour)
+	this.Assert().Equal(ocspResp.ThisUpdate.Add(84*time.Hour), this.handler.ocspRefreshTime(ocspResp))
+}
+
+func (this *CertCacheSuite) TestCertRenewalThreshold() {
+	cert := pkgt.B3Certs[0]
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+
+	// By default, the cert is renewed at 2/3 of its lifetime.
+	renewalTime := this.handler.certRenewalTime(cert)
+	this.Assert().WithinDuration(cert.NotBefore.Add(2*lifetime/3), renewalTime, time.Second)
+
+	// Not before the threshold.
+	this.setTime(renewalTime.Add(-time.Second))
+	this.Assert().False(this.handler.isCertDueForRenewal(cert, this.fakeClock.Now()))
+	this.Assert().False(this.handler.doesCertNeedReloading())
+
+	// But at and after it.
+	this.setTime(renewalTime)
+	this.Assert().True(this.handler.isCertDueForRenewal(cert, this.fakeClock.Now()))
+	this.Assert().True(this.handler.doesCertNeedReloading())
+	this.setTime(renewalTime.Add(time.Hour))
+	this.Assert().True(this.handler.isCertDueForRenewal(cert, this.fakeClock.Now()))
+}
+
+func (this *CertCacheSuite) TestCertRenewalFraction() {
+	cert := pkgt.B3Certs[0]
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+
+	this.handler.SetCertRenewalPolicy(0.5, 0)
+	renewalTime := cert.NotBefore.Add(lifetime / 2)
+	this.Assert().Equal(renewalTime, this.handler.certRenewalTime(cert))
+	this.setTime(renewalTime.Add(-time.Second))
+	this.Assert().False(this.handler.isCertDueForRenewal(cert, this.fakeClock.Now()))
+	this.setTime(renewalTime)
+	this.Assert().True(this.handler.isCertDueForRenewal(cert, this.fakeClock.Now()))
+
+	// Never later than certRenewalInterval before expiry.
+	this.handler.SetCertRenewalPolicy(0.99, 0)
+	this.Assert().Equal(cert.NotAfter.Add(-certRenewalInterval), this.handler.certRenewalTime(cert))
+}
+
+func (this *CertCacheSuite) TestOCSPRefreshIntervalBounds() {
+	ocspResp, err := ocsp.ParseResponse(this.fakeOCSP, pkgt.CACert)
+	this.Require().NoError(err, "parsing fake OCSP response")
+
+	this.handler.SetOCSPRefreshPolicy(0, 0, 24*time.Hour)
+	this.Assert().Equal(ocspResp.ThisUpdate.Add(24*time.Hour), this.handler.ocspRefreshTime(ocspResp))
+
+	this.handler.SetOCSPRefreshPolicy(0.01, 6*time.Hour, 0)
+	this.Assert().Equal(ocspResp.ThisUpdate.Add(6*time.Hour), this.handler.ocspRefreshTime(ocspResp))
+
+	// Never later than NextUpdate.
+	this.handler.SetOCSPRefreshPolicy(0, 30*24*time.Hour, 0)
+	this.Assert().Equal(ocspResp.NextUpdate, this.handler.ocspRefreshTime(ocspResp))
+}
+
+func (this *CertCacheSuite) TestOCSPMinRefreshIntervalOverridesHTTPHeaders() {
+	this.handler.SetOCSPRefreshPolicy(0, time.Hour, 0)
+	this.handler.ocspUpdateAfter = time.Unix(0, 1)
+	this.Assert().False(this.ocspServerCalled(func() {
+		_, _, err := this.handler.readOCSP(true)
+		this.Require().NoError(err, "reading OCSP")
+	}))
+
+	this.fakeClock.Advance(time.Hour)
+	this.Assert().True(this.ocspServerCalled(func() {
+		_, _, err := this.handler.readOCSP(true)
+		this.Require().NoError(err, "updating OCSP")
+	}))
+}
+
+func (this *CertCacheSuite) TestOCSPIgnoreExpiredNextUpdate() {
+	// Prime memory and disk cache with a past-midpoint OCSP:
+	err := os.Remove(filepath.Join(this.tempDir, "ocsp"))
+	this.Require().NoError(err, "deleting OCSP tempfile")
+	staleOCSP, err := FakeOCSPResponse(this.fakeClock.Now().Add(-4*24*time.Hour), this.fakeClock.Now())
+	this.Require().NoError(err, "creating stale OCSP response")
+	this.fakeOCSP = staleOCSP
+	this.Require().True(this.ocspServerCalled(func() {
+		this.handler, err = this.New()
+		this.Require().NoError(err, "reinstantiating CertCache")
+	}))
+
+	// Try to update with an invalid OCSP:
+	this.fakeOCSP, err = FakeOCSPResponse(this.fakeClock.Now().Add(-8*24*time.Hour), this.fakeClock.Now())
+	this.Require().NoError(err, "creating expired OCSP response")
+	this.Assert().True(this.ocspServerCalled(func() {
+		_, _, err := this.handler.readOCSP(true)
+		this.Require().NoError(err, "updating OCSP")
+	}))
+
+	// Verify that the invalid update doesn't squash the valid cache entry.
+	ocsp, _, err := this.handler.readOCSP(true)
+	this.Require().NoError(err, "reading OCSP")
+	this.Assert().Equal(staleOCSP, ocsp)
+}
+
+func (this *CertCacheSuite) TestOCSPIgnoreInvalidProducedAt() {
+	// Prime memory and disk cache with a past-midpoint OCSP:
+	err := os.Remove(filepath.Join(this.tempDir, "ocsp"))
+	this.Require().NoError(err, "deleting OCSP tempfile")
+	staleOCSP, err := FakeOCSPResponse(this.fakeClock.Now().Add(-4*24*time.Hour), this.fakeClock.Now())
+	this.Require().NoError(err, "creating stale OCSP response")
+	this.fakeOCSP = staleOCSP
+	this.Require().True(this.ocspServerCalled(func() {
+		this.handler, err = this.New()
+		this.Require().NoError(err, "reinstantiating CertCache")
+	}))
+
+	// Try to update with an OCSP with an invalid ProducedAt:
+	this.fakeOCSP, err = FakeOCSPResponse(this.fakeClock.Now().Add(-4*24*time.Hour), time.Unix(0, 0))
+	this.Require().NoError(err, "creating invalid OCSP response")
+	this.Assert().True(this.ocspServerCalled(func() {
 		_, _, err := this.handler.readOCSP(true)
 		this.Require().NoError(err, "updating OCSP")
 	}))
@@ -382,6 +1658,87 @@ func (this *CertCacheSuite) TestOCSPIgnoreInvalidProducedAt() {
 	this.Assert().Equal(staleOCSP, ocsp)
 }
 
+func (this *CertCacheSuite) TestOCSPThisUpdateClockSkew() {
+	// Prime memory and disk cache with a past-midpoint OCSP:
+	err := os.Remove(filepath.Join(this.tempDir, "ocsp"))
+	this.Require().NoError(err, "deleting OCSP tempfile")
+	staleOCSP, err := FakeOCSPResponse(this.fakeClock.Now().Add(-4*24*time.Hour), this.fakeClock.Now())
+	this.Require().NoError(err, "creating stale OCSP response")
+	this.fakeOCSP = staleOCSP
+	this.Require().True(this.ocspServerCalled(func() {
+		this.handler, err = this.New()
+		this.Require().NoError(err, "reinstantiating CertCache")
+	}))
+
+	// Try to update with an OCSP whose validity starts in the future:
+	skewedOCSP, err := FakeOCSPResponse(this.fakeClock.Now().Add(time.Hour), this.fakeClock.Now().Add(time.Hour))
+	this.Require().NoError(err, "creating future OCSP response")
+	this.fakeOCSP = skewedOCSP
+
+	// With no tolerance, it is rejected:
+	this.handler.SetOCSPClockSkew(0)
+	this.Assert().True(this.ocspServerCalled(func() {
+		_, _, err := this.handler.readOCSP(true)
+		this.Require().NoError(err, "updating OCSP")
+	}))
+	ocsp, _, err := this.handler.readOCSP(false)
+	this.Require().NoError(err, "reading OCSP")
+	this.Assert().Equal(staleOCSP, ocsp)
+
+	// Within the tolerance, it is accepted:
+	this.handler.SetOCSPClockSkew(2 * time.Hour)
+	this.Assert().True(this.ocspServerCalled(func() {
+		_, _, err := this.handler.readOCSP(true)
+		this.Require().NoError(err, "updating OCSP")
+	}))
+	ocsp, _, err = this.handler.readOCSP(false)
+	this.Require().NoError(err, "reading OCSP")
+	this.Assert().Equal(skewedOCSP, ocsp)
+}
+
+func (this *CertCacheSuite) TestOCSPProducedAtClockSkew() {
+	// Prime memory and disk cache with a past-midpoint OCSP:
+	err := os.Remove(filepath.Join(this.tempDir, "ocsp"))
+	this.Require().NoError(err, "deleting OCSP tempfile")
+	staleOCSP, err := FakeOCSPResponse(this.fakeClock.Now().Add(-4*24*time.Hour), this.fakeClock.Now())
+	this.Require().NoError(err, "creating stale OCSP response")
+	this.fakeOCSP = staleOCSP
+	this.Require().True(this.ocspServerCalled(func() {
+		this.handler, err = this.New()
+		this.Require().NoError(err, "reinstantiating CertCache")
+	}))
+	// Stop the clock, to test the exact boundary.
+	this.fakeClock.SetDelta(0)
+
+	// Try to update with an OCSP produced in the future:
+	skewedOCSP, err := FakeOCSPResponse(this.fakeClock.Now(), this.fakeClock.Now().Add(time.Hour))
+	this.Require().NoError(err, "creating future OCSP response")
+	skewedResp, err := ocsp.ParseResponse(skewedOCSP, nil)
+	this.Require().NoError(err, "parsing future OCSP response")
+	skew := skewedResp.ProducedAt.Sub(this.fakeClock.Now())
+	this.fakeOCSP = skewedOCSP
+
+	// Just beyond the tolerance, it is rejected:
+	this.handler.SetOCSPClockSkew(skew - time.Second)
+	this.Assert().True(this.ocspServerCalled(func() {
+		_, _, err := this.handler.readOCSP(true)
+		this.Require().NoError(err, "updating OCSP")
+	}))
+	ocsp, _, err := this.handler.readOCSP(false)
+	this.Require().NoError(err, "reading OCSP")
+	this.Assert().Equal(staleOCSP, ocsp)
+
+	// At the tolerance, it is accepted:
+	this.handler.SetOCSPClockSkew(skew)
+	this.Assert().True(this.ocspServerCalled(func() {
+		_, _, err := this.handler.readOCSP(true)
+		this.Require().NoError(err, "updating OCSP")
+	}))
+	ocsp, _, err = this.handler.readOCSP(false)
+	this.Require().NoError(err, "reading OCSP")
+	this.Assert().Equal(skewedOCSP, ocsp)
+}
+
 func (this *CertCacheSuite) TestPopulateCertCache() {
 	certCache, err := PopulateCertCache(
 		&util.Config{
@@ -401,12 +1758,352 @@ func (this *CertCacheSuite) TestPopulateCertCache() {
 		pkgt.B3Key,
 		nil,
 		true,
-		false)
+		false,
+		nil)
 	this.Require().NoError(err)
 	this.Assert().NotNil(certCache)
 	this.Assert().Equal(pkgt.B3Certs[0], certCache.GetLatestCert())
 }
 
+func (this *CertCacheSuite) TestPopulateCertCacheWithSCTFile() {
+	sctFile := filepath.Join(this.tempDir, "cert.sct")
+	this.Require().NoError(ioutil.WriteFile(sctFile, fakeSCTList, 0644))
+	config := &util.Config{
+		CertFile:  "../../testdata/b3/fullchain.cert",
+		KeyFile:   "../../testdata/b3/server.privkey",
+		OCSPCache: "/tmp/ocsp",
+		SCTFile:   sctFile,
+		URLSet: []util.URLSet{{
+			Sign: &util.URLPattern{
+				Domain:    "amppackageexample.com",
+				PathRE:    stringPtr(".*"),
+				QueryRE:   stringPtr(""),
+				MaxLength: 2000,
+			},
+		}},
+	}
+	certCache, err := PopulateCertCache(config, pkgt.B3Key, nil, true, false, nil)
+	this.Require().NoError(err)
+	this.Assert().Equal(fakeSCTList, certCache.sctList)
+
+	this.Require().NoError(ioutil.WriteFile(sctFile, []byte("not an SCT list"), 0644))
+	_, err = PopulateCertCache(config, pkgt.B3Key, nil, true, false, nil)
+	this.Assert().Error(err)
+}
+
+func (this *CertCacheSuite) TestOCSPCABundle() {
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		this.ocspHandler(resp, req)
+	}))
+	defer tlsServer.Close()
+	newCertCache := func(bundle []byte) (*CertCache, error) {
+		certCache := New(pkgt.B3Certs, nil, []string{"example.com"}, "cert.crt", "newcert.crt",
+			filepath.Join(this.tempDir, "ocsp-tls"), nil, this.fakeClock.Now)
+		certCache.extractOCSPServer = func(*x509.Certificate) (string, error) {
+			return tlsServer.URL, nil
+		}
+		if bundle != nil {
+			this.Require().NoError(certCache.SetOCSPCABundle(bundle))
+		}
+		return certCache, certCache.Init()
+	}
+
+	// The responder's cert is issued by a CA that isn't a system root.
+	_, err := newCertCache(nil)
+	this.Assert().EqualError(err, "initializing CertCache: Missing OCSP response.")
+
+	bundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw})
+	var certCache *CertCache
+	this.Require().True(this.ocspServerCalled(func() {
+		certCache, err = newCertCache(bundle)
+		this.Require().NoError(err)
+	}))
+	defer certCache.Stop()
+	this.Assert().NoError(certCache.IsHealthy())
+}
+
+func (this *CertCacheSuite) TestPopulateCertCacheWithOCSPCABundle() {
+	bundleFile := filepath.Join(this.tempDir, "ocsp-ca.pem")
+	this.Require().NoError(ioutil.WriteFile(bundleFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: pkgt.CACert.Raw}), 0644))
+	config := &util.Config{
+		CertFile:     "../../testdata/b3/fullchain.cert",
+		KeyFile:      "../../testdata/b3/server.privkey",
+		OCSPCache:    "/tmp/ocsp",
+		OCSPCABundle: bundleFile,
+		URLSet: []util.URLSet{{
+			Sign: &util.URLPattern{
+				Domain:    "amppackageexample.com",
+				PathRE:    stringPtr(".*"),
+				QueryRE:   stringPtr(""),
+				MaxLength: 2000,
+			},
+		}},
+	}
+	certCache, err := PopulateCertCache(config, pkgt.B3Key, nil, true, false, nil)
+	this.Require().NoError(err)
+	this.Assert().NotNil(certCache.client.Transport)
+
+	this.Require().NoError(ioutil.WriteFile(bundleFile, []byte("not a PEM"), 0644))
+	_, err = PopulateCertCache(config, pkgt.B3Key, nil, true, false, nil)
+	this.Assert().Error(err)
+}
+
+func (this *CertCacheSuite) TestSetOCSPCABundleInvalid() {
+	this.Assert().EqualError(this.handler.SetOCSPCABundle([]byte("not a PEM")), "no certificates found in OCSP CA bundle")
+}
+
+// Sets up an OCSP responder that echoes the request's nonce, transformed by
+// echo. If echo returns nil, the response has no nonce. Returns a pointer to
+// the last nonce requested.
+func (this *CertCacheSuite) echoOCSPNonce(echo func(nonce []byte) []byte) *[]byte {
+	var requested []byte
+	this.ocspHandler = func(resp http.ResponseWriter, req *http.Request) {
+		this.ocspServerWasCalled = true
+		nonce, err := ocspRequestNonce(req)
+		this.Require().NoError(err, "parsing OCSP request")
+		requested = nonce
+		ocspResp := this.fakeOCSP
+		if echoed := echo(nonce); echoed != nil {
+			value, err := asn1.Marshal(echoed)
+			this.Require().NoError(err)
+			ocspResp, err = withOCSPResponseExtensions(ocspResp, []pkix.Extension{{Id: ocspNonceOID, Value: value}})
+			this.Require().NoError(err, "adding OCSP nonce")
+		}
+		_, err = resp.Write(ocspResp)
+		this.Require().NoError(err, "writing fake OCSP response")
+	}
+	return &requested
+}
+
+// Returns a new CertCache with the given nonce settings, after replacing the
+// cached OCSP response with one due to be refreshed. Returns the previously
+// cached response.
+func (this *CertCacheSuite) newWithOCSPNonce(required bool) (*CertCache, []byte, error) {
+	this.handler.Stop()
+	cached, err := this.handler.readCachedOCSP()
+	this.Require().NoError(err)
+	// Past the midpoint of the cached response's validity, so that it is
+	// refreshed, but before its expiry.
+	this.fakeClock.Advance(4 * 24 * time.Hour)
+	this.fakeOCSP, err = FakeOCSPResponse(this.fakeClock.Now(), this.fakeClock.Now())
+	this.Require().NoError(err)
+
+	certCache := New(pkgt.B3Certs, nil, []string{"example.com"}, "cert.crt", "newcert.crt",
+		filepath.Join(this.tempDir, "ocsp"), nil, this.fakeClock.Now)
+	certCache.extractOCSPServer = func(*x509.Certificate) (string, error) {
+		return this.ocspServer.URL, nil
+	}
+	certCache.SetOCSPNonce(true, required)
+	err = certCache.Init()
+	return certCache, cached, err
+}
+
+func (this *CertCacheSuite) TestOCSPNonceMatches() {
+	requested := this.echoOCSPNonce(func(nonce []byte) []byte { return nonce })
+	var err error
+	this.Require().True(this.ocspServerCalled(func() {
+		this.handler, _, err = this.newWithOCSPNonce(true)
+		this.Require().NoError(err)
+	}))
+	this.Assert().Len(*requested, ocspNonceLength)
+	ocsp, err := this.handler.readCachedOCSP()
+	this.Require().NoError(err)
+	resp, err := this.handler.parseOCSP(ocsp, this.handler.findIssuer())
+	this.Require().NoError(err)
+	echoed, ok, err := ocspResponseNonce(resp)
+	this.Require().NoError(err)
+	this.Assert().True(ok)
+	this.Assert().Equal(*requested, echoed)
+}
+
+func (this *CertCacheSuite) TestOCSPNonceMismatch() {
+	this.echoOCSPNonce(func(nonce []byte) []byte {
+		return bytes.Repeat([]byte{'x'}, len(nonce))
+	})
+	var cached []byte
+	var err error
+	this.Require().True(this.ocspServerCalled(func() {
+		this.handler, cached, err = this.newWithOCSPNonce(false)
+		this.Require().NoError(err)
+	}))
+	// The mismatched response was rejected in favor of the cached one.
+	ocsp, err := this.handler.readCachedOCSP()
+	this.Require().NoError(err)
+	this.Assert().Equal(cached, ocsp)
+}
+
+func (this *CertCacheSuite) TestOCSPNonceAbsent() {
+	this.echoOCSPNonce(func([]byte) []byte { return nil })
+	var err error
+	this.Require().True(this.ocspServerCalled(func() {
+		this.handler, _, err = this.newWithOCSPNonce(false)
+		this.Require().NoError(err)
+	}))
+	ocsp, err := this.handler.readCachedOCSP()
+	this.Require().NoError(err)
+	this.Assert().Equal(this.fakeOCSP, ocsp)
+}
+
+func (this *CertCacheSuite) TestOCSPNonceAbsentWhenRequired() {
+	this.echoOCSPNonce(func([]byte) []byte { return nil })
+	var cached []byte
+	var err error
+	this.Require().True(this.ocspServerCalled(func() {
+		this.handler, cached, err = this.newWithOCSPNonce(true)
+		this.Require().NoError(err)
+	}))
+	ocsp, err := this.handler.readCachedOCSP()
+	this.Require().NoError(err)
+	this.Assert().Equal(cached, ocsp)
+}
+
+func (this *CertCacheSuite) TestOCSPNonceDisabled() {
+	requested := this.echoOCSPNonce(func([]byte) []byte { return nil })
+	this.handler.Stop()
+	err := os.Remove(filepath.Join(this.tempDir, "ocsp"))
+	this.Require().NoError(err, "deleting OCSP tempfile")
+	this.Require().True(this.ocspServerCalled(func() {
+		this.handler, err = this.New()
+		this.Require().NoError(err)
+	}))
+	this.Assert().Nil(*requested)
+}
+
+func (this *CertCacheSuite) TestOCSPMaxHostFetches() {
+	var inFlight, maxInFlight int32
+	this.ocspHandler = func(resp http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		_, err := resp.Write(this.fakeOCSP)
+		this.Require().NoError(err, "writing fake OCSP response")
+	}
+	// An uninitialized CertCache, so that only the fetches below are in
+	// flight, with a fixed clock, as FakeClock isn't safe for concurrent use.
+	this.handler.Stop()
+	now := this.fakeClock.Now()
+	certCache := New(pkgt.B3Certs, nil, []string{"example.com"}, "cert.crt", "newcert.crt",
+		filepath.Join(this.tempDir, "ocsp"), nil, func() time.Time { return now })
+	certCache.extractOCSPServer = func(*x509.Certificate) (string, error) {
+		return this.ocspServer.URL, nil
+	}
+	certCache.SetOCSPMaxHostFetches(2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var ocspUpdateAfter time.Time
+			this.Assert().Equal(this.fakeOCSP, certCache.fetchOCSP(context.Background(), nil, pkgt.B3Certs, &ocspUpdateAfter, false))
+		}()
+	}
+	wg.Wait()
+	this.Assert().EqualValues(2, atomic.LoadInt32(&maxInFlight))
+}
+
+func (this *CertCacheSuite) TestOCSPMaxHostFetchesStopped() {
+	this.handler.SetOCSPMaxHostFetches(1)
+	release := this.handler.ocspHostSemaphores.acquire(context.Background(), this.ocspServer.Listener.Addr().String(), nil)
+	defer release()
+	this.handler.Stop()
+
+	// With the only slot taken, the fetch gives up once stopped.
+	this.Assert().False(this.ocspServerCalled(func() {
+		var ocspUpdateAfter time.Time
+		this.Assert().Nil(this.handler.fetchOCSP(context.Background(), nil, pkgt.B3Certs, &ocspUpdateAfter, false))
+	}))
+}
+
+func (this *CertCacheSuite) TestStop() {
+	// Stop waits for the background goroutines to exit, abandoning any
+	// in-flight OCSP refresh.
+	this.ocspHandler = func(resp http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+	}
+	fetching := make(chan struct{})
+	exited := false
+	this.handler.goroutines.Add(1)
+	go func() {
+		defer this.handler.goroutines.Done()
+		close(fetching)
+		var ocspUpdateAfter time.Time
+		this.handler.fetchOCSP(this.handler.stopped, nil, pkgt.B3Certs, &ocspUpdateAfter, false)
+		time.Sleep(10 * time.Millisecond)
+		exited = true
+	}()
+	<-fetching
+
+	start := time.Now()
+	this.Assert().True(this.handler.Stop())
+	this.Assert().True(exited)
+	this.Assert().Less(time.Since(start), 5*time.Second)
+
+	// Stopping again is a no-op, even concurrently.
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			this.Assert().False(this.handler.Stop())
+		}()
+	}
+	wg.Wait()
+}
+
+func (this *CertCacheSuite) TestNoGoroutineLeak() {
+	this.handler.Stop()
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		certCache, err := this.New()
+		this.Require().NoError(err, "instantiating CertCache")
+		certCache.Stop()
+	}
+	// Allow unrelated goroutines, e.g. of idle HTTP connections, to wind
+	// down.
+	after := runtime.NumGoroutine()
+	for deadline := time.Now().Add(time.Second); after > before && time.Now().Before(deadline); after = runtime.NumGoroutine() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	this.Assert().LessOrEqual(after, before)
+}
+
+func (this *CertCacheSuite) TestOCSPFetchCancelled() {
+	// The OCSP server hangs until the client gives up.
+	this.ocspHandler = func(resp http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	var ocspUpdateAfter time.Time
+	this.Assert().Equal([]byte("cached"), this.handler.fetchOCSP(ctx, []byte("cached"), pkgt.B3Certs, &ocspUpdateAfter, false))
+	this.Assert().Less(time.Since(start), 5*time.Second)
+}
+
+func TestHostSemaphoresAreIndependent(t *testing.T) {
+	sems := newHostSemaphores(1)
+	releaseA := sems.acquire(context.Background(), "a.example", nil)
+	// Another host has its own slot.
+	releaseB := sems.acquire(context.Background(), "b.example", nil)
+	releaseB()
+	// The first host's slot is taken until released.
+	cancel := make(chan struct{})
+	close(cancel)
+	if sems.acquire(context.Background(), "a.example", cancel) != nil {
+		t.Error("acquired a second slot for a.example")
+	}
+	releaseA()
+	sems.acquire(context.Background(), "a.example", nil)()
+}
+
 func TestCertCacheSuite(t *testing.T) {
 	suite.Run(t, new(CertCacheSuite))
 }
@@ -0,0 +1,56 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certcache
+
+import (
+	"context"
+	"sync"
+)
+
+// Counting semaphores, one per host, bounding the number of concurrent
+// requests to each. The zero limit (and a nil *hostSemaphores) is unbounded.
+type hostSemaphores struct {
+	limit int
+	mu    sync.Mutex
+	sems  map[string]chan struct{}
+}
+
+func newHostSemaphores(limit int) *hostSemaphores {
+	return &hostSemaphores{limit: limit, sems: map[string]chan struct{}{}}
+}
+
+// Blocks until fewer than limit requests to host are in flight, or until
+// cancel is closed or ctx is done. Returns a func that releases the slot, or
+// nil if cancelled.
+func (this *hostSemaphores) acquire(ctx context.Context, host string, cancel <-chan struct{}) func() {
+	if this == nil || this.limit <= 0 {
+		return func() {}
+	}
+	this.mu.Lock()
+	sem, ok := this.sems[host]
+	if !ok {
+		sem = make(chan struct{}, this.limit)
+		this.sems[host] = sem
+	}
+	this.mu.Unlock()
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }
+	case <-cancel:
+		return nil
+	case <-ctx.Done():
+		return nil
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certcache
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Logger receives the diagnostics of a CertCache. Each method is passed a
+// constant message describing the event, followed by alternating keys and
+// values describing its details, e.g.
+//
+//	logger.Warn("OCSP rejected", "reason", "nextUpdate in the past", "nextUpdate", t)
+//
+// so that implementations may route events by severity and message, or emit
+// them as structured (e.g. JSON) logs.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+}
+
+// StdLogger is the default Logger. It writes to the standard log package, one
+// line per event, e.g.
+//
+//	WARN OCSP rejected reason="nextUpdate in the past" nextUpdate=...
+type StdLogger struct{}
+
+func (StdLogger) Debug(msg string, keysAndValues ...interface{}) {
+	stdLog("DEBUG", msg, keysAndValues)
+}
+
+func (StdLogger) Info(msg string, keysAndValues ...interface{}) {
+	stdLog("INFO", msg, keysAndValues)
+}
+
+func (StdLogger) Warn(msg string, keysAndValues ...interface{}) {
+	stdLog("WARN", msg, keysAndValues)
+}
+
+func (StdLogger) Error(msg string, keysAndValues ...interface{}) {
+	stdLog("ERROR", msg, keysAndValues)
+}
+
+func stdLog(level, msg string, keysAndValues []interface{}) {
+	var b strings.Builder
+	b.WriteString(level)
+	b.WriteString(" ")
+	b.WriteString(msg)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		var value interface{} = "(MISSING)"
+		if i+1 < len(keysAndValues) {
+			value = keysAndValues[i+1]
+		}
+		s := fmt.Sprint(value)
+		if strings.ContainsAny(s, " \"=") {
+			s = fmt.Sprintf("%q", s)
+		}
+		fmt.Fprintf(&b, " %v=%s", keysAndValues[i], s)
+	}
+	log.Print(b.String())
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certcache
+
+import (
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
+)
+
+// The OCSP nonce extension, per https://tools.ietf.org/html/rfc8954.
+var ocspNonceOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}
+
+// The recommended length, per https://tools.ietf.org/html/rfc8954#section-2.1.
+const ocspNonceLength = 32
+
+// These reflect the ASN.1 structure of an OCSP request, per
+// https://tools.ietf.org/html/rfc6960#section-4.1.1, insofar as is produced by
+// ocsp.CreateRequest (i.e. unsigned and without requestorName).
+type ocspRequestASN1 struct {
+	TBSRequest ocspTBSRequestASN1
+}
+
+type ocspTBSRequestASN1 struct {
+	Version           int `asn1:"explicit,tag:0,default:0,optional"`
+	RequestList       []asn1.RawValue
+	RequestExtensions []pkix.Extension `asn1:"explicit,tag:2,optional"`
+}
+
+// The fields of the ResponseData of an OCSP response, per
+// https://tools.ietf.org/html/rfc6960#section-4.2.1, up to responseExtensions,
+// which x/crypto/ocsp does not parse.
+type ocspResponseDataASN1 struct {
+	Version            int `asn1:"explicit,tag:0,default:0,optional"`
+	RawResponderID     asn1.RawValue
+	ProducedAt         time.Time `asn1:"generalized"`
+	Responses          []asn1.RawValue
+	ResponseExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+// Adds a random nonce extension to the given DER-encoded OCSP request, as
+// produced by ocsp.CreateRequest. Returns the new request and the nonce.
+func addOCSPNonce(req []byte) ([]byte, []byte, error) {
+	var parsed ocspRequestASN1
+	if rest, err := asn1.Unmarshal(req, &parsed); err != nil {
+		return nil, nil, errors.Wrap(err, "parsing OCSP request")
+	} else if len(rest) > 0 {
+		return nil, nil, errors.New("trailing data after OCSP request")
+	}
+	nonce := make([]byte, ocspNonceLength)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, errors.Wrap(err, "generating OCSP nonce")
+	}
+	value, err := asn1.Marshal(nonce)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "encoding OCSP nonce")
+	}
+	parsed.TBSRequest.RequestExtensions = append(parsed.TBSRequest.RequestExtensions, pkix.Extension{Id: ocspNonceOID, Value: value})
+	req, err = asn1.Marshal(parsed)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "encoding OCSP request")
+	}
+	return req, nonce, nil
+}
+
+// Returns the nonce echoed in the (signed) responseExtensions of resp, or false
+// if there is none.
+func ocspResponseNonce(resp *ocsp.Response) ([]byte, bool, error) {
+	var data ocspResponseDataASN1
+	if _, err := asn1.Unmarshal(resp.TBSResponseData, &data); err != nil {
+		return nil, false, errors.Wrap(err, "parsing OCSP response data")
+	}
+	for _, ext := range data.ResponseExtensions {
+		if !ext.Id.Equal(ocspNonceOID) {
+			continue
+		}
+		// RFC 8954 specifies that the extension's value is an OCTET
+		// STRING containing the nonce, but some responders, following
+		// RFC 2560, omit that inner encoding.
+		var nonce []byte
+		if rest, err := asn1.Unmarshal(ext.Value, &nonce); err == nil && len(rest) == 0 {
+			return nonce, true, nil
+		}
+		return ext.Value, true, nil
+	}
+	return nil, false, nil
+}
@@ -1,12 +1,15 @@
 package certcache
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"io/ioutil"
-	"log"
 	"os"
-	"runtime"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/gofrs/flock"
 	"github.com/pkg/errors"
@@ -24,6 +27,7 @@ type Updateable interface {
 }
 
 // Uses the OS's file locking mechanisms to obtain shared/exclusive locks to
+// ensure the file is never read while partially written, and a lease file to
 // ensure update() is only called once. This is probably good enough for a few
 // processes running on one server.
 //
@@ -41,8 +45,19 @@ type Updateable interface {
 // Updateable using some reasonable remote storage / leader election libraries.
 type LocalFile struct {
 	path string
+	// How long a replica may hold the update lease before others consider it
+	// abandoned. Defaults to defaultLeaseTimeout.
+	leaseTimeout time.Duration
+	logger       Logger
 }
 
+// The default lease timeout. This should comfortably exceed the time taken by
+// update(), e.g. the 60 second timeout of the OCSP HTTP client.
+const defaultLeaseTimeout = 2 * time.Minute
+
+// How often a replica waiting on another's lease checks whether it's done.
+const leasePollInterval = 100 * time.Millisecond
+
 // Check whether a file or directory exists.
 func exists(path string) (bool, error) {
 	_, err := os.Stat(path)
@@ -60,6 +75,79 @@ func (this *LocalFile) Read(ctx context.Context, isExpired func([]byte) bool, up
 	// access the file because another process has locked a portion of the file."
 	lockPath := this.path + ".lock"
 	lock := flock.New(lockPath)
+	contents, err := this.readShared(lock, lockPath)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, errors.Wrapf(ctx.Err(), "while reading %s", this.path)
+	default:
+	}
+	if !isExpired(contents) {
+		return contents, nil
+	}
+
+	// Only the replica holding the lease calls update(). The rest wait for
+	// it to finish and then re-read whatever it wrote.
+	token, leased, err := this.acquireLease()
+	if err != nil {
+		return nil, err
+	}
+	if !leased {
+		if err := this.waitForLease(ctx); err != nil {
+			return nil, err
+		}
+		return this.readShared(lock, lockPath)
+	}
+	defer this.releaseLease(token)
+
+	// At first glance, this looks like "broken" double-checked locking, as in
+	// http://www.cs.umd.edu/~pugh/java/memoryModel/DoubleCheckedLocking.html.
+	// However, the difference is that a read lock is established first, so
+	// that this shouldn't be looking at a partially-written file. Reread the
+	// file while holding the lease, in case another replica finished its
+	// update between our first read and our acquiring the lease.
+	contents, err = this.readShared(lock, lockPath)
+	if err != nil {
+		return nil, err
+	}
+	if !isExpired(contents) {
+		return contents, nil
+	}
+
+	// The file lock is not held during update(), so that other replicas can
+	// continue to read the old contents in the meantime.
+	contents = update(contents)
+
+	// If the file can't be written, the updated contents are still returned,
+	// rather than discarding the result of the expensive update(). Other
+	// replicas will update the file in turn.
+	locked, err := lock.TryLock()
+	if err != nil {
+		this.logger.Error("Not writing updated file; error obtaining exclusive lock", "path", lockPath, "err", err)
+		return contents, nil
+	}
+	if !locked {
+		this.logger.Error("Not writing updated file; unable to obtain exclusive lock", "path", lockPath)
+		return contents, nil
+	}
+	defer func() {
+		if err = lock.Unlock(); err != nil {
+			this.logger.Error("Error unlocking", "path", lockPath, "err", err)
+		}
+	}()
+	// TODO(twifkak): Should I write to a tempfile in the same dir and move into place, instead?
+	if err = ioutil.WriteFile(this.path, contents, 0600); err != nil {
+		return nil, errors.Wrapf(err, "writing %s", this.path)
+	}
+	return contents, nil
+}
+
+// Reads the contents of the file under a shared lock. Returns empty contents
+// if the file does not exist.
+func (this *LocalFile) readShared(lock *flock.Flock, lockPath string) ([]byte, error) {
 	locked, err := lock.TryRLock()
 	if err != nil {
 		return nil, errors.Wrapf(err, "obtaining shared lock for %s", lockPath)
@@ -69,7 +157,7 @@ func (this *LocalFile) Read(ctx context.Context, isExpired func([]byte) bool, up
 	}
 	defer func() {
 		if err = lock.Unlock(); err != nil {
-			log.Printf("Error unlocking %s; %+v", lockPath, err)
+			this.logger.Error("Error unlocking", "path", lockPath, "err", err)
 		}
 	}()
 
@@ -79,66 +167,108 @@ func (this *LocalFile) Read(ctx context.Context, isExpired func([]byte) bool, up
 		return nil, errors.Wrapf(err, "checking file exists %s", this.path)
 	}
 
-	// Initialize empty contents.
-	var contents []byte
+	// If cache file exists, read it. Note that zero-length contents are
+	// considered "expired" by isExpired(). If an attempt is made to read the
+	// file before it exists on Windows, error "The system cannot find the
+	// file specified." is thrown.
+	if !pathExists {
+		return nil, nil
+	}
+	contents, err := ioutil.ReadFile(this.path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", this.path)
+	}
+	return contents, nil
+}
 
-	// If cache file exists, read it and check freshness. Note that zero-length
-	// contents are considered "expired" by isExpired(). If an attempt is made
-	// to read the file before it exists on Windows, error "The system cannot
-	// find the file specified." is thrown.
-	if pathExists {
-		contents, err = ioutil.ReadFile(this.path)
-		if err != nil {
-			return nil, errors.Wrapf(err, "reading %s", this.path)
-		}
+func (this *LocalFile) leasePath() string {
+	return this.path + ".lease"
+}
+
+func (this *LocalFile) getLeaseTimeout() time.Duration {
+	if this.leaseTimeout <= 0 {
+		return defaultLeaseTimeout
 	}
+	return this.leaseTimeout
+}
 
-	// At first glance, this looks like "broken" double-checked locking, as in
-	// http://www.cs.umd.edu/~pugh/java/memoryModel/DoubleCheckedLocking.html.
-	// However, the difference is that a read lock is established first, so
-	// that this shouldn't be looking at a partially-written file.
-	select {
-	case <-ctx.Done():
-		return nil, errors.Wrapf(ctx.Err(), "while reading %s", this.path)
-	default:
-		if !isExpired(contents) {
-			return contents, nil
-		}
-		// Upgrade to a write-lock. It seems this may or may not be atomic, depending on the system.
-		// Windows does not handle a lock "upgrade", hence unlock before lock.
-		if runtime.GOOS == "windows" {
-			if err = lock.Unlock(); err != nil {
-				return nil, errors.Wrapf(err, "Error unlocking %s", lockPath)
+// Returns true if another replica holds an unexpired lease. A lease expires
+// getLeaseTimeout() after its file was created, in case its holder died
+// without releasing it.
+func (this *LocalFile) leaseHeld() bool {
+	stat, err := os.Stat(this.leasePath())
+	if err != nil {
+		return false
+	}
+	return time.Since(stat.ModTime()) < this.getLeaseTimeout()
+}
+
+// Attempts to take the update lease, via exclusive creation of the lease
+// file. Returns false if another replica holds it. Otherwise, returns the
+// random token written to the lease file, identifying this holder to
+// releaseLease.
+func (this *LocalFile) acquireLease() (string, bool, error) {
+	leasePath := this.leasePath()
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", false, errors.Wrap(err, "generating lease token")
+	}
+	token := hex.EncodeToString(random)
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(leasePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			_, err = f.WriteString(token)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
 			}
+			if err != nil {
+				return "", false, errors.Wrapf(err, "writing %s", leasePath)
+			}
+			return token, true, nil
 		}
-		locked, err = lock.TryLock()
-		if err != nil {
-			return nil, errors.Wrapf(err, "obtaining exclusive lock for %s", lockPath)
+		if !os.IsExist(err) {
+			return "", false, errors.Wrapf(err, "creating %s", leasePath)
 		}
-		if !locked {
-			return nil, errors.Errorf("unable to obtain exclusive lock for %s", lockPath)
+		if this.leaseHeld() {
+			return "", false, nil
 		}
-
-		// Reread the file while in write-lock, to make the
-		// read-modify-write atomic, and thus reduce the chance of
-		// multiple calls to update() in parallel.
-		if pathExists {
-			contents, err := ioutil.ReadFile(this.path)
-			if err != nil {
-				return nil, errors.Wrapf(err, "rereading %s", this.path)
-			}
-			if !isExpired(contents) {
-				return contents, nil
-			}
+		// The lease was abandoned; break it and try again.
+		if err = os.Remove(leasePath); err != nil && !os.IsNotExist(err) {
+			return "", false, errors.Wrapf(err, "removing expired %s", leasePath)
 		}
+	}
+	return "", false, nil
+}
+
+// Releases the lease taken by acquireLease, unless it has since expired and
+// been taken by another replica, whose lease file contains a different token.
+func (this *LocalFile) releaseLease(token string) {
+	owner, err := ioutil.ReadFile(this.leasePath())
+	if err != nil {
+		this.logger.Error("Error releasing", "path", this.leasePath(), "err", err)
+		return
+	}
+	if string(owner) != token {
+		this.logger.Warn("Not releasing lease taken over by another replica", "path", this.leasePath())
+		return
+	}
+	if err := os.Remove(this.leasePath()); err != nil {
+		this.logger.Error("Error releasing", "path", this.leasePath(), "err", err)
+	}
+}
 
-		contents = update(contents)
-		// TODO(twifkak): Should I write to a tempfile in the same dir and move into place, instead?
-		if err = ioutil.WriteFile(this.path, contents, 0600); err != nil {
-			return nil, errors.Wrapf(err, "writing %s", this.path)
+// Waits until the lease is released or expires.
+func (this *LocalFile) waitForLease(ctx context.Context) error {
+	this.logger.Debug("Waiting for another replica to update", "path", this.path)
+	deadline := time.Now().Add(this.getLeaseTimeout())
+	for this.leaseHeld() && time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "while waiting for %s", this.leasePath())
+		case <-time.After(leasePollInterval):
 		}
-		return contents, nil
 	}
+	return nil
 }
 
 // Represents an in-memory copy of a file.
@@ -173,15 +303,54 @@ func (this *InMemory) Read(ctx context.Context, isExpired func([]byte) bool, upd
 // the contents of both updateables updated).
 type Chained struct {
 	first, second Updateable
+	logger        Logger
 }
 
 func (this *Chained) Read(ctx context.Context, isExpired func([]byte) bool, update func([]byte) []byte) ([]byte, error) {
 	return this.first.Read(ctx, isExpired, func([]byte) []byte {
 		contents, err := this.second.Read(ctx, isExpired, update)
 		if err != nil {
-			log.Printf("%+v", err)
+			this.logger.Error("Error reading", "err", err)
 			return nil
 		}
 		return contents
 	})
 }
+
+// Represents a file prefixed with a marker line identifying the version of its
+// format, "<name>/<version>\n". Contents without the marker (e.g. written by an
+// older amppkg) or with another version's are read as empty, so that they are
+// considered expired and updated, rather than misinterpreted. The marker is
+// hidden from callers.
+type Versioned struct {
+	inner  Updateable
+	marker []byte
+	logger Logger
+}
+
+func newVersioned(inner Updateable, name string, version int, logger Logger) *Versioned {
+	return &Versioned{inner: inner, marker: []byte(name + "/" + strconv.Itoa(version) + "\n"), logger: logger}
+}
+
+// Returns the contents without the marker, or nil if they lack it.
+func (this *Versioned) strip(contents []byte) []byte {
+	if !bytes.HasPrefix(contents, this.marker) {
+		return nil
+	}
+	return contents[len(this.marker):]
+}
+
+func (this *Versioned) Read(ctx context.Context, isExpired func([]byte) bool, update func([]byte) []byte) ([]byte, error) {
+	contents, err := this.inner.Read(ctx, func(contents []byte) bool {
+		if len(contents) > 0 && !bytes.HasPrefix(contents, this.marker) {
+			this.logger.Info("Discarding cached file of incompatible format", "want", string(bytes.TrimSpace(this.marker)))
+		}
+		return isExpired(this.strip(contents))
+	}, func(contents []byte) []byte {
+		return append(append([]byte{}, this.marker...), update(this.strip(contents))...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return this.strip(contents), nil
+}
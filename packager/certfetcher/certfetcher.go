@@ -30,11 +30,25 @@ import (
 	"github.com/pkg/errors"
 )
 
+// ACMEClient requests certificates from an ACME CA. New implements it with
+// lego; NewWithClient accepts any other, e.g. a fake for testing.
+type ACMEClient interface {
+	// Obtain requests a new cert chain for csr.
+	Obtain(csr *x509.CertificateRequest) ([]*x509.Certificate, error)
+	// Renew requests a cert chain for csr to replace certs, which are
+	// expired or due for renewal.
+	Renew(csr *x509.CertificateRequest, certs []*x509.Certificate) ([]*x509.Certificate, error)
+}
+
 type CertFetcher struct {
 	AcmeDiscoveryURL string
 	AcmeUser         AcmeUser
+	acmeClient       ACMEClient
 	legoClient       *lego.Client
+	legoConfig       *lego.Config
 	CertSignRequest  *x509.CertificateRequest
+	// If non-nil, solves HTTP-01 challenges; to be routed from amppkg's server.
+	HTTPChallengeHandler *HTTPChallengeHandler
 }
 
 // Implements registration.User
@@ -62,8 +76,9 @@ func (u *AcmeUser) GetPrivateKey() crypto.PrivateKey {
 // fetcher.setUser(email, privateKey)
 // fetcher.bindToPort(port)
 func New(email string, eabKid string, eabHmac string, certSignRequest *x509.CertificateRequest,
-	privateKey crypto.PrivateKey, acmeDiscoURL string, httpChallengePort int, httpChallengeWebRoot string,
-	tlsChallengePort int, dnsProvider string, shouldRegister bool) (*CertFetcher, error) {
+	privateKey crypto.PrivateKey, acmeDiscoURL string, keyType certcrypto.KeyType, httpChallengePort int,
+	httpChallengeWebRoot string, httpChallengeMux bool, tlsChallengePort int, dnsProvider string,
+	shouldRegister bool) (*CertFetcher, error) {
 
 	acmeUser := AcmeUser{
 		Email: email,
@@ -72,9 +87,14 @@ func New(email string, eabKid string, eabHmac string, certSignRequest *x509.Cert
 	config := lego.NewConfig(&acmeUser)
 
 	config.CADirURL = acmeDiscoURL
-	config.Certificate.KeyType = certcrypto.EC256
+	config.Certificate.KeyType = keyType
+
+	var httpChallengeHandler *HTTPChallengeHandler
+	if httpChallengeMux {
+		httpChallengeHandler = NewHTTPChallengeHandler()
+	}
 
-	client, err := NewLegoClient(config, httpChallengePort, httpChallengeWebRoot, tlsChallengePort, dnsProvider)
+	client, err := NewLegoClient(config, httpChallengePort, httpChallengeWebRoot, httpChallengeHandler, tlsChallengePort, dnsProvider)
 	if err != nil {
 		return nil, errors.Wrap(err, "Setting up ACME challenges.")
 	}
@@ -87,7 +107,7 @@ func New(email string, eabKid string, eabHmac string, certSignRequest *x509.Cert
 		acmeUser.Registration = reg
 	} else {
 		// We need to reset the LEGO client after calling Registration.ResolveAccountByKey().
-		client, err = NewLegoClient(config, httpChallengePort, httpChallengeWebRoot, tlsChallengePort, dnsProvider)
+		client, err = NewLegoClient(config, httpChallengePort, httpChallengeWebRoot, httpChallengeHandler, tlsChallengePort, dnsProvider)
 		if err != nil {
 			return nil, errors.Wrap(err, "Setting up ACME challenges.")
 		}
@@ -115,14 +135,30 @@ func New(email string, eabKid string, eabHmac string, certSignRequest *x509.Cert
 	return &CertFetcher{
 		AcmeDiscoveryURL: acmeDiscoURL,
 		AcmeUser:         acmeUser,
+		acmeClient:       &legoACMEClient{client},
 		legoClient:       client,
+		legoConfig:       config,
 		CertSignRequest:  certSignRequest,
+
+		HTTPChallengeHandler: httpChallengeHandler,
 	}, nil
 }
 
+// NewWithClient returns a cert fetcher that requests certificates for
+// certSignRequest from acmeClient. If httpChallengeHandler is non-nil, it is
+// to be routed from amppkg's server, as by New.
+func NewWithClient(acmeClient ACMEClient, certSignRequest *x509.CertificateRequest, httpChallengeHandler *HTTPChallengeHandler) *CertFetcher {
+	return &CertFetcher{
+		acmeClient:      acmeClient,
+		CertSignRequest: certSignRequest,
+
+		HTTPChallengeHandler: httpChallengeHandler,
+	}
+}
+
 // NewLegoClient returns a new Lego ACME Client given the configuration parameters passed in.
 func NewLegoClient(config *lego.Config, httpChallengePort int,
-	httpChallengeWebRoot string, tlsChallengePort int,
+	httpChallengeWebRoot string, httpChallengeHandler *HTTPChallengeHandler, tlsChallengePort int,
 	dnsProvider string) (*lego.Client, error) {
 	// A client facilitates communication with the CA server.
 	client, err := lego.NewClient(config)
@@ -151,6 +187,12 @@ func NewLegoClient(config *lego.Config, httpChallengePort int,
 			return nil, errors.Wrap(err, "Setting up HTTP01 challenge provider.")
 		}
 	}
+	if httpChallengeHandler != nil {
+		err := client.Challenge.SetHTTP01Provider(httpChallengeHandler)
+		if err != nil {
+			return nil, errors.Wrap(err, "Setting up HTTP01 challenge provider.")
+		}
+	}
 
 	if tlsChallengePort != 0 {
 		err := client.Challenge.SetTLSALPN01Provider(tlsalpn01.NewProviderServer("", strconv.Itoa(tlsChallengePort)))
@@ -173,14 +215,30 @@ func NewLegoClient(config *lego.Config, httpChallengePort int,
 	return client, nil
 }
 
+// FetchNewCert requests a new cert chain from the CA.
 func (f *CertFetcher) FetchNewCert() ([]*x509.Certificate, error) {
+	return f.acmeClient.Obtain(f.CertSignRequest)
+}
+
+// RenewCert requests a cert chain from the CA to replace certs, which are
+// expired or due for renewal.
+func (f *CertFetcher) RenewCert(certs []*x509.Certificate) ([]*x509.Certificate, error) {
+	return f.acmeClient.Renew(f.CertSignRequest, certs)
+}
+
+// Implements ACMEClient with lego.
+type legoACMEClient struct {
+	client *lego.Client
+}
+
+func (c *legoACMEClient) Obtain(certSignRequest *x509.CertificateRequest) ([]*x509.Certificate, error) {
 	csr := certificate.ObtainForCSRRequest{
-		CSR:    f.CertSignRequest,
+		CSR:    certSignRequest,
 		Bundle: true,
 	}
 	// Each resource comes back with the cert bytes, the bytes of the client's
 	// private key, and a certificate URL.
-	resource, err := f.legoClient.Certificate.ObtainForCSR(csr)
+	resource, err := c.client.Certificate.ObtainForCSR(csr)
 	if err != nil {
 		return nil, err
 	}
@@ -200,3 +258,9 @@ func (f *CertFetcher) FetchNewCert() ([]*x509.Certificate, error) {
 
 	return cert, err
 }
+
+// ACME has no renewal as such; a cert is renewed by ordering a new one, for the
+// same CSR.
+func (c *legoACMEClient) Renew(certSignRequest *x509.CertificateRequest, certs []*x509.Certificate) ([]*x509.Certificate, error) {
+	return c.Obtain(certSignRequest)
+}
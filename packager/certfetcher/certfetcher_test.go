@@ -8,9 +8,11 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/go-acme/lego/v4/acme"
+	"github.com/go-acme/lego/v4/certcrypto"
 	"github.com/go-acme/lego/v4/platform/tester"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -90,13 +92,104 @@ func TestNewFetcher(t *testing.T) {
 	}
 
 	fetcher, err := New("test@test.com", "eab.kid", "eab.hmac", &csr,
-		privateKey, apiURL+"/dir", 5002, "", 0, "", false)
+		privateKey, apiURL+"/dir", certcrypto.EC256, 5002, "", false, 0, "", false)
 	assert.Nil(t, err)
 	assert.NotNil(t, fetcher.legoClient)
 	assert.Equal(t, "test@test.com", fetcher.AcmeUser.Email)
 	assert.Equal(t, privateKey, fetcher.AcmeUser.key)
 }
 
+func TestNewFetcherKeyType(t *testing.T) {
+	_, apiURL, tearDown := tester.SetupFakeAPI()
+	defer tearDown()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err, "Could not generate test key")
+
+	csr := x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName:   "test.example.com",
+			Organization: []string{"Acme Co"},
+		},
+		DNSNames: []string{"test.example.com"},
+	}
+
+	fetcher, err := New("test@test.com", "", "", &csr,
+		privateKey, apiURL+"/dir", certcrypto.RSA4096, 5002, "", false, 0, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, apiURL+"/dir", fetcher.AcmeDiscoveryURL)
+	assert.Equal(t, apiURL+"/dir", fetcher.legoConfig.CADirURL)
+	assert.Equal(t, certcrypto.RSA4096, fetcher.legoConfig.Certificate.KeyType)
+}
+
+func TestNewFetcherRegistersWithEAB(t *testing.T) {
+	// Unlike tester.SetupFakeAPI, serves the directory more than once, as
+	// New fetches it again after failing to resolve an existing account.
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	apiURL := server.URL
+	mux.HandleFunc("/dir", func(w http.ResponseWriter, _ *http.Request) {
+		_ = tester.WriteJSONResponse(w, acme.Directory{
+			NewNonceURL:   apiURL + "/nonce",
+			NewAccountURL: apiURL + "/account",
+			NewOrderURL:   apiURL + "/newOrder",
+		})
+	})
+	mux.HandleFunc("/nonce", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Replay-Nonce", "12345")
+	})
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err, "Could not generate test key")
+
+	var eab json.RawMessage
+	mux.HandleFunc("/account", func(w http.ResponseWriter, r *http.Request) {
+		body, err := readSignedBody(r, privateKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		account := acme.Account{}
+		if err := json.Unmarshal(body, &account); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if account.OnlyReturnExisting {
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(acme.ProblemDetails{
+				Type:   "urn:ietf:params:acme:error:accountDoesNotExist",
+				Detail: "no account for key",
+			})
+			return
+		}
+		eab = account.ExternalAccountBinding
+		w.Header().Set("Location", apiURL+"/account/1")
+		w.WriteHeader(http.StatusCreated)
+		_ = tester.WriteJSONResponse(w, acme.Account{Status: acme.StatusValid})
+	})
+
+	csr := x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName:   "test.example.com",
+			Organization: []string{"Acme Co"},
+		},
+		DNSNames: []string{"test.example.com"},
+	}
+
+	fetcher, err := New("test@test.com", "eab.kid", "ZWFiLmhtYWM", &csr,
+		privateKey, apiURL+"/dir", certcrypto.EC256, 5002, "", false, 0, "", true)
+	require.NoError(t, err)
+	assert.Equal(t, apiURL+"/account/1", fetcher.AcmeUser.Registration.URI)
+
+	// The account was registered with a JWS binding it to the EAB key id.
+	require.NotNil(t, eab, "registration did not include externalAccountBinding")
+	binding, err := jose.ParseSigned(string(eab))
+	require.NoError(t, err)
+	assert.Equal(t, "eab.kid", binding.Signatures[0].Header.KeyID)
+}
+
 func TestFetchCertSuccess(t *testing.T) {
 	mux, apiURL, tearDown := tester.SetupFakeAPI()
 	defer tearDown()
@@ -121,7 +214,7 @@ func TestFetchCertSuccess(t *testing.T) {
 	}
 
 	fetcher, err := New("test@test.com", "eab.kid", "eab.hmac", &csr,
-		privateKey, apiURL+"/dir", 5002, "", 0, "", false)
+		privateKey, apiURL+"/dir", certcrypto.EC256, 5002, "", false, 0, "", false)
 	assert.Nil(t, err)
 	assert.NotNil(t, fetcher)
 
@@ -152,7 +245,7 @@ func TestFetchCertFail(t *testing.T) {
 	}
 
 	fetcher, err := New("test@test.com", "eab.kid", "eab.hmac", &csr,
-		privateKey, apiURL+"/dir", 5002, "", 0, "", false)
+		privateKey, apiURL+"/dir", certcrypto.EC256, 5002, "", false, 0, "", false)
 	assert.Nil(t, err)
 	assert.NotNil(t, fetcher)
 
@@ -1,12 +1,76 @@
-// +build dns01
-
 package certfetcher
 
 import (
+	"sort"
+	"strings"
+
 	"github.com/go-acme/lego/v4/challenge"
-	"github.com/go-acme/lego/v4/providers/dns"
+	"github.com/pkg/errors"
 )
 
+// DNS-01 providers are compiled in selectively, since each one brings in the
+// provider's SDK. The common ones (see dns_*.go) are compiled in by default,
+// unless built with `-tags nodefaultdns`. Others are compiled in by building
+// with a tag named after the provider (e.g. `-tags linode,ovh`), or all of
+// lego's providers, by building with `-tags dns01`.
+
+// dnsProviders are the providers compiled in individually, by name.
+var dnsProviders = map[string]func() (challenge.Provider, error){}
+
+// optionalDNSProviders are the providers that can be compiled in individually
+// with a build tag of the same name.
+var optionalDNSProviders = map[string]bool{
+	"azure":        true,
+	"cloudflare":   true,
+	"digitalocean": true,
+	"exec":         true,
+	"gandiv5":      true,
+	"gcloud":       true,
+	"godaddy":      true,
+	"hetzner":      true,
+	"httpreq":      true,
+	"linode":       true,
+	"namecheap":    true,
+	"ovh":          true,
+	"rfc2136":      true,
+	"route53":      true,
+}
+
+// If non-nil, returns any of lego's providers by name. Set when built with
+// `-tags dns01`.
+var allDNSProviders func(name string) (challenge.Provider, error)
+
+// registerDNSProvider compiles in the named provider. Called from the init()
+// of its build-tagged file.
+func registerDNSProvider(name string, newProvider func() (challenge.Provider, error)) {
+	dnsProviders[name] = newProvider
+}
+
+// Returns the compiled-in DNS-01 provider with the given lego name, configured
+// from the environment, or an error naming the build tag needed to compile it
+// in.
 func DNSProvider(name string) (challenge.Provider, error) {
-	return dns.NewDNSChallengeProviderByName(name)
+	if newProvider, ok := dnsProviders[name]; ok {
+		return newProvider()
+	}
+	if allDNSProviders != nil {
+		return allDNSProviders(name)
+	}
+	if optionalDNSProviders[name] {
+		return nil, errors.Errorf("DNS provider %q is not compiled into amppkg; please rebuild with `-tags %s` (or `-tags dns01` for all providers)", name, name)
+	}
+	return nil, errors.Errorf("DNS provider %q is not compiled into amppkg (it was built with %s); please rebuild with `-tags dns01` for all providers", name, compiledDNSProviders())
+}
+
+// compiledDNSProviders describes the providers compiled in individually.
+func compiledDNSProviders() string {
+	if len(dnsProviders) == 0 {
+		return "none"
+	}
+	names := make([]string, 0, len(dnsProviders))
+	for name := range dnsProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
 }
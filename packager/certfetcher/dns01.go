@@ -0,0 +1,11 @@
+// +build dns01
+
+package certfetcher
+
+import (
+	"github.com/go-acme/lego/v4/providers/dns"
+)
+
+func init() {
+	allDNSProviders = dns.NewDNSChallengeProviderByName
+}
@@ -0,0 +1,12 @@
+// +build azure
+
+package certfetcher
+
+import (
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/providers/dns/azure"
+)
+
+func init() {
+	registerDNSProvider("azure", func() (challenge.Provider, error) { return azure.NewDNSProvider() })
+}
@@ -0,0 +1,12 @@
+// +build !nodefaultdns cloudflare
+
+package certfetcher
+
+import (
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/providers/dns/cloudflare"
+)
+
+func init() {
+	registerDNSProvider("cloudflare", func() (challenge.Provider, error) { return cloudflare.NewDNSProvider() })
+}
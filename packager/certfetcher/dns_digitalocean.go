@@ -0,0 +1,12 @@
+// +build !nodefaultdns digitalocean
+
+package certfetcher
+
+import (
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/providers/dns/digitalocean"
+)
+
+func init() {
+	registerDNSProvider("digitalocean", func() (challenge.Provider, error) { return digitalocean.NewDNSProvider() })
+}
@@ -0,0 +1,12 @@
+// +build exec
+
+package certfetcher
+
+import (
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/providers/dns/exec"
+)
+
+func init() {
+	registerDNSProvider("exec", func() (challenge.Provider, error) { return exec.NewDNSProvider() })
+}
@@ -0,0 +1,12 @@
+// +build gandiv5
+
+package certfetcher
+
+import (
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/providers/dns/gandiv5"
+)
+
+func init() {
+	registerDNSProvider("gandiv5", func() (challenge.Provider, error) { return gandiv5.NewDNSProvider() })
+}
@@ -0,0 +1,12 @@
+// +build !nodefaultdns gcloud
+
+package certfetcher
+
+import (
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/providers/dns/gcloud"
+)
+
+func init() {
+	registerDNSProvider("gcloud", func() (challenge.Provider, error) { return gcloud.NewDNSProvider() })
+}
@@ -0,0 +1,12 @@
+// +build godaddy
+
+package certfetcher
+
+import (
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/providers/dns/godaddy"
+)
+
+func init() {
+	registerDNSProvider("godaddy", func() (challenge.Provider, error) { return godaddy.NewDNSProvider() })
+}
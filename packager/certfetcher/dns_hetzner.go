@@ -0,0 +1,12 @@
+// +build hetzner
+
+package certfetcher
+
+import (
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/providers/dns/hetzner"
+)
+
+func init() {
+	registerDNSProvider("hetzner", func() (challenge.Provider, error) { return hetzner.NewDNSProvider() })
+}
@@ -0,0 +1,12 @@
+// +build httpreq
+
+package certfetcher
+
+import (
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/providers/dns/httpreq"
+)
+
+func init() {
+	registerDNSProvider("httpreq", func() (challenge.Provider, error) { return httpreq.NewDNSProvider() })
+}
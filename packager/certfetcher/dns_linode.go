@@ -0,0 +1,12 @@
+// +build linode
+
+package certfetcher
+
+import (
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/providers/dns/linode"
+)
+
+func init() {
+	registerDNSProvider("linode", func() (challenge.Provider, error) { return linode.NewDNSProvider() })
+}
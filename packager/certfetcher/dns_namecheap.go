@@ -0,0 +1,12 @@
+// +build namecheap
+
+package certfetcher
+
+import (
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/providers/dns/namecheap"
+)
+
+func init() {
+	registerDNSProvider("namecheap", func() (challenge.Provider, error) { return namecheap.NewDNSProvider() })
+}
@@ -0,0 +1,12 @@
+// +build ovh
+
+package certfetcher
+
+import (
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/providers/dns/ovh"
+)
+
+func init() {
+	registerDNSProvider("ovh", func() (challenge.Provider, error) { return ovh.NewDNSProvider() })
+}
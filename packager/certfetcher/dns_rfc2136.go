@@ -0,0 +1,12 @@
+// +build rfc2136
+
+package certfetcher
+
+import (
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/providers/dns/rfc2136"
+)
+
+func init() {
+	registerDNSProvider("rfc2136", func() (challenge.Provider, error) { return rfc2136.NewDNSProvider() })
+}
@@ -0,0 +1,38 @@
+// +build !dns01,!nodefaultdns,!azure,!exec,!gandiv5,!godaddy,!hetzner,!httpreq,!linode,!namecheap,!ovh,!rfc2136
+
+package certfetcher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultDNSProviders(t *testing.T) {
+	// Only check that they are compiled in; constructing them requires
+	// provider credentials in the environment.
+	for _, name := range []string{"cloudflare", "digitalocean", "gcloud", "route53"} {
+		t.Run(name, func(t *testing.T) {
+			assert.Contains(t, dnsProviders, name)
+		})
+	}
+}
+
+func TestDNSProviderNotCompiledIn(t *testing.T) {
+	tests := []struct {
+		name, errContains string
+	}{
+		{"linode", "rebuild with `-tags linode`"},
+		{"rfc2136", "rebuild with `-tags rfc2136`"},
+		{"nosuchprovider", "built with cloudflare, digitalocean, gcloud, route53"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := DNSProvider(test.name)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), `DNS provider "`+test.name+`" is not compiled into amppkg`)
+			assert.Contains(t, err.Error(), test.errContains)
+		})
+	}
+}
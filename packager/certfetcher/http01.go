@@ -0,0 +1,68 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certfetcher
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/ampproject/amppackager/packager/mux"
+)
+
+// HTTPChallengeHandler solves ACME HTTP-01 challenges by serving them from
+// amppkg's own HTTP server, under util.ACMEChallengePrefix, rather than from a
+// separate port (HttpChallengePort) or directory (HttpWebRootDir). It
+// implements challenge.Provider, for lego, and http.Handler, for the mux.
+type HTTPChallengeHandler struct {
+	mu       sync.Mutex
+	keyAuths map[string]string // By token.
+}
+
+func NewHTTPChallengeHandler() *HTTPChallengeHandler {
+	return &HTTPChallengeHandler{keyAuths: map[string]string{}}
+}
+
+// Present makes the key authorization for the given token available until
+// CleanUp is called. Implements challenge.Provider.
+func (this *HTTPChallengeHandler) Present(domain, token, keyAuth string) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.keyAuths[token] = keyAuth
+	return nil
+}
+
+// CleanUp stops serving the given token, once the CA has validated it.
+// Implements challenge.Provider.
+func (this *HTTPChallengeHandler) CleanUp(domain, token, keyAuth string) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	delete(this.keyAuths, token)
+	return nil
+}
+
+// ServeHTTP responds with the key authorization for the token in the mux
+// params, or 404 if there's no such challenge in progress.
+func (this *HTTPChallengeHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	this.mu.Lock()
+	keyAuth, ok := this.keyAuths[mux.Params(req)["token"]]
+	this.mu.Unlock()
+	if !ok {
+		http.NotFound(resp, req)
+		return
+	}
+	resp.Header().Set("Content-Type", "text/plain")
+	resp.Header().Set("Cache-Control", "no-store")
+	_, _ = resp.Write([]byte(keyAuth))
+}
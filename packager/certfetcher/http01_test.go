@@ -0,0 +1,59 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certfetcher
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/go-acme/lego/v4/challenge/http01"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ampproject/amppackager/packager/mux"
+	pkgt "github.com/ampproject/amppackager/packager/testing"
+)
+
+func TestHTTPChallengeHandler(t *testing.T) {
+	handler := NewHTTPChallengeHandler()
+	// The mux also routes the packager's own endpoints, e.g. healthz.
+	healthz := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.Write([]byte("ok"))
+	})
+	server := mux.New(mux.Handlers{Healthz: healthz, ACMEChallenge: handler})
+	challengeURL := "http://example.com" + http01.ChallengePath("token1")
+
+	// Before the challenge is presented.
+	resp := pkgt.NewRequest(t, server, challengeURL).Do()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// While lego waits for the CA to validate the challenge.
+	require.NoError(t, handler.Present("example.com", "token1", "token1.keyauth"))
+	resp = pkgt.NewRequest(t, server, challengeURL).Do()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "token1.keyauth", string(body))
+	resp = pkgt.NewRequest(t, server, "http://example.com"+http01.ChallengePath("token2")).Do()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp = pkgt.NewRequest(t, server, "http://example.com/healthz").Do()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// After validation, the token is no longer served.
+	require.NoError(t, handler.CleanUp("example.com", "token1", "token1.keyauth"))
+	resp = pkgt.NewRequest(t, server, challengeURL).Do()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -16,13 +16,16 @@ package certloader
 
 import (
 	"crypto"
+	"crypto/ecdsa"
 	"crypto/x509"
 	"encoding/pem"
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/WICG/webpackage/go/signedexchange"
+	"github.com/go-acme/lego/v4/certcrypto"
 	"github.com/gofrs/flock"
 	"github.com/pkg/errors"
 
@@ -30,6 +33,14 @@ import (
 	"github.com/ampproject/amppackager/packager/util"
 )
 
+// The lego key types for each util.ACMEServerConfig.ACMEKeyType.
+var acmeKeyTypes = map[string]certcrypto.KeyType{
+	"":                      certcrypto.EC256,
+	util.ACMEKeyTypeEC256:   certcrypto.EC256,
+	util.ACMEKeyTypeRSA2048: certcrypto.RSA2048,
+	util.ACMEKeyTypeRSA4096: certcrypto.RSA4096,
+}
+
 func CreateCertFetcher(config *util.Config, key crypto.PrivateKey, domain string,
 	developmentMode bool, autoRenewCert bool) (*certfetcher.CertFetcher, error) {
 	if !autoRenewCert {
@@ -37,6 +48,12 @@ func CreateCertFetcher(config *util.Config, key crypto.PrivateKey, domain string
 		return nil, nil
 	}
 
+	// lego signs its ACME requests with the key itself, so it can't use a
+	// KeySigner.
+	if _, ok := key.(*ecdsa.PrivateKey); !ok {
+		return nil, errors.New("autorenewcert requires the key from KeyFile or KeyEnv, not KeySigner")
+	}
+
 	if config.ACMEConfig == nil {
 		return nil, errors.New("missing ACMEConfig")
 	}
@@ -60,26 +77,40 @@ func CreateCertFetcher(config *util.Config, key crypto.PrivateKey, domain string
 		return nil, errors.New("missing email address")
 	}
 	emailAddress := acmeConfig.EmailAddress
-	if acmeConfig.DiscoURL == "" {
+	acmeDiscoveryURL := acmeConfig.DiscoURL
+	if acmeDiscoveryURL == "" {
+		acmeDiscoveryURL = acmeConfig.ACMEDirectoryURL
+	}
+	if acmeDiscoveryURL == "" {
 		return nil, errors.New("missing acme disco url")
 	}
-	acmeDiscoveryURL := acmeConfig.DiscoURL
+	keyType, ok := acmeKeyTypes[acmeConfig.ACMEKeyType]
+	if !ok {
+		return nil, errors.Errorf("unknown ACMEKeyType %q", acmeConfig.ACMEKeyType)
+	}
 	// Fields for External Account Binding. Some CAs require them, others like
 	// DigiCert, do not. Either both eabKid and eabHmac has to be specified or
 	// none of them are specified.
-	if acmeConfig.EABKid == "" && acmeConfig.EABHmac != "" {
+	eabKid, err := loadEABCredential("EABKid", acmeConfig.EABKid, acmeConfig.EABKidFile, acmeConfig.EABKidEnv)
+	if err != nil {
+		return nil, err
+	}
+	eabHmac, err := loadEABCredential("EABHmac", acmeConfig.EABHmac, acmeConfig.EABHmacFile, acmeConfig.EABHmacEnv)
+	if err != nil {
+		return nil, err
+	}
+	if eabKid == "" && eabHmac != "" {
 		return nil, errors.New("EABKid is empty, but EABHmac is not empty, both values need to be set or empty")
 	}
-	if acmeConfig.EABKid != "" && acmeConfig.EABHmac == "" {
+	if eabKid != "" && eabHmac == "" {
 		return nil, errors.New("EABKid is not empty, but EABHmac is empty, both values need to be set or empty")
 	}
-	eabKid := acmeConfig.EABKid
-	eabHmac := acmeConfig.EABHmac
 	if acmeConfig.HttpChallengePort == 0 &&
 		acmeConfig.HttpWebRootDir == "" &&
+		!acmeConfig.HttpChallengeMux &&
 		acmeConfig.TlsChallengePort == 0 &&
 		acmeConfig.DnsProvider == "" {
-		return nil, errors.New("one of HttpChallengePort, HttpWebRootDir, TlsChallengePort and DnsProvider must be present")
+		return nil, errors.New("one of HttpChallengePort, HttpWebRootDir, HttpChallengeMux, TlsChallengePort and DnsProvider must be present")
 	}
 	httpChallengePort := acmeConfig.HttpChallengePort
 	httpWebRootDir := acmeConfig.HttpWebRootDir
@@ -95,7 +126,7 @@ func CreateCertFetcher(config *util.Config, key crypto.PrivateKey, domain string
 
 	// Create the cert fetcher that will auto-renew the cert.
 	certFetcher, err := certfetcher.New(emailAddress, eabKid, eabHmac, csr, key,
-		acmeDiscoveryURL, httpChallengePort, httpWebRootDir, tlsChallengePort,
+		acmeDiscoveryURL, keyType, httpChallengePort, httpWebRootDir, acmeConfig.HttpChallengeMux, tlsChallengePort,
 		dnsProvider, true)
 	if err != nil {
 		return nil, errors.Wrap(err, "creating certfetcher")
@@ -104,6 +135,36 @@ func CreateCertFetcher(config *util.Config, key crypto.PrivateKey, domain string
 	return certFetcher, nil
 }
 
+// Returns the External Account Binding credential with the given name, as
+// configured inline, in a file, or in an environment variable (of which at
+// most one may be set). Surrounding whitespace (e.g. a trailing newline in the
+// file) is trimmed.
+func loadEABCredential(name, value, file, env string) (string, error) {
+	sources := 0
+	for _, source := range []string{value, file, env} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return "", errors.Errorf("at most one of %s, %sFile and %sEnv may be set", name, name, name)
+	}
+	switch {
+	case file != "":
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", errors.Wrapf(err, "reading %sFile", name)
+		}
+		value = string(contents)
+	case env != "":
+		var ok bool
+		if value, ok = os.LookupEnv(env); !ok {
+			return "", errors.Errorf("%sEnv is set, but environment variable %s is not", name, env)
+		}
+	}
+	return strings.TrimSpace(value), nil
+}
+
 // Loads X509 certificates from disk.
 // Returns appropriate errors if:
 //	The file can't be read.
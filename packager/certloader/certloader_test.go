@@ -15,7 +15,11 @@
 package certloader
 
 import (
+	"crypto"
 	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -72,3 +76,50 @@ func TestLoadKeyFromFile(t *testing.T) {
 	assert.Equal(t, pkgt.Key, key)
 	assert.Nil(t, err)
 }
+
+func TestLoadEABCredential(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eab")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "hmac")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("file.hmac\n"), 0600))
+	os.Setenv("AMPPKG_TEST_EAB_HMAC", "env.hmac")
+	defer os.Unsetenv("AMPPKG_TEST_EAB_HMAC")
+
+	tests := []struct {
+		desc, value, file, env string
+		expected, expectedErr  string
+	}{
+		{desc: "none", expected: ""},
+		{desc: "inline", value: "inline.hmac", expected: "inline.hmac"},
+		{desc: "file", file: file, expected: "file.hmac"},
+		{desc: "env", env: "AMPPKG_TEST_EAB_HMAC", expected: "env.hmac"},
+		{desc: "missing file", file: filepath.Join(dir, "missing"), expectedErr: "reading EABHmacFile"},
+		{desc: "unset env", env: "AMPPKG_TEST_EAB_UNSET", expectedErr: "environment variable AMPPKG_TEST_EAB_UNSET is not"},
+		{desc: "several", value: "inline.hmac", env: "AMPPKG_TEST_EAB_HMAC", expectedErr: "at most one of EABHmac, EABHmacFile and EABHmacEnv"},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			hmac, err := loadEABCredential("EABHmac", test.value, test.file, test.env)
+			if test.expectedErr != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), test.expectedErr)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, hmac)
+		})
+	}
+}
+
+func TestCreateCertFetcherRequiresPrivateKey(t *testing.T) {
+	signer := &pkgt.FakeSigner{Key: pkgt.Key.(crypto.Signer)}
+	_, err := CreateCertFetcher(&util.Config{}, signer, "amppackageexample.com", false, true)
+	assert.Contains(t, err.Error(), "autorenewcert requires the key from KeyFile or KeyEnv")
+
+	// Without autorenewcert, no CertFetcher is needed.
+	fetcher, err := CreateCertFetcher(&util.Config{}, signer, "amppackageexample.com", false, false)
+	assert.NoError(t, err)
+	assert.Nil(t, fetcher)
+}
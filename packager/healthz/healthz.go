@@ -15,27 +15,141 @@
 package healthz
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
-	"github.com/ampproject/amppackager/packager/certcache"
 	"net/http"
+	"time"
+
+	"github.com/ampproject/amppackager/packager/certcache"
+	"github.com/pkg/errors"
 )
 
+// A Check is one condition of the packager's health, reported by name in the
+// /healthz response when any fails.
+type Check struct {
+	Name string
+	// Returns nil if healthy. ctx is that of the health check request.
+	Run func(ctx context.Context) error
+}
+
+// The threshold of CertExpiryCheck, if zero.
+const defaultCertExpiryThreshold = 7 * 24 * time.Hour
+
+// CertExpiryCheck fails once the latest cert is within threshold (default 7
+// days, which zero selects) of its expiry, so that a cert that isn't being
+// renewed is noticed before it stops being usable.
+func CertExpiryCheck(certHandler certcache.CertHandler, threshold time.Duration, now func() time.Time) Check {
+	if threshold <= 0 {
+		threshold = defaultCertExpiryThreshold
+	}
+	return Check{"certExpiry", func(context.Context) error {
+		cert := certHandler.GetLatestCert()
+		if cert == nil {
+			return errors.New("no cert available")
+		}
+		if remaining := cert.NotAfter.Sub(now()); remaining < threshold {
+			return errors.Errorf("cert expires at %v, within %v", cert.NotAfter, threshold)
+		}
+		return nil
+	}}
+}
+
+// UpstreamCheck fails unless a GET of url, e.g. a page of the origin, gets a
+// non-5xx response.
+func UpstreamCheck(client *http.Client, url string) Check {
+	return Check{"upstream", func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return errors.Wrap(err, "building request")
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return errors.Wrapf(err, "fetching %s", url)
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			return errors.Errorf("fetching %s: status %d", url, resp.StatusCode)
+		}
+		return nil
+	}}
+}
+
 type Healthz struct {
-	certHandler certcache.CertHandler
+	checks []Check
 }
 
-func New(certHandler certcache.CertHandler) (*Healthz, error) {
-	return &Healthz{certHandler}, nil
+// New returns a handler that is healthy if the cert and OCSP response are, per
+// certHandler.IsHealthy, and all of the additional checks pass.
+func New(certHandler certcache.CertHandler, checks ...Check) (*Healthz, error) {
+	cert := Check{"cert", func(context.Context) error { return certHandler.IsHealthy() }}
+	return &Healthz{append([]Check{cert}, checks...)}, nil
+}
+
+// The status of one Check, as reported on failure.
+type checkStatus struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
 }
 
 func (this *Healthz) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 	// Follow https://kubernetes.io/docs/tasks/configure-pod-container/configure-liveness-readiness-startup-probes/
-	err := this.certHandler.IsHealthy()
-	if err != nil {
-		resp.WriteHeader(500)
-		resp.Write([]byte(fmt.Sprintf("not healthy: %v", err)))
-	} else {
+	statuses := make([]checkStatus, len(this.checks))
+	healthy := true
+	for i, check := range this.checks {
+		statuses[i] = checkStatus{Name: check.Name, Healthy: true}
+		if err := check.Run(req.Context()); err != nil {
+			statuses[i].Healthy = false
+			statuses[i].Error = err.Error()
+			healthy = false
+		}
+	}
+	if healthy {
 		resp.WriteHeader(200)
 		resp.Write([]byte("ok"))
+		return
+	}
+	body, err := json.Marshal(statuses)
+	if err != nil {
+		http.Error(resp, fmt.Sprintf("not healthy; error encoding status: %v", err), http.StatusInternalServerError)
+		return
+	}
+	resp.Header().Set("Content-Type", "application/json")
+	resp.Header().Set("Cache-Control", "no-store")
+	resp.Header().Set("X-Content-Type-Options", "nosniff")
+	resp.WriteHeader(500)
+	resp.Write(body)
+}
+
+type StatusReporter interface {
+	Status() *certcache.Status
+}
+
+// Detail serves a JSON description of the current cert and OCSP response, for
+// monitoring and alerting.
+type Detail struct {
+	reporter StatusReporter
+}
+
+func NewDetail(reporter StatusReporter) (*Detail, error) {
+	return &Detail{reporter}, nil
+}
+
+func (this *Detail) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	status := this.reporter.Status()
+	if status == nil {
+		http.Error(resp, "no cert available", http.StatusServiceUnavailable)
+		return
+	}
+	body, err := json.Marshal(status)
+	if err != nil {
+		http.Error(resp, fmt.Sprintf("error encoding status: %v", err), http.StatusInternalServerError)
+		return
 	}
+	resp.Header().Set("Content-Type", "application/json")
+	resp.Header().Set("Cache-Control", "no-store")
+	resp.Header().Set("X-Content-Type-Options", "nosniff")
+	resp.WriteHeader(http.StatusOK)
+	resp.Write(body)
 }
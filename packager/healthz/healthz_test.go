@@ -16,9 +16,13 @@ package healthz
 
 import (
 	"crypto/x509"
+	"encoding/json"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/ampproject/amppackager/packager/certcache"
 	"github.com/ampproject/amppackager/packager/mux"
 	"github.com/pkg/errors"
 
@@ -34,6 +38,10 @@ func (this fakeHealthyCertHandler) GetLatestCert() *x509.Certificate {
 	return pkgt.Certs[0]
 }
 
+func (this fakeHealthyCertHandler) GetOCSPExpiry() time.Time {
+	return time.Time{}
+}
+
 func (this fakeHealthyCertHandler) IsHealthy() error {
 	return nil
 }
@@ -45,6 +53,10 @@ func (this fakeNotHealthyCertHandler) GetLatestCert() *x509.Certificate {
 	return pkgt.Certs[0]
 }
 
+func (this fakeNotHealthyCertHandler) GetOCSPExpiry() time.Time {
+	return time.Time{}
+}
+
 func (this fakeNotHealthyCertHandler) IsHealthy() error {
 	return errors.New("random error")
 }
@@ -52,13 +64,121 @@ func (this fakeNotHealthyCertHandler) IsHealthy() error {
 func TestHealthzOk(t *testing.T) {
 	handler, err := New(fakeHealthyCertHandler{})
 	require.NoError(t, err)
-	resp := pkgt.NewRequest(t, mux.New(nil, nil, nil, handler, nil), "/healthz").Do()
+	resp := pkgt.NewRequest(t, mux.New(mux.Handlers{Healthz: handler}), "/healthz").Do()
 	assert.Equal(t, http.StatusOK, resp.StatusCode, "ok", resp)
 }
 
 func TestHealthzFail(t *testing.T) {
 	handler, err := New(fakeNotHealthyCertHandler{})
 	require.NoError(t, err)
-	resp := pkgt.NewRequest(t, mux.New(nil, nil, nil, handler, nil), "/healthz").Do()
+	resp := pkgt.NewRequest(t, mux.New(mux.Handlers{Healthz: handler}), "/healthz").Do()
 	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode, "error", resp)
 }
+
+// checkResults returns the status of each check listed in a failing /healthz
+// response, keyed by name.
+func checkResults(t *testing.T, resp *http.Response) map[string]checkStatus {
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	var statuses []checkStatus
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&statuses))
+	results := map[string]checkStatus{}
+	for _, status := range statuses {
+		results[status.Name] = status
+	}
+	return results
+}
+
+func TestHealthzFailListsChecks(t *testing.T) {
+	handler, err := New(fakeNotHealthyCertHandler{})
+	require.NoError(t, err)
+	results := checkResults(t, pkgt.NewRequest(t, mux.New(mux.Handlers{Healthz: handler}), "/healthz").Do())
+	assert.Equal(t, map[string]checkStatus{
+		"cert": {Name: "cert", Healthy: false, Error: "random error"},
+	}, results)
+}
+
+func TestHealthzAllChecksPass(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {}))
+	defer upstream.Close()
+	now := func() time.Time { return pkgt.Certs[0].NotAfter.Add(-30 * 24 * time.Hour) }
+	handler, err := New(fakeHealthyCertHandler{},
+		CertExpiryCheck(fakeHealthyCertHandler{}, 7*24*time.Hour, now),
+		UpstreamCheck(upstream.Client(), upstream.URL))
+	require.NoError(t, err)
+	resp := pkgt.NewRequest(t, mux.New(mux.Handlers{Healthz: handler}), "/healthz").Do()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestHealthzCertExpiryFail(t *testing.T) {
+	now := func() time.Time { return pkgt.Certs[0].NotAfter.Add(-3 * 24 * time.Hour) }
+	handler, err := New(fakeHealthyCertHandler{}, CertExpiryCheck(fakeHealthyCertHandler{}, 7*24*time.Hour, now))
+	require.NoError(t, err)
+	results := checkResults(t, pkgt.NewRequest(t, mux.New(mux.Handlers{Healthz: handler}), "/healthz").Do())
+	assert.True(t, results["cert"].Healthy)
+	assert.False(t, results["certExpiry"].Healthy)
+	assert.Contains(t, results["certExpiry"].Error, "within 168h0m0s")
+}
+
+func TestHealthzUpstreamErrorStatus(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+	handler, err := New(fakeHealthyCertHandler{}, UpstreamCheck(upstream.Client(), upstream.URL))
+	require.NoError(t, err)
+	results := checkResults(t, pkgt.NewRequest(t, mux.New(mux.Handlers{Healthz: handler}), "/healthz").Do())
+	assert.True(t, results["cert"].Healthy)
+	assert.False(t, results["upstream"].Healthy)
+	assert.Contains(t, results["upstream"].Error, "status 503")
+}
+
+func TestHealthzUpstreamUnreachable(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {}))
+	upstream.Close()
+	handler, err := New(fakeHealthyCertHandler{}, UpstreamCheck(upstream.Client(), upstream.URL))
+	require.NoError(t, err)
+	results := checkResults(t, pkgt.NewRequest(t, mux.New(mux.Handlers{Healthz: handler}), "/healthz").Do())
+	assert.False(t, results["upstream"].Healthy)
+	assert.Contains(t, results["upstream"].Error, "fetching "+upstream.URL)
+}
+
+type fakeStatusReporter struct {
+	status *certcache.Status
+}
+
+func (this fakeStatusReporter) Status() *certcache.Status {
+	return this.status
+}
+
+func TestHealthzDetail(t *testing.T) {
+	nextUpdate := time.Date(2020, 1, 8, 0, 0, 0, 0, time.UTC)
+	handler, err := NewDetail(fakeStatusReporter{&certcache.Status{
+		Subject:             "CN=example.com",
+		NotBefore:           time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:            time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC),
+		OCSPNextUpdate:      &nextUpdate,
+		OCSPPastRefreshTime: true,
+	}})
+	require.NoError(t, err)
+	resp := pkgt.NewRequest(t, mux.New(mux.Handlers{HealthzDetail: handler}), "/amppkg/healthz/detail").Do()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	var body map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, map[string]interface{}{
+		"subject":             "CN=example.com",
+		"notBefore":           "2020-01-01T00:00:00Z",
+		"notAfter":            "2020-04-01T00:00:00Z",
+		"ocspNextUpdate":      "2020-01-08T00:00:00Z",
+		"ocspPastRefreshTime": true,
+	}, body)
+}
+
+func TestHealthzDetailNoCert(t *testing.T) {
+	handler, err := NewDetail(fakeStatusReporter{nil})
+	require.NoError(t, err)
+	resp := pkgt.NewRequest(t, mux.New(mux.Handlers{HealthzDetail: handler}), "/amppkg/healthz/detail").Do()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
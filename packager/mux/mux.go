@@ -44,18 +44,20 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-// routingRule maps a URL path prefix to three entities:
+// routingRule maps a URL path prefix to four entities:
 // * suffixValidatorFunc - a function that validates the suffix of URL path,
 // * handler - an http.Handler that should handle such prefix,
 // * handlerPrometheusLabel - a label (dimension) to be used in
 //       handler-agnostic Prometheus metrics like requests count.
 //       Must adhere to the Prometheus data model:
 // 		 https://prometheus.io/docs/concepts/data_model/#metric-names-and-labels
+// * methods - the HTTP methods the handler accepts.
 type routingRule struct {
 	urlPathPrefix          string
 	suffixValidatorFunc    func(suffix string, req *http.Request, params *map[string]string, errorMsg *string, errorCode *int)
 	handler                http.Handler
 	handlerPrometheusLabel string
+	methods                map[string]bool
 }
 
 // mux stores a routingMatrix, an array of routing rules that define the mux'
@@ -102,23 +104,89 @@ func expectCertQuery(suffix string, req *http.Request, params *map[string]string
 	}
 }
 
+// expectACMEChallengeToken is a URL Path Suffix Validator specific to ACME
+// HTTP-01 challenge requests.
+func expectACMEChallengeToken(suffix string, req *http.Request, params *map[string]string, errorMsg *string, errorCode *int) {
+	if suffix == "" || strings.Contains(suffix, "/") {
+		return404(suffix, req, params, errorMsg, errorCode)
+	} else {
+		(*params)["token"] = suffix
+	}
+}
+
+// Handlers are the handlers to which New routes requests.
+type Handlers struct {
+	CertCache     http.Handler
+	Signer        http.Handler
+	ValidityMap   http.Handler
+	Healthz       http.Handler
+	HealthzDetail http.Handler
+	Metrics       http.Handler
+	// May be nil, if ACME HTTP-01 challenges aren't served by the amppkg
+	// server itself.
+	ACMEChallenge http.Handler
+	// May be nil, if the standalone transformer isn't served.
+	Transform http.Handler
+}
+
 // New is the main entry point. Use the return value for http.Server.Handler.
-func New(certCache http.Handler, signer http.Handler, validityMap http.Handler, healthz http.Handler, metrics http.Handler) http.Handler {
+func New(handlers Handlers) http.Handler {
+	// Note that the order of rules in the matrix matters: the first
+	// matching rule will be applied, so the rule for “/priv/doc/” precedes
+	// the rule for “/priv/doc” (note that SignerURLPrefix is "/priv/doc").
+	// Also note that the last rule matches any URL.
+	routingMatrix := []routingRule{
+		{util.SignerURLPrefix + "/", expectSignerQuery, handlers.Signer, "signer", readMethods},
+		{util.SignerURLPrefix, expectNoSuffix, handlers.Signer, "signer", readMethods},
+		{util.CertURLPrefix + "/", expectCertQuery, handlers.CertCache, "certCache", readMethods},
+		{util.ValidityMapPath, expectNoSuffix, handlers.ValidityMap, "validityMap", readMethods},
+		{util.HealthzPath, expectNoSuffix, handlers.Healthz, "healthz", readMethods},
+		{util.HealthzDetailPath, expectNoSuffix, handlers.HealthzDetail, "healthzDetail", readMethods},
+		{util.MetricsPath, expectNoSuffix, handlers.Metrics, "metrics", readMethods},
+	}
+	if handlers.ACMEChallenge != nil {
+		routingMatrix = append(routingMatrix,
+			routingRule{util.ACMEChallengePrefix + "/", expectACMEChallengeToken, handlers.ACMEChallenge, "acmeChallenge", readMethods})
+	}
+	if handlers.Transform != nil {
+		routingMatrix = append(routingMatrix,
+			routingRule{util.TransformPath, expectNoSuffix, handlers.Transform, "transform", postMethods})
+	}
 	return &mux{
-		// Note that the order of rules in the matrix matters: the first
-		// matching rule will be applied, so the rule for “/priv/doc/” precedes
-		// the rule for “/priv/doc” (note that SignerURLPrefix is "/priv/doc").
-		// Also note that the last rule matches any URL.
-		[]routingRule{
-			{util.SignerURLPrefix + "/", expectSignerQuery, signer, "signer"},
-			{util.SignerURLPrefix, expectNoSuffix, signer, "signer"},
-			{util.CertURLPrefix + "/", expectCertQuery, certCache, "certCache"},
-			{util.ValidityMapPath, expectNoSuffix, validityMap, "validityMap"},
-			{util.HealthzPath, expectNoSuffix, healthz, "healthz"},
-			{util.MetricsPath, expectNoSuffix, metrics, "metrics"},
-		},
-		/* defaultRule= */ routingRule{"", return404, nil, "handler_not_assigned"},
+		routingMatrix,
+		/* defaultRule= */ routingRule{"", return404, nil, "handler_not_assigned", readMethods},
+	}
+}
+
+// NoSniff wraps handler so that all its responses, including unsigned ones proxied
+// from the origin and error responses, have X-Content-Type-Options: nosniff,
+// replacing any other value set by handler.
+func NoSniff(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		handler.ServeHTTP(&noSniffWriter{ResponseWriter: resp}, req)
+	})
+}
+
+// noSniffWriter sets X-Content-Type-Options just before the header is written,
+// so that it takes precedence over any value set by the handler.
+type noSniffWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (this *noSniffWriter) WriteHeader(statusCode int) {
+	if !this.wroteHeader {
+		this.wroteHeader = true
+		this.Header().Set("X-Content-Type-Options", "nosniff")
+	}
+	this.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (this *noSniffWriter) Write(body []byte) (int, error) {
+	if !this.wroteHeader {
+		this.WriteHeader(http.StatusOK)
 	}
+	return this.ResponseWriter.Write(body)
 }
 
 // promRequestsLatency is a Prometheus histogram that observes requests latencies.
@@ -141,7 +209,10 @@ func tryTrimPrefix(s, prefix string) (string, bool) {
 	return trimmed, len(prefix)+len(trimmed) == sLen
 }
 
-var allowedMethods = map[string]bool{http.MethodGet: true, http.MethodHead: true}
+// The methods accepted by the handlers that only serve content, and by those
+// that accept it, respectively.
+var readMethods = map[string]bool{http.MethodGet: true, http.MethodHead: true}
+var postMethods = map[string]bool{http.MethodPost: true}
 
 func (this *mux) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 	// Use EscapedPath rather than RequestURI because the latter can take
@@ -171,7 +242,7 @@ func (this *mux) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 	errorMsg := ""
 	errorCode := 0
 	// Validate HTTP method and params, parse params and attach them to req.
-	if !allowedMethods[req.Method] {
+	if !matchingRule.methods[req.Method] {
 		errorMsg, errorCode = "405 method not allowed", http.StatusMethodNotAllowed
 	} else {
 		params := map[string]string{}
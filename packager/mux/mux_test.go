@@ -125,18 +125,28 @@ func TestServeHTTPSuccess(t *testing.T) {
 			testURL:       `$HOST/healthz`,
 			expectHandler: `healthz`,
 			expectParams:  map[string]string{},
+		}, {
+			testName:      `HealthzDetail - regular`,
+			testURL:       `$HOST/amppkg/healthz/detail`,
+			expectHandler: `healthzDetail`,
+			expectParams:  map[string]string{},
 		}, {
 			testName:      `Metrics - regular`,
 			testURL:       `$HOST/metrics`,
 			expectHandler: `metrics`,
 			expectParams:  map[string]string{},
+		}, {
+			testName:      `ACME challenge - regular`,
+			testURL:       `$HOST/.well-known/acme-challenge/some_token`,
+			expectHandler: `acmeChallenge`,
+			expectParams:  map[string]string{`token`: `some_token`},
 		},
 	}
 	for _, tt := range templateTests {
 		testName := tt.testName
 		t.Run(testName, func(t *testing.T) {
 			// Defer validation to ensure it does happen.
-			mocks := map[string](*mockedHandler){"signer": &mockedHandler{}, "healthz": &mockedHandler{}, "cert": &mockedHandler{}, "validityMap": &mockedHandler{}, "metrics": &mockedHandler{}}
+			mocks := map[string](*mockedHandler){"signer": &mockedHandler{}, "healthz": &mockedHandler{}, "healthzDetail": &mockedHandler{}, "cert": &mockedHandler{}, "validityMap": &mockedHandler{}, "metrics": &mockedHandler{}, "acmeChallenge": &mockedHandler{}}
 			var actualResp *http.Response
 			defer func() {
 				// Expect no errors.
@@ -159,7 +169,7 @@ func TestServeHTTPSuccess(t *testing.T) {
 			expectMockedHandler.On("ServeHTTP", tt.expectParams)
 
 			// Run.
-			mux := New(mocks["cert"], mocks["signer"], mocks["validityMap"], mocks["healthz"], mocks["metrics"])
+			mux := New(Handlers{CertCache: mocks["cert"], Signer: mocks["signer"], ValidityMap: mocks["validityMap"], Healthz: mocks["healthz"], HealthzDetail: mocks["healthzDetail"], Metrics: mocks["metrics"], ACMEChallenge: mocks["acmeChallenge"]})
 			actualResp = pkgt.NewRequest(t, mux, tt.testURL).Do()
 		})
 	}
@@ -180,7 +190,7 @@ func expectError(t *testing.T, url string, expectErrorMessage string, expectErro
 	}()
 
 	// Initialize mux with 4 identical mocked handlers, because no calls are expect to any of them.
-	mux := New(mockedHandler, mockedHandler, mockedHandler, mockedHandler, mockedHandler)
+	mux := New(Handlers{CertCache: mockedHandler, Signer: mockedHandler, ValidityMap: mockedHandler, Healthz: mockedHandler, HealthzDetail: mockedHandler, Metrics: mockedHandler, ACMEChallenge: mockedHandler})
 
 	// Run and extract error.
 	actualResp = pkgt.NewRequest(t, mux, url).SetBody(body).Do()
@@ -201,6 +211,8 @@ func TestServeHTTPexpect404s(t *testing.T) {
 		{"Healthz - unexpected closing slash    ", "$HOST/healthz/"},
 		{"Healthz - unexpected extra char       ", "$HOST/healthz1"},
 		{"Metrics - unexpected closing slash    ", "$HOST/metrics/"},
+		{"ACME challenge - no token             ", "$HOST/.well-known/acme-challenge/"},
+		{"ACME challenge - nested path          ", "$HOST/.well-known/acme-challenge/a/b"},
 	}
 	for _, tt := range templateTests {
 		t.Run(tt.testName, func(t *testing.T) {
@@ -224,6 +236,31 @@ func TestParamsIncorrectValueType(t *testing.T) {
 	assert.Equal(t, Params(req), map[string]string{})
 }
 
+func TestServeHTTPNoACMEChallengeHandler(t *testing.T) {
+	mux := New(Handlers{})
+	resp := pkgt.NewRequest(t, mux, expand("$HOST/.well-known/acme-challenge/some_token")).Do()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestServeHTTPTransform(t *testing.T) {
+	transform := new(mockedHandler)
+	transform.On("ServeHTTP", map[string]string{})
+	mux := New(Handlers{Transform: transform})
+	resp := pkgt.NewRequest(t, mux, expand("$HOST/amppkg/transform")).SetBody(strings.NewReader("<html amp>")).Do()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	transform.AssertExpectations(t)
+
+	// It accepts only POST.
+	resp = pkgt.NewRequest(t, mux, expand("$HOST/amppkg/transform")).Do()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	transform.AssertNumberOfCalls(t, "ServeHTTP", 1)
+
+	// It isn't served unless given.
+	mux = New(Handlers{})
+	resp = pkgt.NewRequest(t, mux, expand("$HOST/amppkg/transform")).SetBody(strings.NewReader("<html amp>")).Do()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
 // TestPrometheusMetricRequestsLatency tests the end-to-end latencies metrics.
 // It checks that the right error codes and handlers are accounted for. It also
 // checks that the latencies are positive, but doesn't expect exact values,
@@ -318,7 +355,7 @@ func TestPrometheusMetricRequestsLatency(t *testing.T) {
 					http.Error(w, "404 page not found", 404)
 				}
 			}))
-			mux := New(mockHandler, mockHandler, mockHandler, mockHandler, mockHandler)
+			mux := New(Handlers{CertCache: mockHandler, Signer: mockHandler, ValidityMap: mockHandler, Healthz: mockHandler, HealthzDetail: mockHandler, Metrics: mockHandler, ACMEChallenge: mockHandler})
 			pkgt.NewRequest(t, mux, expand(req.urlTemplate)).Do()
 
 		}
@@ -366,3 +403,31 @@ func TestPrometheusMetricRequestsLatency(t *testing.T) {
 		}
 	}
 }
+
+func TestNoSniff(t *testing.T) {
+	cert := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.Write([]byte("cert"))
+	})
+	// As when proxying an unsigned response from an origin that sets its own value.
+	signer := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set("X-Content-Type-Options", "sniff")
+		resp.WriteHeader(http.StatusOK)
+		resp.Write([]byte("doc"))
+	})
+	mockedHandler := new(mockedHandler)
+	mux := New(Handlers{CertCache: cert, Signer: signer, ValidityMap: mockedHandler, Healthz: mockedHandler, HealthzDetail: mockedHandler, Metrics: mockedHandler})
+
+	for _, test := range []struct {
+		url, expected string
+	}{
+		{expand(`$HOST/amppkg/cert/$CERT`), ""},
+		{expand(`$HOST/priv/doc/$SIGN`), "sniff"},
+	} {
+		resp := pkgt.NewRequest(t, mux, test.url).Do()
+		assert.Equal(t, test.expected, resp.Header.Get("X-Content-Type-Options"), "disabled: %s", test.url)
+
+		resp = pkgt.NewRequest(t, NoSniff(mux), test.url).Do()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, test.url)
+		assert.Equal(t, []string{"nosniff"}, resp.Header["X-Content-Type-Options"], test.url)
+	}
+}
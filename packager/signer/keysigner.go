@@ -0,0 +1,129 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signer
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+
+	"github.com/WICG/webpackage/go/signedexchange"
+	"github.com/WICG/webpackage/go/signedexchange/structuredheader"
+	"github.com/pkg/errors"
+)
+
+// sxgSignatureHash returns the hash of the SXG signature algorithm for a leaf
+// cert with the given public key: ecdsa_secp256r1_sha256 or
+// ecdsa_secp384r1_sha384, per
+// https://wicg.github.io/webpackage/draft-yasskin-http-origin-signed-responses.html#signature-validity.
+// Clients reject signatures by any other key, including RSA keys, so they are
+// an error.
+func sxgSignatureHash(pubKey crypto.PublicKey) (crypto.Hash, error) {
+	switch pubKey := pubKey.(type) {
+	case *ecdsa.PublicKey:
+		switch name := pubKey.Curve.Params().Name; name {
+		case elliptic.P256().Params().Name:
+			return crypto.SHA256, nil
+		case elliptic.P384().Params().Name:
+			return crypto.SHA384, nil
+		default:
+			return 0, errors.Errorf("ECDSA curve %s is not supported for signed exchanges; use P-256 or P-384", name)
+		}
+	case *rsa.PublicKey:
+		return 0, errors.New("RSA keys are not supported for signed exchanges; use an ECDSA P-256 or P-384 key")
+	case nil:
+		return 0, errors.New("key has no public key")
+	default:
+		return 0, errors.Errorf("%T keys are not supported for signed exchanges; use an ECDSA P-256 or P-384 key", pubKey)
+	}
+}
+
+// Sets the Signature header of exchange, per signer, with the signature
+// algorithm for the public key of its leaf cert. The private key may be any
+// crypto.Signer for it (e.g. one backed by a KMS), not just an
+// *ecdsa.PrivateKey, as signedexchange requires, so this signs the message
+// itself, and builds the header as signedexchange would.
+func addSignatureHeader(exchange *signedexchange.Exchange, signer *signedexchange.Signer) error {
+	if len(signer.Certs) == 0 {
+		return errors.New("no cert to sign with")
+	}
+	certPubKey := signer.Certs[0].PublicKey
+	hash, err := sxgSignatureHash(certPubKey)
+	if err != nil {
+		return errors.Wrap(err, "leaf cert")
+	}
+	keySigner, ok := signer.PrivKey.(crypto.Signer)
+	if !ok {
+		return errors.Errorf("unsupported private key type %T", signer.PrivKey)
+	}
+	if !publicKeysEqual(certPubKey, keySigner.Public()) {
+		return errors.New("private key doesn't match the leaf cert")
+	}
+	if scheme := signer.CertUrl.Scheme; scheme != "https" && scheme != "data" {
+		return errors.Errorf("cert-url has disallowed scheme %q", scheme)
+	}
+
+	var message bytes.Buffer
+	if err := exchange.DumpSignedMessage(&message, signer); err != nil {
+		return errors.Wrap(err, "serializing signed message")
+	}
+	digest := hash.New()
+	digest.Write(message.Bytes())
+	random := signer.Rand
+	if random == nil {
+		random = rand.Reader
+	}
+	// ECDSA signers return the ASN.1 Ecdsa-Sig-Value that the spec requires.
+	sig, err := keySigner.Sign(random, digest.Sum(nil), hash)
+	if err != nil {
+		return errors.Wrap(err, "signing message")
+	}
+
+	certSha256 := sha256.Sum256(signer.Certs[0].Raw)
+	header := structuredheader.ParameterisedIdentifier{
+		Label: "label",
+		Params: structuredheader.Parameters{
+			"sig":          sig,
+			"validity-url": signer.ValidityUrl.String(),
+			"integrity":    exchange.Version.MiceEncoding().IntegrityIdentifier(),
+			"cert-url":     signer.CertUrl.String(),
+			"cert-sha256":  certSha256[:],
+			"date":         signer.Date.Unix(),
+			"expires":      signer.Expires.Unix(),
+		}}
+	value, err := header.String()
+	if err != nil {
+		return errors.Wrap(err, "serializing Signature header")
+	}
+	exchange.SignatureHeaderValue = value
+	return nil
+}
+
+// publicKeysEqual returns true if a and b are the same ECDSA public key.
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	aKey, ok := a.(*ecdsa.PublicKey)
+	if !ok {
+		return false
+	}
+	bKey, ok := b.(*ecdsa.PublicKey)
+	if !ok {
+		return false
+	}
+	return aKey.Curve.Params().Name == bKey.Curve.Params().Name && aKey.X.Cmp(bKey.X) == 0 && aKey.Y.Cmp(bKey.Y) == 0
+}
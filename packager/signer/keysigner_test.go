@@ -0,0 +1,146 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signer
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/WICG/webpackage/go/signedexchange"
+	"github.com/WICG/webpackage/go/signedexchange/structuredheader"
+	"github.com/WICG/webpackage/go/signedexchange/version"
+	pkgt "github.com/ampproject/amppackager/packager/testing"
+	"github.com/ampproject/amppackager/packager/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Returns a self-signed cert for a new ECDSA key on curve, and the key.
+func newECDSACert(t *testing.T, curve elliptic.Curve) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	require.NoError(t, err)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+// Signs a new exchange with cert and key, and returns it, and the signer.
+func signExchange(cert *x509.Certificate, key crypto.PrivateKey) (*signedexchange.Exchange, *signedexchange.Signer, error) {
+	exchange := signedexchange.NewExchange(version.Version1b3, "https://example.com/", http.MethodGet, http.Header{}, 200, http.Header{"Content-Type": {"text/html"}}, []byte("hello"))
+	if err := exchange.MiEncodePayload(4096); err != nil {
+		return nil, nil, err
+	}
+	certURL, _ := url.Parse("https://example.com/cert")
+	validityURL, _ := url.Parse("https://example.com/validity")
+	date := time.Now()
+	signer := &signedexchange.Signer{
+		Date:        date,
+		Expires:     date.Add(time.Hour),
+		Certs:       []*x509.Certificate{cert},
+		CertUrl:     certURL,
+		ValidityUrl: validityURL,
+		PrivKey:     key,
+	}
+	return exchange, signer, addSignatureHeader(exchange, signer)
+}
+
+func TestAddSignatureHeader(t *testing.T) {
+	p384Cert, p384Key := newECDSACert(t, elliptic.P384())
+	for _, test := range []struct {
+		desc string
+		cert *x509.Certificate
+		key  crypto.PrivateKey
+		hash crypto.Hash
+	}{
+		{"P-256", pkgt.Certs[0], pkgt.Key, crypto.SHA256},
+		{"P-384", p384Cert, p384Key, crypto.SHA384},
+		{"P-256 crypto.Signer", pkgt.Certs[0], &pkgt.FakeSigner{Key: pkgt.Key.(crypto.Signer)}, crypto.SHA256},
+	} {
+		exchange, signer, err := signExchange(test.cert, test.key)
+		if !assert.NoError(t, err, test.desc) {
+			continue
+		}
+		signatures, err := structuredheader.ParseParameterisedList(exchange.SignatureHeaderValue)
+		require.NoError(t, err, test.desc)
+		require.Len(t, signatures, 1, test.desc)
+		assert.Equal(t, "digest/mi-sha256-03", signatures[0].Params["integrity"], test.desc)
+		assert.Equal(t, "https://example.com/cert", signatures[0].Params["cert-url"], test.desc)
+		sig, ok := signatures[0].Params["sig"].([]byte)
+		require.True(t, ok, test.desc)
+
+		// The signature is by the cert's key, with the hash for its curve.
+		var message bytes.Buffer
+		require.NoError(t, exchange.DumpSignedMessage(&message, signer), test.desc)
+		digest := test.hash.New()
+		digest.Write(message.Bytes())
+		var rs struct{ R, S *big.Int }
+		_, err = asn1.Unmarshal(sig, &rs)
+		require.NoError(t, err, test.desc)
+		assert.True(t, ecdsa.Verify(test.cert.PublicKey.(*ecdsa.PublicKey), digest.Sum(nil), rs.R, rs.S), test.desc)
+	}
+}
+
+func TestAddSignatureHeaderUnsupportedKeys(t *testing.T) {
+	p384Cert, _ := newECDSACert(t, elliptic.P384())
+	for _, test := range []struct {
+		desc, expectedErr string
+		cert              *x509.Certificate
+		key               crypto.PrivateKey
+	}{
+		{"RSA", "leaf cert: RSA keys are not supported for signed exchanges", pkgt.CACert, pkgt.CAKey},
+		{"mismatched key", "private key doesn't match the leaf cert", p384Cert, pkgt.Key},
+		{"not a signer", "unsupported private key type", pkgt.Certs[0], "key"},
+	} {
+		exchange, _, err := signExchange(test.cert, test.key)
+		if assert.Error(t, err, test.desc) {
+			assert.Contains(t, err.Error(), test.expectedErr, test.desc)
+		}
+		assert.Empty(t, exchange.SignatureHeaderValue, test.desc)
+	}
+}
+
+func TestNewRejectsUnsupportedKeys(t *testing.T) {
+	for _, test := range []struct {
+		desc, expectedErr string
+		key               crypto.PrivateKey
+	}{
+		{"RSA", "RSA keys are not supported for signed exchanges", pkgt.CAKey},
+		{"P-521", "ECDSA curve P-521 is not supported for signed exchanges", pkgt.B3KeyP521},
+	} {
+		_, err := New(fakeCertHandler{}, test.key, []util.URLSet{}, nil, nil, nil, false, nil, time.Now)
+		if assert.Error(t, err, test.desc) {
+			assert.Contains(t, err.Error(), test.expectedErr, test.desc)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signer
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+
+	"github.com/WICG/webpackage/go/signedexchange"
+	"github.com/WICG/webpackage/go/signedexchange/mice"
+	"github.com/pkg/errors"
+)
+
+// miceReader is an io.Reader of the MI encoding of an in-memory payload. This
+// isn't streaming: each proof depends on all the records after it, so the
+// whole payload must be available before the first byte is read. But unlike
+// mice.Encoding.Encode, it doesn't build an encoded copy of the payload: the
+// proofs are computed up front, and the records then read straight out of
+// the payload. Besides the payload, it holds only 32 bytes per record.
+type miceReader struct {
+	payload    []byte
+	recordSize int
+	// proofs[i] is the integrity proof of record i; proofs[0] is the
+	// top-level proof carried in the digest header.
+	proofs [][]byte
+	// next is the index of the next segment of the encoding to read: the
+	// record size, then record 0, then alternately the proof and the content
+	// of each following record.
+	next int
+	cur  []byte
+}
+
+func newMICEReader(enc mice.Encoding, payload []byte, recordSize int) *miceReader {
+	numRecords := (len(payload) + recordSize - 1) / recordSize
+	if numRecords == 0 && enc == mice.Draft02Encoding {
+		numRecords = 1
+	}
+	this := &miceReader{payload: payload, recordSize: recordSize, proofs: make([][]byte, numRecords)}
+	if numRecords == 0 {
+		// As a special case, the encoding of an empty payload is itself
+		// an empty message, and its integrity proof is SHA-256("\0").
+		this.proofs = [][]byte{hashRecord(nil, nil)}
+		this.next = 1
+		return this
+	}
+	for i := numRecords - 1; i >= 0; i-- {
+		if i == numRecords-1 {
+			this.proofs[i] = hashRecord(this.record(i), nil)
+		} else {
+			this.proofs[i] = hashRecord(this.record(i), this.proofs[i+1])
+		}
+	}
+	return this
+}
+
+// hashRecord returns the integrity proof of a record, given the proof of the
+// record after it, or nil if it is the last.
+func hashRecord(record, nextProof []byte) []byte {
+	h := sha256.New()
+	h.Write(record)
+	if nextProof == nil {
+		h.Write([]byte{0})
+	} else {
+		h.Write(nextProof)
+		h.Write([]byte{1})
+	}
+	return h.Sum(nil)
+}
+
+func (this *miceReader) record(i int) []byte {
+	high := (i + 1) * this.recordSize
+	if high > len(this.payload) {
+		high = len(this.payload)
+	}
+	return this.payload[i*this.recordSize : high]
+}
+
+// segment returns the nth segment of the encoding, or false if there are no
+// more.
+func (this *miceReader) segment(n int) ([]byte, bool) {
+	switch {
+	case n == 0:
+		var size [8]byte
+		binary.BigEndian.PutUint64(size[:], uint64(this.recordSize))
+		return size[:], true
+	case n >= 2*len(this.proofs):
+		return nil, false
+	case n%2 == 1:
+		return this.record(n / 2), true
+	default:
+		return this.proofs[n/2], true
+	}
+}
+
+func (this *miceReader) Read(p []byte) (int, error) {
+	for len(this.cur) == 0 {
+		seg, ok := this.segment(this.next)
+		if !ok {
+			return 0, io.EOF
+		}
+		this.next++
+		this.cur = seg
+	}
+	n := copy(p, this.cur)
+	this.cur = this.cur[n:]
+	return n, nil
+}
+
+// miEncodeHeaders adds the MI encoding headers of payload to exchange, and
+// returns a reader of its encoded payload, to be written after
+// exchange.Write, which should then be given an exchange with no payload. This
+// is equivalent to exchange.MiEncodePayload, without the encoded copy.
+func miEncodeHeaders(exchange *signedexchange.Exchange, payload []byte, recordSize int) (*miceReader, error) {
+	enc := exchange.Version.MiceEncoding()
+	if exchange.ResponseHeaders.Get(enc.DigestHeaderName()) != "" {
+		return nil, errors.Errorf("response already has %q header", enc.DigestHeaderName())
+	}
+	reader := newMICEReader(enc, payload, recordSize)
+	exchange.ResponseHeaders.Add("Content-Encoding", enc.ContentEncoding())
+	exchange.ResponseHeaders.Add(enc.DigestHeaderName(), enc.FormatDigestHeader(reader.proofs[0]))
+	return reader, nil
+}
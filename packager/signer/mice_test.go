@@ -0,0 +1,75 @@
+package signer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"testing"
+
+	"github.com/WICG/webpackage/go/signedexchange/mice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingReader counts the bytes read through it, and the largest read.
+type countingReader struct {
+	r       io.Reader
+	n       int
+	maxRead int
+}
+
+func (this *countingReader) Read(p []byte) (int, error) {
+	n, err := this.r.Read(p)
+	this.n += n
+	if n > this.maxRead {
+		this.maxRead = n
+	}
+	return n, err
+}
+
+func TestMICEReaderMatchesEncode(t *testing.T) {
+	for _, enc := range []mice.Encoding{mice.Draft02Encoding, mice.Draft03Encoding} {
+		for _, size := range []int{0, 1, 15, 16, 17, 100} {
+			payload := bytes.Repeat([]byte("a"), size)
+			var expected bytes.Buffer
+			digest, err := enc.Encode(&expected, payload, 16)
+			require.NoError(t, err)
+
+			reader := newMICEReader(enc, payload, 16)
+			actual, err := ioutil.ReadAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, expected.String(), string(actual), "%s, size %d", enc, size)
+			assert.Equal(t, digest, enc.FormatDigestHeader(reader.proofs[0]), "%s, size %d", enc, size)
+		}
+	}
+}
+
+// This measures only the MI encoding of a payload already in memory. It says
+// nothing of the upstream body, which consumeAndSign buffers in full (up to
+// SetMaxBodyLength) before signing.
+func TestMICEReaderDoesNotCopyPayload(t *testing.T) {
+	payload := bytes.Repeat([]byte("<p>Lorem ipsum dolor sit amet.</p>\n"), 100000)
+	require.True(t, len(payload) > 3<<20)
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	counting := &countingReader{r: newMICEReader(mice.Draft03Encoding, payload, maxMIRecordSize)}
+	buf := make([]byte, 64<<10)
+	for {
+		if _, err := counting.Read(buf); err == io.EOF {
+			break
+		}
+	}
+	runtime.ReadMemStats(&after)
+
+	numRecords := (len(payload) + maxMIRecordSize - 1) / maxMIRecordSize
+	assert.Equal(t, 8+len(payload)+32*(numRecords-1), counting.n)
+	// No read spans more than one record, which is never copied.
+	assert.Equal(t, maxMIRecordSize, counting.maxRead)
+	// A few hundred bytes per record's proof and hash, plus the read
+	// buffer, rather than an encoded copy of the multi-megabyte payload.
+	allocated := after.TotalAlloc - before.TotalAlloc
+	assert.True(t, allocated < uint64(len(payload)/8), "allocated %d bytes", allocated)
+}
@@ -16,11 +16,13 @@ package signer
 
 import (
 	"bytes"
+	"context"
 	"crypto"
 	"crypto/x509"
 	"io"
 	"io/ioutil"
 	"log"
+	"mime"
 	"net/http"
 	"net/url"
 	"path"
@@ -37,10 +39,13 @@ import (
 	"github.com/ampproject/amppackager/packager/rtv"
 	"github.com/ampproject/amppackager/packager/util"
 	"github.com/ampproject/amppackager/transformer"
+	"github.com/ampproject/amppackager/transformer/validator"
 	rpb "github.com/ampproject/amppackager/transformer/request"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 // The user agent to send when issuing fetches. Should look like a mobile device.
@@ -71,6 +76,13 @@ var statefulResponseHeaders = map[string]bool{
 	"WWW-Authenticate":          true,
 }
 
+// Request credentials, which are never signed either, should a misconfigured
+// origin echo them in its response.
+var credentialHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+}
+
 // The server generating a 304 response MUST generate any of the
 // following header fields that would have been sent in a 200 (OK) response
 // to the same request.
@@ -84,11 +96,23 @@ var statusNotModifiedHeaders = map[string]bool{
 	"Vary":             true,
 }
 
+// Expires - Date must be <= 604800 seconds, per
+// https://tools.ietf.org/html/draft-yasskin-httpbis-origin-signed-exchanges-impl-00#section-3.5.
+const maxSignatureDuration = 7 * 24 * time.Hour
+
+// Shorter signatures would barely outlive their distribution to caches.
+const minSignatureDuration = time.Hour
+
+// How far the signature date is backdated, to tolerate clients' clock skew.
+// It is at most half the signature duration, so that short signatures remain
+// valid for a while.
+const maxSignatureBackdate = 24 * time.Hour
+
 // The current maximum is defined at:
 // https://cs.chromium.org/chromium/src/content/browser/loader/merkle_integrity_source_stream.cc?l=18&rcl=591949795043a818e50aba8a539094c321a4220c
 // The maximum is cheapest in terms of network usage, and probably CPU on both
 // server and client. The memory usage difference is negligible.
-const miRecordSize = 16 << 10
+const maxMIRecordSize = 16 << 10
 
 // Overrideable for testing.
 var getTransformerRequest = func(r *rtv.RTVCache, s, u string) *rpb.Request {
@@ -102,6 +126,12 @@ var getTransformerRequest = func(r *rtv.RTVCache, s, u string) *rpb.Request {
 // in that it allows multiple slashes, as well as initial and terminal slashes.
 var protocol = regexp.MustCompile("^[!#$%&'*+\\-.^_`|~0-9a-zA-Z/]+$")
 
+// A comma-separated list of language tags
+// (https://tools.ietf.org/html/rfc7231#section-3.1.3.2), roughly as in
+// https://tools.ietf.org/html/rfc5646#section-2.1: subtags of 1-8
+// alphanumerics, the first alphabetic.
+var languageTags = regexp.MustCompile(`^[ \t]*[a-zA-Z]{1,8}(-[a-zA-Z0-9]{1,8})*([ \t]*,[ \t]*[a-zA-Z]{1,8}(-[a-zA-Z0-9]{1,8})*)*[ \t]*$`)
+
 // Gets all values of the named header, joined on comma.
 func GetJoined(h http.Header, name string) string {
 	if values, ok := h[http.CanonicalHeaderKey(name)]; ok {
@@ -126,11 +156,31 @@ type Signer struct {
 	client                  *http.Client
 	urlSets                 []util.URLSet
 	rtvCache                *rtv.RTVCache
-	shouldPackage           func() error
+	shouldPackage           func(context.Context) error
 	overrideBaseURL         *url.URL
 	requireHeaders          bool
 	forwardedRequestHeaders []string
 	timeNow                 func() time.Time
+	referrerPolicy          string
+	errorOnNonHTML          bool
+	nonHTMLProxyTypes       []string
+	urlSetMatch             string
+	canonicalLinkHeader     bool
+	signatureDuration       time.Duration
+	miRecordSize            int
+	maxBodyLength           int
+	errorOnOversizedBody    bool
+	signedResponseHeaders   map[string]bool
+	strippedResponseHeaders map[string]bool
+	unmatchedURL            string
+	validateAMP             bool
+	signInvalidAMP          bool
+	validatorFailOpen       bool
+	requestTimeout          time.Duration
+	outerCacheControl       string
+	outerMaxAge             time.Duration
+	signContentLanguage     bool
+	transformerOptions      *rpb.Request_Options
 }
 
 func noRedirects(req *http.Request, via []*http.Request) error {
@@ -138,7 +188,7 @@ func noRedirects(req *http.Request, via []*http.Request) error {
 }
 
 func New(certHandler certcache.CertHandler, key crypto.PrivateKey, urlSets []util.URLSet,
-	rtvCache *rtv.RTVCache, shouldPackage func() error, overrideBaseURL *url.URL,
+	rtvCache *rtv.RTVCache, shouldPackage func(context.Context) error, overrideBaseURL *url.URL,
 	requireHeaders bool, forwardedRequestHeaders []string, timeNow func() time.Time) (*Signer, error) {
 	client := http.Client{
 		CheckRedirect: noRedirects,
@@ -146,14 +196,277 @@ func New(certHandler certcache.CertHandler, key crypto.PrivateKey, urlSets []uti
 		Timeout: 60 * time.Second,
 	}
 
-	return &Signer{certHandler, key, &client, urlSets, rtvCache, shouldPackage, overrideBaseURL, requireHeaders, forwardedRequestHeaders, timeNow}, nil
+	if _, err := sxgSignatureHash(util.PublicKey(key)); err != nil {
+		return nil, errors.Wrap(err, "checking signing key")
+	}
+	return &Signer{
+		certHandler:             certHandler,
+		key:                     key,
+		client:                  &client,
+		urlSets:                 urlSets,
+		rtvCache:                rtvCache,
+		shouldPackage:           shouldPackage,
+		overrideBaseURL:         overrideBaseURL,
+		requireHeaders:          requireHeaders,
+		forwardedRequestHeaders: forwardedRequestHeaders,
+		timeNow:                 timeNow,
+		signatureDuration:       maxSignatureDuration,
+		miRecordSize:            maxMIRecordSize,
+		maxBodyLength:           maxSignableBodyLength,
+		requestTimeout:          defaultRequestTimeout,
+	}, nil
+}
+
+// SetReferrerPolicy sets the Referrer-Policy header of signed responses,
+// replacing any set by the origin. This must be a value that passes
+// util.ValidateReferrerPolicy. If empty (the default), the origin's header, if
+// any, is signed unmodified.
+func (this *Signer) SetReferrerPolicy(policy string) {
+	this.referrerPolicy = policy
+}
+
+// SetNonHTMLPolicy sets how to respond when the origin's Content-Type isn't
+// text/html. By default, such responses are proxied unsigned. If
+// errorOnNonHTML is true, a 502 is returned instead, except for the media
+// types in proxyTypes (e.g. "application/json"), which are still proxied
+// unsigned.
+func (this *Signer) SetNonHTMLPolicy(errorOnNonHTML bool, proxyTypes []string) {
+	this.errorOnNonHTML = errorOnNonHTML
+	this.nonHTMLProxyTypes = proxyTypes
+}
+
+// SetURLSetMatch sets how to choose among multiple URLSets matching a request,
+// per util.Config.URLSetMatch. By default, the first match is used.
+func (this *Signer) SetURLSetMatch(policy string) {
+	this.urlSetMatch = policy
+}
+
+// SetUnmatchedURLPolicy sets how to respond to requests whose URLs match no
+// URLSet, per util.Config.UnmatchedURL. By default, they get a 400.
+func (this *Signer) SetUnmatchedURLPolicy(policy string) {
+	this.unmatchedURL = policy
+}
+
+// SetCanonicalLinkHeader sets whether the outer response of signed exchanges
+// includes a Link: rel=canonical header, for caches that discover the
+// canonical URL that way. It is the document's <link rel=canonical>, and is
+// omitted if there is none. By default, it is never included.
+func (this *Signer) SetCanonicalLinkHeader(enabled bool) {
+	this.canonicalLinkHeader = enabled
+}
+
+// SetSignatureDuration sets how long signed exchanges are valid for, i.e. the
+// difference between their signature's expires and date. It is clamped to
+// between an hour and 7 days, the protocol maximum, logging a warning if out
+// of range. Zero selects the maximum, the default.
+func (this *Signer) SetSignatureDuration(duration time.Duration) {
+	switch {
+	case duration == 0:
+		duration = maxSignatureDuration
+	case duration > maxSignatureDuration:
+		log.Printf("Signature duration %v exceeds the maximum; using %v.\n", duration, maxSignatureDuration)
+		duration = maxSignatureDuration
+	case duration < minSignatureDuration:
+		log.Printf("Signature duration %v is below the minimum; using %v.\n", duration, minSignatureDuration)
+		duration = minSignatureDuration
+	}
+	this.signatureDuration = duration
+}
+
+// SetMIRecordSize sets the size of the records into which signed payloads are
+// MI-encoded, each followed by the integrity proof of the next. Smaller
+// records let clients verify and process the payload in smaller increments, at
+// the cost of 32 bytes per record. The default, which zero selects, is the
+// maximum accepted by Chrome; larger values are clamped to it, with a warning.
+func (this *Signer) SetMIRecordSize(size int) {
+	if size > maxMIRecordSize {
+		log.Printf("MI record size %d exceeds the maximum; using %d.\n", size, maxMIRecordSize)
+		size = maxMIRecordSize
+	} else if size <= 0 {
+		size = maxMIRecordSize
+	}
+	this.miRecordSize = size
+}
+
+// SetMaxBodyLength sets the length, in bytes, at which documents are too
+// large to sign, either as fetched or as transformed. By default, it is
+// maxSignableBodyLength, the limit of AMP Caches, which zero selects. Such
+// documents are proxied unsigned, or if errorOnExceeded is true, answered with
+// a 502, so that the failure is visible rather than the document silently
+// going uncached.
+func (this *Signer) SetMaxBodyLength(length int, errorOnExceeded bool) {
+	if length <= 0 {
+		length = maxSignableBodyLength
+	}
+	this.maxBodyLength = length
+	this.errorOnOversizedBody = errorOnExceeded
+}
+
+// SetResponseHeaderPolicy sets which of the origin's response headers are
+// signed, as part of the inner response. If signed is non-empty, only those
+// headers (and Content-Type) are; the headers in stripped never are. Neither
+// affects the headers that the signer sets itself, e.g. Link or
+// Content-Security-Policy. Stateful headers, e.g. Set-Cookie, and request
+// credentials, e.g. Authorization, are never signed regardless. By default,
+// all other headers are signed.
+func (this *Signer) SetResponseHeaderPolicy(signed, stripped []string) {
+	this.signedResponseHeaders = canonicalHeaderSet(signed)
+	this.strippedResponseHeaders = canonicalHeaderSet(stripped)
+}
+
+// SetAMPValidation sets whether transformed documents are checked for AMP
+// validity before signing, so that documents the AMP Cache would reject don't
+// occupy its slots. Invalid documents are answered with a 502, and the
+// problems are logged, unless signInvalid is true, in which case they are
+// signed regardless, and the problems only logged. If the validator itself
+// fails, the document is signed if failOpen is true, and otherwise answered
+// with a 502 as if invalid.
+func (this *Signer) SetAMPValidation(enabled, signInvalid, failOpen bool) {
+	this.validateAMP = enabled
+	this.signInvalidAMP = signInvalid
+	this.validatorFailOpen = failOpen
 }
 
-func (this *Signer) fetchURL(fetch *url.URL, serveHTTPReq *http.Request) (*http.Request, *http.Response, *util.HTTPError) {
+// The default bound on each request, including the fetch from the origin and
+// any OCSP fetch made while deciding whether to sign.
+const defaultRequestTimeout = 10 * time.Second
+
+// SetRequestTimeout sets how long each request may take, including the fetch
+// from the origin, the reading of its body, and any OCSP fetch made while
+// deciding whether to sign, before it is cancelled and answered with a 504, so
+// that a hanging origin doesn't hold a connection indefinitely. Zero selects
+// the default, 10 seconds.
+func (this *Signer) SetRequestTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultRequestTimeout
+	}
+	this.requestTimeout = timeout
+}
+
+// SetOuterCacheControl sets how the max-age of the outer SXG response, which
+// governs its caching by CDNs and other intermediaries, is chosen:
+// util.OuterCacheControlZero (the default), util.OuterCacheControlClamp, or
+// util.OuterCacheControlOverride, with maxAge as the ceiling or value,
+// respectively. It never exceeds the remaining lifetime of the signature.
+func (this *Signer) SetOuterCacheControl(policy string, maxAge time.Duration) {
+	this.outerCacheControl = policy
+	this.outerMaxAge = maxAge
+}
+
+// SetSignContentLanguage sets whether the origin's Content-Language is always
+// signed, as part of the inner response, regardless of SetResponseHeaderPolicy,
+// so that clients and caches see the language of the document as the origin
+// declared it. It is then signed only if it is a well-formed list of language
+// tags; otherwise it is dropped, with a log. By default, it is treated like
+// any other header.
+func (this *Signer) SetSignContentLanguage(enabled bool) {
+	this.signContentLanguage = enabled
+}
+
+// SetTransformerOptions sets the options with which documents are transformed,
+// e.g. to enable transformers that are off by default. They should pass
+// transformer.ValidateOptions. If nil (the default), none are set.
+func (this *Signer) SetTransformerOptions(options *rpb.Request_Options) {
+	this.transformerOptions = options
+}
+
+// canonicalHeaderSet returns the set of the canonical forms of the header
+// names, or nil if there are none.
+func canonicalHeaderSet(names []string) map[string]bool {
+	if len(names) == 0 {
+		return nil
+	}
+	ret := map[string]bool{}
+	for _, name := range names {
+		ret[http.CanonicalHeaderKey(name)] = true
+	}
+	return ret
+}
+
+// signsResponseHeader returns true if the origin's response header with the
+// given canonical name may be signed, per SetResponseHeaderPolicy.
+func (this *Signer) signsResponseHeader(name string) bool {
+	if statefulResponseHeaders[name] || credentialHeaders[name] {
+		return false
+	}
+	if this.signContentLanguage && name == "Content-Language" {
+		return true
+	}
+	if this.strippedResponseHeaders[name] {
+		return false
+	}
+	return this.signedResponseHeaders == nil || this.signedResponseHeaders[name] || name == "Content-Type"
+}
+
+// canonicalURL returns the href of the first <link rel=canonical> in the head
+// of the HTML document, resolved relative to base, or nil if there is none.
+func canonicalURL(doc string, base *url.URL) *url.URL {
+	tokenizer := html.NewTokenizer(strings.NewReader(doc))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.DataAtom {
+			case atom.Body:
+				return nil
+			case atom.Link:
+				var rel, href string
+				hasHref := false
+				for _, attr := range token.Attr {
+					switch attr.Key {
+					case "rel":
+						rel = attr.Val
+					case "href":
+						href, hasHref = attr.Val, true
+					}
+				}
+				if !hasHref {
+					continue
+				}
+				for _, field := range strings.Fields(rel) {
+					if strings.EqualFold(field, "canonical") {
+						u, err := base.Parse(strings.TrimSpace(href))
+						if err != nil {
+							return nil
+						}
+						return u
+					}
+				}
+			}
+		}
+	}
+}
+
+// checkNonHTML returns an error if the fetch response isn't HTML, and the
+// non-HTML policy disallows proxying it.
+func (this *Signer) checkNonHTML(fetchResp *http.Response) *util.HTTPError {
+	if !this.errorOnNonHTML {
+		return nil
+	}
+	contentType := fetchResp.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil {
+		if mediaType == "text/html" {
+			return nil
+		}
+		for _, proxyType := range this.nonHTMLProxyTypes {
+			if strings.EqualFold(proxyType, mediaType) {
+				return nil
+			}
+		}
+	}
+	return util.NewHTTPError(http.StatusBadGateway, "Not packaging because origin Content-Type is ", strconv.Quote(contentType), ", not text/html")
+}
+
+// Fetches the given URL. If host is non-empty, it is sent as the Host header,
+// rather than fetch's host.
+func (this *Signer) fetchURL(fetch *url.URL, host string, serveHTTPReq *http.Request) (*http.Request, *http.Response, *util.HTTPError) {
 	ampURL := fetch.String()
 
 	log.Printf("Fetching URL: %q\n", ampURL)
-	req, err := http.NewRequest(http.MethodGet, ampURL, nil)
+	req, err := http.NewRequestWithContext(serveHTTPReq.Context(), http.MethodGet, ampURL, nil)
 	if err != nil {
 		return nil, nil, util.NewHTTPError(http.StatusInternalServerError, "Error building request: ", err)
 	}
@@ -166,6 +479,9 @@ func (this *Signer) fetchURL(fetch *url.URL, serveHTTPReq *http.Request) (*http.
 			req.Header.Set(header, value)
 		}
 	}
+	if host != "" {
+		req.Host = host
+	}
 	// Golang's HTTP parser appears not to validate the protocol it parses
 	// from the request line, so we do so here.
 	if protocol.MatchString(serveHTTPReq.Proto) {
@@ -195,7 +511,7 @@ func (this *Signer) fetchURL(fetch *url.URL, serveHTTPReq *http.Request) (*http.
 	}
 	resp, err := this.client.Do(req)
 	if err != nil {
-		return nil, nil, util.NewHTTPError(http.StatusBadGateway, "Error fetching: ", err)
+		return nil, nil, upstreamError(req.Context(), "Error fetching: ", err)
 	}
 	util.RemoveHopByHopHeaders(resp.Header)
 	return req, resp, nil
@@ -292,10 +608,19 @@ var promGatewayRequestsLatency = promauto.NewHistogramVec(
 	[]string{"code"},
 )
 
-func (this *Signer) fetchURLAndMeasure(fetch *url.URL, serveHTTPReq *http.Request) (*http.Request, *http.Response, *util.HTTPError) {
+// upstreamError describes a failure to fetch from, or read from, the origin:
+// a 504 if it was due to the request timing out, and otherwise a 502.
+func upstreamError(ctx context.Context, msg string, err error) *util.HTTPError {
+	if ctx.Err() == context.DeadlineExceeded {
+		return util.NewHTTPError(http.StatusGatewayTimeout, msg, err)
+	}
+	return util.NewHTTPError(http.StatusBadGateway, msg, err)
+}
+
+func (this *Signer) fetchURLAndMeasure(fetch *url.URL, host string, serveHTTPReq *http.Request) (*http.Request, *http.Response, *util.HTTPError) {
 	startTime := this.timeNow()
 
-	fetchReq, fetchResp, httpErr := this.fetchURL(fetch, serveHTTPReq)
+	fetchReq, fetchResp, httpErr := this.fetchURL(fetch, host, serveHTTPReq)
 	if httpErr == nil {
 		// httpErr is nil, i.e. the gateway request did succeed. Let Prometheus
 		// observe the gateway request and its latency - along with the response code.
@@ -317,6 +642,10 @@ func (this *Signer) fetchURLAndMeasure(fetch *url.URL, serveHTTPReq *http.Reques
 func (this *Signer) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 	resp.Header().Add("Vary", "Accept, AMP-Cache-Transform")
 
+	ctx, cancel := context.WithTimeout(req.Context(), this.requestTimeout)
+	defer cancel()
+	req = req.WithContext(ctx)
+
 	if err := req.ParseForm(); err != nil {
 		util.NewHTTPError(http.StatusBadRequest, "Form input parsing failed: ", err).LogAndRespond(resp)
 		return
@@ -337,13 +666,24 @@ func (this *Signer) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 		fetch = req.FormValue("fetch")
 		sign = req.FormValue("sign")
 	}
-	fetchURL, signURL, errorOnStatefulHeaders, httpErr := parseURLs(fetch, sign, this.urlSets)
+	fetchURL, signURL, documentURL, urlSet, httpErr := parseURLs(fetch, sign, this.urlSets, this.urlSetMatch == util.URLSetMatchUnique)
 	if httpErr != nil {
-		httpErr.LogAndRespond(resp)
+		if signURL != nil {
+			this.serveUnmatched(resp, req, fetch, signURL, httpErr)
+		} else {
+			httpErr.LogAndRespond(resp)
+		}
 		return
 	}
+	errorOnStatefulHeaders := urlSet.Sign.ErrorOnStatefulHeaders
 
-	fetchReq, fetchResp, httpErr := this.fetchURLAndMeasure(fetchURL, req)
+	// When fetching from an UpstreamBaseURL, identify the public host, so
+	// that the upstream serves the same content as would be served there.
+	fetchHost := ""
+	if fetch == "" && urlSet.UpstreamBaseURL != "" {
+		fetchHost = signURL.Host
+	}
+	fetchReq, fetchResp, httpErr := this.fetchURLAndMeasure(fetchURL, fetchHost, req)
 	if httpErr != nil {
 		httpErr.LogAndRespond(resp)
 		return
@@ -355,7 +695,13 @@ func (this *Signer) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 		}
 	}()
 
-	if err := this.shouldPackage(); err != nil {
+	if err := this.shouldPackage(ctx); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			// The origin's body can no longer be read, so it can't be
+			// proxied either.
+			util.NewHTTPError(http.StatusGatewayTimeout, "Timed out checking whether to package: ", err).LogAndRespond(resp)
+			return
+		}
 		log.Println("Not packaging because server is unhealthy; see above log statements.", err)
 		proxyUnconsumed(resp, fetchResp)
 		return
@@ -387,6 +733,10 @@ func (this *Signer) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 
 	switch fetchResp.StatusCode {
 	case 200:
+		if httpErr := this.checkNonHTML(fetchResp); httpErr != nil {
+			httpErr.LogAndRespond(resp)
+			return
+		}
 		// If fetchURL returns an OK status, then validate, munge, and package.
 		if err := validateFetch(fetchReq, fetchResp); err != nil {
 			log.Println("Not packaging because of invalid fetch: ", err)
@@ -401,7 +751,7 @@ func (this *Signer) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 			}
 		}
 
-		if fetchResp.Header.Get("Variants") != "" || fetchResp.Header.Get("Variant-Key") != "" ||
+		if !urlSet.AllowVariants && (fetchResp.Header.Get("Variants") != "" || fetchResp.Header.Get("Variant-Key") != "") ||
 			// Include versioned headers per https://github.com/WICG/webpackage/pull/406.
 			fetchResp.Header.Get("Variants-04") != "" || fetchResp.Header.Get("Variant-Key-04") != "" {
 			// Variants headers (https://tools.ietf.org/html/draft-ietf-httpbis-variants-04) are disallowed by AMP Cache.
@@ -410,8 +760,15 @@ func (this *Signer) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 			proxyUnconsumed(resp, fetchResp)
 			return
 		}
+		// If allowed, the Variants headers are signed as part of the
+		// response, so that the AMP Cache can choose among variants.
+		if err := validateVariants(fetchResp.Header); err != nil {
+			log.Println("Not packaging because of invalid Variants headers:", err)
+			proxyUnconsumed(resp, fetchResp)
+			return
+		}
 
-		this.consumeAndSign(resp, fetchResp, &SXGParams{signURL, act, transformVersion})
+		this.consumeAndSign(resp, fetchResp, &SXGParams{signURL: signURL, documentURL: documentURL, ampCacheTransformHeader: act, transformVersion: transformVersion})
 
 	case 304:
 		// If fetchURL returns a 304, then also return a 304 with appropriate headers.
@@ -428,6 +785,57 @@ func (this *Signer) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// serveUnmatched responds to a request whose URLs matched no URLSet, per the
+// unmatched URL policy. httpErr describes the mismatch.
+func (this *Signer) serveUnmatched(resp http.ResponseWriter, req *http.Request, fetch string, signURL *url.URL, httpErr *util.HTTPError) {
+	switch this.unmatchedURL {
+	case util.UnmatchedURLNotFound:
+		respondUnmatched(resp, http.StatusNotFound, httpErr)
+	case util.UnmatchedURLForbidden:
+		respondUnmatched(resp, http.StatusForbidden, httpErr)
+	case util.UnmatchedURLProxy:
+		// Only proxy the domains of the URLSets; anything else would make
+		// the packager an open proxy. A separate fetch URL is never
+		// fetched, as it could point anywhere.
+		if fetch != "" || !this.hasSignDomain(signURL.Host) {
+			respondUnmatched(resp, http.StatusNotFound, httpErr)
+			return
+		}
+		log.Println("Proxying unsigned because", httpErr)
+		_, fetchResp, fetchErr := this.fetchURLAndMeasure(signURL, "", req)
+		if fetchErr != nil {
+			fetchErr.LogAndRespond(resp)
+			return
+		}
+		defer func() {
+			if err := fetchResp.Body.Close(); err != nil {
+				log.Println("Error closing fetchResp body:", err)
+			}
+		}()
+		proxyUnconsumed(resp, fetchResp)
+	default:
+		httpErr.LogAndRespond(resp)
+	}
+}
+
+// respondUnmatched responds with the given error status, and a body stating
+// that the URL isn't configured for signing, without the details of httpErr.
+func respondUnmatched(resp http.ResponseWriter, statusCode int, httpErr *util.HTTPError) {
+	log.Println(httpErr)
+	resp.Header().Set("Cache-Control", "no-store")
+	http.Error(resp, http.StatusText(statusCode)+": URL is not configured for signing", statusCode)
+}
+
+// hasSignDomain returns true if domain is that of some URLSet's Sign pattern.
+func (this *Signer) hasSignDomain(domain string) bool {
+	for _, urlSet := range this.urlSets {
+		if urlSet.Sign != nil && urlSet.Sign.Domain == domain {
+			return true
+		}
+	}
+	return false
+}
+
 func formatLinkHeader(preloads []*rpb.Metadata_Preload) (string, error) {
 	var values []string
 	for _, preload := range preloads {
@@ -477,6 +885,10 @@ type SXGParams struct {
 	signURL                 *url.URL
 	ampCacheTransformHeader string
 	transformVersion        int64
+	// The sign URL as requested, before URLSet.TrailingSlash normalization,
+	// i.e. where the fetched document is served, against which its relative
+	// URLs resolve.
+	documentURL *url.URL
 }
 
 // consumedFetchResp stores the fetch response in memory - including the
@@ -489,16 +901,20 @@ type SXGParams struct {
 // the sender to process its payload in reverse order
 // (https://tools.ietf.org/html/draft-thomson-http-mice-03#section-2.1). In an
 // HTTP reverse proxy, this could be done using range requests, but would be
-// inefficient.
+// inefficient. So the upstream body isn't streamed into the SXG, and
+// per-request memory is bounded by SetMaxBodyLength, not SetMIRecordSize; the
+// MI encoding only avoids making further copies of the payload (see
+// miEncodeHeaders).
 type consumedFetchResp struct {
 	body       []byte
 	StatusCode int
 	Header     http.Header
 }
 
-// maxSignableBodyLength is the signable payload length limit. If not hit, the
-// signer will load the payload into consumedFetchResp and sign it. If hit, the
-// signer won't sign the payload, but will proxy it in full by streaming it.
+// maxSignableBodyLength is the default signable payload length limit, per
+// SetMaxBodyLength. If not hit, the signer will load the payload into
+// consumedFetchResp and sign it. If hit, the signer won't sign the payload, but
+// will proxy it in full by streaming it.
 // This way the signer limits per-request memory usage, making amppackager more
 // predictable provisioning-wise. The limit is mostly arbitrary, though there's
 // no benefit to having a limit greater than that of AMP Caches.
@@ -506,21 +922,56 @@ const maxSignableBodyLength = 4 * 1 << 20
 
 func (this *Signer) consumeAndSign(resp http.ResponseWriter, fetchResp *http.Response, params *SXGParams) {
 	// Cap in order to limit per-request memory usage.
-	fetchBodyMaybeCapped, err := ioutil.ReadAll(io.LimitReader(fetchResp.Body, maxSignableBodyLength))
+	fetchBodyMaybeCapped, err := ioutil.ReadAll(io.LimitReader(fetchResp.Body, int64(this.maxBodyLength)))
 	if err != nil {
-		util.NewHTTPError(http.StatusBadGateway, "Error reading body: ", err).LogAndRespond(resp)
+		upstreamError(fetchResp.Request.Context(), "Error reading body: ", err).LogAndRespond(resp)
 		return
 	}
 
-	if len(fetchBodyMaybeCapped) == maxSignableBodyLength {
-		// Body was too long and has been capped. Fallback to proxying.
-		log.Println("Not packaging because the document size hit the limit of ", strconv.Itoa(maxSignableBodyLength), " bytes.")
+	if len(fetchBodyMaybeCapped) == this.maxBodyLength {
+		// Body was too long and has been capped. Fallback to proxying,
+		// unless configured to error.
+		if this.errorOnOversizedBody {
+			this.oversizedBodyError("document").LogAndRespond(resp)
+			return
+		}
+		log.Println("Not packaging because the document size hit the limit of ", strconv.Itoa(this.maxBodyLength), " bytes.")
 		proxyPartiallyConsumed(resp, fetchResp, fetchBodyMaybeCapped)
 	} else {
 		// Body has been consumed fully. OK to proceed.
 		this.serveSignedExchange(resp, consumedFetchResp{fetchBodyMaybeCapped, fetchResp.StatusCode, fetchResp.Header}, params)
 	}
+}
 
+// oversizedBodyError returns the error with which to respond to an oversized
+// document, when configured to error rather than proxy.
+func (this *Signer) oversizedBodyError(what string) *util.HTTPError {
+	return util.NewHTTPError(http.StatusBadGateway, "Not packaging because the ", what, " size hit the limit of ", strconv.Itoa(this.maxBodyLength), " bytes")
+}
+
+// ampValidator is the AMP validator run by checkAMPValidity; a var so that
+// tests can simulate its failure.
+var ampValidator = validator.Validate
+
+// checkAMPValidity returns the error with which to respond if the transformed
+// document shouldn't be signed, per SetAMPValidation.
+func (this *Signer) checkAMPValidity(transformed string, signURL *url.URL) *util.HTTPError {
+	problems, err := ampValidator(transformed)
+	if err != nil {
+		if this.validatorFailOpen {
+			log.Printf("Signing %s without AMP validation, due to validator error: %s", signURL, err)
+			return nil
+		}
+		return util.NewHTTPError(http.StatusBadGateway, "Not packaging due to AMP validator error: ", err)
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	if this.signInvalidAMP {
+		log.Printf("Signing %s despite AMP validation errors: %s", signURL, strings.Join(problems, "; "))
+		return nil
+	}
+	return util.NewHTTPError(http.StatusBadGateway, "Not packaging because the transformed document is invalid AMP: ", strings.Join(problems, "; "))
 }
 
 var promSignedAmpDocumentsSize = promauto.NewHistogramVec(
@@ -548,14 +999,35 @@ var promDocumentsSignedVsUnsigned = promauto.NewCounterVec(
 func (this *Signer) serveSignedExchange(resp http.ResponseWriter, fetchResp consumedFetchResp, params *SXGParams) {
 	// Perform local transformations, as required by AMP SXG caches, per
 	// docs/cache_requirements.md.
-	r := getTransformerRequest(this.rtvCache, string(fetchResp.body), params.signURL.String())
+	r := getTransformerRequest(this.rtvCache, string(fetchResp.body), params.documentURL.String())
 	r.Version = params.transformVersion
-	transformed, metadata, err := transformer.Process(r)
+	r.Options = this.transformerOptions
+	transformed, metadata, warnings, err := transformer.ProcessWithWarnings(r)
 	if err != nil {
 		log.Println("Not packaging due to transformer error:", err)
 		proxyConsumed(resp, fetchResp)
 		return
 	}
+	for _, warning := range warnings {
+		log.Printf("Transformer warning for %s: %s", params.signURL, warning)
+	}
+	// The transforms may add to the document, e.g. its boilerplate, so the
+	// limit is checked again.
+	if len(transformed) >= this.maxBodyLength {
+		if this.errorOnOversizedBody {
+			this.oversizedBodyError("transformed document").LogAndRespond(resp)
+			return
+		}
+		log.Println("Not packaging because the transformed document size hit the limit of ", strconv.Itoa(this.maxBodyLength), " bytes.")
+		proxyConsumed(resp, fetchResp)
+		return
+	}
+	if this.validateAMP {
+		if httpErr := this.checkAMPValidity(transformed, params.signURL); httpErr != nil {
+			httpErr.LogAndRespond(resp)
+			return
+		}
+	}
 
 	// Validate and format Link header.
 	linkHeader, err := formatLinkHeader(metadata.Preloads)
@@ -565,12 +1037,22 @@ func (this *Signer) serveSignedExchange(resp http.ResponseWriter, fetchResp cons
 		return
 	}
 
+	// Before any of the origin's headers are stripped.
+	originMaxAge := originMaxAge(fetchResp.Header)
+
 	// Begin mutations on original fetch response. From this point forward, do
 	// not fall-back to proxy().
 
-	// Remove stateful headers.
-	for header := range statefulResponseHeaders {
-		fetchResp.Header.Del(header)
+	// Remove stateful headers, and any others disallowed by the response
+	// header policy.
+	for header := range fetchResp.Header {
+		if !this.signsResponseHeader(header) {
+			fetchResp.Header.Del(header)
+		}
+	}
+	if contentLanguage := GetJoined(fetchResp.Header, "Content-Language"); this.signContentLanguage && contentLanguage != "" && !languageTags.MatchString(contentLanguage) {
+		log.Printf("Not signing malformed Content-Language %q\n", contentLanguage)
+		fetchResp.Header.Del("Content-Language")
 	}
 
 	// Set Link header if formatting returned a valid value, otherwise, delete
@@ -586,6 +1068,9 @@ func (this *Signer) serveSignedExchange(resp http.ResponseWriter, fetchResp cons
 
 	// Set general security headers.
 	fetchResp.Header.Set("X-Content-Type-Options", "nosniff")
+	if this.referrerPolicy != "" {
+		fetchResp.Header.Set("Referrer-Policy", this.referrerPolicy)
+	}
 
 	// Mutate the fetched CSP to make sure it cannot break AMP pages.
 	fetchResp.Header.Set(
@@ -597,8 +1082,13 @@ func (this *Signer) serveSignedExchange(resp http.ResponseWriter, fetchResp cons
 		accept.SxgVersion,
 		/*uri=*/ params.signURL.String(),
 		/*method=*/ "GET",
-		http.Header{}, fetchResp.StatusCode, fetchResp.Header, []byte(transformed))
-	if err := exchange.MiEncodePayload(miRecordSize); err != nil {
+		http.Header{}, fetchResp.StatusCode, fetchResp.Header, nil)
+	// Rather than exchange.MiEncodePayload, which builds an MI-encoded copy
+	// of the payload, only the integrity proofs are computed here, and the
+	// encoding is read out of the (in-memory) payload after the exchange
+	// headers are written.
+	payload, err := miEncodeHeaders(exchange, []byte(transformed), this.miRecordSize)
+	if err != nil {
 		log.Printf("Error MI-encoding: %s\n", err)
 		proxyConsumed(resp, fetchResp)
 		return
@@ -618,19 +1108,31 @@ func (this *Signer) serveSignedExchange(resp http.ResponseWriter, fetchResp cons
 		proxyConsumed(resp, fetchResp)
 		return
 	}
-	// Expires - Date must be <= 604800 seconds, per
-	// https://tools.ietf.org/html/draft-yasskin-httpbis-origin-signed-exchanges-impl-00#section-3.5.
-	duration := 7 * 24 * time.Hour
+	duration := this.signatureDuration
+	backdate := maxSignatureBackdate
+	if duration/2 < backdate {
+		backdate = duration / 2
+	}
 	if maxAge := time.Duration(metadata.MaxAgeSecs) * time.Second; maxAge < duration {
 		duration = maxAge
 	}
-	date := now.Add(-24 * time.Hour)
+	date := now.Add(-backdate)
 	expires := date.Add(duration)
 	if !expires.After(now) {
 		log.Printf("Not packaging because computed max-age %d places expiry in the past\n", metadata.MaxAgeSecs)
 		proxyConsumed(resp, fetchResp)
 		return
 	}
+	// The signature must not outlive the OCSP response stapled to the cert
+	// chain, as clients will reject the SXG once the OCSP is stale.
+	if ocspExpiry := this.certHandler.GetOCSPExpiry(); !ocspExpiry.IsZero() && ocspExpiry.Before(expires) {
+		expires = ocspExpiry
+		if !expires.After(now) {
+			log.Printf("Not packaging because OCSP NextUpdate %v is in the past\n", ocspExpiry)
+			proxyConsumed(resp, fetchResp)
+			return
+		}
+	}
 	signer := signedexchange.Signer{
 		Date:        date,
 		Expires:     expires,
@@ -642,13 +1144,13 @@ func (this *Signer) serveSignedExchange(resp http.ResponseWriter, fetchResp cons
 		// default is to use getrandom(2) if available, else
 		// /dev/urandom.
 	}
-	if err := exchange.AddSignatureHeader(&signer); err != nil {
+	if err := addSignatureHeader(exchange, &signer); err != nil {
 		log.Printf("Error signing exchange: %s\n", err)
 		proxyConsumed(resp, fetchResp)
 		return
 	}
-	var body bytes.Buffer
-	if err := exchange.Write(&body); err != nil {
+	var headers bytes.Buffer
+	if err := exchange.Write(&headers); err != nil {
 		log.Printf("Error serializing exchange: %s\n", err)
 		proxyConsumed(resp, fetchResp)
 		return
@@ -662,18 +1164,25 @@ func (this *Signer) serveSignedExchange(resp http.ResponseWriter, fetchResp cons
 	}
 
 	resp.Header().Set("Content-Type", accept.SxgContentType)
-	// We set a zero freshness lifetime on the SXG, so that naive caching
-	// intermediaries won't inhibit the update of this resource on AMP
-	// caches. AMP caches are recommended to base their update strategies
-	// on a combination of inner and outer resource lifetime.
-	//
-	// If you change this code to set a Cache-Control based on the inner
-	// resource, you need to ensure that its max-age is no longer than the
-	// lifetime of the signature (6 days, per above). Maybe an even tighter
-	// bound than that, based on data about client clock skew.
-	resp.Header().Set("Cache-Control", "no-transform, max-age=0")
+	if this.canonicalLinkHeader {
+		if canonical := canonicalURL(transformed, params.documentURL); canonical != nil {
+			// As in formatLinkHeader, escape the query's invalid characters.
+			canonical.RawQuery = url.PathEscape(canonical.RawQuery)
+			resp.Header().Set("Link", "<"+canonical.String()+`>;rel=canonical`)
+		}
+	}
+	// By default, we set a zero freshness lifetime on the SXG, so that
+	// naive caching intermediaries won't inhibit the update of this
+	// resource on AMP caches. AMP caches are recommended to base their
+	// update strategies on a combination of inner and outer resource
+	// lifetime.
+	resp.Header().Set("Cache-Control", "no-transform, max-age="+strconv.Itoa(int(this.outerMaxAgeFor(originMaxAge, expires.Sub(now)).Seconds())))
 	resp.Header().Set("X-Content-Type-Options", "nosniff")
-	if _, err := resp.Write(body.Bytes()); err != nil {
+	if _, err := resp.Write(headers.Bytes()); err != nil {
+		log.Println("Error writing response:", err)
+		return
+	}
+	if _, err := io.Copy(resp, payload); err != nil {
 		log.Println("Error writing response:", err)
 		return
 	}
@@ -682,6 +1191,59 @@ func (this *Signer) serveSignedExchange(resp http.ResponseWriter, fetchResp cons
 	promDocumentsSignedVsUnsigned.WithLabelValues("signed").Inc()
 }
 
+// outerMaxAgeFor returns the max-age of the outer SXG response, per
+// SetOuterCacheControl, given that of the origin's response, per originMaxAge,
+// and the remaining lifetime of the signature, which it never exceeds.
+func (this *Signer) outerMaxAgeFor(originMaxAge, lifetime time.Duration) time.Duration {
+	var maxAge time.Duration
+	switch this.outerCacheControl {
+	case util.OuterCacheControlClamp:
+		maxAge = originMaxAge
+		if this.outerMaxAge > 0 && maxAge > this.outerMaxAge {
+			maxAge = this.outerMaxAge
+		}
+	case util.OuterCacheControlOverride:
+		maxAge = this.outerMaxAge
+	}
+	if maxAge > lifetime {
+		maxAge = lifetime
+	}
+	if maxAge < 0 {
+		maxAge = 0
+	}
+	return maxAge
+}
+
+// originMaxAge returns the freshness lifetime that the origin's Cache-Control
+// allows shared caches: its s-maxage, else its max-age, or zero if it has
+// neither. (Responses that forbid caching aren't signed.)
+func originMaxAge(header http.Header) time.Duration {
+	var maxAge, sMaxAge int64 = -1, -1
+	for _, directive := range strings.Split(GetJoined(header, "Cache-Control"), ",") {
+		name, value := strings.TrimSpace(directive), ""
+		if i := strings.IndexByte(name, '='); i >= 0 {
+			name, value = strings.TrimSpace(name[:i]), strings.Trim(strings.TrimSpace(name[i+1:]), `"`)
+		}
+		switch strings.ToLower(name) {
+		case "max-age":
+			if seconds, err := strconv.ParseInt(value, 10, 32); err == nil && seconds >= 0 {
+				maxAge = seconds
+			}
+		case "s-maxage":
+			if seconds, err := strconv.ParseInt(value, 10, 32); err == nil && seconds >= 0 {
+				sMaxAge = seconds
+			}
+		}
+	}
+	switch {
+	case sMaxAge >= 0:
+		return time.Duration(sMaxAge) * time.Second
+	case maxAge >= 0:
+		return time.Duration(maxAge) * time.Second
+	}
+	return 0
+}
+
 func proxyUnconsumed(resp http.ResponseWriter, fetchResp *http.Response) {
 	proxyImpl(resp, fetchResp.Header, fetchResp.StatusCode,
 		/* consumedPrefix= */ nil,
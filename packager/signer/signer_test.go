@@ -16,20 +16,26 @@ package signer
 
 import (
 	"bytes"
+	"context"
+	"crypto"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/binary"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/WICG/webpackage/go/signedexchange"
+	"github.com/WICG/webpackage/go/signedexchange/certurl"
 	"github.com/WICG/webpackage/go/signedexchange/structuredheader"
 	"github.com/ampproject/amppackager/packager/accept"
 	"github.com/ampproject/amppackager/packager/mux"
@@ -60,12 +66,17 @@ func headerNames(headers http.Header) []string {
 }
 
 type fakeCertHandler struct {
+	ocspExpiry time.Time
 }
 
 func (this fakeCertHandler) GetLatestCert() *x509.Certificate {
 	return pkgt.Certs[0]
 }
 
+func (this fakeCertHandler) GetOCSPExpiry() time.Time {
+	return this.ocspExpiry
+}
+
 func (this fakeCertHandler) IsHealthy() error {
 	return nil
 }
@@ -78,16 +89,50 @@ type SignerSuite struct {
 	fakeHandler           func(resp http.ResponseWriter, req *http.Request)
 	lastRequest           *http.Request
 	fakeClock             *pkgt.FakeClock
+	key                   crypto.PrivateKey
+	ocspExpiry            time.Time
+	referrerPolicy        string
+	errorOnNonHTML        bool
+	nonHTMLProxyTypes     []string
+	canonicalLinkHeader   bool
+	signatureDuration     time.Duration
+	miRecordSize          int
+	maxBodyLength         int
+	errorOnOversizedBody  bool
+	signedHeaders         []string
+	strippedHeaders       []string
+	signContentLanguage   bool
+	unmatchedURL          string
+	validateAMP           bool
+	signInvalidAMP        bool
+	validatorFailOpen     bool
+	requestTimeout        time.Duration
+	outerCacheControl     string
+	outerMaxAge           time.Duration
+	transformerOptions    *rpb.Request_Options
 }
 
 func (this *SignerSuite) new(urlSets []util.URLSet) http.Handler {
 	forwardedRequestHeaders := []string{"Host", "X-Foo"}
 	this.fakeClock = pkgt.NewFakeClock()
-	handler, err := New(fakeCertHandler{}, pkgt.Key, urlSets, &rtv.RTVCache{}, func() error { return this.shouldPackage }, nil, true, forwardedRequestHeaders, this.fakeClock.Now)
+	handler, err := New(fakeCertHandler{this.ocspExpiry}, this.key, urlSets, &rtv.RTVCache{}, func(context.Context) error { return this.shouldPackage }, nil, true, forwardedRequestHeaders, this.fakeClock.Now)
 	this.Require().NoError(err)
+	handler.SetReferrerPolicy(this.referrerPolicy)
+	handler.SetNonHTMLPolicy(this.errorOnNonHTML, this.nonHTMLProxyTypes)
+	handler.SetCanonicalLinkHeader(this.canonicalLinkHeader)
+	handler.SetSignatureDuration(this.signatureDuration)
+	handler.SetMIRecordSize(this.miRecordSize)
+	handler.SetMaxBodyLength(this.maxBodyLength, this.errorOnOversizedBody)
+	handler.SetResponseHeaderPolicy(this.signedHeaders, this.strippedHeaders)
+	handler.SetSignContentLanguage(this.signContentLanguage)
+	handler.SetUnmatchedURLPolicy(this.unmatchedURL)
+	handler.SetAMPValidation(this.validateAMP, this.signInvalidAMP, this.validatorFailOpen)
+	handler.SetRequestTimeout(this.requestTimeout)
+	handler.SetOuterCacheControl(this.outerCacheControl, this.outerMaxAge)
+	handler.SetTransformerOptions(this.transformerOptions)
 	// Accept the self-signed certificate generated by the test server.
 	handler.client = this.httpsClient
-	return mux.New(nil, handler, nil, nil, nil)
+	return mux.New(mux.Handlers{Signer: handler})
 }
 
 func (this *SignerSuite) httpURL() string {
@@ -150,6 +195,27 @@ func (this *SignerSuite) TearDownSuite() {
 
 func (this *SignerSuite) SetupTest() {
 	this.shouldPackage = nil
+	this.key = pkgt.Key
+	this.ocspExpiry = time.Time{}
+	this.referrerPolicy = ""
+	this.errorOnNonHTML = false
+	this.nonHTMLProxyTypes = nil
+	this.canonicalLinkHeader = false
+	this.signatureDuration = 0
+	this.miRecordSize = 0
+	this.maxBodyLength = 0
+	this.errorOnOversizedBody = false
+	this.signedHeaders = nil
+	this.strippedHeaders = nil
+	this.signContentLanguage = false
+	this.unmatchedURL = ""
+	this.validateAMP = false
+	this.signInvalidAMP = false
+	this.validatorFailOpen = false
+	this.requestTimeout = 0
+	this.outerCacheControl = ""
+	this.outerMaxAge = 0
+	this.transformerOptions = nil
 	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
 		this.lastRequest = req
 		resp.Header().Set("Content-Type", "text/html")
@@ -164,8 +230,8 @@ func (this *SignerSuite) SetupTest() {
 
 func (this *SignerSuite) TestSimple() {
 	urlSets := []util.URLSet{{
-		Sign:  &util.URLPattern{[]string{"https"}, "", this.httpHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil},
-		Fetch: &util.URLPattern{[]string{"http"}, "", this.httpHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, boolPtr(true)},
+		Sign:  &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
+		Fetch: &util.URLPattern{Scheme: []string{"http"}, Domain: this.httpHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000, SamePath: boolPtr(true)},
 	}}
 	target := "/priv/doc?fetch=" + url.QueryEscape(this.httpURL()+fakePath) + "&sign=" + url.QueryEscape(this.httpSignURL()+fakePath)
 	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
@@ -211,14 +277,181 @@ func (this *SignerSuite) TestSimple() {
 
 	// For small enough bodies, the only thing that MICE does is add a record size prefix.
 	var payloadPrefix bytes.Buffer
-	binary.Write(&payloadPrefix, binary.BigEndian, uint64(miRecordSize))
+	binary.Write(&payloadPrefix, binary.BigEndian, uint64(maxMIRecordSize))
 	this.Assert().Equal(append(payloadPrefix.Bytes(), transformedBody...), exchange.Payload)
 }
 
+func (this *SignerSuite) TestReferrerPolicy() {
+	urlSets := []util.URLSet{{
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
+	}}
+	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set("Content-Type", "text/html")
+		resp.Header().Set("Referrer-Policy", "unsafe-url")
+		resp.Write(fakeBody)
+	}
+	this.referrerPolicy = "no-referrer"
+	resp := pkgt.NewRequest(this.T(), this.new(urlSets), "/priv/doc?sign="+url.QueryEscape(this.httpsURL()+fakePath)).SetHeaders("", header).Do()
+	this.Require().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+
+	exchange, err := signedexchange.ReadExchange(resp.Body)
+	this.Require().NoError(err)
+	this.Assert().Equal([]string{"no-referrer"}, exchange.ResponseHeaders["Referrer-Policy"])
+
+	// The header is covered by the signature.
+	var certChain bytes.Buffer
+	this.Require().NoError(certurl.CertChain{{Cert: pkgt.Certs[0], OCSPResponse: []byte("ocsp")}}.Write(&certChain))
+	fetchCertChain := func(string) ([]byte, error) { return certChain.Bytes(), nil }
+	logger := log.New(ioutil.Discard, "", 0)
+	_, ok := exchange.Verify(this.fakeClock.Now(), fetchCertChain, logger)
+	this.Assert().True(ok)
+	exchange.ResponseHeaders.Set("Referrer-Policy", "unsafe-url")
+	_, ok = exchange.Verify(this.fakeClock.Now(), fetchCertChain, logger)
+	this.Assert().False(ok)
+}
+
+func (this *SignerSuite) TestKeySigner() {
+	urlSets := []util.URLSet{{
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
+	}}
+	// A crypto.Signer other than *ecdsa.PrivateKey, as from a KMS.
+	signer := &pkgt.FakeSigner{Key: pkgt.Key.(crypto.Signer)}
+	this.key = signer
+	resp := pkgt.NewRequest(this.T(), this.new(urlSets), "/priv/doc?sign="+url.QueryEscape(this.httpsURL()+fakePath)).SetHeaders("", header).Do()
+	this.Require().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+	this.Assert().Equal(1, signer.Signs())
+
+	exchange, err := signedexchange.ReadExchange(resp.Body)
+	this.Require().NoError(err)
+	this.Assert().Contains(exchange.SignatureHeaderValue, "integrity=\"digest/mi-sha256-03\"")
+	this.Assert().Contains(exchange.SignatureHeaderValue, "cert-url=\""+this.httpsURL()+"/amppkg/cert/"+pkgt.CertName+"\"")
+
+	var certChain bytes.Buffer
+	this.Require().NoError(certurl.CertChain{{Cert: pkgt.Certs[0], OCSPResponse: []byte("ocsp")}}.Write(&certChain))
+	fetchCertChain := func(string) ([]byte, error) { return certChain.Bytes(), nil }
+	logger := log.New(ioutil.Discard, "", 0)
+	_, ok := exchange.Verify(this.fakeClock.Now(), fetchCertChain, logger)
+	this.Assert().True(ok)
+	exchange.ResponseHeaders.Set("Content-Type", "text/plain")
+	_, ok = exchange.Verify(this.fakeClock.Now(), fetchCertChain, logger)
+	this.Assert().False(ok)
+}
+
+func (this *SignerSuite) TestReferrerPolicyUnset() {
+	urlSets := []util.URLSet{{
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
+	}}
+	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set("Content-Type", "text/html")
+		resp.Header().Set("Referrer-Policy", "same-origin")
+		resp.Write(fakeBody)
+	}
+	resp := pkgt.NewRequest(this.T(), this.new(urlSets), "/priv/doc?sign="+url.QueryEscape(this.httpsURL()+fakePath)).SetHeaders("", header).Do()
+	this.Require().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+
+	exchange, err := signedexchange.ReadExchange(resp.Body)
+	this.Require().NoError(err)
+	this.Assert().Equal("same-origin", exchange.ResponseHeaders.Get("Referrer-Policy"))
+}
+
+func (this *SignerSuite) TestCanonicalLinkHeader() {
+	urlSets := []util.URLSet{{
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
+	}}
+	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set("Content-Type", "text/html")
+		resp.Write([]byte(`<html amp><head><link rel="preconnect" href="https://example.com/"><LINK REL="Canonical" href=" /canonical?a=b c "></head><body><link rel=canonical href="/not-this"></body></html>`))
+	}
+	this.canonicalLinkHeader = true
+	resp := pkgt.NewRequest(this.T(), this.new(urlSets), "/priv/doc?sign="+url.QueryEscape(this.httpsURL()+fakePath)).SetHeaders("", header).Do()
+	this.Require().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+	this.Assert().Equal([]string{"<" + this.httpsURL() + `/canonical?a=b%20c>;rel=canonical`}, resp.Header["Link"])
+
+	// The inner response is unaffected.
+	exchange, err := signedexchange.ReadExchange(resp.Body)
+	this.Require().NoError(err)
+	this.Assert().NotContains(exchange.ResponseHeaders.Get("Link"), "canonical")
+}
+
+func (this *SignerSuite) TestTransformerOptions() {
+	urlSets := []util.URLSet{{
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
+	}}
+	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set("Content-Type", "text/html")
+		resp.Write([]byte(`<html amp><head><style amp-custom>/* a */p{color:red}</style></head><body></body></html>`))
+	}
+	getTransformerRequest = func(r *rtv.RTVCache, s, u string) *rpb.Request {
+		return &rpb.Request{Html: string(s), DocumentUrl: u, Config: rpb.Request_CUSTOM, Transformers: []string{"stripcsscomments"},
+			AllowedFormats: []rpb.Request_HtmlFormat{rpb.Request_AMP}}
+	}
+	target := "/priv/doc?sign=" + url.QueryEscape(this.httpsURL()+fakePath)
+
+	// By default, StripCSSComments is a no-op.
+	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+	this.Require().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+	exchange, err := signedexchange.ReadExchange(resp.Body)
+	this.Require().NoError(err)
+	this.Assert().Contains(string(exchange.Payload), "/* a */")
+
+	this.transformerOptions = &rpb.Request_Options{StripCssComments: true}
+	resp = pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+	this.Require().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+	exchange, err = signedexchange.ReadExchange(resp.Body)
+	this.Require().NoError(err)
+	this.Assert().NotContains(string(exchange.Payload), "/* a */")
+	this.Assert().Contains(string(exchange.Payload), "p{color:red}")
+}
+
+func (this *SignerSuite) TestTrailingSlashTransformsAgainstRequestedURL() {
+	urlSets := []util.URLSet{{
+		Sign:          &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
+		TrailingSlash: "remove",
+	}}
+	var documentURL string
+	getTransformerRequest = func(r *rtv.RTVCache, s, u string) *rpb.Request {
+		documentURL = u
+		return &rpb.Request{Html: string(s), DocumentUrl: u, Config: rpb.Request_NONE,
+			AllowedFormats: []rpb.Request_HtmlFormat{rpb.Request_AMP}}
+	}
+	resp := pkgt.NewRequest(this.T(), this.new(urlSets), "/priv/doc?sign="+url.QueryEscape(this.httpsURL()+"/amp/dir/")).SetHeaders("", header).Do()
+	this.Require().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+
+	// The document's relative URLs resolve against where it was fetched
+	// from, though it is signed under the normalized URL.
+	this.Assert().Equal(this.httpsURL()+"/amp/dir/", documentURL)
+	exchange, err := signedexchange.ReadExchange(resp.Body)
+	this.Require().NoError(err)
+	this.Assert().Equal(this.httpsURL()+"/amp/dir", exchange.RequestURI)
+}
+
+func (this *SignerSuite) TestCanonicalLinkHeaderAbsent() {
+	urlSets := []util.URLSet{{
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
+	}}
+	canonicalBody := []byte(`<html amp><head><link rel=canonical href="https://example.com/"></head><body></body></html>`)
+	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set("Content-Type", "text/html")
+		resp.Write(canonicalBody)
+	}
+
+	// Disabled.
+	resp := pkgt.NewRequest(this.T(), this.new(urlSets), "/priv/doc?sign="+url.QueryEscape(this.httpsURL()+fakePath)).SetHeaders("", header).Do()
+	this.Require().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+	this.Assert().Empty(resp.Header.Get("Link"))
+
+	// Enabled, but the document has no canonical URL.
+	canonicalBody = fakeBody
+	this.canonicalLinkHeader = true
+	resp = pkgt.NewRequest(this.T(), this.new(urlSets), "/priv/doc?sign="+url.QueryEscape(this.httpsURL()+fakePath)).SetHeaders("", header).Do()
+	this.Require().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+	this.Assert().Empty(resp.Header.Get("Link"))
+}
+
 func (this *SignerSuite) TestFetchSignWithForwardedRequestHeaders() {
 	urlSets := []util.URLSet{{
-		Sign:  &util.URLPattern{[]string{"https"}, "", this.certSubjectCN(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil},
-		Fetch: &util.URLPattern{[]string{"http"}, "", this.httpHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, boolPtr(true)},
+		Sign:  &util.URLPattern{Scheme: []string{"https"}, Domain: this.certSubjectCN(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
+		Fetch: &util.URLPattern{Scheme: []string{"http"}, Domain: this.httpHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000, SamePath: boolPtr(true)},
 	}}
 	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
 		// Host and X-Foo headers are forwarded with forwardedRequestHeaders
@@ -259,14 +492,14 @@ func (this *SignerSuite) TestFetchSignWithForwardedRequestHeaders() {
 	certHash, _ := base64.RawURLEncoding.DecodeString(pkgt.CertName)
 	this.Assert().Contains(exchange.SignatureHeaderValue, "cert-sha256=*"+base64.StdEncoding.EncodeToString(certHash[:])+"*")
 	var payloadPrefix bytes.Buffer
-	binary.Write(&payloadPrefix, binary.BigEndian, uint64(miRecordSize))
+	binary.Write(&payloadPrefix, binary.BigEndian, uint64(maxMIRecordSize))
 	this.Assert().Equal(append(payloadPrefix.Bytes(), transformedBody...), exchange.Payload)
 }
 
 func (this *SignerSuite) TestForwardedHost() {
 	urlSets := []util.URLSet{{
-		Sign:  &util.URLPattern{[]string{"https"}, "", this.httpHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil},
-		Fetch: &util.URLPattern{[]string{"http"}, "", this.httpHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, boolPtr(true)},
+		Sign:  &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
+		Fetch: &util.URLPattern{Scheme: []string{"http"}, Domain: this.httpHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000, SamePath: boolPtr(true)},
 	}}
 	header := http.Header{
 		"AMP-Cache-Transform": {"google"}, "Accept": {"application/signed-exchange;v=" + accept.AcceptedSxgVersion},
@@ -283,8 +516,8 @@ func (this *SignerSuite) TestForwardedHost() {
 
 func (this *SignerSuite) TestEscapeQueryParamsInFetchAndSign() {
 	urlSets := []util.URLSet{{
-		Sign:  &util.URLPattern{[]string{"https"}, "", this.httpHost(), stringPtr("/amp/.*"), []string{}, stringPtr(".*"), false, 2000, nil},
-		Fetch: &util.URLPattern{[]string{"http"}, "", this.httpHost(), stringPtr("/amp/.*"), []string{}, stringPtr(".*"), false, 2000, boolPtr(true)},
+		Sign:  &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(".*"), MaxLength: 2000},
+		Fetch: &util.URLPattern{Scheme: []string{"http"}, Domain: this.httpHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(".*"), MaxLength: 2000, SamePath: boolPtr(true)},
 	}}
 	target := "/priv/doc?fetch=" + url.QueryEscape(this.httpURL()+fakePath+"?<hi>") + "&sign=" + url.QueryEscape(this.httpSignURL()+fakePath+"?<hi>")
 	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
@@ -298,8 +531,8 @@ func (this *SignerSuite) TestEscapeQueryParamsInFetchAndSign() {
 
 func (this *SignerSuite) TestMissingFetchParam() {
 	urlSets := []util.URLSet{{
-		Sign:  &util.URLPattern{[]string{"https"}, "", this.httpHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil},
-		Fetch: &util.URLPattern{[]string{"http"}, "", this.httpHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, boolPtr(true)},
+		Sign:  &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
+		Fetch: &util.URLPattern{Scheme: []string{"http"}, Domain: this.httpHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000, SamePath: boolPtr(true)},
 	}}
 	target := "/priv/doc?sign=" + url.QueryEscape(this.httpSignURL()+fakePath)
 	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
@@ -308,8 +541,8 @@ func (this *SignerSuite) TestMissingFetchParam() {
 
 func (this *SignerSuite) TestMissingSignParam() {
 	urlSets := []util.URLSet{{
-		Sign:  &util.URLPattern{[]string{"https"}, "", this.httpHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil},
-		Fetch: &util.URLPattern{[]string{"http"}, "", this.httpHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, boolPtr(true)},
+		Sign:  &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
+		Fetch: &util.URLPattern{Scheme: []string{"http"}, Domain: this.httpHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000, SamePath: boolPtr(true)},
 	}}
 	target := "/priv/doc?fetch=" + url.QueryEscape(this.httpURL()+fakePath)
 	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
@@ -318,16 +551,28 @@ func (this *SignerSuite) TestMissingSignParam() {
 
 func (this *SignerSuite) TestDisallowInvalidCharsSign() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil},
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
 	}}
 	target := "/priv/doc?&sign=" + url.QueryEscape(this.httpSignURL()+fakePath+"<hi>")
 	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
 	this.Assert().Equal(http.StatusBadRequest, resp.StatusCode, "incorrect status: %#v", resp)
 }
 
+func (this *SignerSuite) TestDisallowHTTPSign() {
+	this.lastRequest = nil
+	urlSets := []util.URLSet{{
+		Sign:  &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
+		Fetch: &util.URLPattern{Scheme: []string{"http"}, Domain: this.httpHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000, SamePath: boolPtr(true)},
+	}}
+	target := "/priv/doc?fetch=" + url.QueryEscape(this.httpURL()+fakePath) + "&sign=" + url.QueryEscape(this.httpURL()+fakePath)
+	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+	this.Assert().Equal(http.StatusBadRequest, resp.StatusCode, "incorrect status: %#v", resp)
+	this.Assert().Nil(this.lastRequest, "fetched despite http sign URL")
+}
+
 func (this *SignerSuite) TestNoFetchParam() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil}}}
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
 	target := "/priv/doc?sign=" + url.QueryEscape(this.httpsURL()+fakePath)
 	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
 	this.Assert().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
@@ -338,9 +583,28 @@ func (this *SignerSuite) TestNoFetchParam() {
 	this.Assert().Equal(this.httpsURL()+fakePath, exchange.RequestURI)
 }
 
+func (this *SignerSuite) TestSignWithUpstreamBaseURL() {
+	urlSets := []util.URLSet{{
+		Sign:            &util.URLPattern{Scheme: []string{"https"}, Domain: this.certSubjectCN(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
+		UpstreamBaseURL: this.httpURL(),
+	}}
+	signURL := "https://" + this.certSubjectCN() + fakePath
+	resp := pkgt.NewRequest(this.T(), this.new(urlSets), "/priv/doc?sign="+url.QueryEscape(signURL)).SetHeaders("", header).Do()
+	this.Assert().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+
+	// The fetch went to the internal server, identifying the public host.
+	this.Require().NotNil(this.lastRequest)
+	this.Assert().Equal(fakePath, this.lastRequest.URL.String())
+	this.Assert().Equal(this.certSubjectCN(), this.lastRequest.Host)
+
+	exchange, err := signedexchange.ReadExchange(resp.Body)
+	this.Require().NoError(err)
+	this.Assert().Equal(signURL, exchange.RequestURI)
+}
+
 func (this *SignerSuite) TestSignAsPathParam() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil},
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
 	}}
 	target := `/priv/doc/` + this.httpsURL() + fakePath
 	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
@@ -354,7 +618,7 @@ func (this *SignerSuite) TestSignAsPathParam() {
 
 func (this *SignerSuite) TestSignAsPathParamWithQuery() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(".*"), false, 2000, nil},
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(".*"), MaxLength: 2000},
 	}}
 	target := `/priv/doc/` + this.httpsURL() + fakePath + "?amp=1"
 	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
@@ -369,7 +633,7 @@ func (this *SignerSuite) TestSignAsPathParamWithQuery() {
 // Ensure that the server doesn't attempt to percent-decode the sign URL.
 func (this *SignerSuite) TestSignAsPathParamWithUnusualPctEncoding() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil},
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
 	}}
 	target := `/priv/doc/` + this.httpsURL() + fakePath + `%2A`
 	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
@@ -383,7 +647,7 @@ func (this *SignerSuite) TestSignAsPathParamWithUnusualPctEncoding() {
 
 func (this *SignerSuite) TestPreservesContentType() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil}}}
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
 	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
 		resp.Header().Set("Content-Type", "text/html;charset=utf-8;v=5")
 		resp.Write(fakeBody)
@@ -399,7 +663,7 @@ func (this *SignerSuite) TestPreservesContentType() {
 
 func (this *SignerSuite) TestRemovesLinkHeaders() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil}}}
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
 	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
 		resp.Header().Set("Content-Type", "text/html; charset=utf-8")
 		resp.Header().Set("Link", "rel=preload;<http://1.2.3.4/>")
@@ -416,7 +680,7 @@ func (this *SignerSuite) TestRemovesLinkHeaders() {
 
 func (this *SignerSuite) TestRemovesStatefulHeaders() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil}}}
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
 	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
 		resp.Header().Set("Content-Type", "text/html; charset=utf-8")
 		resp.Header().Set("Set-Cookie", "yum yum yum")
@@ -431,18 +695,93 @@ func (this *SignerSuite) TestRemovesStatefulHeaders() {
 	this.Assert().NotContains(exchange.ResponseHeaders, http.CanonicalHeaderKey("Set-Cookie"))
 }
 
+func (this *SignerSuite) TestResponseHeaderPolicy() {
+	urlSets := []util.URLSet{{
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
+	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set("Content-Type", "text/html; charset=utf-8")
+		resp.Header().Set("Cache-Control", "max-age=60")
+		resp.Header().Set("Content-Language", "en")
+		resp.Header().Set("Server", "apache")
+		resp.Header().Set("X-Debug-Trace", "abc123")
+		resp.Header().Set("Set-Cookie", "yum yum yum")
+		resp.Header().Set("Authorization", "Basic c2VjcmV0")
+		resp.Write(fakeBody)
+	}
+	target := "/priv/doc?sign=" + url.QueryEscape(this.httpsURL()+fakePath)
+	signedHeaders := func() http.Header {
+		resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+		this.Require().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+		exchange, err := signedexchange.ReadExchange(resp.Body)
+		this.Require().NoError(err)
+		return exchange.ResponseHeaders
+	}
+
+	// By default, all but stateful headers and credentials are signed.
+	headers := signedHeaders()
+	this.Assert().Equal("apache", headers.Get("Server"))
+	this.Assert().Equal("abc123", headers.Get("X-Debug-Trace"))
+	this.Assert().NotContains(headers, "Set-Cookie")
+	this.Assert().NotContains(headers, "Authorization")
+
+	this.strippedHeaders = []string{"server", "X-Debug-Trace"}
+	headers = signedHeaders()
+	this.Assert().NotContains(headers, "Server")
+	this.Assert().NotContains(headers, "X-Debug-Trace")
+	this.Assert().Equal("max-age=60", headers.Get("Cache-Control"))
+	this.Assert().Equal("en", headers.Get("Content-Language"))
+
+	this.strippedHeaders = nil
+	this.signedHeaders = []string{"Cache-Control", "Set-Cookie"}
+	headers = signedHeaders()
+	this.Assert().Equal("max-age=60", headers.Get("Cache-Control"))
+	this.Assert().Equal("text/html; charset=utf-8", headers.Get("Content-Type"))
+	this.Assert().NotContains(headers, "Content-Language")
+	this.Assert().NotContains(headers, "Server")
+	this.Assert().NotContains(headers, "Set-Cookie")
+	// Headers set by the signer remain.
+	this.Assert().Equal("nosniff", headers.Get("X-Content-Type-Options"))
+	this.Assert().NotEmpty(headers.Get("Content-Security-Policy"))
+	this.Assert().NotEmpty(headers.Get("Digest"))
+}
+
+func (this *SignerSuite) TestSignContentLanguage() {
+	urlSets := []util.URLSet{{
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
+	contentLanguage := "en-US, fr"
+	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set("Content-Type", "text/html; charset=utf-8")
+		resp.Header().Set("Content-Language", contentLanguage)
+		resp.Write(fakeBody)
+	}
+	target := "/priv/doc?sign=" + url.QueryEscape(this.httpsURL()+fakePath)
+	signedHeaders := func() http.Header {
+		resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+		this.Require().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+		exchange, err := signedexchange.ReadExchange(resp.Body)
+		this.Require().NoError(err)
+		return exchange.ResponseHeaders
+	}
+
+	// Unless configured, Content-Language follows the response header policy.
+	this.signedHeaders = []string{"Cache-Control"}
+	this.Assert().NotContains(signedHeaders(), "Content-Language")
+
+	this.signContentLanguage = true
+	this.Assert().Equal("en-US, fr", signedHeaders().Get("Content-Language"))
+
+	this.signedHeaders = nil
+	this.strippedHeaders = []string{"Content-Language"}
+	this.Assert().Equal("en-US, fr", signedHeaders().Get("Content-Language"))
+
+	// Malformed values aren't signed.
+	contentLanguage = "en_US; q=1"
+	this.Assert().NotContains(signedHeaders(), "Content-Language")
+}
+
 func (this *SignerSuite) TestMutatesCspHeaders() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{
-			[]string{"https"},
-			"",
-			this.httpsHost(),
-			stringPtr("/amp/.*"),
-			[]string{},
-			stringPtr(""),
-			false,
-			2000,
-			nil}}}
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
 	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
 		resp.Header().Set("Content-Type", "text/html; charset=utf-8")
 		// Expect base-uri and block-all-mixed-content to remain unmodified.
@@ -476,7 +815,7 @@ func (this *SignerSuite) TestMutatesCspHeaders() {
 
 func (this *SignerSuite) TestAddsLinkHeaders() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil}}}
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
 	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
 		resp.Header().Set("Content-Type", "text/html; charset=utf-8")
 		resp.Write([]byte(`<html amp><head><link rel=stylesheet href=foo><script src=bar></script><link rel=preload as=image href=baz imagesizes="100vw" imagesrcset="qux">`))
@@ -492,7 +831,7 @@ func (this *SignerSuite) TestAddsLinkHeaders() {
 
 func (this *SignerSuite) TestEscapesLinkHeaders() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil}}}
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
 	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
 		resp.Header().Set("Content-Type", "text/html; charset=utf-8")
 		// This shouldn't happen for valid AMP, and AMP Caches should
@@ -513,7 +852,7 @@ func (this *SignerSuite) TestEscapesLinkHeaders() {
 
 func (this *SignerSuite) TestRemovesHopByHopHeaders() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil}}}
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
 	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
 		resp.Header().Set("Content-Type", "text/html; charset=utf-8")
 		resp.Header().Set("Connection", "PROXY-AUTHENTICATE, Server")
@@ -537,7 +876,7 @@ func (this *SignerSuite) TestRemovesHopByHopHeaders() {
 
 func (this *SignerSuite) TestLimitsDuration() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil}}}
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
 	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
 		resp.Header().Set("Content-Type", "text/html; charset=utf-8")
 		resp.Write([]byte("<html amp><body><amp-script script max-age=123456>"))
@@ -560,7 +899,7 @@ func (this *SignerSuite) TestLimitsDuration() {
 
 func (this *SignerSuite) TestDoesNotExtendDuration() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil}}}
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
 	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
 		resp.Header().Set("Content-Type", "text/html; charset=utf-8")
 		resp.Write([]byte("<html amp><body><amp-script script max-age=700000>"))
@@ -581,9 +920,88 @@ func (this *SignerSuite) TestDoesNotExtendDuration() {
 	this.Assert().Equal(int64(604800), expires-date)
 }
 
+// Returns the date and expires of the signature of the exchange served for
+// fakePath.
+func (this *SignerSuite) signatureDateAndExpires() (int64, int64) {
+	urlSets := []util.URLSet{{
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
+	target := "/priv/doc?sign=" + url.QueryEscape(this.httpsURL()+fakePath)
+	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+	this.Require().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+
+	exchange, err := signedexchange.ReadExchange(resp.Body)
+	this.Require().NoError(err)
+	signatures, err := structuredheader.ParseParameterisedList(exchange.SignatureHeaderValue)
+	this.Require().NoError(err)
+	this.Require().NotEmpty(signatures)
+	date, ok := signatures[0].Params["date"].(int64)
+	this.Require().True(ok)
+	expires, ok := signatures[0].Params["expires"].(int64)
+	this.Require().True(ok)
+	return date, expires
+}
+
+func (this *SignerSuite) TestConfiguredDuration() {
+	this.signatureDuration = 2 * time.Hour
+	date, expires := this.signatureDateAndExpires()
+	this.Assert().Equal(int64(7200), expires-date)
+	// The date is backdated by half the duration, rather than a day, so
+	// that the signature is still valid.
+	now := time.Now().Unix()
+	this.Assert().InDelta(now-3600, date, 5)
+	this.Assert().True(expires > now, "expires = %d, now = %d", expires, now)
+}
+
+func (this *SignerSuite) TestClampsDurationToMaximum() {
+	this.signatureDuration = 30 * 24 * time.Hour
+	date, expires := this.signatureDateAndExpires()
+	this.Assert().Equal(int64(604800), expires-date)
+}
+
+func (this *SignerSuite) TestClampsDurationToMinimum() {
+	this.signatureDuration = time.Minute
+	date, expires := this.signatureDateAndExpires()
+	this.Assert().Equal(int64(3600), expires-date)
+}
+
+func (this *SignerSuite) TestLimitsDurationToOCSPExpiry() {
+	urlSets := []util.URLSet{{
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
+	// The OCSP expires in 2 days, before the default 6 days' remaining validity.
+	this.ocspExpiry = time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	target := "/priv/doc?sign=" + url.QueryEscape(this.httpsURL()+fakePath)
+	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+	this.Assert().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+
+	exchange, err := signedexchange.ReadExchange(resp.Body)
+	this.Require().NoError(err)
+	signatures, err := structuredheader.ParseParameterisedList(exchange.SignatureHeaderValue)
+	this.Require().NoError(err)
+	this.Require().NotEmpty(signatures)
+	date, ok := signatures[0].Params["date"].(int64)
+	this.Require().True(ok)
+	expires, ok := signatures[0].Params["expires"].(int64)
+	this.Require().True(ok)
+	this.Assert().Equal(this.ocspExpiry.Unix(), expires)
+	this.Assert().True(expires-date < 604800, "expires-date = %d", expires-date)
+}
+
+func (this *SignerSuite) TestProxyUnsignedIfOCSPExpired() {
+	urlSets := []util.URLSet{{
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
+	this.ocspExpiry = time.Now().Add(-time.Hour)
+	target := "/priv/doc?sign=" + url.QueryEscape(this.httpsURL()+fakePath)
+	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+	this.Assert().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	this.Require().NoError(err)
+	this.Assert().Equal(fakeBody, body, "incorrect body: %#v", resp)
+}
+
 func (this *SignerSuite) TestProxyUnsignedIfExpired() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil}}}
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
 	fakeBody := []byte("<html amp><body><amp-script script max-age=86400>")
 	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
 		resp.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -600,7 +1018,7 @@ func (this *SignerSuite) TestProxyUnsignedIfExpired() {
 
 func (this *SignerSuite) TestErrorNoCache() {
 	urlSets := []util.URLSet{{
-		Fetch: &util.URLPattern{[]string{"http"}, "", this.httpHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, boolPtr(true)},
+		Fetch: &util.URLPattern{Scheme: []string{"http"}, Domain: this.httpHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000, SamePath: boolPtr(true)},
 	}}
 	// Missing sign param generates an error.
 	target := "/priv/doc?fetch=" + url.QueryEscape(this.httpURL()+fakePath)
@@ -611,7 +1029,7 @@ func (this *SignerSuite) TestErrorNoCache() {
 
 func (this *SignerSuite) TestProxyUnsignedIfRedirect() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil},
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
 	}}
 	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
 		resp.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -629,7 +1047,7 @@ func (this *SignerSuite) TestProxyUnsignedIfRedirect() {
 
 func (this *SignerSuite) TestProxyUnsignedIfNotModified() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil},
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
 	}}
 	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
 		resp.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -647,9 +1065,105 @@ func (this *SignerSuite) TestProxyUnsignedIfNotModified() {
 	this.Assert().Equal("superrad", resp.Header.Get("etag"))
 }
 
+func (this *SignerSuite) TestConditionalRequest() {
+	urlSets := []util.URLSet{{
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
+	}}
+	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
+		this.lastRequest = req
+		resp.Header().Set("ETag", `"v1"`)
+		resp.Header().Set("Last-Modified", "Mon, 01 Jun 2020 00:00:00 GMT")
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			resp.WriteHeader(304)
+			return
+		}
+		resp.Header().Set("Content-Type", "text/html")
+		resp.Write(fakeBody)
+	}
+	target := "/priv/doc?sign=" + url.QueryEscape(this.httpsURL()+fakePath)
+
+	// The validators are forwarded to the origin, and its 304 is returned
+	// as is, rather than re-signing the unchanged document.
+	conditional := http.Header{"If-None-Match": {`"v1"`}, "If-Modified-Since": {"Mon, 01 Jun 2020 00:00:00 GMT"}}
+	for name, values := range header {
+		conditional[name] = values
+	}
+	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", conditional).Do()
+	this.Assert().Equal(`"v1"`, this.lastRequest.Header.Get("If-None-Match"))
+	this.Assert().Equal("Mon, 01 Jun 2020 00:00:00 GMT", this.lastRequest.Header.Get("If-Modified-Since"))
+	this.Assert().Equal(http.StatusNotModified, resp.StatusCode)
+	this.Assert().Equal(`"v1"`, resp.Header.Get("ETag"))
+	this.Assert().NotEqual(accept.SxgContentType, resp.Header.Get("Content-Type"))
+	body, err := ioutil.ReadAll(resp.Body)
+	this.Require().NoError(err)
+	this.Assert().Empty(body)
+
+	// Once the document has changed, it is signed anew.
+	conditional.Set("If-None-Match", `"v0"`)
+	resp = pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", conditional).Do()
+	this.Assert().Equal(http.StatusOK, resp.StatusCode)
+	this.Assert().Equal(accept.SxgContentType, resp.Header.Get("Content-Type"))
+}
+
+func (this *SignerSuite) TestUnmatchedURL() {
+	urlSets := []util.URLSet{{
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
+	}}
+	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
+		this.lastRequest = req
+		resp.Header().Set("Content-Type", "text/html")
+		resp.Write(fakeBody)
+	}
+	target := "/priv/doc?sign=" + url.QueryEscape(this.httpsURL()+"/other/page.html")
+
+	tcs := []struct {
+		policy     string
+		statusCode int
+	}{
+		{"", http.StatusBadRequest},
+		{util.UnmatchedURLBadRequest, http.StatusBadRequest},
+		{util.UnmatchedURLNotFound, http.StatusNotFound},
+		{util.UnmatchedURLForbidden, http.StatusForbidden},
+	}
+	for _, tc := range tcs {
+		this.unmatchedURL = tc.policy
+		resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+		this.Assert().Equal(tc.statusCode, resp.StatusCode, "policy %q", tc.policy)
+		body, err := ioutil.ReadAll(resp.Body)
+		this.Require().NoError(err)
+		if tc.statusCode != http.StatusBadRequest {
+			this.Assert().Equal(http.StatusText(tc.statusCode)+": URL is not configured for signing\n", string(body), "policy %q", tc.policy)
+		}
+	}
+
+	// The sign URL is proxied unsigned.
+	this.unmatchedURL = util.UnmatchedURLProxy
+	this.lastRequest = nil
+	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+	this.Assert().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+	this.Assert().Equal("text/html", resp.Header.Get("Content-Type"))
+	body, err := ioutil.ReadAll(resp.Body)
+	this.Require().NoError(err)
+	this.Assert().Equal(fakeBody, body)
+	if this.Assert().NotNil(this.lastRequest) {
+		this.Assert().Equal("/other/page.html", this.lastRequest.URL.Path)
+	}
+
+	// But not for other domains, nor for separate fetch URLs.
+	for _, target := range []string{
+		"/priv/doc?sign=" + url.QueryEscape("https://other.example/amp/page.html"),
+		"/priv/doc?fetch=" + url.QueryEscape(this.httpURL()+"/other/page.html") + "&sign=" + url.QueryEscape(this.httpsURL()+"/other/page.html"),
+	} {
+		this.lastRequest = nil
+		resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+		this.Assert().Equal(http.StatusNotFound, resp.StatusCode, "target %q", target)
+		this.Assert().Nil(this.lastRequest, "target %q", target)
+	}
+}
+
 func (this *SignerSuite) TestProxyUnsignedIfShouldntPackage() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil},
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
 	}}
 	this.shouldPackage = errors.New("random error")
 	target := "/priv/doc?sign=" + url.QueryEscape(this.httpsURL()+fakePath)
@@ -662,7 +1176,7 @@ func (this *SignerSuite) TestProxyUnsignedIfShouldntPackage() {
 
 func (this *SignerSuite) TestProxyUnsignedIfMissingAMPCacheTransformHeader() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil},
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
 	}}
 	header := http.Header{"Accept": {"application/signed-exchange;v=" + accept.AcceptedSxgVersion}}
 	resp := pkgt.NewRequest(this.T(), this.new(urlSets), "/priv/doc?sign="+url.QueryEscape(this.httpsURL()+fakePath)).SetHeaders("", header).Do()
@@ -674,7 +1188,7 @@ func (this *SignerSuite) TestProxyUnsignedIfMissingAMPCacheTransformHeader() {
 
 func (this *SignerSuite) TestProxyUnsignedIfInvalidAMPCacheTransformHeader() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil},
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
 	}}
 	header := http.Header{
 		"Accept":              {"application/signed-exchange;v=" + accept.AcceptedSxgVersion},
@@ -689,7 +1203,7 @@ func (this *SignerSuite) TestProxyUnsignedIfInvalidAMPCacheTransformHeader() {
 
 func (this *SignerSuite) TestProxyUnsignedIfMissingAcceptHeader() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil},
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
 	}}
 	header := http.Header{"AMP-Cache-Transform": {"google"}}
 	resp := pkgt.NewRequest(this.T(), this.new(urlSets), "/priv/doc?sign="+url.QueryEscape(this.httpsURL()+fakePath)).SetHeaders("", header).Do()
@@ -701,7 +1215,7 @@ func (this *SignerSuite) TestProxyUnsignedIfMissingAcceptHeader() {
 
 func (this *SignerSuite) TestProxyUnsignedNonCachable() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil},
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
 	}}
 	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
 		resp.Header().Set("Content-Type", "text/html")
@@ -716,9 +1230,77 @@ func (this *SignerSuite) TestProxyUnsignedNonCachable() {
 	this.Assert().Equal("text/html", resp.Header.Get("Content-Type"))
 }
 
+func (this *SignerSuite) serveJSON() {
+	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set("Content-Type", "application/json; charset=utf-8")
+		resp.Header().Set("Cache-Control", "max-age=60")
+		resp.WriteHeader(200)
+		resp.Write([]byte(`{"amp": true}`))
+	}
+}
+
+func (this *SignerSuite) TestProxyUnsignedNonHTML() {
+	urlSets := []util.URLSet{{
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
+	}}
+	this.serveJSON()
+
+	target := "/priv/doc?sign=" + url.QueryEscape(this.httpsURL()+fakePath)
+	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+	this.Assert().Equal(200, resp.StatusCode)
+	this.Assert().Equal("application/json; charset=utf-8", resp.Header.Get("Content-Type"))
+	body, err := ioutil.ReadAll(resp.Body)
+	this.Require().NoError(err)
+	this.Assert().Equal(`{"amp": true}`, string(body))
+}
+
+func (this *SignerSuite) TestProxyUnsignedNonHTMLProxyType() {
+	urlSets := []util.URLSet{{
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
+	}}
+	this.serveJSON()
+	this.errorOnNonHTML = true
+	this.nonHTMLProxyTypes = []string{"Application/JSON"}
+
+	target := "/priv/doc?sign=" + url.QueryEscape(this.httpsURL()+fakePath)
+	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+	this.Assert().Equal(200, resp.StatusCode)
+	this.Assert().Equal("application/json; charset=utf-8", resp.Header.Get("Content-Type"))
+}
+
+func (this *SignerSuite) TestErrorOnNonHTML() {
+	urlSets := []util.URLSet{{
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
+	}}
+	this.serveJSON()
+	this.errorOnNonHTML = true
+	this.nonHTMLProxyTypes = []string{"image/png"}
+
+	var logs strings.Builder
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	target := "/priv/doc?sign=" + url.QueryEscape(this.httpsURL()+fakePath)
+	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+	this.Assert().Equal(http.StatusBadGateway, resp.StatusCode)
+	this.Assert().Equal("no-store", resp.Header.Get("Cache-Control"))
+	this.Assert().Contains(logs.String(), `origin Content-Type is "application/json; charset=utf-8", not text/html`)
+}
+
+func (this *SignerSuite) TestErrorOnNonHTMLSignsHTML() {
+	urlSets := []util.URLSet{{
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
+	}}
+	this.errorOnNonHTML = true
+
+	target := "/priv/doc?sign=" + url.QueryEscape(this.httpsURL()+fakePath)
+	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+	this.Assert().Equal(200, resp.StatusCode)
+	this.Assert().Equal(accept.SxgContentType, resp.Header.Get("Content-Type"))
+}
+
 func (this *SignerSuite) TestProxyUnsignedBadContentEncoding() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil},
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
 	}}
 	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
 		resp.Header().Set("Content-Type", "text/html")
@@ -735,7 +1317,7 @@ func (this *SignerSuite) TestProxyUnsignedBadContentEncoding() {
 
 func (this *SignerSuite) TestProxyUnsignedErrOnStatefulHeader() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), true, 2000, nil},
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), ErrorOnStatefulHeaders: true, MaxLength: 2000},
 	}}
 	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
 		resp.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -753,7 +1335,7 @@ func (this *SignerSuite) TestProxyUnsignedErrOnStatefulHeader() {
 
 func (this *SignerSuite) TestProxyUnsignedOnVariants() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), true, 2000, nil},
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), ErrorOnStatefulHeaders: true, MaxLength: 2000},
 	}}
 	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
 		resp.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -770,9 +1352,52 @@ func (this *SignerSuite) TestProxyUnsignedOnVariants() {
 	this.Assert().Equal("text/html", resp.Header.Get("Content-Type"))
 }
 
+func (this *SignerSuite) TestSignsVariants() {
+	urlSets := []util.URLSet{{
+		Sign:          &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
+		AllowVariants: true,
+	}}
+	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set("Content-Type", "text/html")
+		resp.Header().Set("Variants", "Sec-CH-Viewport-Width;mobile;desktop")
+		resp.Header().Set("Variant-Key", "mobile")
+		resp.Write(fakeBody)
+	}
+
+	target := "/priv/doc?sign=" + url.QueryEscape(this.httpsURL()+fakePath)
+	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+	this.Assert().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+	this.Assert().Equal("", resp.Header.Get("Variants"))
+
+	exchange, err := signedexchange.ReadExchange(resp.Body)
+	this.Require().NoError(err)
+	this.Assert().Equal("Sec-CH-Viewport-Width;mobile;desktop", exchange.ResponseHeaders.Get("Variants"))
+	this.Assert().Equal("mobile", exchange.ResponseHeaders.Get("Variant-Key"))
+	this.Assert().NoError(validateVariants(exchange.ResponseHeaders))
+}
+
+func (this *SignerSuite) TestProxyUnsignedOnInvalidVariants() {
+	urlSets := []util.URLSet{{
+		Sign:          &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
+		AllowVariants: true,
+	}}
+	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set("Content-Type", "text/html")
+		resp.Header().Set("Variants", "Sec-CH-Viewport-Width;mobile;desktop")
+		resp.Header().Set("Variant-Key", "tablet")
+		resp.Write(fakeBody)
+	}
+
+	target := "/priv/doc?sign=" + url.QueryEscape(this.httpsURL()+fakePath)
+	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+	this.Assert().Equal(http.StatusOK, resp.StatusCode)
+	this.Assert().Equal("tablet", resp.Header.Get("Variant-Key"))
+	this.Assert().Equal("text/html", resp.Header.Get("Content-Type"))
+}
+
 func (this *SignerSuite) TestProxyUnsignedOnVariants04() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), true, 2000, nil},
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), ErrorOnStatefulHeaders: true, MaxLength: 2000},
 	}}
 	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
 		resp.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -790,7 +1415,7 @@ func (this *SignerSuite) TestProxyUnsignedOnVariants04() {
 
 func (this *SignerSuite) TestProxyUnsignedIfNotAMP() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil}}}
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
 	nonAMPBody := []byte("<html><body>They like to OPINE. Get it? (Is he fir real? Yew gotta be kidding me.)")
 	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
 		resp.Header().Set("Content-Type", "text/html")
@@ -807,7 +1432,7 @@ func (this *SignerSuite) TestProxyUnsignedIfNotAMP() {
 
 func (this *SignerSuite) TestProxyUnsignedIfWrongAMP() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil}}}
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
 	wrongAMPBody := []byte("<html amp4email><body>They like to OPINE. Get it? (Is he fir real? Yew gotta be kidding me.)")
 	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
 		resp.Header().Set("Content-Type", "text/html")
@@ -824,7 +1449,7 @@ func (this *SignerSuite) TestProxyUnsignedIfWrongAMP() {
 
 func (this *SignerSuite) TestProxyTransformError() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil},
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
 	}}
 
 	// Generate a request for non-existent transformer that will fail
@@ -845,7 +1470,7 @@ func (this *SignerSuite) TestProxyTransformError() {
 
 func (this *SignerSuite) TestProxyHeadersUnaltered() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil},
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
 	}}
 
 	// "Perform local transformations" is close to the last opportunity that a
@@ -905,7 +1530,7 @@ const promExpectedHeaderGatewayRequestsLatency = `
 
 func (this *SignerSuite) TestPrometheusMetricGatewayRequestsLatency() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil},
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
 	}}
 	suffix := "/priv/doc?sign=" + url.QueryEscape(this.httpsURL()+fakePath)
 	handler := this.new(urlSets)
@@ -1032,10 +1657,10 @@ func (this *SignerSuite) TestPrometheusMetricGatewayRequestsLatency() {
 		},
 		{
 			requestsFunc: func() {
-				this.fakeClock.Delta = 1 * time.Second
+				this.fakeClock.SetDelta(1 * time.Second)
 				this.minimalisticRequestWithFakeGatewayRequest(handler, suffix, 200)
 				this.minimalisticRequestWithFakeGatewayRequest(handler, suffix, 200)
-				this.fakeClock.Delta = 5 * time.Second
+				this.fakeClock.SetDelta(5 * time.Second)
 				this.minimalisticRequestWithFakeGatewayRequest(handler, suffix, 200)
 			},
 			expectation: `
@@ -1069,7 +1694,7 @@ func (this *SignerSuite) TestPrometheusMetricGatewayRequestsLatency() {
 
 func (this *SignerSuite) TestIfCappedDontSignAndProxyFullDocument() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil}}}
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
 
 	const uncappedTailLength = 100
 	veryLongString := strings.Repeat("a", maxSignableBodyLength+uncappedTailLength)
@@ -1087,12 +1712,243 @@ func (this *SignerSuite) TestIfCappedDontSignAndProxyFullDocument() {
 	this.Assert().Equal(customFakeBody, body, "incorrect body: %#v", resp)
 }
 
+// sizedBody returns a document of the given length that transforms to itself.
+func sizedBody(length int) []byte {
+	const prefix, suffix = "<html amp><head></head><body>", "</body></html>"
+	return []byte(prefix + strings.Repeat("a", length-len(prefix)-len(suffix)) + suffix)
+}
+
+func (this *SignerSuite) TestMaxBodyLength() {
+	urlSets := []util.URLSet{{
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
+	target := "/priv/doc?sign=" + url.QueryEscape(this.httpsURL()+fakePath)
+	this.maxBodyLength = 1000
+
+	for _, errorOnOversizedBody := range []bool{false, true} {
+		this.errorOnOversizedBody = errorOnOversizedBody
+
+		// Just under the limit, the document is signed.
+		this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
+			resp.Header().Set("Content-Type", "text/html")
+			resp.Write(sizedBody(999))
+		}
+		resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+		this.Assert().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+		this.Assert().Equal(accept.SxgContentType, resp.Header.Get("Content-Type"))
+
+		// At the limit, it is not.
+		this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
+			resp.Header().Set("Content-Type", "text/html")
+			resp.Write(sizedBody(1000))
+		}
+		resp = pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+		if errorOnOversizedBody {
+			this.Assert().Equal(http.StatusBadGateway, resp.StatusCode, "incorrect status: %#v", resp)
+		} else {
+			this.Assert().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+			body, err := ioutil.ReadAll(resp.Body)
+			this.Require().NoError(err)
+			this.Assert().Equal(sizedBody(1000), body)
+		}
+	}
+}
+
+func (this *SignerSuite) TestMaxBodyLengthAfterTransform() {
+	urlSets := []util.URLSet{{
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
+	// Under the limit as fetched, but not once a head and end tags are added.
+	customFakeBody := []byte("<html amp><body>" + strings.Repeat("a", 980))
+	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set("Content-Type", "text/html")
+		resp.Write(customFakeBody)
+	}
+	this.maxBodyLength = 1000
+	target := "/priv/doc?sign=" + url.QueryEscape(this.httpsURL()+fakePath)
+	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+	this.Assert().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+	body, err := ioutil.ReadAll(resp.Body)
+	this.Require().NoError(err)
+	this.Assert().Equal(customFakeBody, body)
+
+	this.errorOnOversizedBody = true
+	resp = pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+	this.Assert().Equal(http.StatusBadGateway, resp.StatusCode, "incorrect status: %#v", resp)
+}
+
+func (this *SignerSuite) TestAMPValidation() {
+	urlSets := []util.URLSet{{
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
+	validBody := []byte(`<html amp><head><meta charset=utf-8><meta name=viewport content="width=device-width"><script async src=https://cdn.ampproject.org/v0.js></script><style amp-boilerplate>body{visibility:hidden}</style></head><body>Hello</body></html>`)
+	invalidBody := []byte(`<html amp><head><meta charset=utf-8><meta name=viewport content="width=device-width"><script async src=https://cdn.ampproject.org/v0.js></script><style amp-boilerplate>body{visibility:hidden}</style></head><body><iframe src=/ad.html></iframe></body></html>`)
+	var fetchBody []byte
+	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set("Content-Type", "text/html")
+		resp.Write(fetchBody)
+	}
+	this.validateAMP = true
+	target := "/priv/doc?sign=" + url.QueryEscape(this.httpsURL()+fakePath)
+
+	// A valid document is signed.
+	fetchBody = validBody
+	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+	this.Assert().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+	this.Assert().Equal(accept.SxgContentType, resp.Header.Get("Content-Type"))
+
+	// An invalid one is refused.
+	fetchBody = invalidBody
+	resp = pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+	this.Assert().Equal(http.StatusBadGateway, resp.StatusCode, "incorrect status: %#v", resp)
+
+	// Unless overridden.
+	this.signInvalidAMP = true
+	resp = pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+	this.Assert().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+	this.Assert().Equal(accept.SxgContentType, resp.Header.Get("Content-Type"))
+
+	// Without validation, it is signed too.
+	this.validateAMP = false
+	this.signInvalidAMP = false
+	resp = pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+	this.Assert().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+	this.Assert().Equal(accept.SxgContentType, resp.Header.Get("Content-Type"))
+}
+
+func (this *SignerSuite) TestAMPValidatorError() {
+	urlSets := []util.URLSet{{
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
+	orig := ampValidator
+	defer func() { ampValidator = orig }()
+	ampValidator = func(string) ([]string, error) { return nil, errors.New("validator unavailable") }
+	this.validateAMP = true
+	target := "/priv/doc?sign=" + url.QueryEscape(this.httpsURL()+fakePath)
+
+	// Fail-closed refuses to sign.
+	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+	this.Assert().Equal(http.StatusBadGateway, resp.StatusCode, "incorrect status: %#v", resp)
+
+	// Fail-open signs anyway.
+	this.validatorFailOpen = true
+	resp = pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+	this.Assert().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+	this.Assert().Equal(accept.SxgContentType, resp.Header.Get("Content-Type"))
+}
+
+func (this *SignerSuite) TestOuterCacheControl() {
+	urlSets := []util.URLSet{{
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
+	originCacheControl := ""
+	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set("Content-Type", "text/html; charset=utf-8")
+		resp.Header().Set("Cache-Control", originCacheControl)
+		resp.Write(fakeBody)
+	}
+	target := "/priv/doc?sign=" + url.QueryEscape(this.httpsURL()+fakePath)
+	outerCacheControl := func() string {
+		resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+		this.Require().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+		this.Require().Equal(accept.SxgContentType, resp.Header.Get("Content-Type"))
+		return resp.Header.Get("Cache-Control")
+	}
+
+	// By default, the origin's max-age is signed, but not reflected outside.
+	originCacheControl = "public, max-age=3600"
+	this.Assert().Equal("no-transform, max-age=0", outerCacheControl())
+
+	// Clamped to the ceiling.
+	this.outerCacheControl = util.OuterCacheControlClamp
+	this.outerMaxAge = 300 * time.Second
+	this.Assert().Equal("no-transform, max-age=300", outerCacheControl())
+
+	// Shorter origin max-ages, preferring s-maxage, are kept.
+	originCacheControl = "max-age=3600, s-maxage=60"
+	this.Assert().Equal("no-transform, max-age=60", outerCacheControl())
+
+	// Without a ceiling, the signature's lifetime bounds it.
+	originCacheControl = "max-age=31536000"
+	this.outerMaxAge = 0
+	this.signatureDuration = 24 * time.Hour
+	maxAge, err := strconv.Atoi(strings.TrimPrefix(outerCacheControl(), "no-transform, max-age="))
+	this.Require().NoError(err)
+	this.Assert().True(maxAge > 0 && maxAge <= 86400, "max-age=%d", maxAge)
+
+	// Overridden regardless of the origin.
+	this.signatureDuration = 0
+	this.outerCacheControl = util.OuterCacheControlOverride
+	this.outerMaxAge = 120 * time.Second
+	originCacheControl = "max-age=60"
+	this.Assert().Equal("no-transform, max-age=120", outerCacheControl())
+}
+
+func (this *SignerSuite) TestRequestTimeout() {
+	urlSets := []util.URLSet{{
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
+	this.requestTimeout = 100 * time.Millisecond
+	// hang blocks until the signer gives up, or long after it should have.
+	// It then signals hung, so that the handler isn't swapped while the
+	// server is still running it.
+	hung := make(chan struct{})
+	hang := func(req *http.Request) {
+		defer func() { hung <- struct{}{} }()
+		select {
+		case <-req.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}
+	target := "/priv/doc?sign=" + url.QueryEscape(this.httpsURL()+fakePath)
+
+	// The origin doesn't respond.
+	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
+		hang(req)
+	}
+	start := time.Now()
+	resp := pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+	this.Assert().Equal(http.StatusGatewayTimeout, resp.StatusCode, "incorrect status: %#v", resp)
+	this.Assert().Less(time.Since(start), time.Second)
+	<-hung
+
+	// The origin responds, but doesn't finish the body.
+	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set("Content-Type", "text/html")
+		resp.Write([]byte("<html amp>"))
+		resp.(http.Flusher).Flush()
+		hang(req)
+	}
+	start = time.Now()
+	resp = pkgt.NewRequest(this.T(), this.new(urlSets), target).SetHeaders("", header).Do()
+	this.Assert().Equal(http.StatusGatewayTimeout, resp.StatusCode, "incorrect status: %#v", resp)
+	this.Assert().Less(time.Since(start), time.Second)
+	<-hung
+}
+
+func (this *SignerSuite) TestRequestTimeoutCancelsShouldPackage() {
+	urlSets := []util.URLSet{{
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
+	this.requestTimeout = 100 * time.Millisecond
+	handler, err := New(fakeCertHandler{this.ocspExpiry}, pkgt.Key, urlSets, &rtv.RTVCache{}, func(ctx context.Context) error {
+		// A hanging OCSP fetch, abandoned with the request.
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+			return nil
+		}
+	}, nil, true, []string{}, pkgt.NewFakeClock().Now)
+	this.Require().NoError(err)
+	handler.SetRequestTimeout(this.requestTimeout)
+	handler.client = this.httpsClient
+
+	start := time.Now()
+	resp := pkgt.NewRequest(this.T(), mux.New(mux.Handlers{Signer: handler}), "/priv/doc?sign="+url.QueryEscape(this.httpsURL()+fakePath)).SetHeaders("", header).Do()
+	this.Assert().Equal(http.StatusGatewayTimeout, resp.StatusCode, "incorrect status: %#v", resp)
+	this.Assert().Less(time.Since(start), time.Second)
+}
+
 func (this *SignerSuite) TestWrongContentLength() {
 	fiveCharacterBody := []byte("abcde")
 	wrongLength := "4"
 
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil}}}
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000}}}
 	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
 		resp.Header().Set("Content-Type", "text/html")
 		resp.Header().Set("Content-Length", wrongLength)
@@ -1105,7 +1961,7 @@ func (this *SignerSuite) TestWrongContentLength() {
 
 func (this *SignerSuite) TestPrometheusMetricSignedAmpDocumentsSize() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil},
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
 	}}
 	target := "/priv/doc?sign=" + url.QueryEscape(this.httpsURL()+fakePath)
 
@@ -1194,7 +2050,7 @@ func (this *SignerSuite) TestPrometheusMetricSignedAmpDocumentsSize() {
 
 func (this *SignerSuite) TestPrometheusMetricDocumentsSignedVsUnsigned() {
 	urlSets := []util.URLSet{{
-		Sign: &util.URLPattern{[]string{"https"}, "", this.httpsHost(), stringPtr("/amp/.*"), []string{}, stringPtr(""), false, 2000, nil},
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
 	}}
 	target := "/priv/doc?sign=" + url.QueryEscape(this.httpsURL()+fakePath)
 
@@ -1232,3 +2088,27 @@ func (this *SignerSuite) TestPrometheusMetricDocumentsSignedVsUnsigned() {
 		this.Require().NoError(promtest.CollectAndCompare(promDocumentsSignedVsUnsigned, expectation, "amppackager_signer_documents_total"), scenario.name+" failed.")
 	}
 }
+
+func (this *SignerSuite) TestConfiguredMIRecordSize() {
+	urlSets := []util.URLSet{{
+		Sign: &util.URLPattern{Scheme: []string{"https"}, Domain: this.httpsHost(), PathRE: stringPtr("/amp/.*"), PathExcludeRE: []string{}, QueryRE: stringPtr(""), MaxLength: 2000},
+	}}
+	text := bytes.Repeat([]byte("They like to OPINE. "), 1000)
+	this.fakeHandler = func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set("Content-Type", "text/html")
+		resp.Write(append([]byte("<html amp><body>"), text...))
+	}
+	this.miRecordSize = 1024
+	resp := pkgt.NewRequest(this.T(), this.new(urlSets), "/priv/doc?sign="+url.QueryEscape(this.httpsURL()+fakePath)).SetHeaders("", header).Do()
+	this.Require().Equal(http.StatusOK, resp.StatusCode, "incorrect status: %#v", resp)
+
+	exchange, err := signedexchange.ReadExchange(resp.Body)
+	this.Require().NoError(err)
+	this.Assert().Equal(uint64(1024), binary.BigEndian.Uint64(exchange.Payload[:8]))
+	enc := exchange.Version.MiceEncoding()
+	decoder, err := enc.NewDecoder(bytes.NewReader(exchange.Payload), exchange.ResponseHeaders.Get(enc.DigestHeaderName()), maxMIRecordSize)
+	this.Require().NoError(err)
+	decoded, err := ioutil.ReadAll(decoder)
+	this.Require().NoError(err)
+	this.Assert().Equal(append(append([]byte("<html amp><head></head><body>"), text...), "</body></html>"...), decoded)
+}
@@ -5,12 +5,14 @@ import (
 	"mime"
 	"net/http"
 	"net/url"
-	"regexp"
+	"path"
+	"strconv"
 	"strings"
 
 	"github.com/ampproject/amppackager/packager/util"
 	"github.com/pkg/errors"
 	"github.com/pquerna/cachecontrol"
+	"golang.org/x/net/http/httpguts"
 )
 
 // Converts an URL string into an URL object with an unambiguous interpretation.
@@ -39,188 +41,114 @@ func parseURL(rawURL string, name string) (*url.URL, *util.HTTPError) {
 	return ret, nil
 }
 
-// Returns true iff the given pattern matches the entire test string.
-func regexpFullMatch(pattern string, test string) bool {
-	// This is how regexp/exec_test.go turns a partial pattern into a full pattern.
-	fullRe := `\A(?:` + pattern + `)\z`
-	matches, _ := regexp.MatchString(fullRe, test)
-	return matches
-}
-
-// Implements the URL-matching common to both fetchURLMatches and signURLMatches.
-func urlMatches(url *url.URL, pattern util.URLPattern) error {
-	if url.Opaque != "" {
-		// Opaque URLs are unfetchable, and also disallowed by the spec
-		// as sign URLs.
-		return errors.New("URL is opaque")
-	}
-	if url.User != nil {
-		// The `user:pass@` portion of a URL is not technically
-		// disallowed by the spec, but is a weird enough request that
-		// it seems wise to disable this capability by default (i.e.
-		// more likely a sign of attack than a legitimate request).
-		// Please open an issue if you have a legitimate need for this
-		// in a fetch/sign URL.
-		return errors.New("URL contains user")
-	}
-	// PathRE matches the path component of the URL, including the
-	// beginning slash.
-	if !regexpFullMatch(*pattern.PathRE, url.EscapedPath()) {
-		return errors.New("PathRE doesn't match")
-	}
-	// If any of PathExcludeRE matches, the URL does not match.
-	for _, re := range pattern.PathExcludeRE {
-		if regexpFullMatch(re, url.EscapedPath()) {
-			return errors.Errorf("PathExcludeRE matches: %s", re)
+// If the given fetch and sign URLs are valid, and match at least one of the
+// urlSets (as specified by the [[URLSet]] blocks in the config file), then
+// this returns the parsed fetch URL, the URL to sign, the sign URL as
+// requested, and the first matching URLSet. If fetch is empty, the returned
+// fetch URL is the requested sign URL, or if the matching URLSet specifies an
+// UpstreamBaseURL, the requested sign URL rebased onto it. The URL to sign is
+// the requested one, normalized per the URLSet's TrailingSlash, and must also
+// match it. If requireUnique is true, it is an error for more than one URLSet
+// to match. Otherwise, returns an error, along with the parsed sign URL if it
+// is well-formed but matches no URLSet.
+func parseURLs(fetch string, sign string, urlSets []util.URLSet, requireUnique bool) (*url.URL, *url.URL, *url.URL, *util.URLSet, *util.HTTPError) {
+	var fetchURL *url.URL
+	var err *util.HTTPError
+	if fetch != "" {
+		fetchURL, err = parseURL(fetch, "fetch")
+		if err != nil {
+			// TODO(twifkak): Use errors.Wrap() after changing return types to error.
+			return nil, nil, nil, nil, err
 		}
 	}
-	// QueryRE matches the query component of the URL, *not* including the
-	// beginning question mark.
-	if !regexpFullMatch(*pattern.QueryRE, url.RawQuery) {
-		return errors.New("QueryRE doesn't match")
+	signURL, err := parseURL(sign, "sign")
+	if err != nil {
+		// TODO(twifkak): Use errors.Wrap() after changing return types to error.
+		return nil, nil, nil, nil, err
 	}
-	if len(url.String()) > pattern.MaxLength {
-		return errors.New("URL too long")
+	// Reject a non-HTTPS sign URL outright, rather than as a mismatch with
+	// every URLSet, as no config could allow it.
+	if signURL.Scheme != "https" {
+		return nil, nil, nil, nil, util.NewHTTPError(http.StatusBadRequest, "sign URL must be https, not ", signURL.Scheme)
 	}
-	return nil
-}
 
-// True iff actualScheme is an element of expectedSchemes.
-func schemeMatches(actualScheme string, expectedSchemes []string) bool {
-	for _, expectedScheme := range expectedSchemes {
-		if actualScheme == expectedScheme {
-			return true
+	var match *util.URLSet
+	matches := []string{}
+	errs := []string{}
+	for i := range urlSets {
+		if err := urlSets[i].MatchURLs(fetchURL, signURL); err != nil {
+			errs = append(errs, err.Error())
+			continue
 		}
-	}
-	return false
-}
-
-// True iff url matches pattern, as defined by an [URLSet.Fetch] block in the
-// config file. The format of this URLPattern is validated by
-// validateFetchURLPattern in config.go.
-func fetchURLMatches(url *url.URL, pattern *util.URLPattern) error {
-	// If the fetch block is not specified, then this particular URLSet is
-	// a "sign-only" config. That is: only the sign URL should be passed to
-	// the Signer; this will be used as the fetch URL as well.
-	if pattern == nil {
-		if url == nil {
-			return nil
-		} else {
-			return errors.New("If URLSet.Fetch is unspecified, then so should ?fetch= be.")
+		if match == nil {
+			match = &urlSets[i]
 		}
+		if !requireUnique {
+			break
+		}
+		matches = append(matches, strconv.Itoa(i))
 	}
-	if url == nil {
-		return errors.New("?fetch= is unspecified")
-	}
-	// The fetch block may specify which schemes are allowed.
-	if !schemeMatches(url.Scheme, pattern.Scheme) {
-		return errors.New("Scheme doesn't match")
-	}
-	// The fetch block may specify either Domain or DomainRE.
-	if pattern.Domain != "" && url.Host != pattern.Domain {
-		return errors.New("Domain doesn't match")
+	if len(matches) > 1 {
+		return nil, nil, nil, nil, util.NewHTTPError(http.StatusInternalServerError, "fetch/sign URLs ambiguously match URLSets ", strings.Join(matches, ", "))
 	}
-	if pattern.DomainRE != "" && !regexpFullMatch(pattern.DomainRE, url.Host) {
-		return errors.New("DomainRE doesn't match")
+	if match == nil {
+		return nil, signURL, nil, nil, util.NewHTTPError(http.StatusBadRequest, "fetch/sign URLs do not match config; caused by: ", strings.Join(errs, ", "))
 	}
-	return urlMatches(url, *pattern)
-}
-
-// Determines if b is either a valid byte of a fallback URL, per
-// https://wicg.github.io/webpackage/draft-yasskin-http-origin-signed-responses.html#seccons-content-sniffing
-// item 3.1, or is the U+0025 (%) character.
-func isFallbackURLCodePoint(b byte) bool {
-	// https://url.spec.whatwg.org/#url-code-points, but in codepoint order:
-	//
-	// U+0021 (!), U+0024 ($), U+0026 (&), U+0027 ('), U+0028 LEFT PARENTHESIS,
-	// U+0029 RIGHT PARENTHESIS, U+002A (*), U+002B (+), U+002C (,), U+002D (-),
-	// U+002E (.), U+002F (/), ASCII digits (U+0030 - U+0039), U+003A (:),
-	// U+003B (;), U+003D (=), U+003F (?), U+0040 (@),
-	// ASCII upper alpha (U+0041 - U+005A), U+005F (_),
-	// ASCII lower alpha (U+0061 - U+007A), U+007E (~)
-
-	// Vaguely ordered most to least common, to aid short-circuiting:
-	return (b >= 'a' && b <= 'z') || b == '_' || b == '~' ||
-		(b >= '!' && b <= 'Z' && b != '"' /*x22*/ && b != '#' /*x23*/ && b != '<' /*x3C*/ && b != '>' /*x3E*/)
-}
-
-// True iff url matches pattern, as defined by an [URLSet.Sign] block in the
-// config file. The format of this URLPattern is validated by
-// validateSignURLPattern in config.go.
-func signURLMatches(url *url.URL, pattern *util.URLPattern) error {
-	for _, b := range []byte(url.String()) {
-		if !isFallbackURLCodePoint(b) {
-			return errors.New("Contains invalid byte")
+	// The normalized URL is the one signed, so it too must be allowed by the
+	// URLSet, e.g. by its PathRE.
+	normalizedURL := normalizeTrailingSlash(signURL, match.TrailingSlash)
+	if match.TrailingSlash != "" {
+		if err := match.MatchURLs(fetchURL, normalizedURL); err != nil {
+			return nil, signURL, nil, nil, util.NewHTTPError(http.StatusBadRequest, "normalized sign URL does not match config; caused by: ", err)
 		}
 	}
-
-	// The sign block may not specify which schemes are allowed. Only HTTPS
-	// is allowed:
-	// https://wicg.github.io/webpackage/draft-yasskin-httpbis-origin-signed-exchanges-impl.html#rfc.section.5.3
-	if url.Scheme != "https" {
-		return errors.New("Scheme doesn't match")
-	}
-	// The sign block may only specify Domain. DomainRE would only be
-	// useful for wildcard SXG certificates. Please open an issue if you
-	// have a valid wildcard SXG certificate and a legitimate need for
-	// this. This should be implemented with some thought into how to
-	// ensure that the sign URL matches the fetch URL.
-	if url.Host != pattern.Domain {
-		return errors.New("Domain doesn't match")
+	if fetchURL == nil {
+		fetchURL = signURL
+		if match.UpstreamBaseURL != "" {
+			upstream, err := url.Parse(match.UpstreamBaseURL)
+			if err != nil {
+				return nil, nil, nil, nil, util.NewHTTPError(http.StatusInternalServerError, "Error parsing UpstreamBaseURL: ", err)
+			}
+			fetchURL = rebaseURL(signURL, upstream)
+		}
 	}
-	return urlMatches(url, *pattern)
+	return fetchURL, normalizedURL, signURL, match, nil
 }
 
-// True iff the given fetchURL and signURL match the given set (as specified by
-// an [[URLSet]] block in the config file), and, if SamePath is true (default),
-// fetchURL and signURL match each other.
-func urlsMatch(fetchURL *url.URL, signURL *url.URL, set util.URLSet) error {
-	if err := fetchURLMatches(fetchURL, set.Fetch); err != nil {
-		return errors.Wrap(err, "fetch URL")
-	}
-	if err := signURLMatches(signURL, set.Sign); err != nil {
-		return errors.Wrap(err, "sign URL")
-	}
-	theyMatch := set.Fetch == nil || !*set.Fetch.SamePath || fetchURL.RequestURI() == signURL.RequestURI()
-	if !theyMatch {
-		return errors.New("fetch and sign paths don't match")
-	}
-	return nil
+// Returns a copy of u with its scheme and host replaced by base's.
+func rebaseURL(u *url.URL, base *url.URL) *url.URL {
+	rebased := *u
+	rebased.Scheme = base.Scheme
+	rebased.Host = base.Host
+	return &rebased
 }
 
-// If the given fetch and sign URLs are valid, and match at least one of the
-// urlSets (as specified by the [[URLSet]] blocks in the config file), then
-// this returns the parsed URLs as well as a bool containing the value of
-// ErrorOnStatefulHeaders for the first matching URLSet. Otherwise, returns an
-// error.
-func parseURLs(fetch string, sign string, urlSets []util.URLSet) (*url.URL, *url.URL, bool, *util.HTTPError) {
-	var fetchURL *url.URL
-	var err *util.HTTPError
-	if fetch != "" {
-		fetchURL, err = parseURL(fetch, "fetch")
-		if err != nil {
-			// TODO(twifkak): Use errors.Wrap() after changing return types to error.
-			return nil, nil, false, err
+// Returns a copy of u with a trailing slash added to or removed from its path,
+// per the given policy (see util.URLSet.TrailingSlash). The root path is left
+// unmodified.
+func normalizeTrailingSlash(u *url.URL, policy string) *url.URL {
+	normalize := func(p string) string {
+		switch policy {
+		case "add":
+			if !strings.HasSuffix(p, "/") && !strings.Contains(path.Base(p), ".") {
+				return p + "/"
+			}
+		case "remove":
+			if trimmed := strings.TrimRight(p, "/"); trimmed != "" {
+				return trimmed
+			}
 		}
+		return p
 	}
-	signURL, err := parseURL(sign, "sign")
-	if err != nil {
-		// TODO(twifkak): Use errors.Wrap() after changing return types to error.
-		return nil, nil, false, err
+	if u.Path == "" || u.Path == "/" {
+		return u
 	}
-
-	errs := []string{}
-	for _, set := range urlSets {
-		err := urlsMatch(fetchURL, signURL, set)
-		if err == nil {
-			if fetchURL == nil {
-				fetchURL = signURL
-			}
-			return fetchURL, signURL, set.Sign.ErrorOnStatefulHeaders, nil
-		}
-		errs = append(errs, err.Error())
+	normalized := *u
+	normalized.Path = normalize(u.Path)
+	if u.RawPath != "" {
+		normalized.RawPath = normalize(u.RawPath)
 	}
-	return nil, nil, false, util.NewHTTPError(http.StatusBadRequest, "fetch/sign URLs do not match config; caused by: ", strings.Join(errs, ", "))
+	return &normalized
 }
 
 // Given a request/response pair for the fetch from the packager to the backend
@@ -267,3 +195,65 @@ func validateFetch(req *http.Request, resp *http.Response) error {
 	}
 	return nil
 }
+
+// Splits the list of ";"-separated tokens, ignoring optional whitespace around
+// the separators. Returns an error if any isn't a token.
+func splitVariantTokens(item string) ([]string, error) {
+	values := strings.Split(item, ";")
+	for i := range values {
+		values[i] = strings.Trim(values[i], " \t")
+		if !httpguts.ValidHeaderFieldName(values[i]) {
+			return nil, errors.Errorf("invalid token %q", values[i])
+		}
+	}
+	return values, nil
+}
+
+// Validates the Variants and Variant-Key headers of the response, per
+// https://tools.ietf.org/html/draft-ietf-httpbis-variants-06#section-2:
+//
+//	Variants     = 1#variant-item
+//	variant-item = field-name *( OWS ";" OWS available-value )
+//	Variant-Key  = 1#variant-key
+//	variant-key  = available-value *( OWS ";" OWS available-value )
+//
+// where available-value is a token. Additionally, each variant-key must have
+// one available-value of each variant-item, in order, so that the signed
+// exchange identifies which variant it is. It's valid for neither header to be
+// present.
+func validateVariants(header http.Header) error {
+	variants, variantKey := GetJoined(header, "Variants"), GetJoined(header, "Variant-Key")
+	if variants == "" && variantKey == "" {
+		return nil
+	}
+	if variants == "" || variantKey == "" {
+		return errors.New("Variants and Variant-Key must both be present")
+	}
+	var available [][]string
+	for _, item := range strings.Split(variants, ",") {
+		values, err := splitVariantTokens(item)
+		if err != nil {
+			return errors.Wrap(err, "parsing Variants")
+		}
+		available = append(available, values[1:])
+	}
+	for _, key := range strings.Split(variantKey, ",") {
+		values, err := splitVariantTokens(key)
+		if err != nil {
+			return errors.Wrap(err, "parsing Variant-Key")
+		}
+		if len(values) != len(available) {
+			return errors.Errorf("Variant-Key %q has %d values, but Variants has %d items", strings.TrimSpace(key), len(values), len(available))
+		}
+	nextValue:
+		for i, value := range values {
+			for _, availableValue := range available[i] {
+				if value == availableValue {
+					continue nextValue
+				}
+			}
+			return errors.Errorf("Variant-Key value %q is not available in Variants", value)
+		}
+	}
+	return nil
+}
@@ -4,7 +4,6 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
-	"strings"
 	"testing"
 
 	"github.com/ampproject/amppackager/packager/util"
@@ -33,120 +32,48 @@ func TestParseURL(t *testing.T) {
 	assert.Equal(t, "http://foo.com/baz", urlFrom(parseURL("http://foo.com/bar/../baz", "sign")).String())
 }
 
-func TestFetchURLMatches(t *testing.T) {
-	assert.NoError(t, fetchURLMatches(nil, nil))
-	assert.NoError(t, fetchURLMatches(urlOrDie("http://example.com/"),
-		&util.URLPattern{Scheme: []string{"http"}, PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000}))
-	assert.NoError(t, fetchURLMatches(urlOrDie("http://example.com/"),
-		&util.URLPattern{Scheme: []string{"http"}, Domain: "example.com", PathRE: stringPtr("/"), QueryRE: stringPtr(""), MaxLength: 2000}))
-	assert.NoError(t, fetchURLMatches(urlOrDie("http://example.com/"),
-		&util.URLPattern{Scheme: []string{"http"}, DomainRE: "example.*", PathRE: stringPtr("/"), QueryRE: stringPtr(""), MaxLength: 2000}))
-
-	assert.EqualError(t, fetchURLMatches(urlOrDie("http://example.com/"), nil),
-		"If URLSet.Fetch is unspecified, then so should ?fetch= be.")
-	assert.EqualError(t, fetchURLMatches(urlOrDie("http://example.com/"),
-		&util.URLPattern{Scheme: []string{"https"}, PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000}),
-		"Scheme doesn't match")
-	assert.EqualError(t, fetchURLMatches(urlOrDie("http://example.com/"),
-		&util.URLPattern{Scheme: []string{"http"}, Domain: "wrongexample.com", PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000}),
-		"Domain doesn't match")
-	assert.EqualError(t, fetchURLMatches(urlOrDie("http://example.com:1234/"),
-		&util.URLPattern{Scheme: []string{"http"}, Domain: "example.com", PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000}),
-		"Domain doesn't match")
-	assert.EqualError(t, fetchURLMatches(urlOrDie("http://example.com/"),
-		&util.URLPattern{Scheme: []string{"http"}, DomainRE: "xample", PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000}),
-		"DomainRE doesn't match")
-
-	assert.EqualError(t, fetchURLMatches(urlOrDie("http:example.com/"),
-		&util.URLPattern{Scheme: []string{"http"}, PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000}),
-		"URL is opaque")
-	assert.EqualError(t, fetchURLMatches(urlOrDie("http://user@example.com/"),
-		&util.URLPattern{Scheme: []string{"http"}, PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000}),
-		"URL contains user")
-	assert.EqualError(t, fetchURLMatches(urlOrDie("http://example.com/"),
-		&util.URLPattern{Scheme: []string{"http"}, PathRE: stringPtr("/amp/.*"), QueryRE: stringPtr(".*"), MaxLength: 2000}),
-		"PathRE doesn't match")
-	assert.EqualError(t, fetchURLMatches(urlOrDie("http://example.com/"),
-		&util.URLPattern{Scheme: []string{"http"}, PathRE: stringPtr(".*"), PathExcludeRE: []string{"/"}, QueryRE: stringPtr(".*"), MaxLength: 2000}),
-		"PathExcludeRE matches: /")
-	assert.EqualError(t, fetchURLMatches(urlOrDie("http://example.com/?sessid=foo"),
-		&util.URLPattern{Scheme: []string{"http"}, PathRE: stringPtr(".*"), QueryRE: stringPtr(""), MaxLength: 2000}),
-		"QueryRE doesn't match")
-	assert.EqualError(t, fetchURLMatches(urlOrDie("http://example.com/"),
-		&util.URLPattern{Scheme: []string{"http"}, PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 10}),
-		"URL too long")
-}
-
-func TestIsFallbackURLCodePoint(t *testing.T) {
-	// https://url.spec.whatwg.org/#url-code-points + "%", in codepoint order:
-	validURLCodepoints := `!$%&'()*+,-./0123456789:;=?@ABCDEFGHIJKLMNOPQRSTUVWXYZ_abcdefghijklmnopqrstuvwxyz~`
-	for b := 0; b < 0x100; b++ {
-		expected := strings.ContainsRune(validURLCodepoints, rune(b))
-		assert.Equal(t, expected, isFallbackURLCodePoint(byte(b)), "char: %#v", string(rune(b)))
-	}
-}
-
-func TestSignURLMatches(t *testing.T) {
-	assert.NoError(t, signURLMatches(urlOrDie("https://example.com/"),
-		&util.URLPattern{Domain: "example.com", PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000}))
-
-	assert.EqualError(t, signURLMatches(urlOrDie("http://example.com/"),
-		&util.URLPattern{Domain: "example.com", PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000}),
-		"Scheme doesn't match")
-	assert.EqualError(t, signURLMatches(urlOrDie("https://wrongexample.com/"),
-		&util.URLPattern{Domain: "example.com", PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000}),
-		"Domain doesn't match")
-}
-
-func TestURLsMatch(t *testing.T) {
-	config := util.URLSet{
-		Fetch: &util.URLPattern{
-			Scheme: []string{"http"}, Domain: "fetch.com",
-			PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000,
-			SamePath: boolPtr(true)},
-		Sign: &util.URLPattern{
-			Domain: "sign.com",
-			PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000},
-	}
-
-	assert.NoError(t, urlsMatch(urlOrDie("http://fetch.com/"), urlOrDie("https://sign.com/"), config))
-
-	assert.EqualError(t, urlsMatch(urlOrDie("https://fetch.com/"), urlOrDie("https://sign.com/"), config),
-		"fetch URL: Scheme doesn't match")
-	assert.EqualError(t, urlsMatch(urlOrDie("http://fetch.com/"), urlOrDie("http://sign.com/"), config),
-		"sign URL: Scheme doesn't match")
-	assert.EqualError(t, urlsMatch(urlOrDie("http://fetch.com/"), urlOrDie("https://sign.com/other"), config),
-		"fetch and sign paths don't match")
-
-	*config.Fetch.SamePath = false
-	assert.NoError(t, urlsMatch(urlOrDie("http://fetch.com/"), urlOrDie("https://sign.com/other"), config))
-}
-
 func TestParseURLs(t *testing.T) {
-	if _, _, _, err := parseURLs("a%-", "b", []util.URLSet{}); assert.NotNil(t, err) {
+	if _, _, _, _, err := parseURLs("a%-", "b", []util.URLSet{}, false); assert.NotNil(t, err) {
 		assert.Contains(t, err.Error(), "fetch URL")
 	}
-	if _, _, _, err := parseURLs("http://a", "b%-", []util.URLSet{}); assert.NotNil(t, err) {
+	if _, _, _, _, err := parseURLs("http://a", "b%-", []util.URLSet{}, false); assert.NotNil(t, err) {
 		assert.Contains(t, err.Error(), "sign URL")
 	}
 
-	fetch, sign, errorOnStatefulHeaders, err := parseURLs("", "https://example.com/", []util.URLSet{
+	fetch, sign, _, set, err := parseURLs("", "https://example.com/", []util.URLSet{
 		{Sign: &util.URLPattern{Domain: "wrongexample.com", PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000}},
 		{Sign: &util.URLPattern{Domain: "example.com", PathRE: stringPtr("/amp/.*"), QueryRE: stringPtr(".*"), MaxLength: 2000}},
 		{Sign: &util.URLPattern{Domain: "example.com", PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000, ErrorOnStatefulHeaders: true}},
 		{Sign: &util.URLPattern{Domain: "badexample.com", PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000}},
-	})
+	}, false)
 	if assert.Nil(t, err) {
 		assert.Equal(t, "https://example.com/", fetch.String())
 		assert.Equal(t, "https://example.com/", sign.String())
-		assert.True(t, errorOnStatefulHeaders)
+		assert.True(t, set.Sign.ErrorOnStatefulHeaders)
+	}
+
+	fetch, sign, _, _, err = parseURLs("", "https://example.com/amp/a?b=c", []util.URLSet{
+		{Sign: &util.URLPattern{Domain: "example.com", PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000},
+			UpstreamBaseURL: "http://10.0.0.1:8080"},
+	}, false)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "http://10.0.0.1:8080/amp/a?b=c", fetch.String())
+		assert.Equal(t, "https://example.com/amp/a?b=c", sign.String())
+	}
+
+	// A non-HTTPS sign URL is rejected regardless of config.
+	_, _, _, _, err = parseURLs("", "http://example.com/", []util.URLSet{
+		{Sign: &util.URLPattern{Domain: "example.com", PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000}},
+	}, false)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "sign URL must be https, not http")
 	}
 
-	_, _, _, err = parseURLs("", "https://example.com/", []util.URLSet{
+	_, _, _, _, err = parseURLs("", "https://example.com/", []util.URLSet{
 		{Sign: &util.URLPattern{Domain: "wrongexample.com", PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000}},
 		{Sign: &util.URLPattern{Domain: "example.com", PathRE: stringPtr("/amp/.*"), QueryRE: stringPtr(".*"), MaxLength: 2000}},
 		{Sign: &util.URLPattern{Domain: "badexample.com", PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000}},
-	})
+	}, false)
 	if assert.NotNil(t, err) {
 		if assert.Error(t, err) {
 			assert.Contains(t, err.Error(), "fetch/sign URLs do not match config")
@@ -154,6 +81,88 @@ func TestParseURLs(t *testing.T) {
 	}
 }
 
+func TestParseURLsMatchPolicy(t *testing.T) {
+	urlSets := []util.URLSet{
+		{Sign: &util.URLPattern{Domain: "example.com", PathRE: stringPtr("/amp/.*"), QueryRE: stringPtr(".*"), MaxLength: 2000}},
+		{Sign: &util.URLPattern{Domain: "example.com", PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000, ErrorOnStatefulHeaders: true}},
+	}
+
+	// First match wins.
+	_, _, _, set, err := parseURLs("", "https://example.com/amp/a", urlSets, false)
+	if assert.Nil(t, err) {
+		assert.Equal(t, &urlSets[0], set)
+	}
+
+	// Overlapping matches are an error.
+	_, _, _, _, err = parseURLs("", "https://example.com/amp/a", urlSets, true)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "ambiguously match URLSets 0, 1")
+	}
+
+	// A single match is fine.
+	_, _, _, set, err = parseURLs("", "https://example.com/other", urlSets, true)
+	if assert.Nil(t, err) {
+		assert.Equal(t, &urlSets[1], set)
+	}
+}
+
+func TestNormalizeTrailingSlash(t *testing.T) {
+	tcs := []struct {
+		policy, url, expected string
+	}{
+		{"", "https://example.com/path/", "https://example.com/path/"},
+		{"", "https://example.com/path", "https://example.com/path"},
+		{"remove", "https://example.com/path/", "https://example.com/path"},
+		{"remove", "https://example.com/path//?a=b", "https://example.com/path?a=b"},
+		{"remove", "https://example.com/path", "https://example.com/path"},
+		{"remove", "https://example.com/", "https://example.com/"},
+		{"remove", "https://example.com/a%2Fb/", "https://example.com/a%2Fb"},
+		{"add", "https://example.com/path", "https://example.com/path/"},
+		{"add", "https://example.com/path/", "https://example.com/path/"},
+		{"add", "https://example.com/index.html", "https://example.com/index.html"},
+		{"add", "https://example.com", "https://example.com"},
+	}
+	for _, tc := range tcs {
+		u := urlOrDie(tc.url)
+		orig := u.String()
+		assert.Equal(t, tc.expected, normalizeTrailingSlash(u, tc.policy).String(), "%s %s", tc.policy, tc.url)
+		assert.Equal(t, orig, u.String(), "modified input")
+	}
+}
+
+func TestParseURLsNormalizesTrailingSlash(t *testing.T) {
+	for _, policy := range []string{"add", "remove"} {
+		var signed []string
+		for _, sign := range []string{"https://example.com/amp/a", "https://example.com/amp/a/"} {
+			fetch, signURL, _, _, err := parseURLs("", sign, []util.URLSet{
+				{Sign: &util.URLPattern{Domain: "example.com", PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000},
+					TrailingSlash: policy},
+			}, false)
+			if assert.Nil(t, err) {
+				// The requested URL is still fetched.
+				assert.Equal(t, sign, fetch.String())
+				signed = append(signed, signURL.String())
+			}
+		}
+		if assert.Len(t, signed, 2) {
+			assert.Equal(t, signed[0], signed[1], policy)
+		}
+	}
+}
+
+func TestParseURLsRematchesNormalizedURL(t *testing.T) {
+	// Only the requested URL is allowed by the PathRE, so the normalized one
+	// may not be signed.
+	_, signURL, _, _, err := parseURLs("", "https://example.com/amp/a/", []util.URLSet{
+		{Sign: &util.URLPattern{Domain: "example.com", PathRE: stringPtr("/amp/.*/"), QueryRE: stringPtr(".*"), MaxLength: 2000},
+			TrailingSlash: "remove"},
+	}, false)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "normalized sign URL does not match config")
+		assert.Equal(t, "https://example.com/amp/a/", signURL.String())
+	}
+}
+
 func TestValidateFetch(t *testing.T) {
 	req := httptest.NewRequest("", "/", nil)
 	resp := http.Response{Header: http.Header{}}
@@ -221,3 +230,32 @@ func TestValidateFetch(t *testing.T) {
 	resp.Header.Set("Content-Type", `text/html; charset="utf-8"`)
 	assert.NoError(t, validateFetch(req, &resp))
 }
+
+func TestValidateVariants(t *testing.T) {
+	variants := func(variants, variantKey string) http.Header {
+		header := http.Header{}
+		if variants != "" {
+			header.Set("Variants", variants)
+		}
+		if variantKey != "" {
+			header.Set("Variant-Key", variantKey)
+		}
+		return header
+	}
+	assert.NoError(t, validateVariants(variants("", "")))
+	assert.NoError(t, validateVariants(variants("Sec-CH-Viewport-Width;mobile;desktop", "mobile")))
+	assert.NoError(t, validateVariants(variants("Accept-Language ; en ; fr, Sec-CH-Viewport-Width;mobile;desktop", "fr;desktop, en ;mobile")))
+
+	assert.EqualError(t, validateVariants(variants("Sec-CH-Viewport-Width;mobile", "")),
+		"Variants and Variant-Key must both be present")
+	assert.EqualError(t, validateVariants(variants("", "mobile")),
+		"Variants and Variant-Key must both be present")
+	assert.EqualError(t, validateVariants(variants("Sec-CH-Viewport-Width;mobile;", "mobile")),
+		`parsing Variants: invalid token ""`)
+	assert.EqualError(t, validateVariants(variants("Sec-CH-Viewport-Width;mob\"ile", "mobile")),
+		`parsing Variants: invalid token "mob\"ile"`)
+	assert.EqualError(t, validateVariants(variants("Sec-CH-Viewport-Width;mobile", "mobile;desktop")),
+		`Variant-Key "mobile;desktop" has 2 values, but Variants has 1 items`)
+	assert.EqualError(t, validateVariants(variants("Sec-CH-Viewport-Width;mobile", "tablet")),
+		`Variant-Key value "tablet" is not available in Variants`)
+}
@@ -23,6 +23,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
@@ -174,17 +175,112 @@ func (r *Request) Do() *http.Response {
 	return rec.Result()
 }
 
+// FakeClock is a clock that advances by a fixed delta (by default, a second)
+// on every call to Now. It is safe for concurrent use.
 type FakeClock struct {
-	SecondsSince0 time.Duration
-	Delta         time.Duration
+	mu            sync.Mutex
+	secondsSince0 time.Duration
+	delta         time.Duration
 }
 
 func NewFakeClock() *FakeClock {
-	return &FakeClock{time.Now().Sub(time.Unix(0, 0)), time.Second}
+	return &FakeClock{secondsSince0: time.Now().Sub(time.Unix(0, 0)), delta: time.Second}
 }
 
 func (this *FakeClock) Now() time.Time {
-	secondsSince0 := this.SecondsSince0
-	this.SecondsSince0 = secondsSince0 + this.Delta
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	secondsSince0 := this.secondsSince0
+	this.secondsSince0 = secondsSince0 + this.delta
 	return time.Unix(0, 0).Add(secondsSince0)
 }
+
+// Set sets the time the next call to Now returns.
+func (this *FakeClock) Set(t time.Time) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.secondsSince0 = t.Sub(time.Unix(0, 0))
+}
+
+// Advance moves the clock forward by d.
+func (this *FakeClock) Advance(d time.Duration) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.secondsSince0 += d
+}
+
+// SetDelta sets how far the clock advances on every call to Now.
+func (this *FakeClock) SetDelta(d time.Duration) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.delta = d
+}
+
+// FakeACMEClient implements certfetcher.ACMEClient, without a CA, returning
+// Certs (or Err) to every request, and counting them.
+type FakeACMEClient struct {
+	Certs []*x509.Certificate
+	Err   error
+
+	mu           sync.Mutex
+	obtains      int
+	renewals     int
+	renewedCerts []*x509.Certificate
+}
+
+func (this *FakeACMEClient) Obtain(csr *x509.CertificateRequest) ([]*x509.Certificate, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.obtains++
+	return this.Certs, this.Err
+}
+
+func (this *FakeACMEClient) Renew(csr *x509.CertificateRequest, certs []*x509.Certificate) ([]*x509.Certificate, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.renewals++
+	this.renewedCerts = certs
+	return this.Certs, this.Err
+}
+
+// Obtains returns the number of calls to Obtain.
+func (this *FakeACMEClient) Obtains() int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.obtains
+}
+
+// Renewals returns the number of calls to Renew, and the certs passed to the
+// last of them.
+func (this *FakeACMEClient) Renewals() (int, []*x509.Certificate) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.renewals, this.renewedCerts
+}
+
+// FakeSigner implements crypto.Signer with Key, without exposing it as an
+// *ecdsa.PrivateKey, as a KMS-backed signer would, and counts its signatures.
+type FakeSigner struct {
+	Key crypto.Signer
+
+	mu    sync.Mutex
+	signs int
+}
+
+func (this *FakeSigner) Public() crypto.PublicKey {
+	return this.Key.Public()
+}
+
+func (this *FakeSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	this.mu.Lock()
+	this.signs++
+	this.mu.Unlock()
+	return this.Key.Sign(rand, digest, opts)
+}
+
+// Signs returns the number of calls to Sign.
+func (this *FakeSigner) Signs() int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.signs
+}
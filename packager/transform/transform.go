@@ -0,0 +1,129 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package transform serves the AMP transformer on its own, for debugging: it
+// responds to POSTed AMP HTML with the document as the signer would sign it.
+package transform
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ampproject/amppackager/packager/rtv"
+	"github.com/ampproject/amppackager/packager/util"
+	"github.com/ampproject/amppackager/transformer"
+	rpb "github.com/ampproject/amppackager/transformer/request"
+	"github.com/ampproject/amppackager/transformer/transformers"
+)
+
+// DocumentURLHeader is the request header naming the public URL of the
+// POSTed document, against which its relative URLs are resolved.
+const DocumentURLHeader = "Document-URL"
+
+// WarningHeader is the response header, repeated once per warning, describing
+// the non-fatal problems the transformers found, and the lossy changes they
+// made.
+const WarningHeader = "AMP-Transformer-Warning"
+
+// The default length at which documents are too large, the same as the
+// signer's default limit.
+const defaultMaxBodyLength = 4 << 20
+
+// The same request as the signer makes, so that the document is transformed
+// as it would be signed. Overridable for tests.
+var getTransformerRequest = func(r *rtv.RTVCache, s, u string) *rpb.Request {
+	return &rpb.Request{Html: s, DocumentUrl: u, Rtv: r.GetRTV(), Css: r.GetCSS(),
+		AllowedFormats: []rpb.Request_HtmlFormat{rpb.Request_AMP}}
+}
+
+type Transformer struct {
+	rtvCache      *rtv.RTVCache
+	maxBodyLength int
+	options       *rpb.Request_Options
+}
+
+func New(rtvCache *rtv.RTVCache) (*Transformer, error) {
+	return &Transformer{rtvCache: rtvCache, maxBodyLength: defaultMaxBodyLength}, nil
+}
+
+// SetMaxBodyLength sets the length, in bytes, at which documents are too
+// large to transform, and answered with a 413. It should match the signer's
+// (see signer.SetMaxBodyLength), so that the documents accepted are those the
+// signer would sign. Zero selects the default.
+func (this *Transformer) SetMaxBodyLength(length int) {
+	if length <= 0 {
+		length = defaultMaxBodyLength
+	}
+	this.maxBodyLength = length
+}
+
+// SetOptions sets the options with which documents are transformed. They
+// should match the signer's (see signer.SetTransformerOptions).
+func (this *Transformer) SetOptions(options *rpb.Request_Options) {
+	this.options = options
+}
+
+func (this *Transformer) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	documentURL, err := url.Parse(req.Header.Get(DocumentURLHeader))
+	if err != nil || !documentURL.IsAbs() {
+		http.Error(resp, "400 bad request - "+DocumentURLHeader+" header must be an absolute URL", http.StatusBadRequest)
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, int64(this.maxBodyLength)))
+	if err != nil {
+		util.NewHTTPError(http.StatusBadRequest, "Error reading body: ", err).LogAndRespond(resp)
+		return
+	}
+	if len(body) >= this.maxBodyLength {
+		http.Error(resp, "413 request entity too large - limit is "+strconv.Itoa(this.maxBodyLength)+" bytes", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	r := getTransformerRequest(this.rtvCache, string(body), documentURL.String())
+	r.Options = this.options
+	context := transformers.Context{}
+	transformed, _, err := transformer.ProcessWithContext(r, &context)
+	if err != nil {
+		// The error describes the document, not the packager, so it is
+		// of use to the client.
+		http.Error(resp, "400 bad request - "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, warning := range context.Warnings {
+		resp.Header().Add(WarningHeader, headerSafe(warning.String()))
+	}
+	resp.Header().Set("Content-Type", "text/html; charset=utf-8")
+	resp.Header().Set("Cache-Control", "no-store")
+	resp.Header().Set("X-Content-Type-Options", "nosniff")
+	// The document is arbitrary client-supplied markup, so it mustn't run
+	// with the packager's origin.
+	resp.Header().Set("Content-Security-Policy", "sandbox")
+	resp.Write([]byte(transformed))
+}
+
+// headerSafe replaces the characters that may not appear in a header value,
+// e.g. newlines in quoted markup, with spaces.
+func headerSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, s)
+}
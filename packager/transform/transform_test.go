@@ -0,0 +1,115 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/packager/mux"
+	"github.com/ampproject/amppackager/packager/rtv"
+	pkgt "github.com/ampproject/amppackager/packager/testing"
+	rpb "github.com/ampproject/amppackager/transformer/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	// Don't fetch the runtime.
+	getTransformerRequest = func(r *rtv.RTVCache, s, u string) *rpb.Request {
+		return &rpb.Request{Html: s, DocumentUrl: u, AllowedFormats: []rpb.Request_HtmlFormat{rpb.Request_AMP}}
+	}
+}
+
+func transform(t *testing.T, documentURL, body string) *http.Response {
+	handler, err := New(&rtv.RTVCache{})
+	require.NoError(t, err)
+	return transformWith(t, handler, documentURL, body)
+}
+
+func transformWith(t *testing.T, handler *Transformer, documentURL, body string) *http.Response {
+	header := http.Header{}
+	if documentURL != "" {
+		header.Set(DocumentURLHeader, documentURL)
+	}
+	return pkgt.NewRequest(t, mux.New(mux.Handlers{Transform: handler}), "/amppkg/transform").
+		SetHeaders("", header).SetBody(strings.NewReader(body)).Do()
+}
+
+func TestTransform(t *testing.T) {
+	resp := transform(t, "https://example.com/amp.html",
+		`<html amp><head><title>One</title><!-- secret --><title>Two</title></head><body><a href="/page.html">link</a></body></html>`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "sandbox", resp.Header.Get("Content-Security-Policy"))
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	// The comment and the second title are stripped, and the link made
+	// absolute.
+	assert.NotContains(t, string(body), "secret")
+	assert.Contains(t, string(body), "<title>One</title>")
+	assert.NotContains(t, string(body), "Two")
+	assert.Contains(t, string(body), "href=https://example.com/page.html>")
+	assert.Contains(t, string(body), "transformed=")
+	warnings := resp.Header[http.CanonicalHeaderKey(WarningHeader)]
+	if assert.Len(t, warnings, 1) {
+		assert.Contains(t, warnings[0], "duplicate-title: removed extra <title> in <head>")
+	}
+}
+
+func TestTransformMissingDocumentURL(t *testing.T) {
+	for _, documentURL := range []string{"", "/relative.html"} {
+		resp := transform(t, documentURL, `<html amp><body></body></html>`)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "%q", documentURL)
+	}
+}
+
+func TestTransformNonAMP(t *testing.T) {
+	resp := transform(t, "https://example.com/", `<html><body></body></html>`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "400 bad request - ")
+}
+
+func TestTransformTooLarge(t *testing.T) {
+	resp := transform(t, "https://example.com/", `<html amp><body>`+strings.Repeat("a", defaultMaxBodyLength)+`</body></html>`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
+func TestTransformMaxBodyLength(t *testing.T) {
+	handler, err := New(&rtv.RTVCache{})
+	require.NoError(t, err)
+	handler.SetMaxBodyLength(100)
+	small := `<html amp><body></body></html>`
+	resp := transformWith(t, handler, "https://example.com/", small)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	// As for the signer, a document of the limit's length is too large.
+	resp = transformWith(t, handler, "https://example.com/", small+strings.Repeat(" ", 100-len(small)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
+func TestTransformOptions(t *testing.T) {
+	handler, err := New(&rtv.RTVCache{})
+	require.NoError(t, err)
+	handler.SetOptions(&rpb.Request_Options{InjectTitle: true, DefaultTitle: "Default"})
+	resp := transformWith(t, handler, "https://example.com/", `<html amp><head></head><body></body></html>`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "<title>Default</title>")
+}
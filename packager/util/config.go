@@ -15,12 +15,25 @@
 package util
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 
+	"github.com/WICG/webpackage/go/signedexchange"
+	"github.com/ampproject/amppackager/transformer"
+	rpb "github.com/ampproject/amppackager/transformer/request"
+	"github.com/golang/protobuf/jsonpb"
 	"github.com/pelletier/go-toml"
 	"github.com/pkg/errors"
+	"golang.org/x/net/http/httpguts"
 )
 
 type Config struct {
@@ -28,7 +41,80 @@ type Config struct {
 	Port      int
 	CertFile  string // This must be the full certificate chain.
 	KeyFile   string // Just for the first cert, obviously.
+	KeyEnv    string // Alternatively, the environment variable holding the PEM of the key.
+	KeySigner string // Alternatively, the name of a crypto.Signer registered with RegisterKeySigner.
 	CSRFile   string // Certificate Signing Request.
+	SCTFile   string // SignedCertificateTimestampList for the cert in CertFile.
+
+	// If positive, CertFile is checked for modifications this often, and if
+	// replaced with a new cert chain, it is served in place of the old one.
+	CertFileWatchIntervalSeconds int
+
+	// When to refresh the OCSP response: after this fraction of its validity
+	// period (default 0.5), bounded by the min and max intervals (default
+	// unbounded) after its ThisUpdate.
+	OCSPRefreshFraction           float64
+	OCSPMinRefreshIntervalSeconds int
+	OCSPMaxRefreshIntervalSeconds int
+
+	// Alternatively, with OCSPRefreshStrategy OCSPRefreshFixed (rather than
+	// the default, OCSPRefreshMidpoint), refresh a fixed interval after its
+	// ThisUpdate, but never later than its NextUpdate.
+	OCSPRefreshStrategy        string
+	OCSPRefreshIntervalSeconds int
+
+	// How far in the future (default 300, if unset) the ThisUpdate and
+	// ProducedAt of an OCSP response may be, to tolerate clock skew with the
+	// OCSP responder. Zero tolerates none.
+	OCSPClockSkewSeconds *int
+
+	// How the OCSP response for NewCertFile is obtained, before it replaces
+	// CertFile: RenewalOCSPReuse (the default) or RenewalOCSPFetch.
+	RenewalOCSPBootstrap string
+
+	// When auto-renewing certs, renew once this fraction of the cert's
+	// lifetime (default 2/3) has elapsed, but no later than 8 days before its
+	// expiry. Check this often (default 86400).
+	CertRenewalFraction             float64
+	CertRenewalCheckIntervalSeconds int
+
+	// How long signed exchanges are valid for, i.e. their signature's
+	// expires minus date (default 604800, the maximum allowed, to which
+	// larger values are clamped). Must be at least 3600.
+	SignatureDurationSeconds int
+
+	// The size of the records into which signed payloads are MI-encoded
+	// (default 16384, the maximum allowed).
+	MIRecordSize int
+
+	// Documents of this many bytes or more (default 4194304, the limit of AMP
+	// Caches), either as fetched or as transformed, are not signed. They are
+	// proxied unsigned, or if ErrorOnOversizedBody is true, answered with a
+	// 502. The fetched body is read only up to the limit.
+	MaxSignableBodyLength int
+	ErrorOnOversizedBody  bool
+
+	// How long each request may take (default 10), including the fetch from
+	// the origin and any OCSP fetch made while deciding whether to sign,
+	// before it is cancelled and answered with a 504.
+	RequestTimeoutSeconds int
+
+	// On SIGINT or SIGTERM, the server stops accepting connections, and
+	// waits this long (default 30) for in-flight requests to finish.
+	ShutdownGracePeriodSeconds int
+
+	// What to do on SIGHUP: SIGHUPRefreshOCSP, to fetch a new OCSP response
+	// even if the cached one isn't due for refresh, or SIGHUPIgnore. If
+	// unset, SIGHUP terminates the server, as by default.
+	SIGHUPAction string
+
+	// If ValidateAMP is true, transformed documents are checked for AMP
+	// validity before signing, and invalid ones are answered with a 502,
+	// unless SignInvalidAMP is true. If the validator itself fails, they are
+	// signed if ValidatorFailOpen is true, and otherwise answered with a 502.
+	ValidateAMP       bool
+	SignInvalidAMP    bool
+	ValidatorFailOpen bool
 
 	// When set, both CertFile and NewCertFile will be read/write. CertFile and
 	// NewCertFile will be set when both are valid and that once CertFile becomes
@@ -38,14 +124,57 @@ type Config struct {
 	// ammpackager are running).
 	NewCertFile             string // The new full certificate chain replacing the expired one.
 	OCSPCache               string
+	OCSPLockTimeoutSeconds  int    // How long a replica may hold the lock on OCSPCache while refreshing it.
+	OCSPCABundle            string // PEM file of extra CAs to trust for HTTPS connections to the OCSP responder.
+	CRLFallback             bool   // If true, consult the CRL when no valid OCSP response is available.
+	OCSPNonce               bool   // If true, send a nonce in OCSP requests, and reject responses echoing a different one.
+	OCSPNonceRequired       bool   // If true, also reject OCSP responses that don't echo the nonce. Implies OCSPNonce.
+	OCSPMaxHostFetches      int    // If positive, the most OCSP requests that may be in flight to any one responder host.
+	ReferrerPolicy          string // If set, the Referrer-Policy of signed responses.
+	ErrorOnNonHTML          bool   // If true, respond 502 rather than proxying unsigned when the origin's Content-Type isn't text/html or in NonHTMLProxyTypes.
+	NonHTMLProxyTypes       []string
+	URLSetMatch             string // How to choose among multiple matching URLSets: URLSetMatchFirst (the default) or URLSetMatchUnique.
+	UnmatchedURL            string // How to respond when no URLSet matches: UnmatchedURLBadRequest (the default), UnmatchedURLNotFound, UnmatchedURLForbidden, or UnmatchedURLProxy.
+	CanonicalLinkHeader     bool   // If true, add a Link: rel=canonical header, reflecting the document's canonical URL, to the outer SXG response.
+	RequireHTTPSFetch       bool   // If true, require fetch URLs (URLSet.Fetch and UpstreamBaseURL), as well as sign URLs, to be HTTPS.
+	NoSniff                 bool   // If true, add X-Content-Type-Options: nosniff to all responses, including unsigned and error responses.
+	ServeTransform          bool   // If true, serve the transformer on its own at /amppkg/transform, for debugging.
+	OuterCacheControl       string // How the max-age of the outer SXG response is chosen: OuterCacheControlZero (the default), OuterCacheControlClamp, or OuterCacheControlOverride.
+	OuterMaxAgeSeconds      int    // The ceiling on, or with OuterCacheControlOverride the value of, the outer max-age.
+	HealthzCertExpiryDays   int    // /healthz fails once the cert is within this many days (default 7) of its expiry.
+	HealthzUpstreamURL      string // If set, /healthz fails unless a GET of this URL, e.g. a page of the origin, gets a non-5xx response.
 	ForwardedRequestHeaders []string
+	SignedResponseHeaders   []string // If set, only these of the origin's response headers (and Content-Type) are signed.
+	StrippedResponseHeaders []string // The origin's response headers never to sign, e.g. Server.
+	SignContentLanguage     bool     // If true, the origin's Content-Language is signed, if well-formed, regardless of the above.
 	URLSet                  []URLSet
 	ACMEConfig              *ACMEConfig
+
+	// Options for the transformers, e.g. to enable those that are off by
+	// default. Set by the [TransformerOptions] table, whose keys are the
+	// field names of Request.Options in transformer/request/request.proto.
+	TransformerOptions *rpb.Request_Options `toml:"-"`
 }
 
 type URLSet struct {
 	Fetch *URLPattern
 	Sign  *URLPattern
+	// If set, and Fetch is not, documents are fetched from this base URL
+	// (e.g. of an internal load balancer) instead of the sign URL's origin,
+	// keeping the sign URL's path and query, and its host as the Host header.
+	UpstreamBaseURL string
+	// If "add" or "remove", a trailing slash is added to or removed from the
+	// path of the signed URL, so that e.g. /path and /path/ are signed as one
+	// URL. The document is still fetched from the requested URL. "add" leaves
+	// paths whose last segment looks like a file name (e.g. /index.html)
+	// unmodified.
+	TrailingSlash string
+	// If true, responses with Variants and Variant-Key headers (e.g. for
+	// mobile and desktop markup) are signed, rather than proxied unsigned,
+	// with the headers kept in the signed inner response. They must be
+	// well-formed, and the Variant-Key must list an available value of
+	// each of the Variants.
+	AllowVariants bool
 }
 
 type URLPattern struct {
@@ -57,7 +186,21 @@ type URLPattern struct {
 	QueryRE                *string
 	ErrorOnStatefulHeaders bool
 	MaxLength              int
+	QueryMaxLength         int
 	SamePath               *bool
+
+	// DomainRE, PathRE, PathExcludeRE, and QueryRE, compiled by
+	// ValidateURLPattern. See the *Matches methods.
+	compiled *compiledURLPattern
+}
+
+// The regexps of a URLPattern, anchored to match the entire string. Any may be
+// nil, if absent or invalid.
+type compiledURLPattern struct {
+	domainRE      *regexp.Regexp
+	pathRE        *regexp.Regexp
+	pathExcludeRE []*regexp.Regexp
+	queryRE       *regexp.Regexp
 }
 
 type ACMEConfig struct {
@@ -70,6 +213,11 @@ type ACMEServerConfig struct {
 	AccountURL string
 	// ACME Account URL. If non-empty, we will auto-renew cert via ACME.
 	DiscoURL string
+	// Alternative name for DiscoURL; at most one of them may be set.
+	ACMEDirectoryURL string
+	// The type of key lego uses for the certificates it requests:
+	// ACMEKeyTypeEC256 (the default), ACMEKeyTypeRSA2048 or ACMEKeyTypeRSA4096.
+	ACMEKeyType string
 	// Email address registered with ACME CA.
 	EmailAddress string
 	// Key Identifier from ACME CA. Used for External Account Binding.
@@ -77,17 +225,27 @@ type ACMEServerConfig struct {
 	// MAC Key from ACME CA. Used for External Account Binding. Should be in
 	// Base64 URL Encoding without padding format.
 	EABHmac string
+	// Alternatively to EABKid and EABHmac, files containing them (e.g. mounted
+	// secrets), or environment variables set to them. At most one source may
+	// be set for each.
+	EABKidFile  string
+	EABHmacFile string
+	EABKidEnv   string
+	EABHmacEnv  string
 
 	// See: https://letsencrypt.org/docs/challenge-types/
-	// For non-wildcard domains, only one of HttpChallengePort, HttpWebRootDir or
-	// TlsChallengePort needs to be present.
+	// For non-wildcard domains, only one of HttpChallengePort, HttpWebRootDir,
+	// HttpChallengeMux or TlsChallengePort needs to be present.
 	// HttpChallengePort means AmpPackager will respond to HTTP challenges via this port.
 	// HttpWebRootDir means AmpPackager will deposit challenge token in this directory.
+	// HttpChallengeMux means AmpPackager will respond to HTTP challenges via its own
+	// server (i.e. Port), at /.well-known/acme-challenge/.
 	// TlsChallengePort means AmpPackager will respond to TLS challenges via this port.
 	// For wildcard domains, DnsProvider must be set to one of the support LEGO configs:
 	// https://go-acme.github.io/lego/dns/
 	HttpChallengePort int    // ACME HTTP challenge port.
 	HttpWebRootDir    string // ACME HTTP web root directory where challenge token will be deposited.
+	HttpChallengeMux  bool   // ACME HTTP challenge served by the amppkg server itself.
 	TlsChallengePort  int    // ACME TLS challenge port.
 	DnsProvider       string // ACME DNS Provider used for challenge.
 }
@@ -99,29 +257,110 @@ type ACMEServerConfig struct {
 var emptyRegexp = ""
 var defaultPathRegexp = ".*"
 
-// Also sets defaults.
+// Also sets defaults, and compiles the pattern's regexps for reuse.
 func ValidateURLPattern(pattern *URLPattern) error {
 	if pattern.PathRE == nil {
 		pattern.PathRE = &defaultPathRegexp
-	} else if _, err := regexp.Compile(*pattern.PathRE); err != nil {
-		return errors.New("PathRE must be a valid regexp")
-	}
-	for _, exclude := range pattern.PathExcludeRE {
-		if _, err := regexp.Compile(exclude); err != nil {
-			return errors.Errorf("PathExcludeRE contains invalid regexp %q", exclude)
-		}
 	}
 	if pattern.QueryRE == nil {
 		pattern.QueryRE = &emptyRegexp
-	} else if _, err := regexp.Compile(*pattern.QueryRE); err != nil {
-		return errors.New("QueryRE must be a valid regexp")
 	}
+	compiled, errs := compileURLPattern(pattern)
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	pattern.compiled = compiled
 	if pattern.MaxLength == 0 {
 		pattern.MaxLength = 2000
 	}
+	if pattern.QueryMaxLength < 0 {
+		return errors.New("QueryMaxLength must be non-negative")
+	}
 	return nil
 }
 
+// Compiles a regexp matching the entire string, if pattern does.
+func compileFullMatch(pattern string) (*regexp.Regexp, error) {
+	// Compile it as is first, so that any error refers to the pattern as
+	// written.
+	if _, err := regexp.Compile(pattern); err != nil {
+		return nil, err
+	}
+	// This is how regexp/exec_test.go turns a partial pattern into a full pattern.
+	return regexp.Compile(`\A(?:` + pattern + `)\z`)
+}
+
+// Compiles the regexps of the given pattern, returning an error for each that
+// doesn't compile.
+func compileURLPattern(pattern *URLPattern) (*compiledURLPattern, []error) {
+	compiled := &compiledURLPattern{}
+	var errs []error
+	var err error
+	if pattern.DomainRE != "" {
+		if compiled.domainRE, err = compileFullMatch(pattern.DomainRE); err != nil {
+			errs = append(errs, errors.Errorf("DomainRE must be a valid regexp: %s", err))
+		}
+	}
+	if pattern.PathRE != nil {
+		if compiled.pathRE, err = compileFullMatch(*pattern.PathRE); err != nil {
+			errs = append(errs, errors.Errorf("PathRE must be a valid regexp: %s", err))
+		}
+	}
+	for _, exclude := range pattern.PathExcludeRE {
+		re, err := compileFullMatch(exclude)
+		if err != nil {
+			errs = append(errs, errors.Errorf("PathExcludeRE contains invalid regexp %q: %s", exclude, err))
+		}
+		compiled.pathExcludeRE = append(compiled.pathExcludeRE, re)
+	}
+	if pattern.QueryRE != nil {
+		if compiled.queryRE, err = compileFullMatch(*pattern.QueryRE); err != nil {
+			errs = append(errs, errors.Errorf("QueryRE must be a valid regexp: %s", err))
+		}
+	}
+	return compiled, errs
+}
+
+// Returns the compiled regexps of the pattern: those compiled by
+// ValidateURLPattern, or if it wasn't called (e.g. for a URLPattern literal),
+// freshly compiled ones. Invalid regexps are nil, and match nothing.
+func (this *URLPattern) regexps() *compiledURLPattern {
+	if this.compiled != nil {
+		return this.compiled
+	}
+	compiled, _ := compileURLPattern(this)
+	return compiled
+}
+
+// DomainREMatches returns true iff DomainRE matches the entire host.
+func (this *URLPattern) DomainREMatches(host string) bool {
+	re := this.regexps().domainRE
+	return re != nil && re.MatchString(host)
+}
+
+// PathREMatches returns true iff PathRE matches the entire path.
+func (this *URLPattern) PathREMatches(path string) bool {
+	re := this.regexps().pathRE
+	return re != nil && re.MatchString(path)
+}
+
+// PathExcludeREMatch returns the first of PathExcludeRE that matches the entire
+// path, and whether there is one.
+func (this *URLPattern) PathExcludeREMatch(path string) (string, bool) {
+	for i, re := range this.regexps().pathExcludeRE {
+		if re != nil && re.MatchString(path) {
+			return this.PathExcludeRE[i], true
+		}
+	}
+	return "", false
+}
+
+// QueryREMatches returns true iff QueryRE matches the entire query.
+func (this *URLPattern) QueryREMatches(query string) bool {
+	re := this.regexps().queryRE
+	return re != nil && re.MatchString(query)
+}
+
 func ValidateSignURLPattern(pattern *URLPattern) error {
 	if pattern == nil {
 		return errors.New("This section must be specified")
@@ -185,6 +424,227 @@ func ValidateFetchURLPattern(pattern *URLPattern) error {
 	return nil
 }
 
+// The policy tokens defined by
+// https://w3c.github.io/webappsec-referrer-policy/#referrer-policies.
+var referrerPolicies = map[string]bool{
+	"no-referrer":                     true,
+	"no-referrer-when-downgrade":      true,
+	"origin":                          true,
+	"origin-when-cross-origin":        true,
+	"same-origin":                     true,
+	"strict-origin":                   true,
+	"strict-origin-when-cross-origin": true,
+	"unsafe-url":                      true,
+}
+
+// ValidateReferrerPolicy checks that policy is a valid Referrer-Policy header
+// value: a comma-separated list of known policy tokens.
+func ValidateReferrerPolicy(policy string) error {
+	for _, token := range strings.Split(policy, ",") {
+		token = strings.TrimSpace(token)
+		if !referrerPolicies[strings.ToLower(token)] {
+			return errors.Errorf("ReferrerPolicy contains invalid value %q", token)
+		}
+	}
+	return nil
+}
+
+// Values of Config.URLSetMatch.
+const (
+	// The first URLSet that matches the request is used.
+	URLSetMatchFirst = "first"
+	// The request is rejected if more than one URLSet matches it.
+	URLSetMatchUnique = "unique"
+)
+
+func ValidateURLSetMatch(policy string) error {
+	switch policy {
+	case "", URLSetMatchFirst, URLSetMatchUnique:
+		return nil
+	}
+	return errors.Errorf("URLSetMatch must be %q or %q, not %q", URLSetMatchFirst, URLSetMatchUnique, policy)
+}
+
+// Values of Config.UnmatchedURL.
+const (
+	// The request is rejected with a 400.
+	UnmatchedURLBadRequest = "bad-request"
+	// The request is rejected with a 404.
+	UnmatchedURLNotFound = "not-found"
+	// The request is rejected with a 403.
+	UnmatchedURLForbidden = "forbidden"
+	// The sign URL is fetched and proxied unsigned, if its domain is that of
+	// some URLSet's Sign pattern. Otherwise, the request is rejected with a
+	// 404, so that the packager cannot be used as an open proxy.
+	UnmatchedURLProxy = "proxy"
+)
+
+func ValidateUnmatchedURL(policy string) error {
+	switch policy {
+	case "", UnmatchedURLBadRequest, UnmatchedURLNotFound, UnmatchedURLForbidden, UnmatchedURLProxy:
+		return nil
+	}
+	return errors.Errorf("UnmatchedURL must be %q, %q, %q, or %q, not %q", UnmatchedURLBadRequest, UnmatchedURLNotFound, UnmatchedURLForbidden, UnmatchedURLProxy, policy)
+}
+
+// Values of Config.OuterCacheControl. In all cases, the outer max-age is no
+// longer than the remaining lifetime of the signature.
+const (
+	// The outer response has max-age=0, so that intermediaries don't delay
+	// the update of the SXG on AMP caches.
+	OuterCacheControlZero = "zero"
+	// The outer max-age is the origin's s-maxage or max-age, if any (or 0),
+	// no longer than OuterMaxAgeSeconds, if positive.
+	OuterCacheControlClamp = "clamp"
+	// The outer max-age is OuterMaxAgeSeconds, regardless of the origin's.
+	OuterCacheControlOverride = "override"
+)
+
+func ValidateOuterCacheControl(policy string, maxAgeSeconds int) error {
+	if maxAgeSeconds < 0 {
+		return errors.New("OuterMaxAgeSeconds must not be negative")
+	}
+	switch policy {
+	case "", OuterCacheControlZero, OuterCacheControlClamp:
+		return nil
+	case OuterCacheControlOverride:
+		if maxAgeSeconds == 0 {
+			return errors.Errorf("OuterMaxAgeSeconds must be positive with OuterCacheControl %q", policy)
+		}
+		return nil
+	}
+	return errors.Errorf("OuterCacheControl must be %q, %q, or %q, not %q", OuterCacheControlZero, OuterCacheControlClamp, OuterCacheControlOverride, policy)
+}
+
+// Values of Config.OCSPRefreshStrategy.
+const (
+	// The OCSP response is refreshed once OCSPRefreshFraction (by default,
+	// half) of its validity period has elapsed.
+	OCSPRefreshMidpoint = "midpoint"
+	// The OCSP response is refreshed OCSPRefreshIntervalSeconds after its
+	// ThisUpdate.
+	OCSPRefreshFixed = "fixed"
+)
+
+func ValidateOCSPRefreshStrategy(config *Config) error {
+	switch config.OCSPRefreshStrategy {
+	case "", OCSPRefreshMidpoint:
+		if config.OCSPRefreshIntervalSeconds != 0 {
+			return errors.Errorf("OCSPRefreshIntervalSeconds requires OCSPRefreshStrategy %q", OCSPRefreshFixed)
+		}
+		return nil
+	case OCSPRefreshFixed:
+		if config.OCSPRefreshIntervalSeconds <= 0 {
+			return errors.Errorf("OCSPRefreshStrategy %q requires a positive OCSPRefreshIntervalSeconds", OCSPRefreshFixed)
+		}
+		if config.OCSPRefreshFraction != 0 || config.OCSPMaxRefreshIntervalSeconds != 0 {
+			return errors.Errorf("OCSPRefreshFraction and OCSPMaxRefreshIntervalSeconds not allowed with OCSPRefreshStrategy %q", OCSPRefreshFixed)
+		}
+		return nil
+	}
+	return errors.Errorf("OCSPRefreshStrategy must be %q or %q, not %q", OCSPRefreshMidpoint, OCSPRefreshFixed, config.OCSPRefreshStrategy)
+}
+
+// Values of Config.RenewalOCSPBootstrap.
+const (
+	// The OCSP response for CertFile is reused if it also applies to
+	// NewCertFile, i.e. they have the same issuer and leaf serial number.
+	// Otherwise, a fresh response is fetched.
+	RenewalOCSPReuse = "reuse"
+	// A fresh OCSP response is always fetched for NewCertFile.
+	RenewalOCSPFetch = "fetch"
+)
+
+func ValidateRenewalOCSPBootstrap(policy string) error {
+	switch policy {
+	case "", RenewalOCSPReuse, RenewalOCSPFetch:
+		return nil
+	}
+	return errors.Errorf("RenewalOCSPBootstrap must be %q or %q, not %q", RenewalOCSPReuse, RenewalOCSPFetch, policy)
+}
+
+// Values of Config.SIGHUPAction.
+const (
+	SIGHUPRefreshOCSP = "refreshocsp"
+	SIGHUPIgnore      = "ignore"
+)
+
+func ValidateSIGHUPAction(action string) error {
+	switch action {
+	case "", SIGHUPRefreshOCSP, SIGHUPIgnore:
+		return nil
+	}
+	return errors.Errorf("SIGHUPAction must be %q or %q, not %q", SIGHUPRefreshOCSP, SIGHUPIgnore, action)
+}
+
+// Values of ACMEServerConfig.ACMEKeyType.
+const (
+	ACMEKeyTypeEC256   = "EC256"
+	ACMEKeyTypeRSA2048 = "RSA2048"
+	ACMEKeyTypeRSA4096 = "RSA4096"
+)
+
+func ValidateACMEServerConfig(acme *ACMEServerConfig) error {
+	if acme.DiscoURL != "" && acme.ACMEDirectoryURL != "" && acme.DiscoURL != acme.ACMEDirectoryURL {
+		return errors.New("only one of DiscoURL and ACMEDirectoryURL should be specified")
+	}
+	switch acme.ACMEKeyType {
+	case "", ACMEKeyTypeEC256, ACMEKeyTypeRSA2048, ACMEKeyTypeRSA4096:
+		return nil
+	}
+	return errors.Errorf("ACMEKeyType must be %q, %q or %q, not %q", ACMEKeyTypeEC256, ACMEKeyTypeRSA2048, ACMEKeyTypeRSA4096, acme.ACMEKeyType)
+}
+
+func ValidateUpstreamBaseURL(set *URLSet) error {
+	if set.Fetch != nil {
+		return errors.New("UpstreamBaseURL not allowed with URLSet.Fetch")
+	}
+	u, err := url.Parse(set.UpstreamBaseURL)
+	if err != nil {
+		return errors.Wrap(err, "UpstreamBaseURL must be a valid URL")
+	}
+	if !allowedFetchSchemes[u.Scheme] {
+		return errors.Errorf("UpstreamBaseURL has invalid scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return errors.New("UpstreamBaseURL must specify a host")
+	}
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return errors.New("UpstreamBaseURL must contain only a scheme and host")
+	}
+	return nil
+}
+
+// ValidateHTTPSFetch checks that set only fetches from HTTPS URLs, defaulting
+// an unspecified URLSet.Fetch.Scheme to https. Called before
+// ValidateFetchURLPattern, which would otherwise default it to http and https.
+func ValidateHTTPSFetch(set *URLSet) error {
+	if set.Fetch != nil {
+		if len(set.Fetch.Scheme) == 0 {
+			set.Fetch.Scheme = []string{"https"}
+		}
+		for _, scheme := range set.Fetch.Scheme {
+			if scheme != "https" {
+				return errors.Errorf("Fetch.Scheme must be https with RequireHTTPSFetch, not %q", scheme)
+			}
+		}
+	}
+	if set.UpstreamBaseURL != "" {
+		if u, err := url.Parse(set.UpstreamBaseURL); err == nil && u.Scheme != "https" {
+			return errors.Errorf("UpstreamBaseURL must be https with RequireHTTPSFetch, not %q", u.Scheme)
+		}
+	}
+	return nil
+}
+
+func ValidateTrailingSlash(policy string) error {
+	switch policy {
+	case "", "add", "remove":
+		return nil
+	}
+	return errors.Errorf("TrailingSlash must be \"add\" or \"remove\", not %q", policy)
+}
+
 func ValidateForwardedRequestHeaders(hs []string) error {
 	for _, h := range hs {
 		if msg := haveInvalidForwardedRequestHeader(h); msg != "" {
@@ -194,16 +654,104 @@ func ValidateForwardedRequestHeaders(hs []string) error {
 	return nil
 }
 
+// envRefRE matches a ${VAR} or ${VAR:-default} reference to an environment
+// variable.
+var envRefRE = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// expandEnv replaces each ${VAR} in s with the value of the environment
+// variable VAR, and each ${VAR:-default} with its value if set and non-empty,
+// else default. It returns an error if a variable without a default is unset.
+func expandEnv(s string) (string, error) {
+	var err error
+	expanded := envRefRE.ReplaceAllStringFunc(s, func(ref string) string {
+		match := envRefRE.FindStringSubmatch(ref)
+		value, ok := os.LookupEnv(match[1])
+		if strings.Contains(ref, ":-") {
+			if value == "" {
+				return match[2]
+			}
+		} else if !ok && err == nil {
+			err = errors.Errorf("environment variable %s is unset", match[1])
+		}
+		return value
+	})
+	return expanded, err
+}
+
+// expandEnvInTree applies expandEnv to every string value (including those
+// in arrays and nested tables) of tree, whose key path is prefix.
+func expandEnvInTree(tree *toml.Tree, prefix string) error {
+	for _, key := range tree.Keys() {
+		path := prefix + key
+		switch value := tree.GetPath([]string{key}).(type) {
+		case string:
+			expanded, err := expandEnv(value)
+			if err != nil {
+				return errors.Wrapf(err, "expanding %s", path)
+			}
+			tree.SetPath([]string{key}, expanded)
+		case []interface{}:
+			for i, item := range value {
+				if str, ok := item.(string); ok {
+					expanded, err := expandEnv(str)
+					if err != nil {
+						return errors.Wrapf(err, "expanding %s.%d", path, i)
+					}
+					value[i] = expanded
+				}
+			}
+		case *toml.Tree:
+			if err := expandEnvInTree(value, path+"."); err != nil {
+				return err
+			}
+		case []*toml.Tree:
+			for i, table := range value {
+				if err := expandEnvInTree(table, fmt.Sprintf("%s.%d.", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// readTransformerOptions converts the [TransformerOptions] table to the
+// Request.Options it describes, and validates them. Unlike the rest of the
+// config, unknown keys are an error, as misspelling an option would otherwise
+// silently leave its transformer disabled.
+func readTransformerOptions(tree *toml.Tree) (*rpb.Request_Options, error) {
+	j, err := json.Marshal(tree.ToMap())
+	if err != nil {
+		return nil, errors.Wrap(err, "converting TransformerOptions")
+	}
+	options := &rpb.Request_Options{}
+	if err := jsonpb.Unmarshal(bytes.NewReader(j), options); err != nil {
+		return nil, errors.Wrap(err, "parsing TransformerOptions")
+	}
+	if err := transformer.ValidateOptions(options); err != nil {
+		return nil, errors.Wrap(err, "validating TransformerOptions")
+	}
+	return options, nil
+}
+
 // ReadConfig reads the config file specified at --config and validates it.
 func ReadConfig(configBytes []byte) (*Config, error) {
 	tree, err := toml.LoadBytes(configBytes)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to parse TOML")
 	}
+	if err = expandEnvInTree(tree, ""); err != nil {
+		return nil, err
+	}
 	config := Config{}
 	if err = tree.Unmarshal(&config); err != nil {
 		return nil, errors.Wrapf(err, "failed to unmarshal TOML")
 	}
+	if options, ok := tree.Get("TransformerOptions").(*toml.Tree); ok {
+		if config.TransformerOptions, err = readTransformerOptions(options); err != nil {
+			return nil, err
+		}
+	}
 	// TODO(twifkak): Return an error if the TOML includes any fields that aren't part of the Config struct.
 
 	if config.Port == 0 {
@@ -212,17 +760,111 @@ func ReadConfig(configBytes []byte) (*Config, error) {
 	if config.CertFile == "" {
 		return nil, errors.New("must specify CertFile")
 	}
-	if config.KeyFile == "" {
-		return nil, errors.New("must specify KeyFile")
+	if err := validateKeySource(&config); err != nil {
+		return nil, err
 	}
 	if config.OCSPCache == "" {
 		return nil, errors.New("must specify OCSPCache")
 	}
+	if config.CertFileWatchIntervalSeconds < 0 {
+		return nil, errors.New("CertFileWatchIntervalSeconds must not be negative")
+	}
+	if config.OCSPLockTimeoutSeconds < 0 {
+		return nil, errors.New("OCSPLockTimeoutSeconds must not be negative")
+	}
+	if config.OCSPMaxHostFetches < 0 {
+		return nil, errors.New("OCSPMaxHostFetches must not be negative")
+	}
+	if config.OCSPRefreshFraction < 0 || config.OCSPRefreshFraction > 1 {
+		return nil, errors.New("OCSPRefreshFraction must be between 0 and 1")
+	}
+	if config.OCSPMinRefreshIntervalSeconds < 0 {
+		return nil, errors.New("OCSPMinRefreshIntervalSeconds must not be negative")
+	}
+	if config.OCSPMaxRefreshIntervalSeconds < 0 {
+		return nil, errors.New("OCSPMaxRefreshIntervalSeconds must not be negative")
+	}
+	if config.OCSPMaxRefreshIntervalSeconds > 0 && config.OCSPMaxRefreshIntervalSeconds < config.OCSPMinRefreshIntervalSeconds {
+		return nil, errors.New("OCSPMaxRefreshIntervalSeconds must not be less than OCSPMinRefreshIntervalSeconds")
+	}
+	if err := ValidateOCSPRefreshStrategy(&config); err != nil {
+		return nil, err
+	}
+	if config.OCSPClockSkewSeconds != nil && *config.OCSPClockSkewSeconds < 0 {
+		return nil, errors.New("OCSPClockSkewSeconds must not be negative")
+	}
+	if err := ValidateRenewalOCSPBootstrap(config.RenewalOCSPBootstrap); err != nil {
+		return nil, err
+	}
+	if config.CertRenewalFraction < 0 || config.CertRenewalFraction >= 1 {
+		return nil, errors.New("CertRenewalFraction must be at least 0 and less than 1")
+	}
+	if config.CertRenewalCheckIntervalSeconds < 0 {
+		return nil, errors.New("CertRenewalCheckIntervalSeconds must not be negative")
+	}
+	if config.SignatureDurationSeconds != 0 && config.SignatureDurationSeconds < 3600 {
+		return nil, errors.New("SignatureDurationSeconds must be at least 3600")
+	}
+	if config.MIRecordSize < 0 || config.MIRecordSize > 16384 {
+		return nil, errors.New("MIRecordSize must be between 0 and 16384")
+	}
+	if config.MaxSignableBodyLength < 0 {
+		return nil, errors.New("MaxSignableBodyLength must not be negative")
+	}
+	if config.RequestTimeoutSeconds < 0 {
+		return nil, errors.New("RequestTimeoutSeconds must not be negative")
+	}
+	if config.ShutdownGracePeriodSeconds < 0 {
+		return nil, errors.New("ShutdownGracePeriodSeconds must not be negative")
+	}
+	if err := ValidateSIGHUPAction(config.SIGHUPAction); err != nil {
+		return nil, err
+	}
+	if config.HealthzCertExpiryDays < 0 {
+		return nil, errors.New("HealthzCertExpiryDays must not be negative")
+	}
+	if config.HealthzUpstreamURL != "" {
+		u, err := url.Parse(config.HealthzUpstreamURL)
+		if err != nil || !allowedFetchSchemes[u.Scheme] || u.Host == "" {
+			return nil, errors.Errorf("HealthzUpstreamURL must be an absolute http or https URL, not %q", config.HealthzUpstreamURL)
+		}
+	}
+	if config.ReferrerPolicy != "" {
+		if err := ValidateReferrerPolicy(config.ReferrerPolicy); err != nil {
+			return nil, err
+		}
+	}
+	if err := ValidateURLSetMatch(config.URLSetMatch); err != nil {
+		return nil, err
+	}
+	if err := ValidateUnmatchedURL(config.UnmatchedURL); err != nil {
+		return nil, err
+	}
+	if err := ValidateOuterCacheControl(config.OuterCacheControl, config.OuterMaxAgeSeconds); err != nil {
+		return nil, err
+	}
 	if len(config.ForwardedRequestHeaders) > 0 {
 		if err := ValidateForwardedRequestHeaders(config.ForwardedRequestHeaders); err != nil {
 			return nil, err
 		}
 	}
+	for _, h := range append(config.SignedResponseHeaders, config.StrippedResponseHeaders...) {
+		if !httpguts.ValidHeaderFieldName(h) {
+			return nil, errors.Errorf("SignedResponseHeaders and StrippedResponseHeaders must be header names, not %q", h)
+		}
+	}
+	if config.ACMEConfig != nil {
+		if config.ACMEConfig.Production != nil {
+			if err := ValidateACMEServerConfig(config.ACMEConfig.Production); err != nil {
+				return nil, errors.Wrap(err, "parsing ACMEConfig.Production")
+			}
+		}
+		if config.ACMEConfig.Development != nil {
+			if err := ValidateACMEServerConfig(config.ACMEConfig.Development); err != nil {
+				return nil, errors.Wrap(err, "parsing ACMEConfig.Development")
+			}
+		}
+	}
 	ocspDir := filepath.Dir(config.OCSPCache)
 	if stat, err := os.Stat(ocspDir); os.IsNotExist(err) || !stat.Mode().IsDir() {
 		return nil, errors.Errorf("OCSPCache parent directory must exist: %s", ocspDir)
@@ -232,6 +874,11 @@ func ReadConfig(configBytes []byte) (*Config, error) {
 		return nil, errors.New("must specify one or more [[URLSet]]")
 	}
 	for i := range config.URLSet {
+		if config.RequireHTTPSFetch {
+			if err := ValidateHTTPSFetch(&config.URLSet[i]); err != nil {
+				return nil, errors.Wrapf(err, "parsing URLSet.%d", i)
+			}
+		}
 		if config.URLSet[i].Fetch != nil {
 			if err := ValidateFetchURLPattern(config.URLSet[i].Fetch); err != nil {
 				return nil, errors.Wrapf(err, "parsing URLSet.%d.Fetch", i)
@@ -240,6 +887,107 @@ func ReadConfig(configBytes []byte) (*Config, error) {
 		if err := ValidateSignURLPattern(config.URLSet[i].Sign); err != nil {
 			return nil, errors.Wrapf(err, "parsing URLSet.%d.Sign", i)
 		}
+		if config.URLSet[i].UpstreamBaseURL != "" {
+			if err := ValidateUpstreamBaseURL(&config.URLSet[i]); err != nil {
+				return nil, errors.Wrapf(err, "parsing URLSet.%d", i)
+			}
+		}
+		if err := ValidateTrailingSlash(config.URLSet[i].TrailingSlash); err != nil {
+			return nil, errors.Wrapf(err, "parsing URLSet.%d", i)
+		}
 	}
 	return &config, nil
 }
+
+// Validate checks the parts of the config that ReadConfig can't check without
+// touching the filesystem, without binding ports or contacting the OCSP or
+// ACME servers, so that a config can be checked before it's deployed: that
+// CertFile and the key (see LoadKey) parse, and the cert matches the key and each
+// URLSet.Sign.Domain; that the URLSet patterns have domains and valid regexps;
+// and that OCSPCache is writable. It returns an error listing every problem
+// found, or nil if none.
+func (this *Config) Validate() error {
+	var problems []string
+	addProblem := func(err error) {
+		problems = append(problems, err.Error())
+	}
+
+	var cert *x509.Certificate
+	if certPem, err := ioutil.ReadFile(this.CertFile); err != nil {
+		addProblem(errors.Wrap(err, "reading CertFile"))
+	} else if certs, err := signedexchange.ParseCertificates(certPem); err != nil {
+		addProblem(errors.Wrapf(err, "parsing CertFile %s", this.CertFile))
+	} else if len(certs) == 0 {
+		addProblem(errors.Errorf("CertFile %s contains no certificates", this.CertFile))
+	} else {
+		cert = certs[0]
+	}
+	key, err := LoadKey(this)
+	if err != nil {
+		addProblem(err)
+	}
+	if cert != nil && key != nil {
+		if _, certIsECDSA := cert.PublicKey.(*ecdsa.PublicKey); !certIsECDSA {
+			addProblem(errors.Errorf("CertFile %s and %s must both be ECDSA", this.CertFile, keySourceName(this)))
+			cert = nil
+		}
+	}
+
+	if len(this.URLSet) == 0 {
+		addProblem(errors.New("must specify one or more [[URLSet]]"))
+	}
+	for i, set := range this.URLSet {
+		if set.Fetch != nil {
+			if set.Fetch.Domain == "" && set.Fetch.DomainRE == "" {
+				addProblem(errors.Errorf("URLSet.%d.Fetch: Domain or DomainRE must be specified", i))
+			}
+			_, errs := compileURLPattern(set.Fetch)
+			for _, err := range errs {
+				addProblem(errors.Wrapf(err, "URLSet.%d.Fetch", i))
+			}
+		}
+		if set.Sign == nil {
+			addProblem(errors.Errorf("URLSet.%d.Sign must be specified", i))
+			continue
+		}
+		_, errs := compileURLPattern(set.Sign)
+		for _, err := range errs {
+			addProblem(errors.Wrapf(err, "URLSet.%d.Sign", i))
+		}
+		if set.Sign.Domain == "" {
+			addProblem(errors.Errorf("URLSet.%d.Sign: Domain must be specified", i))
+		} else if cert != nil && key != nil {
+			if err := CertificateMatches(cert, key, set.Sign.Domain); err != nil {
+				addProblem(errors.Wrapf(err, "URLSet.%d.Sign: CertFile %s doesn't match %s and Domain %s", i, this.CertFile, keySourceName(this), set.Sign.Domain))
+			}
+		}
+	}
+
+	if this.OCSPCache == "" {
+		addProblem(errors.New("must specify OCSPCache"))
+	} else if err := checkWritable(this.OCSPCache); err != nil {
+		addProblem(errors.Wrap(err, "OCSPCache must be writable"))
+	}
+
+	if len(problems) > 0 {
+		return errors.Errorf("config has %d problem(s):\n  %s", len(problems), strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// Returns nil if the file at path can be written by the current user: if it
+// exists, it can be opened for writing, and a new file can be created in its
+// directory (as the OCSP cache's lease file is). Leaves both unmodified.
+func checkWritable(path string) error {
+	if file, err := os.OpenFile(path, os.O_WRONLY, 0); err == nil {
+		file.Close()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	temp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".validate")
+	if err != nil {
+		return err
+	}
+	temp.Close()
+	return os.Remove(temp.Name())
+}
@@ -1,8 +1,13 @@
 package util
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
+	rpb "github.com/ampproject/amppackager/transformer/request"
+	"github.com/golang/protobuf/proto"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -11,133 +16,743 @@ func errorFrom(_ *Config, err error) string {
 	return err.Error()
 }
 
+// withRegexps returns pattern with its regexps compiled, as by ReadConfig.
+func withRegexps(pattern *URLPattern) *URLPattern {
+	pattern.compiled, _ = compileURLPattern(pattern)
+	return pattern
+}
+
 func stringPtr(s string) *string {
 	return &s
 }
 
-func boolPtr(b bool) *bool {
-	return &b
-}
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestInvalid(t *testing.T) {
+	assert.NotEqual(t, "", errorFrom(ReadConfig([]byte(``))))
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`abc`))), "failed to parse TOML")
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`[Port] X=5`))), "failed to unmarshal TOML")
+}
+
+func TestMinimalValidConfig(t *testing.T) {
+	config, err := ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		CSRFile = "file.csr"
+		OCSPCache = "/tmp/ocsp"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))
+	require.NoError(t, err)
+	assert.Equal(t, Config{
+		Port:      8080,
+		CertFile:  "cert.pem",
+		KeyFile:   "key.pem",
+		CSRFile:   "file.csr",
+		OCSPCache: "/tmp/ocsp",
+		URLSet: []URLSet{{
+			Sign: withRegexps(&URLPattern{
+				Domain:    "example.com",
+				PathRE:    stringPtr(".*"),
+				QueryRE:   stringPtr(""),
+				MaxLength: 2000,
+			}),
+		}},
+	}, *config)
+}
+
+func TestForwardedRequestHeader(t *testing.T) {
+	config, err := ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		ForwardedRequestHeaders = ["X-Foo", "X-Bar"]
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))
+	require.NoError(t, err)
+	assert.Equal(t, Config{
+		Port:                    8080,
+		CertFile:                "cert.pem",
+		KeyFile:                 "key.pem",
+		OCSPCache:               "/tmp/ocsp",
+		ForwardedRequestHeaders: []string{"X-Foo", "X-Bar"},
+		URLSet: []URLSet{{
+			Sign: withRegexps(&URLPattern{
+				Domain:    "example.com",
+				PathRE:    stringPtr(".*"),
+				QueryRE:   stringPtr(""),
+				MaxLength: 2000,
+			}),
+		}},
+	}, *config)
+}
+
+func TestForwardedRequestHeadersHaveHopByHopHeader(t *testing.T) {
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		ForwardedRequestHeaders = ["X-Foo", "X-Bar", "connection"]
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), "ForwardedRequestHeaders must not have hop-by-hop header of connection")
+}
+
+func TestForwardedRequestHeadersHaveConditionalRequestHeader(t *testing.T) {
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		ForwardedRequestHeaders = ["X-Foo", "X-Bar", "if-match"]
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), "ForwardedRequestHeaders must not have conditional request header of if-match")
+}
+
+func TestForwardedRequestHeadersHaveDisallowedHeader(t *testing.T) {
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		ForwardedRequestHeaders = ["X-Foo", "X-Bar", "via"]
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), "ForwardedRequestHeaders must not include request header of via")
+}
+
+func TestForwardedRequestHeadersHaveTE(t *testing.T) {
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		ForwardedRequestHeaders = ["X-Foo", "X-Bar", "TE"]
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), "ForwardedRequestHeaders must not include request header of TE")
+}
+
+func TestOCSPDirDoesntExist(t *testing.T) {
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/this/does/not/exist/ocsp"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), "OCSPCache parent directory must exist")
+}
+
+func TestNegativeCertFileWatchInterval(t *testing.T) {
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		CertFileWatchIntervalSeconds = -1
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), "CertFileWatchIntervalSeconds must not be negative")
+}
+
+func TestNegativeOCSPLockTimeout(t *testing.T) {
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		OCSPLockTimeoutSeconds = -1
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), "OCSPLockTimeoutSeconds must not be negative")
+}
+
+func TestSignatureDurationMinimum(t *testing.T) {
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		SignatureDurationSeconds = 60
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), "SignatureDurationSeconds must be at least 3600")
+}
+
+func TestMIRecordSizeMaximum(t *testing.T) {
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		MIRecordSize = 65536
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), "MIRecordSize must be between 0 and 16384")
+}
+
+func TestNegativeMaxSignableBodyLength(t *testing.T) {
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		MaxSignableBodyLength = -1
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), "MaxSignableBodyLength must not be negative")
+}
+
+func TestNegativeRequestTimeout(t *testing.T) {
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		RequestTimeoutSeconds = -1
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), "RequestTimeoutSeconds must not be negative")
+}
+
+func TestOuterCacheControl(t *testing.T) {
+	config, err := ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		OuterCacheControl = "clamp"
+		OuterMaxAgeSeconds = 300
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))
+	require.NoError(t, err)
+	assert.Equal(t, OuterCacheControlClamp, config.OuterCacheControl)
+	assert.Equal(t, 300, config.OuterMaxAgeSeconds)
+
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		OuterCacheControl = "override"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), `OuterMaxAgeSeconds must be positive with OuterCacheControl "override"`)
+
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		OuterCacheControl = "origin"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), `OuterCacheControl must be "zero", "clamp", or "override", not "origin"`)
+}
+
+func TestInvalidHealthzUpstreamURL(t *testing.T) {
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		HealthzUpstreamURL = "/relative"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), "HealthzUpstreamURL must be an absolute http or https URL")
+}
+
+func TestInvalidStrippedResponseHeader(t *testing.T) {
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		StrippedResponseHeaders = ["X Debug"]
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), `SignedResponseHeaders and StrippedResponseHeaders must be header names, not "X Debug"`)
+}
+
+func TestNegativeOCSPMaxHostFetches(t *testing.T) {
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		OCSPMaxHostFetches = -1
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), "OCSPMaxHostFetches must not be negative")
+}
+
+func TestOCSPRefreshPolicy(t *testing.T) {
+	config, err := ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		OCSPRefreshFraction = 0.25
+		OCSPMinRefreshIntervalSeconds = 3600
+		OCSPMaxRefreshIntervalSeconds = 7200
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))
+	require.NoError(t, err)
+	assert.Equal(t, 0.25, config.OCSPRefreshFraction)
+	assert.Equal(t, 3600, config.OCSPMinRefreshIntervalSeconds)
+	assert.Equal(t, 7200, config.OCSPMaxRefreshIntervalSeconds)
+}
+
+func TestNegativeOCSPClockSkew(t *testing.T) {
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		OCSPClockSkewSeconds = -1
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), "OCSPClockSkewSeconds must not be negative")
+}
+
+func TestOCSPClockSkew(t *testing.T) {
+	config, err := ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))
+	require.NoError(t, err)
+	assert.Nil(t, config.OCSPClockSkewSeconds)
+
+	// Zero is distinct from unset, tolerating no skew rather than the default.
+	config, err = ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		OCSPClockSkewSeconds = 0
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))
+	require.NoError(t, err)
+	if assert.NotNil(t, config.OCSPClockSkewSeconds) {
+		assert.Equal(t, 0, *config.OCSPClockSkewSeconds)
+	}
+}
+
+func TestInvalidOCSPRefreshFraction(t *testing.T) {
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		OCSPRefreshFraction = 1.5
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), "OCSPRefreshFraction must be between 0 and 1")
+}
+
+func TestNegativeOCSPMinRefreshInterval(t *testing.T) {
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		OCSPMinRefreshIntervalSeconds = -1
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), "OCSPMinRefreshIntervalSeconds must not be negative")
+}
+
+func TestOCSPMaxRefreshIntervalLessThanMin(t *testing.T) {
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		OCSPMinRefreshIntervalSeconds = 7200
+		OCSPMaxRefreshIntervalSeconds = 3600
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), "OCSPMaxRefreshIntervalSeconds must not be less than OCSPMinRefreshIntervalSeconds")
+}
+
+func TestReferrerPolicy(t *testing.T) {
+	config, err := ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		ReferrerPolicy = "no-referrer, strict-origin-when-cross-origin"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))
+	require.NoError(t, err)
+	assert.Equal(t, "no-referrer, strict-origin-when-cross-origin", config.ReferrerPolicy)
+}
+
+func TestNonHTMLPolicy(t *testing.T) {
+	config, err := ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		ErrorOnNonHTML = true
+		NonHTMLProxyTypes = ["application/json"]
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))
+	require.NoError(t, err)
+	assert.True(t, config.ErrorOnNonHTML)
+	assert.Equal(t, []string{"application/json"}, config.NonHTMLProxyTypes)
+}
+
+func TestURLSetMatch(t *testing.T) {
+	config, err := ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		URLSetMatch = "unique"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))
+	require.NoError(t, err)
+	assert.Equal(t, URLSetMatchUnique, config.URLSetMatch)
+
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		URLSetMatch = "last"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), `URLSetMatch must be "first" or "unique", not "last"`)
+}
+
+func TestUnmatchedURL(t *testing.T) {
+	config, err := ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		UnmatchedURL = "proxy"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))
+	require.NoError(t, err)
+	assert.Equal(t, UnmatchedURLProxy, config.UnmatchedURL)
+
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		UnmatchedURL = "ignore"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), `UnmatchedURL must be "bad-request", "not-found", "forbidden", or "proxy", not "ignore"`)
+}
+
+func TestACMEServerConfig(t *testing.T) {
+	config, err := ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+		[ACMEConfig]
+		  [ACMEConfig.Production]
+		    ACMEDirectoryURL = "https://acme.example/dir"
+		    ACMEKeyType = "RSA4096"
+	`))
+	require.NoError(t, err)
+	assert.Equal(t, "https://acme.example/dir", config.ACMEConfig.Production.ACMEDirectoryURL)
+	assert.Equal(t, ACMEKeyTypeRSA4096, config.ACMEConfig.Production.ACMEKeyType)
+
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+		[ACMEConfig]
+		  [ACMEConfig.Development]
+		    DiscoURL = "https://acme.example/dir"
+		    ACMEKeyType = "RSA1024"
+	`))), `parsing ACMEConfig.Development: ACMEKeyType must be "EC256", "RSA2048" or "RSA4096", not "RSA1024"`)
+
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+		[ACMEConfig]
+		  [ACMEConfig.Production]
+		    DiscoURL = "https://acme.example/dir"
+		    ACMEDirectoryURL = "https://staging.acme.example/dir"
+	`))), "only one of DiscoURL and ACMEDirectoryURL should be specified")
+}
+
+func TestOCSPRefreshStrategy(t *testing.T) {
+	config, err := ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		OCSPRefreshStrategy = "fixed"
+		OCSPRefreshIntervalSeconds = 86400
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))
+	require.NoError(t, err)
+	assert.Equal(t, OCSPRefreshFixed, config.OCSPRefreshStrategy)
+	assert.Equal(t, 86400, config.OCSPRefreshIntervalSeconds)
 
-func TestInvalid(t *testing.T) {
-	assert.NotEqual(t, "", errorFrom(ReadConfig([]byte(``))))
-	assert.Contains(t, errorFrom(ReadConfig([]byte(`abc`))), "failed to parse TOML")
-	assert.Contains(t, errorFrom(ReadConfig([]byte(`[Port] X=5`))), "failed to unmarshal TOML")
+	for _, test := range []struct {
+		settings, expectedErr string
+	}{
+		{`OCSPRefreshStrategy = "hourly"`, `OCSPRefreshStrategy must be "midpoint" or "fixed", not "hourly"`},
+		{`OCSPRefreshStrategy = "fixed"`, `OCSPRefreshStrategy "fixed" requires a positive OCSPRefreshIntervalSeconds`},
+		{"OCSPRefreshIntervalSeconds = 86400", `OCSPRefreshIntervalSeconds requires OCSPRefreshStrategy "fixed"`},
+		{"OCSPRefreshStrategy = \"fixed\"\nOCSPRefreshIntervalSeconds = 86400\nOCSPRefreshFraction = 0.25", "OCSPRefreshFraction and OCSPMaxRefreshIntervalSeconds not allowed"},
+	} {
+		assert.Contains(t, errorFrom(ReadConfig([]byte(`
+			CertFile = "cert.pem"
+			KeyFile = "key.pem"
+			OCSPCache = "/tmp/ocsp"
+			`+test.settings+`
+			[[URLSet]]
+			  [URLSet.Sign]
+			    Domain = "example.com"
+		`))), test.expectedErr)
+	}
 }
 
-func TestMinimalValidConfig(t *testing.T) {
+func TestCertRenewalPolicy(t *testing.T) {
 	config, err := ReadConfig([]byte(`
 		CertFile = "cert.pem"
 		KeyFile = "key.pem"
-		CSRFile = "file.csr"
 		OCSPCache = "/tmp/ocsp"
+		CertRenewalFraction = 0.5
+		CertRenewalCheckIntervalSeconds = 3600
 		[[URLSet]]
 		  [URLSet.Sign]
 		    Domain = "example.com"
 	`))
 	require.NoError(t, err)
-	assert.Equal(t, Config{
-		Port:      8080,
-		CertFile:  "cert.pem",
-		KeyFile:   "key.pem",
-		CSRFile:   "file.csr",
-		OCSPCache: "/tmp/ocsp",
-		URLSet: []URLSet{{
-			Sign: &URLPattern{
-				Domain:    "example.com",
-				PathRE:    stringPtr(".*"),
-				QueryRE:   stringPtr(""),
-				MaxLength: 2000,
-			},
-		}},
-	}, *config)
+	assert.Equal(t, 0.5, config.CertRenewalFraction)
+	assert.Equal(t, 3600, config.CertRenewalCheckIntervalSeconds)
+
+	for _, test := range []struct {
+		settings, expectedErr string
+	}{
+		{"CertRenewalFraction = 1.0", "CertRenewalFraction must be at least 0 and less than 1"},
+		{"CertRenewalFraction = -0.5", "CertRenewalFraction must be at least 0 and less than 1"},
+		{"CertRenewalCheckIntervalSeconds = -1", "CertRenewalCheckIntervalSeconds must not be negative"},
+	} {
+		assert.Contains(t, errorFrom(ReadConfig([]byte(`
+			CertFile = "cert.pem"
+			KeyFile = "key.pem"
+			OCSPCache = "/tmp/ocsp"
+			`+test.settings+`
+			[[URLSet]]
+			  [URLSet.Sign]
+			    Domain = "example.com"
+		`))), test.expectedErr)
+	}
 }
 
-func TestForwardedRequestHeader(t *testing.T) {
+func TestRenewalOCSPBootstrap(t *testing.T) {
 	config, err := ReadConfig([]byte(`
 		CertFile = "cert.pem"
 		KeyFile = "key.pem"
 		OCSPCache = "/tmp/ocsp"
-		ForwardedRequestHeaders = ["X-Foo", "X-Bar"]
+		RenewalOCSPBootstrap = "fetch"
 		[[URLSet]]
 		  [URLSet.Sign]
 		    Domain = "example.com"
 	`))
 	require.NoError(t, err)
-	assert.Equal(t, Config{
-		Port:                    8080,
-		CertFile:                "cert.pem",
-		KeyFile:                 "key.pem",
-		OCSPCache:               "/tmp/ocsp",
-		ForwardedRequestHeaders: []string{"X-Foo", "X-Bar"},
-		URLSet: []URLSet{{
-			Sign: &URLPattern{
-				Domain:    "example.com",
-				PathRE:    stringPtr(".*"),
-				QueryRE:   stringPtr(""),
-				MaxLength: 2000,
-			},
-		}},
-	}, *config)
+	assert.Equal(t, RenewalOCSPFetch, config.RenewalOCSPBootstrap)
+
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		RenewalOCSPBootstrap = "share"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), `RenewalOCSPBootstrap must be "reuse" or "fetch", not "share"`)
 }
 
-func TestForwardedRequestHeadersHaveHopByHopHeader(t *testing.T) {
+func TestSIGHUPAction(t *testing.T) {
+	config, err := ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		SIGHUPAction = "refreshocsp"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))
+	require.NoError(t, err)
+	assert.Equal(t, SIGHUPRefreshOCSP, config.SIGHUPAction)
+
 	assert.Contains(t, errorFrom(ReadConfig([]byte(`
 		CertFile = "cert.pem"
 		KeyFile = "key.pem"
 		OCSPCache = "/tmp/ocsp"
-		ForwardedRequestHeaders = ["X-Foo", "X-Bar", "connection"]
+		SIGHUPAction = "reload"
 		[[URLSet]]
 		  [URLSet.Sign]
 		    Domain = "example.com"
-	`))), "ForwardedRequestHeaders must not have hop-by-hop header of connection")
+	`))), `SIGHUPAction must be "refreshocsp" or "ignore", not "reload"`)
 }
 
-func TestForwardedRequestHeadersHaveConditionalRequestHeader(t *testing.T) {
+func TestInvalidReferrerPolicy(t *testing.T) {
 	assert.Contains(t, errorFrom(ReadConfig([]byte(`
 		CertFile = "cert.pem"
 		KeyFile = "key.pem"
 		OCSPCache = "/tmp/ocsp"
-		ForwardedRequestHeaders = ["X-Foo", "X-Bar", "if-match"]
+		ReferrerPolicy = "no-referrer, everywhere"
 		[[URLSet]]
 		  [URLSet.Sign]
 		    Domain = "example.com"
-	`))), "ForwardedRequestHeaders must not have conditional request header of if-match")
+	`))), `ReferrerPolicy contains invalid value "everywhere"`)
 }
 
-func TestForwardedRequestHeadersHaveDisallowedHeader(t *testing.T) {
+func TestUpstreamBaseURL(t *testing.T) {
+	config, err := ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		[[URLSet]]
+		  UpstreamBaseURL = "http://10.0.0.1:8080"
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))
+	require.NoError(t, err)
+	assert.Equal(t, "http://10.0.0.1:8080", config.URLSet[0].UpstreamBaseURL)
+}
+
+func TestRequireHTTPSFetch(t *testing.T) {
+	config, err := ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		RequireHTTPSFetch = true
+		[[URLSet]]
+		  [URLSet.Fetch]
+		    Domain = "fetch.example.com"
+		  [URLSet.Sign]
+		    Domain = "example.com"
+		[[URLSet]]
+		  UpstreamBaseURL = "https://10.0.0.1:8443"
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https"}, config.URLSet[0].Fetch.Scheme)
+
 	assert.Contains(t, errorFrom(ReadConfig([]byte(`
 		CertFile = "cert.pem"
 		KeyFile = "key.pem"
 		OCSPCache = "/tmp/ocsp"
-		ForwardedRequestHeaders = ["X-Foo", "X-Bar", "via"]
+		RequireHTTPSFetch = true
 		[[URLSet]]
+		  [URLSet.Fetch]
+		    Scheme = ["http", "https"]
+		    Domain = "fetch.example.com"
 		  [URLSet.Sign]
 		    Domain = "example.com"
-	`))), "ForwardedRequestHeaders must not include request header of via")
+	`))), `parsing URLSet.0: Fetch.Scheme must be https with RequireHTTPSFetch, not "http"`)
+
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		RequireHTTPSFetch = true
+		[[URLSet]]
+		  UpstreamBaseURL = "http://10.0.0.1:8080"
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), `parsing URLSet.0: UpstreamBaseURL must be https with RequireHTTPSFetch, not "http"`)
 }
 
-func TestForwardedRequestHeadersHaveTE(t *testing.T) {
+func TestTrailingSlash(t *testing.T) {
+	config, err := ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		[[URLSet]]
+		  TrailingSlash = "remove"
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))
+	require.NoError(t, err)
+	assert.Equal(t, "remove", config.URLSet[0].TrailingSlash)
+
 	assert.Contains(t, errorFrom(ReadConfig([]byte(`
 		CertFile = "cert.pem"
 		KeyFile = "key.pem"
 		OCSPCache = "/tmp/ocsp"
-		ForwardedRequestHeaders = ["X-Foo", "X-Bar", "TE"]
 		[[URLSet]]
+		  TrailingSlash = "strip"
 		  [URLSet.Sign]
 		    Domain = "example.com"
-	`))), "ForwardedRequestHeaders must not include request header of TE")
+	`))), `TrailingSlash must be "add" or "remove", not "strip"`)
 }
 
-func TestOCSPDirDoesntExist(t *testing.T) {
+func TestInvalidUpstreamBaseURL(t *testing.T) {
 	assert.Contains(t, errorFrom(ReadConfig([]byte(`
 		CertFile = "cert.pem"
 		KeyFile = "key.pem"
-		OCSPCache = "/tmp/this/does/not/exist/ocsp"
+		OCSPCache = "/tmp/ocsp"
 		[[URLSet]]
+		  UpstreamBaseURL = "http://10.0.0.1:8080/amp"
 		  [URLSet.Sign]
 		    Domain = "example.com"
-	`))), "OCSPCache parent directory must exist")
+	`))), "UpstreamBaseURL must contain only a scheme and host")
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		[[URLSet]]
+		  UpstreamBaseURL = "ftp://10.0.0.1"
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), `UpstreamBaseURL has invalid scheme "ftp"`)
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		[[URLSet]]
+		  UpstreamBaseURL = "http://10.0.0.1"
+		  [URLSet.Fetch]
+		    Domain = "example.com"
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), "UpstreamBaseURL not allowed with URLSet.Fetch")
 }
 
 func TestInvalidPathRE(t *testing.T) {
@@ -152,6 +767,60 @@ func TestInvalidPathRE(t *testing.T) {
 	`))), "PathRE must be a valid regexp")
 }
 
+func TestInvalidRegexpIsPinpointed(t *testing.T) {
+	assert.Equal(t, "parsing URLSet.1.Fetch: PathRE must be a valid regexp: error parsing regexp: missing closing ): `/amp/(.*`", errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+		  [URLSet.Fetch]
+		    Domain = "www.example.com"
+		    PathRE = "/amp/(.*"
+	`))))
+	assert.Equal(t, "parsing URLSet.0.Fetch: DomainRE must be a valid regexp: error parsing regexp: missing argument to repetition operator: `*`", errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+		  [URLSet.Fetch]
+		    DomainRE = "**.example.com"
+	`))))
+}
+
+func TestCompiledRegexps(t *testing.T) {
+	config, err := ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+		    PathRE = "/amp/.*"
+		    PathExcludeRE = ["/amp/signin"]
+		    QueryRE = "amp=1"
+	`))
+	require.NoError(t, err)
+	sign := config.URLSet[0].Sign
+	require.NotNil(t, sign.compiled)
+	assert.True(t, sign.PathREMatches("/amp/a.html"))
+	// Regexps must match the entire string.
+	assert.False(t, sign.PathREMatches("/b/amp/a.html"))
+	exclude, ok := sign.PathExcludeREMatch("/amp/signin")
+	assert.True(t, ok)
+	assert.Equal(t, "/amp/signin", exclude)
+	_, ok = sign.PathExcludeREMatch("/amp/signin/b")
+	assert.False(t, ok)
+	assert.True(t, sign.QueryREMatches("amp=1"))
+	assert.False(t, sign.QueryREMatches("amp=12"))
+}
+
 func TestInvalidPathExcludeRE(t *testing.T) {
 	assert.Contains(t, errorFrom(ReadConfig([]byte(`
 		CertFile = "cert.pem"
@@ -194,12 +863,12 @@ func TestOptionalNewCert(t *testing.T) {
 		NewCertFile: "newcert.pem",
 		OCSPCache:   "/tmp/ocsp",
 		URLSet: []URLSet{{
-			Sign: &URLPattern{
+			Sign: withRegexps(&URLPattern{
 				Domain:    "example.com",
 				PathRE:    stringPtr(".*"),
 				QueryRE:   stringPtr(""),
 				MaxLength: 2000,
-			},
+			}),
 		}},
 	}, *config)
 }
@@ -265,12 +934,12 @@ func TestOptionalACMEConfig(t *testing.T) {
 			},
 		},
 		URLSet: []URLSet{{
-			Sign: &URLPattern{
+			Sign: withRegexps(&URLPattern{
 				Domain:    "example.com",
 				PathRE:    stringPtr(".*"),
 				QueryRE:   stringPtr(""),
 				MaxLength: 2000,
-			},
+			}),
 		}},
 	}, *config)
 }
@@ -339,14 +1008,14 @@ func TestSignOverrides(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, 1, len(config.URLSet))
 	// TODO(twifkak): Don't depend on scheme order.
-	assert.Equal(t, URLPattern{
+	assert.Equal(t, *withRegexps(&URLPattern{
 		Domain:                 "example.com",
 		PathRE:                 stringPtr("/amp/.*"),
 		PathExcludeRE:          []string{"/amp/signin", "/amp/settings(/.*)?"},
 		QueryRE:                stringPtr(""),
 		ErrorOnStatefulHeaders: true,
 		MaxLength:              8000,
-	}, *config.URLSet[0].Sign)
+	}), *config.URLSet[0].Sign)
 }
 
 func TestFetchDefaults(t *testing.T) {
@@ -393,7 +1062,7 @@ func TestFetchOverrides(t *testing.T) {
 	`))
 	require.NoError(t, err)
 	require.Equal(t, 1, len(config.URLSet))
-	assert.Equal(t, URLPattern{
+	assert.Equal(t, *withRegexps(&URLPattern{
 		Scheme:        []string{"http"},
 		DomainRE:      ".*",
 		PathRE:        stringPtr("/amp/.*"),
@@ -401,7 +1070,7 @@ func TestFetchOverrides(t *testing.T) {
 		QueryRE:       stringPtr(""),
 		MaxLength:     8000,
 		SamePath:      boolPtr(false),
-	}, *config.URLSet[0].Fetch)
+	}), *config.URLSet[0].Fetch)
 }
 
 func TestFetchInvalidScheme(t *testing.T) {
@@ -425,6 +1094,48 @@ func TestFetchNoDomain(t *testing.T) {
 	`))), "Domain or DomainRE must be specified")
 }
 
+func TestKeySource(t *testing.T) {
+	config, err := ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyEnv = "AMPPKG_KEY"
+		OCSPCache = "/tmp/ocsp"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))
+	require.NoError(t, err)
+	assert.Equal(t, "", config.KeyFile)
+	assert.Equal(t, "AMPPKG_KEY", config.KeyEnv)
+
+	config, err = ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeySigner = "kms"
+		OCSPCache = "/tmp/ocsp"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))
+	require.NoError(t, err)
+	assert.Equal(t, "kms", config.KeySigner)
+
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		OCSPCache = "/tmp/ocsp"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), "must specify KeyFile, KeyEnv, or KeySigner")
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		KeySigner = "kms"
+		OCSPCache = "/tmp/ocsp"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))), "at most one of KeyFile, KeyEnv, and KeySigner may be set")
+}
+
 func TestFetchDomainAndDomainRE(t *testing.T) {
 	assert.Contains(t, errorFrom(ReadConfig([]byte(`
 		CertFile = "cert.pem"
@@ -448,3 +1159,167 @@ func TestFetchErrorOnStatefulHeaders(t *testing.T) {
 		    ErrorOnStatefulHeaders = true
 	`))), "ErrorOnStatefulHeaders not allowed")
 }
+
+func validConfig(ocspCache string) *Config {
+	return &Config{
+		CertFile:  "../../testdata/b3/fullchain.cert",
+		KeyFile:   "../../testdata/b3/server.privkey",
+		OCSPCache: ocspCache,
+		URLSet: []URLSet{{
+			Fetch: &URLPattern{Domain: "www.amppackageexample.com", PathRE: stringPtr("/amp/.*")},
+			Sign:  &URLPattern{Domain: "amppackageexample.com"},
+		}},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	ocspCache := filepath.Join(dir, "ocsp")
+
+	assert.NoError(t, validConfig(ocspCache).Validate())
+	// Validate leaves nothing behind.
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	for _, test := range []struct {
+		desc         string
+		modify       func(*Config)
+		expectedErrs []string
+	}{
+		{"missing cert", func(c *Config) { c.CertFile = filepath.Join(dir, "missing.cert") }, []string{"reading CertFile"}},
+		{"unparseable cert", func(c *Config) { c.CertFile = "../../testdata/b3/server.csr" }, []string{"parsing CertFile ../../testdata/b3/server.csr"}},
+		{"unparseable key", func(c *Config) { c.KeyFile = "../../testdata/b3/server.cert" }, []string{"parsing KeyFile ../../testdata/b3/server.cert"}},
+		{"mismatched key", func(c *Config) { c.KeyFile = "../../testdata/b3/server2.privkey" }, []string{"URLSet.0.Sign: CertFile ../../testdata/b3/fullchain.cert doesn't match KeyFile ../../testdata/b3/server2.privkey"}},
+		{"mismatched domain", func(c *Config) { c.URLSet[0].Sign.Domain = "example.com" }, []string{"doesn't match KeyFile ../../testdata/b3/server.privkey and Domain example.com"}},
+		{"unset KeyEnv", func(c *Config) {
+			c.KeyFile = ""
+			c.KeyEnv = "AMPPKG_TEST_UNSET"
+		}, []string{"KeyEnv is set, but environment variable AMPPKG_TEST_UNSET is not"}},
+		{"no URLSet", func(c *Config) { c.URLSet = nil }, []string{"must specify one or more [[URLSet]]"}},
+		{"missing domains", func(c *Config) {
+			c.URLSet[0].Fetch.Domain = ""
+			c.URLSet[0].Sign.Domain = ""
+		}, []string{"URLSet.0.Fetch: Domain or DomainRE must be specified", "URLSet.0.Sign: Domain must be specified"}},
+		{"bad regexps", func(c *Config) {
+			c.URLSet[0].Fetch.PathRE = stringPtr("(")
+			c.URLSet[0].Sign.QueryRE = stringPtr("[")
+			c.URLSet[0].Sign.PathExcludeRE = []string{"*"}
+		}, []string{"URLSet.0.Fetch: PathRE must be a valid regexp", "URLSet.0.Sign: PathExcludeRE contains invalid regexp \"*\"", "URLSet.0.Sign: QueryRE must be a valid regexp"}},
+		{"unwritable OCSPCache", func(c *Config) { c.OCSPCache = filepath.Join(dir, "missing", "ocsp") }, []string{"OCSPCache must be writable"}},
+		{"several problems", func(c *Config) {
+			c.KeyFile = ""
+			c.URLSet[0].Sign.PathRE = stringPtr("(")
+			c.OCSPCache = ""
+		}, []string{"config has 3 problem(s)", "must specify KeyFile, KeyEnv, or KeySigner", "URLSet.0.Sign: PathRE must be a valid regexp", "must specify OCSPCache"}},
+	} {
+		config := validConfig(ocspCache)
+		test.modify(config)
+		err := config.Validate()
+		if !assert.Error(t, err, test.desc) {
+			continue
+		}
+		for _, expectedErr := range test.expectedErrs {
+			assert.Contains(t, err.Error(), expectedErr, test.desc)
+		}
+	}
+}
+
+func TestEnvSubstitution(t *testing.T) {
+	os.Setenv("AMPPKG_TEST_PEMS", "/etc/amppkg")
+	os.Setenv("AMPPKG_TEST_DOMAIN", "example.com")
+	os.Setenv("AMPPKG_TEST_EMPTY", "")
+	defer os.Unsetenv("AMPPKG_TEST_PEMS")
+	defer os.Unsetenv("AMPPKG_TEST_DOMAIN")
+	defer os.Unsetenv("AMPPKG_TEST_EMPTY")
+
+	config, err := ReadConfig([]byte(`
+		CertFile = "${AMPPKG_TEST_PEMS}/cert.pem"
+		KeyFile = "${AMPPKG_TEST_UNSET:-./pems}/key.pem"
+		OCSPCache = "${AMPPKG_TEST_EMPTY:-/tmp}/ocsp"
+		ForwardedRequestHeaders = ["X-${AMPPKG_TEST_UNSET:-Custom}"]
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "${AMPPKG_TEST_DOMAIN}"
+		    PathRE = "/amp/.*$"
+	`))
+	require.NoError(t, err)
+	assert.Equal(t, "/etc/amppkg/cert.pem", config.CertFile)
+	assert.Equal(t, "./pems/key.pem", config.KeyFile)
+	assert.Equal(t, "/tmp/ocsp", config.OCSPCache)
+	assert.Equal(t, []string{"X-Custom"}, config.ForwardedRequestHeaders)
+	assert.Equal(t, "example.com", config.URLSet[0].Sign.Domain)
+	assert.Equal(t, "/amp/.*$", *config.URLSet[0].Sign.PathRE)
+
+	assert.Equal(t, "expanding URLSet.0.Sign.Domain: environment variable AMPPKG_TEST_UNSET is unset", errorFrom(ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "${AMPPKG_TEST_UNSET}"
+	`))))
+	// Set but empty is not an error, absent a default.
+	assert.Contains(t, errorFrom(ReadConfig([]byte(`
+		CertFile = "${AMPPKG_TEST_EMPTY}"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+	`))), "must specify CertFile")
+}
+
+func TestTransformerOptions(t *testing.T) {
+	config, err := ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		[TransformerOptions]
+		  strip_css_comments = true
+		  parallel_subtrees = true
+		  max_subtree_concurrency = 4
+		  amp_format_precedence = ["AMP4ADS", "AMP"]
+		  tracking_pixel_hosts = ["pixel.example"]
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))
+	require.NoError(t, err)
+	want := &rpb.Request_Options{
+		StripCssComments:      true,
+		ParallelSubtrees:      true,
+		MaxSubtreeConcurrency: 4,
+		AmpFormatPrecedence:   []rpb.Request_HtmlFormat{rpb.Request_AMP4ADS, rpb.Request_AMP},
+		TrackingPixelHosts:    []string{"pixel.example"},
+	}
+	assert.True(t, proto.Equal(want, config.TransformerOptions), "TransformerOptions=%v, want %v", config.TransformerOptions, want)
+
+	config, err = ReadConfig([]byte(`
+		CertFile = "cert.pem"
+		KeyFile = "key.pem"
+		OCSPCache = "/tmp/ocsp"
+		[[URLSet]]
+		  [URLSet.Sign]
+		    Domain = "example.com"
+	`))
+	require.NoError(t, err)
+	assert.Nil(t, config.TransformerOptions)
+
+	for _, options := range []string{
+		`strip_css_comment = true`,
+		`max_subtree_concurrency = -1`,
+		`css_comment_keep_pattern = "("`,
+		`amp_format_precedence = ["AMP5"]`,
+	} {
+		assert.Contains(t, errorFrom(ReadConfig([]byte(`
+			CertFile = "cert.pem"
+			KeyFile = "key.pem"
+			OCSPCache = "/tmp/ocsp"
+			[TransformerOptions]
+			  `+options+`
+			[[URLSet]]
+			  [URLSet.Sign]
+			    Domain = "example.com"
+		`))), "TransformerOptions", options)
+	}
+}
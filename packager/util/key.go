@@ -0,0 +1,137 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// A KeySignerFactory returns the crypto.Signer for the SXG key, e.g. one that
+// signs via a KMS, so that the private key itself need never be loaded.
+type KeySignerFactory func(config *Config) (crypto.Signer, error)
+
+var (
+	keySignersMu sync.RWMutex
+	keySigners   = map[string]KeySignerFactory{}
+)
+
+// RegisterKeySigner makes the signer returned by newSigner available as the
+// SXG key, when KeySigner is name. It is intended to be called from the init
+// function of the package providing the signer, as it must be registered
+// before the config is validated or the key loaded. Registering the same name
+// twice panics.
+func RegisterKeySigner(name string, newSigner KeySignerFactory) {
+	keySignersMu.Lock()
+	defer keySignersMu.Unlock()
+	if _, ok := keySigners[name]; ok {
+		panic("util: RegisterKeySigner called twice for " + name)
+	}
+	keySigners[name] = newSigner
+}
+
+// Returns an error unless exactly one of KeyFile, KeyEnv, and KeySigner is
+// set.
+func validateKeySource(config *Config) error {
+	sources := 0
+	for _, source := range []string{config.KeyFile, config.KeyEnv, config.KeySigner} {
+		if source != "" {
+			sources++
+		}
+	}
+	switch {
+	case sources == 0:
+		return errors.New("must specify KeyFile, KeyEnv, or KeySigner")
+	case sources > 1:
+		return errors.New("at most one of KeyFile, KeyEnv, and KeySigner may be set")
+	}
+	return nil
+}
+
+// keySourceName describes the configured source of the key, for errors.
+func keySourceName(config *Config) string {
+	switch {
+	case config.KeyEnv != "":
+		return "KeyEnv " + config.KeyEnv
+	case config.KeySigner != "":
+		return "KeySigner " + config.KeySigner
+	default:
+		return "KeyFile " + config.KeyFile
+	}
+}
+
+// LoadKey returns the SXG private key from its configured source: the PEM file
+// at KeyFile, the PEM in the environment variable KeyEnv, or the crypto.Signer
+// registered as KeySigner. In the last case, the returned key is that
+// crypto.Signer, and not an *ecdsa.PrivateKey. Either way, its public key is
+// ECDSA.
+func LoadKey(config *Config) (crypto.PrivateKey, error) {
+	if err := validateKeySource(config); err != nil {
+		return nil, err
+	}
+	var key crypto.PrivateKey
+	switch {
+	case config.KeyEnv != "":
+		keyPem, ok := os.LookupEnv(config.KeyEnv)
+		if !ok {
+			return nil, errors.Errorf("KeyEnv is set, but environment variable %s is not", config.KeyEnv)
+		}
+		var err error
+		if key, err = ParsePrivateKey([]byte(keyPem)); err != nil {
+			return nil, errors.Wrapf(err, "parsing KeyEnv %s", config.KeyEnv)
+		}
+	case config.KeySigner != "":
+		keySignersMu.RLock()
+		newSigner, ok := keySigners[config.KeySigner]
+		keySignersMu.RUnlock()
+		if !ok {
+			return nil, errors.Errorf("no KeySigner registered as %q", config.KeySigner)
+		}
+		signer, err := newSigner(config)
+		if err != nil {
+			return nil, errors.Wrapf(err, "creating KeySigner %s", config.KeySigner)
+		}
+		if signer == nil {
+			return nil, errors.Errorf("KeySigner %s returned no signer", config.KeySigner)
+		}
+		key = signer
+	default:
+		keyPem, err := ioutil.ReadFile(config.KeyFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading KeyFile %s", config.KeyFile)
+		}
+		if key, err = ParsePrivateKey(keyPem); err != nil {
+			return nil, errors.Wrapf(err, "parsing KeyFile %s", config.KeyFile)
+		}
+	}
+	if _, ok := PublicKey(key).(*ecdsa.PublicKey); !ok {
+		return nil, errors.Errorf("%s must be ECDSA", keySourceName(config))
+	}
+	return key, nil
+}
+
+// PublicKey returns the public key corresponding to key, or nil if key isn't
+// a crypto.Signer.
+func PublicKey(key crypto.PrivateKey) crypto.PublicKey {
+	if signer, ok := key.(crypto.Signer); ok {
+		return signer.Public()
+	}
+	return nil
+}
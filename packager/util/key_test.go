@@ -0,0 +1,83 @@
+package util_test
+
+import (
+	"crypto"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	pkgt "github.com/ampproject/amppackager/packager/testing"
+	"github.com/ampproject/amppackager/packager/util"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadKeyFromFile(t *testing.T) {
+	key, err := util.LoadKey(&util.Config{KeyFile: "../../testdata/b3/server.privkey"})
+	require.NoError(t, err)
+	assert.Equal(t, pkgt.B3Key, key)
+
+	_, err = util.LoadKey(&util.Config{KeyFile: "../../testdata/b3/server.cert"})
+	assert.Contains(t, errorFrom(err), "parsing KeyFile ../../testdata/b3/server.cert")
+}
+
+func TestLoadKeyFromEnv(t *testing.T) {
+	keyPem, err := ioutil.ReadFile("../../testdata/b3/server.privkey")
+	require.NoError(t, err)
+	os.Setenv("AMPPKG_TEST_KEY", string(keyPem))
+	defer os.Unsetenv("AMPPKG_TEST_KEY")
+
+	key, err := util.LoadKey(&util.Config{KeyEnv: "AMPPKG_TEST_KEY"})
+	require.NoError(t, err)
+	assert.Equal(t, pkgt.B3Key, key)
+	assert.Nil(t, util.CertificateMatches(pkgt.B3Certs[0], key, "amppackageexample.com"))
+
+	_, err = util.LoadKey(&util.Config{KeyEnv: "AMPPKG_TEST_UNSET"})
+	assert.Contains(t, errorFrom(err), "environment variable AMPPKG_TEST_UNSET is not")
+
+	os.Setenv("AMPPKG_TEST_KEY", "not a key")
+	_, err = util.LoadKey(&util.Config{KeyEnv: "AMPPKG_TEST_KEY"})
+	assert.Contains(t, errorFrom(err), "parsing KeyEnv AMPPKG_TEST_KEY")
+}
+
+func TestLoadKeyFromSigner(t *testing.T) {
+	signer := &pkgt.FakeSigner{Key: pkgt.B3Key.(crypto.Signer)}
+	var gotConfig *util.Config
+	util.RegisterKeySigner("test-signer", func(config *util.Config) (crypto.Signer, error) {
+		gotConfig = config
+		return signer, nil
+	})
+	util.RegisterKeySigner("test-failing-signer", func(*util.Config) (crypto.Signer, error) {
+		return nil, errors.New("KMS unavailable")
+	})
+	util.RegisterKeySigner("test-rsa-signer", func(*util.Config) (crypto.Signer, error) {
+		return pkgt.CAKey, nil
+	})
+
+	config := &util.Config{KeySigner: "test-signer"}
+	key, err := util.LoadKey(config)
+	require.NoError(t, err)
+	assert.Same(t, signer, key)
+	assert.Same(t, config, gotConfig)
+	// The signer's public key is used to match the cert.
+	assert.Nil(t, util.CertificateMatches(pkgt.B3Certs[0], key, "amppackageexample.com"))
+	assert.NotNil(t, util.CertificateMatches(pkgt.B3Certs2[0], key, "amppackageexample.com"))
+
+	_, err = util.LoadKey(&util.Config{KeySigner: "test-failing-signer"})
+	assert.Contains(t, errorFrom(err), "creating KeySigner test-failing-signer: KMS unavailable")
+	_, err = util.LoadKey(&util.Config{KeySigner: "test-rsa-signer"})
+	assert.Contains(t, errorFrom(err), "KeySigner test-rsa-signer must be ECDSA")
+	_, err = util.LoadKey(&util.Config{KeySigner: "test-unregistered-signer"})
+	assert.Contains(t, errorFrom(err), `no KeySigner registered as "test-unregistered-signer"`)
+	assert.Panics(t, func() {
+		util.RegisterKeySigner("test-signer", func(*util.Config) (crypto.Signer, error) { return signer, nil })
+	})
+}
+
+func TestLoadKeySource(t *testing.T) {
+	_, err := util.LoadKey(&util.Config{})
+	assert.Contains(t, errorFrom(err), "must specify KeyFile, KeyEnv, or KeySigner")
+	_, err = util.LoadKey(&util.Config{KeyFile: "../../testdata/b3/server.privkey", KeyEnv: "AMPPKG_TEST_KEY"})
+	assert.Contains(t, errorFrom(err), "at most one of KeyFile, KeyEnv, and KeySigner may be set")
+}
@@ -0,0 +1,179 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// Implements the URL-matching common to both fetchURLMatches and signURLMatches.
+func urlMatches(url *url.URL, pattern URLPattern) error {
+	if url.Opaque != "" {
+		// Opaque URLs are unfetchable, and also disallowed by the spec
+		// as sign URLs.
+		return errors.New("URL is opaque")
+	}
+	if url.User != nil {
+		// The `user:pass@` portion of a URL is not technically
+		// disallowed by the spec, but is a weird enough request that
+		// it seems wise to disable this capability by default (i.e.
+		// more likely a sign of attack than a legitimate request).
+		// Please open an issue if you have a legitimate need for this
+		// in a fetch/sign URL.
+		return errors.New("URL contains user")
+	}
+	// PathRE matches the path component of the URL, including the
+	// beginning slash.
+	if !pattern.PathREMatches(url.EscapedPath()) {
+		return errors.New("PathRE doesn't match")
+	}
+	// If any of PathExcludeRE matches, the URL does not match.
+	if re, ok := pattern.PathExcludeREMatch(url.EscapedPath()); ok {
+		return errors.Errorf("PathExcludeRE matches: %s", re)
+	}
+	// QueryRE matches the query component of the URL, *not* including the
+	// beginning question mark.
+	if !pattern.QueryREMatches(url.RawQuery) {
+		return errors.New("QueryRE doesn't match")
+	}
+	if pattern.QueryMaxLength > 0 && len(url.RawQuery) > pattern.QueryMaxLength {
+		return errors.New("Query too long")
+	}
+	if len(url.String()) > pattern.MaxLength {
+		return errors.New("URL too long")
+	}
+	return nil
+}
+
+// True iff actualScheme is an element of expectedSchemes.
+func schemeMatches(actualScheme string, expectedSchemes []string) bool {
+	for _, expectedScheme := range expectedSchemes {
+		if actualScheme == expectedScheme {
+			return true
+		}
+	}
+	return false
+}
+
+// True iff url matches pattern, as defined by an [URLSet.Fetch] block in the
+// config file. The format of this URLPattern is validated by
+// validateFetchURLPattern in config.go.
+func fetchURLMatches(url *url.URL, pattern *URLPattern) error {
+	// If the fetch block is not specified, then this particular URLSet is
+	// a "sign-only" config. That is: only the sign URL should be passed to
+	// the Signer; this will be used as the fetch URL as well.
+	if pattern == nil {
+		if url == nil {
+			return nil
+		} else {
+			return errors.New("If URLSet.Fetch is unspecified, then so should ?fetch= be.")
+		}
+	}
+	if url == nil {
+		return errors.New("?fetch= is unspecified")
+	}
+	// The fetch block may specify which schemes are allowed.
+	if !schemeMatches(url.Scheme, pattern.Scheme) {
+		return errors.New("Scheme doesn't match")
+	}
+	// The fetch block may specify either Domain or DomainRE.
+	if pattern.Domain != "" && url.Host != pattern.Domain {
+		return errors.New("Domain doesn't match")
+	}
+	if pattern.DomainRE != "" && !pattern.DomainREMatches(url.Host) {
+		return errors.New("DomainRE doesn't match")
+	}
+	return urlMatches(url, *pattern)
+}
+
+// Determines if b is either a valid byte of a fallback URL, per
+// https://wicg.github.io/webpackage/draft-yasskin-http-origin-signed-responses.html#seccons-content-sniffing
+// item 3.1, or is the U+0025 (%) character.
+func isFallbackURLCodePoint(b byte) bool {
+	// https://url.spec.whatwg.org/#url-code-points, but in codepoint order:
+	//
+	// U+0021 (!), U+0024 ($), U+0026 (&), U+0027 ('), U+0028 LEFT PARENTHESIS,
+	// U+0029 RIGHT PARENTHESIS, U+002A (*), U+002B (+), U+002C (,), U+002D (-),
+	// U+002E (.), U+002F (/), ASCII digits (U+0030 - U+0039), U+003A (:),
+	// U+003B (;), U+003D (=), U+003F (?), U+0040 (@),
+	// ASCII upper alpha (U+0041 - U+005A), U+005F (_),
+	// ASCII lower alpha (U+0061 - U+007A), U+007E (~)
+
+	// Vaguely ordered most to least common, to aid short-circuiting:
+	return (b >= 'a' && b <= 'z') || b == '_' || b == '~' ||
+		(b >= '!' && b <= 'Z' && b != '"' /*x22*/ && b != '#' /*x23*/ && b != '<' /*x3C*/ && b != '>' /*x3E*/)
+}
+
+// True iff url matches pattern, as defined by an [URLSet.Sign] block in the
+// config file. The format of this URLPattern is validated by
+// validateSignURLPattern in config.go.
+func signURLMatches(url *url.URL, pattern *URLPattern) error {
+	for _, b := range []byte(url.String()) {
+		if !isFallbackURLCodePoint(b) {
+			return errors.New("Contains invalid byte")
+		}
+	}
+
+	// The sign block may not specify which schemes are allowed. Only HTTPS
+	// is allowed:
+	// https://wicg.github.io/webpackage/draft-yasskin-httpbis-origin-signed-exchanges-impl.html#rfc.section.5.3
+	if url.Scheme != "https" {
+		return errors.New("Scheme doesn't match")
+	}
+	// The sign block may only specify Domain. DomainRE would only be
+	// useful for wildcard SXG certificates. Please open an issue if you
+	// have a valid wildcard SXG certificate and a legitimate need for
+	// this. This should be implemented with some thought into how to
+	// ensure that the sign URL matches the fetch URL.
+	if url.Host != pattern.Domain {
+		return errors.New("Domain doesn't match")
+	}
+	return urlMatches(url, *pattern)
+}
+
+// Returns nil iff the given fetchURL and signURL match the set (as specified
+// by an [[URLSet]] block in the config file), and, if SamePath is true
+// (default), fetchURL and signURL match each other. fetchURL is nil if the
+// request specified no fetch URL. Otherwise, the error describes the mismatch.
+func (this *URLSet) MatchURLs(fetchURL *url.URL, signURL *url.URL) error {
+	if err := fetchURLMatches(fetchURL, this.Fetch); err != nil {
+		return errors.Wrap(err, "fetch URL")
+	}
+	if err := signURLMatches(signURL, this.Sign); err != nil {
+		return errors.Wrap(err, "sign URL")
+	}
+	theyMatch := this.Fetch == nil || !*this.Fetch.SamePath || fetchURL.RequestURI() == signURL.RequestURI()
+	if !theyMatch {
+		return errors.New("fetch and sign paths don't match")
+	}
+	return nil
+}
+
+// Matches reports whether u may be signed per the set, applying its domain,
+// path, and query checks (including length limits). If the set has a Fetch
+// block, u is also checked against it, as the fetch URL. If it doesn't match,
+// the error describes why.
+func (this *URLSet) Matches(u *url.URL) (bool, error) {
+	var fetchURL *url.URL
+	if this.Fetch != nil {
+		fetchURL = u
+	}
+	if err := this.MatchURLs(fetchURL, u); err != nil {
+		return false, err
+	}
+	return true, nil
+}
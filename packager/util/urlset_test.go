@@ -0,0 +1,155 @@
+package util
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func urlOrDie(spec string) *url.URL {
+	url, err := url.Parse(spec)
+	if err != nil {
+		panic(err)
+	}
+	return url
+}
+
+func TestFetchURLMatches(t *testing.T) {
+	assert.NoError(t, fetchURLMatches(nil, nil))
+	assert.NoError(t, fetchURLMatches(urlOrDie("http://example.com/"),
+		&URLPattern{Scheme: []string{"http"}, PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000}))
+	assert.NoError(t, fetchURLMatches(urlOrDie("http://example.com/"),
+		&URLPattern{Scheme: []string{"http"}, Domain: "example.com", PathRE: stringPtr("/"), QueryRE: stringPtr(""), MaxLength: 2000}))
+	assert.NoError(t, fetchURLMatches(urlOrDie("http://example.com/"),
+		&URLPattern{Scheme: []string{"http"}, DomainRE: "example.*", PathRE: stringPtr("/"), QueryRE: stringPtr(""), MaxLength: 2000}))
+
+	assert.EqualError(t, fetchURLMatches(urlOrDie("http://example.com/"), nil),
+		"If URLSet.Fetch is unspecified, then so should ?fetch= be.")
+	assert.EqualError(t, fetchURLMatches(urlOrDie("http://example.com/"),
+		&URLPattern{Scheme: []string{"https"}, PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000}),
+		"Scheme doesn't match")
+	assert.EqualError(t, fetchURLMatches(urlOrDie("http://example.com/"),
+		&URLPattern{Scheme: []string{"http"}, Domain: "wrongexample.com", PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000}),
+		"Domain doesn't match")
+	assert.EqualError(t, fetchURLMatches(urlOrDie("http://example.com:1234/"),
+		&URLPattern{Scheme: []string{"http"}, Domain: "example.com", PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000}),
+		"Domain doesn't match")
+	assert.EqualError(t, fetchURLMatches(urlOrDie("http://example.com/"),
+		&URLPattern{Scheme: []string{"http"}, DomainRE: "xample", PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000}),
+		"DomainRE doesn't match")
+
+	assert.EqualError(t, fetchURLMatches(urlOrDie("http:example.com/"),
+		&URLPattern{Scheme: []string{"http"}, PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000}),
+		"URL is opaque")
+	assert.EqualError(t, fetchURLMatches(urlOrDie("http://user@example.com/"),
+		&URLPattern{Scheme: []string{"http"}, PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000}),
+		"URL contains user")
+	assert.EqualError(t, fetchURLMatches(urlOrDie("http://example.com/"),
+		&URLPattern{Scheme: []string{"http"}, PathRE: stringPtr("/amp/.*"), QueryRE: stringPtr(".*"), MaxLength: 2000}),
+		"PathRE doesn't match")
+	assert.EqualError(t, fetchURLMatches(urlOrDie("http://example.com/"),
+		&URLPattern{Scheme: []string{"http"}, PathRE: stringPtr(".*"), PathExcludeRE: []string{"/"}, QueryRE: stringPtr(".*"), MaxLength: 2000}),
+		"PathExcludeRE matches: /")
+	assert.EqualError(t, fetchURLMatches(urlOrDie("http://example.com/?sessid=foo"),
+		&URLPattern{Scheme: []string{"http"}, PathRE: stringPtr(".*"), QueryRE: stringPtr(""), MaxLength: 2000}),
+		"QueryRE doesn't match")
+	assert.EqualError(t, fetchURLMatches(urlOrDie("http://example.com/"),
+		&URLPattern{Scheme: []string{"http"}, PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 10}),
+		"URL too long")
+}
+
+func TestIsFallbackURLCodePoint(t *testing.T) {
+	// https://url.spec.whatwg.org/#url-code-points + "%", in codepoint order:
+	validURLCodepoints := `!$%&'()*+,-./0123456789:;=?@ABCDEFGHIJKLMNOPQRSTUVWXYZ_abcdefghijklmnopqrstuvwxyz~`
+	for b := 0; b < 0x100; b++ {
+		expected := strings.ContainsRune(validURLCodepoints, rune(b))
+		assert.Equal(t, expected, isFallbackURLCodePoint(byte(b)), "char: %#v", string(rune(b)))
+	}
+}
+
+func TestSignURLMatches(t *testing.T) {
+	assert.NoError(t, signURLMatches(urlOrDie("https://example.com/"),
+		&URLPattern{Domain: "example.com", PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000}))
+
+	assert.EqualError(t, signURLMatches(urlOrDie("http://example.com/"),
+		&URLPattern{Domain: "example.com", PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000}),
+		"Scheme doesn't match")
+	assert.EqualError(t, signURLMatches(urlOrDie("https://wrongexample.com/"),
+		&URLPattern{Domain: "example.com", PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000}),
+		"Domain doesn't match")
+}
+
+func TestURLsMatch(t *testing.T) {
+	config := URLSet{
+		Fetch: &URLPattern{
+			Scheme: []string{"http"}, Domain: "fetch.com",
+			PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000,
+			SamePath: boolPtr(true)},
+		Sign: &URLPattern{
+			Domain: "sign.com",
+			PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000},
+	}
+
+	assert.NoError(t, config.MatchURLs(urlOrDie("http://fetch.com/"), urlOrDie("https://sign.com/")))
+
+	assert.EqualError(t, config.MatchURLs(urlOrDie("https://fetch.com/"), urlOrDie("https://sign.com/")),
+		"fetch URL: Scheme doesn't match")
+	assert.EqualError(t, config.MatchURLs(urlOrDie("http://fetch.com/"), urlOrDie("http://sign.com/")),
+		"sign URL: Scheme doesn't match")
+	assert.EqualError(t, config.MatchURLs(urlOrDie("http://fetch.com/"), urlOrDie("https://sign.com/other")),
+		"fetch and sign paths don't match")
+
+	*config.Fetch.SamePath = false
+	assert.NoError(t, config.MatchURLs(urlOrDie("http://fetch.com/"), urlOrDie("https://sign.com/other")))
+}
+
+func TestQueryMaxLength(t *testing.T) {
+	pattern := &URLPattern{Scheme: []string{"http"}, PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000, QueryMaxLength: 5}
+	assert.NoError(t, fetchURLMatches(urlOrDie("http://example.com/?a=123"), pattern))
+	assert.EqualError(t, fetchURLMatches(urlOrDie("http://example.com/?a=1234"), pattern),
+		"Query too long")
+
+	// The path doesn't count towards the query length.
+	assert.NoError(t, fetchURLMatches(urlOrDie("http://example.com/a/long/path?a=1"), pattern))
+
+	assert.EqualError(t, ValidateURLPattern(&URLPattern{QueryMaxLength: -1}), "QueryMaxLength must be non-negative")
+}
+
+func TestURLSetMatches(t *testing.T) {
+	set := URLSet{
+		Sign: &URLPattern{
+			Domain: "example.com",
+			PathRE: stringPtr("/amp/.*"), QueryRE: stringPtr(".*"), MaxLength: 2000, QueryMaxLength: 10},
+	}
+
+	matches, err := set.Matches(urlOrDie("https://example.com/amp/page?q=short"))
+	assert.NoError(t, err)
+	assert.True(t, matches)
+
+	matches, err = set.Matches(urlOrDie("https://example.com/amp/page?q=much-too-long"))
+	assert.EqualError(t, err, "sign URL: Query too long")
+	assert.False(t, matches)
+
+	matches, err = set.Matches(urlOrDie("https://example.com/other"))
+	assert.EqualError(t, err, "sign URL: PathRE doesn't match")
+	assert.False(t, matches)
+
+	matches, err = set.Matches(urlOrDie("https://other.com/amp/page"))
+	assert.EqualError(t, err, "sign URL: Domain doesn't match")
+	assert.False(t, matches)
+
+	// With a Fetch block, the URL must also match it.
+	set.Fetch = &URLPattern{
+		Scheme: []string{"https"}, Domain: "example.com",
+		PathRE: stringPtr(".*"), QueryRE: stringPtr(".*"), MaxLength: 2000, QueryMaxLength: 3,
+		SamePath: boolPtr(true)}
+	matches, err = set.Matches(urlOrDie("https://example.com/amp/page?q=a"))
+	assert.NoError(t, err)
+	assert.True(t, matches)
+
+	matches, err = set.Matches(urlOrDie("https://example.com/amp/page?q=short"))
+	assert.EqualError(t, err, "fetch URL: Query too long")
+	assert.False(t, matches)
+}
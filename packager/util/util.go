@@ -46,7 +46,10 @@ func CertName(cert *x509.Certificate) string {
 
 const ValidityMapPath = "/amppkg/validity"
 const HealthzPath = "/healthz"
+const HealthzDetailPath = "/amppkg/healthz/detail"
 const MetricsPath = "/metrics"
+const ACMEChallengePrefix = "/.well-known/acme-challenge"
+const TransformPath = "/amppkg/transform"
 
 // ParsePrivateKey returns the first PEM block that looks like a private key.
 func ParsePrivateKey(keyPem []byte) (crypto.PrivateKey, error) {
@@ -99,8 +102,16 @@ func CanSignHttpExchanges(cert *x509.Certificate) error {
 
 // Returns nil if the certificate matches the private key and domain, else the appropriate error.
 func CertificateMatches(cert *x509.Certificate, priv crypto.PrivateKey, domain string) error {
-	certPubKey := cert.PublicKey.(*ecdsa.PublicKey)
-	pubKey := priv.(*ecdsa.PrivateKey).PublicKey
+	certPubKey, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return errors.New("PublicKey of cert is not ECDSA")
+	}
+	// priv may be a crypto.Signer other than *ecdsa.PrivateKey, e.g. one
+	// backed by a KMS, so compare its public key.
+	pubKey, ok := PublicKey(priv).(*ecdsa.PublicKey)
+	if !ok {
+		return errors.New("PublicKey of key is not ECDSA")
+	}
 	if certPubKey.Curve != pubKey.Curve {
 		return errors.New("PublicKey.Curve not match")
 	}
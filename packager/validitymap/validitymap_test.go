@@ -14,7 +14,7 @@ func TestValidityMap(t *testing.T) {
 	handler, err := New()
 	require.NoError(t, err)
 
-	resp := pkgt.NewRequest(t, mux.New(nil, nil, handler, nil, nil), "/amppkg/validity").Do()
+	resp := pkgt.NewRequest(t, mux.New(mux.Handlers{ValidityMap: handler}), "/amppkg/validity").Do()
 	defer resp.Body.Close()
 	assert.Equal(t, "application/cbor", resp.Header.Get("Content-Type"))
 	assert.Equal(t, "public, max-age=604800", resp.Header.Get("Cache-Control"))
@@ -58,6 +58,8 @@ const (
 
 	AMPExperiment = "amp-experiment"
 
+	AMPKeyframes = "amp-keyframes"
+
 	AMPRuntime = "amp-runtime"
 
 	AMPStory = "amp-story"
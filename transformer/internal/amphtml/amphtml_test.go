@@ -381,3 +381,26 @@ func TestNewDOM(t *testing.T) {
 		}
 	}
 }
+
+func TestNewDOMSynthesizesBody(t *testing.T) {
+	for _, input := range []string{
+		"<html><head><title>t</title></head></html>",
+		"<title>t</title><p>hello</p>",
+	} {
+		n, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("html.Parse(%s) failed unexpectedly. %v", input, err)
+		}
+		dom, err := NewDOM(n)
+		if err != nil {
+			t.Errorf("NewDOM(%s) failed unexpectedly. %v", input, err)
+			continue
+		}
+		if dom.BodyNode == nil || dom.BodyNode.DataAtom != atom.Body || dom.BodyNode.Parent != dom.HTMLNode {
+			t.Errorf("NewDOM(%s).BodyNode=%v, want the <body> child of <html>", input, dom.BodyNode)
+		}
+		if dom.HeadNode.FirstChild == nil || dom.HeadNode.FirstChild.DataAtom != atom.Title {
+			t.Errorf("NewDOM(%s).HeadNode has no <title>", input)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package css
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// StripComments returns css with all comments removed, except those for which
+// keep returns true. keep is passed the full comment, including the /* and */
+// delimiters; it may be nil. Comments within strings are not comments, and so
+// are left alone.
+//
+// A comment separating two name code points (e.g. "1px/**/2px") is replaced
+// with a single space, so that removing it does not join two tokens into one.
+func StripComments(css string, keep func(string) bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(css); {
+		switch c := css[i]; {
+		case c == '"' || c == '\'':
+			end := endOfString(css, i)
+			sb.WriteString(css[i:end])
+			i = end
+		case c == '\\' && i+1 < len(css):
+			// An escaped code point, e.g. \/ or \".
+			_, size := utf8.DecodeRuneInString(css[i+1:])
+			sb.WriteString(css[i : i+1+size])
+			i += 1 + size
+		case c == '/' && strings.HasPrefix(css[i:], "/*"):
+			end := strings.Index(css[i+2:], "*/")
+			if end == -1 {
+				end = len(css)
+			} else {
+				end += i + 4
+			}
+			comment := css[i:end]
+			if keep != nil && keep(comment) {
+				sb.WriteString(comment)
+			} else if before, after := lastRune(sb.String()), firstRune(css[end:]); isName(before) && isName(after) {
+				sb.WriteByte(' ')
+			}
+			i = end
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+	return sb.String()
+}
+
+// endOfString returns the index just past the end of the string token
+// starting at css[start], which must be a quote. Unterminated strings end at
+// a newline or the end of the input, per
+// https://www.w3.org/TR/css-syntax-3/#consume-string-token.
+func endOfString(css string, start int) int {
+	quote := css[start]
+	for i := start + 1; i < len(css); i++ {
+		switch css[i] {
+		case quote:
+			return i + 1
+		case '\n':
+			return i
+		case '\\':
+			i++
+		}
+	}
+	return len(css)
+}
+
+// lastRune returns the last code point of s, or 0 if s is empty.
+func lastRune(s string) rune {
+	if s == "" {
+		return 0
+	}
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return r
+}
+
+// firstRune returns the first code point of s, or 0 if s is empty.
+func firstRune(s string) rune {
+	if s == "" {
+		return 0
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	return r
+}
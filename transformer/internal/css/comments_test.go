@@ -0,0 +1,50 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package css
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStripComments(t *testing.T) {
+	keepBang := func(comment string) bool { return strings.HasPrefix(comment, "/*!") }
+	tcs := []struct{ desc, input, expected string }{
+		{"no comments", "a{color:red}", "a{color:red}"},
+		{"comment", "/* hi */a{color:red}", "a{color:red}"},
+		{"multiple comments", "a{/* 1 */color:/* 2 */red}/* 3 */", "a{color:red}"},
+		{"multi-line comment", "a{color:red}/*\n * hi\n */", "a{color:red}"},
+		{"unterminated comment", "a{color:red}/* hi", "a{color:red}"},
+		{"between names", "a{margin:1px/**/2px}", "a{margin:1px 2px}"},
+		{"in string", `a::after{content:"/* hi */"}`, `a::after{content:"/* hi */"}`},
+		{"in single-quoted string", `a::after{content:'/* hi */'}`, `a::after{content:'/* hi */'}`},
+		{"escaped quote in string", `a::after{content:"\"/* hi */"}/* bye */`, `a::after{content:"\"/* hi */"}`},
+		{"escaped slash", `a\/*b{}`, `a\/*b{}`},
+		{"kept", "/*! license */a{}/* not */", "/*! license */a{}"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			if actual := StripComments(tc.input, keepBang); actual != tc.expected {
+				t.Errorf("StripComments(%q) = %q, want %q", tc.input, actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestStripCommentsNilKeep(t *testing.T) {
+	if actual := StripComments("/*! license */a{}", nil); actual != "a{}" {
+		t.Errorf("StripComments() = %q, want %q", actual, "a{}")
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package css
+
+import (
+	"errors"
+	"strings"
+)
+
+// Declaration is a single declaration within a list, such as the value of a
+// style attribute.
+type Declaration struct {
+	// Property is the lowercased property name, e.g. "position", or empty if
+	// the declaration is malformed.
+	Property string
+	// Value is the value of the declaration, without surrounding whitespace
+	// or any !important.
+	Value string
+	// Important is true if the declaration ends in !important.
+	Important bool
+	// Raw is the text of the declaration, excluding the terminating semicolon.
+	Raw string
+}
+
+// ParseDeclarations splits a declaration list, such as "color: red; margin: 0",
+// into its declarations, per
+// 5.4.5 https://www.w3.org/TR/css-syntax-3/#consume-a-list-of-declarations
+// Joining the Raw fields with ";" reconstructs the (preprocessed) input.
+func ParseDeclarations(css string) ([]Declaration, error) {
+	tokens := NewTokenizer(css).All()
+	if last := tokens[len(tokens)-1]; last.Type == ErrorToken {
+		return nil, errors.New(last.Value)
+	}
+	var decls []Declaration
+	for _, declTokens := range splitDeclarations(tokens) {
+		decls = append(decls, parseDeclaration(declTokens))
+	}
+	return decls, nil
+}
+
+// splitDeclarations splits the tokens of a declaration list at the semicolons
+// separating its declarations.
+func splitDeclarations(tokens []Token) [][]Token {
+	var ret [][]Token
+	start := 0
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i].Type == SemicolonToken {
+			ret = append(ret, tokens[start:i])
+			start = i + 1
+			continue
+		}
+		i += consumeAComponentValue(tokens[i:])
+	}
+	return append(ret, tokens[start:])
+}
+
+// parseDeclaration parses the tokens of a single declaration, per
+// 5.4.6 https://www.w3.org/TR/css-syntax-3/#consume-a-declaration
+func parseDeclaration(tokens []Token) Declaration {
+	var raw strings.Builder
+	for i := range tokens {
+		if tokens[i].Type != EOFToken {
+			raw.WriteString(tokens[i].String())
+		}
+	}
+	decl := Declaration{Raw: raw.String()}
+	tokens = trimWhitespaceTokens(tokens)
+	if len(tokens) < 2 || tokens[0].Type != IdentToken {
+		return decl
+	}
+	property := tokens[0].Value
+	tokens = trimWhitespaceTokens(tokens[1:])
+	if len(tokens) == 0 || tokens[0].Type != ColonToken {
+		return decl
+	}
+	tokens = trimWhitespaceTokens(tokens[1:])
+	if n := len(tokens); n >= 2 && tokens[n-1].Type == IdentToken && strings.EqualFold(tokens[n-1].Value, "important") {
+		if bang := trimWhitespaceTokens(tokens[:n-1]); len(bang) > 0 && bang[len(bang)-1].Type == DelimToken && bang[len(bang)-1].Value == "!" {
+			decl.Important = true
+			tokens = trimWhitespaceTokens(bang[:len(bang)-1])
+		}
+	}
+	decl.Property = strings.ToLower(property)
+	var value strings.Builder
+	for i := range tokens {
+		value.WriteString(tokens[i].String())
+	}
+	decl.Value = value.String()
+	return decl
+}
+
+// trimWhitespaceTokens returns tokens without any leading or trailing
+// whitespace or EOF tokens.
+func trimWhitespaceTokens(tokens []Token) []Token {
+	for len(tokens) > 0 && (tokens[0].Type == WhitespaceToken || tokens[0].Type == EOFToken) {
+		tokens = tokens[1:]
+	}
+	for len(tokens) > 0 && (tokens[len(tokens)-1].Type == WhitespaceToken || tokens[len(tokens)-1].Type == EOFToken) {
+		tokens = tokens[:len(tokens)-1]
+	}
+	return tokens
+}
@@ -0,0 +1,73 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package css
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseDeclarations(t *testing.T) {
+	tcs := []struct {
+		desc, input string
+		expected    []Declaration
+	}{
+		{
+			desc:  "simple",
+			input: "color: red;Margin:0",
+			expected: []Declaration{
+				{Property: "color", Value: "red", Raw: "color: red"},
+				{Property: "margin", Value: "0", Raw: "Margin:0"},
+			},
+		},
+		{
+			desc:  "important",
+			input: " position : fixed ! IMPORTANT ;",
+			expected: []Declaration{
+				{Property: "position", Value: "fixed", Important: true, Raw: " position : fixed ! IMPORTANT "},
+				{Raw: ""},
+			},
+		},
+		{
+			desc:  "semicolons within functions and strings",
+			input: `background: url("a;b") no-repeat; content: ';'; width: calc(1px + (2px;))`,
+			expected: []Declaration{
+				{Property: "background", Value: `url("a;b") no-repeat`, Raw: `background: url("a;b") no-repeat`},
+				{Property: "content", Value: "';'", Raw: " content: ';'"},
+				{Property: "width", Value: "calc(1px + (2px;))", Raw: " width: calc(1px + (2px;))"},
+			},
+		},
+		{
+			desc:  "malformed",
+			input: "color red; : red; 1px: 0",
+			expected: []Declaration{
+				{Raw: "color red"},
+				{Raw: " : red"},
+				{Raw: " 1px: 0"},
+			},
+		},
+	}
+	for _, tc := range tcs {
+		decls, err := ParseDeclarations(tc.input)
+		if err != nil {
+			t.Errorf("%s: ParseDeclarations(%q) unexpectedly failed %q", tc.desc, tc.input, err)
+			continue
+		}
+		if diff := cmp.Diff(tc.expected, decls); diff != "" {
+			t.Errorf("%s: ParseDeclarations(%q) differs (-want +got):\n%s", tc.desc, tc.input, diff)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package css
+
+import (
+	"errors"
+	"strings"
+)
+
+// A Violation is a disallowed at-rule or declaration found by StripDisallowed.
+type Violation struct {
+	// Line is the 1-based line of the stylesheet on which it starts.
+	Line int
+	// Name is the at-rule, e.g. "@import", or the property, e.g. "behavior".
+	Name string
+}
+
+// StripDisallowed returns the stylesheet without the at-rules and the
+// declarations of style rules for which the allow functions return false, and
+// the Violations removed, in order. allowAtRule is passed the lowercase name
+// of the at-rule, without the @ or any vendor prefix (e.g. "keyframes" for
+// @-webkit-keyframes); allowProperty is passed the lowercase property name.
+// Within allowed @media and @supports rules, the nested rules are checked too.
+// Declarations within other at-rules (e.g. @font-face) are kept.
+func StripDisallowed(css string, allowAtRule, allowProperty func(string) bool) (string, []Violation, error) {
+	tokens := NewTokenizer(css).All()
+	if last := tokens[len(tokens)-1]; last.Type == ErrorToken {
+		return "", nil, errors.New(last.Value)
+	}
+	var violations []Violation
+	var sb strings.Builder
+	ruleFilter{
+		keepAtRule: func(scope string, rule []Token) bool {
+			if allowAtRule(atRuleName(rule[0].Value)) {
+				return true
+			}
+			violations = append(violations, Violation{rule[0].line(), "@" + strings.ToLower(rule[0].Value)})
+			return false
+		},
+		keepDeclaration: func(decl Declaration, tokens []Token) bool {
+			if allowProperty(decl.Property) {
+				return true
+			}
+			violations = append(violations, Violation{trimWhitespaceTokens(tokens)[0].line(), decl.Property})
+			return false
+		},
+	}.filterRules(tokens, "", &sb)
+	return sb.String(), violations, nil
+}
+
+// line returns the 1-based line of the (preprocessed) input on which the token
+// starts.
+func (t *Token) line() int {
+	return 1 + strings.Count(t.parent.input[:t.startPos], "\n")
+}
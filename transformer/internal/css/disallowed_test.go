@@ -0,0 +1,71 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package css
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStripDisallowed(t *testing.T) {
+	allowAtRule := func(name string) bool { return name != "import" }
+	allowProperty := func(property string) bool { return property != "behavior" }
+	tcs := []struct {
+		desc, input, expected string
+		violations            []Violation
+	}{
+		{
+			desc:     "keeps valid rules",
+			input:    "a { color: red } @media print { b { margin: 0 } }",
+			expected: "a { color: red } @media print { b { margin: 0 } }",
+		},
+		{
+			desc:       "strips import",
+			input:      "@import url(a.css);\n@IMPORT 'b.css';\na { color: red }",
+			expected:   "\n\na { color: red }",
+			violations: []Violation{{1, "@import"}, {2, "@import"}},
+		},
+		{
+			desc:       "strips declarations",
+			input:      "a {\n  behavior: url(a.htc);\n  color: red;\n  BEHAVIOR: url(b.htc) }",
+			expected:   "a {\n  color: red}",
+			violations: []Violation{{2, "behavior"}, {4, "behavior"}},
+		},
+		{
+			desc:       "within media",
+			input:      "@media print {\n  @import 'a.css';\n  a { color: red; behavior: none }\n}",
+			expected:   "@media print {\n  \n  a { color: red}\n}",
+			violations: []Violation{{2, "@import"}, {3, "behavior"}},
+		},
+		{
+			desc:     "keeps declarations in other at-rules",
+			input:    "@font-face { behavior: none } @-webkit-keyframes a { from { behavior: none } }",
+			expected: "@font-face { behavior: none } @-webkit-keyframes a { from { behavior: none } }",
+		},
+	}
+	for _, tc := range tcs {
+		output, violations, err := StripDisallowed(tc.input, allowAtRule, allowProperty)
+		if err != nil {
+			t.Errorf("%s: StripDisallowed(%q) unexpectedly failed %q", tc.desc, tc.input, err)
+			continue
+		}
+		if output != tc.expected {
+			t.Errorf("%s: StripDisallowed(%q)=%q, want=%q", tc.desc, tc.input, output, tc.expected)
+		}
+		if !reflect.DeepEqual(violations, tc.violations) {
+			t.Errorf("%s: StripDisallowed(%q) violations=%v, want=%v", tc.desc, tc.input, violations, tc.violations)
+		}
+	}
+}
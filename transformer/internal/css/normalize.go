@@ -0,0 +1,253 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package css
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// ruleListAtRules are the at-rules whose blocks contain rules, rather than
+// declarations. Within @keyframes, only the declarations of each keyframe
+// are normalized, not the keyframe selectors.
+var ruleListAtRules = map[string]bool{
+	"media":     true,
+	"supports":  true,
+	"keyframes": true,
+}
+
+// NormalizeValues returns the stylesheet with the colors and numbers in its
+// declaration values written in their shortest equivalent form: hex colors
+// are lowercased and shortened (#AABBCC becomes #abc), and numbers lose their
+// leading and trailing zeros (0.50em becomes .5em). Selectors, at-rule
+// preludes, custom properties, and numbers in scientific notation are left
+// untouched.
+func NormalizeValues(css string) (string, error) {
+	// The tokenizer does not recognize comments, so tokenize the text
+	// between them separately, and copy the comments verbatim.
+	pieces := splitComments(css)
+	var tokens []Token
+	for i, piece := range pieces {
+		if i%2 == 1 {
+			// A comment; represented by a Token without a parent.
+			tokens = append(tokens, Token{Type: WhitespaceToken, Value: piece})
+			continue
+		}
+		pieceTokens := NewTokenizer(piece).All()
+		last := pieceTokens[len(pieceTokens)-1]
+		if last.Type == ErrorToken {
+			return "", errors.New(last.Value)
+		}
+		tokens = append(tokens, pieceTokens[:len(pieceTokens)-1]...)
+	}
+	var sb strings.Builder
+	// The current declaration value, as written and as normalized. It is
+	// only known to be a value once it ends without a {} block, as in a
+	// nested style rule such as "&:hover #AABBCC {}".
+	var raw, normalized strings.Builder
+	endValue := func(keep *strings.Builder) {
+		sb.WriteString(keep.String())
+		raw.Reset()
+		normalized.Reset()
+	}
+	// Whether each enclosing {} block contains declarations.
+	var declBlocks []bool
+	// The first token of the current rule's prelude or declaration; nil if
+	// not yet seen.
+	var first *Token
+	// Whether within the value of a declaration, and whether that is of a
+	// custom property.
+	inValue, custom := false, false
+	for i := range tokens {
+		tok := &tokens[i]
+		text := tok.Value
+		if tok.parent != nil {
+			text = tok.String()
+		}
+		inDecls := len(declBlocks) > 0 && declBlocks[len(declBlocks)-1]
+		switch tok.Type {
+		case OpenCurlyToken:
+			endValue(&raw)
+			isDecls := true
+			if !inDecls && first != nil && first.Type == AtKeywordToken {
+				isDecls = !ruleListAtRules[atRuleName(first.Value)]
+			}
+			declBlocks = append(declBlocks, isDecls)
+			first, inValue, custom = nil, false, false
+		case CloseCurlyToken:
+			endValue(&normalized)
+			if len(declBlocks) > 0 {
+				declBlocks = declBlocks[:len(declBlocks)-1]
+			}
+			first, inValue, custom = nil, false, false
+		case SemicolonToken:
+			endValue(&normalized)
+			first, inValue, custom = nil, false, false
+		case ColonToken:
+			if inDecls && !inValue {
+				sb.WriteString(text)
+				inValue = true
+				continue
+			}
+		case WhitespaceToken, CDOToken, CDCToken:
+		default:
+			if first == nil {
+				first = tok
+				// The tokenizer predates custom properties, and so
+				// splits "--x" into "-" and "-x".
+				custom = tok.Type == IdentToken && strings.HasPrefix(tok.Value, "--") ||
+					tok.Type == DelimToken && tok.Value == "-" && i+1 < len(tokens) &&
+						tokens[i+1].Type == IdentToken && strings.HasPrefix(tokens[i+1].Value, "-")
+			}
+		}
+		if !inValue {
+			sb.WriteString(text)
+			continue
+		}
+		raw.WriteString(text)
+		if n, ok := normalizeValue(tok, text); ok && !custom {
+			normalized.WriteString(n)
+		} else {
+			normalized.WriteString(text)
+		}
+	}
+	endValue(&normalized)
+	return sb.String(), nil
+}
+
+// splitComments splits css into the text between comments (at even indices)
+// and the comments themselves (at odd indices).
+func splitComments(css string) []string {
+	var pieces []string
+	start := 0
+	for i := 0; i < len(css); {
+		switch c := css[i]; {
+		case c == '"' || c == '\'':
+			i = endOfString(css, i)
+		case c == '\\' && i+1 < len(css):
+			_, size := utf8.DecodeRuneInString(css[i+1:])
+			i += 1 + size
+		case c == '/' && strings.HasPrefix(css[i:], "/*"):
+			end := strings.Index(css[i+2:], "*/")
+			if end == -1 {
+				end = len(css)
+			} else {
+				end += i + 4
+			}
+			pieces = append(pieces, css[start:i], css[i:end])
+			start, i = end, end
+		default:
+			i++
+		}
+	}
+	return append(pieces, css[start:])
+}
+
+// atRuleName returns the lowercase name of the at-rule, without any vendor
+// prefix.
+func atRuleName(name string) string {
+	name = strings.ToLower(name)
+	if strings.HasPrefix(name, "-") {
+		if i := strings.Index(name[1:], "-"); i >= 0 {
+			return name[i+2:]
+		}
+	}
+	return name
+}
+
+// normalizeValue returns the shortest form of the color or numeric token,
+// whose text is raw, and whether it has one.
+func normalizeValue(tok *Token, raw string) (string, bool) {
+	switch tok.Type {
+	case HashToken:
+		return normalizeHexColor(raw)
+	case NumberToken:
+		return normalizeNumber(raw)
+	case PercentageToken:
+		if n, ok := normalizeNumber(strings.TrimSuffix(raw, "%")); ok {
+			return n + "%", true
+		}
+	case DimensionToken:
+		// The unit is all but the numeric prefix, whose length is that of
+		// the number's representation unless it was escaped.
+		if len(tok.Value) < len(raw) && raw[:len(tok.Value)] == tok.Value {
+			if n, ok := normalizeNumber(tok.Value); ok {
+				return n + raw[len(tok.Value):], true
+			}
+		}
+	}
+	return "", false
+}
+
+// normalizeHexColor lowercases the #RGB, #RGBA, #RRGGBB or #RRGGBBAA color,
+// shortening the latter two when each component repeats a digit.
+func normalizeHexColor(raw string) (string, bool) {
+	hex := strings.ToLower(strings.TrimPrefix(raw, "#"))
+	switch len(hex) {
+	case 3, 4, 6, 8:
+	default:
+		return "", false
+	}
+	for _, r := range hex {
+		if !('0' <= r && r <= '9' || 'a' <= r && r <= 'f') {
+			return "", false
+		}
+	}
+	if len(hex) == 6 || len(hex) == 8 {
+		short := make([]byte, 0, len(hex)/2)
+		for i := 0; i < len(hex); i += 2 {
+			if hex[i] != hex[i+1] {
+				short = nil
+				break
+			}
+			short = append(short, hex[i])
+		}
+		if short != nil {
+			hex = string(short)
+		}
+	}
+	return "#" + hex, true
+}
+
+// normalizeNumber removes the redundant leading zeros of the integer part,
+// and trailing zeros of the fractional part, of the decimal number. Numbers in
+// scientific notation are not normalized.
+func normalizeNumber(raw string) (string, bool) {
+	sign := ""
+	if strings.HasPrefix(raw, "+") || strings.HasPrefix(raw, "-") {
+		sign, raw = raw[:1], raw[1:]
+	}
+	if raw == "" || strings.ContainsAny(raw, "eE") {
+		return "", false
+	}
+	intPart, fracPart := raw, ""
+	if i := strings.IndexByte(raw, '.'); i >= 0 {
+		intPart, fracPart = raw[:i], raw[i+1:]
+	}
+	if strings.Trim(intPart+fracPart, "0123456789") != "" {
+		return "", false
+	}
+	intPart = strings.TrimLeft(intPart, "0")
+	fracPart = strings.TrimRight(fracPart, "0")
+	switch {
+	case fracPart != "":
+		return sign + intPart + "." + fracPart, true
+	case intPart != "":
+		return sign + intPart, true
+	default:
+		return sign + "0", true
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package css
+
+import "testing"
+
+func TestNormalizeValues(t *testing.T) {
+	tcs := []struct {
+		desc, input, expected string
+	}{
+		{
+			desc:     "shortens and lowercases hex colors",
+			input:    "a { color: #AABBCC; background: #FFEEDD80; border-color: #ABCDEF #Fa0 }",
+			expected: "a { color: #abc; background: #ffeedd80; border-color: #abcdef #fa0 }",
+		},
+		{
+			desc:     "shortens colors with alpha",
+			input:    "a{color:#11223344}",
+			expected: "a{color:#1234}",
+		},
+		{
+			desc:     "trims zeros from numbers",
+			input:    "a { opacity: 0.50; margin: 1.0px -0.5em 010% 0.0; line-height: 1.25 }",
+			expected: "a { opacity: .5; margin: 1px -.5em 10% 0; line-height: 1.25 }",
+		},
+		{
+			desc:     "leaves selectors alone",
+			input:    "#AABBCC:hover, li:nth-child(02) { color: #FFFFFF }",
+			expected: "#AABBCC:hover, li:nth-child(02) { color: #fff }",
+		},
+		{
+			desc:     "recurses into media, supports, and keyframes",
+			input:    "@media (min-width: 10.0px) { a { width: 10.0px } } @keyframes k { 50.0% { opacity: 0.5 } }",
+			expected: "@media (min-width: 10.0px) { a { width: 10px } } @keyframes k { 50.0% { opacity: .5 } }",
+		},
+		{
+			desc:     "normalizes other at-rule declarations",
+			input:    "@font-face { font-weight: 400.0 } @page { margin: 1.50in }",
+			expected: "@font-face { font-weight: 400 } @page { margin: 1.5in }",
+		},
+		{
+			desc:     "leaves non-colors, scientific notation, and custom properties alone",
+			input:    "a { color: #GGG; width: 1.0e3px; --x: #AABBCC 0.50; content: \"#FFFFFF 0.5\"; background: url(#AABBCC) }",
+			expected: "a { color: #GGG; width: 1.0e3px; --x: #AABBCC 0.50; content: \"#FFFFFF 0.5\"; background: url(#AABBCC) }",
+		},
+		{
+			desc:     "preserves comments",
+			input:    "a { color: /* #FFFFFF; */ #FFFFFF; width: 0.5px/**/ }",
+			expected: "a { color: /* #FFFFFF; */ #fff; width: .5px/**/ }",
+		},
+		{
+			desc:     "leaves nested style rules alone",
+			input:    "a { &:hover #AABBCC { color: #AABBCC } }",
+			expected: "a { &:hover #AABBCC { color: #abc } }",
+		},
+	}
+	for _, tc := range tcs {
+		output, err := NormalizeValues(tc.input)
+		if err != nil {
+			t.Errorf("%s: NormalizeValues(%q) unexpectedly failed %q", tc.desc, tc.input, err)
+			continue
+		}
+		if output != tc.expected {
+			t.Errorf("%s: NormalizeValues(%q)=%q, want=%q", tc.desc, tc.input, output, tc.expected)
+		}
+	}
+}
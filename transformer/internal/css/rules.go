@@ -0,0 +1,283 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package css
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// conditionalGroupRules are the at-rules whose blocks contain style rules, and
+// are filtered recursively by FilterRules.
+var conditionalGroupRules = map[string]bool{
+	"media":    true,
+	"supports": true,
+}
+
+// FilterRules returns the stylesheet without the style rules for which keep
+// returns false. keep is passed the tokens of the rule's prelude (i.e. its
+// selector list), including any surrounding whitespace. Style rules nested
+// within @media and @supports are filtered too; other at-rules (e.g.
+// @font-face, @keyframes) are kept unmodified.
+func FilterRules(css string, keep func(prelude []Token) bool) (string, error) {
+	tokens := NewTokenizer(css).All()
+	if last := tokens[len(tokens)-1]; last.Type == ErrorToken {
+		return "", errors.New(last.Value)
+	}
+	var sb strings.Builder
+	ruleFilter{keepStyleRule: keep}.filterRules(tokens, "", &sb)
+	return sb.String(), nil
+}
+
+// DedupeFontFaces returns the stylesheet without the @font-face rules that are
+// identical to an earlier one, ignoring comments and differences in
+// whitespace. Rules within @media or @supports are only compared with those
+// within identical conditions.
+func DedupeFontFaces(css string) (string, error) {
+	tokens := NewTokenizer(css).All()
+	if last := tokens[len(tokens)-1]; last.Type == ErrorToken {
+		return "", errors.New(last.Value)
+	}
+	seen := map[string]bool{}
+	var sb strings.Builder
+	ruleFilter{keepAtRule: func(scope string, rule []Token) bool {
+		if !strings.EqualFold(rule[0].Value, "font-face") {
+			return true
+		}
+		key := scope + ruleKey(rule)
+		if seen[key] {
+			return false
+		}
+		seen[key] = true
+		return true
+	}}.filterRules(tokens, "", &sb)
+	return sb.String(), nil
+}
+
+// ExtractKeyframes returns the stylesheet without the top-level @keyframes
+// rules (including vendor-prefixed ones, e.g. @-webkit-keyframes) for which
+// extract returns true, and, separately, those rules, concatenated in order.
+// extract is passed the text of the rule, and the properties declared by its
+// keyframes, lowercase and without any vendor prefix. Rules that contain
+// anything other than keyframes, or are malformed, are kept, as are those
+// nested within @media or @supports.
+func ExtractKeyframes(css string, extract func(rule string, properties []string) bool) (string, string, error) {
+	tokens := NewTokenizer(css).All()
+	if last := tokens[len(tokens)-1]; last.Type == ErrorToken {
+		return "", "", errors.New(last.Value)
+	}
+	var kept, extracted strings.Builder
+	ruleFilter{keepAtRule: func(scope string, rule []Token) bool {
+		if scope != "" || atRuleName(rule[0].Value) != "keyframes" {
+			return true
+		}
+		properties, ok := keyframesProperties(rule)
+		if !ok {
+			return true
+		}
+		var text strings.Builder
+		writeTokens(rule, &text)
+		if !extract(text.String(), properties) {
+			return true
+		}
+		extracted.WriteString(text.String())
+		return false
+	}}.filterRules(tokens, "", &kept)
+	return kept.String(), extracted.String(), nil
+}
+
+// keyframesProperties returns the properties declared by the keyframes of the
+// @keyframes rule, lowercase and without any vendor prefix, or false if the
+// rule is unterminated, or its block holds anything but keyframes with
+// well-formed declarations.
+func keyframesProperties(rule []Token) ([]string, bool) {
+	open := 0
+	for ; open < len(rule) && rule[open].Type != OpenCurlyToken; open++ {
+	}
+	end := len(rule) - 1
+	if open >= end || rule[end].Type != CloseCurlyToken {
+		return nil, false
+	}
+	var properties []string
+	block := rule[open+1 : end]
+	for i := 0; i < len(block); i++ {
+		if block[i].Type == WhitespaceToken {
+			continue
+		}
+		if block[i].Type == AtKeywordToken {
+			return nil, false
+		}
+		// A keyframe: a selector (e.g. "from" or "50%"), followed by a {}
+		// block of declarations.
+		blockOpen := i
+		for ; blockOpen < len(block) && block[blockOpen].Type != OpenCurlyToken; blockOpen++ {
+			blockOpen += consumeAComponentValue(block[blockOpen:])
+		}
+		if blockOpen >= len(block) {
+			return nil, false
+		}
+		blockEnd := blockOpen + consumeASimpleBlock(block[blockOpen:])
+		if blockEnd >= len(block) || block[blockEnd].Type != CloseCurlyToken {
+			return nil, false
+		}
+		for _, declTokens := range splitDeclarations(block[blockOpen+1 : blockEnd]) {
+			decl := parseDeclaration(declTokens)
+			if decl.Property == "" {
+				if len(trimWhitespaceTokens(declTokens)) > 0 {
+					return nil, false
+				}
+				continue
+			}
+			properties = append(properties, atRuleName(decl.Property))
+		}
+		i = blockEnd
+	}
+	return properties, true
+}
+
+// ruleKey returns a canonical form of the tokens, ignoring comments,
+// the case of at-keywords, and insignificant whitespace.
+func ruleKey(tokens []Token) string {
+	var sb strings.Builder
+	// Whether whitespace separates the token from the previous significant
+	// one, and whether that one was punctuation (or a function).
+	space, afterPunctuation := false, true
+	for i := range tokens {
+		tok := tokens[i]
+		switch tok.Type {
+		case WhitespaceToken, EOFToken:
+			space = true
+			continue
+		case AtKeywordToken:
+			tok.Value = strings.ToLower(tok.Value)
+		}
+		if space && !afterPunctuation && !punctuation[tok.Type] {
+			sb.WriteByte(' ')
+		}
+		fmt.Fprintf(&sb, "%d:%q:%q", tok.Type, tok.Value, tok.Extra)
+		space, afterPunctuation = false, punctuation[tok.Type] || tok.Type == FunctionToken
+	}
+	return sb.String()
+}
+
+// punctuation are the token types around which whitespace is insignificant.
+var punctuation = map[TokenType]bool{
+	ColonToken:       true,
+	SemicolonToken:   true,
+	CommaToken:       true,
+	OpenSquareToken:  true,
+	CloseSquareToken: true,
+	OpenParenToken:   true,
+	CloseParenToken:  true,
+	OpenCurlyToken:   true,
+	CloseCurlyToken:  true,
+}
+
+// ruleFilter decides which rules filterRules keeps.
+type ruleFilter struct {
+	// Returns false for the style rules to omit, given their prelude. If
+	// nil, all are kept.
+	keepStyleRule func(prelude []Token) bool
+	// Returns false for the at-rules (other than conditional group rules)
+	// to omit, given their tokens and the canonical form of the preludes of
+	// the rules enclosing them. If nil, all are kept.
+	keepAtRule func(scope string, rule []Token) bool
+	// Returns false for the declarations of style rules to omit, given the
+	// declaration and its tokens. If nil, all are kept.
+	keepDeclaration func(decl Declaration, tokens []Token) bool
+}
+
+// filterRules writes the given list of rules, enclosed by the rules
+// identified by scope, to sb, omitting those for which the ruleFilter returns
+// false.
+func (this ruleFilter) filterRules(tokens []Token, scope string, sb *strings.Builder) {
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i].Type {
+		case EOFToken:
+			return
+		case WhitespaceToken, CDOToken, CDCToken:
+			sb.WriteString(tokens[i].String())
+		case AtKeywordToken:
+			end := i + consumeAnAtRule(tokens[i:])
+			if end >= len(tokens) {
+				end = len(tokens) - 1
+			}
+			open := i
+			for ; open < end && tokens[open].Type != OpenCurlyToken; open++ {
+			}
+			if this.keepAtRule != nil && !this.keepAtRule(scope, tokens[i:end+1]) {
+				// Omitted.
+			} else if conditionalGroupRules[strings.ToLower(tokens[i].Value)] && tokens[open].Type == OpenCurlyToken {
+				writeTokens(tokens[i:open+1], sb)
+				this.filterRules(tokens[open+1:end], scope+ruleKey(tokens[i:open])+"{", sb)
+				if tokens[end].Type == CloseCurlyToken {
+					sb.WriteString(tokens[end].String())
+				}
+			} else {
+				writeTokens(tokens[i:end+1], sb)
+			}
+			i = end
+		default:
+			// A qualified rule: a prelude, followed by a {} block.
+			open := i
+			for ; open < len(tokens) && tokens[open].Type != OpenCurlyToken && tokens[open].Type != EOFToken; open++ {
+				open += consumeAComponentValue(tokens[open:])
+			}
+			if open >= len(tokens) || tokens[open].Type != OpenCurlyToken {
+				// A parse error; keep the remainder verbatim.
+				writeTokens(tokens[i:], sb)
+				return
+			}
+			end := open + consumeASimpleBlock(tokens[open:])
+			if end >= len(tokens) {
+				end = len(tokens) - 1
+			}
+			if this.keepStyleRule != nil && !this.keepStyleRule(tokens[i:open]) {
+				// Omitted.
+			} else if this.keepDeclaration != nil {
+				writeTokens(tokens[i:open+1], sb)
+				this.filterDeclarations(tokens[open+1:end], sb)
+				writeTokens(tokens[end:end+1], sb)
+			} else {
+				writeTokens(tokens[i:end+1], sb)
+			}
+			i = end
+		}
+	}
+}
+
+// filterDeclarations writes the declaration list to sb, omitting the
+// declarations for which keepDeclaration returns false. Malformed declarations
+// are kept.
+func (this ruleFilter) filterDeclarations(tokens []Token, sb *strings.Builder) {
+	var kept []string
+	for _, declTokens := range splitDeclarations(tokens) {
+		decl := parseDeclaration(declTokens)
+		if decl.Property == "" || this.keepDeclaration(decl, declTokens) {
+			kept = append(kept, decl.Raw)
+		}
+	}
+	sb.WriteString(strings.Join(kept, ";"))
+}
+
+// writeTokens writes the (preprocessed) text of tokens to sb.
+func writeTokens(tokens []Token, sb *strings.Builder) {
+	for i := range tokens {
+		if tokens[i].Type != EOFToken {
+			sb.WriteString(tokens[i].String())
+		}
+	}
+}
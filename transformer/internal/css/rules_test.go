@@ -0,0 +1,195 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package css
+
+import (
+	"strings"
+	"testing"
+)
+
+// dropSelector returns a keep func that drops the rules whose prelude
+// contains selector.
+func dropSelector(selector string) func([]Token) bool {
+	return func(prelude []Token) bool {
+		var sb strings.Builder
+		writeTokens(prelude, &sb)
+		return !strings.Contains(sb.String(), selector)
+	}
+}
+
+func TestFilterRules(t *testing.T) {
+	tcs := []struct {
+		desc, input, expected string
+	}{
+		{
+			desc:     "keeps all",
+			input:    "a { color: red } b{}",
+			expected: "a { color: red } b{}",
+		},
+		{
+			desc:     "drops rule",
+			input:    ".gone { color: red } .kept { color: blue }",
+			expected: " .kept { color: blue }",
+		},
+		{
+			desc:     "nested blocks",
+			input:    ".gone { background: url(a{b}.png) } .kept:not(.x) {}",
+			expected: " .kept:not(.x) {}",
+		},
+		{
+			desc:     "recurses into media and supports",
+			input:    "@media (min-width: 1px) { .gone {} .kept {} } @supports (display: grid) { .gone {} }",
+			expected: "@media (min-width: 1px) {  .kept {} } @supports (display: grid) {  }",
+		},
+		{
+			desc:     "keeps other at-rules",
+			input:    "@font-face { font-family: gone } @keyframes gone { from {} } @charset \"utf-8\";",
+			expected: "@font-face { font-family: gone } @keyframes gone { from {} } @charset \"utf-8\";",
+		},
+		{
+			desc:     "unterminated",
+			input:    ".kept { color: red",
+			expected: ".kept { color: red",
+		},
+	}
+	for _, tc := range tcs {
+		output, err := FilterRules(tc.input, dropSelector("gone"))
+		if err != nil {
+			t.Errorf("%s: FilterRules(%q) unexpectedly failed %q", tc.desc, tc.input, err)
+			continue
+		}
+		if output != tc.expected {
+			t.Errorf("%s: FilterRules(%q)=%q, want=%q", tc.desc, tc.input, output, tc.expected)
+		}
+	}
+}
+
+func TestDedupeFontFaces(t *testing.T) {
+	tcs := []struct {
+		desc, input, expected string
+	}{
+		{
+			desc:     "identical",
+			input:    "@font-face { font-family: a; src: url(a.woff) } @font-face {font-family:a;/* again */src:url(a.woff)}",
+			expected: "@font-face { font-family: a; src: url(a.woff) } ",
+		},
+		{
+			desc:     "distinct",
+			input:    "@font-face { font-family: a; src: url(a.woff) } @font-face { font-family: a; src: url(a.woff2) }",
+			expected: "@font-face { font-family: a; src: url(a.woff) } @font-face { font-family: a; src: url(a.woff2) }",
+		},
+		{
+			desc:     "case-insensitive at-keyword",
+			input:    "@font-face { font-family: a } a {} @FONT-FACE { font-family: a }",
+			expected: "@font-face { font-family: a } a {} ",
+		},
+		{
+			desc:     "scoped by conditional group rules",
+			input:    "@font-face { font-family: a } @media print { @font-face { font-family: a } @font-face { font-family: a } } @media print{@font-face{font-family:a}}",
+			expected: "@font-face { font-family: a } @media print { @font-face { font-family: a }  } @media print{}",
+		},
+		{
+			desc:     "other at-rules",
+			input:    "@keyframes k { from {} } @keyframes k { from {} }",
+			expected: "@keyframes k { from {} } @keyframes k { from {} }",
+		},
+	}
+	for _, tc := range tcs {
+		output, err := DedupeFontFaces(tc.input)
+		if err != nil {
+			t.Errorf("%s: DedupeFontFaces(%q) unexpectedly failed %q", tc.desc, tc.input, err)
+			continue
+		}
+		if output != tc.expected {
+			t.Errorf("%s: DedupeFontFaces(%q)=%q, want=%q", tc.desc, tc.input, output, tc.expected)
+		}
+	}
+}
+
+func TestExtractKeyframes(t *testing.T) {
+	// Extracts the rules named "move" that don't animate color.
+	extract := func(rule string, properties []string) bool {
+		if !strings.Contains(rule, "move") {
+			return false
+		}
+		for _, property := range properties {
+			if property == "color" {
+				return false
+			}
+		}
+		return true
+	}
+	tcs := []struct {
+		desc, input, expectedKept, expectedExtracted string
+		expectedProperties                           []string
+	}{
+		{
+			desc:               "extracts",
+			input:              "a {} @keyframes move { from { opacity: 0 } to { opacity: 1; transform: none } } b {}",
+			expectedKept:       "a {}  b {}",
+			expectedExtracted:  "@keyframes move { from { opacity: 0 } to { opacity: 1; transform: none } }",
+			expectedProperties: []string{"opacity", "opacity", "transform"},
+		},
+		{
+			desc:               "vendor prefixes",
+			input:              "@-webkit-keyframes move { 50% { -webkit-transform: none; } }",
+			expectedKept:       "",
+			expectedExtracted:  "@-webkit-keyframes move { 50% { -webkit-transform: none; } }",
+			expectedProperties: []string{"transform"},
+		},
+		{
+			desc:               "keeps those extract rejects",
+			input:              "@keyframes stay { from { opacity: 0 } } @keyframes move { to { color: red } }",
+			expectedKept:       "@keyframes stay { from { opacity: 0 } } @keyframes move { to { color: red } }",
+			expectedExtracted:  "",
+			expectedProperties: []string{"opacity", "color"},
+		},
+		{
+			desc:              "keeps nested",
+			input:             "@media print { @keyframes move { from { opacity: 0 } } }",
+			expectedKept:      "@media print { @keyframes move { from { opacity: 0 } } }",
+			expectedExtracted: "",
+		},
+		{
+			desc:              "keeps non-keyframes",
+			input:             "@keyframes move { @media print {} } @keyframes move { from { opacity } } @font-face { move: 1 }",
+			expectedKept:      "@keyframes move { @media print {} } @keyframes move { from { opacity } } @font-face { move: 1 }",
+			expectedExtracted: "",
+		},
+		{
+			desc:              "keeps unterminated",
+			input:             "@keyframes move { from { opacity: 0 }",
+			expectedKept:      "@keyframes move { from { opacity: 0 }",
+			expectedExtracted: "",
+		},
+	}
+	for _, tc := range tcs {
+		var properties []string
+		kept, extracted, err := ExtractKeyframes(tc.input, func(rule string, p []string) bool {
+			properties = append(properties, p...)
+			return extract(rule, p)
+		})
+		if err != nil {
+			t.Errorf("%s: ExtractKeyframes(%q) unexpectedly failed %q", tc.desc, tc.input, err)
+			continue
+		}
+		if kept != tc.expectedKept || extracted != tc.expectedExtracted {
+			t.Errorf("%s: ExtractKeyframes(%q)=%q, %q, want=%q, %q", tc.desc, tc.input, kept, extracted, tc.expectedKept, tc.expectedExtracted)
+		}
+		if strings.Join(properties, ",") != strings.Join(tc.expectedProperties, ",") {
+			t.Errorf("%s: ExtractKeyframes(%q) passed properties %q, want=%q", tc.desc, tc.input, properties, tc.expectedProperties)
+		}
+	}
+}
@@ -71,6 +71,29 @@ func NextSkippingChildren(n *html.Node) *html.Node {
 	return c
 }
 
+// VisitElements calls visit with n, if it is an element, and each of its
+// element descendants, in depth first order. It stops early, returning false,
+// if visit returns false. visit must not remove the nodes it is passed.
+func VisitElements(n *html.Node, visit func(*html.Node) bool) bool {
+	for c := n; c != nil; {
+		if c.Type == html.ElementNode && !visit(c) {
+			return false
+		}
+		if c.FirstChild != nil {
+			c = c.FirstChild
+			continue
+		}
+		for c != n && c.NextSibling == nil {
+			c = c.Parent
+		}
+		if c == n {
+			break
+		}
+		c = c.NextSibling
+	}
+	return true
+}
+
 // FindNode returns the (first) specified child node of the given atom
 // type or ok=false if there are none.
 func FindNode(n *html.Node, atom atom.Atom) (*html.Node, bool) {
@@ -106,6 +129,11 @@ func IsChildOf(n *html.Node, atom atom.Atom) bool {
 
 // FindAttribute returns a pointer to the attribute of node n with the
 // given namespace and key or ok=false if there is none.
+//
+// Within <svg> and <math>, the parser splits namespaced attributes, e.g.
+// xlink:href has namespace "xlink" and key "href", so they must be looked up
+// (and set, by SetAttribute) by namespace. Elsewhere, they are not split, so
+// e.g. <a xlink:href> has no namespace, and key "xlink:href".
 func FindAttribute(n *html.Node, namespace, key string) (*html.Attribute, bool) {
 	for i := range n.Attr {
 		if n.Attr[i].Namespace == namespace && n.Attr[i].Key == key {
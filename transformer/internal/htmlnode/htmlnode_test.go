@@ -247,3 +247,102 @@ func TestNextSkippingChildren(t *testing.T) {
 		t.Errorf("NextSkippingChildren(span) = %v, want nil", result)
 	}
 }
+
+func TestVisitElements(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<html><head></head><body><div><span>a</span><!-- b --><i></i></div><p></p></body></html>`))
+	if err != nil {
+		t.Fatalf("html.Parse failed %q", err)
+	}
+	body, ok := FindNode(doc, atom.Body)
+	if !ok {
+		t.Fatal("missing <body>")
+	}
+
+	var visited []string
+	if !VisitElements(body, func(n *html.Node) bool {
+		visited = append(visited, n.Data)
+		return true
+	}) {
+		t.Error("VisitElements() = false, want true")
+	}
+	if got, want := strings.Join(visited, " "), "body div span i p"; got != want {
+		t.Errorf("VisitElements() visited %q, want %q", got, want)
+	}
+
+	// Only the subtree is visited.
+	div, _ := FindNode(body, atom.Div)
+	visited = nil
+	VisitElements(div, func(n *html.Node) bool {
+		visited = append(visited, n.Data)
+		return true
+	})
+	if got, want := strings.Join(visited, " "), "div span i"; got != want {
+		t.Errorf("VisitElements(div) visited %q, want %q", got, want)
+	}
+
+	// Visiting stops once visit returns false.
+	visited = nil
+	if VisitElements(doc, func(n *html.Node) bool {
+		visited = append(visited, n.Data)
+		return n.DataAtom != atom.Span
+	}) {
+		t.Error("VisitElements() = true, want false")
+	}
+	if got, want := strings.Join(visited, " "), "html head body div span"; got != want {
+		t.Errorf("VisitElements() visited %q, want %q", got, want)
+	}
+}
+
+func TestNamespacedAttributes(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<svg><use xlink:href="#a" href="#b"></use></svg><a xlink:href="#c"></a>`))
+	if err != nil {
+		t.Fatalf("html.Parse failed %q", err)
+	}
+	var use, a *html.Node
+	for n := doc; n != nil; n = Next(n) {
+		switch n.Data {
+		case "use":
+			use = n
+		case "a":
+			a = n
+		}
+	}
+	if use == nil || a == nil {
+		t.Fatal("missing <use> or <a>")
+	}
+
+	if v, ok := GetAttributeVal(use, "xlink", "href"); !ok || v != "#a" {
+		t.Errorf("GetAttributeVal(use, xlink, href)=%q, %t want=%q, true", v, ok, "#a")
+	}
+	if v, ok := GetAttributeVal(use, "", "href"); !ok || v != "#b" {
+		t.Errorf("GetAttributeVal(use, \"\", href)=%q, %t want=%q, true", v, ok, "#b")
+	}
+	if HasAttribute(use, "", "xlink:href") {
+		t.Error("HasAttribute(use, \"\", xlink:href)=true want=false")
+	}
+	// Outside of foreign content, the attribute isn't split.
+	if HasAttribute(a, "xlink", "href") {
+		t.Error("HasAttribute(a, xlink, href)=true want=false")
+	}
+	if v, ok := GetAttributeVal(a, "", "xlink:href"); !ok || v != "#c" {
+		t.Errorf("GetAttributeVal(a, \"\", xlink:href)=%q, %t want=%q, true", v, ok, "#c")
+	}
+
+	SetAttribute(use, "xlink", "href", "#d")
+	if v, _ := GetAttributeVal(use, "xlink", "href"); v != "#d" {
+		t.Errorf("after SetAttribute, GetAttributeVal(use, xlink, href)=%q want=%q", v, "#d")
+	}
+	if v, _ := GetAttributeVal(use, "", "href"); v != "#b" {
+		t.Errorf("after SetAttribute, GetAttributeVal(use, \"\", href)=%q want=%q", v, "#b")
+	}
+	if len(use.Attr) != 2 {
+		t.Errorf("after SetAttribute, use.Attr=%v want 2 attributes", use.Attr)
+	}
+	var rendered strings.Builder
+	if err := html.Render(&rendered, use); err != nil {
+		t.Fatalf("html.Render failed %q", err)
+	}
+	if got, want := rendered.String(), `<use xlink:href="#d" href="#b"></use>`; got != want {
+		t.Errorf("html.Render(use)=%q want=%q", got, want)
+	}
+}
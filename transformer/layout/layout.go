@@ -82,20 +82,42 @@ func ApplyLayout(n *html.Node) error {
 		return nil
 	}
 
+	actualLayout, dimensions, err := getEffectiveLayout(n)
+	if err != nil {
+		return err
+	}
+	apply(n, actualLayout, dimensions)
+	return nil
+}
+
+// GetEffectiveLayout returns the layout that the AMP runtime would apply to
+// the given custom element: that named by its layout attribute, or if absent,
+// the default implied by its width, height, sizes, and heights attributes.
+// Returns an error if the layout isn't supported.
+func GetEffectiveLayout(n *html.Node) (amppb.AmpLayout_Layout, error) {
+	layout, _, err := getEffectiveLayout(n)
+	return layout, err
+}
+
+// GetLayoutName returns the value of the layout attribute that specifies the
+// given layout, e.g. "fixed-height".
+func GetLayoutName(layout amppb.AmpLayout_Layout) string {
+	return getLayoutName(layout)
+}
+
+// getEffectiveLayout is like GetEffectiveLayout, but also returns the
+// element's normalized dimensions.
+func getEffectiveLayout(n *html.Node) (amppb.AmpLayout_Layout, cssDimensions, error) {
 	inputLayout := ParseAMPLayout(n)
 	dimensions, err := getNormalizedDimensions(n, inputLayout)
 	if err != nil {
-		return err
+		return amppb.AmpLayout_UNKNOWN, dimensions, err
 	}
 	actualLayout, err := getNormalizedLayout(
 		inputLayout, dimensions,
 		htmlnode.HasAttributeAndIsNotEmpty(n, "", "sizes"),
 		htmlnode.HasAttributeAndIsNotEmpty(n, "", "heights"))
-	if err != nil {
-		return err
-	}
-	apply(n, actualLayout, dimensions)
-	return nil
+	return actualLayout, dimensions, err
 }
 
 // Parses the layout attribute value of the given node and returns the
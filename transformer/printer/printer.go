@@ -38,7 +38,7 @@ type writer interface {
 }
 
 // Print emits the given Node to the given Writer.
-// - Comments are skipped and not emitted.
+// - Comments are skipped and not emitted (see PrintPreservingComments).
 // - Unnecessary quotes are dropped for attribute values.
 func Print(w io.Writer, n *html.Node) error {
 	if x, ok := w.(writer); ok {
@@ -51,11 +51,34 @@ func Print(w io.Writer, n *html.Node) error {
 	return buf.Flush()
 }
 
+// PrintPreservingComments is like Print, but emits the comments for which
+// preserve returns true.
+func PrintPreservingComments(w io.Writer, n *html.Node, preserve func(*html.Node) bool) error {
+	buf := bufio.NewWriter(w)
+	if err := render(&commentPreservingWriter{buf, preserve}, n); err != nil {
+		return err
+	}
+	return buf.Flush()
+}
+
+// commentPreservingWriter is a writer that carries the option set by
+// PrintPreservingComments through render.
+type commentPreservingWriter struct {
+	*bufio.Writer
+	preserve func(*html.Node) bool
+}
+
+// isRendered returns true if the comment node n is emitted to w.
+func isRendered(w writer, n *html.Node) bool {
+	cw, ok := w.(*commentPreservingWriter)
+	return ok && cw.preserve(n)
+}
+
 // isFirstNode returns true if n is the first of its siblings that is rendered.
-func isFirstNode(n *html.Node) bool {
+func isFirstNode(w writer, n *html.Node) bool {
 	for n = n.PrevSibling; n != nil; n = n.PrevSibling {
-		// Comments are not rendered.
-		if n.Type != html.CommentNode {
+		// Comments are not rendered, unless preserved.
+		if n.Type != html.CommentNode || isRendered(w, n) {
 			return false
 		}
 	}
@@ -71,7 +94,7 @@ func render(w writer, n *html.Node) error {
 		if n.Data == "" {
 			return nil
 		}
-		if (n.Parent.DataAtom == atom.Pre || n.Parent.DataAtom == atom.Textarea) && isFirstNode(n) && (n.Data[0] == '\r' || n.Data[0] == '\n') {
+		if (n.Parent.DataAtom == atom.Pre || n.Parent.DataAtom == atom.Textarea) && isFirstNode(w, n) && (n.Data[0] == '\r' || n.Data[0] == '\n') {
 			// Emit a line feed that will be summarily dropped
 			// if re-parsed again. This is needed for idempotency,
 			// when there are multiple newlines at the start of a
@@ -97,8 +120,18 @@ func render(w writer, n *html.Node) error {
 	case html.ElementNode:
 		return renderElementNode(w, n)
 	case html.CommentNode:
-		// Comments are skipped.
-		return nil
+		// Comments are skipped, unless preserved.
+		if !isRendered(w, n) {
+			return nil
+		}
+		if _, err := w.WriteString("<!--"); err != nil {
+			return err
+		}
+		if _, err := w.WriteString(n.Data); err != nil {
+			return err
+		}
+		_, err := w.WriteString("-->")
+		return err
 	case html.DoctypeNode:
 		if _, err := w.WriteString("<!doctype "); err != nil {
 			return err
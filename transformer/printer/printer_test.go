@@ -164,6 +164,29 @@ func TestStripComments(t *testing.T) {
 	runAllTestCases(t, testCases)
 }
 
+func TestPrintPreservingComments(t *testing.T) {
+	input := tt.Concat(
+		"<!doctype html><html ⚡><head><!--[if IE]><p>x</p><![endif]--></head>",
+		"<body><!-- dropped --><pre><!--keep-->\n\na</pre></body></html>")
+	expected := tt.Concat(
+		"<!doctype html><html ⚡><head><!--[if IE]><p>x</p><![endif]--></head>",
+		"<body><pre><!--keep-->\n\na</pre></body></html>")
+	doc, err := html.Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("html.Parse failed %q", err)
+	}
+	preserve := func(n *html.Node) bool {
+		return strings.HasPrefix(n.Data, "[if") || n.Data == "keep"
+	}
+	var output strings.Builder
+	if err := printer.PrintPreservingComments(&output, doc, preserve); err != nil {
+		t.Fatalf("printer.PrintPreservingComments failed %q", err)
+	}
+	if output.String() != expected {
+		t.Errorf("PrintPreservingComments=\n%q\nwant=\n%q", &output, expected)
+	}
+}
+
 func TestClosesTags(t *testing.T) {
 	testCases := []tt.TestCase{
 		{
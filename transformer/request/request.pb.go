@@ -134,10 +134,12 @@ type Request struct {
 	Transformers []string `protobuf:"bytes,3,rep,name=transformers,proto3" json:"transformers,omitempty"`
 	// The version of the transforms to perform (optional). If specified, it must
 	// be a supported version.
-	Version              int64    `protobuf:"varint,8,opt,name=version,proto3" json:"version,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	Version int64 `protobuf:"varint,8,opt,name=version,proto3" json:"version,omitempty"`
+	// Options for the transformers (optional).
+	Options              *Request_Options `protobuf:"bytes,9,opt,name=options,proto3" json:"options,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}         `json:"-"`
+	XXX_unrecognized     []byte           `json:"-"`
+	XXX_sizecache        int32            `json:"-"`
 }
 
 func (m *Request) Reset()         { *m = Request{} }
@@ -221,6 +223,430 @@ func (m *Request) GetVersion() int64 {
 	return 0
 }
 
+func (m *Request) GetOptions() *Request_Options {
+	if m != nil {
+		return m.Options
+	}
+	return nil
+}
+
+// Options for the transformers. Those that enable a transformer (e.g.
+// strip_css_comments) are needed for it to have any effect, whether it is
+// run by the DEFAULT config or named in transformers. Options that take Go
+// values (e.g. an SVG resolver) are only available via
+// transformers.Context.
+type Request_Options struct {
+	// If true, StripCSSComments removes comments from <style amp-custom>.
+	StripCssComments bool `protobuf:"varint,1,opt,name=strip_css_comments,json=stripCssComments,proto3" json:"strip_css_comments,omitempty"`
+	// An RE2 regexp matching the comments which StripCSSComments should
+	// preserve. If empty, license comments are preserved.
+	CssCommentKeepPattern string `protobuf:"bytes,2,opt,name=css_comment_keep_pattern,json=cssCommentKeepPattern,proto3" json:"css_comment_keep_pattern,omitempty"`
+	// If true, DedupeFontFaces removes duplicate @font-face rules from
+	// <style amp-custom>.
+	DedupeFontFaces bool `protobuf:"varint,3,opt,name=dedupe_font_faces,json=dedupeFontFaces,proto3" json:"dedupe_font_faces,omitempty"`
+	// If true, AMPKeyframes moves the large @keyframes rules of
+	// <style amp-custom> into <style amp-keyframes> at the end of <body>.
+	MoveAmpKeyframes bool `protobuf:"varint,4,opt,name=move_amp_keyframes,json=moveAmpKeyframes,proto3" json:"move_amp_keyframes,omitempty"`
+	// The size, in bytes, of the smallest @keyframes rule AMPKeyframes moves.
+	// If zero, it is 1024.
+	AmpKeyframesThreshold int32 `protobuf:"varint,5,opt,name=amp_keyframes_threshold,json=ampKeyframesThreshold,proto3" json:"amp_keyframes_threshold,omitempty"`
+	// If true, UnusedExtensions removes the script tags of all unused
+	// extensions, not just those exempted by the AMP validator from its
+	// requirement that they be used.
+	PruneUnusedExtensions bool `protobuf:"varint,6,opt,name=prune_unused_extensions,json=pruneUnusedExtensions,proto3" json:"prune_unused_extensions,omitempty"`
+	// If true, RelativeURL rewrites the absolute href and src attributes with
+	// the origin of the base URL as path-absolute URLs.
+	RelativeSameOriginUrls bool `protobuf:"varint,7,opt,name=relative_same_origin_urls,json=relativeSameOriginUrls,proto3" json:"relative_same_origin_urls,omitempty"`
+	// If true, StripDisallowedCSS removes the at-rules and properties AMP
+	// disallows (e.g. @import and behavior) from <style amp-custom>.
+	StripDisallowedCss bool `protobuf:"varint,8,opt,name=strip_disallowed_css,json=stripDisallowedCss,proto3" json:"strip_disallowed_css,omitempty"`
+	// If true, StripDisallowedCSS fails listing them instead.
+	ErrorOnDisallowedCss bool `protobuf:"varint,9,opt,name=error_on_disallowed_css,json=errorOnDisallowedCss,proto3" json:"error_on_disallowed_css,omitempty"`
+	// If true, NormalizeCSS shortens the colors and numbers in
+	// <style amp-custom>.
+	NormalizeCss bool `protobuf:"varint,10,opt,name=normalize_css,json=normalizeCss,proto3" json:"normalize_css,omitempty"`
+	// The AMP formats, most preferred first, by which AMPFormat resolves
+	// conflicting format attributes on <html>. If empty, AMPFormat is disabled.
+	AmpFormatPrecedence []Request_HtmlFormat `protobuf:"varint,11,rep,packed,name=amp_format_precedence,json=ampFormatPrecedence,proto3,enum=amp.transform.Request_HtmlFormat" json:"amp_format_precedence,omitempty"`
+	// If true, AMPImgLayout sets the default layout of <amp-img> elements
+	// explicitly.
+	ExplicitAmpImgLayout bool `protobuf:"varint,12,opt,name=explicit_amp_img_layout,json=explicitAmpImgLayout,proto3" json:"explicit_amp_img_layout,omitempty"`
+	// Prefixes of comments which NodeCleanup should preserve, e.g. "[if" for IE
+	// conditional comments. If empty, all comments are stripped.
+	PreserveCommentPrefixes []string `protobuf:"bytes,13,rep,name=preserve_comment_prefixes,json=preserveCommentPrefixes,proto3" json:"preserve_comment_prefixes,omitempty"`
+	// Names of elements whose nonce attributes NodeCleanup should preserve. If
+	// empty, all nonce attributes are stripped.
+	PreserveNonceElements []string `protobuf:"bytes,14,rep,name=preserve_nonce_elements,json=preserveNonceElements,proto3" json:"preserve_nonce_elements,omitempty"`
+	// The maximum number of preconnect hints URLRewrite emits. If zero, there
+	// is no limit.
+	MaxPreconnects int32 `protobuf:"varint,15,opt,name=max_preconnects,json=maxPreconnects,proto3" json:"max_preconnects,omitempty"`
+	// If true, ResourceHints adds preconnect hints for the AMP CDN and the
+	// origins of the document's subresources.
+	ResourceHints bool `protobuf:"varint,16,opt,name=resource_hints,json=resourceHints,proto3" json:"resource_hints,omitempty"`
+	// The maximum number of hints ResourceHints adds. If zero, it is 4.
+	MaxResourceHints int32 `protobuf:"varint,17,opt,name=max_resource_hints,json=maxResourceHints,proto3" json:"max_resource_hints,omitempty"`
+	// Inline style declarations which StripInlineStyles removes, each of the
+	// form "property" or "property:value". If empty, StripInlineStyles is
+	// disabled.
+	DisallowedInlineStyles []string `protobuf:"bytes,18,rep,name=disallowed_inline_styles,json=disallowedInlineStyles,proto3" json:"disallowed_inline_styles,omitempty"`
+	// If true, InjectTitle inserts a <title> into documents without one.
+	InjectTitle bool `protobuf:"varint,19,opt,name=inject_title,json=injectTitle,proto3" json:"inject_title,omitempty"`
+	// The title InjectTitle inserts. If empty, the title is derived from the
+	// canonical URL.
+	DefaultTitle string `protobuf:"bytes,20,opt,name=default_title,json=defaultTitle,proto3" json:"default_title,omitempty"`
+	// If true, CollapseWhitespace collapses runs of whitespace in text.
+	CollapseWhitespace bool `protobuf:"varint,21,opt,name=collapse_whitespace,json=collapseWhitespace,proto3" json:"collapse_whitespace,omitempty"`
+	// If true, EmptyTables removes table sections and tables without cells.
+	StripEmptyTables bool `protobuf:"varint,22,opt,name=strip_empty_tables,json=stripEmptyTables,proto3" json:"strip_empty_tables,omitempty"`
+	// If true, WrapperDivs collapses chains of single-child wrapper divs.
+	CollapseWrapperDivs bool `protobuf:"varint,23,opt,name=collapse_wrapper_divs,json=collapseWrapperDivs,proto3" json:"collapse_wrapper_divs,omitempty"`
+	// If true, ClassTokens removes duplicate tokens from class attributes.
+	DedupeClasses bool `protobuf:"varint,24,opt,name=dedupe_classes,json=dedupeClasses,proto3" json:"dedupe_classes,omitempty"`
+	// If true, ClassTokens also sorts the tokens of class attributes.
+	SortClasses bool `protobuf:"varint,25,opt,name=sort_classes,json=sortClasses,proto3" json:"sort_classes,omitempty"`
+	// If true, TrackingPixels converts tracking images into <amp-pixel>.
+	ConvertTrackingPixels bool `protobuf:"varint,26,opt,name=convert_tracking_pixels,json=convertTrackingPixels,proto3" json:"convert_tracking_pixels,omitempty"`
+	// The hosts whose images TrackingPixels converts, regardless of their size.
+	// Subdomains match too.
+	TrackingPixelHosts []string `protobuf:"bytes,27,rep,name=tracking_pixel_hosts,json=trackingPixelHosts,proto3" json:"tracking_pixel_hosts,omitempty"`
+	// If true, ImgToAMPImg converts <img> elements into <amp-img>.
+	ConvertImgToAmpImg bool `protobuf:"varint,28,opt,name=convert_img_to_amp_img,json=convertImgToAmpImg,proto3" json:"convert_img_to_amp_img,omitempty"`
+	// If true, MediaAttributes checks, and where possible fills in, the
+	// required attributes of <amp-video> and <amp-audio>.
+	EnforceMediaAttributes bool `protobuf:"varint,29,opt,name=enforce_media_attributes,json=enforceMediaAttributes,proto3" json:"enforce_media_attributes,omitempty"`
+	// If true, ComponentStructure checks, and where possible repairs, the
+	// required structure of <amp-accordion> and <amp-sidebar>.
+	EnforceComponentStructure bool `protobuf:"varint,30,opt,name=enforce_component_structure,json=enforceComponentStructure,proto3" json:"enforce_component_structure,omitempty"`
+	// If true, AMPGeoGroups removes invalid country codes from the
+	// ISOCountryGroups of <amp-geo> configs.
+	EnforceAmpGeoGroups bool `protobuf:"varint,31,opt,name=enforce_amp_geo_groups,json=enforceAmpGeoGroups,proto3" json:"enforce_amp_geo_groups,omitempty"`
+	// If true, AMPGeoGroups fails listing them instead.
+	ErrorOnInvalidAmpGeoGroups bool `protobuf:"varint,32,opt,name=error_on_invalid_amp_geo_groups,json=errorOnInvalidAmpGeoGroups,proto3" json:"error_on_invalid_amp_geo_groups,omitempty"`
+	// If true, MergeAnalytics merges <amp-analytics> elements with compatible
+	// configs.
+	MergeAmpAnalytics bool `protobuf:"varint,33,opt,name=merge_amp_analytics,json=mergeAmpAnalytics,proto3" json:"merge_amp_analytics,omitempty"`
+	// If true, PruneUnusedCSS removes the amp-custom style rules that match no
+	// element.
+	PruneUnusedCss bool `protobuf:"varint,34,opt,name=prune_unused_css,json=pruneUnusedCss,proto3" json:"prune_unused_css,omitempty"`
+	// If true, NodeCleanup strips data-* attributes from elements other than
+	// AMP components, except those matching preserve_attribute_prefixes.
+	PruneDataAttributes bool `protobuf:"varint,35,opt,name=prune_data_attributes,json=pruneDataAttributes,proto3" json:"prune_data_attributes,omitempty"`
+	// Prefixes of attribute names, e.g. "data-vars-", which NodeCleanup never
+	// prunes.
+	PreserveAttributePrefixes []string `protobuf:"bytes,36,rep,name=preserve_attribute_prefixes,json=preserveAttributePrefixes,proto3" json:"preserve_attribute_prefixes,omitempty"`
+	// If true, the transformers marked safe to parallelize process the children
+	// of <body> concurrently, which may be faster for very large documents.
+	ParallelSubtrees bool `protobuf:"varint,37,opt,name=parallel_subtrees,json=parallelSubtrees,proto3" json:"parallel_subtrees,omitempty"`
+	// The maximum number of subtrees processed at once, if parallel_subtrees is
+	// true. If zero, it is runtime.GOMAXPROCS(0).
+	MaxSubtreeConcurrency int32 `protobuf:"varint,38,opt,name=max_subtree_concurrency,json=maxSubtreeConcurrency,proto3" json:"max_subtree_concurrency,omitempty"`
+	// If true, the transformers that follow one which fails, and which is safe
+	// to skip, are still run, and the partially transformed document is
+	// returned along with the errors.
+	BestEffort           bool     `protobuf:"varint,39,opt,name=best_effort,json=bestEffort,proto3" json:"best_effort,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Request_Options) Reset()         { *m = Request_Options{} }
+func (m *Request_Options) String() string { return proto.CompactTextString(m) }
+func (*Request_Options) ProtoMessage()    {}
+func (*Request_Options) Descriptor() ([]byte, []int) {
+	return fileDescriptor_762cce2ac5f73405, []int{0, 0}
+}
+
+func (m *Request_Options) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Request_Options.Unmarshal(m, b)
+}
+func (m *Request_Options) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Request_Options.Marshal(b, m, deterministic)
+}
+func (m *Request_Options) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Request_Options.Merge(m, src)
+}
+func (m *Request_Options) XXX_Size() int {
+	return xxx_messageInfo_Request_Options.Size(m)
+}
+func (m *Request_Options) XXX_DiscardUnknown() {
+	xxx_messageInfo_Request_Options.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Request_Options proto.InternalMessageInfo
+
+func (m *Request_Options) GetStripCssComments() bool {
+	if m != nil {
+		return m.StripCssComments
+	}
+	return false
+}
+
+func (m *Request_Options) GetCssCommentKeepPattern() string {
+	if m != nil {
+		return m.CssCommentKeepPattern
+	}
+	return ""
+}
+
+func (m *Request_Options) GetDedupeFontFaces() bool {
+	if m != nil {
+		return m.DedupeFontFaces
+	}
+	return false
+}
+
+func (m *Request_Options) GetMoveAmpKeyframes() bool {
+	if m != nil {
+		return m.MoveAmpKeyframes
+	}
+	return false
+}
+
+func (m *Request_Options) GetAmpKeyframesThreshold() int32 {
+	if m != nil {
+		return m.AmpKeyframesThreshold
+	}
+	return 0
+}
+
+func (m *Request_Options) GetPruneUnusedExtensions() bool {
+	if m != nil {
+		return m.PruneUnusedExtensions
+	}
+	return false
+}
+
+func (m *Request_Options) GetRelativeSameOriginUrls() bool {
+	if m != nil {
+		return m.RelativeSameOriginUrls
+	}
+	return false
+}
+
+func (m *Request_Options) GetStripDisallowedCss() bool {
+	if m != nil {
+		return m.StripDisallowedCss
+	}
+	return false
+}
+
+func (m *Request_Options) GetErrorOnDisallowedCss() bool {
+	if m != nil {
+		return m.ErrorOnDisallowedCss
+	}
+	return false
+}
+
+func (m *Request_Options) GetNormalizeCss() bool {
+	if m != nil {
+		return m.NormalizeCss
+	}
+	return false
+}
+
+func (m *Request_Options) GetAmpFormatPrecedence() []Request_HtmlFormat {
+	if m != nil {
+		return m.AmpFormatPrecedence
+	}
+	return nil
+}
+
+func (m *Request_Options) GetExplicitAmpImgLayout() bool {
+	if m != nil {
+		return m.ExplicitAmpImgLayout
+	}
+	return false
+}
+
+func (m *Request_Options) GetPreserveCommentPrefixes() []string {
+	if m != nil {
+		return m.PreserveCommentPrefixes
+	}
+	return nil
+}
+
+func (m *Request_Options) GetPreserveNonceElements() []string {
+	if m != nil {
+		return m.PreserveNonceElements
+	}
+	return nil
+}
+
+func (m *Request_Options) GetMaxPreconnects() int32 {
+	if m != nil {
+		return m.MaxPreconnects
+	}
+	return 0
+}
+
+func (m *Request_Options) GetResourceHints() bool {
+	if m != nil {
+		return m.ResourceHints
+	}
+	return false
+}
+
+func (m *Request_Options) GetMaxResourceHints() int32 {
+	if m != nil {
+		return m.MaxResourceHints
+	}
+	return 0
+}
+
+func (m *Request_Options) GetDisallowedInlineStyles() []string {
+	if m != nil {
+		return m.DisallowedInlineStyles
+	}
+	return nil
+}
+
+func (m *Request_Options) GetInjectTitle() bool {
+	if m != nil {
+		return m.InjectTitle
+	}
+	return false
+}
+
+func (m *Request_Options) GetDefaultTitle() string {
+	if m != nil {
+		return m.DefaultTitle
+	}
+	return ""
+}
+
+func (m *Request_Options) GetCollapseWhitespace() bool {
+	if m != nil {
+		return m.CollapseWhitespace
+	}
+	return false
+}
+
+func (m *Request_Options) GetStripEmptyTables() bool {
+	if m != nil {
+		return m.StripEmptyTables
+	}
+	return false
+}
+
+func (m *Request_Options) GetCollapseWrapperDivs() bool {
+	if m != nil {
+		return m.CollapseWrapperDivs
+	}
+	return false
+}
+
+func (m *Request_Options) GetDedupeClasses() bool {
+	if m != nil {
+		return m.DedupeClasses
+	}
+	return false
+}
+
+func (m *Request_Options) GetSortClasses() bool {
+	if m != nil {
+		return m.SortClasses
+	}
+	return false
+}
+
+func (m *Request_Options) GetConvertTrackingPixels() bool {
+	if m != nil {
+		return m.ConvertTrackingPixels
+	}
+	return false
+}
+
+func (m *Request_Options) GetTrackingPixelHosts() []string {
+	if m != nil {
+		return m.TrackingPixelHosts
+	}
+	return nil
+}
+
+func (m *Request_Options) GetConvertImgToAmpImg() bool {
+	if m != nil {
+		return m.ConvertImgToAmpImg
+	}
+	return false
+}
+
+func (m *Request_Options) GetEnforceMediaAttributes() bool {
+	if m != nil {
+		return m.EnforceMediaAttributes
+	}
+	return false
+}
+
+func (m *Request_Options) GetEnforceComponentStructure() bool {
+	if m != nil {
+		return m.EnforceComponentStructure
+	}
+	return false
+}
+
+func (m *Request_Options) GetEnforceAmpGeoGroups() bool {
+	if m != nil {
+		return m.EnforceAmpGeoGroups
+	}
+	return false
+}
+
+func (m *Request_Options) GetErrorOnInvalidAmpGeoGroups() bool {
+	if m != nil {
+		return m.ErrorOnInvalidAmpGeoGroups
+	}
+	return false
+}
+
+func (m *Request_Options) GetMergeAmpAnalytics() bool {
+	if m != nil {
+		return m.MergeAmpAnalytics
+	}
+	return false
+}
+
+func (m *Request_Options) GetPruneUnusedCss() bool {
+	if m != nil {
+		return m.PruneUnusedCss
+	}
+	return false
+}
+
+func (m *Request_Options) GetPruneDataAttributes() bool {
+	if m != nil {
+		return m.PruneDataAttributes
+	}
+	return false
+}
+
+func (m *Request_Options) GetPreserveAttributePrefixes() []string {
+	if m != nil {
+		return m.PreserveAttributePrefixes
+	}
+	return nil
+}
+
+func (m *Request_Options) GetParallelSubtrees() bool {
+	if m != nil {
+		return m.ParallelSubtrees
+	}
+	return false
+}
+
+func (m *Request_Options) GetMaxSubtreeConcurrency() int32 {
+	if m != nil {
+		return m.MaxSubtreeConcurrency
+	}
+	return 0
+}
+
+func (m *Request_Options) GetBestEffort() bool {
+	if m != nil {
+		return m.BestEffort
+	}
+	return false
+}
+
 // An inclusive range of version numbers.
 type VersionRange struct {
 	Min                  int64    `protobuf:"varint,1,opt,name=min,proto3" json:"min,omitempty"`
@@ -466,6 +892,7 @@ func init() {
 	proto.RegisterEnum("amp.transform.Request_HtmlFormat", Request_HtmlFormat_name, Request_HtmlFormat_value)
 	proto.RegisterEnum("amp.transform.Request_TransformersConfig", Request_TransformersConfig_name, Request_TransformersConfig_value)
 	proto.RegisterType((*Request)(nil), "amp.transform.Request")
+	proto.RegisterType((*Request_Options)(nil), "amp.transform.Request.Options")
 	proto.RegisterType((*VersionRange)(nil), "amp.transform.VersionRange")
 	proto.RegisterType((*Metadata)(nil), "amp.transform.Metadata")
 	proto.RegisterType((*Metadata_Preload)(nil), "amp.transform.Metadata.Preload")
@@ -477,42 +904,99 @@ func init() {
 }
 
 var fileDescriptor_762cce2ac5f73405 = []byte{
-	// 583 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x53, 0xcd, 0x72, 0xda, 0x3c,
-	0x14, 0x8d, 0x2d, 0xc2, 0xcf, 0x0d, 0xe1, 0xf3, 0x68, 0xf1, 0x8d, 0x26, 0x9b, 0x3a, 0xac, 0xc8,
-	0xc6, 0xcc, 0xd0, 0x76, 0xba, 0xe8, 0xca, 0x09, 0x4e, 0x4b, 0x0b, 0x86, 0x51, 0x20, 0xed, 0x74,
-	0xc3, 0x28, 0x46, 0x21, 0x34, 0x16, 0xa6, 0x92, 0x48, 0xc9, 0x03, 0xf6, 0x01, 0xba, 0xec, 0xdb,
-	0x74, 0x24, 0x63, 0x92, 0xf4, 0x67, 0xba, 0xd2, 0xb9, 0x47, 0xf7, 0x48, 0x67, 0xee, 0x0f, 0x1c,
-	0x6b, 0xc9, 0x96, 0xea, 0x3a, 0x93, 0x82, 0xcb, 0xb6, 0xe4, 0x5f, 0xd6, 0x5c, 0xe9, 0xe2, 0x0c,
-	0x56, 0x32, 0xd3, 0x19, 0x3e, 0x64, 0x62, 0x15, 0xec, 0xd2, 0x9a, 0xdf, 0x11, 0x54, 0x68, 0x9e,
-	0x80, 0x31, 0x94, 0x6e, 0xb4, 0x48, 0x89, 0xe3, 0x3b, 0xad, 0x1a, 0xb5, 0x18, 0x1f, 0x43, 0x7d,
-	0x96, 0x25, 0x6b, 0xc1, 0x97, 0x7a, 0xba, 0x96, 0x29, 0x71, 0xed, 0xdd, 0x41, 0xc1, 0x4d, 0x64,
-	0x8a, 0x3d, 0x40, 0x52, 0xdf, 0x91, 0x92, 0xbd, 0x31, 0xd0, 0x30, 0x89, 0x52, 0x64, 0x3f, 0x67,
-	0x12, 0xa5, 0xf0, 0x3b, 0xf8, 0x8f, 0xa5, 0x69, 0xf6, 0x95, 0xcf, 0xa6, 0xe6, 0x5b, 0xa6, 0x15,
-	0xa9, 0xf8, 0xa8, 0xd5, 0xe8, 0x1c, 0x07, 0x4f, 0xfc, 0x04, 0x5b, 0x2f, 0xc1, 0x5b, 0x2d, 0xd2,
-	0x73, 0x9b, 0x49, 0x1b, 0x5b, 0x65, 0x1e, 0x2a, 0x1c, 0x42, 0x39, 0xc9, 0x96, 0xd7, 0x8b, 0x39,
-	0x29, 0xfb, 0x4e, 0xab, 0xd1, 0x39, 0xf9, 0xcb, 0x13, 0xe3, 0x87, 0x5a, 0xa8, 0x33, 0x2b, 0xa0,
-	0x5b, 0x21, 0x6e, 0x42, 0xfd, 0x51, 0xa5, 0x14, 0x41, 0x3e, 0x6a, 0xd5, 0xe8, 0x13, 0x0e, 0x13,
-	0xa8, 0xdc, 0x71, 0xa9, 0x16, 0xd9, 0x92, 0x54, 0x7d, 0xa7, 0x85, 0x68, 0x11, 0x36, 0x27, 0x00,
-	0x0f, 0xf6, 0xb0, 0x07, 0xf5, 0x49, 0xfc, 0x3e, 0x1e, 0x7e, 0x88, 0xa7, 0x67, 0xc3, 0x6e, 0xe4,
-	0xed, 0xe1, 0x0a, 0xa0, 0x70, 0x30, 0xf2, 0x1c, 0x7c, 0x00, 0x95, 0x70, 0x30, 0x7a, 0x11, 0x76,
-	0x2f, 0x3c, 0x17, 0x1f, 0x42, 0xcd, 0x04, 0xd1, 0x20, 0xec, 0xf5, 0x3d, 0x64, 0x64, 0xd1, 0xc7,
-	0x51, 0x44, 0x7b, 0x83, 0x28, 0x1e, 0x87, 0x7d, 0xaf, 0xd4, 0x7c, 0x03, 0xf8, 0x77, 0xcb, 0xe6,
-	0x8d, 0x6e, 0x74, 0x1e, 0x4e, 0xfa, 0x63, 0x6f, 0x0f, 0x57, 0xa1, 0x14, 0x0f, 0xe3, 0xc8, 0x73,
-	0x70, 0x03, 0xe0, 0x32, 0xec, 0xf7, 0xba, 0xe1, 0xb8, 0x37, 0x8c, 0x3d, 0x17, 0x03, 0x94, 0xcf,
-	0x26, 0x17, 0xe3, 0xe1, 0xc0, 0x43, 0xcd, 0x0e, 0xd4, 0x2f, 0x73, 0xab, 0x94, 0x2d, 0xe7, 0xdc,
-	0xb4, 0x43, 0x2c, 0x96, 0xb6, 0xad, 0x88, 0x1a, 0x68, 0x19, 0xb6, 0xb1, 0xcd, 0x34, 0x0c, 0xdb,
-	0x34, 0xbf, 0xb9, 0x50, 0x1d, 0x70, 0xcd, 0x66, 0x4c, 0x33, 0xfc, 0x1a, 0xaa, 0x2b, 0xc9, 0xd3,
-	0x8c, 0xcd, 0x14, 0x71, 0x7c, 0xd4, 0x3a, 0xe8, 0x3c, 0xfb, 0xa5, 0xc6, 0x45, 0x6a, 0x30, 0xca,
-	0xf3, 0xe8, 0x4e, 0x80, 0x7d, 0xa8, 0x0b, 0xb6, 0x99, 0xb2, 0x39, 0x9f, 0x2a, 0x9e, 0x28, 0xfb,
-	0xc9, 0x3e, 0x05, 0xc1, 0x36, 0xe1, 0x9c, 0x5f, 0xf0, 0x44, 0x1d, 0xfd, 0x70, 0xa0, 0xb2, 0xd5,
-	0x19, 0x27, 0x66, 0xac, 0xf2, 0x91, 0x33, 0x10, 0x37, 0xc0, 0x65, 0x6a, 0x3b, 0x67, 0x2e, 0x33,
-	0x7d, 0xd8, 0x17, 0x7c, 0xb6, 0x60, 0x04, 0x19, 0xea, 0xd4, 0x25, 0x0e, 0xcd, 0x09, 0xdc, 0x03,
-	0x60, 0x5a, 0xcb, 0xc5, 0xd5, 0x5a, 0x73, 0x45, 0x4a, 0xd6, 0xe8, 0xc9, 0x3f, 0x8c, 0x06, 0x61,
-	0xa1, 0xa0, 0x8f, 0xc4, 0xf8, 0x7f, 0x28, 0x8b, 0x6c, 0xb6, 0x4e, 0xb9, 0x1d, 0xda, 0x2a, 0xdd,
-	0x46, 0x47, 0x6d, 0xa8, 0xed, 0x04, 0xc6, 0xeb, 0x2d, 0xbf, 0x2f, 0xbc, 0xde, 0xf2, 0x7b, 0xc3,
-	0xdc, 0xb1, 0x62, 0x29, 0x0c, 0x3c, 0x7d, 0xf5, 0xe9, 0xe5, 0x7c, 0xa1, 0x6f, 0xd6, 0x57, 0x41,
-	0x92, 0x89, 0x36, 0x13, 0xab, 0x95, 0xcc, 0x3e, 0xf3, 0x44, 0x5b, 0xc8, 0x92, 0x5b, 0x36, 0xe7,
-	0xb2, 0xfd, 0x87, 0x2d, 0xbd, 0x2a, 0xdb, 0xf5, 0x7c, 0xfe, 0x33, 0x00, 0x00, 0xff, 0xff, 0xa7,
-	0x23, 0x3f, 0xb6, 0xc3, 0x03, 0x00, 0x00,
+	// 1503 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x56, 0xfd, 0x6e, 0xe3, 0xb8,
+	0x11, 0x3f, 0xc7, 0xd9, 0x7c, 0x30, 0x89, 0xa3, 0x65, 0x36, 0x09, 0x37, 0xd7, 0xde, 0x66, 0x73,
+	0xbd, 0x5e, 0xae, 0x2d, 0x9c, 0xc2, 0xd7, 0xfb, 0x68, 0x0b, 0x14, 0xd0, 0x39, 0xde, 0x5d, 0x77,
+	0x13, 0xdb, 0x50, 0xec, 0xdb, 0xa2, 0xff, 0x10, 0x8c, 0x3c, 0x76, 0xd4, 0x88, 0xa4, 0x4a, 0x52,
+	0x3e, 0xbb, 0xef, 0x57, 0xa0, 0x4f, 0x50, 0xa0, 0x6f, 0x53, 0x90, 0x94, 0x64, 0x3b, 0xed, 0xa1,
+	0xfd, 0xcb, 0xd2, 0xef, 0x83, 0x1c, 0x0d, 0x87, 0xe3, 0x41, 0xaf, 0x8d, 0x62, 0x42, 0x4f, 0xa4,
+	0xe2, 0xa0, 0xae, 0x14, 0xfc, 0x35, 0x07, 0x6d, 0xca, 0xdf, 0x66, 0xa6, 0xa4, 0x91, 0xf8, 0x80,
+	0xf1, 0xac, 0x59, 0xc9, 0x2e, 0xfe, 0x79, 0x84, 0xb6, 0x23, 0x2f, 0xc0, 0x18, 0x6d, 0x3e, 0x18,
+	0x9e, 0x92, 0xda, 0x79, 0xed, 0x72, 0x37, 0x72, 0xcf, 0xf8, 0x35, 0xda, 0x1f, 0xcb, 0x38, 0xe7,
+	0x20, 0x0c, 0xcd, 0x55, 0x4a, 0x36, 0x1c, 0xb7, 0x57, 0x62, 0x23, 0x95, 0xe2, 0x00, 0xd5, 0x95,
+	0x99, 0x91, 0x4d, 0xc7, 0xd8, 0x47, 0x8b, 0xc4, 0x5a, 0x93, 0x67, 0x1e, 0x89, 0xb5, 0xc6, 0x7f,
+	0x44, 0x87, 0x2c, 0x4d, 0xe5, 0x0f, 0x30, 0xa6, 0x76, 0x5b, 0x66, 0x34, 0xd9, 0x3e, 0xaf, 0x5f,
+	0x36, 0x5a, 0xaf, 0x9b, 0x6b, 0xf1, 0x34, 0x8b, 0x58, 0x9a, 0xef, 0x0c, 0x4f, 0xdf, 0x38, 0x65,
+	0xd4, 0x28, 0x9c, 0xfe, 0x55, 0xe3, 0x10, 0x6d, 0xc5, 0x52, 0x4c, 0x92, 0x29, 0xd9, 0x3a, 0xaf,
+	0x5d, 0x36, 0x5a, 0x5f, 0xfc, 0xc8, 0x12, 0xc3, 0x65, 0x2e, 0x74, 0xdb, 0x19, 0xa2, 0xc2, 0x88,
+	0x2f, 0xd0, 0xfe, 0x4a, 0xa6, 0x34, 0xa9, 0x9f, 0xd7, 0x2f, 0x77, 0xa3, 0x35, 0x0c, 0x13, 0xb4,
+	0x3d, 0x03, 0xa5, 0x13, 0x29, 0xc8, 0xce, 0x79, 0xed, 0xb2, 0x1e, 0x95, 0xaf, 0xf8, 0x5b, 0xb4,
+	0x2d, 0x33, 0x93, 0x48, 0xa1, 0xc9, 0xee, 0x79, 0xed, 0x72, 0xaf, 0xf5, 0xc9, 0x8f, 0x44, 0xd0,
+	0xf7, 0xaa, 0xa8, 0x94, 0x9f, 0xfd, 0xe3, 0x10, 0x6d, 0x17, 0x20, 0xfe, 0x15, 0xc2, 0xda, 0xa8,
+	0x24, 0xa3, 0xb1, 0xd6, 0x34, 0x96, 0xdc, 0xa6, 0x53, 0xbb, 0xdc, 0xef, 0x44, 0x81, 0x63, 0xda,
+	0x5a, 0xb7, 0x0b, 0x1c, 0x7f, 0x83, 0xc8, 0x8a, 0x8e, 0x3e, 0x02, 0x64, 0x34, 0x63, 0xc6, 0x80,
+	0x12, 0xc5, 0x99, 0x1c, 0xc7, 0x95, 0xfc, 0x3d, 0x40, 0x36, 0xf0, 0x24, 0xfe, 0x05, 0x7a, 0x3e,
+	0x86, 0x71, 0x9e, 0x01, 0x9d, 0x48, 0x61, 0xe8, 0x84, 0xc5, 0x60, 0xbf, 0xd7, 0xee, 0x72, 0xe8,
+	0x89, 0x37, 0x52, 0x98, 0x37, 0x16, 0xb6, 0x21, 0x71, 0x39, 0x03, 0xca, 0x78, 0x46, 0x1f, 0x61,
+	0x31, 0x51, 0x8c, 0x83, 0x76, 0x07, 0xbb, 0x13, 0x05, 0x96, 0x09, 0x79, 0xf6, 0xbe, 0xc4, 0xf1,
+	0xd7, 0xe8, 0x74, 0x4d, 0x48, 0xcd, 0x83, 0x02, 0xfd, 0x20, 0xd3, 0xb1, 0x3b, 0xf9, 0x67, 0xd1,
+	0x31, 0x5b, 0x91, 0x0f, 0x4b, 0xd2, 0xfa, 0x32, 0x95, 0x0b, 0xa0, 0xb9, 0xc8, 0x35, 0x8c, 0x29,
+	0xcc, 0x0d, 0x08, 0xed, 0xd2, 0xb9, 0xe5, 0xb6, 0x3a, 0x76, 0xf4, 0xc8, 0xb1, 0x9d, 0x8a, 0xc4,
+	0xbf, 0x45, 0x2f, 0x15, 0xa4, 0xcc, 0x24, 0x33, 0xa0, 0x9a, 0x71, 0xa0, 0x52, 0x25, 0xd3, 0x44,
+	0xd8, 0xb2, 0xb4, 0xd5, 0x64, 0x9d, 0x27, 0xa5, 0xe0, 0x8e, 0x71, 0xe8, 0x3b, 0x7a, 0xa4, 0x52,
+	0x8d, 0x7f, 0x8d, 0x5e, 0xf8, 0x5c, 0x8f, 0x13, 0x5d, 0xd6, 0xa1, 0xad, 0xd0, 0x1d, 0xe7, 0xf2,
+	0xe7, 0x70, 0x5d, 0x51, 0x6d, 0xad, 0xf1, 0x57, 0xe8, 0x14, 0x94, 0x92, 0x8a, 0x4a, 0xf1, 0xd4,
+	0xb4, 0xeb, 0x4c, 0x2f, 0x1c, 0xdd, 0x17, 0xeb, 0xb6, 0x4f, 0xd1, 0x81, 0xb0, 0x65, 0x9a, 0x26,
+	0x7f, 0x03, 0x27, 0x46, 0x4e, 0xbc, 0x5f, 0x81, 0x56, 0x34, 0x42, 0x36, 0x33, 0xc5, 0x45, 0xa0,
+	0x99, 0x82, 0x18, 0xc6, 0x20, 0x62, 0x20, 0x7b, 0xff, 0xef, 0x95, 0x38, 0x62, 0x3c, 0xf3, 0x8f,
+	0x83, 0xca, 0xed, 0x42, 0x9e, 0x67, 0x69, 0x12, 0x27, 0xc6, 0x9d, 0x60, 0xc2, 0xa7, 0x34, 0x65,
+	0x0b, 0x99, 0x1b, 0xb2, 0x5f, 0x84, 0x5c, 0xd0, 0x21, 0xcf, 0xba, 0x7c, 0x7a, 0xe3, 0x38, 0xfc,
+	0x3b, 0xf4, 0x32, 0x53, 0xa0, 0x41, 0xcd, 0xa0, 0x2a, 0xaf, 0x4c, 0xc1, 0x24, 0x99, 0x83, 0x26,
+	0x07, 0xee, 0x62, 0x9c, 0x96, 0x82, 0xa2, 0xbe, 0x06, 0x05, 0xed, 0x8f, 0xb2, 0xf0, 0x0a, 0x29,
+	0x62, 0xa0, 0x90, 0x82, 0x2f, 0xe4, 0x86, 0x73, 0x1e, 0x97, 0x74, 0xcf, 0xb2, 0x9d, 0x82, 0xc4,
+	0x9f, 0xa3, 0x43, 0xce, 0xe6, 0xee, 0xd3, 0xa5, 0x10, 0x10, 0x1b, 0x4d, 0x0e, 0x5d, 0xc9, 0x34,
+	0x38, 0x9b, 0x0f, 0x96, 0x28, 0xfe, 0x0c, 0x35, 0x14, 0x68, 0x99, 0xab, 0x18, 0xe8, 0x43, 0x62,
+	0xd7, 0x0d, 0xdc, 0xa7, 0x1c, 0x94, 0xe8, 0x3b, 0x0b, 0xba, 0xc2, 0x65, 0x73, 0xfa, 0x44, 0xfa,
+	0xdc, 0x2d, 0x19, 0x70, 0x36, 0x8f, 0xd6, 0xd4, 0xdf, 0x22, 0xb2, 0x72, 0xa4, 0x89, 0x48, 0x13,
+	0x01, 0x54, 0x9b, 0x45, 0x0a, 0x9a, 0x60, 0x17, 0xf6, 0xc9, 0x92, 0xef, 0x3a, 0xfa, 0xce, 0xb1,
+	0xb6, 0x1b, 0x26, 0xe2, 0x2f, 0x10, 0x1b, 0x6a, 0x12, 0x93, 0x02, 0x39, 0x72, 0xc1, 0xec, 0x79,
+	0x6c, 0x68, 0x21, 0x5b, 0x01, 0x63, 0x98, 0xb0, 0x3c, 0x2d, 0x35, 0x2f, 0xdc, 0xed, 0xdc, 0x2f,
+	0x40, 0x2f, 0xba, 0x42, 0x47, 0xb1, 0x4c, 0x53, 0x96, 0x69, 0xa0, 0x3f, 0x3c, 0x24, 0x06, 0x74,
+	0xc6, 0x62, 0x20, 0xc7, 0xbe, 0x1c, 0x4b, 0xea, 0x43, 0xc5, 0x2c, 0x9b, 0x05, 0xf0, 0xcc, 0x2c,
+	0xa8, 0x61, 0xf7, 0x36, 0xd8, 0x93, 0x95, 0x66, 0xd1, 0xb1, 0xc4, 0xd0, 0xe1, 0xb8, 0x85, 0x8e,
+	0x97, 0xcb, 0x2b, 0x96, 0x65, 0xa0, 0xe8, 0x38, 0x99, 0x69, 0x72, 0xea, 0x0c, 0xd5, 0xde, 0x1f,
+	0x3c, 0x77, 0x9d, 0xcc, 0x5c, 0xa6, 0x8b, 0x3e, 0x11, 0xa7, 0x4c, 0x6b, 0xd0, 0x84, 0xf8, 0x4c,
+	0x7b, 0xb4, 0xed, 0x41, 0x9b, 0x01, 0x2d, 0x95, 0xa9, 0x44, 0x2f, 0x7d, 0x06, 0x2c, 0x56, 0x4a,
+	0xbe, 0x46, 0xa7, 0xb1, 0x14, 0x33, 0x50, 0x86, 0x1a, 0xc5, 0xe2, 0xc7, 0x44, 0x4c, 0x69, 0x96,
+	0xcc, 0x21, 0xd5, 0xe4, 0xcc, 0xdf, 0xef, 0x82, 0x1e, 0x16, 0xec, 0xc0, 0x91, 0xf6, 0x92, 0xae,
+	0xeb, 0xe9, 0x83, 0xd4, 0x46, 0x93, 0x8f, 0xdd, 0x91, 0x60, 0xb3, 0xaa, 0x7e, 0x67, 0x19, 0xdc,
+	0x42, 0x27, 0xe5, 0x4e, 0xb6, 0xd8, 0x8d, 0x2c, 0xeb, 0x9e, 0xfc, 0xa4, 0xcc, 0xa4, 0x63, 0xbb,
+	0x7c, 0x3a, 0x94, 0xbe, 0xe8, 0xed, 0xe1, 0x83, 0x98, 0x48, 0x5b, 0x25, 0x1c, 0xc6, 0x09, 0xa3,
+	0xcc, 0x18, 0x95, 0xdc, 0xe7, 0x06, 0x34, 0xf9, 0xa9, 0x6f, 0x22, 0x05, 0x7f, 0x6b, 0xe9, 0xb0,
+	0x62, 0xf1, 0x1f, 0xd0, 0xc7, 0xa5, 0x33, 0x96, 0x3c, 0x93, 0xc2, 0xde, 0x14, 0x6d, 0x54, 0x1e,
+	0x9b, 0x5c, 0x01, 0xf9, 0xc4, 0x99, 0x5f, 0x16, 0x92, 0x76, 0xa9, 0xb8, 0x2b, 0x05, 0xf8, 0x4b,
+	0x54, 0xae, 0xec, 0xc2, 0x9c, 0x82, 0xa4, 0x53, 0x25, 0xf3, 0x4c, 0x93, 0x57, 0xfe, 0x58, 0x0a,
+	0x36, 0xe4, 0xd9, 0x5b, 0x90, 0x6f, 0x1d, 0x85, 0xdb, 0xe8, 0x55, 0xd5, 0x87, 0x12, 0x31, 0x63,
+	0x69, 0x32, 0x7e, 0xea, 0x3e, 0x77, 0xee, 0xb3, 0xa2, 0x1f, 0x75, 0xbd, 0x68, 0x6d, 0x91, 0x26,
+	0x3a, 0xe2, 0xa0, 0xa6, 0x7e, 0x5f, 0x26, 0x58, 0xba, 0x30, 0x49, 0xac, 0xc9, 0x6b, 0x67, 0x7c,
+	0xee, 0xa8, 0x90, 0x67, 0x61, 0x49, 0xe0, 0x4b, 0x14, 0xac, 0x75, 0x68, 0xdb, 0xc8, 0x2e, 0x9c,
+	0xb8, 0xb1, 0xd2, 0x9a, 0x6d, 0x2b, 0x6b, 0x21, 0xdf, 0xac, 0xe9, 0x98, 0x99, 0xb5, 0x54, 0x7e,
+	0xea, 0x3f, 0xc9, 0x91, 0xd7, 0xcc, 0x3c, 0xc9, 0x63, 0xd5, 0x34, 0x2a, 0xc7, 0xb2, 0xe5, 0xfc,
+	0xcc, 0x1d, 0x77, 0xd5, 0x93, 0x2a, 0x63, 0xd5, 0x74, 0x7e, 0x89, 0x9e, 0x67, 0x4c, 0xb1, 0x34,
+	0x85, 0x94, 0xea, 0xfc, 0xde, 0x28, 0x00, 0x4d, 0x3e, 0xf3, 0x57, 0xa1, 0x24, 0xee, 0x0a, 0xdc,
+	0x16, 0xa3, 0xed, 0x0c, 0x85, 0x8e, 0xc6, 0x52, 0xc4, 0xb9, 0x52, 0x20, 0xe2, 0x05, 0xf9, 0xb9,
+	0xff, 0x93, 0xe2, 0x6c, 0x5e, 0xa8, 0xdb, 0x4b, 0x12, 0xbf, 0x42, 0x7b, 0xf7, 0xa0, 0x0d, 0x85,
+	0xc9, 0x44, 0x2a, 0x43, 0x3e, 0x77, 0xcb, 0x23, 0x0b, 0x75, 0x1c, 0x72, 0x31, 0x42, 0x68, 0xd9,
+	0x90, 0x71, 0x80, 0xf6, 0x47, 0xbd, 0xf7, 0xbd, 0xfe, 0x87, 0x1e, 0x6d, 0xf7, 0xaf, 0x3b, 0xc1,
+	0x47, 0x78, 0x1b, 0xd5, 0xc3, 0xdb, 0x41, 0x50, 0xc3, 0x7b, 0x68, 0x3b, 0xbc, 0x1d, 0xfc, 0x26,
+	0xbc, 0xbe, 0x0b, 0x36, 0xf0, 0x01, 0xda, 0xb5, 0x2f, 0x9d, 0xdb, 0xb0, 0x7b, 0x13, 0xd4, 0xad,
+	0xad, 0xf3, 0xa7, 0x41, 0x27, 0xea, 0xde, 0x76, 0x7a, 0xc3, 0xf0, 0x26, 0xd8, 0xbc, 0x78, 0x8b,
+	0xf0, 0x7f, 0xce, 0x2d, 0x76, 0x8d, 0xeb, 0xce, 0x9b, 0x70, 0x74, 0x33, 0x0c, 0x3e, 0xc2, 0x3b,
+	0x68, 0xb3, 0xd7, 0xef, 0x75, 0x82, 0x1a, 0x6e, 0x20, 0xf4, 0x7d, 0x78, 0xd3, 0xbd, 0x0e, 0x87,
+	0xdd, 0x7e, 0x2f, 0xd8, 0xc0, 0x08, 0x6d, 0xb5, 0x47, 0x77, 0xc3, 0xfe, 0x6d, 0x50, 0xbf, 0x68,
+	0xa1, 0xfd, 0xef, 0xfd, 0xbc, 0x12, 0x31, 0x31, 0x05, 0x3b, 0x93, 0xf1, 0x44, 0xb8, 0xf9, 0xa2,
+	0x1e, 0xd9, 0x47, 0x87, 0xb0, 0x39, 0xd9, 0x28, 0x10, 0x36, 0xbf, 0xf8, 0xfb, 0x06, 0xda, 0xb9,
+	0x05, 0xc3, 0xec, 0x61, 0xe2, 0xdf, 0xa3, 0x9d, 0x4c, 0x41, 0x2a, 0xd9, 0xd8, 0x4e, 0x25, 0xf5,
+	0xcb, 0xbd, 0xd6, 0xab, 0x27, 0x7f, 0x4c, 0xa5, 0xb4, 0x39, 0xf0, 0xba, 0xa8, 0x32, 0xe0, 0x73,
+	0xb4, 0x6f, 0xd3, 0xce, 0xa6, 0x40, 0x35, 0xc4, 0xda, 0x6d, 0xf2, 0x2c, 0x42, 0x9c, 0xcd, 0xc3,
+	0x29, 0xdc, 0x41, 0xac, 0xcf, 0xfe, 0x55, 0x43, 0xdb, 0x85, 0xcf, 0x46, 0x62, 0x67, 0x4b, 0x3f,
+	0x77, 0xda, 0x47, 0xdc, 0x40, 0x1b, 0x4c, 0x17, 0x83, 0xcd, 0x06, 0xb3, 0xc3, 0xd8, 0x33, 0x77,
+	0x5b, 0xdd, 0xe4, 0xb2, 0xfb, 0xdd, 0x06, 0xa9, 0x45, 0x1e, 0xc0, 0x5d, 0x84, 0x56, 0xca, 0x6e,
+	0xd3, 0x05, 0xfa, 0xc5, 0xff, 0x08, 0xb4, 0x59, 0x15, 0x55, 0xb4, 0x62, 0xc6, 0x27, 0x68, 0x8b,
+	0xcb, 0x71, 0x9e, 0x82, 0x9b, 0x5f, 0x76, 0xa2, 0xe2, 0xed, 0xec, 0x0a, 0xed, 0x56, 0x06, 0x1b,
+	0xeb, 0x23, 0x2c, 0xca, 0x58, 0x1f, 0x61, 0x61, 0x91, 0x19, 0x2b, 0x27, 0x63, 0xfb, 0xf8, 0xdd,
+	0x37, 0x7f, 0xfe, 0x6a, 0x9a, 0x98, 0x87, 0xfc, 0xbe, 0x19, 0x4b, 0x7e, 0xc5, 0x78, 0x96, 0x29,
+	0x69, 0xff, 0x21, 0xdc, 0x23, 0x8b, 0x1f, 0xd9, 0x14, 0xd4, 0xd5, 0x7f, 0x19, 0xd5, 0xef, 0xb7,
+	0xdc, 0x8c, 0xfe, 0xe5, 0xbf, 0x07, 0x00, 0xc6, 0x6a, 0x55, 0x49, 0xc8, 0x0b, 0x00, 0x00,
 }
@@ -18,6 +18,7 @@
 package transformer
 
 import (
+	"fmt"
 	"math"
 	"net/url"
 	"regexp"
@@ -43,36 +44,133 @@ import (
 var transformerFunctionMap = map[string]func(*transformers.Context) error{
 	"absoluteurl":           transformers.AbsoluteURL,
 	"ampboilerplate":        transformers.AMPBoilerplate,
+	"ampformat":             transformers.AMPFormat,
+	"ampgeogroups":          skippable(transformers.AMPGeoGroups),
+	"ampimglayout":          transformers.Subtrees(transformers.AMPImgLayout),
+	"ampkeyframes":          transformers.AMPKeyframes,
 	"ampruntimecss":         transformers.AMPRuntimeCSS,
+	"classtokens":           transformers.Subtrees(transformers.ClassTokens),
+	"collapsewhitespace":    transformers.Subtrees(transformers.CollapseWhitespace),
+	"componentstructure":    transformers.ComponentStructure,
+	"dedupefontfaces":       skippable(transformers.DedupeFontFaces),
+	"emptytables":           transformers.Subtrees(transformers.EmptyTables),
+	"extractdatauriimages":  transformers.ExtractDataURIImages,
+	"imgtoampimg":           transformers.ImgToAMPImg,
+	"injecttitle":           transformers.InjectTitle,
+	"inlinesvguse":          transformers.InlineSVGUse,
 	"linktag":               transformers.LinkTag,
+	"mediaattributes":       skippable(transformers.MediaAttributes),
+	"mergeanalytics":        transformers.MergeAnalytics,
 	"nodecleanup":           transformers.NodeCleanup,
+	"normalizecss":          transformers.NormalizeCSS,
 	"preloadimage":          transformers.PreloadImage,
+	"pruneunusedcss":        transformers.PruneUnusedCSS,
+	"relativeurl":           transformers.RelativeURL,
 	"reorderhead":           transformers.ReorderHead,
+	"resourcehints":         transformers.ResourceHints,
 	"serversiderendering":   transformers.ServerSideRendering,
-	"stripjs":               transformers.StripJS,
+	"srcsetaspectratio":     transformers.SrcsetAspectRatio,
+	"stripcsscomments":      skippable(transformers.StripCSSComments),
+	"stripdisallowedcss":    skippable(transformers.StripDisallowedCSS),
+	"striphttpequiv":        transformers.StripHTTPEquiv,
+	"stripinlinestyles":     transformers.Subtrees(transformers.StripInlineStyles),
+	"stripjs":               transformers.Subtrees(transformers.StripJS),
 	"stripscriptcomments":   transformers.StripScriptComments,
+	"stripserviceworkers":   transformers.StripServiceWorkers,
+	"trackingpixels":        transformers.Subtrees(transformers.TrackingPixels),
 	"transformedidentifier": transformers.TransformedIdentifier,
 	"unusedextensions":      transformers.UnusedExtensions,
 	"urlrewrite":            transformers.URLRewrite,
+	"wrapperdivs":           transformers.Subtrees(transformers.WrapperDivs),
+	"xmlcleanup":            transformers.XMLCleanup,
 }
 
 // The map of config to the list of transformers, in the order in
-// which they should be executed.
+// which they should be executed. Those wrapped in transformers.Subtrees are
+// safe to run on the children of <body> concurrently, and those wrapped in
+// skippable are safe to skip when they fail, per Context.BestEffort.
 var configMap = map[rpb.Request_TransformersConfig][]func(*transformers.Context) error{
 	rpb.Request_DEFAULT: {
-		// NodeCleanup should be first.
+		// XMLCleanup must run before NodeCleanup, which strips the comment
+		// nodes it inspects.
+		transformers.XMLCleanup,
+		// NodeCleanup should be first, after XMLCleanup.
 		transformers.NodeCleanup,
-		transformers.StripJS,
+		// AMPFormat must run before the transformers that depend on the
+		// document's format, e.g. StripServiceWorkers and AMPBoilerplate.
+		transformers.AMPFormat,
+		// InlineSVGUse must run before StripJS, which sanitizes the
+		// inlined markup.
+		transformers.InlineSVGUse,
+		// StripServiceWorkers must run before StripJS, which would
+		// otherwise remove the registration scripts without a warning.
+		transformers.StripServiceWorkers,
+		transformers.Subtrees(transformers.StripJS),
+		transformers.StripHTTPEquiv,
 		transformers.StripScriptComments,
+		// StripDisallowedCSS must run before StripCSSComments, so that
+		// the size limit it checks reflects the removals, and before
+		// URLRewrite, which would otherwise rewrite the removed imports.
+		skippable(transformers.StripDisallowedCSS),
+		// AMPKeyframes must run before StripCSSComments and
+		// DedupeFontFaces, so that the size limit they check excludes the
+		// rules it moves.
+		transformers.AMPKeyframes,
+		skippable(transformers.StripCSSComments),
+		skippable(transformers.DedupeFontFaces),
+		transformers.NormalizeCSS,
+		// StripInlineStyles must run before ServerSideRendering, so that it
+		// only strips authored styles.
+		transformers.Subtrees(transformers.StripInlineStyles),
+		transformers.InjectTitle,
+		transformers.Subtrees(transformers.CollapseWhitespace),
+		transformers.Subtrees(transformers.ClassTokens),
+		transformers.Subtrees(transformers.EmptyTables),
+		// WrapperDivs must run after EmptyTables, which may leave wrappers
+		// with a single child.
+		transformers.Subtrees(transformers.WrapperDivs),
 		transformers.LinkTag,
 		transformers.AbsoluteURL,
 		transformers.AMPBoilerplate,
 		transformers.UnusedExtensions,
+		// TrackingPixels must run before ImgToAMPImg, so that tracking
+		// <img>s become <amp-pixel>s rather than <amp-img>s.
+		transformers.Subtrees(transformers.TrackingPixels),
+		// ImgToAMPImg must run before AMPImgLayout and
+		// ServerSideRendering, which process the <amp-img>s it creates.
+		transformers.ImgToAMPImg,
+		// ExtractDataURIImages must run after ImgToAMPImg, so that it
+		// extracts from the <amp-img>s it creates, and before URLRewrite.
+		transformers.ExtractDataURIImages,
+		// MediaAttributes must run before ServerSideRendering, which lays
+		// out the elements it fills.
+		skippable(transformers.MediaAttributes),
+		// ComponentStructure must run before ServerSideRendering, which
+		// lays out the elements it repairs.
+		transformers.ComponentStructure,
+		skippable(transformers.AMPGeoGroups),
+		transformers.MergeAnalytics,
+		// AMPImgLayout must run before ServerSideRendering, which applies
+		// the layout it sets.
+		transformers.Subtrees(transformers.AMPImgLayout),
 		transformers.ServerSideRendering,
 		transformers.AMPRuntimeCSS,
 		transformers.TransformedIdentifier,
+		// PruneUnusedCSS must run after the transformers that remove
+		// elements, and before URLRewrite, so that pruned rules' URLs
+		// aren't preconnected.
+		transformers.PruneUnusedCSS,
+		// SrcsetAspectRatio must run before URLRewrite, so that ImageSizer
+		// sees the original image URLs.
+		transformers.SrcsetAspectRatio,
 		transformers.URLRewrite,
+		// ResourceHints must run after URLRewrite, so that it hints the
+		// rewritten origins and skips those URLRewrite already hinted.
+		transformers.ResourceHints,
 		transformers.PreloadImage,
+		// RelativeURL must run after the transformers that resolve or
+		// inspect URLs (e.g. AbsoluteURL and URLRewrite).
+		transformers.RelativeURL,
 		// ReorderHead should run after all transformers that modify the
 		// <head>, as they may do so without preserving the proper order.
 		transformers.ReorderHead,
@@ -91,14 +189,55 @@ var configMap = map[rpb.Request_TransformersConfig][]func(*transformers.Context)
 const maxPreloads = 20
 
 
+// TransformerErrors is returned by ProcessWithContext when
+// Context.BestEffort is true and any skippable transformers failed. It lists
+// their errors, in the order the transformers ran.
+type TransformerErrors []error
+
+func (this TransformerErrors) Error() string {
+	messages := make([]string, len(this))
+	for i, err := range this {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d transformers failed: %s", len(this), strings.Join(messages, "; "))
+}
+
+// skippedError is returned by the transformers wrapped in skippable.
+type skippedError struct {
+	error
+}
+
+// skippable wraps the transformer fn, which leaves the DOM consistent for the
+// transformers that follow it even when it fails (e.g. by failing before it
+// modifies the DOM), so that Context.BestEffort may run them regardless.
+func skippable(fn func(*transformers.Context) error) func(*transformers.Context) error {
+	return func(c *transformers.Context) error {
+		if err := fn(c); err != nil {
+			return skippedError{err}
+		}
+		return nil
+	}
+}
+
 // Override for tests.
 var runTransformers = func(c *transformers.Context, fns []func(*transformers.Context) error) error {
+	var errs TransformerErrors
 	// Invoke the configured transformers
 	for _, f := range fns {
 		if err := f(c); err != nil {
-			return errors.WithStack(err)
+			skipped, ok := err.(skippedError)
+			if !ok {
+				return errors.WithStack(err)
+			}
+			if !c.BestEffort {
+				return errors.WithStack(skipped.error)
+			}
+			errs = append(errs, errors.WithStack(skipped.error))
 		}
 	}
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
 
@@ -314,6 +453,101 @@ func computeMaxAgeSeconds(dom *amphtml.DOM) int32 {
 	return maxAge
 }
 
+// ValidateOptions returns an error if o, which may be nil, contains invalid
+// values, so that callers can reject them before making requests.
+func ValidateOptions(o *rpb.Request_Options) error {
+	if o == nil {
+		return nil
+	}
+	for name, v := range map[string]int32{
+		"amp_keyframes_threshold": o.AmpKeyframesThreshold,
+		"max_preconnects":         o.MaxPreconnects,
+		"max_resource_hints":      o.MaxResourceHints,
+		"max_subtree_concurrency": o.MaxSubtreeConcurrency,
+	} {
+		if v < 0 {
+			return errors.Errorf("option %s must not be negative: %d", name, v)
+		}
+	}
+	if _, err := regexp.Compile(o.CssCommentKeepPattern); err != nil {
+		return errors.Wrap(err, "parsing option css_comment_keep_pattern")
+	}
+	return nil
+}
+
+// applyOptions sets the fields of c corresponding to those set in o, which may
+// be nil. Those unset in o are left as they are, so that callers of
+// ProcessWithContext may set them directly instead.
+func applyOptions(c *transformers.Context, o *rpb.Request_Options) error {
+	if o == nil {
+		return nil
+	}
+	if err := ValidateOptions(o); err != nil {
+		return err
+	}
+	setBool := func(field *bool, v bool) {
+		if v {
+			*field = true
+		}
+	}
+	setInt := func(field *int, v int32) {
+		if v > 0 {
+			*field = int(v)
+		}
+	}
+	setStrings := func(field *[]string, v []string) {
+		if len(v) > 0 {
+			*field = v
+		}
+	}
+	if o.CssCommentKeepPattern != "" {
+		c.CSSCommentKeepPattern = regexp.MustCompile(o.CssCommentKeepPattern)
+	}
+	if len(o.AmpFormatPrecedence) > 0 {
+		c.AMPFormatPrecedence = o.AmpFormatPrecedence
+	}
+	if o.DefaultTitle != "" {
+		c.DefaultTitle = o.DefaultTitle
+	}
+	setBool(&c.StripCSSComments, o.StripCssComments)
+	setBool(&c.DedupeFontFaces, o.DedupeFontFaces)
+	setBool(&c.MoveAMPKeyframes, o.MoveAmpKeyframes)
+	setInt(&c.AMPKeyframesThreshold, o.AmpKeyframesThreshold)
+	setBool(&c.PruneUnusedExtensions, o.PruneUnusedExtensions)
+	setBool(&c.RelativeSameOriginURLs, o.RelativeSameOriginUrls)
+	setBool(&c.StripDisallowedCSS, o.StripDisallowedCss)
+	setBool(&c.ErrorOnDisallowedCSS, o.ErrorOnDisallowedCss)
+	setBool(&c.NormalizeCSS, o.NormalizeCss)
+	setBool(&c.ExplicitAMPImgLayout, o.ExplicitAmpImgLayout)
+	setStrings(&c.PreserveCommentPrefixes, o.PreserveCommentPrefixes)
+	setStrings(&c.PreserveNonceElements, o.PreserveNonceElements)
+	setInt(&c.MaxPreconnects, o.MaxPreconnects)
+	setBool(&c.ResourceHints, o.ResourceHints)
+	setInt(&c.MaxResourceHints, o.MaxResourceHints)
+	setStrings(&c.DisallowedInlineStyles, o.DisallowedInlineStyles)
+	setBool(&c.InjectTitle, o.InjectTitle)
+	setBool(&c.CollapseWhitespace, o.CollapseWhitespace)
+	setBool(&c.StripEmptyTables, o.StripEmptyTables)
+	setBool(&c.CollapseWrapperDivs, o.CollapseWrapperDivs)
+	setBool(&c.DedupeClasses, o.DedupeClasses)
+	setBool(&c.SortClasses, o.SortClasses)
+	setBool(&c.ConvertTrackingPixels, o.ConvertTrackingPixels)
+	setStrings(&c.TrackingPixelHosts, o.TrackingPixelHosts)
+	setBool(&c.ConvertImgToAMPImg, o.ConvertImgToAmpImg)
+	setBool(&c.EnforceMediaAttributes, o.EnforceMediaAttributes)
+	setBool(&c.EnforceComponentStructure, o.EnforceComponentStructure)
+	setBool(&c.EnforceAMPGeoGroups, o.EnforceAmpGeoGroups)
+	setBool(&c.ErrorOnInvalidAMPGeoGroups, o.ErrorOnInvalidAmpGeoGroups)
+	setBool(&c.MergeAMPAnalytics, o.MergeAmpAnalytics)
+	setBool(&c.PruneUnusedCSS, o.PruneUnusedCss)
+	setBool(&c.PruneDataAttributes, o.PruneDataAttributes)
+	setStrings(&c.PreserveAttributePrefixes, o.PreserveAttributePrefixes)
+	setBool(&c.ParallelSubtrees, o.ParallelSubtrees)
+	setInt(&c.MaxSubtreeConcurrency, o.MaxSubtreeConcurrency)
+	setBool(&c.BestEffort, o.BestEffort)
+	return nil
+}
+
 // Process will parse the given request, which contains the HTML to
 // transform, applying the requested list of transformers, and return the
 // transformed HTML and list of resources to preload (absolute URLs), or an
@@ -321,8 +555,29 @@ func computeMaxAgeSeconds(dom *amphtml.DOM) int32 {
 //
 // If the requested list of transformers is empty, apply the default.
 func Process(r *rpb.Request) (string, *rpb.Metadata, error) {
-	context := &transformers.Context{}
+	return ProcessWithContext(r, &transformers.Context{})
+}
+
+// ProcessWithWarnings is like Process, but also returns the warnings reported
+// by the transformers, describing non-fatal problems found, and lossy changes
+// made (e.g. removing a duplicate <title>).
+func ProcessWithWarnings(r *rpb.Request) (string, *rpb.Metadata, []transformers.Warning, error) {
+	context := transformers.Context{}
+	html, metadata, err := ProcessWithContext(r, &context)
+	return html, metadata, context.Warnings, err
+}
 
+// ProcessWithContext is like Process, but runs the transformers with the
+// given context, so that callers may set the options it contains (such as
+// SVGResolver). The DOM and URL fields of the context are populated from r,
+// as are the options set in r.Options, overriding those of the context.
+//
+// If context.BestEffort is true, a failing transformer that is safe to skip
+// (e.g. StripDisallowedCSS) doesn't stop the rest from running; instead, the
+// partially transformed document and metadata are returned, along with a
+// TransformerErrors. Any other failing transformer still aborts the
+// transformation.
+func ProcessWithContext(r *rpb.Request, context *transformers.Context) (string, *rpb.Metadata, error) {
 	if err := validateUTF8ForHTML(r.Html); err != nil {
 		return "", nil, err
 	}
@@ -361,21 +616,34 @@ func Process(r *rpb.Request) (string, *rpb.Metadata, error) {
 		context.Version = version
 	}
 
+	if err := applyOptions(context, r.Options); err != nil {
+		return "", nil, err
+	}
+
 	// This must run AFTER DocumentURL is parsed.
 	setBaseURL(context)
 
+	var transformerErrs error
 	if err := runTransformers(context, fns); err != nil {
-		return "", nil, err
+		if _, ok := err.(TransformerErrors); !ok {
+			return "", nil, err
+		}
+		transformerErrs = err
 	}
 	// extractPreloads is an implicit transformer, and must run before printer.
 	preloads := extractPreloads(context.DOM)
 	var o strings.Builder
-	if err := printer.Print(&o, context.DOM.RootNode); err != nil {
+	if len(context.PreserveCommentPrefixes) > 0 {
+		err = printer.PrintPreservingComments(&o, context.DOM.RootNode, context.PreservesComment)
+	} else {
+		err = printer.Print(&o, context.DOM.RootNode)
+	}
+	if err != nil {
 		return "", nil, err
 	}
 	metadata := rpb.Metadata{
 		Preloads:   preloads,
 		MaxAgeSecs: computeMaxAgeSeconds(context.DOM),
 	}
-	return o.String(), &metadata, nil
+	return o.String(), &metadata, transformerErrs
 }
@@ -28,7 +28,7 @@ func TestProcess(t *testing.T) {
 		config      rpb.Request_TransformersConfig
 		expectedLen int
 	}{
-		{rpb.Request_DEFAULT, 13},
+		{rpb.Request_DEFAULT, 41},
 		{rpb.Request_NONE, 0},
 		{rpb.Request_VALIDATION, 1},
 		{rpb.Request_CUSTOM, 0},
@@ -318,6 +318,79 @@ func TestCustom(t *testing.T) {
 	}
 }
 
+func TestPreserveCommentPrefixes(t *testing.T) {
+	r := rpb.Request{Html: "<html ⚡><body><!--googleoff: all--><p>a<!-- b --></p></body></html>", Config: rpb.Request_CUSTOM, Transformers: []string{"nodecleanup"}}
+	html, _, err := ProcessWithContext(&r, &transformers.Context{PreserveCommentPrefixes: []string{"googleoff"}})
+	if err != nil {
+		t.Fatalf("unexpected failure %v", err)
+	}
+	if want := "<html ⚡><head></head><body><!--googleoff: all--><p>a</p></body></html>"; html != want {
+		t.Errorf("ProcessWithContext()=%q, want %q", html, want)
+	}
+}
+
+func TestBestEffort(t *testing.T) {
+	transformerFunctionMap["testerror"] = skippable(func(*transformers.Context) error { return errors.New("test error") })
+	defer delete(transformerFunctionMap, "testerror")
+	transformerFunctionMap["testfatal"] = func(*transformers.Context) error { return errors.New("test fatal") }
+	defer delete(transformerFunctionMap, "testfatal")
+
+	for _, tc := range []struct {
+		desc               string
+		bestEffort         bool
+		options            *rpb.Request_Options
+		transformers       []string
+		expectedError      string
+		expectedHTML       string
+		expectedErrorCount int
+	}{
+		// The first error aborts the transformation.
+		{"fail fast", false, nil, []string{"testerror", "nodecleanup", "testerror"}, "test error", "", 0},
+		// The remaining transformers still run, and each error is returned.
+		{"best effort", true, nil, []string{"testerror", "nodecleanup", "testerror"}, "test error", "<html ⚡><head></head><body><p>a</p></body></html>", 2},
+		{"best effort from request", false, &rpb.Request_Options{BestEffort: true}, []string{"testerror", "nodecleanup", "testerror"}, "test error", "<html ⚡><head></head><body><p>a</p></body></html>", 2},
+		// A transformer that isn't safe to skip still aborts it.
+		{"best effort stops on unskippable", true, nil, []string{"testerror", "testfatal", "nodecleanup"}, "test fatal", "", 0},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			r := rpb.Request{Html: "<html ⚡><body><p>a<!-- b --></p></body></html>", Config: rpb.Request_CUSTOM, Transformers: tc.transformers, Options: tc.options}
+			html, metadata, err := ProcessWithContext(&r, &transformers.Context{BestEffort: tc.bestEffort})
+			if err == nil {
+				t.Fatal("ProcessWithContext() unexpectedly succeeded")
+			}
+			if !strings.Contains(err.Error(), tc.expectedError) {
+				t.Errorf("ProcessWithContext() error=%q, want one containing %q", err, tc.expectedError)
+			}
+			if html != tc.expectedHTML {
+				t.Errorf("ProcessWithContext()=%q, want %q", html, tc.expectedHTML)
+			}
+			partial := tc.expectedErrorCount > 0
+			if (metadata != nil) != partial {
+				t.Errorf("ProcessWithContext() metadata=%v, want present=%t", metadata, partial)
+			}
+			errs, ok := err.(TransformerErrors)
+			if ok != partial || len(errs) != tc.expectedErrorCount {
+				t.Errorf("ProcessWithContext() error=%#v, want %d TransformerErrors", err, tc.expectedErrorCount)
+			}
+		})
+	}
+}
+
+func TestProcessWithWarnings(t *testing.T) {
+	r := rpb.Request{Html: "<html ⚡><head><title>a</title><title>b</title></head><body></body></html>", Config: rpb.Request_CUSTOM, Transformers: []string{"nodecleanup"}}
+	html, _, warnings, err := ProcessWithWarnings(&r)
+	if err != nil {
+		t.Fatalf("unexpected failure %v", err)
+	}
+	if want := "<html ⚡><head><title>a</title></head><body></body></html>"; html != want {
+		t.Errorf("ProcessWithWarnings()=%q, want %q", html, want)
+	}
+	want := []transformers.Warning{{Code: transformers.WarningDuplicateTitle, Message: "removed extra <title> in <head>", Location: "html > head > title:nth-child(2)"}}
+	if diff := cmp.Diff(want, warnings); diff != "" {
+		t.Errorf("ProcessWithWarnings() warnings differ (-want +got):\n%s", diff)
+	}
+}
+
 func TestCustomFail(t *testing.T) {
 	r := &rpb.Request{Html: "<html ⚡><lemur>", Config: rpb.Request_CUSTOM, Transformers: []string{"does_not_exist"}}
 	if html, _, err := Process(r); err == nil {
@@ -507,3 +580,175 @@ func TestBaseURL(t *testing.T) {
 		})
 	}
 }
+
+func TestBaseURLResolution(t *testing.T) {
+	docURL := "http://example.com/a/page.html"
+	tcs := []struct {
+		desc, base, expectedHead, expectedSrc string
+	}{
+		{
+			"no base",
+			"",
+			"<head></head>",
+			"http://example.com/a/img.png",
+		},
+		{
+			"absolute",
+			"<base href=https://cdn.example.com/assets/>",
+			"<head></head>",
+			"https://cdn.example.com/assets/img.png",
+		},
+		{
+			"relative",
+			"<base href=../b/>",
+			"<head></head>",
+			"http://example.com/b/img.png",
+		},
+		{
+			"with target",
+			"<base href=https://cdn.example.com/assets/ target=_top>",
+			"<head><base target=_top></head>",
+			"https://cdn.example.com/assets/img.png",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			r := rpb.Request{Html: "<html amp><head>" + tc.base + "</head><body><amp-img src=img.png></amp-img></body></html>", DocumentUrl: docURL, Config: rpb.Request_CUSTOM, Transformers: []string{"absoluteurl"}}
+			html, _, err := Process(&r)
+			if err != nil {
+				t.Fatalf("unexpected failure %v", err)
+			}
+			// The <base href> is removed, having been resolved.
+			if !strings.Contains(html, tc.expectedHead) {
+				t.Errorf("Process()=%s, want head %s", html, tc.expectedHead)
+			}
+			if expected := "<amp-img src=" + tc.expectedSrc + ">"; !strings.Contains(html, expected) {
+				t.Errorf("Process()=%s, want %s", html, expected)
+			}
+		})
+	}
+}
+
+func TestParallelSubtrees(t *testing.T) {
+	// A large document, with content for each of the transformers marked
+	// safe to parallelize.
+	var body strings.Builder
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&body, "\n  <div><div class=\"b a b\" style=\"color:red;behavior:url(x.htc)\" onclick=\"f()\">"+
+			"<p>  section   %d  </p><table><tbody></tbody></table>"+
+			"<img src=https://pixel.example/p.gif width=1 height=1><amp-img src=/%d.jpg width=10 height=10></amp-img>"+
+			"<script>f()</script></div></div>\n  text %d <span class=\"c c\">x</span>", i, i, i)
+	}
+	r := rpb.Request{Html: "<html ⚡><head><meta charset=utf-8></head><body class=\"x x\" onload=\"f()\">" + body.String() + "</body></html>", DocumentUrl: "https://example.com/", Config: rpb.Request_DEFAULT}
+	newContext := func() *transformers.Context {
+		return &transformers.Context{
+			DisallowedInlineStyles: []string{"behavior"},
+			CollapseWhitespace:     true,
+			DedupeClasses:          true,
+			SortClasses:            true,
+			StripEmptyTables:       true,
+			CollapseWrapperDivs:    true,
+			ConvertTrackingPixels:  true,
+			ExplicitAMPImgLayout:   true,
+		}
+	}
+
+	serialContext := newContext()
+	serialHTML, serialMetadata, err := ProcessWithContext(&r, serialContext)
+	if err != nil {
+		t.Fatalf("unexpected failure %v", err)
+	}
+	for _, concurrency := range []int{0, 1, 7} {
+		parallelContext := newContext()
+		parallelContext.ParallelSubtrees = true
+		parallelContext.MaxSubtreeConcurrency = concurrency
+		parallelHTML, parallelMetadata, err := ProcessWithContext(&r, parallelContext)
+		if err != nil {
+			t.Fatalf("concurrency %d: unexpected failure %v", concurrency, err)
+		}
+		if serialHTML != parallelHTML {
+			t.Errorf("concurrency %d: parallel output differs from serial:\n%s", concurrency, diff.Diff(serialHTML, parallelHTML))
+		}
+		if !proto.Equal(serialMetadata, parallelMetadata) {
+			t.Errorf("concurrency %d: parallel metadata %v differs from serial %v", concurrency, parallelMetadata, serialMetadata)
+		}
+		if d := cmp.Diff(serialContext.Warnings, parallelContext.Warnings); d != "" {
+			t.Errorf("concurrency %d: parallel warnings differ from serial (-serial +parallel):\n%s", concurrency, d)
+		}
+	}
+	// Sanity check that the transformers ran.
+	for _, unwanted := range []string{"onclick", "behavior", "<tbody>", "b a b", "<script>f()", "pixel.example/p.gif width"} {
+		if strings.Contains(serialHTML, unwanted) {
+			t.Errorf("output unexpectedly contains %q", unwanted)
+		}
+	}
+}
+
+func TestRequestOptions(t *testing.T) {
+	html := "<html ⚡><head><meta charset=utf-8><style amp-custom>/* a */ p{color:red}</style></head><body><div><div><p class=\"b a b\">  x  </p></div></div></body></html>"
+	r := rpb.Request{Html: html, DocumentUrl: "https://example.com/", Options: &rpb.Request_Options{
+		StripCssComments:      true,
+		CollapseWhitespace:    true,
+		CollapseWrapperDivs:   true,
+		DedupeClasses:         true,
+		SortClasses:           true,
+		ParallelSubtrees:      true,
+		MaxSubtreeConcurrency: 2,
+	}}
+	context := transformers.Context{}
+	got, _, err := ProcessWithContext(&r, &context)
+	if err != nil {
+		t.Fatalf("unexpected failure %v", err)
+	}
+	if !context.ParallelSubtrees || context.MaxSubtreeConcurrency != 2 {
+		t.Errorf("ParallelSubtrees=%t, MaxSubtreeConcurrency=%d, want true, 2", context.ParallelSubtrees, context.MaxSubtreeConcurrency)
+	}
+	want, _, err := ProcessWithContext(&rpb.Request{Html: html, DocumentUrl: "https://example.com/"}, &transformers.Context{
+		StripCSSComments:    true,
+		CollapseWhitespace:  true,
+		CollapseWrapperDivs: true,
+		DedupeClasses:       true,
+		SortClasses:         true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected failure %v", err)
+	}
+	if got != want {
+		t.Errorf("with options, Process()=\n%s\nwant=\n%s", got, want)
+	}
+	for _, unwanted := range []string{"/* a */", "b a b", "  x  "} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("Process()=%s, unexpectedly contains %q", got, unwanted)
+		}
+	}
+
+	// An opt-in transformer named by the CUSTOM config runs with the options.
+	r = rpb.Request{Html: html, Config: rpb.Request_CUSTOM, Transformers: []string{"stripcsscomments"}, Options: &rpb.Request_Options{StripCssComments: true}}
+	if got, _, err := Process(&r); err != nil {
+		t.Errorf("CUSTOM: unexpected failure %v", err)
+	} else if strings.Contains(got, "/* a */") {
+		t.Errorf("CUSTOM: Process()=%s, want comment stripped", got)
+	}
+}
+
+func TestRequestOptionsInvalid(t *testing.T) {
+	tcs := []struct {
+		desc    string
+		options *rpb.Request_Options
+	}{
+		{"negative concurrency", &rpb.Request_Options{ParallelSubtrees: true, MaxSubtreeConcurrency: -1}},
+		{"negative threshold", &rpb.Request_Options{AmpKeyframesThreshold: -1}},
+		{"bad pattern", &rpb.Request_Options{CssCommentKeepPattern: "("}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			if err := ValidateOptions(tc.options); err == nil {
+				t.Error("ValidateOptions() unexpectedly succeeded")
+			}
+			r := rpb.Request{Html: "<html ⚡><head></head><body></body></html>", Options: tc.options}
+			if _, _, err := Process(&r); err == nil {
+				t.Error("Process() unexpectedly succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"strings"
+
+	rpb "github.com/ampproject/amppackager/transformer/request"
+	"github.com/pkg/errors"
+)
+
+// ampFormatAttributes maps the <html> attributes declaring an AMP format to
+// that format. ⚡ is \u26a1.
+var ampFormatAttributes = map[string]rpb.Request_HtmlFormat{
+	"amp":       rpb.Request_AMP,
+	"⚡":         rpb.Request_AMP,
+	"amp4ads":   rpb.Request_AMP4ADS,
+	"⚡4ads":     rpb.Request_AMP4ADS,
+	"amp4email": rpb.Request_AMP4EMAIL,
+	"⚡4email":   rpb.Request_AMP4EMAIL,
+}
+
+// AMPFormat resolves conflicting AMP format attributes on <html>, keeping
+// exactly one: the first attribute declaring the format that comes first in
+// Context.AMPFormatPrecedence, among those allowed by the request.
+//
+// <html ⚡ amp4ads>
+//            transforms to
+// <html amp4ads>
+//
+// given a precedence of AMP4ADS before AMP. Redundant attributes declaring the
+// same format (e.g. both amp and ⚡) are removed too. Each removal is reported
+// in Context.Warnings. It returns an error if none of the declared formats is
+// in the precedence.
+//
+// This is opt-in; it does nothing unless Context.AMPFormatPrecedence is
+// non-empty.
+func AMPFormat(e *Context) error {
+	if len(e.AMPFormatPrecedence) == 0 {
+		return nil
+	}
+	n := e.DOM.HTMLNode
+	declared := map[rpb.Request_HtmlFormat]string{}
+	var keys []string
+	for _, a := range n.Attr {
+		if format, ok := ampFormatAttributes[a.Key]; ok && a.Namespace == "" {
+			if _, ok := declared[format]; !ok {
+				declared[format] = a.Key
+			}
+			keys = append(keys, a.Key)
+		}
+	}
+	if len(keys) <= 1 {
+		return nil
+	}
+	keep := ""
+	for _, format := range e.AMPFormatPrecedence {
+		if key, ok := declared[format]; ok && isFormatAllowed(e, format) {
+			keep = key
+			break
+		}
+	}
+	if keep == "" {
+		return errors.Errorf("<html> has conflicting AMP format attributes (%s), none of which is in the precedence and allowed by the request", strings.Join(keys, ", "))
+	}
+	attrs := n.Attr[:0]
+	kept := false
+	for _, a := range n.Attr {
+		if _, ok := ampFormatAttributes[a.Key]; ok && a.Namespace == "" {
+			if a.Key != keep || kept {
+				e.Warn(WarningConflictingFormats, n, "removed AMP format attribute %s, in favor of %s", a.Key, keep)
+				continue
+			}
+			kept = true
+		}
+		attrs = append(attrs, a)
+	}
+	n.Attr = attrs
+	return nil
+}
+
+// isFormatAllowed returns true if the request allows the given format. If the
+// request doesn't restrict the formats, all are allowed.
+func isFormatAllowed(e *Context, format rpb.Request_HtmlFormat) bool {
+	if e.Request == nil || len(e.Request.AllowedFormats) == 0 {
+		return true
+	}
+	for _, allowed := range e.Request.AllowedFormats {
+		if allowed == format {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	rpb "github.com/ampproject/amppackager/transformer/request"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+func TestAMPFormat(t *testing.T) {
+	adsFirst := []rpb.Request_HtmlFormat{rpb.Request_AMP4ADS, rpb.Request_AMP4EMAIL, rpb.Request_AMP}
+	ampFirst := []rpb.Request_HtmlFormat{rpb.Request_AMP, rpb.Request_AMP4ADS, rpb.Request_AMP4EMAIL}
+	tcs := []struct {
+		desc, input, expected string
+		precedence            []rpb.Request_HtmlFormat
+		allowed               []rpb.Request_HtmlFormat
+		warnings              int
+	}{
+		{
+			desc:       "Keeps ads over AMP",
+			input:      `<html ⚡ amp4ads lang="en">`,
+			expected:   `<html amp4ads="" lang="en">`,
+			precedence: adsFirst,
+			warnings:   1,
+		},
+		{
+			desc:       "Keeps AMP over ads",
+			input:      `<html ⚡ amp4ads lang="en">`,
+			expected:   `<html ⚡="" lang="en">`,
+			precedence: ampFirst,
+			warnings:   1,
+		},
+		{
+			desc:       "Removes redundant attributes of the same format",
+			input:      `<html amp ⚡4ads ⚡>`,
+			expected:   `<html amp="">`,
+			precedence: ampFirst,
+			warnings:   2,
+		},
+		{
+			desc:       "Skips formats the request disallows",
+			input:      `<html ⚡ amp4ads>`,
+			expected:   `<html ⚡="">`,
+			precedence: adsFirst,
+			allowed:    []rpb.Request_HtmlFormat{rpb.Request_AMP},
+			warnings:   1,
+		},
+		{
+			desc:       "Leaves a single attribute alone",
+			input:      `<html ⚡4email>`,
+			expected:   `<html ⚡4email="">`,
+			precedence: ampFirst,
+		},
+		{
+			desc:     "Disabled",
+			input:    `<html ⚡ amp4ads>`,
+			expected: `<html ⚡="" amp4ads="">`,
+		},
+	}
+	for _, tc := range tcs {
+		inputDoc, err := html.Parse(strings.NewReader(tc.input + "<head></head><body></body></html>"))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, tc.input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, tc.input, err)
+			continue
+		}
+		context := transformers.Context{DOM: inputDOM, AMPFormatPrecedence: tc.precedence, Request: &rpb.Request{AllowedFormats: tc.allowed}}
+		if err := transformers.AMPFormat(&context); err != nil {
+			t.Errorf("%s: AMPFormat() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, tc.input, err)
+			continue
+		}
+		if expected := tc.expected + "<head></head><body></body></html>"; output.String() != expected {
+			t.Errorf("%s: AMPFormat()=\n%q\nwant=\n%q", tc.desc, &output, expected)
+		}
+		if len(context.Warnings) != tc.warnings {
+			t.Errorf("%s: Warnings=%v, want %d", tc.desc, context.Warnings, tc.warnings)
+		}
+	}
+}
+
+func TestAMPFormatErrors(t *testing.T) {
+	inputDoc, err := html.Parse(strings.NewReader(`<html amp4ads amp4email><head></head><body></body></html>`))
+	if err != nil {
+		t.Fatalf("html.Parse failed %q", err)
+	}
+	inputDOM, err := amphtml.NewDOM(inputDoc)
+	if err != nil {
+		t.Fatalf("amphtml.NewDOM failed %q", err)
+	}
+	context := transformers.Context{DOM: inputDOM, AMPFormatPrecedence: []rpb.Request_HtmlFormat{rpb.Request_AMP}}
+	err = transformers.AMPFormat(&context)
+	expectedError := "<html> has conflicting AMP format attributes (amp4ads, amp4email), none of which is in the precedence and allowed by the request"
+	if err == nil || err.Error() != expectedError {
+		t.Errorf("AMPFormat()=%v, want %q", err, expectedError)
+	}
+}
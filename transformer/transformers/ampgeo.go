@@ -0,0 +1,192 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// isoCountryCodes are the officially assigned ISO 3166-1 alpha-2 codes, in
+// the lowercase form amp-geo matches against.
+var isoCountryCodes = func() map[string]bool {
+	codes := map[string]bool{}
+	for _, code := range strings.Fields(`
+		ad ae af ag ai al am ao aq ar as at au aw ax az
+		ba bb bd be bf bg bh bi bj bl bm bn bo bq br bs bt bv bw by bz
+		ca cc cd cf cg ch ci ck cl cm cn co cr cu cv cw cx cy cz
+		de dj dk dm do dz ec ee eg eh er es et fi fj fk fm fo fr
+		ga gb gd ge gf gg gh gi gl gm gn gp gq gr gs gt gu gw gy
+		hk hm hn hr ht hu id ie il im in io iq ir is it je jm jo jp
+		ke kg kh ki km kn kp kr kw ky kz la lb lc li lk lr ls lt lu lv ly
+		ma mc md me mf mg mh mk ml mm mn mo mp mq mr ms mt mu mv mw mx my mz
+		na nc ne nf ng ni nl no np nr nu nz om
+		pa pe pf pg ph pk pl pm pn pr ps pt pw py qa re ro rs ru rw
+		sa sb sc sd se sg sh si sj sk sl sm sn so sr ss st sv sx sy sz
+		tc td tf tg th tj tk tl tm tn to tr tt tv tw tz ua ug um us uy uz
+		va vc ve vg vi vn vu wf ws ye yt za zm zw`) {
+		codes[code] = true
+	}
+	return codes
+}()
+
+// ampGeoPresets are the predefined groups amp-geo expands, and "unknown",
+// which matches when the country can't be determined.
+var ampGeoPresets = map[string]bool{
+	"preset-eea":   true,
+	"preset-us-ca": true,
+	"unknown":      true,
+}
+
+// An ISO 3166-2 subdivision code, e.g. "us-ca", which amp-geo also matches.
+var ampGeoSubdivision = regexp.MustCompile(`^([a-z]{2})-[a-z0-9]{1,3}$`)
+
+// AMPGeoGroups checks the ISOCountryGroups of each <amp-geo> config, so that
+// mistyped country codes don't silently fail to match. Each group must be an
+// array of ISO 3166-1 alpha-2 country codes (or ISO 3166-2 subdivision codes
+// of them), presets, or "unknown". Codes in uppercase are lowercased, as
+// amp-geo matches only lowercase; other invalid codes are removed, as are
+// groups that aren't arrays of strings. Each change is reported in
+// Context.Warnings. Configs that aren't valid JSON are left unmodified, as
+// are those without ISOCountryGroups.
+//
+// <amp-geo layout=nodisplay><script type=application/json>{"ISOCountryGroups":{"eu":["DE","fr","xx"]}}</script></amp-geo>
+//
+//	transforms to
+//
+// <amp-geo layout=nodisplay><script type=application/json>{"ISOCountryGroups":{"eu":["de","fr"]}}</script></amp-geo>
+//
+// This is opt-in; it does nothing unless Context.EnforceAMPGeoGroups is true.
+// If Context.ErrorOnInvalidAMPGeoGroups is true, it instead returns an error
+// listing the problems.
+func AMPGeoGroups(e *Context) error {
+	if !e.EnforceAMPGeoGroups {
+		return nil
+	}
+	for n := e.DOM.BodyNode; n != nil; n = htmlnode.Next(n) {
+		if n.Type != html.ElementNode || n.Data != "amp-geo" {
+			continue
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.DataAtom != atom.Script || c.FirstChild == nil || c.FirstChild.Type != html.TextNode {
+				continue
+			}
+			if v, _ := htmlnode.GetAttributeVal(c, "", "type"); strings.ToLower(v) != "application/json" {
+				continue
+			}
+			config, problems, ok := fixAMPGeoConfig(c.FirstChild.Data)
+			if !ok || len(problems) == 0 {
+				continue
+			}
+			if e.ErrorOnInvalidAMPGeoGroups {
+				return errors.Errorf("<amp-geo> at %s has invalid ISOCountryGroups: %s", nodeLocation(n), strings.Join(problems, ", "))
+			}
+			for _, problem := range problems {
+				e.Warn(WarningAMPGeoGroup, n, "%s", problem)
+			}
+			c.FirstChild.Data = config
+		}
+	}
+	return nil
+}
+
+// fixAMPGeoConfig returns the amp-geo JSON config with its ISOCountryGroups
+// fixed, and a description of each fix, or false if it couldn't be parsed.
+func fixAMPGeoConfig(config string) (string, []string, bool) {
+	var parsed map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(config), &parsed); err != nil {
+		return "", nil, false
+	}
+	rawGroups, ok := parsed["ISOCountryGroups"]
+	if !ok {
+		return "", nil, true
+	}
+	var groups map[string]json.RawMessage
+	if err := json.Unmarshal(rawGroups, &groups); err != nil {
+		return "", nil, false
+	}
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	for _, name := range names {
+		var codes []string
+		if err := json.Unmarshal(groups[name], &codes); err != nil {
+			problems = append(problems, fmt.Sprintf("removed group %q, which is not an array of strings", name))
+			delete(groups, name)
+			continue
+		}
+		valid := make([]string, 0, len(codes))
+		changed := false
+		for _, code := range codes {
+			lower := strings.ToLower(code)
+			if !isValidAMPGeoCode(lower) {
+				problems = append(problems, fmt.Sprintf("removed invalid country code %q from group %q", code, name))
+				changed = true
+				continue
+			}
+			if lower != code {
+				problems = append(problems, fmt.Sprintf("lowercased country code %q in group %q", code, name))
+				changed = true
+			}
+			valid = append(valid, lower)
+		}
+		if !changed {
+			continue
+		}
+		fixed, err := json.Marshal(valid)
+		if err != nil {
+			return "", nil, false
+		}
+		groups[name] = fixed
+	}
+	if len(problems) == 0 {
+		return "", nil, true
+	}
+	var err error
+	if parsed["ISOCountryGroups"], err = json.Marshal(groups); err != nil {
+		return "", nil, false
+	}
+	// json.Marshal escapes <, >, and &, so the config can't close its
+	// <script>.
+	fixed, err := json.Marshal(parsed)
+	if err != nil {
+		return "", nil, false
+	}
+	return string(fixed), problems, true
+}
+
+// isValidAMPGeoCode returns true if code, in lowercase, is one that amp-geo
+// may match.
+func isValidAMPGeoCode(code string) bool {
+	if ampGeoPresets[code] || isoCountryCodes[code] {
+		return true
+	}
+	if m := ampGeoSubdivision.FindStringSubmatch(code); m != nil {
+		return isoCountryCodes[m[1]]
+	}
+	return false
+}
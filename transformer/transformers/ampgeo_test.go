@@ -0,0 +1,132 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+func ampGeo(config string) string {
+	return `<amp-geo layout="nodisplay"><script type="application/json">` + config + `</script></amp-geo>`
+}
+
+func TestAMPGeoGroups(t *testing.T) {
+	tcs := []struct {
+		desc, input, expected string
+		expectedWarnings      int
+		errorOnInvalid        bool
+		expectedError         bool
+	}{
+		{
+			desc:     "valid groups",
+			input:    ampGeo(`{"ISOCountryGroups": {"eea": ["preset-eea", "unknown"], "us": ["us", "us-ca"]}}`),
+			expected: ampGeo(`{"ISOCountryGroups": {"eea": ["preset-eea", "unknown"], "us": ["us", "us-ca"]}}`),
+		},
+		{
+			desc:             "removes invalid country code",
+			input:            ampGeo(`{"AmpBind": true, "ISOCountryGroups": {"eu": ["de", "xx", "fr"]}}`),
+			expected:         ampGeo(`{"AmpBind":true,"ISOCountryGroups":{"eu":["de","fr"]}}`),
+			expectedWarnings: 1,
+		},
+		{
+			desc:             "lowercases country codes",
+			input:            ampGeo(`{"ISOCountryGroups": {"na": ["US", "ca"], "mx": ["mx"]}}`),
+			expected:         ampGeo(`{"ISOCountryGroups":{"mx":["mx"],"na":["us","ca"]}}`),
+			expectedWarnings: 1,
+		},
+		{
+			desc:             "removes invalid group",
+			input:            ampGeo(`{"ISOCountryGroups": {"bad": "us", "good": ["gb"]}}`),
+			expected:         ampGeo(`{"ISOCountryGroups":{"good":["gb"]}}`),
+			expectedWarnings: 1,
+		},
+		{
+			desc:     "leaves unparseable config alone",
+			input:    ampGeo(`{"ISOCountryGroups": {"eu": ["xx"]`),
+			expected: ampGeo(`{"ISOCountryGroups": {"eu": ["xx"]`),
+		},
+		{
+			desc:           "errors on invalid country code",
+			input:          ampGeo(`{"ISOCountryGroups": {"eu": ["de", "usa"]}}`),
+			errorOnInvalid: true,
+			expectedError:  true,
+		},
+	}
+	for _, tc := range tcs {
+		input := tt.Concat("<html><head></head><body>", tc.input, "</body></html>")
+		expected := tt.Concat("<html><head></head><body>", tc.expected, "</body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		context := transformers.Context{DOM: inputDOM, EnforceAMPGeoGroups: true, ErrorOnInvalidAMPGeoGroups: tc.errorOnInvalid}
+		err = transformers.AMPGeoGroups(&context)
+		if tc.expectedError {
+			if err == nil {
+				t.Errorf("%s: AMPGeoGroups() unexpectedly succeeded", tc.desc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: AMPGeoGroups() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if output.String() != expected {
+			t.Errorf("%s: Transform=\n%q\nwant=\n%q", tc.desc, output.String(), expected)
+		}
+		if len(context.Warnings) != tc.expectedWarnings {
+			t.Errorf("%s: got %d warnings, want %d: %v", tc.desc, len(context.Warnings), tc.expectedWarnings, context.Warnings)
+		}
+	}
+}
+
+func TestAMPGeoGroupsDisabled(t *testing.T) {
+	input := `<html><head></head><body>` + ampGeo(`{"ISOCountryGroups": {"eu": ["xx"]}}`) + `</body></html>`
+	inputDoc, err := html.Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("html.Parse for %s failed %q", input, err)
+	}
+	inputDOM, err := amphtml.NewDOM(inputDoc)
+	if err != nil {
+		t.Fatalf("amphtml.NewDOM for %s failed %q", input, err)
+	}
+	if err := transformers.AMPGeoGroups(&transformers.Context{DOM: inputDOM}); err != nil {
+		t.Fatalf("AMPGeoGroups() unexpectedly failed %q", err)
+	}
+	var output strings.Builder
+	if err := html.Render(&output, inputDoc); err != nil {
+		t.Fatalf("html.Render for %s failed %q", input, err)
+	}
+	if output.String() != input {
+		t.Errorf("Transform=\n%q\nwant=\n%q", output.String(), input)
+	}
+}
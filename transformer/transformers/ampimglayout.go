@@ -0,0 +1,55 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"github.com/ampproject/amppackager/transformer/layout"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// AMPImgLayout makes the default layout of each <amp-img> explicit: if it has
+// no layout attribute, but has a width or height, the layout that the AMP
+// runtime would apply by default is set, e.g.
+//   <amp-img width=100 height=50>          -> layout=fixed
+//   <amp-img height=50>                    -> layout=fixed-height
+//   <amp-img width=100 height=50 sizes=..> -> layout=responsive
+// Elements whose default layout is unsupported, or which are descendants of a
+// <template>, are left unmodified.
+//
+// This is opt-in; it does nothing unless Context.ExplicitAMPImgLayout is set.
+//
+// This must run before ServerSideRendering, which applies the layout.
+func AMPImgLayout(e *Context) error {
+	if !e.ExplicitAMPImgLayout {
+		return nil
+	}
+	for n := e.DOM.BodyNode; n != nil; n = htmlnode.Next(n) {
+		if n.Type != html.ElementNode || n.Data != "amp-img" {
+			continue
+		}
+		if htmlnode.HasAttributeAndIsNotEmpty(n, "", "layout") || htmlnode.IsDescendantOf(n, atom.Template) {
+			continue
+		}
+		if !htmlnode.HasAttribute(n, "", "width") && !htmlnode.HasAttribute(n, "", "height") {
+			continue
+		}
+		if l, err := layout.GetEffectiveLayout(n); err == nil {
+			htmlnode.SetAttribute(n, "", "layout", layout.GetLayoutName(l))
+		}
+	}
+	return nil
+}
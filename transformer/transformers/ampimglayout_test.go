@@ -0,0 +1,113 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+func TestAMPImgLayout(t *testing.T) {
+	tcs := []struct {
+		desc, input, expected string
+	}{
+		{
+			desc:     "width and height default to fixed",
+			input:    `<amp-img src="a.jpg" width="100" height="50"></amp-img>`,
+			expected: `<amp-img src="a.jpg" width="100" height="50" layout="fixed"></amp-img>`,
+		},
+		{
+			desc:     "width, height and sizes default to responsive",
+			input:    `<amp-img srcset="a.jpg 100w" sizes="100vw" width="100" height="50"></amp-img>`,
+			expected: `<amp-img srcset="a.jpg 100w" sizes="100vw" width="100" height="50" layout="responsive"></amp-img>`,
+		},
+		{
+			desc:     "height alone defaults to fixed-height",
+			input:    `<amp-img src="a.jpg" height="50"></amp-img>`,
+			expected: `<amp-img src="a.jpg" height="50" layout="fixed-height"></amp-img>`,
+		},
+		{
+			desc:     "auto width defaults to fixed-height",
+			input:    `<amp-img src="a.jpg" width="auto" height="50"></amp-img>`,
+			expected: `<amp-img src="a.jpg" width="auto" height="50" layout="fixed-height"></amp-img>`,
+		},
+		{
+			desc:     "empty layout is replaced",
+			input:    `<amp-img src="a.jpg" width="100" height="50" layout=""></amp-img>`,
+			expected: `<amp-img src="a.jpg" width="100" height="50" layout="fixed"></amp-img>`,
+		},
+		{
+			desc:     "explicit layout is kept",
+			input:    `<amp-img src="a.jpg" width="100" height="50" layout="intrinsic"></amp-img>`,
+			expected: `<amp-img src="a.jpg" width="100" height="50" layout="intrinsic"></amp-img>`,
+		},
+		{
+			desc:     "no dimensions",
+			input:    `<amp-img src="a.jpg"></amp-img>`,
+			expected: `<amp-img src="a.jpg"></amp-img>`,
+		},
+		{
+			desc:     "invalid dimensions",
+			input:    `<amp-img src="a.jpg" width="big" height="50"></amp-img>`,
+			expected: `<amp-img src="a.jpg" width="big" height="50"></amp-img>`,
+		},
+		{
+			desc:     "other elements",
+			input:    `<amp-video src="a.mp4" width="100" height="50"></amp-video>`,
+			expected: `<amp-video src="a.mp4" width="100" height="50"></amp-video>`,
+		},
+		{
+			desc:     "inside template",
+			input:    `<template><amp-img src="a.jpg" width="100" height="50"></amp-img></template>`,
+			expected: `<template><amp-img src="a.jpg" width="100" height="50"></amp-img></template>`,
+		},
+	}
+	for _, tc := range tcs {
+		for _, enabled := range []bool{true, false} {
+			input := tt.Concat("<html><head></head><body>", tc.input, "</body></html>")
+			expected := input
+			if enabled {
+				expected = tt.Concat("<html><head></head><body>", tc.expected, "</body></html>")
+			}
+			inputDoc, err := html.Parse(strings.NewReader(input))
+			if err != nil {
+				t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+				continue
+			}
+			inputDOM, err := amphtml.NewDOM(inputDoc)
+			if err != nil {
+				t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+				continue
+			}
+			if err := transformers.AMPImgLayout(&transformers.Context{DOM: inputDOM, ExplicitAMPImgLayout: enabled}); err != nil {
+				t.Errorf("%s: AMPImgLayout() unexpectedly failed %q", tc.desc, err)
+				continue
+			}
+			var output strings.Builder
+			if err := html.Render(&output, inputDoc); err != nil {
+				t.Errorf("%s: html.Render for %s failed %q", tc.desc, input, err)
+				continue
+			}
+			if output.String() != expected {
+				t.Errorf("%s (enabled=%t): Transform=\n%q\nwant=\n%q", tc.desc, enabled, output.String(), expected)
+			}
+		}
+	}
+}
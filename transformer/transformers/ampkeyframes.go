@@ -0,0 +1,158 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"strings"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	"github.com/ampproject/amppackager/transformer/internal/css"
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// maxAMPKeyframesStyleBytes is the maximum size of the <style amp-keyframes>
+// stylesheet, per
+// https://amp.dev/documentation/guides-and-tutorials/develop/style_and_layout/style_pages/.
+const maxAMPKeyframesStyleBytes = 500000
+
+// The default for Context.AMPKeyframesThreshold.
+const defaultAMPKeyframesThreshold = 1024
+
+// allowedAMPKeyframesProperties are the properties AMP allows the keyframes
+// of <style amp-keyframes> to animate, as they can be animated on the GPU.
+var allowedAMPKeyframesProperties = map[string]bool{
+	"animation-timing-function": true,
+	"offset-distance":           true,
+	"opacity":                   true,
+	"transform":                 true,
+	"visibility":                true,
+}
+
+// AMPKeyframes moves the large @keyframes rules of the <style amp-custom>
+// stylesheet into a <style amp-keyframes> at the end of <body>, where they
+// don't count against the amp-custom size limit, or delay the first render.
+// Only top-level rules (not those within @media or @supports) at least
+// Context.AMPKeyframesThreshold bytes long are moved, and only if they
+// animate just the properties AMP allows there (e.g. opacity and transform).
+//
+// It also normalizes the placement of any existing <style amp-keyframes>,
+// which AMP requires to be the last child of <body>, merging them if there
+// are several, and warning about each it moves.
+//
+// <head><style amp-custom>a{} @keyframes k{from{opacity:0}to{opacity:1}}</style></head><body><p></p></body>
+//
+//	transforms to (if the rule exceeds the threshold)
+//
+// <head><style amp-custom>a{} </style></head><body><p></p><style amp-keyframes>@keyframes k{from{opacity:0}to{opacity:1}}</style></body>
+//
+// This is opt-in; it does nothing unless Context.MoveAMPKeyframes is true.
+// It returns an error if the resulting <style amp-keyframes> exceeds the AMP
+// size limit. Stylesheets that cannot be tokenized are left unmodified.
+func AMPKeyframes(e *Context) error {
+	if !e.MoveAMPKeyframes {
+		return nil
+	}
+	threshold := e.AMPKeyframesThreshold
+	if threshold <= 0 {
+		threshold = defaultAMPKeyframesThreshold
+	}
+	extract := func(rule string, properties []string) bool {
+		if len(rule) < threshold {
+			return false
+		}
+		for _, property := range properties {
+			if !allowedAMPKeyframesProperties[property] {
+				return false
+			}
+		}
+		return true
+	}
+	var sheet strings.Builder
+	for c := e.DOM.HeadNode.FirstChild; c != nil; c = c.NextSibling {
+		if c.DataAtom != atom.Style || !htmlnode.HasAttribute(c, "", amphtml.AMPCustom) {
+			continue
+		}
+		for t := c.FirstChild; t != nil; t = t.NextSibling {
+			if t.Type != html.TextNode {
+				continue
+			}
+			kept, extracted, err := css.ExtractKeyframes(t.Data, extract)
+			if err != nil || extracted == "" {
+				continue
+			}
+			t.Data = kept
+			sheet.WriteString(extracted)
+		}
+	}
+
+	var existing []*html.Node
+	for n := e.DOM.RootNode; n != nil; n = htmlnode.Next(n) {
+		if n.DataAtom == atom.Style && htmlnode.HasAttribute(n, "", amphtml.AMPKeyframes) && !htmlnode.IsDescendantOf(n, atom.Template) {
+			existing = append(existing, n)
+		}
+	}
+	body := e.DOM.BodyNode
+	if sheet.Len() == 0 && (len(existing) == 0 || len(existing) == 1 && isLastElementChild(body, existing[0])) {
+		return nil
+	}
+	// The existing rules follow the moved ones, as they did in the
+	// document, so that they still take precedence over those of the same
+	// name.
+	for _, n := range existing {
+		if len(existing) > 1 || !isLastElementChild(body, n) {
+			e.Warn(WarningAMPKeyframes, n, "moved <style amp-keyframes> to the end of <body>")
+		}
+		for t := n.FirstChild; t != nil; t = t.NextSibling {
+			if t.Type == html.TextNode {
+				sheet.WriteString(t.Data)
+			}
+		}
+	}
+	if sheet.Len() > maxAMPKeyframesStyleBytes {
+		return errors.Errorf("<style amp-keyframes> is %d bytes, exceeding the limit of %d", sheet.Len(), maxAMPKeyframesStyleBytes)
+	}
+
+	var keyframes *html.Node
+	if len(existing) > 0 {
+		keyframes = existing[0]
+		for _, n := range existing[1:] {
+			htmlnode.RemoveNode(&n)
+		}
+		keyframes.Parent.RemoveChild(keyframes)
+		htmlnode.RemoveAllChildren(keyframes)
+	} else {
+		keyframes = htmlnode.Element("style", html.Attribute{Key: amphtml.AMPKeyframes})
+	}
+	keyframes.AppendChild(htmlnode.Text(sheet.String()))
+	body.AppendChild(keyframes)
+	return nil
+}
+
+// isLastElementChild returns true if n is the last child of p, ignoring any
+// whitespace that follows it.
+func isLastElementChild(p, n *html.Node) bool {
+	if n.Parent != p {
+		return false
+	}
+	for c := n.NextSibling; c != nil; c = c.NextSibling {
+		if c.Type != html.TextNode || strings.TrimSpace(c.Data) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,163 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+// A @keyframes rule of more than 40 bytes, the threshold in the tests.
+const largeKeyframes = `@keyframes fade{from{opacity:0}50%{opacity:.5}to{opacity:1}}`
+
+func TestAMPKeyframes(t *testing.T) {
+	tcs := []struct {
+		desc                       string
+		head, body                 string
+		expectedHead, expectedBody string
+		threshold                  int
+		disabled                   bool
+		expectError                bool
+		expectedWarnings           int
+	}{
+		{
+			desc:         "Moves large keyframes into amp-keyframes",
+			head:         `<style amp-custom>h1{color:red}` + largeKeyframes + `</style>`,
+			body:         `<p>hello</p>`,
+			expectedHead: `<style amp-custom="">h1{color:red}</style>`,
+			expectedBody: `<p>hello</p><style amp-keyframes="">` + largeKeyframes + `</style>`,
+		},
+		{
+			desc:         "Moves vendor-prefixed keyframes",
+			head:         `<style amp-custom>@-webkit-keyframes spin{from{-webkit-transform:rotate(0)}to{-webkit-transform:rotate(360deg)}}</style>`,
+			expectedHead: `<style amp-custom=""></style>`,
+			expectedBody: `<style amp-keyframes="">@-webkit-keyframes spin{from{-webkit-transform:rotate(0)}to{-webkit-transform:rotate(360deg)}}</style>`,
+		},
+		{
+			desc:         "Leaves small keyframes in amp-custom",
+			head:         `<style amp-custom>@keyframes k{to{opacity:1}}</style>`,
+			expectedHead: `<style amp-custom="">@keyframes k{to{opacity:1}}</style>`,
+		},
+		{
+			desc:         "Default threshold",
+			head:         `<style amp-custom>` + largeKeyframes + `</style>`,
+			expectedHead: `<style amp-custom="">` + largeKeyframes + `</style>`,
+			threshold:    -1,
+		},
+		{
+			desc:         "Leaves keyframes animating disallowed properties",
+			head:         `<style amp-custom>@keyframes color{from{background-color:red}to{background-color:blue}}</style>`,
+			expectedHead: `<style amp-custom="">@keyframes color{from{background-color:red}to{background-color:blue}}</style>`,
+		},
+		{
+			desc:         "Leaves keyframes within media queries",
+			head:         `<style amp-custom>@media (min-width:600px){` + largeKeyframes + `}</style>`,
+			expectedHead: `<style amp-custom="">@media (min-width:600px){` + largeKeyframes + `}</style>`,
+		},
+		{
+			desc:         "Appends to existing amp-keyframes",
+			head:         `<style amp-custom>` + largeKeyframes + `</style>`,
+			body:         `<p>hello</p><style amp-keyframes>@keyframes k{to{opacity:1}}</style>`,
+			expectedHead: `<style amp-custom=""></style>`,
+			expectedBody: `<p>hello</p><style amp-keyframes="">` + largeKeyframes + `@keyframes k{to{opacity:1}}</style>`,
+		},
+		{
+			desc:             "Moves misplaced amp-keyframes to the end of body",
+			head:             `<style amp-custom>h1{color:red}</style>`,
+			body:             `<style amp-keyframes>@keyframes k{to{opacity:1}}</style><p>hello</p>`,
+			expectedHead:     `<style amp-custom="">h1{color:red}</style>`,
+			expectedBody:     `<p>hello</p><style amp-keyframes="">@keyframes k{to{opacity:1}}</style>`,
+			expectedWarnings: 1,
+		},
+		{
+			desc:             "Merges several amp-keyframes",
+			body:             `<style amp-keyframes>@keyframes a{to{opacity:1}}</style><p>hello</p><style amp-keyframes>@keyframes b{to{opacity:0}}</style>`,
+			expectedBody:     `<p>hello</p><style amp-keyframes="">@keyframes a{to{opacity:1}}@keyframes b{to{opacity:0}}</style>`,
+			expectedWarnings: 2,
+		},
+		{
+			desc:         "Leaves amp-keyframes within templates",
+			body:         `<template type="amp-mustache"><style amp-keyframes>@keyframes k{to{opacity:1}}</style></template><p>hello</p>`,
+			expectedBody: `<template type="amp-mustache"><style amp-keyframes="">@keyframes k{to{opacity:1}}</style></template><p>hello</p>`,
+		},
+		{
+			desc:         "Disabled",
+			head:         `<style amp-custom>` + largeKeyframes + `</style>`,
+			body:         `<style amp-keyframes></style><p>hello</p>`,
+			expectedHead: `<style amp-custom="">` + largeKeyframes + `</style>`,
+			expectedBody: `<style amp-keyframes=""></style><p>hello</p>`,
+			disabled:     true,
+		},
+		{
+			desc:        "Over limit",
+			head:        `<style amp-custom>` + largeKeyframes + `</style>`,
+			body:        `<style amp-keyframes>@keyframes k{to{opacity:1}}` + strings.Repeat(" ", 500000) + `</style>`,
+			expectError: true,
+		},
+	}
+	for _, tc := range tcs {
+		input := tt.Concat("<html><head>", tc.head, "</head><body>", tc.body, "</body></html>")
+		expected := tt.Concat("<html><head>", tc.expectedHead, "</head><body>", tc.expectedBody, "</body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		threshold := tc.threshold
+		if threshold == 0 {
+			threshold = 40
+		} else if threshold < 0 {
+			threshold = 0
+		}
+		context := transformers.Context{DOM: inputDOM, MoveAMPKeyframes: !tc.disabled, AMPKeyframesThreshold: threshold}
+		err = transformers.AMPKeyframes(&context)
+		if tc.expectError {
+			if err == nil {
+				t.Errorf("%s: AMPKeyframes() unexpectedly succeeded", tc.desc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: AMPKeyframes() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if output.String() != expected {
+			t.Errorf("%s: AMPKeyframes()=\n%q\nwant=\n%q", tc.desc, &output, expected)
+		}
+		if len(context.Warnings) != tc.expectedWarnings {
+			t.Errorf("%s: AMPKeyframes() warned %v, want %d warnings", tc.desc, context.Warnings, tc.expectedWarnings)
+		}
+		for _, warning := range context.Warnings {
+			if warning.Code != transformers.WarningAMPKeyframes {
+				t.Errorf("%s: AMPKeyframes() warned %v, want code %q", tc.desc, warning, transformers.WarningAMPKeyframes)
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"golang.org/x/net/html"
+)
+
+// ClassTokens normalizes the class attribute of each element, improving the
+// compression of documents generated by templates, by removing duplicate
+// tokens (keeping the first) and joining them with single spaces:
+//
+// <div class="b  a b">
+//            transforms to
+// <div class="b a">
+//
+// If Context.SortClasses is true, the tokens are also sorted. Class
+// attributes with a single token, or containing mustache templates, are left
+// unmodified. The order of class tokens has no meaning in HTML or CSS, so
+// this doesn't change rendering.
+//
+// This is opt-in; it does nothing unless Context.DedupeClasses is true.
+func ClassTokens(e *Context) error {
+	if !e.DedupeClasses {
+		return nil
+	}
+	for n := e.DOM.RootNode; n != nil; n = htmlnode.Next(n) {
+		if n.Type != html.ElementNode {
+			continue
+		}
+		for i := range n.Attr {
+			attr := &n.Attr[i]
+			if attr.Namespace != "" || attr.Key != "class" || strings.Contains(attr.Val, "{{") {
+				continue
+			}
+			tokens := strings.FieldsFunc(attr.Val, func(r rune) bool { return strings.ContainsRune(whitespace, r) })
+			if len(tokens) <= 1 {
+				continue
+			}
+			seen := make(map[string]bool, len(tokens))
+			unique := tokens[:0]
+			for _, token := range tokens {
+				if !seen[token] {
+					seen[token] = true
+					unique = append(unique, token)
+				}
+			}
+			if e.SortClasses {
+				sort.Strings(unique)
+			}
+			attr.Val = strings.Join(unique, " ")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+func TestClassTokens(t *testing.T) {
+	tcs := []struct {
+		desc, input, expected string
+		sort, disabled        bool
+	}{
+		{
+			desc:     "dedupes keeping first",
+			input:    "<div class=\"b  a\tb a c\"></div><p class=\"x x\"></p>",
+			expected: `<div class="b a c"></div><p class="x"></p>`,
+		},
+		{
+			desc:     "sorts",
+			input:    `<div class="b a b c"></div>`,
+			expected: `<div class="a b c"></div>`,
+			sort:     true,
+		},
+		{
+			desc:     "leaves single token untouched",
+			input:    `<div class=" a "></div><svg class="icon"></svg>`,
+			expected: `<div class=" a "></div><svg class="icon"></svg>`,
+			sort:     true,
+		},
+		{
+			desc:     "leaves templates and non-breaking spaces untouched",
+			input:    "<div class=\"{{x}} a a\"></div><div class=\"a\u00a0b a\"></div>",
+			expected: "<div class=\"{{x}} a a\"></div><div class=\"a\u00a0b a\"></div>",
+		},
+		{
+			desc:     "disabled",
+			input:    `<div class="b a b"></div>`,
+			expected: `<div class="b a b"></div>`,
+			sort:     true,
+			disabled: true,
+		},
+	}
+	for _, tc := range tcs {
+		input := tt.Concat("<html><head></head><body>", tc.input, "</body></html>")
+		expected := tt.Concat("<html><head></head><body>", tc.expected, "</body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if err := transformers.ClassTokens(&transformers.Context{DOM: inputDOM, DedupeClasses: !tc.disabled, SortClasses: tc.sort}); err != nil {
+			t.Errorf("%s: ClassTokens() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if output.String() != expected {
+			t.Errorf("%s: ClassTokens()=\n%q\nwant=\n%q", tc.desc, &output, expected)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"regexp"
+
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// whitespaceRun matches runs of HTML whitespace.
+var whitespaceRun = regexp.MustCompile("[ \t\r\n\f]+")
+
+// CollapseWhitespace collapses each run of whitespace in text nodes to a
+// single space, reducing the size of the document:
+//
+// <p>
+//     Hello,   world.
+// </p>
+//            transforms to
+// <p> Hello, world. </p>
+//
+// Leading and trailing whitespace is collapsed but not removed, so that the
+// spacing between inline elements is unaffected. Text within <pre>,
+// <textarea>, <script> and <style> is left unmodified. Note that this does not
+// account for elements styled with white-space: pre (or similar), whose
+// rendering may change.
+//
+// This is opt-in; it does nothing unless Context.CollapseWhitespace is true.
+func CollapseWhitespace(e *Context) error {
+	if !e.CollapseWhitespace {
+		return nil
+	}
+	for n := e.DOM.RootNode; n != nil; n = htmlnode.Next(n) {
+		if n.Type != html.TextNode || n.Parent == nil {
+			continue
+		}
+		switch n.Parent.DataAtom {
+		case atom.Script, atom.Style:
+			continue
+		}
+		if htmlnode.IsDescendantOf(n, atom.Pre) || htmlnode.IsDescendantOf(n, atom.Textarea) {
+			continue
+		}
+		n.Data = whitespaceRun.ReplaceAllString(n.Data, " ")
+	}
+	return nil
+}
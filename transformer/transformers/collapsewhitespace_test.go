@@ -0,0 +1,85 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+func TestCollapseWhitespace(t *testing.T) {
+	tcs := []struct {
+		desc, input, expected string
+		disabled              bool
+	}{
+		{
+			desc:     "collapses text",
+			input:    "<p>\n    Hello,\t\t world.\n</p>",
+			expected: "<p> Hello, world. </p>",
+		},
+		{
+			desc:     "keeps inline spacing",
+			input:    "<p>a  <b>b</b>\n\n<i>c</i></p>",
+			expected: "<p>a <b>b</b> <i>c</i></p>",
+		},
+		{
+			desc:     "preserves pre",
+			input:    "<pre>a\n   b  <b>c   d</b></pre>",
+			expected: "<pre>a\n   b  <b>c   d</b></pre>",
+		},
+		{
+			desc:     "preserves textarea, script and style",
+			input:    "<textarea>a    b</textarea><script type=application/json>{  }</script><style>a  {}</style>",
+			expected: "<textarea>a    b</textarea><script type=\"application/json\">{  }</script><style>a  {}</style>",
+		},
+		{
+			desc:     "disabled",
+			input:    "<p>a    b</p>",
+			expected: "<p>a    b</p>",
+			disabled: true,
+		},
+	}
+	for _, tc := range tcs {
+		input := tt.Concat("<html><head></head><body>", tc.input, "</body></html>")
+		expected := tt.Concat("<html><head></head><body>", tc.expected, "</body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if err := transformers.CollapseWhitespace(&transformers.Context{DOM: inputDOM, CollapseWhitespace: !tc.disabled}); err != nil {
+			t.Errorf("%s: CollapseWhitespace() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if output.String() != expected {
+			t.Errorf("%s: CollapseWhitespace()=\n%q\nwant=\n%q", tc.desc, &output, expected)
+		}
+	}
+}
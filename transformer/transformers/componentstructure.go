@@ -0,0 +1,201 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"strings"
+
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// ComponentStructure checks that each <amp-accordion> and <amp-sidebar> has
+// the structure the AMP validator requires, repairing it where possible:
+//   - The children of an <amp-accordion> must be <section>s, each with a
+//     header (h1-h6 or <header>) followed by a single content element. A
+//     missing header is derived from the section's aria-label or title; a
+//     missing content element is added empty; and several content elements
+//     are wrapped in a <div>.
+//   - An <amp-sidebar> must be a child of <body>, to which it is moved; must
+//     have layout nodisplay, if any; must have side "left" or "right", if
+//     any; and its <nav toolbar> children must have a toolbar-target. It is
+//     not allowed in AMP4ADS and AMP4EMAIL documents.
+// Each repair is reported in Context.Warnings. It returns an error identifying
+// the element if the structure can't be repaired. Elements within <template>
+// are not checked.
+//
+// <amp-accordion><section title="FAQ"><p>a</p><p>b</p></section></amp-accordion>
+//            transforms to
+// <amp-accordion><section title="FAQ"><header>FAQ</header><div><p>a</p><p>b</p></div></section></amp-accordion>
+//
+// This is opt-in; it does nothing unless Context.EnforceComponentStructure is
+// true.
+//
+// This must run before ServerSideRendering, which lays out the elements it
+// repairs.
+func ComponentStructure(e *Context) error {
+	if !e.EnforceComponentStructure {
+		return nil
+	}
+	format := documentFormat(e.DOM.HTMLNode)
+	var sidebars []*html.Node
+	for n := e.DOM.BodyNode; n != nil; n = htmlnode.Next(n) {
+		if n.Type != html.ElementNode || htmlnode.IsDescendantOf(n, atom.Template) {
+			continue
+		}
+		switch n.Data {
+		case "amp-accordion":
+			if err := repairAccordion(e, n); err != nil {
+				return err
+			}
+		case "amp-sidebar":
+			if format != "" {
+				return errors.Errorf("<amp-sidebar> at %s is not allowed in %s documents", nodeLocation(n), format)
+			}
+			// Repaired after the walk, as it may be moved.
+			sidebars = append(sidebars, n)
+		}
+	}
+	for _, n := range sidebars {
+		if err := repairSidebar(e, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// documentFormat returns "AMP4ADS" or "AMP4EMAIL" if the given <html> element
+// declares that format, or "" for AMP.
+func documentFormat(n *html.Node) string {
+	for _, a := range n.Attr {
+		switch a.Key {
+		case "amp4ads", "⚡4ads":
+			return "AMP4ADS"
+		case "amp4email", "⚡4email":
+			return "AMP4EMAIL"
+		}
+	}
+	return ""
+}
+
+// repairAccordion repairs the sections of the <amp-accordion> n.
+func repairAccordion(e *Context, n *html.Node) error {
+	i := 0
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch {
+		case c.Type == html.CommentNode || isWhitespaceText(c):
+			continue
+		case c.Type != html.ElementNode:
+			return errors.Errorf("<amp-accordion> at %s has text outside of its <section>s", nodeLocation(n))
+		case c.DataAtom != atom.Section:
+			return errors.Errorf("<amp-accordion> at %s has a <%s> child; its children must be <section>s", nodeLocation(n), c.Data)
+		}
+		i++
+		if err := repairAccordionSection(e, c, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// repairAccordionSection gives the i'th <section> n of an <amp-accordion> a
+// header and single content element.
+func repairAccordionSection(e *Context, n *html.Node, i int) error {
+	var children []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.CommentNode && !isWhitespaceText(c) {
+			children = append(children, c)
+		}
+	}
+	if len(children) == 0 || !isSectionHeader(children[0]) {
+		label := sectionLabel(n)
+		if label == "" {
+			return errors.Errorf("section %d of <amp-accordion> at %s has no header (h1-h6 or <header>) as its first child, and none can be derived from an aria-label or title", i, nodeLocation(n.Parent))
+		}
+		header := htmlnode.Element("header")
+		header.AppendChild(htmlnode.Text(label))
+		n.InsertBefore(header, n.FirstChild)
+		children = append([]*html.Node{header}, children...)
+		e.Warn(WarningComponentStructure, n, "added <header>%s</header> to <section> of <amp-accordion>", label)
+	}
+	switch {
+	case len(children) == 1:
+		n.AppendChild(htmlnode.Element("div"))
+		e.Warn(WarningComponentStructure, n, "added empty content to <section> of <amp-accordion>")
+	case len(children) > 2:
+		content := htmlnode.Element("div")
+		for _, c := range children[1:] {
+			n.RemoveChild(c)
+			content.AppendChild(c)
+		}
+		n.AppendChild(content)
+		e.Warn(WarningComponentStructure, n, "wrapped the %d content elements of <section> of <amp-accordion> in a <div>", len(children)-1)
+	}
+	return nil
+}
+
+// isSectionHeader returns true if n may be the header of an <amp-accordion>
+// section.
+func isSectionHeader(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Header:
+		return true
+	}
+	return false
+}
+
+// sectionLabel returns the label an <amp-accordion> section declares for
+// itself, if any.
+func sectionLabel(n *html.Node) string {
+	for _, key := range []string{"aria-label", "title"} {
+		if val, ok := htmlnode.GetAttributeVal(n, "", key); ok && strings.TrimSpace(val) != "" {
+			return strings.TrimSpace(val)
+		}
+	}
+	return ""
+}
+
+// repairSidebar moves the <amp-sidebar> n to <body> and checks its attributes
+// and toolbars.
+func repairSidebar(e *Context, n *html.Node) error {
+	if n.Parent != e.DOM.BodyNode {
+		e.Warn(WarningComponentStructure, n, "moved <amp-sidebar> to <body>")
+		n.Parent.RemoveChild(n)
+		e.DOM.BodyNode.AppendChild(n)
+	}
+	if layout, ok := htmlnode.GetAttributeVal(n, "", "layout"); ok && strings.ToLower(strings.TrimSpace(layout)) != "nodisplay" {
+		e.Warn(WarningComponentStructure, n, "changed layout=%q of <amp-sidebar> to nodisplay", layout)
+		htmlnode.SetAttribute(n, "", "layout", "nodisplay")
+	}
+	if side, ok := htmlnode.GetAttributeVal(n, "", "side"); ok && side != "left" && side != "right" {
+		return errors.Errorf("<amp-sidebar> at %s has side=%q; it must be \"left\" or \"right\"", nodeLocation(n), side)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.DataAtom == atom.Nav && htmlnode.HasAttribute(c, "", "toolbar") && !hasNonEmptyAttribute(c, "toolbar-target") {
+			return errors.Errorf("<nav toolbar> at %s has no toolbar-target", nodeLocation(c))
+		}
+	}
+	return nil
+}
+
+// isWhitespaceText returns true if n is a text node of only whitespace.
+func isWhitespaceText(n *html.Node) bool {
+	return n.Type == html.TextNode && strings.Trim(n.Data, whitespace) == ""
+}
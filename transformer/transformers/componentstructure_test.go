@@ -0,0 +1,161 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+func TestComponentStructure(t *testing.T) {
+	tcs := []struct {
+		desc, input, expected string
+		disabled              bool
+	}{
+		{
+			desc:     "valid accordion",
+			input:    "<amp-accordion>\n<section><h2>a</h2><p>b</p></section>\n<!-- c -->\n</amp-accordion>",
+			expected: "<amp-accordion>\n<section><h2>a</h2><p>b</p></section>\n<!-- c -->\n</amp-accordion>",
+		},
+		{
+			desc:     "adds a missing header from the title",
+			input:    `<amp-accordion><section title="FAQ"><p>a</p></section></amp-accordion>`,
+			expected: `<amp-accordion><section title="FAQ"><header>FAQ</header><p>a</p></section></amp-accordion>`,
+		},
+		{
+			desc:     "prefers aria-label to title",
+			input:    `<amp-accordion><section aria-label="Label" title="Title"><p>a</p></section></amp-accordion>`,
+			expected: `<amp-accordion><section aria-label="Label" title="Title"><header>Label</header><p>a</p></section></amp-accordion>`,
+		},
+		{
+			desc:     "wraps several content elements",
+			input:    `<amp-accordion><section title="FAQ"><p>a</p><p>b</p></section></amp-accordion>`,
+			expected: `<amp-accordion><section title="FAQ"><header>FAQ</header><div><p>a</p><p>b</p></div></section></amp-accordion>`,
+		},
+		{
+			desc:     "adds missing content",
+			input:    `<amp-accordion><section><header>a</header></section></amp-accordion>`,
+			expected: `<amp-accordion><section><header>a</header><div></div></section></amp-accordion>`,
+		},
+		{
+			desc:     "moves sidebar to body",
+			input:    `<div><amp-sidebar id="s" layout="nodisplay"><p>a</p></amp-sidebar></div><p>b</p>`,
+			expected: `<div></div><p>b</p><amp-sidebar id="s" layout="nodisplay"><p>a</p></amp-sidebar>`,
+		},
+		{
+			desc:     "fixes sidebar layout",
+			input:    `<amp-sidebar id="s" layout="fill" side="left"><p>a</p></amp-sidebar>`,
+			expected: `<amp-sidebar id="s" layout="nodisplay" side="left"><p>a</p></amp-sidebar>`,
+		},
+		{
+			desc:     "leaves templates alone",
+			input:    `<template><amp-accordion><section><p>{{a}}</p></section></amp-accordion></template>`,
+			expected: `<template><amp-accordion><section><p>{{a}}</p></section></amp-accordion></template>`,
+		},
+		{
+			desc:     "disabled",
+			input:    `<amp-accordion><section title="FAQ"><p>a</p></section></amp-accordion>`,
+			expected: `<amp-accordion><section title="FAQ"><p>a</p></section></amp-accordion>`,
+			disabled: true,
+		},
+	}
+	for _, tc := range tcs {
+		input := tt.Concat("<html><head></head><body>", tc.input, "</body></html>")
+		expected := tt.Concat("<html><head></head><body>", tc.expected, "</body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if err := transformers.ComponentStructure(&transformers.Context{DOM: inputDOM, EnforceComponentStructure: !tc.disabled}); err != nil {
+			t.Errorf("%s: ComponentStructure() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if output.String() != expected {
+			t.Errorf("%s: ComponentStructure()=\n%q\nwant=\n%q", tc.desc, &output, expected)
+		}
+	}
+}
+
+func TestComponentStructureErrors(t *testing.T) {
+	tcs := []struct {
+		desc, html, input, expectedError string
+	}{
+		{
+			desc:          "unlabeled section",
+			html:          "<html>",
+			input:         `<amp-accordion><section><h3>a</h3><p>b</p></section><section><p>c</p></section></amp-accordion>`,
+			expectedError: "section 2 of <amp-accordion> at html > body > amp-accordion:nth-child(1) has no header (h1-h6 or <header>) as its first child, and none can be derived from an aria-label or title",
+		},
+		{
+			desc:          "non-section child",
+			html:          "<html>",
+			input:         `<amp-accordion><div>a</div></amp-accordion>`,
+			expectedError: "<amp-accordion> at html > body > amp-accordion:nth-child(1) has a <div> child; its children must be <section>s",
+		},
+		{
+			desc:          "sidebar in email",
+			html:          "<html ⚡4email>",
+			input:         `<amp-sidebar id="s" layout="nodisplay"></amp-sidebar>`,
+			expectedError: "<amp-sidebar> at html > body > amp-sidebar:nth-child(1) is not allowed in AMP4EMAIL documents",
+		},
+		{
+			desc:          "bad side",
+			html:          "<html>",
+			input:         `<amp-sidebar id="s" layout="nodisplay" side="top"></amp-sidebar>`,
+			expectedError: `<amp-sidebar> at html > body > amp-sidebar:nth-child(1) has side="top"; it must be "left" or "right"`,
+		},
+		{
+			desc:          "toolbar without target",
+			html:          "<html>",
+			input:         `<amp-sidebar id="s" layout="nodisplay"><nav toolbar="(max-width: 600px)"><ul></ul></nav></amp-sidebar>`,
+			expectedError: "<nav toolbar> at html > body > amp-sidebar:nth-child(1) > nav:nth-child(1) has no toolbar-target",
+		},
+	}
+	for _, tc := range tcs {
+		input := tt.Concat(tc.html, "<head></head><body>", tc.input, "</body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		err = transformers.ComponentStructure(&transformers.Context{DOM: inputDOM, EnforceComponentStructure: true})
+		if err == nil {
+			t.Errorf("%s: ComponentStructure() unexpectedly succeeded", tc.desc)
+		} else if err.Error() != tc.expectedError {
+			t.Errorf("%s: ComponentStructure() error=%q, want=%q", tc.desc, err, tc.expectedError)
+		}
+	}
+}
@@ -15,10 +15,16 @@
 package transformers
 
 import (
+	"fmt"
 	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/ampproject/amppackager/transformer/internal/amphtml"
 	rpb "github.com/ampproject/amppackager/transformer/request"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
 )
 
 // Context stores the root DOM Node and contextual data used for the
@@ -40,4 +46,293 @@ type Context struct {
 
 	// The request parameters.
 	Request *rpb.Request
+
+	// Resolves external SVG documents referenced by <use> elements. If nil,
+	// InlineSVGUse is disabled.
+	SVGResolver SVGResolver
+
+	// If true, the transformers that follow one that fails, and that is
+	// safe to skip, are still run, and the partially transformed document
+	// is returned along with the errors, e.g. for batch processing. If
+	// false, or if the failing transformer is not safe to skip (e.g.
+	// because it leaves the DOM inconsistent), the error aborts the
+	// transformation.
+	BestEffort bool
+
+	// If true, StripCSSComments removes comments from <style amp-custom>.
+	StripCSSComments bool
+
+	// Comments which StripCSSComments should preserve. If nil, license
+	// comments are preserved.
+	CSSCommentKeepPattern *regexp.Regexp
+
+	// If true, DedupeFontFaces removes duplicate @font-face rules from
+	// <style amp-custom>.
+	DedupeFontFaces bool
+
+	// If true, AMPKeyframes moves the large @keyframes rules of
+	// <style amp-custom> into <style amp-keyframes> at the end of <body>.
+	MoveAMPKeyframes bool
+
+	// The size, in bytes, of the smallest @keyframes rule AMPKeyframes
+	// moves. If zero, it is 1024.
+	AMPKeyframesThreshold int
+
+	// If true, UnusedExtensions removes the script tags of all unused
+	// extensions, not just those exempted by the AMP validator from its
+	// requirement that they be used.
+	PruneUnusedExtensions bool
+
+	// If true, RelativeURL rewrites the absolute href and src attributes
+	// with the origin of BaseURL as path-absolute URLs.
+	RelativeSameOriginURLs bool
+
+	// If true, StripDisallowedCSS removes the at-rules and properties AMP
+	// disallows (e.g. @import and behavior) from <style amp-custom>.
+	StripDisallowedCSS bool
+
+	// If true, StripDisallowedCSS returns an error listing them instead.
+	ErrorOnDisallowedCSS bool
+
+	// If true, NormalizeCSS shortens the colors and numbers in
+	// <style amp-custom>.
+	NormalizeCSS bool
+
+	// The AMP formats, most preferred first, by which AMPFormat resolves
+	// conflicting format attributes on <html> (e.g. both ⚡ and amp4ads). If
+	// empty, AMPFormat is disabled.
+	AMPFormatPrecedence []rpb.Request_HtmlFormat
+
+	// If true, AMPImgLayout sets the default layout of <amp-img> elements
+	// explicitly.
+	ExplicitAMPImgLayout bool
+
+	// Reports the intrinsic dimensions of images referenced by srcset
+	// attributes. If nil, SrcsetAspectRatio is disabled.
+	ImageSizer ImageSizer
+
+	// If true, SrcsetAspectRatio removes srcset candidates with inconsistent
+	// aspect ratios, rather than only warning about them.
+	DropInconsistentSrcsetCandidates bool
+
+	// Prefixes of comments which NodeCleanup should preserve, e.g. "[if" for
+	// IE conditional comments, or "googleoff". Leading whitespace in the
+	// comment is ignored. If empty, all comments are stripped.
+	PreserveCommentPrefixes []string
+
+	// Names of elements (e.g. "meta" or "my-csp-marker") whose nonce
+	// attributes NodeCleanup should preserve. If empty, all nonce attributes
+	// are stripped.
+	PreserveNonceElements []string
+
+	// The maximum number of preconnect hints URLRewrite emits, preferring
+	// those for image CDNs over those for other subresources, and preferring
+	// both over any existing hints for other origins (e.g. analytics). If
+	// zero, there is no limit.
+	MaxPreconnects int
+
+	// If true, ResourceHints adds preconnect hints for the AMP CDN and the
+	// origins of the document's subresources.
+	ResourceHints bool
+
+	// The maximum number of hints ResourceHints adds. If zero, it is 4.
+	MaxResourceHints int
+
+	// Inline style declarations which StripInlineStyles removes, each of the
+	// form "property" (e.g. "behavior") or "property:value" (e.g.
+	// "position:fixed"). If empty, StripInlineStyles is disabled.
+	DisallowedInlineStyles []string
+
+	// If true, InjectTitle inserts a <title> into documents without one.
+	InjectTitle bool
+
+	// The title InjectTitle inserts. If empty, the title is derived from the
+	// canonical URL.
+	DefaultTitle string
+
+	// If true, CollapseWhitespace collapses runs of whitespace in text.
+	CollapseWhitespace bool
+
+	// If true, EmptyTables removes table sections and tables without cells.
+	StripEmptyTables bool
+
+	// If true, WrapperDivs collapses chains of single-child wrapper divs.
+	CollapseWrapperDivs bool
+
+	// If true, ClassTokens removes duplicate tokens from class attributes.
+	DedupeClasses bool
+
+	// If true, ClassTokens also sorts the tokens of class attributes.
+	SortClasses bool
+
+	// If true, TrackingPixels converts tracking images into <amp-pixel>.
+	ConvertTrackingPixels bool
+
+	// The hosts whose images TrackingPixels converts, regardless of their
+	// size. Subdomains match too.
+	TrackingPixelHosts []string
+
+	// If true, ImgToAMPImg converts <img> elements into <amp-img>.
+	ConvertImgToAMPImg bool
+
+	// Stores the images ExtractDataURIImages extracts from data URIs. If nil,
+	// ExtractDataURIImages is disabled.
+	DataURIImageStore DataURIImageStore
+
+	// The size, in decoded bytes, of the smallest data URI image that
+	// ExtractDataURIImages extracts. If zero, it is 4096.
+	DataURIImageThreshold int
+
+	// If true, MediaAttributes checks, and where possible fills in, the
+	// required attributes of <amp-video> and <amp-audio>.
+	EnforceMediaAttributes bool
+
+	// If true, ComponentStructure checks, and where possible repairs, the
+	// required structure of <amp-accordion> and <amp-sidebar>.
+	EnforceComponentStructure bool
+
+	// If true, AMPGeoGroups removes invalid country codes from the
+	// ISOCountryGroups of <amp-geo> configs.
+	EnforceAMPGeoGroups bool
+
+	// If true, AMPGeoGroups returns an error listing them instead.
+	ErrorOnInvalidAMPGeoGroups bool
+
+	// If true, MergeAnalytics merges <amp-analytics> elements with
+	// compatible configs.
+	MergeAMPAnalytics bool
+
+	// If true, PruneUnusedCSS removes the amp-custom style rules that match
+	// no element.
+	PruneUnusedCSS bool
+
+	// If true, NodeCleanup strips data-* attributes from elements other than
+	// AMP components, except those matching PreserveAttributePrefixes.
+	PruneDataAttributes bool
+
+	// Prefixes of attribute names, e.g. "data-vars-", which NodeCleanup
+	// never prunes. If empty, and PruneDataAttributes is false, all
+	// attributes survive, as before.
+	PreserveAttributePrefixes []string
+
+	// If true, the transformers marked safe to parallelize (see Subtrees)
+	// process the children of <body> concurrently, which may be faster for
+	// very large documents.
+	ParallelSubtrees bool
+
+	// The maximum number of subtrees processed at once, if ParallelSubtrees
+	// is true. If zero, it is runtime.GOMAXPROCS(0).
+	MaxSubtreeConcurrency int
+
+	// Non-fatal problems found, and lossy changes made, by the transformers,
+	// for the caller to log.
+	Warnings []Warning
+}
+
+// Codes of the Warnings reported by the transformers.
+const (
+	WarningAMPGeoGroup        = "amp-geo-group"
+	WarningAMPKeyframes       = "amp-keyframes"
+	WarningComponentStructure = "component-structure"
+	WarningConflictingFormats = "conflicting-formats"
+	WarningDataURIImage       = "data-uri-image"
+	WarningDisallowedCSS      = "disallowed-css"
+	WarningDuplicateAttribute = "duplicate-attribute"
+	WarningDuplicateTitle     = "duplicate-title"
+	WarningHTTPEquiv          = "http-equiv"
+	WarningImgMissingSize     = "img-missing-size"
+	WarningSanitizedURI       = "sanitized-uri"
+	WarningServiceWorker      = "service-worker"
+	WarningSrcsetAspectRatio  = "srcset-aspect-ratio"
+)
+
+// Warning describes a non-fatal problem found, or a lossy change made, by a
+// transformer.
+type Warning struct {
+	// Code identifies the kind of warning, e.g. WarningDuplicateTitle.
+	Code string
+	// Message describes the specific problem or change.
+	Message string
+	// Location is the path to the element concerned, e.g.
+	// "html > body > div:nth-child(2) > img:nth-child(1)", or empty if not
+	// applicable.
+	Location string
+}
+
+func (this Warning) String() string {
+	if this.Location == "" {
+		return this.Code + ": " + this.Message
+	}
+	return this.Code + ": " + this.Message + " (at " + this.Location + ")"
+}
+
+// Warn appends a Warning with the given code to Warnings. If n is not nil, it
+// is the location of the warning; this must be called before n is detached
+// from the DOM.
+func (this *Context) Warn(code string, n *html.Node, format string, args ...interface{}) {
+	this.Warnings = append(this.Warnings, Warning{Code: code, Message: fmt.Sprintf(format, args...), Location: nodeLocation(n)})
+}
+
+// nodeLocation returns the path from the root element to the element n (or, if
+// n isn't an element, its parent), identifying each element by its tag name
+// and, below <html>, <head>, and <body>, its position among its siblings.
+func nodeLocation(n *html.Node) string {
+	for n != nil && n.Type != html.ElementNode {
+		n = n.Parent
+	}
+	var path []string
+	for ; n != nil && n.Type == html.ElementNode; n = n.Parent {
+		step := n.Data
+		switch n.DataAtom {
+		case atom.Html, atom.Head, atom.Body:
+		default:
+			i := 1
+			for c := n.PrevSibling; c != nil; c = c.PrevSibling {
+				if c.Type == html.ElementNode {
+					i++
+				}
+			}
+			step += ":nth-child(" + strconv.Itoa(i) + ")"
+		}
+		path = append([]string{step}, path...)
+	}
+	return strings.Join(path, " > ")
+}
+
+// PreservesNonce returns true if the nonce attribute of element n should be
+// preserved, per PreserveNonceElements.
+func (this *Context) PreservesNonce(n *html.Node) bool {
+	for _, name := range this.PreserveNonceElements {
+		if strings.EqualFold(n.Data, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// PreservesAttribute returns true if the attribute with the given key should
+// survive attribute pruning, per PreserveAttributePrefixes.
+func (this *Context) PreservesAttribute(key string) bool {
+	key = strings.ToLower(key)
+	for _, prefix := range this.PreserveAttributePrefixes {
+		if prefix != "" && strings.HasPrefix(key, strings.ToLower(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// PreservesComment returns true if n is a comment node that should be
+// preserved, per PreserveCommentPrefixes.
+func (this *Context) PreservesComment(n *html.Node) bool {
+	if n.Type != html.CommentNode {
+		return false
+	}
+	data := strings.TrimLeft(n.Data, whitespace)
+	for _, prefix := range this.PreserveCommentPrefixes {
+		if prefix != "" && strings.HasPrefix(data, prefix) {
+			return true
+		}
+	}
+	return false
 }
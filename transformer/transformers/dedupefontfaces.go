@@ -0,0 +1,60 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	"github.com/ampproject/amppackager/transformer/internal/css"
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// DedupeFontFaces removes the @font-face rules of the <style amp-custom>
+// stylesheet that duplicate an earlier one, ignoring comments and whitespace.
+//
+// <style amp-custom>@font-face { font-family: a } @font-face {font-family:a}</style>
+//            transforms to
+// <style amp-custom>@font-face { font-family: a } </style>
+//
+// This is opt-in; it does nothing unless Context.DedupeFontFaces is true.
+// It returns an error if the stylesheet exceeds the AMP size limit, even after
+// deduplication.
+func DedupeFontFaces(e *Context) error {
+	if !e.DedupeFontFaces {
+		return nil
+	}
+	for c := e.DOM.HeadNode.FirstChild; c != nil; c = c.NextSibling {
+		if c.DataAtom != atom.Style || !htmlnode.HasAttribute(c, "", amphtml.AMPCustom) {
+			continue
+		}
+		size := 0
+		for t := c.FirstChild; t != nil; t = t.NextSibling {
+			if t.Type != html.TextNode {
+				continue
+			}
+			// Leave stylesheets that cannot be tokenized untouched.
+			if deduped, err := css.DedupeFontFaces(t.Data); err == nil {
+				t.Data = deduped
+			}
+			size += len(t.Data)
+		}
+		if size > maxAMPCustomStyleBytes {
+			return errors.Errorf("<style amp-custom> is %d bytes, exceeding the limit of %d", size, maxAMPCustomStyleBytes)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+func TestDedupeFontFaces(t *testing.T) {
+	tcs := []struct {
+		desc, input, expected string
+		disabled              bool
+		expectError           bool
+	}{
+		{
+			desc:     "Removes identical font faces",
+			input:    `<style amp-custom>@font-face{font-family:a;src:url(a.woff)}h1{font-family:a}@font-face { font-family: a; src: url(a.woff) }</style>`,
+			expected: `<style amp-custom="">@font-face{font-family:a;src:url(a.woff)}h1{font-family:a}</style>`,
+		},
+		{
+			desc:     "Keeps distinct font faces",
+			input:    `<style amp-custom>@font-face{font-family:a;src:url(a.woff)}@font-face{font-family:a;font-weight:bold;src:url(a-bold.woff)}</style>`,
+			expected: `<style amp-custom="">@font-face{font-family:a;src:url(a.woff)}@font-face{font-family:a;font-weight:bold;src:url(a-bold.woff)}</style>`,
+		},
+		{
+			desc:     "Leaves other styles alone",
+			input:    `<style amp-boilerplate>@font-face{font-family:a}@font-face{font-family:a}</style>`,
+			expected: `<style amp-boilerplate="">@font-face{font-family:a}@font-face{font-family:a}</style>`,
+		},
+		{
+			desc:     "Disabled",
+			input:    `<style amp-custom>@font-face{font-family:a}@font-face{font-family:a}</style>`,
+			expected: `<style amp-custom="">@font-face{font-family:a}@font-face{font-family:a}</style>`,
+			disabled: true,
+		},
+		{
+			desc:        "Over limit after deduplication",
+			input:       `<style amp-custom>@font-face{font-family:a}@font-face{font-family:a}h1{content:"` + strings.Repeat("x", 80000) + `"}</style>`,
+			expectError: true,
+		},
+	}
+	for _, tc := range tcs {
+		input := tt.Concat("<html><head>", tc.input, "</head><body></body></html>")
+		expected := tt.Concat("<html><head>", tc.expected, "</head><body></body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		context := transformers.Context{DOM: inputDOM, DedupeFontFaces: !tc.disabled}
+		err = transformers.DedupeFontFaces(&context)
+		if tc.expectError {
+			if err == nil {
+				t.Errorf("%s: DedupeFontFaces() unexpectedly succeeded", tc.desc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: DedupeFontFaces() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if output.String() != expected {
+			t.Errorf("%s: DedupeFontFaces()=\n%q\nwant=\n%q", tc.desc, &output, expected)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"strings"
+
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// EmptyTables removes the scaffolding of generated tables that has no
+// content: <thead>, <tbody>, and <tfoot> sections without cells, and <table>s
+// without cells.
+//
+// <table><thead></thead><tbody><tr><td>a</td></tr></tbody></table><table><tbody></tbody></table>
+//            transforms to
+// <table><tbody><tr><td>a</td></tr></tbody></table>
+//
+// Tables within <template> are left unmodified, as their contents may be
+// rendered at runtime.
+//
+// This is opt-in; it does nothing unless Context.StripEmptyTables is true.
+func EmptyTables(e *Context) error {
+	if !e.StripEmptyTables {
+		return nil
+	}
+	for n := e.DOM.BodyNode; n != nil; n = htmlnode.Next(n) {
+		if n.Type != html.ElementNode {
+			continue
+		}
+		switch n.DataAtom {
+		case atom.Table, atom.Thead, atom.Tbody, atom.Tfoot:
+		default:
+			continue
+		}
+		if n.Namespace != "" || htmlnode.IsDescendantOf(n, atom.Template) {
+			continue
+		}
+		if !hasTableContent(n, n.DataAtom == atom.Table) {
+			htmlnode.RemoveNode(&n)
+		}
+	}
+	return nil
+}
+
+// hasTableContent returns true if the table or table section n contains a
+// cell or, for a section, any non-whitespace text (e.g. misnested by the
+// author).
+func hasTableContent(n *html.Node, isTable bool) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch {
+		case c.Type == html.ElementNode && (c.DataAtom == atom.Td || c.DataAtom == atom.Th):
+			return true
+		case c.Type == html.TextNode && !isTable && strings.Trim(c.Data, whitespace) != "":
+			return true
+		case hasTableContent(c, isTable):
+			return true
+		}
+	}
+	return false
+}
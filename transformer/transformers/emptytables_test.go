@@ -0,0 +1,90 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+func TestEmptyTables(t *testing.T) {
+	tcs := []struct {
+		desc, input, expected string
+		disabled              bool
+	}{
+		{
+			desc:     "removes empty sections",
+			input:    "<table><thead>\n</thead><tbody><tr><td>a</td></tr></tbody><tfoot><tr></tr></tfoot></table>",
+			expected: "<table><tbody><tr><td>a</td></tr></tbody></table>",
+		},
+		{
+			desc:     "removes tables without cells",
+			input:    "<p>a</p><table class=\"x\"><tbody><tr></tr></tbody></table><table></table><p>b</p>",
+			expected: "<p>a</p><p>b</p>",
+		},
+		{
+			desc:     "keeps populated tables",
+			input:    "<table><thead><tr><th>h</th></tr></thead><tbody><tr><td></td></tr></tbody></table>",
+			expected: "<table><thead><tr><th>h</th></tr></thead><tbody><tr><td></td></tr></tbody></table>",
+		},
+		{
+			desc:     "keeps nested tables with cells",
+			input:    "<table><tbody><tr><td><table><tbody></tbody></table></td></tr></tbody></table>",
+			expected: "<table><tbody><tr><td></td></tr></tbody></table>",
+		},
+		{
+			desc:     "leaves templates alone",
+			input:    "<template><table><tbody></tbody></table></template>",
+			expected: "<template><table><tbody></tbody></table></template>",
+		},
+		{
+			desc:     "disabled",
+			input:    "<table><tbody></tbody></table>",
+			expected: "<table><tbody></tbody></table>",
+			disabled: true,
+		},
+	}
+	for _, tc := range tcs {
+		input := tt.Concat("<html><head></head><body>", tc.input, "</body></html>")
+		expected := tt.Concat("<html><head></head><body>", tc.expected, "</body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if err := transformers.EmptyTables(&transformers.Context{DOM: inputDOM, StripEmptyTables: !tc.disabled}); err != nil {
+			t.Errorf("%s: EmptyTables() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if output.String() != expected {
+			t.Errorf("%s: EmptyTables()=\n%q\nwant=\n%q", tc.desc, &output, expected)
+		}
+	}
+}
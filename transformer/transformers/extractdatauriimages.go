@@ -0,0 +1,150 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"encoding/base64"
+	"mime"
+	"net/url"
+	"strings"
+
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// DataURIImageStore stores an image extracted from a data URI, given its media
+// type (e.g. "image/png") and decoded content, and returns the absolute URL at
+// which it is served, e.g. as a signed subresource.
+type DataURIImageStore func(mediaType string, data []byte) (*url.URL, error)
+
+// The size, in decoded bytes, of the smallest data URI image that
+// ExtractDataURIImages extracts, if Context.DataURIImageThreshold is zero.
+const defaultDataURIImageThreshold = 4096
+
+// ExtractDataURIImages moves large images out of data URIs, so that they don't
+// bloat the signed document and can be cached separately. The src of each
+// <amp-img> that is a data: URI of an image, of at least
+// Context.DataURIImageThreshold decoded bytes, is replaced with the URL
+// returned by Context.DataURIImageStore, as is that of any <img> within it with
+// the same src (e.g. a <noscript> fallback). Smaller images are left inline, as
+// the additional fetch would cost more than it saves. Identical images are
+// stored once.
+//
+// This is opt-in; it does nothing unless Context.DataURIImageStore is set. If
+// the store fails, the image is left inline, and reported in Context.Warnings.
+//
+// This must run after ImgToAMPImg, so that it extracts from the <amp-img>s it
+// creates, and before URLRewrite, which rewrites the extracted URLs like those
+// of any other image.
+func ExtractDataURIImages(e *Context) error {
+	if e.DataURIImageStore == nil {
+		return nil
+	}
+	threshold := e.DataURIImageThreshold
+	if threshold <= 0 {
+		threshold = defaultDataURIImageThreshold
+	}
+	// The URLs of the images stored so far, keyed by data URI.
+	stored := map[string]string{}
+	for n := e.DOM.RootNode; n != nil; n = htmlnode.Next(n) {
+		if n.Type != html.ElementNode || n.Data != "amp-img" {
+			continue
+		}
+		src, ok := htmlnode.FindAttribute(n, "", "src")
+		if !ok {
+			continue
+		}
+		dataURI := strings.TrimSpace(src.Val)
+		u, ok := stored[dataURI]
+		if !ok {
+			mediaType, data, ok := parseDataURI(dataURI)
+			if !ok || !strings.HasPrefix(mediaType, "image/") || len(data) < threshold {
+				continue
+			}
+			storedURL, err := e.DataURIImageStore(mediaType, data)
+			if err != nil {
+				e.Warn(WarningDataURIImage, n, "leaving %d-byte %s data URI inline: %s", len(data), mediaType, err)
+				continue
+			}
+			u = storedURL.String()
+			stored[dataURI] = u
+		}
+		src.Val = u
+		replaceImgSrcs(n, dataURI, u)
+	}
+	return nil
+}
+
+// replaceImgSrcs replaces the src of each <img> within n that is from with to.
+func replaceImgSrcs(n *html.Node, from, to string) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.DataAtom == atom.Img {
+			if src, ok := htmlnode.FindAttribute(c, "", "src"); ok && strings.TrimSpace(src.Val) == from {
+				src.Val = to
+			}
+		}
+		replaceImgSrcs(c, from, to)
+	}
+}
+
+// parseDataURI returns the media type (without parameters) and decoded content
+// of a data: URI, per https://tools.ietf.org/html/rfc2397, or false if it isn't
+// one.
+func parseDataURI(s string) (string, []byte, bool) {
+	if len(s) < len("data:") || !strings.EqualFold(s[:len("data:")], "data:") {
+		return "", nil, false
+	}
+	comma := strings.IndexByte(s, ',')
+	if comma < 0 {
+		return "", nil, false
+	}
+	header, content := s[len("data:"):comma], s[comma+1:]
+	isBase64 := false
+	if strings.HasSuffix(strings.ToLower(header), ";base64") {
+		isBase64 = true
+		header = header[:len(header)-len(";base64")]
+	}
+	mediaType := "text/plain"
+	if header != "" {
+		parsed, _, err := mime.ParseMediaType(header)
+		if err != nil {
+			return "", nil, false
+		}
+		mediaType = parsed
+	}
+	content, err := url.PathUnescape(content)
+	if err != nil {
+		return "", nil, false
+	}
+	if !isBase64 {
+		return mediaType, []byte(content), true
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.Map(dropWhitespace, content))
+	if err != nil {
+		return "", nil, false
+	}
+	return mediaType, data, true
+}
+
+// dropWhitespace is a strings.Map function removing ASCII whitespace, which
+// base64 data URIs may contain.
+func dropWhitespace(r rune) rune {
+	switch r {
+	case ' ', '\t', '\n', '\f', '\r':
+		return -1
+	}
+	return r
+}
@@ -0,0 +1,185 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+)
+
+// fakeDataURIImageStore serves the images it stores at
+// https://example.com/img/<n>, and records them.
+type fakeDataURIImageStore struct {
+	mediaTypes []string
+	images     [][]byte
+}
+
+func (this *fakeDataURIImageStore) store(mediaType string, data []byte) (*url.URL, error) {
+	if mediaType == "image/webp" {
+		return nil, errors.New("unsupported")
+	}
+	this.mediaTypes = append(this.mediaTypes, mediaType)
+	this.images = append(this.images, data)
+	return url.Parse("https://example.com/img/" + strconv.Itoa(len(this.images)))
+}
+
+func TestExtractDataURIImages(t *testing.T) {
+	large := bytes.Repeat([]byte{0x89, 'P', 'N', 'G'}, 1024)
+	largeURI := "data:image/png;base64," + base64.StdEncoding.EncodeToString(large)
+	small := []byte("GIF89a")
+	smallURI := "data:image/gif;base64," + base64.StdEncoding.EncodeToString(small)
+	largeSVG := `<svg xmlns="http://www.w3.org/2000/svg">` + strings.Repeat(`<path d="M0 0"/>`, 256) + `</svg>`
+	largeSVGURI := "data:image/svg+xml;charset=utf-8," + url.PathEscape(largeSVG)
+
+	tcs := []struct {
+		desc, input, expected string
+		expectedImages        []string
+		expectedWarnings      int
+	}{
+		{
+			desc:           "Extracts large base64 image",
+			input:          `<amp-img src="` + largeURI + `" width=10 height=10></amp-img>`,
+			expected:       `<amp-img src="https://example.com/img/1" width="10" height="10"></amp-img>`,
+			expectedImages: []string{string(large)},
+		},
+		{
+			desc:           "Extracts large percent-encoded image",
+			input:          `<amp-img src="` + largeSVGURI + `" width=10 height=10></amp-img>`,
+			expected:       `<amp-img src="https://example.com/img/1" width="10" height="10"></amp-img>`,
+			expectedImages: []string{largeSVG},
+		},
+		{
+			desc:     "Leaves small image inline",
+			input:    `<amp-img src="` + smallURI + `" width=10 height=10></amp-img>`,
+			expected: `<amp-img src="` + smallURI + `" width="10" height="10"></amp-img>`,
+		},
+		{
+			desc:           "Stores identical images once, and rewrites fallbacks",
+			input:          `<amp-img src="` + largeURI + `" width=10 height=10><img src="` + largeURI + `"></amp-img><amp-img src="` + largeURI + `" width=10 height=10></amp-img>`,
+			expected:       `<amp-img src="https://example.com/img/1" width="10" height="10"><img src="https://example.com/img/1"/></amp-img><amp-img src="https://example.com/img/1" width="10" height="10"></amp-img>`,
+			expectedImages: []string{string(large)},
+		},
+		{
+			desc:     "Leaves non-image data URI alone",
+			input:    `<amp-img src="data:text/plain,` + strings.Repeat("a", 5000) + `" width=10 height=10></amp-img>`,
+			expected: `<amp-img src="data:text/plain,` + strings.Repeat("a", 5000) + `" width="10" height="10"></amp-img>`,
+		},
+		{
+			desc:     "Leaves other URLs alone",
+			input:    `<amp-img src="https://example.com/a.png" width=10 height=10></amp-img>`,
+			expected: `<amp-img src="https://example.com/a.png" width="10" height="10"></amp-img>`,
+		},
+		{
+			desc:             "Leaves unstorable image inline",
+			input:            `<amp-img src="data:image/webp;base64,` + base64.StdEncoding.EncodeToString(large) + `" width=10 height=10></amp-img>`,
+			expected:         `<amp-img src="data:image/webp;base64,` + base64.StdEncoding.EncodeToString(large) + `" width="10" height="10"></amp-img>`,
+			expectedWarnings: 1,
+		},
+	}
+	for _, tc := range tcs {
+		input := tt.Concat("<html><head></head><body>", tc.input, "</body></html>")
+		expected := tt.Concat("<html><head></head><body>", tc.expected, "</body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		store := fakeDataURIImageStore{}
+		context := transformers.Context{DOM: inputDOM, DataURIImageStore: store.store}
+		if err := transformers.ExtractDataURIImages(&context); err != nil {
+			t.Errorf("%s: ExtractDataURIImages() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if output.String() != expected {
+			t.Errorf("%s: Transform=\n%q\nwant=\n%q", tc.desc, output.String(), expected)
+		}
+		if len(store.images) != len(tc.expectedImages) {
+			t.Errorf("%s: stored %d images, want %d", tc.desc, len(store.images), len(tc.expectedImages))
+		} else {
+			for i, image := range store.images {
+				if string(image) != tc.expectedImages[i] {
+					t.Errorf("%s: stored image %d = %q, want %q", tc.desc, i, image, tc.expectedImages[i])
+				}
+			}
+		}
+		if len(context.Warnings) != tc.expectedWarnings {
+			t.Errorf("%s: got %d warnings, want %d: %v", tc.desc, len(context.Warnings), tc.expectedWarnings, context.Warnings)
+		}
+	}
+}
+
+func TestExtractDataURIImagesThreshold(t *testing.T) {
+	uri := "data:image/gif;base64," + base64.StdEncoding.EncodeToString([]byte("GIF89a"))
+	input := `<html><head></head><body><amp-img src="` + uri + `" width="10" height="10"></amp-img></body></html>`
+	inputDoc, err := html.Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("html.Parse for %s failed %q", input, err)
+	}
+	inputDOM, err := amphtml.NewDOM(inputDoc)
+	if err != nil {
+		t.Fatalf("amphtml.NewDOM for %s failed %q", input, err)
+	}
+	store := fakeDataURIImageStore{}
+	context := transformers.Context{DOM: inputDOM, DataURIImageStore: store.store, DataURIImageThreshold: 6}
+	if err := transformers.ExtractDataURIImages(&context); err != nil {
+		t.Fatalf("ExtractDataURIImages() unexpectedly failed %q", err)
+	}
+	if len(store.mediaTypes) != 1 || store.mediaTypes[0] != "image/gif" {
+		t.Errorf("stored %v, want [image/gif]", store.mediaTypes)
+	}
+}
+
+func TestExtractDataURIImagesDisabled(t *testing.T) {
+	uri := "data:image/png;base64," + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("a"), 8192))
+	input := `<html><head></head><body><amp-img src="` + uri + `" width="10" height="10"></amp-img></body></html>`
+	inputDoc, err := html.Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("html.Parse for %s failed %q", input, err)
+	}
+	inputDOM, err := amphtml.NewDOM(inputDoc)
+	if err != nil {
+		t.Fatalf("amphtml.NewDOM for %s failed %q", input, err)
+	}
+	if err := transformers.ExtractDataURIImages(&transformers.Context{DOM: inputDOM}); err != nil {
+		t.Fatalf("ExtractDataURIImages() unexpectedly failed %q", err)
+	}
+	var output strings.Builder
+	if err := html.Render(&output, inputDoc); err != nil {
+		t.Fatalf("html.Render for %s failed %q", input, err)
+	}
+	if output.String() != input {
+		t.Errorf("Transform=\n%q\nwant=\n%q", output.String(), input)
+	}
+}
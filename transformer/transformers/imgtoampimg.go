@@ -0,0 +1,113 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// imgToAMPImgAttributes are the attributes of an <img> that are copied to the
+// <amp-img> replacing it. Others (e.g. event handlers, loading) are dropped.
+var imgToAMPImgAttributes = map[string]bool{
+	"alt":         true,
+	"attribution": true,
+	"class":       true,
+	"height":      true,
+	"id":          true,
+	"sizes":       true,
+	"src":         true,
+	"srcset":      true,
+	"style":       true,
+	"title":       true,
+	"width":       true,
+}
+
+// ImgToAMPImg converts each <img> into an <amp-img>, for documents produced
+// by systems that emit plain images, e.g.
+//   <img src=a.jpg width=100 height=50> -> <amp-img src=a.jpg width=100 height=50 layout=responsive>
+// If the <img> lacks a width or height, its intrinsic dimensions are taken
+// from Context.ImageSizer, if set, and the layout is fixed. Otherwise, it is
+// left unmodified, and a warning is reported in Context.Warnings.
+// Images within <noscript>, <svg>, or <template> are left unmodified.
+//
+// This is opt-in; it does nothing unless Context.ConvertImgToAMPImg is true.
+//
+// This must run before AMPImgLayout and ServerSideRendering, which process
+// the <amp-img> elements it creates.
+func ImgToAMPImg(e *Context) error {
+	if !e.ConvertImgToAMPImg {
+		return nil
+	}
+	for n := e.DOM.BodyNode; n != nil; n = htmlnode.Next(n) {
+		if n.Type != html.ElementNode || n.DataAtom != atom.Img || n.Namespace != "" {
+			continue
+		}
+		if htmlnode.IsDescendantOf(n, atom.Noscript) || htmlnode.IsDescendantOf(n, atom.Svg) || htmlnode.IsDescendantOf(n, atom.Template) {
+			continue
+		}
+		src, _ := htmlnode.GetAttributeVal(n, "", "src")
+		layout := "responsive"
+		width, hasWidth := htmlnode.GetAttributeVal(n, "", "width")
+		height, hasHeight := htmlnode.GetAttributeVal(n, "", "height")
+		if !hasWidth || width == "" || !hasHeight || height == "" {
+			w, h, ok := intrinsicImageSize(e, src)
+			if !ok {
+				e.Warn(WarningImgMissingSize, n,
+					"<img src=%q> has no width and height; not converting to <amp-img>", src)
+				continue
+			}
+			layout, width, height = "fixed", strconv.Itoa(w), strconv.Itoa(h)
+		}
+		attrs := make([]html.Attribute, 0, len(n.Attr)+1)
+		for _, attr := range n.Attr {
+			if attr.Namespace == "" && imgToAMPImgAttributes[attr.Key] {
+				attrs = append(attrs, attr)
+			}
+		}
+		n.Data, n.DataAtom, n.Attr = "amp-img", 0, attrs
+		htmlnode.SetAttribute(n, "", "width", width)
+		htmlnode.SetAttribute(n, "", "height", height)
+		htmlnode.SetAttribute(n, "", "layout", layout)
+	}
+	return nil
+}
+
+// intrinsicImageSize returns the dimensions of the image at src, per
+// Context.ImageSizer.
+func intrinsicImageSize(e *Context, src string) (int, int, bool) {
+	if e.ImageSizer == nil || src == "" {
+		return 0, 0, false
+	}
+	var u *url.URL
+	var err error
+	if e.BaseURL != nil {
+		u, err = e.BaseURL.Parse(src)
+	} else {
+		u, err = url.Parse(src)
+	}
+	if err != nil {
+		return 0, 0, false
+	}
+	width, height, ok := e.ImageSizer(u)
+	if !ok || width <= 0 || height <= 0 {
+		return 0, 0, false
+	}
+	return width, height, true
+}
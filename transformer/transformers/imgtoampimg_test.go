@@ -0,0 +1,93 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+func TestImgToAMPImg(t *testing.T) {
+	tcs := []struct {
+		desc, input, expected string
+		disabled              bool
+		expectedWarnings      []string
+	}{
+		{
+			desc:     "responsive",
+			input:    `<img src="a.jpg" alt="A" width="100" height="50" onerror="x()" loading="lazy">`,
+			expected: `<amp-img src="a.jpg" alt="A" width="100" height="50" layout="responsive"></amp-img>`,
+		},
+		{
+			desc:     "fixed from intrinsic size",
+			input:    `<img src="a-400.jpg" width="200">`,
+			expected: `<amp-img src="a-400.jpg" width="400" height="300" layout="fixed"></amp-img>`,
+		},
+		{
+			desc:             "missing dimensions",
+			input:            `<img src="unknown.jpg" height="50">`,
+			expected:         `<img src="unknown.jpg" height="50"/>`,
+			expectedWarnings: []string{`<img src="unknown.jpg"> has no width and height; not converting to <amp-img>`},
+		},
+		{
+			desc:     "skips svg and template",
+			input:    `<svg><image href="a.jpg"></image></svg><template><img src="a.jpg" width="1" height="1"></template>`,
+			expected: `<svg><image href="a.jpg"></image></svg><template><img src="a.jpg" width="1" height="1"/></template>`,
+		},
+		{
+			desc:     "disabled",
+			input:    `<img src="a.jpg" width="100" height="50">`,
+			expected: `<img src="a.jpg" width="100" height="50"/>`,
+			disabled: true,
+		},
+	}
+	baseURL, _ := url.Parse("https://example.com/")
+	for _, tc := range tcs {
+		input := tt.Concat("<html><head></head><body>", tc.input, "</body></html>")
+		expected := tt.Concat("<html><head></head><body>", tc.expected, "</body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		context := transformers.Context{DOM: inputDOM, BaseURL: baseURL, ImageSizer: fakeImageSizer, ConvertImgToAMPImg: !tc.disabled}
+		if err := transformers.ImgToAMPImg(&context); err != nil {
+			t.Errorf("%s: ImgToAMPImg() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if output.String() != expected {
+			t.Errorf("%s: ImgToAMPImg()=\n%q\nwant=\n%q", tc.desc, &output, expected)
+		}
+		if strings.Join(warningMessages(context.Warnings), "\n") != strings.Join(tc.expectedWarnings, "\n") {
+			t.Errorf("%s: Warnings=%q, want %q", tc.desc, warningMessages(context.Warnings), tc.expectedWarnings)
+		}
+	}
+}
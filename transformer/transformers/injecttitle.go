@@ -0,0 +1,106 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// titleSeparators are replaced by spaces when deriving a title from a URL.
+var titleSeparators = strings.NewReplacer("-", " ", "_", " ", "+", " ")
+
+// InjectTitle inserts a <title> into <head> if there is none (or it is
+// empty). The title is Context.DefaultTitle if set; otherwise, it is derived
+// from the last path segment of the canonical URL (falling back to the
+// document URL), e.g.
+//
+// <link rel=canonical href=https://example.com/news/secret-life-of-trees.html>
+//            yields
+// <title>secret life of trees</title>
+//
+// or the URL's hostname, if its path is empty.
+//
+// This is opt-in; it does nothing unless Context.InjectTitle is true.
+//
+// This must run after NodeCleanup, which strips extra <title> elements.
+func InjectTitle(e *Context) error {
+	if !e.InjectTitle {
+		return nil
+	}
+	var title *html.Node
+	for c := e.DOM.HeadNode.FirstChild; c != nil; c = c.NextSibling {
+		if c.DataAtom == atom.Title {
+			title = c
+			break
+		}
+	}
+	if title != nil {
+		for t := title.FirstChild; t != nil; t = t.NextSibling {
+			if t.Type == html.TextNode && strings.Trim(t.Data, whitespace) != "" {
+				return nil
+			}
+		}
+		htmlnode.RemoveAllChildren(title)
+	} else {
+		title = htmlnode.Element("title")
+		e.DOM.HeadNode.AppendChild(title)
+	}
+	text := e.DefaultTitle
+	if text == "" {
+		text = titleFromURL(canonicalURL(e))
+	}
+	title.AppendChild(htmlnode.Text(text))
+	return nil
+}
+
+// canonicalURL returns the URL of the <link rel=canonical> in <head>, or if
+// there is none, the document URL.
+func canonicalURL(e *Context) *url.URL {
+	for c := e.DOM.HeadNode.FirstChild; c != nil; c = c.NextSibling {
+		if c.DataAtom != atom.Link {
+			continue
+		}
+		if rel, ok := htmlnode.GetAttributeVal(c, "", "rel"); !ok || !fieldsContain(rel, "canonical") {
+			continue
+		}
+		href, ok := htmlnode.GetAttributeVal(c, "", "href")
+		if !ok || e.BaseURL == nil {
+			continue
+		}
+		if u, err := e.BaseURL.Parse(strings.TrimSpace(href)); err == nil {
+			return u
+		}
+	}
+	return e.DocumentURL
+}
+
+// titleFromURL returns a human-readable title derived from u.
+func titleFromURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	segment := path.Base(u.Path)
+	segment = strings.TrimSuffix(segment, path.Ext(segment))
+	if title := strings.Join(strings.Fields(titleSeparators.Replace(segment)), " "); title != "" && title != "/" {
+		return title
+	}
+	return u.Hostname()
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+func TestInjectTitle(t *testing.T) {
+	tcs := []struct {
+		desc, head, expected, defaultTitle string
+		disabled                           bool
+	}{
+		{
+			desc:         "inserts configured default",
+			head:         `<link rel=canonical href=/news/secret-life-of-trees.html>`,
+			expected:     `<link rel="canonical" href="/news/secret-life-of-trees.html"/><title>Example News</title>`,
+			defaultTitle: "Example News",
+		},
+		{
+			desc:     "derives from canonical URL",
+			head:     `<link rel=canonical href=/news/secret-life_of-trees.html>`,
+			expected: `<link rel="canonical" href="/news/secret-life_of-trees.html"/><title>secret life of trees</title>`,
+		},
+		{
+			desc:     "derives from document URL without canonical",
+			expected: `<title>doc</title>`,
+		},
+		{
+			desc:     "falls back to hostname",
+			head:     `<link rel=canonical href=https://www.example.com/>`,
+			expected: `<link rel="canonical" href="https://www.example.com/"/><title>www.example.com</title>`,
+		},
+		{
+			desc:     "fills empty title",
+			head:     `<title> </title>`,
+			expected: `<title>doc</title>`,
+		},
+		{
+			desc:         "keeps existing title",
+			head:         `<title>Trees</title>`,
+			expected:     `<title>Trees</title>`,
+			defaultTitle: "Example News",
+		},
+		{
+			desc:     "disabled",
+			expected: ``,
+			disabled: true,
+		},
+	}
+	documentURL, _ := url.Parse("https://example.com/amp/doc.html")
+	for _, tc := range tcs {
+		input := tt.Concat("<html><head>", tc.head, "</head><body></body></html>")
+		expected := tt.Concat("<html><head>", tc.expected, "</head><body></body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		context := transformers.Context{
+			DOM:          inputDOM,
+			DocumentURL:  documentURL,
+			BaseURL:      documentURL,
+			InjectTitle:  !tc.disabled,
+			DefaultTitle: tc.defaultTitle,
+		}
+		if err := transformers.InjectTitle(&context); err != nil {
+			t.Errorf("%s: InjectTitle() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if output.String() != expected {
+			t.Errorf("%s: InjectTitle()=\n%q\nwant=\n%q", tc.desc, &output, expected)
+		}
+	}
+}
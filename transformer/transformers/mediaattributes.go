@@ -0,0 +1,164 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// sizelessMediaLayouts are the layouts of <amp-video> that need no width or
+// height.
+var sizelessMediaLayouts = map[string]bool{
+	"fill":      true,
+	"flex-item": true,
+	"nodisplay": true,
+}
+
+// MediaAttributes checks that each <amp-video> and <amp-audio> has the
+// attributes the AMP validator requires, filling in those that can be
+// derived:
+//   - Each must have a src attribute, or <source> children with src
+//     attributes.
+//   - An <amp-video> must have a height, and unless its layout is
+//     fixed-height (or one needing no dimensions, e.g. fill), a width. Any
+//     missing dimensions are derived from the intrinsic size of its poster,
+//     per Context.ImageSizer, preserving its aspect ratio.
+// It returns an error identifying the element if the requirements can't be
+// met. Elements within <template> are not checked.
+//
+// This is opt-in; it does nothing unless Context.EnforceMediaAttributes is
+// true.
+//
+// This must run before ServerSideRendering, which lays out the elements it
+// fills.
+func MediaAttributes(e *Context) error {
+	if !e.EnforceMediaAttributes {
+		return nil
+	}
+	for n := e.DOM.BodyNode; n != nil; n = htmlnode.Next(n) {
+		if n.Type != html.ElementNode || (n.Data != "amp-video" && n.Data != "amp-audio") {
+			continue
+		}
+		if htmlnode.IsDescendantOf(n, atom.Template) {
+			continue
+		}
+		if err := checkMediaSources(n); err != nil {
+			return err
+		}
+		if n.Data == "amp-video" {
+			if err := fillVideoDimensions(e, n); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkMediaSources returns an error if the media element n has neither a src
+// attribute nor <source> children, or has a <source> child without a src.
+func checkMediaSources(n *html.Node) error {
+	hasSrc := hasNonEmptyAttribute(n, "src")
+	hasSources := false
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.DataAtom != atom.Source {
+			continue
+		}
+		if !hasNonEmptyAttribute(c, "src") {
+			return errors.Errorf("<source> at %s has no src", nodeLocation(c))
+		}
+		hasSources = true
+	}
+	if !hasSrc && !hasSources {
+		return errors.Errorf("<%s> at %s has no src attribute or <source> children", n.Data, nodeLocation(n))
+	}
+	return nil
+}
+
+// fillVideoDimensions sets the missing width and height of the <amp-video> n,
+// if required by its layout, from the intrinsic size of its poster.
+func fillVideoDimensions(e *Context, n *html.Node) error {
+	layout, _ := htmlnode.GetAttributeVal(n, "", "layout")
+	layout = strings.ToLower(strings.TrimSpace(layout))
+	if sizelessMediaLayouts[layout] {
+		return nil
+	}
+	width, hasWidth := mediaDimension(n, "width")
+	height, hasHeight := mediaDimension(n, "height")
+	if layout == "fixed-height" {
+		// The width must be absent or auto; only the height is needed.
+		hasWidth = true
+	}
+	if hasWidth && hasHeight {
+		return nil
+	}
+	poster, _ := htmlnode.GetAttributeVal(n, "", "poster")
+	posterWidth, posterHeight, ok := intrinsicImageSize(e, poster)
+	if !ok {
+		return errors.Errorf("<amp-video> at %s has no %s, and it cannot be derived from its poster", nodeLocation(n), missingDimensions(hasWidth, hasHeight))
+	}
+	switch {
+	case hasWidth && layout != "fixed-height":
+		height = width * float64(posterHeight) / float64(posterWidth)
+	case hasHeight:
+		width = height * float64(posterWidth) / float64(posterHeight)
+	default:
+		width, height = float64(posterWidth), float64(posterHeight)
+	}
+	if !hasWidth {
+		htmlnode.SetAttribute(n, "", "width", strconv.Itoa(int(math.Round(width))))
+	}
+	if !hasHeight {
+		htmlnode.SetAttribute(n, "", "height", strconv.Itoa(int(math.Round(height))))
+	}
+	return nil
+}
+
+// mediaDimension returns the value, in pixels, of the named dimension
+// attribute of n, or false if it is absent or not a positive number.
+func mediaDimension(n *html.Node, key string) (float64, bool) {
+	val, ok := htmlnode.GetAttributeVal(n, "", key)
+	if !ok {
+		return 0, false
+	}
+	dim, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(val), "px"), 64)
+	if err != nil || dim <= 0 {
+		return 0, false
+	}
+	return dim, true
+}
+
+// missingDimensions describes the dimensions that are missing.
+func missingDimensions(hasWidth, hasHeight bool) string {
+	switch {
+	case !hasWidth && !hasHeight:
+		return "width or height"
+	case !hasWidth:
+		return "width"
+	default:
+		return "height"
+	}
+}
+
+func hasNonEmptyAttribute(n *html.Node, key string) bool {
+	val, ok := htmlnode.GetAttributeVal(n, "", key)
+	return ok && strings.TrimSpace(val) != ""
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+func TestMediaAttributes(t *testing.T) {
+	tcs := []struct {
+		desc, input, expected string
+		disabled              bool
+	}{
+		{
+			desc:     "fills dimensions from poster",
+			input:    `<amp-video src="v.mp4" poster="a-400.jpg" layout="responsive"></amp-video>`,
+			expected: `<amp-video src="v.mp4" poster="a-400.jpg" layout="responsive" width="400" height="300"></amp-video>`,
+		},
+		{
+			desc:     "fills height preserving aspect ratio",
+			input:    `<amp-video poster="a-800.jpg" width="200"><source src="v.webm" type="video/webm"></amp-video>`,
+			expected: `<amp-video poster="a-800.jpg" width="200" height="150"><source src="v.webm" type="video/webm"/></amp-video>`,
+		},
+		{
+			desc:     "fixed-height needs only height",
+			input:    `<amp-video src="v.mp4" poster="b-800.jpg" layout="fixed-height" width="auto"></amp-video>`,
+			expected: `<amp-video src="v.mp4" poster="b-800.jpg" layout="fixed-height" width="auto" height="800"></amp-video>`,
+		},
+		{
+			desc:     "sizeless layouts and amp-audio",
+			input:    `<amp-video src="v.mp4" layout="fill"></amp-video><amp-audio src="a.mp3"></amp-audio>`,
+			expected: `<amp-video src="v.mp4" layout="fill"></amp-video><amp-audio src="a.mp3"></amp-audio>`,
+		},
+		{
+			desc:     "disabled",
+			input:    `<amp-video></amp-video>`,
+			expected: `<amp-video></amp-video>`,
+			disabled: true,
+		},
+	}
+	baseURL, _ := url.Parse("https://example.com/")
+	for _, tc := range tcs {
+		input := tt.Concat("<html><head></head><body>", tc.input, "</body></html>")
+		expected := tt.Concat("<html><head></head><body>", tc.expected, "</body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		context := transformers.Context{DOM: inputDOM, BaseURL: baseURL, ImageSizer: fakeImageSizer, EnforceMediaAttributes: !tc.disabled}
+		if err := transformers.MediaAttributes(&context); err != nil {
+			t.Errorf("%s: MediaAttributes() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if output.String() != expected {
+			t.Errorf("%s: MediaAttributes()=\n%q\nwant=\n%q", tc.desc, &output, expected)
+		}
+	}
+}
+
+func TestMediaAttributesErrors(t *testing.T) {
+	tcs := []struct {
+		desc, input, expectedError string
+	}{
+		{
+			desc:          "unresolvable dimensions",
+			input:         `<p>a</p><amp-video src="v.mp4" poster="unknown.jpg" height="100"></amp-video>`,
+			expectedError: "<amp-video> at html > body > amp-video:nth-child(2) has no width, and it cannot be derived from its poster",
+		},
+		{
+			desc:          "no poster",
+			input:         `<amp-video src="v.mp4"></amp-video>`,
+			expectedError: "<amp-video> at html > body > amp-video:nth-child(1) has no width or height, and it cannot be derived from its poster",
+		},
+		{
+			desc:          "no source",
+			input:         `<amp-audio><div fallback>No audio</div></amp-audio>`,
+			expectedError: "<amp-audio> at html > body > amp-audio:nth-child(1) has no src attribute or <source> children",
+		},
+		{
+			desc:          "source without src",
+			input:         `<amp-audio><source type="audio/mpeg"></amp-audio>`,
+			expectedError: "<source> at html > body > amp-audio:nth-child(1) > source:nth-child(1) has no src",
+		},
+	}
+	baseURL, _ := url.Parse("https://example.com/")
+	for _, tc := range tcs {
+		input := tt.Concat("<html><head></head><body>", tc.input, "</body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		context := transformers.Context{DOM: inputDOM, BaseURL: baseURL, ImageSizer: fakeImageSizer, EnforceMediaAttributes: true}
+		err = transformers.MediaAttributes(&context)
+		if err == nil {
+			t.Errorf("%s: MediaAttributes() unexpectedly succeeded", tc.desc)
+		} else if err.Error() != tc.expectedError {
+			t.Errorf("%s: MediaAttributes() error=%q, want=%q", tc.desc, err, tc.expectedError)
+		}
+	}
+}
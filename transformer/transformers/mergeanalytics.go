@@ -0,0 +1,195 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// An <amp-analytics> that others may be merged into.
+type analyticsTarget struct {
+	n *html.Node
+	// The text node holding its JSON config.
+	text    *html.Node
+	config  map[string]interface{}
+	changed bool
+}
+
+// MergeAnalytics merges <amp-analytics> elements with identical attributes
+// (e.g. the same type, for the same vendor) into the first of them,
+// concatenating their triggers, so that the page carries one config rather
+// than several. Elements are merged only where it is safe: each must have
+// only an inline JSON config, without a remote config attribute; their
+// configs must be identical apart from their triggers; and any trigger they
+// share by name must be identical. Elements that conflict are left separate,
+// as are those within <template>.
+//
+// <amp-analytics type="gtag"><script type="application/json">{"vars":{"gtag_id":"G-1"},"triggers":{"a":{"on":"visible"}}}</script></amp-analytics>
+// <amp-analytics type="gtag"><script type="application/json">{"vars":{"gtag_id":"G-1"},"triggers":{"b":{"on":"click"}}}</script></amp-analytics>
+//
+//	transforms to
+//
+// <amp-analytics type="gtag"><script type="application/json">{"triggers":{"a":{"on":"visible"},"b":{"on":"click"}},"vars":{"gtag_id":"G-1"}}</script></amp-analytics>
+//
+// This is opt-in; it does nothing unless Context.MergeAMPAnalytics is true.
+func MergeAnalytics(e *Context) error {
+	if !e.MergeAMPAnalytics {
+		return nil
+	}
+	// The elements that others may be merged into, keyed by their
+	// attributes.
+	targets := map[string][]*analyticsTarget{}
+	var merged []*html.Node
+	for n := e.DOM.BodyNode; n != nil; n = htmlnode.Next(n) {
+		if n.Type != html.ElementNode || n.Data != "amp-analytics" || htmlnode.IsDescendantOf(n, atom.Template) {
+			continue
+		}
+		if htmlnode.HasAttribute(n, "", "config") {
+			continue
+		}
+		text, config, ok := analyticsConfig(n)
+		if !ok {
+			continue
+		}
+		key := attributesKey(n)
+		absorbed := false
+		for _, target := range targets[key] {
+			if mergeAnalyticsConfig(target.config, config) {
+				target.changed = true
+				absorbed = true
+				break
+			}
+		}
+		if absorbed {
+			merged = append(merged, n)
+			continue
+		}
+		targets[key] = append(targets[key], &analyticsTarget{n, text, config, false})
+	}
+	for _, ts := range targets {
+		for _, target := range ts {
+			if !target.changed {
+				continue
+			}
+			// json.Marshal escapes <, >, and &, so the config can't close
+			// its <script>.
+			config, err := json.Marshal(target.config)
+			if err != nil {
+				continue
+			}
+			target.text.Data = string(config)
+		}
+	}
+	for _, n := range merged {
+		htmlnode.RemoveNode(&n)
+	}
+	return nil
+}
+
+// analyticsConfig returns the text node holding the JSON config of
+// <amp-analytics> n, and the config, or false if n has anything other than a
+// single JSON <script> child (ignoring whitespace and comments), or the config
+// isn't a JSON object.
+func analyticsConfig(n *html.Node) (*html.Node, map[string]interface{}, bool) {
+	var script *html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch {
+		case c.Type == html.CommentNode:
+		case c.Type == html.TextNode && strings.TrimSpace(c.Data) == "":
+		case c.DataAtom == atom.Script && script == nil:
+			script = c
+		default:
+			return nil, nil, false
+		}
+	}
+	if script == nil || script.FirstChild == nil || script.FirstChild != script.LastChild || script.FirstChild.Type != html.TextNode {
+		return nil, nil, false
+	}
+	if v, _ := htmlnode.GetAttributeVal(script, "", "type"); strings.ToLower(v) != "application/json" {
+		return nil, nil, false
+	}
+	decoder := json.NewDecoder(strings.NewReader(script.FirstChild.Data))
+	// Preserve numbers as written.
+	decoder.UseNumber()
+	var config map[string]interface{}
+	if err := decoder.Decode(&config); err != nil || config == nil || decoder.More() {
+		return nil, nil, false
+	}
+	if _, ok := config["triggers"]; ok {
+		if _, ok := config["triggers"].(map[string]interface{}); !ok {
+			return nil, nil, false
+		}
+	}
+	return script.FirstChild, config, true
+}
+
+// mergeAnalyticsConfig merges the triggers of src into dst, and returns true,
+// if their other keys are identical, and the triggers they share by name are
+// too. Otherwise, it leaves dst unmodified, and returns false.
+func mergeAnalyticsConfig(dst, src map[string]interface{}) bool {
+	for k, v := range src {
+		if k != "triggers" && !reflect.DeepEqual(dst[k], v) {
+			return false
+		}
+	}
+	for k := range dst {
+		if _, ok := src[k]; !ok && k != "triggers" {
+			return false
+		}
+	}
+	srcTriggers, _ := src["triggers"].(map[string]interface{})
+	dstTriggers, _ := dst["triggers"].(map[string]interface{})
+	for name, trigger := range srcTriggers {
+		if existing, ok := dstTriggers[name]; ok && !reflect.DeepEqual(existing, trigger) {
+			return false
+		}
+	}
+	if len(srcTriggers) == 0 {
+		return true
+	}
+	if dstTriggers == nil {
+		dstTriggers = map[string]interface{}{}
+		dst["triggers"] = dstTriggers
+	}
+	for name, trigger := range srcTriggers {
+		dstTriggers[name] = trigger
+	}
+	return true
+}
+
+// attributesKey returns a string identifying the set of n's attributes,
+// regardless of their order.
+func attributesKey(n *html.Node) string {
+	attrs := make([]string, len(n.Attr))
+	for i, attr := range n.Attr {
+		attrs[i] = attr.Namespace + ":" + attr.Key + "=" + attr.Val
+	}
+	sort.Strings(attrs)
+	var key bytes.Buffer
+	for _, attr := range attrs {
+		// NUL can't appear in attributes parsed from HTML.
+		key.WriteString(attr)
+		key.WriteByte(0)
+	}
+	return key.String()
+}
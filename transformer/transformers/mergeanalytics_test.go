@@ -0,0 +1,114 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+func analytics(attrs, config string) string {
+	return `<amp-analytics` + attrs + `><script type="application/json">` + config + `</script></amp-analytics>`
+}
+
+func TestMergeAnalytics(t *testing.T) {
+	tcs := []struct {
+		desc, input, expected string
+		disabled              bool
+	}{
+		{
+			desc: "merges compatible configs",
+			input: analytics(` type="gtag"`, `{"vars": {"gtag_id": "G-1"}, "triggers": {"a": {"on": "visible"}}}`) +
+				`<p>x</p>` +
+				analytics(` type="gtag"`, `{"vars": {"gtag_id": "G-1"}, "triggers": {"b": {"on": "click", "selector": "#x"}}}`),
+			expected: analytics(` type="gtag"`, `{"triggers":{"a":{"on":"visible"},"b":{"on":"click","selector":"#x"}},"vars":{"gtag_id":"G-1"}}`) +
+				`<p>x</p>`,
+		},
+		{
+			desc: "dedupes identical triggers",
+			input: analytics(``, `{"requests": {"p": "https://example.com/p"}, "triggers": {"a": {"on": "visible", "request": "p"}}}`) +
+				analytics(``, `{"requests": {"p": "https://example.com/p"}, "triggers": {"a": {"on": "visible", "request": "p"}}}`),
+			expected: analytics(``, `{"requests":{"p":"https://example.com/p"},"triggers":{"a":{"on":"visible","request":"p"}}}`),
+		},
+		{
+			desc: "leaves conflicting vars separate",
+			input: analytics(` type="gtag"`, `{"vars": {"gtag_id": "G-1"}, "triggers": {"a": {"on": "visible"}}}`) +
+				analytics(` type="gtag"`, `{"vars": {"gtag_id": "G-2"}, "triggers": {"b": {"on": "click"}}}`),
+			expected: analytics(` type="gtag"`, `{"vars": {"gtag_id": "G-1"}, "triggers": {"a": {"on": "visible"}}}`) +
+				analytics(` type="gtag"`, `{"vars": {"gtag_id": "G-2"}, "triggers": {"b": {"on": "click"}}}`),
+		},
+		{
+			desc: "leaves conflicting triggers separate",
+			input: analytics(``, `{"triggers": {"a": {"on": "visible"}}}`) +
+				analytics(``, `{"triggers": {"a": {"on": "click"}}}`),
+			expected: analytics(``, `{"triggers": {"a": {"on": "visible"}}}`) +
+				analytics(``, `{"triggers": {"a": {"on": "click"}}}`),
+		},
+		{
+			desc: "leaves different vendors separate",
+			input: analytics(` type="gtag"`, `{"triggers": {"a": {"on": "visible"}}}`) +
+				analytics(` type="segment"`, `{"triggers": {"b": {"on": "visible"}}}`),
+			expected: analytics(` type="gtag"`, `{"triggers": {"a": {"on": "visible"}}}`) +
+				analytics(` type="segment"`, `{"triggers": {"b": {"on": "visible"}}}`),
+		},
+		{
+			desc: "leaves remote configs separate",
+			input: analytics(` config="https://example.com/a.json"`, `{"triggers": {"a": {"on": "visible"}}}`) +
+				analytics(` config="https://example.com/a.json"`, `{"triggers": {"b": {"on": "visible"}}}`),
+			expected: analytics(` config="https://example.com/a.json"`, `{"triggers": {"a": {"on": "visible"}}}`) +
+				analytics(` config="https://example.com/a.json"`, `{"triggers": {"b": {"on": "visible"}}}`),
+		},
+		{
+			desc: "disabled",
+			input: analytics(``, `{"triggers": {"a": {"on": "visible"}}}`) +
+				analytics(``, `{"triggers": {"b": {"on": "visible"}}}`),
+			expected: analytics(``, `{"triggers": {"a": {"on": "visible"}}}`) +
+				analytics(``, `{"triggers": {"b": {"on": "visible"}}}`),
+			disabled: true,
+		},
+	}
+	for _, tc := range tcs {
+		input := tt.Concat("<html><head></head><body>", tc.input, "</body></html>")
+		expected := tt.Concat("<html><head></head><body>", tc.expected, "</body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		context := transformers.Context{DOM: inputDOM, MergeAMPAnalytics: !tc.disabled}
+		if err := transformers.MergeAnalytics(&context); err != nil {
+			t.Errorf("%s: MergeAnalytics() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if output.String() != expected {
+			t.Errorf("%s: Transform=\n%q\nwant=\n%q", tc.desc, output.String(), expected)
+		}
+	}
+}
@@ -15,6 +15,7 @@
 package transformers
 
 import (
+	"regexp"
 	"strings"
 
 	"github.com/ampproject/amppackager/transformer/internal/amphtml"
@@ -36,10 +37,15 @@ var (
 )
 
 // NodeCleanup cleans up the DOM tree, including, but not limited to:
-//  - stripping comment nodes.
+//  - stripping comment nodes, except those allowlisted by
+//    Context.PreserveCommentPrefixes.
 //  - stripping noscript elements.
 //  - removing duplicate attributes
-//  - stripping nonce attributes
+//  - stripping nonce attributes, except on elements allowlisted by
+//    Context.PreserveNonceElements.
+//  - if Context.PruneDataAttributes is set, stripping data-* attributes from
+//    non-AMP elements, except those allowlisted by
+//    Context.PreserveAttributePrefixes.
 //  - Escape JSP/ASP characters in <script> and <style>
 //  - sanitizing URI values
 //  - removing extra <title> elements
@@ -47,8 +53,10 @@ func NodeCleanup(e *Context) error {
 	for n := e.DOM.RootNode; n != nil; n = htmlnode.Next(n) {
 		switch n.Type {
 		case html.CommentNode:
-			// Strip out comment nodes.
-			htmlnode.RemoveNode(&n)
+			// Strip out comment nodes, unless allowlisted.
+			if !e.PreservesComment(n) {
+				htmlnode.RemoveNode(&n)
+			}
 			continue
 
 		case html.ElementNode:
@@ -59,21 +67,27 @@ func NodeCleanup(e *Context) error {
 			}
 
 			// Deduplicate attributes from element nodes
-			n.Attr = uniqueAttributes(n.Attr)
+			n.Attr = uniqueAttributes(e, n)
 
-			// Strip out nonce attributes
-			for i := len(n.Attr) - 1; i >= 0; i-- {
-				if n.Attr[i].Key == "nonce" {
-					n.Attr = append(n.Attr[:i], n.Attr[i+1:]...)
+			// Strip out nonce attributes, unless allowlisted.
+			if !e.PreservesNonce(n) {
+				for i := len(n.Attr) - 1; i >= 0; i-- {
+					if n.Attr[i].Key == "nonce" {
+						n.Attr = append(n.Attr[:i], n.Attr[i+1:]...)
+					}
 				}
 			}
 
+			if e.PruneDataAttributes {
+				pruneDataAttributes(e, n)
+			}
+
 			// Sanitize URI attribute values.
-			n.Attr = sanitizeURIAttributes(n.Attr)
+			sanitizeURIAttributes(e, n)
 
 			// Remove extra <title> elements
 			if n.DataAtom == atom.Title {
-				maybeStripTitle(&n)
+				maybeStripTitle(e, &n)
 			}
 
 			if n.Data == "amp-img" {
@@ -103,38 +117,135 @@ func NodeCleanup(e *Context) error {
 	// Find and fix amp-custom style after recursion above, which
 	// would have removed whitespace only children nodes. This call
 	// will then properly remove the empty style node.
-	findAndFixStyleAMPCustom(e.DOM.HeadNode)
+	findAndFixStyleAMPCustom(e, e.DOM.HeadNode)
 	return nil
 }
 
-// Returns the unique attributes (based off the attribute key), keeping
-// the first one encountered.
-func uniqueAttributes(attrs []html.Attribute) []html.Attribute {
-	u := make([]html.Attribute, 0, len(attrs))
-	m := make(map[string]struct{})
-	for _, a := range attrs {
-		if _, ok := m[a.Key]; !ok {
-			m[a.Key] = struct{}{}
+// Returns the unique attributes of n (based off the case-insensitive
+// attribute key and its namespace), keeping the first one encountered.
+// Dropping a duplicate with a different value is reported in
+// Context.Warnings. Before version 9, keys are compared case-sensitively, and
+// regardless of namespace.
+func uniqueAttributes(e *Context, n *html.Node) []html.Attribute {
+	u := make([]html.Attribute, 0, len(n.Attr))
+	m := make(map[string]int)
+	for _, a := range n.Attr {
+		key := a.Key
+		if e.Version >= 9 {
+			key = a.Namespace + ":" + strings.ToLower(a.Key)
+		}
+		i, ok := m[key]
+		if !ok {
+			m[key] = len(u)
 			u = append(u, a)
+			continue
+		}
+		if a.Val != u[i].Val {
+			e.Warn(WarningDuplicateAttribute, n,
+				"dropped duplicate attribute %s=%q on <%s>, keeping %s=%q", a.Key, a.Val, n.Data, u[i].Key, u[i].Val)
 		}
 	}
 	return u
 }
 
-// Sanitizes all any possible URI values (href or src), modifying the
-// input slice, and returning it as well.
-func sanitizeURIAttributes(attrs []html.Attribute) []html.Attribute {
-	for i := range attrs {
-		if attrs[i].Key == "src" || attrs[i].Key == "href" {
-			attrs[i].Val = strings.Map(func(r rune) rune {
-				if strings.ContainsRune(unsanitaryURIChars, r) {
-					return -1
-				}
-				return r
-			}, attrs[i].Val)
+// pruneDataAttributes strips the data-* attributes of n, unless n is an AMP
+// component (whose data-* attributes are commonly its configuration). The
+// attributes allowlisted by Context.PreserveAttributePrefixes, and those of
+// amp-bind's data-amp-bind-* syntax, are kept.
+func pruneDataAttributes(e *Context, n *html.Node) {
+	if strings.HasPrefix(n.Data, "amp-") {
+		return
+	}
+	for i := len(n.Attr) - 1; i >= 0; i-- {
+		key := strings.ToLower(n.Attr[i].Key)
+		if n.Attr[i].Namespace != "" || !strings.HasPrefix(key, "data-") || strings.HasPrefix(key, "data-amp-") || e.PreservesAttribute(key) {
+			continue
+		}
+		n.Attr = append(n.Attr[:i], n.Attr[i+1:]...)
+	}
+}
+
+// uriAttributes are the attributes whose values are a single URL.
+var uriAttributes = map[string]bool{
+	"action":      true,
+	"background":  true,
+	"cite":        true,
+	"cta-image":   true,
+	"cta-image-2": true,
+	"data":        true,
+	"data-src":    true,
+	"formaction":  true,
+	"href":        true,
+	"icon":        true,
+	"longdesc":    true,
+	"manifest":    true,
+	"poster":      true,
+	"src":         true,
+}
+
+// srcsetAttributes are the attributes whose values are a comma-separated list
+// of image candidates.
+var srcsetAttributes = map[string]bool{
+	"imagesrcset": true,
+	"srcset":      true,
+}
+
+var (
+	// srcsetDescriptors matches the (optional) descriptors at the end of a
+	// srcset image candidate, e.g. " 100w" or "\n2x".
+	srcsetDescriptors = regexp.MustCompile(`(?:[ \t\n\r\f]+[0-9.eE+-]+[wxh])*[ \t\n\r\f]*$`)
+	// cssURL matches a url() within an inline style.
+	cssURL = regexp.MustCompile(`(?i)\burl\([^)]*\)`)
+)
+
+// Sanitizes all any possible URI values (in src, href, srcset, url() within
+// style, etc.) of n, reporting each change in Context.Warnings. Before
+// version 9, only src and href are sanitized.
+func sanitizeURIAttributes(e *Context, n *html.Node) {
+	for i := range n.Attr {
+		attr := &n.Attr[i]
+		val := attr.Val
+		switch {
+		case attr.Key == "src" || attr.Key == "href":
+			attr.Val = sanitizeURI(val)
+		case e.Version < 9:
+			continue
+		case uriAttributes[attr.Key]:
+			attr.Val = sanitizeURI(val)
+		case srcsetAttributes[attr.Key]:
+			attr.Val = sanitizeSrcset(val)
+		case attr.Key == "style":
+			attr.Val = cssURL.ReplaceAllStringFunc(val, sanitizeURI)
+		}
+		if attr.Val != val {
+			e.Warn(WarningSanitizedURI, n, "stripped tabs and newlines from %s=%q", attr.Key, val)
 		}
 	}
-	return attrs
+}
+
+// sanitizeURI strips unsanitaryURIChars from the given URI.
+func sanitizeURI(uri string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(unsanitaryURIChars, r) {
+			return -1
+		}
+		return r
+	}, uri)
+}
+
+// sanitizeSrcset strips unsanitaryURIChars from the URL of each image
+// candidate in the given srcset, leaving the whitespace that separates the
+// URLs from their descriptors.
+func sanitizeSrcset(srcset string) string {
+	candidates := strings.Split(srcset, ",")
+	for i, c := range candidates {
+		url := strings.TrimLeft(c, whitespace)
+		leading := c[:len(c)-len(url)]
+		descriptors := url[srcsetDescriptors.FindStringIndex(url)[0]:]
+		url = url[:len(url)-len(descriptors)]
+		candidates[i] = leading + sanitizeURI(url) + descriptors
+	}
+	return strings.Join(candidates, ",")
 }
 
 // findAndFixStyleAMPCustom finds the <style amp-custom> element and
@@ -142,30 +253,69 @@ func sanitizeURIAttributes(attrs []html.Attribute) []html.Attribute {
 // attributes.
 // There can only be one <style amp-custom> element and only within head.
 // https://www.ampproject.org/docs/design/responsive_amp#add-styles-to-a-page
-func findAndFixStyleAMPCustom(h *html.Node) {
+// If there are several, their contents are concatenated into the first, and
+// the rest are removed. Before version 9, only the first is fixed.
+func findAndFixStyleAMPCustom(e *Context, h *html.Node) {
 	if h.DataAtom != atom.Head {
 		return
 	}
-	for c := h.FirstChild; c != nil; c = c.NextSibling {
+	if e.Version < 9 {
+		for c := h.FirstChild; c != nil; c = c.NextSibling {
+			if c.DataAtom == atom.Style && htmlnode.HasAttribute(c, "", amphtml.AMPCustom) {
+				// Strip empty nodes
+				if c.FirstChild == nil && c.LastChild == nil {
+					h.RemoveChild(c)
+				} else {
+					// Strip remaining attributes
+					c.Attr = []html.Attribute{{Key: amphtml.AMPCustom}}
+				}
+
+				// there can only be one <style amp-custom>, so return
+				return
+			}
+		}
+		return
+	}
+	var first *html.Node
+	var css strings.Builder
+	for c := h.FirstChild; c != nil; {
+		next := c.NextSibling
 		if c.DataAtom == atom.Style && htmlnode.HasAttribute(c, "", amphtml.AMPCustom) {
-			// Strip empty nodes
-			if c.FirstChild == nil && c.LastChild == nil {
-				h.RemoveChild(c)
+			for t := c.FirstChild; t != nil; t = t.NextSibling {
+				if t.Type == html.TextNode {
+					css.WriteString(t.Data)
+				}
+			}
+			if first == nil {
+				first = c
 			} else {
-				// Strip remaining attributes
-				c.Attr = []html.Attribute{{Key: amphtml.AMPCustom}}
+				h.RemoveChild(c)
 			}
-
-			// there can only be one <style amp-custom>, so return
-			return
 		}
+		c = next
 	}
+	if first == nil {
+		return
+	}
+	// Strip empty nodes
+	if css.Len() == 0 {
+		h.RemoveChild(first)
+		return
+	}
+	// Strip remaining attributes
+	first.Attr = []html.Attribute{{Key: amphtml.AMPCustom}}
+	htmlnode.RemoveAllChildren(first)
+	first.AppendChild(htmlnode.Text(css.String()))
 }
 
 // maybeStripTitle removes the given title element if it is extraneous.
-// There can only be one in head and none in body (svgs are excepted).
-func maybeStripTitle(n **html.Node) {
-	if (*n).DataAtom != atom.Title || htmlnode.IsDescendantOf(*n, atom.Svg) {
+// There can only be one in head and none in body. SVG titles (i.e. those in
+// the SVG namespace, or in any <svg> subtree, however deeply nested) are
+// never removed, nor counted against the one in head. Before version 9, only
+// those in an <svg> subtree are SVG titles, and any previous title in head
+// counts.
+func maybeStripTitle(e *Context, n **html.Node) {
+	if (*n).DataAtom != atom.Title || isSVGTitle(e, *n) {
 		return
 	}
 
@@ -174,17 +324,24 @@ func maybeStripTitle(n **html.Node) {
 		// If we are in head, see if there are any previous title siblings,
 		// and if so, strip this one.
 		for c := (*n).PrevSibling; c != nil; c = c.PrevSibling {
-			if c.DataAtom == atom.Title {
+			if c.DataAtom == atom.Title && (e.Version < 9 || !isSVGTitle(e, c)) {
+				e.Warn(WarningDuplicateTitle, *n, "removed extra <title> in <head>")
 				htmlnode.RemoveNode(n)
 				return
 			}
 		}
 	case htmlnode.IsDescendantOf(*n, atom.Body):
 		// Strip any titles found in body.
+		e.Warn(WarningDuplicateTitle, *n, "removed <title> in <body>")
 		htmlnode.RemoveNode(n)
 	}
 }
 
+// isSVGTitle returns true if the title element n belongs to an SVG image.
+func isSVGTitle(e *Context, n *html.Node) bool {
+	return (e.Version >= 9 && n.Namespace == "svg") || htmlnode.IsDescendantOf(n, atom.Svg)
+}
+
 func stripHeroImage(n *html.Node) {
 	attr, ok := htmlnode.FindAttribute(n, "", "i-amphtml-ssr")
 	if !ok {
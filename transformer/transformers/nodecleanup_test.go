@@ -22,7 +22,9 @@ import (
 	"github.com/ampproject/amppackager/transformer/internal/amphtml"
 	tt "github.com/ampproject/amppackager/transformer/internal/testing"
 	"github.com/ampproject/amppackager/transformer/transformers"
+	"github.com/google/go-cmp/cmp"
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 // BuildHTML returns AMPHTML with the given body string. Everything
@@ -63,14 +65,16 @@ func TestNodeCleanup_Strip(t *testing.T) {
 			Expected: BuildHTML("<a class=bar href='#'></a>"),
 		},
 		{
-			Desc:     "dedupe attr, case-insensitive",
-			Input:    BuildHTML("<a CLASS=foo class=foo></a>"),
-			Expected: BuildHTML("<a class=foo></a>"),
+			Desc:               "dedupe attr, case-insensitive",
+			TransformerVersion: 9,
+			Input:              BuildHTML("<a CLASS=foo class=foo></a>"),
+			Expected:           BuildHTML("<a class=foo></a>"),
 		},
 		{
-			Desc:     "dedupe attr, case-insensitive, order irrelevant",
-			Input:    BuildHTML("<a class=foo CLASS=bar></a>"),
-			Expected: BuildHTML("<a class=foo></a>"),
+			Desc:               "dedupe attr, case-insensitive, order irrelevant",
+			TransformerVersion: 9,
+			Input:              BuildHTML("<a class=foo CLASS=bar></a>"),
+			Expected:           BuildHTML("<a class=foo></a>"),
 		},
 		{
 			Desc: "strips child whitespace nodes from <html> and <head>",
@@ -123,6 +127,24 @@ func TestNodeCleanup_Strip(t *testing.T) {
 			Input:    "<style amp-custom>amp-gist { color: red; }</style>",
 			Expected: "<style amp-custom>amp-gist { color: red; }</style>",
 		},
+		{
+			Desc:               "merge multiple amp-custom styles",
+			TransformerVersion: 9,
+			Input:              "<head><style amp-custom>a { color: red; }</style><meta charset=utf-8><style amp-custom type=text/css>b { color: blue; }</style><style amp-custom></style></head>",
+			Expected:           "<head><style amp-custom>a { color: red; }b { color: blue; }</style><meta charset=utf-8></head>",
+		},
+		{
+			Desc:               "merge into empty first amp-custom style",
+			TransformerVersion: 9,
+			Input:              "<head><style amp-custom></style><style amp-custom>b { color: blue; }</style></head>",
+			Expected:           "<head><style amp-custom>b { color: blue; }</style></head>",
+		},
+		{
+			Desc:               "fix only the first amp-custom style before version 9",
+			TransformerVersion: 8,
+			Input:              "<head><style amp-custom type=text/css>a { color: red; }</style><style amp-custom type=text/css>b { color: blue; }</style></head>",
+			Expected:           "<head><style amp-custom>a { color: red; }</style><style amp-custom type=text/css>b { color: blue; }</style></head>",
+		},
 		{
 			Desc:     "strip extra attrs from style amp-custom",
 			Input:    "<style amp-custom=amp-custom type=text/css>amp-gist { color: red; }</style>",
@@ -140,6 +162,36 @@ func TestNodeCleanup_Strip(t *testing.T) {
 			Input: `<a href="  	">`,
 			Expected: `<a href="  "/>`,
 		},
+		{
+			Desc:               "Sanitize URIs in other URL attributes",
+			TransformerVersion: 9,
+			Input:              "<amp-video poster=\"a\n.jpg\" data-src=\"b\t.mp4\"></amp-video><svg><use xlink:href=\"c\r.svg#d\"></use></svg>",
+			Expected:           `<amp-video poster="a.jpg" data-src="b.mp4"></amp-video><svg><use xlink:href="c.svg#d"></use></svg>`,
+		},
+		{
+			Desc:               "Sanitize URIs in srcset",
+			TransformerVersion: 9,
+			Input:              "<img srcset=\"https://example.com/a\n.jpg\n1x,\n\thttps://example.com/b\t.jpg 100w 50h, c\r.jpg\">",
+			Expected:           "<img srcset=\"https://example.com/a.jpg\n1x,\n\thttps://example.com/b.jpg 100w 50h, c.jpg\"/>",
+		},
+		{
+			Desc:               "Sanitize URIs in srcset with data URL",
+			TransformerVersion: 9,
+			Input:              "<img srcset=\"data:image/png;base64,AA\nAA 2x\">",
+			Expected:           `<img srcset="data:image/png;base64,AAAA 2x"/>`,
+		},
+		{
+			Desc:               "Sanitize URIs in style",
+			TransformerVersion: 9,
+			Input:              "<div style=\"color:\nred;background:url('a\n.png')\"></div>",
+			Expected:           "<div style=\"color:\nred;background:url('a.png')\"></div>",
+		},
+		{
+			Desc:               "Sanitize URIs only in src and href before version 9",
+			TransformerVersion: 8,
+			Input:              "<img src=\"a\n.jpg\" srcset=\"b\n.jpg 2x\" style=\"background:url('c\n.png')\"><amp-video poster=\"d\n.jpg\"></amp-video>",
+			Expected:           "<img src=\"a.jpg\" srcset=\"b\n.jpg 2x\" style=\"background:url('c\n.png')\"/><amp-video poster=\"d\n.jpg\"></amp-video>",
+		},
 		{
 			Desc: "untouched URI",
 			Input: `<lemur uri="  	">`,
@@ -169,6 +221,26 @@ func TestNodeCleanup_Strip(t *testing.T) {
 				"<svg><symbol><title>b</title></symbol></svg>",
 				"</body>"),
 		},
+		{
+			Desc: "Strip bogus body <title> next to svg icon <title>",
+			Input: tt.Concat("<!doctype html><html ⚡><body>",
+				"<title>bogus</title>",
+				"<p><a href=/><span><svg class=icon><g><svg><title>Home</title></svg></g></svg></span>Home</a></p>",
+				"<title>bogus</title>",
+				"</body>"),
+			Expected: tt.Concat("<!doctype html><html ⚡><body>",
+				`<p><a href="/"><span><svg class="icon"><g><svg><title>Home</title></svg></g></svg></span>Home</a></p>`,
+				"</body>"),
+		},
+		{
+			Desc: "Preserve svg <title> inside foreignObject",
+			Input: tt.Concat("<!doctype html><html ⚡><body>",
+				"<svg><foreignObject><div><svg><title>a</title></svg></div></foreignObject></svg>",
+				"</body>"),
+			Expected: tt.Concat("<!doctype html><html ⚡><body>",
+				"<svg><foreignObject><div><svg><title>a</title></svg></div></foreignObject></svg>",
+				"</body>"),
+		},
 	}
 	runNodeCleanupTestCases(t, tcs)
 }
@@ -229,6 +301,229 @@ func TestNodeCleanup_NonceRemoved(t *testing.T) {
 	runNodeCleanupTestCases(t, tcs)
 }
 
+func TestNodeCleanup_PreserveNonceElements(t *testing.T) {
+	input := `<html><head><script nonce="a" async></script><style nonce="b"></style></head><body><csp-marker nonce="c"></csp-marker></body></html>`
+	tcs := []struct {
+		desc     string
+		elements []string
+		expected string
+	}{
+		{
+			desc:     "unset strips all nonces",
+			expected: `<html><head><script async=""></script><style></style></head><body><csp-marker></csp-marker></body></html>`,
+		},
+		{
+			desc:     "nonce on configured element preserved",
+			elements: []string{"CSP-Marker"},
+			expected: `<html><head><script async=""></script><style></style></head><body><csp-marker nonce="c"></csp-marker></body></html>`,
+		},
+	}
+	for _, tc := range tcs {
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("html.Parse failed %q", err)
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Fatalf("amphtml.NewDOM failed %q", err)
+		}
+		if err := transformers.NodeCleanup(&transformers.Context{DOM: inputDOM, PreserveNonceElements: tc.elements}); err != nil {
+			t.Errorf("%s: NodeCleanup() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render failed %q", tc.desc, err)
+			continue
+		}
+		if output.String() != tc.expected {
+			t.Errorf("%s: NodeCleanup()=\n%q\nwant=\n%q", tc.desc, &output, tc.expected)
+		}
+	}
+}
+
+// warningMessages returns the messages of the given warnings.
+func warningMessages(warnings []transformers.Warning) []string {
+	var ret []string
+	for _, w := range warnings {
+		ret = append(ret, w.Message)
+	}
+	return ret
+}
+
+func TestNodeCleanup_Warnings(t *testing.T) {
+	input := "<html><head><title>a</title><title>b</title></head><body><div></div><p><a href=\"/a\nb\">x</a></p><title>c</title></body></html>"
+	inputDoc, err := html.Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("html.Parse failed %q", err)
+	}
+	inputDOM, err := amphtml.NewDOM(inputDoc)
+	if err != nil {
+		t.Fatalf("amphtml.NewDOM failed %q", err)
+	}
+	context := transformers.Context{DOM: inputDOM}
+	if err := transformers.NodeCleanup(&context); err != nil {
+		t.Fatalf("NodeCleanup() unexpectedly failed %q", err)
+	}
+	expected := []transformers.Warning{
+		{Code: transformers.WarningDuplicateTitle, Message: "removed extra <title> in <head>", Location: "html > head > title:nth-child(2)"},
+		{Code: transformers.WarningSanitizedURI, Message: `stripped tabs and newlines from href="/a\nb"`, Location: "html > body > p:nth-child(2) > a:nth-child(1)"},
+		{Code: transformers.WarningDuplicateTitle, Message: "removed <title> in <body>", Location: "html > body > title:nth-child(3)"},
+	}
+	if diff := cmp.Diff(expected, context.Warnings); diff != "" {
+		t.Errorf("Warnings differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestNodeCleanup_SVGNamespaceTitle(t *testing.T) {
+	// The parser only puts SVG titles in <svg> subtrees, so the title is
+	// added to the parsed DOM directly, as other producers of the DOM may do.
+	for _, tc := range []struct {
+		version  int64
+		expected string
+	}{
+		{8, "<body><p></p></body>"},
+		{9, "<body><p><title></title></p></body>"},
+	} {
+		inputDoc, err := html.Parse(strings.NewReader("<p></p>"))
+		if err != nil {
+			t.Fatalf("html.Parse failed %q", err)
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Fatalf("amphtml.NewDOM failed %q", err)
+		}
+		inputDOM.BodyNode.FirstChild.AppendChild(&html.Node{Type: html.ElementNode, Data: "title", DataAtom: atom.Title, Namespace: "svg"})
+		if err := transformers.NodeCleanup(&transformers.Context{DOM: inputDOM, Version: tc.version}); err != nil {
+			t.Fatalf("NodeCleanup() unexpectedly failed %q", err)
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDOM.BodyNode); err != nil {
+			t.Fatalf("html.Render failed %q", err)
+		}
+		if output.String() != tc.expected {
+			t.Errorf("version %d: NodeCleanup()=%q, want=%q", tc.version, &output, tc.expected)
+		}
+	}
+}
+
+func TestNodeCleanup_DuplicateAttributes(t *testing.T) {
+	// The parser lowercases (and deduplicates) attribute keys, so the
+	// duplicates are added to the parsed DOM directly, as other producers of
+	// the DOM may do.
+	tcs := []struct {
+		desc             string
+		version          int64
+		attrs            []html.Attribute
+		expected         string
+		expectedWarnings []string
+	}{
+		{
+			desc:     "same value",
+			version:  9,
+			attrs:    []html.Attribute{{Key: "CLASS", Val: "a"}, {Key: "class", Val: "a"}},
+			expected: `<p CLASS="a"></p>`,
+		},
+		{
+			desc:             "differing values",
+			version:          9,
+			attrs:            []html.Attribute{{Key: "id", Val: "a"}, {Key: "Id", Val: "b"}, {Key: "ID", Val: "a"}},
+			expected:         `<p id="a"></p>`,
+			expectedWarnings: []string{`dropped duplicate attribute Id="b" on <p>, keeping id="a"`},
+		},
+		{
+			desc:     "distinct keys",
+			version:  9,
+			attrs:    []html.Attribute{{Key: "class", Val: "a"}, {Key: "data-class", Val: "b"}},
+			expected: `<p class="a" data-class="b"></p>`,
+		},
+		{
+			desc:             "case-sensitive before version 9",
+			version:          8,
+			attrs:            []html.Attribute{{Key: "id", Val: "a"}, {Key: "Id", Val: "b"}, {Key: "id", Val: "c"}},
+			expected:         `<p id="a" Id="b"></p>`,
+			expectedWarnings: []string{`dropped duplicate attribute id="c" on <p>, keeping id="a"`},
+		},
+	}
+	for _, tc := range tcs {
+		inputDoc, err := html.Parse(strings.NewReader("<p></p>"))
+		if err != nil {
+			t.Fatalf("html.Parse failed %q", err)
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Fatalf("amphtml.NewDOM failed %q", err)
+		}
+		p := inputDOM.BodyNode.FirstChild
+		p.Attr = tc.attrs
+		context := transformers.Context{DOM: inputDOM, Version: tc.version}
+		if err := transformers.NodeCleanup(&context); err != nil {
+			t.Errorf("%s: NodeCleanup() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, p); err != nil {
+			t.Errorf("%s: html.Render failed %q", tc.desc, err)
+			continue
+		}
+		if output.String() != tc.expected {
+			t.Errorf("%s: NodeCleanup()=%q, want=%q", tc.desc, &output, tc.expected)
+		}
+		if strings.Join(warningMessages(context.Warnings), "\n") != strings.Join(tc.expectedWarnings, "\n") {
+			t.Errorf("%s: Warnings=%q, want %q", tc.desc, warningMessages(context.Warnings), tc.expectedWarnings)
+		}
+	}
+}
+
+func TestNodeCleanup_PruneDataAttributes(t *testing.T) {
+	input := `<html><head></head><body><button data-vars-event="click" data-tooltip="Hi" data-amp-bind-text="x" id="b"></button><amp-ad data-slot="/1/a"></amp-ad></body></html>`
+	tcs := []struct {
+		desc     string
+		prune    bool
+		prefixes []string
+		expected string
+	}{
+		{
+			desc:     "disabled",
+			prefixes: []string{"data-vars-"},
+			expected: input,
+		},
+		{
+			desc:     "prunes all but AMP",
+			prune:    true,
+			expected: `<html><head></head><body><button data-amp-bind-text="x" id="b"></button><amp-ad data-slot="/1/a"></amp-ad></body></html>`,
+		},
+		{
+			desc:     "preserves allowlisted prefixes",
+			prune:    true,
+			prefixes: []string{"data-vars-", ""},
+			expected: `<html><head></head><body><button data-vars-event="click" data-amp-bind-text="x" id="b"></button><amp-ad data-slot="/1/a"></amp-ad></body></html>`,
+		},
+	}
+	for _, tc := range tcs {
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("html.Parse failed %q", err)
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Fatalf("amphtml.NewDOM failed %q", err)
+		}
+		if err := transformers.NodeCleanup(&transformers.Context{DOM: inputDOM, PruneDataAttributes: tc.prune, PreserveAttributePrefixes: tc.prefixes}); err != nil {
+			t.Errorf("%s: NodeCleanup() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render failed %q", tc.desc, err)
+			continue
+		}
+		if output.String() != tc.expected {
+			t.Errorf("%s: NodeCleanup()=\n%q\nwant=\n%q", tc.desc, &output, tc.expected)
+		}
+	}
+}
+
 func TestNodeCleanup_NoScriptRemoved(t *testing.T) {
 	tcs := []tt.TestCase{
 		{
@@ -260,6 +555,31 @@ func TestNodeCleanup_NoScriptRemoved(t *testing.T) {
 	runNodeCleanupTestCases(t, tcs)
 }
 
+// NodeCleanup strips <noscript> elements rather than reparsing their
+// contents, so a malformed ad snippet within one cannot fail the transform.
+func TestNodeCleanup_MalformedNoscript(t *testing.T) {
+	input := `<html><head></head><body><noscript><img src="https://ad.example/p?a=<b c="d><script>document.write("</noscript><p>kept</p></body></html>`
+	inputDoc, err := html.Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("html.Parse for %s failed %q", input, err)
+	}
+	inputDOM, err := amphtml.NewDOM(inputDoc)
+	if err != nil {
+		t.Fatalf("amphtml.NewDOM for %s failed %q", input, err)
+	}
+	context := transformers.Context{DOM: inputDOM}
+	if err := transformers.NodeCleanup(&context); err != nil {
+		t.Fatalf("NodeCleanup() unexpectedly failed %q", err)
+	}
+	var output strings.Builder
+	if err := html.Render(&output, inputDoc); err != nil {
+		t.Fatalf("html.Render for %s failed %q", input, err)
+	}
+	if expected := "<html><head></head><body><p>kept</p></body></html>"; output.String() != expected {
+		t.Errorf("NodeCleanup()=\n%q\nwant=\n%q", &output, expected)
+	}
+}
+
 func TestNodeCleanup_ReescapeText(t *testing.T) {
 	basetcs := []tt.TestCase{
 		{
@@ -365,6 +685,57 @@ func TestNodeCleanup_StripHeroImage(t *testing.T) {
 	runNodeCleanupTestCases(t, tcs)
 }
 
+func TestNodeCleanup_PreserveCommentPrefixes(t *testing.T) {
+	input := tt.Concat(
+		"<html><head><!--[if IE]><script></script><![endif]--><!-- build:css --></head>",
+		"<body><!--googleoff: index--><p>a<!-- plain --></p><!-- googleon: index -->",
+		"<!--if not conditional--><!----></body></html>")
+	tcs := []struct {
+		desc     string
+		prefixes []string
+		expected string
+	}{
+		{
+			desc:     "unset strips all comments",
+			expected: "<html><head></head><body><p>a</p></body></html>",
+		},
+		{
+			desc:     "allowlisted comments preserved",
+			prefixes: []string{"[if", "googleoff", "googleon"},
+			expected: tt.Concat(
+				"<html><head><!--[if IE]><script></script><![endif]--></head>",
+				"<body><!--googleoff: index--><p>a</p><!-- googleon: index --></body></html>"),
+		},
+		{
+			desc:     "empty prefix ignored",
+			prefixes: []string{""},
+			expected: "<html><head></head><body><p>a</p></body></html>",
+		},
+	}
+	for _, tc := range tcs {
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("html.Parse failed %q", err)
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Fatalf("amphtml.NewDOM failed %q", err)
+		}
+		if err := transformers.NodeCleanup(&transformers.Context{DOM: inputDOM, PreserveCommentPrefixes: tc.prefixes}); err != nil {
+			t.Errorf("%s: NodeCleanup() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render failed %q", tc.desc, err)
+			continue
+		}
+		if output.String() != tc.expected {
+			t.Errorf("%s: NodeCleanup()=\n%q\nwant=\n%q", tc.desc, &output, tc.expected)
+		}
+	}
+}
+
 func runNodeCleanupTestCases(t *testing.T, tcs []tt.TestCase) {
 	for _, tc := range tcs {
 		inputDoc, err := html.Parse(strings.NewReader(tc.Input))
@@ -377,7 +748,7 @@ func runNodeCleanupTestCases(t *testing.T, tcs []tt.TestCase) {
 			t.Errorf("%s\namphtml.NewDOM for %s failed %q", tc.Desc, tc.Input, err)
 			continue
 		}
-		transformers.NodeCleanup(&transformers.Context{DOM: inputDOM})
+		transformers.NodeCleanup(&transformers.Context{DOM: inputDOM, Version: tc.TransformerVersion})
 		var input strings.Builder
 		if err := html.Render(&input, inputDoc); err != nil {
 			t.Errorf("%s: html.Render failed %q", tc.Input, err)
@@ -0,0 +1,54 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	"github.com/ampproject/amppackager/transformer/internal/css"
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// NormalizeCSS rewrites the colors and numbers in the declarations of the
+// <style amp-custom> stylesheet in their shortest equivalent form, for byte
+// savings and deterministic output. Hex colors are lowercased and shortened,
+// and numbers lose redundant leading and trailing zeros.
+//
+// <style amp-custom>h1 { color: #FF0000; margin: 0.50em }</style>
+//            transforms to
+// <style amp-custom>h1 { color: #f00; margin: .5em }</style>
+//
+// This is opt-in; it does nothing unless Context.NormalizeCSS is true.
+func NormalizeCSS(e *Context) error {
+	if !e.NormalizeCSS {
+		return nil
+	}
+	for c := e.DOM.HeadNode.FirstChild; c != nil; c = c.NextSibling {
+		if c.DataAtom != atom.Style || !htmlnode.HasAttribute(c, "", amphtml.AMPCustom) {
+			continue
+		}
+		for t := c.FirstChild; t != nil; t = t.NextSibling {
+			if t.Type != html.TextNode {
+				continue
+			}
+			// Leave stylesheets that cannot be tokenized untouched.
+			if normalized, err := css.NormalizeValues(t.Data); err == nil {
+				t.Data = normalized
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+func TestNormalizeCSS(t *testing.T) {
+	tcs := []struct {
+		desc, input, expected string
+		disabled              bool
+	}{
+		{
+			desc:     "Normalizes colors",
+			input:    `<style amp-custom>h1{color:#FF0000;background:#AbCdEf}</style>`,
+			expected: `<style amp-custom="">h1{color:#f00;background:#abcdef}</style>`,
+		},
+		{
+			desc:     "Normalizes numbers",
+			input:    `<style amp-custom>h1{margin:0.50em 1.0px;opacity:0.0;width:010%}</style>`,
+			expected: `<style amp-custom="">h1{margin:.5em 1px;opacity:0;width:10%}</style>`,
+		},
+		{
+			desc:     "Keeps equivalent values",
+			input:    `<style amp-custom>#ABCDEF{color:#aabbcd;line-height:1.25;width:1e3px;content:"#FFFFFF"}</style>`,
+			expected: `<style amp-custom="">#ABCDEF{color:#aabbcd;line-height:1.25;width:1e3px;content:"#FFFFFF"}</style>`,
+		},
+		{
+			desc:     "Leaves other styles alone",
+			input:    `<style amp-boilerplate>h1{color:#FF0000}</style>`,
+			expected: `<style amp-boilerplate="">h1{color:#FF0000}</style>`,
+		},
+		{
+			desc:     "Disabled",
+			input:    `<style amp-custom>h1{color:#FF0000}</style>`,
+			expected: `<style amp-custom="">h1{color:#FF0000}</style>`,
+			disabled: true,
+		},
+	}
+	for _, tc := range tcs {
+		input := tt.Concat("<html><head>", tc.input, "</head><body></body></html>")
+		expected := tt.Concat("<html><head>", tc.expected, "</head><body></body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		context := transformers.Context{DOM: inputDOM, NormalizeCSS: !tc.disabled}
+		if err := transformers.NormalizeCSS(&context); err != nil {
+			t.Errorf("%s: NormalizeCSS() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if output.String() != expected {
+			t.Errorf("%s: NormalizeCSS()=\n%q\nwant=\n%q", tc.desc, &output, expected)
+		}
+	}
+}
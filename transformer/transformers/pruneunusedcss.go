@@ -0,0 +1,262 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"strings"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	"github.com/ampproject/amppackager/transformer/internal/css"
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// PruneUnusedCSS removes the style rules of the <style amp-custom> stylesheet
+// whose selectors cannot match any element in the document, e.g. those left
+// behind by the removal of an <amp-ad>.
+//
+// <style amp-custom>amp-ad { margin: 0 } .kept { color: red }</style>
+//            transforms to
+// <style amp-custom> .kept { color: red }</style>
+//
+// The matching is conservative: only type selectors of custom elements (which
+// the AMP runtime doesn't create) and class and ID selectors are considered,
+// and a rule is removed only if every selector in its list contains a
+// compound selector that no element satisfies. Classes prefixed with "amp-" or
+// "i-amphtml-" may be added by the runtime, so are assumed to match. Nothing
+// is pruned if the document may change classes or IDs at runtime (via
+// amp-bind, toggleClass, amp-script, or templates).
+//
+// This is opt-in; it does nothing unless Context.PruneUnusedCSS is true.
+//
+// This must run after the transformers that remove elements, and before
+// URLRewrite, so that the URLs of pruned rules aren't preconnected.
+func PruneUnusedCSS(e *Context) error {
+	if !e.PruneUnusedCSS {
+		return nil
+	}
+	doc, ok := collectSelectorIndex(e.DOM.RootNode)
+	if !ok {
+		return nil
+	}
+	for c := e.DOM.HeadNode.FirstChild; c != nil; c = c.NextSibling {
+		if c.DataAtom != atom.Style || !htmlnode.HasAttribute(c, "", amphtml.AMPCustom) {
+			continue
+		}
+		for t := c.FirstChild; t != nil; t = t.NextSibling {
+			if t.Type != html.TextNode {
+				continue
+			}
+			pruned, err := css.FilterRules(t.Data, doc.mayMatch)
+			if err != nil {
+				// Leave stylesheets that cannot be tokenized untouched.
+				continue
+			}
+			t.Data = pruned
+		}
+	}
+	return nil
+}
+
+// element is the part of an element that PruneUnusedCSS matches on.
+type element struct {
+	tag     string
+	id      string
+	classes map[string]bool
+}
+
+// selectorIndex is the set of elements in a document.
+type selectorIndex []element
+
+// collectSelectorIndex returns the elements of the document rooted at n. It
+// returns false if their classes or IDs may change at runtime.
+func collectSelectorIndex(n *html.Node) (selectorIndex, bool) {
+	var doc selectorIndex
+	for ; n != nil; n = htmlnode.Next(n) {
+		if n.Type != html.ElementNode {
+			continue
+		}
+		if n.Data == "amp-script" || n.DataAtom == atom.Template || (n.DataAtom == atom.Script && htmlnode.HasAttribute(n, "", "template")) {
+			return nil, false
+		}
+		el := element{tag: n.Data, classes: map[string]bool{}}
+		for _, attr := range n.Attr {
+			switch {
+			case attr.Key == "[class]" || attr.Key == "[id]" || attr.Key == "data-amp-bind-class" || attr.Key == "data-amp-bind-id":
+				return nil, false
+			case attr.Key == "on" && strings.Contains(attr.Val, "toggleClass"):
+				return nil, false
+			case attr.Key == "id":
+				if strings.Contains(attr.Val, "{{") {
+					return nil, false
+				}
+				el.id = attr.Val
+			case attr.Key == "class":
+				if strings.Contains(attr.Val, "{{") {
+					return nil, false
+				}
+				for _, class := range strings.Fields(attr.Val) {
+					el.classes[class] = true
+				}
+			}
+		}
+		doc = append(doc, el)
+	}
+	return doc, true
+}
+
+// mayMatch returns false if none of the selectors in the list can match an
+// element of the document.
+func (this selectorIndex) mayMatch(prelude []css.Token) bool {
+	start := 0
+	for i := 0; i <= len(prelude); i++ {
+		if i < len(prelude) && prelude[i].Type != css.CommaToken {
+			i += skipComponentValue(prelude[i:])
+			continue
+		}
+		if this.selectorMayMatch(prelude[start:i]) {
+			return true
+		}
+		start = i + 1
+	}
+	return false
+}
+
+// compoundSelector holds the requirements of a compound selector that
+// PruneUnusedCSS understands. Anything else is assumed to match.
+type compoundSelector struct {
+	tag     string
+	id      string
+	classes []string
+}
+
+// selectorMayMatch returns false if the complex selector contains a compound
+// selector that no element of the document satisfies. It returns true for any
+// selector it doesn't understand.
+func (this selectorIndex) selectorMayMatch(selector []css.Token) bool {
+	var compound compoundSelector
+	for i := 0; i < len(selector); i++ {
+		tok := selector[i]
+		switch tok.Type {
+		case css.WhitespaceToken, css.EOFToken:
+			// A descendant combinator, or insignificant.
+			if !this.compoundMayMatch(compound) {
+				return false
+			}
+			compound = compoundSelector{}
+		case css.IdentToken:
+			// A type selector.
+			tag := strings.ToLower(tok.Value)
+			if strings.Contains(tag, "-") && !strings.HasPrefix(tag, "i-amphtml-") {
+				compound.tag = tag
+			}
+		case css.HashToken:
+			compound.id = tok.Value
+		case css.DelimToken:
+			switch tok.Value {
+			case ".":
+				if i+1 >= len(selector) || selector[i+1].Type != css.IdentToken {
+					return true
+				}
+				i++
+				class := selector[i].Value
+				if !strings.HasPrefix(class, "amp-") && !strings.HasPrefix(class, "i-amphtml-") {
+					compound.classes = append(compound.classes, class)
+				}
+			case ">", "+", "~":
+				if !this.compoundMayMatch(compound) {
+					return false
+				}
+				compound = compoundSelector{}
+			case "*":
+			default:
+				// E.g. the namespace separator "|".
+				return true
+			}
+		case css.ColonToken:
+			// A pseudo-class or pseudo-element; its argument, if any, is
+			// ignored.
+			for i+1 < len(selector) && selector[i+1].Type == css.ColonToken {
+				i++
+			}
+			if i+1 >= len(selector) {
+				return true
+			}
+			i++
+			switch selector[i].Type {
+			case css.IdentToken:
+			case css.FunctionToken:
+				i += skipComponentValue(selector[i:])
+			default:
+				return true
+			}
+		case css.OpenSquareToken:
+			// An attribute selector.
+			i += skipComponentValue(selector[i:])
+		default:
+			return true
+		}
+	}
+	return this.compoundMayMatch(compound)
+}
+
+// compoundMayMatch returns true if some element of the document satisfies the
+// compound selector's requirements.
+func (this selectorIndex) compoundMayMatch(compound compoundSelector) bool {
+	if compound.tag == "" && compound.id == "" && len(compound.classes) == 0 {
+		return true
+	}
+	for _, el := range this {
+		if compound.tag != "" && el.tag != compound.tag {
+			continue
+		}
+		if compound.id != "" && el.id != compound.id {
+			continue
+		}
+		matches := true
+		for _, class := range compound.classes {
+			if !el.classes[class] {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+// skipComponentValue returns the number of tokens to skip past the component
+// value (e.g. a block or function) that starts at tokens[0].
+func skipComponentValue(tokens []css.Token) int {
+	if len(tokens) == 0 {
+		return 0
+	}
+	depth := 0
+	for i := range tokens {
+		switch tokens[i].Type {
+		case css.FunctionToken, css.OpenParenToken, css.OpenSquareToken, css.OpenCurlyToken:
+			depth++
+		case css.CloseParenToken, css.CloseSquareToken, css.CloseCurlyToken:
+			depth--
+		}
+		if depth <= 0 {
+			return i
+		}
+	}
+	return len(tokens) - 1
+}
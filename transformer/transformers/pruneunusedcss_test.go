@@ -0,0 +1,126 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+func TestPruneUnusedCSS(t *testing.T) {
+	tcs := []struct {
+		desc, css, body, expected string
+		disabled                  bool
+	}{
+		{
+			desc:     "prunes rules for removed amp-ad",
+			css:      "amp-ad { margin: 0 } .ad-slot amp-ad, amp-ad > .label {} .kept { color: red }",
+			body:     `<p class="kept"></p>`,
+			expected: "  .kept { color: red }",
+		},
+		{
+			desc:     "keeps rules for present elements",
+			css:      "amp-ad { margin: 0 } #main .kept {}",
+			body:     `<div id="main"><amp-ad class="kept"></amp-ad></div>`,
+			expected: "amp-ad { margin: 0 } #main .kept {}",
+		},
+		{
+			desc:     "keeps list with any matching selector",
+			css:      ".gone, .kept {} .gone.kept {}",
+			body:     `<p class="kept"></p><p class="gone"></p>`,
+			expected: ".gone, .kept {} ",
+		},
+		{
+			desc:     "requires one element to match compound",
+			css:      ".a.b {} .a {}",
+			body:     `<p class="a"></p><p class="b"></p>`,
+			expected: " .a {}",
+		},
+		{
+			desc:     "keeps runtime selectors",
+			css:      "amp-img img {} .amp-active {} .i-amphtml-layout {} i-amphtml-sizer {} p:hover::before {} [hidden] {} svg|a {}",
+			body:     `<amp-img></amp-img><p></p>`,
+			expected: "amp-img img {} .amp-active {} .i-amphtml-layout {} i-amphtml-sizer {} p:hover::before {} [hidden] {} svg|a {}",
+		},
+		{
+			desc:     "ignores pseudo-class arguments",
+			css:      ".kept:not(.gone) {} .gone:not(.kept) {}",
+			body:     `<p class="kept"></p>`,
+			expected: ".kept:not(.gone) {} ",
+		},
+		{
+			desc:     "recurses into media",
+			css:      "@media (max-width: 600px) { amp-ad {} .kept {} } @font-face { font-family: x }",
+			body:     `<p class="kept"></p>`,
+			expected: "@media (max-width: 600px) {  .kept {} } @font-face { font-family: x }",
+		},
+		{
+			desc:     "amp-bind class binding disables pruning",
+			css:      ".gone {}",
+			body:     `<p [class]="state.classes"></p>`,
+			expected: ".gone {}",
+		},
+		{
+			desc:     "toggleClass disables pruning",
+			css:      ".gone {}",
+			body:     `<button on="tap:p.toggleClass(class=gone)"></button><p id="p"></p>`,
+			expected: ".gone {}",
+		},
+		{
+			desc:     "templates disable pruning",
+			css:      ".gone {}",
+			body:     `<amp-list src="https://example.com/l.json"><template type="amp-mustache"><p class="gone"></p></template></amp-list>`,
+			expected: ".gone {}",
+		},
+		{
+			desc:     "disabled",
+			css:      "amp-ad {}",
+			body:     `<p></p>`,
+			expected: "amp-ad {}",
+			disabled: true,
+		},
+	}
+	for _, tc := range tcs {
+		input := tt.Concat("<html><head><style amp-custom>", tc.css, "</style></head><body>", tc.body, "</body></html>")
+		expected := tt.Concat("<html><head><style amp-custom=\"\">", tc.expected, "</style></head><body>", tc.body, "</body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if err := transformers.PruneUnusedCSS(&transformers.Context{DOM: inputDOM, PruneUnusedCSS: !tc.disabled}); err != nil {
+			t.Errorf("%s: PruneUnusedCSS() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if output.String() != expected {
+			t.Errorf("%s: PruneUnusedCSS()=\n%q\nwant=\n%q", tc.desc, &output, expected)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// RelativeURL rewrites the absolute href and src attributes whose origin
+// (scheme, host, and port) is that of Context.BaseURL as path-absolute URLs,
+// preserving their query and fragment, to shorten the document. e.g. for
+// BaseURL https://www.example.com/index.html,
+//
+// <a href="https://www.example.com/foo?q#f">
+//
+//	transforms to
+//
+// <a href="/foo?q#f">
+//
+// Cross-origin URLs, and those without an origin (e.g. data: and mailto:),
+// are left alone, as are <link rel=canonical> and anything inside templates.
+//
+// This is opt-in; it does nothing unless Context.RelativeSameOriginURLs is
+// true. It undoes AbsoluteURL, so it should only be enabled for documents
+// that are served from their own origin, and not by an AMP Cache.
+func RelativeURL(e *Context) error {
+	if !e.RelativeSameOriginURLs || e.BaseURL == nil {
+		return nil
+	}
+	for n := e.DOM.RootNode; n != nil; n = htmlnode.Next(n) {
+		if n.Type != html.ElementNode || htmlnode.IsDescendantOf(n, atom.Template) {
+			continue
+		}
+		if n.DataAtom == atom.Link {
+			if rel, ok := htmlnode.GetAttributeVal(n, "", "rel"); ok && strings.EqualFold(strings.TrimSpace(rel), "canonical") {
+				continue
+			}
+		}
+		for _, key := range []string{"href", "src"} {
+			if attr, ok := htmlnode.FindAttribute(n, "", key); ok {
+				if relative, ok := relativeSameOriginURL(e.BaseURL, attr.Val); ok {
+					attr.Val = relative
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// relativeSameOriginURL returns the path-absolute form of the absolute URL
+// s, and true, if its origin is that of base. It slices s, rather than
+// re-serializing it, so that its path, query, and fragment are preserved
+// exactly.
+func relativeSameOriginURL(base *url.URL, s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	// Browsers treat backslashes in http(s) URLs as slashes, but url.Parse
+	// does not, so leave such URLs alone, rather than risk changing their
+	// origin.
+	if strings.ContainsRune(s, '\\') {
+		return "", false
+	}
+	u, err := url.Parse(s)
+	if err != nil || !u.IsAbs() || u.Opaque != "" || u.User != nil {
+		return "", false
+	}
+	if !strings.EqualFold(u.Scheme, base.Scheme) || !strings.EqualFold(u.Host, base.Host) {
+		return "", false
+	}
+	authority := strings.Index(s, "//")
+	if authority < 0 {
+		return "", false
+	}
+	rest := s[authority+2:]
+	end := strings.IndexAny(rest, "/?#")
+	if end < 0 {
+		return "/", true
+	}
+	relative := rest[end:]
+	if strings.HasPrefix(relative, "//") {
+		// Would be parsed as a protocol-relative URL, with another host.
+		return "", false
+	}
+	if relative[0] != '/' {
+		relative = "/" + relative
+	}
+	return relative, true
+}
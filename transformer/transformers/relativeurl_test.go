@@ -0,0 +1,123 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+func TestRelativeURL(t *testing.T) {
+	tcs := []struct {
+		desc, input, expected string
+		disabled              bool
+	}{
+		{
+			desc:     "Same-origin href",
+			input:    `<a href="https://www.example.com/foo">a</a>`,
+			expected: `<a href="/foo">a</a>`,
+		},
+		{
+			desc:     "Same-origin src",
+			input:    `<amp-img src="https://www.example.com/img.png"></amp-img>`,
+			expected: `<amp-img src="/img.png"></amp-img>`,
+		},
+		{
+			desc:     "Preserves query and fragment",
+			input:    `<a href="https://WWW.example.com/foo/bar%2F?a=1&amp;b=%20#frag">a</a>`,
+			expected: `<a href="/foo/bar%2F?a=1&amp;b=%20#frag">a</a>`,
+		},
+		{
+			desc:     "Empty path",
+			input:    `<a href="https://www.example.com">a</a><a href="https://www.example.com?q">b</a><a href="https://www.example.com#f">c</a>`,
+			expected: `<a href="/">a</a><a href="/?q">b</a><a href="/#f">c</a>`,
+		},
+		{
+			desc:     "Cross-origin",
+			input:    `<a href="https://other.example.com/foo">a</a><a href="http://www.example.com/foo">b</a><a href="https://www.example.com:8443/foo">c</a>`,
+			expected: `<a href="https://other.example.com/foo">a</a><a href="http://www.example.com/foo">b</a><a href="https://www.example.com:8443/foo">c</a>`,
+		},
+		{
+			desc:     "Non-http schemes",
+			input:    `<a href="mailto:devnull@example.com">a</a><amp-img src="data:image/png;base64,AAAA"></amp-img>`,
+			expected: `<a href="mailto:devnull@example.com">a</a><amp-img src="data:image/png;base64,AAAA"></amp-img>`,
+		},
+		{
+			desc:     "Relative",
+			input:    `<a href="/foo">a</a><a href="bar">b</a><a href="//www.example.com/baz">c</a>`,
+			expected: `<a href="/foo">a</a><a href="bar">b</a><a href="//www.example.com/baz">c</a>`,
+		},
+		{
+			desc:     "Path that would change origin",
+			input:    `<a href="https://www.example.com//evil.example/foo">a</a><a href="https://www.example.com\evil.example">b</a>`,
+			expected: `<a href="https://www.example.com//evil.example/foo">a</a><a href="https://www.example.com\evil.example">b</a>`,
+		},
+		{
+			desc:     "Userinfo",
+			input:    `<a href="https://user@www.example.com/foo">a</a>`,
+			expected: `<a href="https://user@www.example.com/foo">a</a>`,
+		},
+		{
+			desc:     "Canonical",
+			input:    `<link href="https://www.example.com/foo" rel="canonical"/><link href="https://www.example.com/style.css" rel="stylesheet"/>`,
+			expected: `<link href="https://www.example.com/foo" rel="canonical"/><link href="/style.css" rel="stylesheet"/>`,
+		},
+		{
+			desc:     "Template",
+			input:    `<template type="amp-mustache"><a href="https://www.example.com/foo">a</a></template>`,
+			expected: `<template type="amp-mustache"><a href="https://www.example.com/foo">a</a></template>`,
+		},
+		{
+			desc:     "Disabled",
+			input:    `<a href="https://www.example.com/foo">a</a>`,
+			expected: `<a href="https://www.example.com/foo">a</a>`,
+			disabled: true,
+		},
+	}
+	baseURL, _ := url.Parse("https://www.example.com/index.html")
+	for _, tc := range tcs {
+		input := tt.Concat("<html><head></head><body>", tc.input, "</body></html>")
+		expected := tt.Concat("<html><head></head><body>", tc.expected, "</body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		context := transformers.Context{DOM: inputDOM, DocumentURL: baseURL, BaseURL: baseURL, RelativeSameOriginURLs: !tc.disabled}
+		if err := transformers.RelativeURL(&context); err != nil {
+			t.Errorf("%s: RelativeURL() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if output.String() != expected {
+			t.Errorf("%s: RelativeURL()=\n%q\nwant=\n%q", tc.desc, &output, expected)
+		}
+	}
+}
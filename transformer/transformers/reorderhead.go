@@ -24,6 +24,21 @@ import (
 	"golang.org/x/net/html"
 )
 
+// fontProviderURLPrefixes are the URL prefixes of the font-provider
+// stylesheets AMP allows <link rel=stylesheet> to reference, per
+// https://amp.dev/documentation/guides-and-tutorials/develop/style_and_layout/custom_fonts/.
+var /* const */ fontProviderURLPrefixes = []string{
+	"https://cdnjs.cloudflare.com/ajax/libs/font-awesome/",
+	"https://cloud.typography.com/",
+	"https://fast.fonts.net/",
+	"https://fonts.googleapis.com/css",
+	"https://maxcdn.bootstrapcdn.com/font-awesome/",
+	"https://p.typekit.net/",
+	"https://pro.fontawesome.com/",
+	"https://use.fontawesome.com/",
+	"https://use.typekit.net/",
+}
+
 type headNodes struct {
 	linkFavicon                   []*html.Node
 	linkResourceHint              []*html.Node
@@ -57,6 +72,9 @@ type headNodes struct {
 // (10) <style amp-custom>
 // (11) any other tags allowed in <head>
 // (12) AMP boilerplate (first style amp-boilerplate, then noscript)
+// From version 9, font-provider <link rel=stylesheet> tags are placed in (9)
+// even if they follow <style amp-custom>, and those that duplicate an earlier
+// one's href are removed.
 func ReorderHead(e *Context) error {
 	hn := new(headNodes)
 
@@ -84,6 +102,10 @@ func ReorderHead(e *Context) error {
 	hn.scriptRenderDelaying = uniquifyAndSortByExtensionScript(hn.scriptRenderDelaying)
 	hn.scriptNonRenderDelaying = uniquifyAndSortByExtensionScript(hn.scriptNonRenderDelaying)
 
+	if e.Version >= 9 {
+		hoistFontStylesheets(hn)
+	}
+
 	// Remove children of <head>.
 	htmlnode.RemoveAllChildren(e.DOM.HeadNode)
 
@@ -147,6 +169,57 @@ func registerLink(n *html.Node, hn *headNodes) {
 	hn.other = append(hn.other, n)
 }
 
+// hoistFontStylesheets moves the font-provider stylesheets from other to
+// linkStylesheetBeforeAMPCustom, keeping only the first one for each href.
+func hoistFontStylesheets(hn *headNodes) {
+	seen := map[string]bool{}
+	var before []*html.Node
+	for _, n := range hn.linkStylesheetBeforeAMPCustom {
+		if href, ok := fontStylesheetHref(n); ok {
+			if seen[href] {
+				continue
+			}
+			seen[href] = true
+		}
+		before = append(before, n)
+	}
+	var other []*html.Node
+	for _, n := range hn.other {
+		if href, ok := fontStylesheetHref(n); ok {
+			if !seen[href] {
+				seen[href] = true
+				before = append(before, n)
+			}
+			continue
+		}
+		other = append(other, n)
+	}
+	hn.linkStylesheetBeforeAMPCustom = before
+	hn.other = other
+}
+
+// fontStylesheetHref returns the href of n, and true, if n is a
+// <link rel=stylesheet> for a font-provider stylesheet.
+func fontStylesheetHref(n *html.Node) (string, bool) {
+	if n.DataAtom != atom.Link {
+		return "", false
+	}
+	if rel, ok := htmlnode.GetAttributeVal(n, "", "rel"); !ok || !strings.EqualFold(strings.TrimSpace(rel), "stylesheet") {
+		return "", false
+	}
+	href, ok := htmlnode.GetAttributeVal(n, "", "href")
+	if !ok {
+		return "", false
+	}
+	href = strings.TrimSpace(href)
+	for _, prefix := range fontProviderURLPrefixes {
+		if strings.HasPrefix(href, prefix) {
+			return href, true
+		}
+	}
+	return "", false
+}
+
 // registerMeta registers <meta> tags to different variables depending on the attributes on the <meta> tag. These are (1) the required <meta charset> and (2) all other <meta> tags.
 func registerMeta(n *html.Node, hn *headNodes) {
 	if htmlnode.HasAttribute(n, "", "charset") {
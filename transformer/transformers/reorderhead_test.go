@@ -276,6 +276,60 @@ func TestReorderHead(t *testing.T) {
 	runReorderHeadTestcases(t, tcs)
 }
 
+func TestReorderHeadFontStylesheets(t *testing.T) {
+	const (
+		linkFontA   = `<link href="https://fonts.googleapis.com/css?family=A" rel="stylesheet"/>`
+		linkFontB   = `<link href="https://use.typekit.net/abc.css" rel="stylesheet"/>`
+		linkOther   = `<link href="https://example.com/style.css" rel="stylesheet"/>`
+		styleCustom = `<style amp-custom="">h1{color:red}</style>`
+	)
+	tcs := []tt.TestCase{
+		{
+			Desc:               "Leaves ordered font links",
+			TransformerVersion: 9,
+			Input:              tt.Concat("<html><head>", linkFontA, linkFontB, styleCustom, "</head><body></body></html>"),
+			Expected:           tt.Concat("<html><head>", linkFontA, linkFontB, styleCustom, "</head><body></body></html>"),
+		},
+		{
+			Desc:               "Removes duplicate font links",
+			TransformerVersion: 9,
+			Input:              tt.Concat("<html><head>", linkFontA, linkFontB, linkFontA, styleCustom, "</head><body></body></html>"),
+			Expected:           tt.Concat("<html><head>", linkFontA, linkFontB, styleCustom, "</head><body></body></html>"),
+		},
+		{
+			Desc:               "Moves late font links before amp-custom",
+			TransformerVersion: 9,
+			Input:              tt.Concat("<html><head>", linkFontA, styleCustom, tt.Title, linkFontB, "</head><body></body></html>"),
+			Expected:           tt.Concat("<html><head>", linkFontA, linkFontB, styleCustom, tt.Title, "</head><body></body></html>"),
+		},
+		{
+			Desc:               "Removes late duplicate font links",
+			TransformerVersion: 9,
+			Input:              tt.Concat("<html><head>", styleCustom, linkFontA, linkFontA, "</head><body></body></html>"),
+			Expected:           tt.Concat("<html><head>", linkFontA, styleCustom, "</head><body></body></html>"),
+		},
+		{
+			Desc:               "Leaves other stylesheets",
+			TransformerVersion: 9,
+			Input:              tt.Concat("<html><head>", styleCustom, linkOther, linkOther, "</head><body></body></html>"),
+			Expected:           tt.Concat("<html><head>", styleCustom, linkOther, linkOther, "</head><body></body></html>"),
+		},
+		{
+			Desc:               "Leaves font links with other rels",
+			TransformerVersion: 9,
+			Input:              tt.Concat("<html><head>", styleCustom, `<link href="https://fonts.googleapis.com/css?family=A" rel="preload"/>`, "</head><body></body></html>"),
+			Expected:           tt.Concat("<html><head>", styleCustom, `<link href="https://fonts.googleapis.com/css?family=A" rel="preload"/>`, "</head><body></body></html>"),
+		},
+		{
+			Desc:               "Leaves font links before version 9",
+			TransformerVersion: 8,
+			Input:              tt.Concat("<html><head>", linkFontA, styleCustom, linkFontA, "</head><body></body></html>"),
+			Expected:           tt.Concat("<html><head>", linkFontA, styleCustom, linkFontA, "</head><body></body></html>"),
+		},
+	}
+	runReorderHeadTestcases(t, tcs)
+}
+
 func runReorderHeadTestcases(t *testing.T, tcs []tt.TestCase) {
 	for _, tc := range tcs {
 		inputDoc, err := html.Parse(strings.NewReader(tc.Input))
@@ -288,7 +342,7 @@ func runReorderHeadTestcases(t *testing.T, tcs []tt.TestCase) {
 			t.Errorf("%s\namphtml.NewDOM for %s failed %q", tc.Desc, tc.Input, err)
 			continue
 		}
-		transformers.ReorderHead(&transformers.Context{DOM: inputDOM})
+		transformers.ReorderHead(&transformers.Context{DOM: inputDOM, Version: tc.TransformerVersion})
 
 		var input strings.Builder
 		if err := html.Render(&input, inputDoc); err != nil {
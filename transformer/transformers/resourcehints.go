@@ -0,0 +1,130 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// defaultMaxResourceHints is the number of hints ResourceHints emits if
+// Context.MaxResourceHints is zero.
+const defaultMaxResourceHints = 4
+
+// analyticsURLRE matches the absolute https URLs in an amp-analytics config.
+var analyticsURLRE = regexp.MustCompile(`https://[^\s"'\\/?#]+`)
+
+// ResourceHints adds <link rel="dns-prefetch preconnect"> hints to the <head>
+// for the origins the page will fetch from: the AMP CDN, the hosts of external
+// scripts and images, and the origins referenced by <amp-analytics> and
+// <amp-ad>. Origins that already have a preconnect or dns-prefetch hint are
+// skipped.
+//
+// At most Context.MaxResourceHints (or, if zero, 4) hints are added,
+// preferring the AMP CDN, then image origins, then the rest.
+//
+// This is opt-in; it does nothing unless Context.ResourceHints is true.
+//
+// This must run after URLRewrite, so that the hints are for the rewritten
+// URLs, and so that those URLRewrite added are not duplicated.
+func ResourceHints(e *Context) error {
+	if !e.ResourceHints {
+		return nil
+	}
+	existing := map[string]bool{}
+	for c := e.DOM.HeadNode.FirstChild; c != nil; c = c.NextSibling {
+		if c.DataAtom != atom.Link {
+			continue
+		}
+		rel, ok := htmlnode.GetAttributeVal(c, "", "rel")
+		if !ok || !(fieldsContain(strings.ToLower(rel), "preconnect") || fieldsContain(strings.ToLower(rel), "dns-prefetch")) {
+			continue
+		}
+		if href, ok := htmlnode.GetAttributeVal(c, "", "href"); ok {
+			if origin, ok := hintOrigin(e.BaseURL, href); ok {
+				existing[origin] = true
+			}
+		}
+	}
+
+	hints := make(preconnectMap)
+	add := func(ref string, priority preconnectPriority) {
+		if origin, ok := hintOrigin(e.BaseURL, ref); ok && !existing[origin] {
+			hints.add(origin, priority)
+		}
+	}
+	add(amphtml.AMPCacheSchemeAndHost, preconnectRuntime)
+	for n := e.DOM.RootNode; n != nil; n = htmlnode.Next(n) {
+		if n.Type != html.ElementNode {
+			continue
+		}
+		switch {
+		case n.DataAtom == atom.Script:
+			if src, ok := htmlnode.GetAttributeVal(n, "", "src"); ok {
+				add(src, preconnectOther)
+			}
+		case n.DataAtom == atom.Img || n.Data == "amp-img":
+			if src, ok := htmlnode.GetAttributeVal(n, "", "src"); ok {
+				add(src, preconnectImage)
+			}
+		case n.Data == "amp-ad" || n.Data == "amp-analytics":
+			for _, attr := range n.Attr {
+				if attr.Namespace == "" && strings.HasPrefix(attr.Val, "https://") {
+					add(attr.Val, preconnectOther)
+				}
+			}
+			// The inline config, if any, is JSON in a child <script>.
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				if c.DataAtom != atom.Script || c.FirstChild == nil {
+					continue
+				}
+				for _, ref := range analyticsURLRE.FindAllString(c.FirstChild.Data, -1) {
+					add(ref, preconnectOther)
+				}
+			}
+		}
+	}
+
+	max := e.MaxResourceHints
+	if max <= 0 {
+		max = defaultMaxResourceHints
+	}
+	for _, origin := range hints.selectPreconnects(max) {
+		e.DOM.HeadNode.AppendChild(preconnectLink(origin))
+	}
+	return nil
+}
+
+// hintOrigin returns the origin of ref, resolved relative to baseURL, if it
+// is an https URL worth hinting: one with a literal (not templated) host.
+func hintOrigin(baseURL *url.URL, ref string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return "", false
+	}
+	if baseURL != nil {
+		u = baseURL.ResolveReference(u)
+	}
+	if u.Scheme != "https" || u.Host == "" || strings.ContainsAny(u.Host, "${}") {
+		return "", false
+	}
+	return "https://" + strings.ToLower(u.Host), true
+}
@@ -0,0 +1,108 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+func hint(origin string) string {
+	return `<link href="` + origin + `" rel="dns-prefetch preconnect"/>`
+}
+
+func TestResourceHints(t *testing.T) {
+	tcs := []struct {
+		desc, head, body, expectedHead string
+		max                            int
+		disabled                       bool
+	}{
+		{
+			desc:         "AMP CDN",
+			expectedHead: hint("https://cdn.ampproject.org"),
+		},
+		{
+			desc: "scripts and images",
+			head: `<script async src="https://cdn.ampproject.org/v0.js"></script><script async custom-element="amp-foo" src="https://Scripts.example/foo.js"></script>`,
+			body: `<amp-img src="https://img.example/a.jpg" width="1" height="1"></amp-img><img src="/b.jpg"/><img src="http://insecure.example/c.jpg"/>`,
+			expectedHead: tt.Concat(`<script async="" src="https://cdn.ampproject.org/v0.js"></script><script async="" custom-element="amp-foo" src="https://Scripts.example/foo.js"></script>`,
+				hint("https://cdn.ampproject.org"), hint("https://example.com"), hint("https://img.example"), hint("https://scripts.example")),
+		},
+		{
+			desc: "amp-analytics and amp-ad",
+			body: tt.Concat(`<amp-analytics config="https://config.example/a.json"><script type="application/json">{"requests": {"pageview": "https://collect.example/p?u=${canonicalUrl}", "t": "https://${host}/x"}}</script></amp-analytics>`,
+				`<amp-ad type="a9" src="https://ads.example/ad.js"></amp-ad>`),
+			max:          5,
+			expectedHead: tt.Concat(hint("https://ads.example"), hint("https://cdn.ampproject.org"), hint("https://collect.example"), hint("https://config.example")),
+		},
+		{
+			desc: "dedupes existing hints",
+			head: `<link rel="preconnect" href="https://CDN.ampproject.org/"><link rel="dns-prefetch" href="//img.example">`,
+			body: `<amp-img src="https://img.example/a.jpg" width="1" height="1"></amp-img><amp-img src="https://other.example/a.jpg" width="1" height="1"></amp-img>`,
+			expectedHead: tt.Concat(`<link rel="preconnect" href="https://CDN.ampproject.org/"/><link rel="dns-prefetch" href="//img.example"/>`,
+				hint("https://other.example")),
+		},
+		{
+			desc: "cap prefers AMP CDN then images",
+			head: `<script async custom-element="amp-foo" src="https://a.example/foo.js"></script>`,
+			body: `<amp-img src="https://z.example/a.jpg" width="1" height="1"></amp-img><amp-img src="https://y.example/a.jpg" width="1" height="1"></amp-img>`,
+			max:  2,
+			expectedHead: tt.Concat(`<script async="" custom-element="amp-foo" src="https://a.example/foo.js"></script>`,
+				hint("https://cdn.ampproject.org"), hint("https://y.example")),
+		},
+		{
+			desc:     "disabled",
+			body:     `<amp-img src="https://img.example/a.jpg" width="1" height="1"></amp-img>`,
+			disabled: true,
+		},
+	}
+	baseURL, _ := url.Parse("https://example.com/")
+	for _, tc := range tcs {
+		input := tt.Concat("<html><head>", tc.head, "</head><body>", tc.body, "</body></html>")
+		expected := tt.Concat("<html><head>", tc.expectedHead, "</head><body>", tc.body, "</body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if tc.disabled {
+			expected = input
+		}
+		context := transformers.Context{DOM: inputDOM, BaseURL: baseURL, ResourceHints: !tc.disabled, MaxResourceHints: tc.max}
+		if err := transformers.ResourceHints(&context); err != nil {
+			t.Errorf("%s: ResourceHints() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if output.String() != expected {
+			t.Errorf("%s: ResourceHints()=\n%q\nwant=\n%q", tc.desc, &output, expected)
+		}
+	}
+}
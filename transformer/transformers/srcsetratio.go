@@ -0,0 +1,135 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"golang.org/x/net/html"
+)
+
+// ImageSizer returns the intrinsic width and height of the image at the given
+// absolute URL, or false if they are unknown.
+type ImageSizer func(u *url.URL) (width, height int, ok bool)
+
+// The maximum relative difference between two aspect ratios for them to be
+// considered consistent, allowing for rounding of scaled dimensions.
+const maxAspectRatioDifference = 0.01
+
+// SrcsetAspectRatio verifies that the candidates of each srcset attribute have
+// a consistent aspect ratio, as candidates differing from the element's
+// rendered ratio cause layout shift when selected. The reference ratio is that
+// of the element's width and height attributes, if both are present, or else
+// that of the first candidate with known dimensions. Each inconsistent
+// candidate is reported in Context.Warnings, and, if
+// Context.DropInconsistentSrcsetCandidates is set, removed from the srcset.
+//
+// This is opt-in; it does nothing unless Context.ImageSizer is set. Candidates
+// whose dimensions are unknown are left unmodified.
+//
+// This must run before URLRewrite, so that ImageSizer is passed the original
+// image URLs.
+func SrcsetAspectRatio(e *Context) error {
+	if e.ImageSizer == nil {
+		return nil
+	}
+	for n := e.DOM.RootNode; n != nil; n = htmlnode.Next(n) {
+		if n.Type != html.ElementNode || n.Namespace != "" {
+			continue
+		}
+		if srcset, ok := htmlnode.GetAttributeVal(n, "", "srcset"); ok {
+			checkSrcsetAspectRatio(e, n, srcset)
+		}
+	}
+	return nil
+}
+
+func checkSrcsetAspectRatio(e *Context, n *html.Node, srcset string) {
+	normalized, offsets := amphtml.ParseSrcset(srcset)
+	if len(offsets) == 0 {
+		return
+	}
+	ref, hasRef := elementAspectRatio(n)
+	var kept []string
+	dropped := false
+	for i, offset := range offsets {
+		end := len(normalized)
+		if i+1 < len(offsets) {
+			end = offsets[i+1].Start
+		}
+		candidate := strings.TrimRight(normalized[offset.Start:end], ", ")
+		src := normalized[offset.Start:offset.End]
+		ratio, ok := imageAspectRatio(e, src)
+		switch {
+		case !ok:
+		case !hasRef:
+			ref, hasRef = ratio, true
+		case math.Abs(ratio-ref)/ref > maxAspectRatioDifference:
+			e.Warn(WarningSrcsetAspectRatio, n,
+				"srcset candidate %s has aspect ratio %.3f, inconsistent with %.3f", src, ratio, ref)
+			if e.DropInconsistentSrcsetCandidates {
+				dropped = true
+				continue
+			}
+		}
+		kept = append(kept, candidate)
+	}
+	// If no candidate remains, leave the srcset as is rather than remove it;
+	// the element might have no src to fall back to.
+	if dropped && len(kept) > 0 {
+		htmlnode.SetAttribute(n, "", "srcset", strings.Join(kept, ", "))
+	}
+}
+
+// elementAspectRatio returns the ratio of n's width and height attributes, or
+// false if either is missing or not a positive number.
+func elementAspectRatio(n *html.Node) (float64, bool) {
+	width, ok := positiveNumberAttribute(n, "width")
+	if !ok {
+		return 0, false
+	}
+	height, ok := positiveNumberAttribute(n, "height")
+	if !ok {
+		return 0, false
+	}
+	return width / height, true
+}
+
+func positiveNumberAttribute(n *html.Node, key string) (float64, bool) {
+	val, ok := htmlnode.GetAttributeVal(n, "", key)
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(val), "px"), 64)
+	if err != nil || f <= 0 {
+		return 0, false
+	}
+	return f, true
+}
+
+// imageAspectRatio returns the ratio of the intrinsic dimensions of the image
+// at src, as reported by Context.ImageSizer, or false if they are unknown.
+func imageAspectRatio(e *Context, src string) (float64, bool) {
+	width, height, ok := intrinsicImageSize(e, src)
+	if !ok {
+		return 0, false
+	}
+	return float64(width) / float64(height), true
+}
@@ -0,0 +1,146 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+// fakeImageSizes are the dimensions known to fakeImageSizer.
+var fakeImageSizes = map[string][2]int{
+	"https://example.com/a-400.jpg":  {400, 300},
+	"https://example.com/a-800.jpg":  {800, 600},
+	"https://example.com/a-801.jpg":  {801, 600},
+	"https://example.com/b-800.jpg":  {800, 800},
+	"https://example.com/b-1600.jpg": {1600, 1600},
+}
+
+func fakeImageSizer(u *url.URL) (int, int, bool) {
+	size, ok := fakeImageSizes[u.String()]
+	return size[0], size[1], ok
+}
+
+func TestSrcsetAspectRatio(t *testing.T) {
+	tcs := []struct {
+		desc, input, expected string
+		drop                  bool
+		expectedWarnings      []string
+	}{
+		{
+			desc:     "Consistent candidates",
+			input:    `<amp-img srcset="a-400.jpg 400w, a-800.jpg 800w, a-801.jpg 801w"></amp-img>`,
+			expected: `<amp-img srcset="a-400.jpg 400w, a-800.jpg 800w, a-801.jpg 801w"></amp-img>`,
+		},
+		{
+			desc:             "Warns on inconsistent candidate",
+			input:            `<amp-img srcset="a-400.jpg 400w, b-800.jpg 800w"></amp-img>`,
+			expected:         `<amp-img srcset="a-400.jpg 400w, b-800.jpg 800w"></amp-img>`,
+			expectedWarnings: []string{"srcset candidate b-800.jpg has aspect ratio 1.000, inconsistent with 1.333"},
+		},
+		{
+			// The rewritten srcset is normalized by amphtml.ParseSrcset.
+			desc:             "Drops inconsistent candidate",
+			input:            `<amp-img srcset="a-400.jpg 400w, b-800.jpg 800w, a-800.jpg 1000w"></amp-img>`,
+			expected:         `<amp-img srcset="a-800.jpg 1000w, a-400.jpg 400w"></amp-img>`,
+			drop:             true,
+			expectedWarnings: []string{"srcset candidate b-800.jpg has aspect ratio 1.000, inconsistent with 1.333"},
+		},
+		{
+			desc:             "Compares against width and height attributes",
+			input:            `<amp-img width="100" height="100" srcset="a-400.jpg 400w, b-800.jpg 800w, b-1600.jpg 1600w"></amp-img>`,
+			expected:         `<amp-img width="100" height="100" srcset="b-1600.jpg 1600w, b-800.jpg 800w"></amp-img>`,
+			drop:             true,
+			expectedWarnings: []string{"srcset candidate a-400.jpg has aspect ratio 1.333, inconsistent with 1.000"},
+		},
+		{
+			desc:             "Leaves srcset if no candidate is consistent",
+			input:            `<img width="1" height="2" srcset="a-400.jpg 400w, b-800.jpg 800w">`,
+			expected:         `<img width="1" height="2" srcset="a-400.jpg 400w, b-800.jpg 800w"/>`,
+			drop:             true,
+			expectedWarnings: []string{"srcset candidate a-400.jpg has aspect ratio 1.333, inconsistent with 0.500", "srcset candidate b-800.jpg has aspect ratio 1.000, inconsistent with 0.500"},
+		},
+		{
+			desc:     "Ignores candidates of unknown size",
+			input:    `<amp-img srcset="unknown.jpg 400w, b-800.jpg 800w, b-1600.jpg 1600w"></amp-img>`,
+			expected: `<amp-img srcset="unknown.jpg 400w, b-800.jpg 800w, b-1600.jpg 1600w"></amp-img>`,
+			drop:     true,
+		},
+	}
+	baseURL, _ := url.Parse("https://example.com/")
+	for _, tc := range tcs {
+		input := tt.Concat("<html><head></head><body>", tc.input, "</body></html>")
+		expected := tt.Concat("<html><head></head><body>", tc.expected, "</body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		context := transformers.Context{DOM: inputDOM, BaseURL: baseURL, DocumentURL: baseURL,
+			ImageSizer: fakeImageSizer, DropInconsistentSrcsetCandidates: tc.drop}
+		if err := transformers.SrcsetAspectRatio(&context); err != nil {
+			t.Errorf("%s: SrcsetAspectRatio() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if output.String() != expected {
+			t.Errorf("%s: Transform=\n%q\nwant=\n%q", tc.desc, output.String(), expected)
+		}
+		if strings.Join(warningMessages(context.Warnings), "\n") != strings.Join(tc.expectedWarnings, "\n") {
+			t.Errorf("%s: Warnings=%q, want %q", tc.desc, warningMessages(context.Warnings), tc.expectedWarnings)
+		}
+	}
+}
+
+func TestSrcsetAspectRatioDisabled(t *testing.T) {
+	input := `<html><head></head><body><amp-img srcset="a-400.jpg 400w, b-800.jpg 800w"></amp-img></body></html>`
+	inputDoc, err := html.Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("html.Parse for %s failed %q", input, err)
+	}
+	inputDOM, err := amphtml.NewDOM(inputDoc)
+	if err != nil {
+		t.Fatalf("amphtml.NewDOM for %s failed %q", input, err)
+	}
+	context := transformers.Context{DOM: inputDOM, DropInconsistentSrcsetCandidates: true}
+	if err := transformers.SrcsetAspectRatio(&context); err != nil {
+		t.Fatalf("SrcsetAspectRatio() unexpectedly failed %q", err)
+	}
+	var output strings.Builder
+	if err := html.Render(&output, inputDoc); err != nil {
+		t.Fatalf("html.Render for %s failed %q", input, err)
+	}
+	if output.String() != input {
+		t.Errorf("Transform=\n%q\nwant=\n%q", output.String(), input)
+	}
+	if len(context.Warnings) != 0 {
+		t.Errorf("Warnings=%q, want none", context.Warnings)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"regexp"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	"github.com/ampproject/amppackager/transformer/internal/css"
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// maxAMPCustomStyleBytes is the maximum size of the <style amp-custom>
+// stylesheet, per
+// https://amp.dev/documentation/guides-and-tutorials/develop/style_and_layout/style_pages/.
+const maxAMPCustomStyleBytes = 75000
+
+// defaultCSSCommentKeepPattern matches license comments, as conventionally
+// preserved by CSS minifiers: /*! ... */, or those mentioning @license or
+// @preserve.
+var defaultCSSCommentKeepPattern = regexp.MustCompile(`^/\*!|@license|@preserve`)
+
+// StripCSSComments removes comments from the <style amp-custom> stylesheet,
+// except those matching Context.CSSCommentKeepPattern (by default, license
+// comments).
+//
+// <style amp-custom>/* Header */ h1 { color: red }</style>
+//            transforms to
+// <style amp-custom> h1 { color: red }</style>
+//
+// This is opt-in; it does nothing unless Context.StripCSSComments is true.
+// It returns an error if the stylesheet exceeds the AMP size limit, even after
+// stripping.
+func StripCSSComments(e *Context) error {
+	if !e.StripCSSComments {
+		return nil
+	}
+	keepPattern := e.CSSCommentKeepPattern
+	if keepPattern == nil {
+		keepPattern = defaultCSSCommentKeepPattern
+	}
+	for c := e.DOM.HeadNode.FirstChild; c != nil; c = c.NextSibling {
+		if c.DataAtom != atom.Style || !htmlnode.HasAttribute(c, "", amphtml.AMPCustom) {
+			continue
+		}
+		size := 0
+		for t := c.FirstChild; t != nil; t = t.NextSibling {
+			if t.Type == html.TextNode {
+				t.Data = css.StripComments(t.Data, keepPattern.MatchString)
+				size += len(t.Data)
+			}
+		}
+		if size > maxAMPCustomStyleBytes {
+			return errors.Errorf("<style amp-custom> is %d bytes, exceeding the limit of %d", size, maxAMPCustomStyleBytes)
+		}
+	}
+	return nil
+}
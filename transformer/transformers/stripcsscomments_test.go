@@ -0,0 +1,149 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+func TestStripCSSComments(t *testing.T) {
+	tcs := []struct {
+		desc, input, expected string
+		keepPattern           *regexp.Regexp
+	}{
+		{
+			desc:     "Strips ordinary comments",
+			input:    "<style amp-custom>/* Header */h1{color:red}/* Footer */footer{margin:0}</style>",
+			expected: "<style amp-custom>h1{color:red}footer{margin:0}</style>",
+		},
+		{
+			desc:     "Keeps license comments",
+			input:    "<style amp-custom>/*! Bootstrap | MIT License */h1{color:red}/* @license Apache */p{}/* ordinary */</style>",
+			expected: "<style amp-custom>/*! Bootstrap | MIT License */h1{color:red}/* @license Apache */p{}</style>",
+		},
+		{
+			desc:        "Keeps comments matching custom pattern",
+			input:       "<style amp-custom>/*! ordinary */h1{color:red}/* (c) Example Inc. */</style>",
+			expected:    "<style amp-custom>h1{color:red}/* (c) Example Inc. */</style>",
+			keepPattern: regexp.MustCompile(`\(c\)`),
+		},
+		{
+			desc:     "Leaves comment-like strings alone",
+			input:    `<style amp-custom>a::after{content:"/* not a comment */"}</style>`,
+			expected: `<style amp-custom>a::after{content:"/* not a comment */"}</style>`,
+		},
+		{
+			desc:     "Leaves other styles alone",
+			input:    "<style amp-boilerplate>/* boilerplate */</style><style amp-custom>/* custom */</style>",
+			expected: "<style amp-boilerplate>/* boilerplate */</style><style amp-custom></style>",
+		},
+	}
+	for _, tc := range tcs {
+		input := tt.Concat("<html><head>", tc.input, "</head><body></body></html>")
+		expected := tt.Concat("<html><head>", tc.expected, "</head><body></body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		context := transformers.Context{DOM: inputDOM, StripCSSComments: true, CSSCommentKeepPattern: tc.keepPattern}
+		if err := transformers.StripCSSComments(&context); err != nil {
+			t.Errorf("%s: StripCSSComments() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		expectedDoc, err := html.Parse(strings.NewReader(expected))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, expected, err)
+			continue
+		}
+		var expectedOutput strings.Builder
+		if err := html.Render(&expectedOutput, expectedDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, expected, err)
+			continue
+		}
+		if output.String() != expectedOutput.String() {
+			t.Errorf("%s: Transform=\n%q\nwant=\n%q", tc.desc, output.String(), expectedOutput.String())
+		}
+	}
+}
+
+func TestStripCSSCommentsDisabled(t *testing.T) {
+	input := "<html><head><style amp-custom>/* Header */</style></head><body></body></html>"
+	inputDoc, err := html.Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("html.Parse for %s failed %q", input, err)
+	}
+	inputDOM, err := amphtml.NewDOM(inputDoc)
+	if err != nil {
+		t.Fatalf("amphtml.NewDOM for %s failed %q", input, err)
+	}
+	if err := transformers.StripCSSComments(&transformers.Context{DOM: inputDOM}); err != nil {
+		t.Fatalf("StripCSSComments() unexpectedly failed %q", err)
+	}
+	var output strings.Builder
+	if err := html.Render(&output, inputDoc); err != nil {
+		t.Fatalf("html.Render for %s failed %q", input, err)
+	}
+	if !strings.Contains(output.String(), "/* Header */") {
+		t.Errorf("Transform=\n%q\nwant comment preserved", output.String())
+	}
+}
+
+func TestStripCSSCommentsSizeLimit(t *testing.T) {
+	tcs := []struct {
+		desc        string
+		css         string
+		expectError bool
+	}{
+		{"Under limit after stripping", "/*" + strings.Repeat(" ", 80000) + "*/h1{}", false},
+		{"Over limit after stripping", "h1{content:\"" + strings.Repeat("x", 80000) + "\"}", true},
+	}
+	for _, tc := range tcs {
+		input := tt.Concat("<html><head><style amp-custom>", tc.css, "</style></head><body></body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse failed %q", tc.desc, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM failed %q", tc.desc, err)
+			continue
+		}
+		err = transformers.StripCSSComments(&transformers.Context{DOM: inputDOM, StripCSSComments: true})
+		if tc.expectError && err == nil {
+			t.Errorf("%s: StripCSSComments() unexpectedly succeeded", tc.desc)
+		} else if !tc.expectError && err != nil {
+			t.Errorf("%s: StripCSSComments() unexpectedly failed %q", tc.desc, err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	"github.com/ampproject/amppackager/transformer/internal/css"
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// allowedCSSAtRules are the at-rules AMP allows in <style amp-custom>, per
+// https://amp.dev/documentation/guides-and-tutorials/develop/style_and_layout/style_pages/.
+// Vendor-prefixed variants, e.g. @-webkit-keyframes, are allowed too.
+var allowedCSSAtRules = map[string]bool{
+	"font-face": true,
+	"keyframes": true,
+	"media":     true,
+	"page":      true,
+	"supports":  true,
+}
+
+// disallowedCSSProperties are the properties AMP disallows in
+// <style amp-custom>.
+var disallowedCSSProperties = map[string]bool{
+	"behavior":     true,
+	"-moz-binding": true,
+}
+
+// StripDisallowedCSS removes the at-rules and properties that AMP disallows
+// from the <style amp-custom> stylesheet, e.g. @import, and the behavior and
+// -moz-binding properties, warning about each.
+//
+// <style amp-custom>@import url(a.css); h1 { behavior: url(a.htc); color: red }</style>
+//
+//	transforms to
+//
+// <style amp-custom> h1 { color: red }</style>
+//
+// This is opt-in; it does nothing unless Context.StripDisallowedCSS is true.
+// If Context.ErrorOnDisallowedCSS is true, it instead returns an error
+// listing them. Stylesheets that cannot be tokenized are left unmodified.
+//
+// This must run before URLRewrite, so that the URLs of removed imports aren't
+// rewritten or preconnected.
+func StripDisallowedCSS(e *Context) error {
+	if !e.StripDisallowedCSS {
+		return nil
+	}
+	allowAtRule := func(name string) bool { return allowedCSSAtRules[name] }
+	allowProperty := func(property string) bool { return !disallowedCSSProperties[property] }
+	for c := e.DOM.HeadNode.FirstChild; c != nil; c = c.NextSibling {
+		if c.DataAtom != atom.Style || !htmlnode.HasAttribute(c, "", amphtml.AMPCustom) {
+			continue
+		}
+		for t := c.FirstChild; t != nil; t = t.NextSibling {
+			if t.Type != html.TextNode {
+				continue
+			}
+			stripped, violations, err := css.StripDisallowed(t.Data, allowAtRule, allowProperty)
+			if err != nil || len(violations) == 0 {
+				continue
+			}
+			if e.ErrorOnDisallowedCSS {
+				descs := make([]string, len(violations))
+				for i, v := range violations {
+					descs[i] = describeCSSViolation(v)
+				}
+				return errors.Errorf("<style amp-custom> has disallowed CSS: %s", strings.Join(descs, ", "))
+			}
+			for _, v := range violations {
+				e.Warn(WarningDisallowedCSS, c, "removed %s", describeCSSViolation(v))
+			}
+			t.Data = stripped
+		}
+	}
+	return nil
+}
+
+// describeCSSViolation returns e.g. "@import on line 3".
+func describeCSSViolation(v css.Violation) string {
+	return fmt.Sprintf("%s on line %d", v.Name, v.Line)
+}
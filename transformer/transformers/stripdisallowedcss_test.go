@@ -0,0 +1,114 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+func TestStripDisallowedCSS(t *testing.T) {
+	tcs := []struct {
+		desc, input, expected string
+		expectedWarnings      []string
+		disabled              bool
+	}{
+		{
+			desc:             "Removes import",
+			input:            "<style amp-custom>@import url(a.css);\nh1{color:red}</style>",
+			expected:         "<style amp-custom=\"\">\nh1{color:red}</style>",
+			expectedWarnings: []string{"disallowed-css: removed @import on line 1 (at html > head > style:nth-child(1))"},
+		},
+		{
+			desc:             "Removes properties",
+			input:            "<style amp-custom>h1{color:red}\nh2{behavior:url(a.htc);-moz-binding:url(b.xml);margin:0}</style>",
+			expected:         "<style amp-custom=\"\">h1{color:red}\nh2{margin:0}</style>",
+			expectedWarnings: []string{"disallowed-css: removed behavior on line 2 (at html > head > style:nth-child(1))", "disallowed-css: removed -moz-binding on line 2 (at html > head > style:nth-child(1))"},
+		},
+		{
+			desc:     "Keeps valid rules",
+			input:    "<style amp-custom>@font-face{font-family:a}@-webkit-keyframes a{from{opacity:0}}@media print{@page{margin:0}h1{color:red}}@supports (display:grid){h1{display:grid}}</style>",
+			expected: "<style amp-custom=\"\">@font-face{font-family:a}@-webkit-keyframes a{from{opacity:0}}@media print{@page{margin:0}h1{color:red}}@supports (display:grid){h1{display:grid}}</style>",
+		},
+		{
+			desc:     "Leaves other styles alone",
+			input:    "<style amp-boilerplate>@import url(a.css);</style>",
+			expected: "<style amp-boilerplate=\"\">@import url(a.css);</style>",
+		},
+		{
+			desc:     "Disabled",
+			input:    "<style amp-custom>@import url(a.css);</style>",
+			expected: "<style amp-custom=\"\">@import url(a.css);</style>",
+			disabled: true,
+		},
+	}
+	for _, tc := range tcs {
+		input := tt.Concat("<html><head>", tc.input, "</head><body></body></html>")
+		expected := tt.Concat("<html><head>", tc.expected, "</head><body></body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		context := transformers.Context{DOM: inputDOM, StripDisallowedCSS: !tc.disabled}
+		if err := transformers.StripDisallowedCSS(&context); err != nil {
+			t.Errorf("%s: StripDisallowedCSS() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if output.String() != expected {
+			t.Errorf("%s: StripDisallowedCSS()=\n%q\nwant=\n%q", tc.desc, &output, expected)
+		}
+		var warnings []string
+		for _, w := range context.Warnings {
+			warnings = append(warnings, w.String())
+		}
+		if !reflect.DeepEqual(warnings, tc.expectedWarnings) {
+			t.Errorf("%s: StripDisallowedCSS() warnings=%q, want=%q", tc.desc, warnings, tc.expectedWarnings)
+		}
+	}
+}
+
+func TestStripDisallowedCSSErrors(t *testing.T) {
+	inputDoc, err := html.Parse(strings.NewReader("<html><head><style amp-custom>@import url(a.css);\nh1{behavior:url(a.htc)}</style></head><body></body></html>"))
+	if err != nil {
+		t.Fatalf("html.Parse failed %q", err)
+	}
+	inputDOM, err := amphtml.NewDOM(inputDoc)
+	if err != nil {
+		t.Fatalf("amphtml.NewDOM failed %q", err)
+	}
+	context := transformers.Context{DOM: inputDOM, StripDisallowedCSS: true, ErrorOnDisallowedCSS: true}
+	err = transformers.StripDisallowedCSS(&context)
+	expectedError := "<style amp-custom> has disallowed CSS: @import on line 1, behavior on line 2"
+	if err == nil || err.Error() != expectedError {
+		t.Errorf("StripDisallowedCSS()=%v, want %q", err, expectedError)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// The http-equiv directives that AMP allows, mapped to a regexp their content
+// must match, or nil if any content is allowed. See
+// https://github.com/ampproject/amphtml/blob/main/validator/validator-main.protoascii.
+var allowedHTTPEquiv = map[string]*regexp.Regexp{
+	"content-language":       nil,
+	"content-script-type":    regexp.MustCompile(`(?i)^text/javascript$`),
+	"content-style-type":     regexp.MustCompile(`(?i)^text/css$`),
+	"content-type":           regexp.MustCompile(`(?i)^text/html; ?charset=utf-8$`),
+	"imagetoolbar":           nil,
+	"origin-trial":           nil,
+	"pics-label":             nil,
+	"resource-type":          nil,
+	"x-dns-prefetch-control": nil,
+	"x-ua-compatible":        regexp.MustCompile(`(?i)^\s*(ie=edge|chrome=1)\s*(,\s*(ie=edge|chrome=1)\s*)*$`),
+}
+
+// StripHTTPEquiv removes the <meta http-equiv> directives that AMP disallows,
+// e.g. refresh, which AMP pages may not use to redirect, and
+// Content-Security-Policy, which the packager sets itself.
+// - Remove those whose http-equiv isn't one of allowedHTTPEquiv, or whose
+//   content doesn't match it, e.g. an X-UA-Compatible other than IE=edge or
+//   chrome=1, or a Content-Type with a charset other than utf-8.
+// - Remove those outside of <head>.
+// <meta charset> and <meta name> tags are unaffected. Each removal is reported
+// in Context.Warnings. Before version 9, this is a no-op.
+func StripHTTPEquiv(e *Context) error {
+	if e.Version < 9 {
+		return nil
+	}
+	for n := e.DOM.RootNode; n != nil; n = htmlnode.Next(n) {
+		if n.Type != html.ElementNode || n.DataAtom != atom.Meta {
+			continue
+		}
+		httpEquiv, ok := htmlnode.GetAttributeVal(n, "", "http-equiv")
+		if !ok {
+			continue
+		}
+		content, _ := htmlnode.GetAttributeVal(n, "", "content")
+		contentRE, allowed := allowedHTTPEquiv[strings.ToLower(strings.TrimSpace(httpEquiv))]
+		switch {
+		case !allowed:
+			e.Warn(WarningHTTPEquiv, n, "removed disallowed <meta http-equiv=%q>", httpEquiv)
+		case contentRE != nil && !contentRE.MatchString(content):
+			e.Warn(WarningHTTPEquiv, n, "removed <meta http-equiv=%q> with disallowed content %q", httpEquiv, content)
+		case n.Parent != e.DOM.HeadNode:
+			e.Warn(WarningHTTPEquiv, n, "removed <meta http-equiv=%q> outside of <head>", httpEquiv)
+		default:
+			continue
+		}
+		htmlnode.RemoveNode(&n)
+	}
+	return nil
+}
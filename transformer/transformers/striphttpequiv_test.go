@@ -0,0 +1,130 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+func TestStripHTTPEquiv(t *testing.T) {
+	tcs := []tt.TestCase{
+		{
+			Desc:               "strips refresh",
+			TransformerVersion: 9,
+			Input:              "<html><head><meta charset=utf-8><meta http-equiv=refresh content=\"0; url=https://example.com/\"></head><body></body></html>",
+			Expected:           "<html><head><meta charset=utf-8></head><body></body></html>",
+		},
+		{
+			Desc:               "no-op before version 9",
+			TransformerVersion: 8,
+			Input:              "<html><head><meta http-equiv=refresh content=\"0; url=https://example.com/\"></head><body></body></html>",
+			Expected:           "<html><head><meta http-equiv=refresh content=\"0; url=https://example.com/\"></head><body></body></html>",
+		},
+		{
+			Desc:               "strips Content-Security-Policy",
+			TransformerVersion: 9,
+			Input:              "<html><head><meta http-equiv=Content-Security-Policy content=\"default-src 'self'\"></head><body></body></html>",
+			Expected:           "<html><head></head><body></body></html>",
+		},
+		{
+			Desc:               "keeps utf-8 Content-Type",
+			TransformerVersion: 9,
+			Input:              "<html><head><meta http-equiv=Content-Type content=\"text/html; charset=UTF-8\"></head><body></body></html>",
+			Expected:           "<html><head><meta http-equiv=Content-Type content=\"text/html; charset=UTF-8\"></head><body></body></html>",
+		},
+		{
+			Desc:               "strips other Content-Type",
+			TransformerVersion: 9,
+			Input:              "<html><head><meta http-equiv=content-type content=\"text/html; charset=iso-8859-1\"></head><body></body></html>",
+			Expected:           "<html><head></head><body></body></html>",
+		},
+		{
+			Desc:               "keeps X-UA-Compatible IE=edge",
+			TransformerVersion: 9,
+			Input:              "<html><head><meta http-equiv=X-UA-Compatible content=\"IE=edge,chrome=1\"></head><body></body></html>",
+			Expected:           "<html><head><meta http-equiv=X-UA-Compatible content=\"IE=edge,chrome=1\"></head><body></body></html>",
+		},
+		{
+			Desc:               "strips other X-UA-Compatible",
+			TransformerVersion: 9,
+			Input:              "<html><head><meta http-equiv=X-UA-Compatible content=IE=EmulateIE7></head><body></body></html>",
+			Expected:           "<html><head></head><body></body></html>",
+		},
+		{
+			Desc:               "keeps content-language",
+			TransformerVersion: 9,
+			Input:              "<html><head><meta http-equiv=content-language content=en></head><body></body></html>",
+			Expected:           "<html><head><meta http-equiv=content-language content=en></head><body></body></html>",
+		},
+		{
+			Desc:               "strips http-equiv in body",
+			TransformerVersion: 9,
+			Input:              "<html><head></head><body><meta http-equiv=content-language content=en><p>a</p></body></html>",
+			Expected:           "<html><head></head><body><p>a</p></body></html>",
+		},
+		{
+			Desc:               "keeps meta name",
+			TransformerVersion: 9,
+			Input:              "<html><head><meta name=viewport content=width=device-width></head><body></body></html>",
+			Expected:           "<html><head><meta name=viewport content=width=device-width></head><body></body></html>",
+		},
+	}
+	for _, tc := range tcs {
+		inputDoc, err := html.Parse(strings.NewReader(tc.Input))
+		if err != nil {
+			t.Errorf("%s: html.Parse failed %q", tc.Input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s\namphtml.NewDOM for %s failed %q", tc.Desc, tc.Input, err)
+			continue
+		}
+		context := transformers.Context{DOM: inputDOM, Version: tc.TransformerVersion}
+		if err := transformers.StripHTTPEquiv(&context); err != nil {
+			t.Errorf("%s: StripHTTPEquiv() unexpectedly failed %q", tc.Desc, err)
+			continue
+		}
+		var input strings.Builder
+		if err := html.Render(&input, inputDoc); err != nil {
+			t.Errorf("%s: html.Render failed %q", tc.Input, err)
+			continue
+		}
+
+		expectedDoc, err := html.Parse(strings.NewReader(tc.Expected))
+		if err != nil {
+			t.Errorf("%s: html.Parse failed %q", tc.Expected, err)
+			continue
+		}
+		var expected strings.Builder
+		err = html.Render(&expected, expectedDoc)
+		if err != nil {
+			t.Errorf("%s: html.Render failed %q", tc.Expected, err)
+			continue
+		}
+		if input.String() != expected.String() {
+			t.Errorf("%s: Transform=\n%q\nwant=\n%q", tc.Desc, &input, &expected)
+		}
+		if removed := tc.Input != tc.Expected; removed != (len(context.Warnings) > 0) {
+			t.Errorf("%s: Warnings=%v", tc.Desc, context.Warnings)
+		}
+	}
+}
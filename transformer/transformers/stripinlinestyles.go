@@ -0,0 +1,123 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"strings"
+
+	"github.com/ampproject/amppackager/transformer/internal/css"
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"golang.org/x/net/html"
+)
+
+// StripInlineStyles removes the declarations within style attributes that
+// match Context.DisallowedInlineStyles, leaving the rest. For example, with
+// "position:fixed" disallowed,
+//
+// <div style="position: fixed; color: red">
+//            transforms to
+// <div style=" color: red">
+//
+// The style attribute is removed if no declarations remain. Style attributes
+// that cannot be tokenized are left unmodified.
+//
+// This is opt-in; it does nothing unless Context.DisallowedInlineStyles is
+// non-empty.
+//
+// This must run before ServerSideRendering, so that it only strips authored
+// styles, and before URLRewrite, so that URLs are only rewritten (and
+// preconnected) for the declarations that remain.
+func StripInlineStyles(e *Context) error {
+	if len(e.DisallowedInlineStyles) == 0 {
+		return nil
+	}
+	disallowed := parseDisallowedInlineStyles(e.DisallowedInlineStyles)
+	for n := e.DOM.RootNode; n != nil; n = htmlnode.Next(n) {
+		if n.Type != html.ElementNode {
+			continue
+		}
+		attr, ok := htmlnode.FindAttribute(n, "", "style")
+		if !ok {
+			continue
+		}
+		decls, err := css.ParseDeclarations(attr.Val)
+		if err != nil {
+			continue
+		}
+		var kept []string
+		stripped := false
+		for _, decl := range decls {
+			if disallowed.matches(decl) {
+				stripped = true
+				continue
+			}
+			kept = append(kept, decl.Raw)
+		}
+		if !stripped {
+			continue
+		}
+		style := strings.Join(kept, ";")
+		if strings.Trim(style, whitespace+";") == "" {
+			htmlnode.RemoveAttribute(n, attr)
+		} else {
+			attr.Val = style
+		}
+	}
+	return nil
+}
+
+// disallowedInlineStyles maps a property name to the values for which its
+// declarations are disallowed. A nil slice disallows every value.
+type disallowedInlineStyles map[string][]string
+
+// parseDisallowedInlineStyles parses entries of the form "property" or
+// "property:value".
+func parseDisallowedInlineStyles(entries []string) disallowedInlineStyles {
+	ret := disallowedInlineStyles{}
+	for _, entry := range entries {
+		property, value := entry, ""
+		if i := strings.IndexByte(entry, ':'); i != -1 {
+			property, value = entry[:i], strings.TrimSpace(entry[i+1:])
+		}
+		property = strings.ToLower(strings.TrimSpace(property))
+		if property == "" {
+			continue
+		}
+		values, ok := ret[property]
+		switch {
+		case value == "":
+			ret[property] = nil
+		case !ok || values != nil:
+			ret[property] = append(values, value)
+		}
+	}
+	return ret
+}
+
+func (this disallowedInlineStyles) matches(decl css.Declaration) bool {
+	values, ok := this[decl.Property]
+	if !ok {
+		return false
+	}
+	if values == nil {
+		return true
+	}
+	for _, value := range values {
+		if strings.EqualFold(decl.Value, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+func TestStripInlineStyles(t *testing.T) {
+	disallowed := []string{"position:fixed", "Behavior"}
+	tcs := []struct {
+		desc, input, expected string
+		disallowed            []string
+	}{
+		{
+			desc:       "strips disallowed property value",
+			input:      `<div style="position: fixed; color: red"></div>`,
+			expected:   `<div style=" color: red"></div>`,
+			disallowed: disallowed,
+		},
+		{
+			desc:       "keeps allowed value of property",
+			input:      `<div style="position: relative; color: red"></div>`,
+			expected:   `<div style="position: relative; color: red"></div>`,
+			disallowed: disallowed,
+		},
+		{
+			desc:       "strips disallowed property regardless of value",
+			input:      `<p style="color:red;BEHAVIOR:url(a.htc);margin:0"></p>`,
+			expected:   `<p style="color:red;margin:0"></p>`,
+			disallowed: disallowed,
+		},
+		{
+			desc:       "strips important and differently cased values",
+			input:      `<div style="color:red;position:FIXED !important"></div>`,
+			expected:   `<div style="color:red"></div>`,
+			disallowed: disallowed,
+		},
+		{
+			desc:       "removes attribute if nothing remains",
+			input:      `<div style="position:fixed;"></div>`,
+			expected:   `<div></div>`,
+			disallowed: disallowed,
+		},
+		{
+			desc:     "disabled without disallowed styles",
+			input:    `<div style="position: fixed; color: red"></div>`,
+			expected: `<div style="position: fixed; color: red"></div>`,
+		},
+	}
+	for _, tc := range tcs {
+		input := tt.Concat("<html><head></head><body>", tc.input, "</body></html>")
+		expected := tt.Concat("<html><head></head><body>", tc.expected, "</body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if err := transformers.StripInlineStyles(&transformers.Context{DOM: inputDOM, DisallowedInlineStyles: tc.disallowed}); err != nil {
+			t.Errorf("%s: StripInlineStyles() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if output.String() != expected {
+			t.Errorf("%s: StripInlineStyles()=\n%q\nwant=\n%q", tc.desc, &output, expected)
+		}
+	}
+}
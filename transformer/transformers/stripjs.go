@@ -71,7 +71,9 @@ func StripJS(e *Context) error {
 					htmlnode.RemoveNode(&n)
 				}
 			}
-		} else {
+		} else if e.Version < 9 {
+			// Before version 9, the attribute following each removed one
+			// was skipped, and so kept even if it matched.
 			for _, attr := range n.Attr {
 				if attr.Namespace == "" {
 					if match := eventRE.MatchString(attr.Key); match {
@@ -79,6 +81,15 @@ func StripJS(e *Context) error {
 					}
 				}
 			}
+		} else {
+			// Iterate in reverse, so that removals don't skip the
+			// following attribute. Note that AMP's on="tap:..." action
+			// attribute doesn't match eventRE, and is kept.
+			for i := len(n.Attr) - 1; i >= 0; i-- {
+				if n.Attr[i].Namespace == "" && eventRE.MatchString(n.Attr[i].Key) {
+					n.Attr = append(n.Attr[:i], n.Attr[i+1:]...)
+				}
+			}
 		}
 	}
 	return nil
@@ -106,6 +106,18 @@ func TestStripJS(t *testing.T) {
 			Input:    "<body><select on=\"myFunction()\"></body>",
 			Expected: "<body><select on=myFunction()></select></body>",
 		},
+		{
+			Desc:               "strips adjacent event attrs, keeps AMP actions",
+			TransformerVersion: 9,
+			Input:              "<body><button onclick=\"a()\" onmouseover=\"b()\" on=\"tap:lightbox.open\" ONLOAD=\"c()\">x</button></body>",
+			Expected:           "<body><button on=\"tap:lightbox.open\">x</button></body>",
+		},
+		{
+			Desc:               "skips the attr after a stripped one before version 9",
+			TransformerVersion: 8,
+			Input:              "<body><button onclick=\"a()\" onmouseover=\"b()\" on=\"tap:lightbox.open\" ONLOAD=\"c()\">x</button></body>",
+			Expected:           "<body><button onmouseover=\"b()\" on=\"tap:lightbox.open\">x</button></body>",
+		},
 		{
 			Desc:     "keep tag attr on-foo",
 			Input:    "<body><select on-foo=\"myFunction()\"></body>",
@@ -129,7 +141,7 @@ func TestStripJS(t *testing.T) {
 			t.Errorf("%s\namphtml.NewDOM for %s failed %q", tc.Desc, tc.Input, err)
 			continue
 		}
-		transformers.StripJS(&transformers.Context{DOM: inputDOM})
+		transformers.StripJS(&transformers.Context{DOM: inputDOM, Version: tc.TransformerVersion})
 		var input strings.Builder
 		if err := html.Render(&input, inputDoc); err != nil {
 			t.Errorf("%s: html.Render failed %q", tc.Input, err)
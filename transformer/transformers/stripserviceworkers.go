@@ -0,0 +1,89 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"strings"
+
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// StripServiceWorkers removes the author-added service worker and manifest
+// markup that AMP disallows. Service workers may only be installed via
+// <amp-install-serviceworker>, which is kept.
+// - Remove <link rel=serviceworker>.
+// - Remove <link rel=manifest> outside of <head>, after the first one,
+//   or in AMP4ADS and AMP4EMAIL documents.
+// - Remove inline <script>s that register a service worker, i.e. that are
+//   executable (no type, or a JavaScript type) and reference
+//   navigator.serviceWorker.
+// Each removal is reported in Context.Warnings. Before version 9, this is a
+// no-op.
+func StripServiceWorkers(e *Context) error {
+	if e.Version < 9 {
+		return nil
+	}
+	allowManifest := documentFormat(e.DOM.HTMLNode) == ""
+	for n := e.DOM.RootNode; n != nil; n = htmlnode.Next(n) {
+		if n.Type != html.ElementNode {
+			continue
+		}
+		switch n.DataAtom {
+		case atom.Link:
+			rel, _ := htmlnode.GetAttributeVal(n, "", "rel")
+			if fieldsContain(rel, "serviceworker") {
+				e.Warn(WarningServiceWorker, n, "removed <link rel=serviceworker>; use <amp-install-serviceworker> instead")
+				htmlnode.RemoveNode(&n)
+			} else if fieldsContain(rel, "manifest") {
+				if !allowManifest || n.Parent != e.DOM.HeadNode {
+					e.Warn(WarningServiceWorker, n, "removed disallowed <link rel=manifest>")
+					htmlnode.RemoveNode(&n)
+				} else {
+					// Only the first manifest applies.
+					allowManifest = false
+				}
+			}
+		case atom.Script:
+			if isServiceWorkerRegistration(n) {
+				e.Warn(WarningServiceWorker, n, "removed service worker registration <script>; use <amp-install-serviceworker> instead")
+				htmlnode.RemoveNode(&n)
+			}
+		}
+	}
+	return nil
+}
+
+// isServiceWorkerRegistration returns true if the <script> n is an executable
+// inline script that references navigator.serviceWorker.
+func isServiceWorkerRegistration(n *html.Node) bool {
+	if htmlnode.HasAttribute(n, "", "src") {
+		return false
+	}
+	if typeVal, ok := htmlnode.GetAttributeVal(n, "", "type"); ok {
+		switch strings.ToLower(strings.TrimSpace(typeVal)) {
+		case "", "text/javascript", "application/javascript", "module":
+		default:
+			return false
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode && strings.Contains(c.Data, "serviceWorker") {
+			return true
+		}
+	}
+	return false
+}
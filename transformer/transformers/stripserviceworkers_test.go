@@ -0,0 +1,130 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+func TestStripServiceWorkers(t *testing.T) {
+	tcs := []tt.TestCase{
+		{
+			Desc:               "strips registration script",
+			TransformerVersion: 9,
+			Input:              "<html><head></head><body><p>a</p><script>if ('serviceWorker' in navigator) { navigator.serviceWorker.register('/sw.js'); }</script></body></html>",
+			Expected:           "<html><head></head><body><p>a</p></body></html>",
+		},
+		{
+			Desc:               "no-op before version 9",
+			TransformerVersion: 8,
+			Input:              "<html><head><link rel=serviceworker href=/sw.js></head><body><script>navigator.serviceWorker.register('/sw.js')</script></body></html>",
+			Expected:           "<html><head><link rel=serviceworker href=/sw.js></head><body><script>navigator.serviceWorker.register('/sw.js')</script></body></html>",
+		},
+		{
+			Desc:               "strips module registration script",
+			TransformerVersion: 9,
+			Input:              "<html><head><script type=module>navigator.serviceWorker.register('/sw.js')</script></head><body></body></html>",
+			Expected:           "<html><head></head><body></body></html>",
+		},
+		{
+			Desc:               "keeps JSON mentioning serviceWorker",
+			TransformerVersion: 9,
+			Input:              "<html><head><script type=application/json>{\"serviceWorker\": true}</script></head><body></body></html>",
+			Expected:           "<html><head><script type=application/json>{\"serviceWorker\": true}</script></head><body></body></html>",
+		},
+		{
+			Desc:               "strips serviceworker link",
+			TransformerVersion: 9,
+			Input:              "<html><head><link rel=serviceworker href=/sw.js></head><body></body></html>",
+			Expected:           "<html><head></head><body></body></html>",
+		},
+		{
+			Desc:               "keeps manifest in head",
+			TransformerVersion: 9,
+			Input:              "<html><head><link rel=manifest href=/manifest.json></head><body></body></html>",
+			Expected:           "<html><head><link rel=manifest href=/manifest.json></head><body></body></html>",
+		},
+		{
+			Desc:               "strips duplicate manifest",
+			TransformerVersion: 9,
+			Input:              "<html><head><link rel=manifest href=/a.json><link rel=\"Manifest\" href=/b.json></head><body></body></html>",
+			Expected:           "<html><head><link rel=manifest href=/a.json></head><body></body></html>",
+		},
+		{
+			Desc:               "strips manifest in body",
+			TransformerVersion: 9,
+			Input:              "<html><head></head><body><link rel=manifest href=/manifest.json><p>a</p></body></html>",
+			Expected:           "<html><head></head><body><p>a</p></body></html>",
+		},
+		{
+			Desc:               "strips manifest in email",
+			TransformerVersion: 9,
+			Input:              "<html ⚡4email><head><link rel=manifest href=/manifest.json></head><body></body></html>",
+			Expected:           "<html ⚡4email><head></head><body></body></html>",
+		},
+		{
+			Desc:               "keeps amp-install-serviceworker",
+			TransformerVersion: 9,
+			Input:              "<html><head></head><body><amp-install-serviceworker src=https://example.com/sw.js layout=nodisplay></amp-install-serviceworker></body></html>",
+			Expected:           "<html><head></head><body><amp-install-serviceworker src=https://example.com/sw.js layout=nodisplay></amp-install-serviceworker></body></html>",
+		},
+	}
+	for _, tc := range tcs {
+		inputDoc, err := html.Parse(strings.NewReader(tc.Input))
+		if err != nil {
+			t.Errorf("%s: html.Parse failed %q", tc.Input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s\namphtml.NewDOM for %s failed %q", tc.Desc, tc.Input, err)
+			continue
+		}
+		context := transformers.Context{DOM: inputDOM, Version: tc.TransformerVersion}
+		if err := transformers.StripServiceWorkers(&context); err != nil {
+			t.Errorf("%s: StripServiceWorkers() unexpectedly failed %q", tc.Desc, err)
+			continue
+		}
+		var input strings.Builder
+		if err := html.Render(&input, inputDoc); err != nil {
+			t.Errorf("%s: html.Render failed %q", tc.Input, err)
+			continue
+		}
+
+		expectedDoc, err := html.Parse(strings.NewReader(tc.Expected))
+		if err != nil {
+			t.Errorf("%s: html.Parse failed %q", tc.Expected, err)
+			continue
+		}
+		var expected strings.Builder
+		err = html.Render(&expected, expectedDoc)
+		if err != nil {
+			t.Errorf("%s: html.Render failed %q", tc.Expected, err)
+			continue
+		}
+		if input.String() != expected.String() {
+			t.Errorf("%s: Transform=\n%q\nwant=\n%q", tc.Desc, &input, &expected)
+		}
+		if removed := tc.Input != tc.Expected; removed != (len(context.Warnings) > 0) {
+			t.Errorf("%s: Warnings=%v", tc.Desc, context.Warnings)
+		}
+	}
+}
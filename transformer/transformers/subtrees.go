@@ -0,0 +1,160 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// The location of the children of <body>, per nodeLocation.
+const bodyChildLocation = "html > body > "
+
+// Subtrees marks the transformer fn as safe to run on independent subtrees of
+// the document concurrently, and returns a transformer that does so if
+// Context.ParallelSubtrees is true. Otherwise, the returned transformer just
+// runs fn.
+//
+// fn is safe to parallelize if running it on the whole document is equivalent
+// to running it first on the document with an empty <body>, and then on each
+// child of <body> in turn. That is, it visits the nodes in document order; its
+// changes to each node depend only on that node, its descendants, and
+// Context's options, not on <head> or other subtrees; it modifies nothing
+// outside the node it visits (other than removing or replacing it); and it
+// reports only via Context.Warnings, or its error.
+//
+// When run concurrently, each child of <body> is moved into a document of its
+// own (with copies of the <html> and <body> attributes), and processed
+// there, concurrently with the other children, and with the document with an
+// empty <body>. The results are then moved back into <body> in their original
+// order, and the warnings appended in document order, with their Locations as
+// if fn had run serially. If it fails on more than one subtree, the error for
+// the first, in document order, is returned.
+func Subtrees(fn func(*Context) error) func(*Context) error {
+	return func(e *Context) error {
+		if !e.ParallelSubtrees || e.DOM.BodyNode.FirstChild == nil {
+			return fn(e)
+		}
+		return runSubtrees(e, fn)
+	}
+}
+
+// runSubtrees runs fn concurrently on the children of <body>, per Subtrees.
+func runSubtrees(e *Context, fn func(*Context) error) error {
+	body := e.DOM.BodyNode
+	var children []*html.Node
+	for c := body.FirstChild; c != nil; c = body.FirstChild {
+		body.RemoveChild(c)
+		children = append(children, c)
+	}
+
+	// Job 0 is the document itself, now with an empty <body>.
+	jobs := make([]Context, len(children)+1)
+	jobs[0] = *e
+	jobs[0].Warnings = nil
+	for i, c := range children {
+		jobs[i+1] = *e
+		jobs[i+1].DOM = subtreeDOM(e.DOM, c)
+		jobs[i+1].Warnings = nil
+	}
+
+	concurrency := e.MaxSubtreeConcurrency
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+	sem := make(chan struct{}, concurrency)
+	errs := make([]error, len(jobs))
+	var wg sync.WaitGroup
+	for i := range jobs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = fn(&jobs[i])
+		}(i)
+	}
+	wg.Wait()
+
+	e.Warnings = append(e.Warnings, jobs[0].Warnings...)
+	// The number of element children of <body> so far, which precede those
+	// of the subtree being moved back.
+	elements := 0
+	for _, job := range jobs[1:] {
+		for _, warning := range job.Warnings {
+			warning.Location = offsetBodyChildLocation(warning.Location, elements)
+			e.Warnings = append(e.Warnings, warning)
+		}
+		subtreeBody := job.DOM.BodyNode
+		for c := subtreeBody.FirstChild; c != nil; c = subtreeBody.FirstChild {
+			subtreeBody.RemoveChild(c)
+			body.AppendChild(c)
+			if c.Type == html.ElementNode {
+				elements++
+			}
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subtreeDOM returns a new DOM whose <body> contains only n, and whose <html>
+// and <body> have copies of the attributes of those of dom.
+func subtreeDOM(dom *amphtml.DOM, n *html.Node) *amphtml.DOM {
+	root := &html.Node{Type: html.DocumentNode}
+	htmlNode := &html.Node{Type: html.ElementNode, DataAtom: atom.Html, Data: "html",
+		Attr: append([]html.Attribute(nil), dom.HTMLNode.Attr...)}
+	head := &html.Node{Type: html.ElementNode, DataAtom: atom.Head, Data: "head"}
+	body := &html.Node{Type: html.ElementNode, DataAtom: atom.Body, Data: "body",
+		Attr: append([]html.Attribute(nil), dom.BodyNode.Attr...)}
+	root.AppendChild(htmlNode)
+	htmlNode.AppendChild(head)
+	htmlNode.AppendChild(body)
+	body.AppendChild(n)
+	return &amphtml.DOM{RootNode: root, HTMLNode: htmlNode, HeadNode: head, BodyNode: body}
+}
+
+// offsetBodyChildLocation returns location, a nodeLocation within the
+// document of a subtree, with the position of its child of <body> advanced by
+// offset, the number of elements that precede the subtree in the document.
+func offsetBodyChildLocation(location string, offset int) string {
+	if offset == 0 || !strings.HasPrefix(location, bodyChildLocation) {
+		return location
+	}
+	step := strings.TrimPrefix(location, bodyChildLocation)
+	rest := ""
+	if i := strings.Index(step, " > "); i >= 0 {
+		step, rest = step[:i], step[i:]
+	}
+	i := strings.LastIndex(step, ":nth-child(")
+	if i < 0 || !strings.HasSuffix(step, ")") {
+		return location
+	}
+	position, err := strconv.Atoi(step[i+len(":nth-child(") : len(step)-1])
+	if err != nil {
+		return location
+	}
+	return bodyChildLocation + step[:i] + ":nth-child(" + strconv.Itoa(position+offset) + ")" + rest
+}
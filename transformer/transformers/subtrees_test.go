@@ -0,0 +1,96 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// removeAndWarn removes every <s>, and warns of every <p>, and fails at the
+// first <b>.
+func removeAndWarn(e *transformers.Context) error {
+	for n := e.DOM.RootNode; n != nil; n = htmlnode.Next(n) {
+		switch n.DataAtom {
+		case atom.S:
+			htmlnode.RemoveNode(&n)
+		case atom.P:
+			e.Warn(transformers.WarningDuplicateAttribute, n, "p %s", n.FirstChild.Data)
+		case atom.B:
+			return errors.Errorf("b %s", n.FirstChild.Data)
+		}
+	}
+	return nil
+}
+
+func runSubtrees(t *testing.T, input string, parallel bool) (string, []transformers.Warning, error) {
+	doc, err := html.Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("%s: html.Parse failed %q", input, err)
+	}
+	dom, err := amphtml.NewDOM(doc)
+	if err != nil {
+		t.Fatalf("%s: amphtml.NewDOM failed %q", input, err)
+	}
+	context := transformers.Context{DOM: dom, ParallelSubtrees: parallel, MaxSubtreeConcurrency: 2}
+	err = transformers.Subtrees(removeAndWarn)(&context)
+	var output strings.Builder
+	if err := html.Render(&output, doc); err != nil {
+		t.Fatalf("%s: html.Render failed %q", input, err)
+	}
+	return output.String(), context.Warnings, err
+}
+
+func TestSubtrees(t *testing.T) {
+	input := "<html><head></head><body><s>a</s>text<p>1</p><s>b</s><div><s>c</s><p>2</p></div><p>3</p><s>d</s>more<section><p>4</p></section></body></html>"
+	serial, serialWarnings, err := runSubtrees(t, input, false)
+	if err != nil {
+		t.Fatalf("serial: unexpected failure %q", err)
+	}
+	parallel, parallelWarnings, err := runSubtrees(t, input, true)
+	if err != nil {
+		t.Fatalf("parallel: unexpected failure %q", err)
+	}
+	if serial != parallel {
+		t.Errorf("parallel=\n%q\nwant=\n%q", parallel, serial)
+	}
+	if diff := cmp.Diff(serialWarnings, parallelWarnings); diff != "" {
+		t.Errorf("parallel warnings differ (-serial +parallel):\n%s", diff)
+	}
+	if want := "html > body > section:nth-child(4) > p:nth-child(1)"; len(parallelWarnings) != 4 || parallelWarnings[3].Location != want {
+		t.Errorf("parallel warnings=%v, want the last at %s", parallelWarnings, want)
+	}
+}
+
+func TestSubtreesFirstError(t *testing.T) {
+	input := "<html><head></head><body><p>1</p><div><b>first</b></div><b>second</b></body></html>"
+	_, _, serialErr := runSubtrees(t, input, false)
+	output, _, parallelErr := runSubtrees(t, input, true)
+	if serialErr == nil || parallelErr == nil || serialErr.Error() != parallelErr.Error() {
+		t.Errorf("parallel error %q, want %q", parallelErr, serialErr)
+	}
+	// The subtrees are moved back into <body>.
+	if want := "<html><head></head><body><p>1</p><div><b>first</b></div><b>second</b></body></html>"; output != want {
+		t.Errorf("parallel=\n%q\nwant=\n%q", output, want)
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// SVGResolver returns the markup of the external SVG document at the given
+// absolute URL (without fragment), e.g. a sprite sheet of <symbol>s.
+type SVGResolver func(u *url.URL) (string, error)
+
+// InlineSVGUse inlines the targets of external <use> references, such as
+// <use xlink:href="sprite.svg#icon">, so that the signed document does not
+// depend on additional fetches. The referenced element (typically a <symbol>)
+// is copied into a <defs> of the outermost enclosing <svg>, and the <use> is
+// rewritten to reference the local copy, e.g. <use xlink:href="#icon">.
+//
+// This is opt-in; it does nothing unless Context.SVGResolver is set. If the
+// resolver fails, or the referenced element cannot be found, the <use> is left
+// unmodified.
+//
+// This must run before StripJS, so that any scripts or event handlers within
+// the inlined markup are removed.
+func InlineSVGUse(e *Context) error {
+	if e.SVGResolver == nil {
+		return nil
+	}
+	s := svgInliner{
+		e:       e,
+		sprites: map[string]*html.Node{},
+		inlined: map[string]string{},
+		ids:     map[string]bool{},
+	}
+	for n := e.DOM.RootNode; n != nil; n = htmlnode.Next(n) {
+		if id, ok := htmlnode.GetAttributeVal(n, "", "id"); ok {
+			s.ids[id] = true
+		}
+	}
+	for n := e.DOM.RootNode; n != nil; n = htmlnode.Next(n) {
+		if n.Type == html.ElementNode && n.Namespace == "svg" && n.Data == "use" {
+			s.inlineUse(n)
+		}
+	}
+	return nil
+}
+
+type svgInliner struct {
+	e *Context
+	// Parsed external SVG documents, keyed by URL. A nil value indicates the
+	// document could not be resolved.
+	sprites map[string]*html.Node
+	// Local ids of already-inlined elements, keyed by absolute URL.
+	inlined map[string]string
+	// All ids in use in the document.
+	ids map[string]bool
+}
+
+func (this *svgInliner) inlineUse(n *html.Node) {
+	attr, ok := htmlnode.FindAttribute(n, "xlink", "href")
+	if !ok {
+		if attr, ok = htmlnode.FindAttribute(n, "", "href"); !ok {
+			return
+		}
+	}
+	href := strings.TrimSpace(attr.Val)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return
+	}
+	u, err := this.e.BaseURL.Parse(href)
+	if err != nil || u.Fragment == "" {
+		return
+	}
+	if id, ok := this.inlined[u.String()]; ok {
+		attr.Val = "#" + id
+		return
+	}
+	target := this.findTarget(u)
+	if target == nil {
+		return
+	}
+	svg := outermostSVG(n)
+	if svg == nil {
+		return
+	}
+	id := this.uniqueID(u.Fragment)
+	target.Parent.RemoveChild(target)
+	htmlnode.SetAttribute(target, "", "id", id)
+	removeCommentNodes(target)
+	defs := findOrCreateDefs(svg)
+	defs.AppendChild(target)
+	this.inlined[u.String()] = id
+	attr.Val = "#" + id
+}
+
+// findTarget returns the element with the id named by u's fragment, within the
+// resolved SVG document at u, or nil if there is none.
+func (this *svgInliner) findTarget(u *url.URL) *html.Node {
+	docURL := *u
+	docURL.Fragment = ""
+	key := docURL.String()
+	root, ok := this.sprites[key]
+	if !ok {
+		if markup, err := this.e.SVGResolver(&docURL); err == nil {
+			root, _ = html.Parse(strings.NewReader(markup))
+		}
+		this.sprites[key] = root
+	}
+	for c := root; c != nil; c = htmlnode.Next(c) {
+		if c.Type == html.ElementNode && c.Namespace == "svg" {
+			if id, ok := htmlnode.GetAttributeVal(c, "", "id"); ok && id == u.Fragment {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// uniqueID returns id, suffixed as necessary to avoid colliding with any
+// existing id in the document, and reserves it.
+func (this *svgInliner) uniqueID(id string) string {
+	candidate := id
+	for i := 1; this.ids[candidate]; i++ {
+		candidate = id + "-" + strconv.Itoa(i)
+	}
+	this.ids[candidate] = true
+	return candidate
+}
+
+// outermostSVG returns the outermost <svg> ancestor of n, or nil if none.
+func outermostSVG(n *html.Node) *html.Node {
+	var svg *html.Node
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type == html.ElementNode && p.DataAtom == atom.Svg {
+			svg = p
+		}
+	}
+	return svg
+}
+
+// findOrCreateDefs returns the first <defs> child of svg, prepending one if
+// none exists.
+func findOrCreateDefs(svg *html.Node) *html.Node {
+	for c := svg.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Namespace == "svg" && c.Data == "defs" {
+			return c
+		}
+	}
+	defs := htmlnode.Element("defs")
+	defs.Namespace = "svg"
+	svg.InsertBefore(defs, svg.FirstChild)
+	return defs
+}
+
+// removeCommentNodes removes all comment nodes within n.
+func removeCommentNodes(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.CommentNode {
+			n.RemoveChild(c)
+		} else {
+			removeCommentNodes(c)
+		}
+		c = next
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+)
+
+const spriteSVG = `<svg xmlns="http://www.w3.org/2000/svg">` +
+	`<symbol id="cart" viewBox="0 0 24 24"><!-- cart --><path d="M0 0h24v24H0z"></path></symbol>` +
+	`<symbol id="star" viewBox="0 0 24 24"><path d="M12 2l3 7h7z"></path></symbol>` +
+	`</svg>`
+
+// fakeSVGResolver serves spriteSVG at https://example.com/sprite.svg, and
+// records the URLs it was asked for.
+type fakeSVGResolver struct {
+	requested []string
+}
+
+func (this *fakeSVGResolver) resolve(u *url.URL) (string, error) {
+	this.requested = append(this.requested, u.String())
+	if u.String() != "https://example.com/sprite.svg" {
+		return "", errors.Errorf("not found: %s", u)
+	}
+	return spriteSVG, nil
+}
+
+func TestInlineSVGUse(t *testing.T) {
+	tcs := []struct {
+		desc, input, expected string
+		expectedRequests      int
+	}{
+		{
+			desc:             "Inlines symbol and rewrites xlink:href",
+			input:            `<svg><use xlink:href="sprite.svg#cart"></use></svg>`,
+			expected:         `<svg><defs><symbol id="cart" viewBox="0 0 24 24"><path d="M0 0h24v24H0z"></path></symbol></defs><use xlink:href="#cart"></use></svg>`,
+			expectedRequests: 1,
+		},
+		{
+			desc:             "Inlines symbol and rewrites href",
+			input:            `<svg><use href="https://example.com/sprite.svg#star"></use></svg>`,
+			expected:         `<svg><defs><symbol id="star" viewBox="0 0 24 24"><path d="M12 2l3 7h7z"></path></symbol></defs><use href="#star"></use></svg>`,
+			expectedRequests: 1,
+		},
+		{
+			desc:             "Inlines each symbol once and fetches each sprite once",
+			input:            `<svg><use xlink:href="sprite.svg#cart"></use></svg><svg><use xlink:href="sprite.svg#cart"></use><use xlink:href="sprite.svg#star"></use></svg>`,
+			expected:         `<svg><defs><symbol id="cart" viewBox="0 0 24 24"><path d="M0 0h24v24H0z"></path></symbol></defs><use xlink:href="#cart"></use></svg><svg><defs><symbol id="star" viewBox="0 0 24 24"><path d="M12 2l3 7h7z"></path></symbol></defs><use xlink:href="#cart"></use><use xlink:href="#star"></use></svg>`,
+			expectedRequests: 1,
+		},
+		{
+			desc:             "Appends to existing defs",
+			input:            `<svg><defs><linearGradient id="g"></linearGradient></defs><use xlink:href="sprite.svg#star"></use></svg>`,
+			expected:         `<svg><defs><linearGradient id="g"></linearGradient><symbol id="star" viewBox="0 0 24 24"><path d="M12 2l3 7h7z"></path></symbol></defs><use xlink:href="#star"></use></svg>`,
+			expectedRequests: 1,
+		},
+		{
+			desc:             "Avoids colliding with existing ids",
+			input:            `<div id="cart"></div><svg><use xlink:href="sprite.svg#cart"></use></svg>`,
+			expected:         `<div id="cart"></div><svg><defs><symbol id="cart-1" viewBox="0 0 24 24"><path d="M0 0h24v24H0z"></path></symbol></defs><use xlink:href="#cart-1"></use></svg>`,
+			expectedRequests: 1,
+		},
+		{
+			desc:             "Leaves local references alone",
+			input:            `<svg><symbol id="local"></symbol><use xlink:href="#local"></use></svg>`,
+			expected:         `<svg><symbol id="local"></symbol><use xlink:href="#local"></use></svg>`,
+			expectedRequests: 0,
+		},
+		{
+			desc:             "Leaves unknown symbols alone",
+			input:            `<svg><use xlink:href="sprite.svg#unknown"></use></svg>`,
+			expected:         `<svg><use xlink:href="sprite.svg#unknown"></use></svg>`,
+			expectedRequests: 1,
+		},
+		{
+			desc:             "Leaves unresolvable sprites alone",
+			input:            `<svg><use xlink:href="missing.svg#cart"></use></svg>`,
+			expected:         `<svg><use xlink:href="missing.svg#cart"></use></svg>`,
+			expectedRequests: 1,
+		},
+	}
+	baseURL, _ := url.Parse("https://example.com/")
+	for _, tc := range tcs {
+		input := tt.Concat("<html><head></head><body>", tc.input, "</body></html>")
+		expected := tt.Concat("<html><head></head><body>", tc.expected, "</body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		resolver := fakeSVGResolver{}
+		context := transformers.Context{DOM: inputDOM, BaseURL: baseURL, DocumentURL: baseURL, SVGResolver: resolver.resolve}
+		if err := transformers.InlineSVGUse(&context); err != nil {
+			t.Errorf("%s: InlineSVGUse() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if output.String() != expected {
+			t.Errorf("%s: Transform=\n%q\nwant=\n%q", tc.desc, output.String(), expected)
+		}
+		if len(resolver.requested) != tc.expectedRequests {
+			t.Errorf("%s: resolver called %d times, want %d: %v", tc.desc, len(resolver.requested), tc.expectedRequests, resolver.requested)
+		}
+	}
+}
+
+func TestInlineSVGUseDisabled(t *testing.T) {
+	input := `<html><head></head><body><svg><use xlink:href="sprite.svg#cart"></use></svg></body></html>`
+	inputDoc, err := html.Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("html.Parse for %s failed %q", input, err)
+	}
+	inputDOM, err := amphtml.NewDOM(inputDoc)
+	if err != nil {
+		t.Fatalf("amphtml.NewDOM for %s failed %q", input, err)
+	}
+	if err := transformers.InlineSVGUse(&transformers.Context{DOM: inputDOM}); err != nil {
+		t.Fatalf("InlineSVGUse() unexpectedly failed %q", err)
+	}
+	var output strings.Builder
+	if err := html.Render(&output, inputDoc); err != nil {
+		t.Fatalf("html.Render for %s failed %q", input, err)
+	}
+	if output.String() != input {
+		t.Errorf("Transform=\n%q\nwant=\n%q", output.String(), input)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// TrackingPixels converts tracking images, i.e. <img> and <amp-img> elements
+// that are 1x1 or whose src is on one of Context.TrackingPixelHosts (or a
+// subdomain), into <amp-pixel>, e.g.
+//   <img src=https://t.example/p.gif width=1 height=1> -> <amp-pixel src=https://t.example/p.gif layout=nodisplay>
+// Only images with an https src are converted, as amp-pixel requires. Images
+// within <noscript> or <template> are left unmodified.
+//
+// This is opt-in; it does nothing unless Context.ConvertTrackingPixels is
+// true.
+//
+// This must run after AbsoluteURL, and before ImgToAMPImg, so that tracking
+// <img>s aren't converted to <amp-img>.
+func TrackingPixels(e *Context) error {
+	if !e.ConvertTrackingPixels {
+		return nil
+	}
+	for n := e.DOM.BodyNode; n != nil; n = htmlnode.Next(n) {
+		if n.Type != html.ElementNode || n.Namespace != "" || (n.DataAtom != atom.Img && n.Data != "amp-img") {
+			continue
+		}
+		if htmlnode.IsDescendantOf(n, atom.Noscript) || htmlnode.IsDescendantOf(n, atom.Template) {
+			continue
+		}
+		src, ok := htmlnode.GetAttributeVal(n, "", "src")
+		if !ok {
+			continue
+		}
+		u, err := url.Parse(strings.TrimSpace(src))
+		if err == nil && e.BaseURL != nil {
+			u = e.BaseURL.ResolveReference(u)
+		}
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			continue
+		}
+		if !isTrackingPixel(e, n, u) {
+			continue
+		}
+		attrs := []html.Attribute{{Key: "src", Val: u.String()}, {Key: "layout", Val: "nodisplay"}}
+		if policy, ok := htmlnode.GetAttributeVal(n, "", "referrerpolicy"); ok && policy == "no-referrer" {
+			attrs = append(attrs, html.Attribute{Key: "referrerpolicy", Val: policy})
+		}
+		pixel := htmlnode.Element("amp-pixel", attrs...)
+		n.Parent.InsertBefore(pixel, n)
+		htmlnode.RemoveNode(&n)
+	}
+	return nil
+}
+
+// isTrackingPixel returns true if the image n, with the given src, is 1x1, or
+// is served from one of Context.TrackingPixelHosts.
+func isTrackingPixel(e *Context, n *html.Node, src *url.URL) bool {
+	width, _ := htmlnode.GetAttributeVal(n, "", "width")
+	height, _ := htmlnode.GetAttributeVal(n, "", "height")
+	if strings.TrimSpace(width) == "1" && strings.TrimSpace(height) == "1" {
+		return true
+	}
+	hostname := strings.ToLower(src.Hostname())
+	for _, host := range e.TrackingPixelHosts {
+		host = strings.ToLower(host)
+		if hostname == host || strings.HasSuffix(hostname, "."+host) {
+			return true
+		}
+	}
+	return false
+}
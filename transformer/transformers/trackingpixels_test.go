@@ -0,0 +1,94 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+func TestTrackingPixels(t *testing.T) {
+	tcs := []struct {
+		desc, input, expected string
+		disabled              bool
+	}{
+		{
+			desc:     "1x1 img",
+			input:    `<p>a<img src="https://t.example/p.gif?id=1" width="1" height="1" alt="" onload="x()">b</p>`,
+			expected: `<p>a<amp-pixel src="https://t.example/p.gif?id=1" layout="nodisplay"></amp-pixel>b</p>`,
+		},
+		{
+			desc:     "amp-img on tracking host",
+			input:    `<amp-img src="https://px.tracker.example/p.gif" width="10" height="10" referrerpolicy="no-referrer"></amp-img>`,
+			expected: `<amp-pixel src="https://px.tracker.example/p.gif" layout="nodisplay" referrerpolicy="no-referrer"></amp-pixel>`,
+		},
+		{
+			desc:     "relative src",
+			input:    `<img src="/p.gif" width="1" height="1">`,
+			expected: `<amp-pixel src="https://example.com/p.gif" layout="nodisplay"></amp-pixel>`,
+		},
+		{
+			desc:     "not tracking",
+			input:    `<img src="https://example.com/a.jpg" width="100" height="1"><img src="https://nottracker.example/a.jpg" width="1" height="5">`,
+			expected: `<img src="https://example.com/a.jpg" width="100" height="1"/><img src="https://nottracker.example/a.jpg" width="1" height="5"/>`,
+		},
+		{
+			desc:     "not https",
+			input:    `<img src="http://t.example/p.gif" width="1" height="1">`,
+			expected: `<img src="http://t.example/p.gif" width="1" height="1"/>`,
+		},
+		{
+			desc:     "disabled",
+			input:    `<img src="https://t.example/p.gif" width="1" height="1">`,
+			expected: `<img src="https://t.example/p.gif" width="1" height="1"/>`,
+			disabled: true,
+		},
+	}
+	baseURL, _ := url.Parse("https://example.com/")
+	for _, tc := range tcs {
+		input := tt.Concat("<html><head></head><body>", tc.input, "</body></html>")
+		expected := tt.Concat("<html><head></head><body>", tc.expected, "</body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		context := transformers.Context{DOM: inputDOM, BaseURL: baseURL,
+			ConvertTrackingPixels: !tc.disabled, TrackingPixelHosts: []string{"Tracker.example"}}
+		if err := transformers.TrackingPixels(&context); err != nil {
+			t.Errorf("%s: TrackingPixels() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if output.String() != expected {
+			t.Errorf("%s: TrackingPixels()=\n%q\nwant=\n%q", tc.desc, &output, expected)
+		}
+	}
+}
@@ -24,7 +24,7 @@ import (
 
 // elementExemptedExtensions are names of elements that indicate usage
 // of an equally named extension. e.g. If the <amp-iframe> element is present,
-// then the amp-iframe extension is in use. Used by insertMatchingExtensions.
+// then the amp-iframe extension is in use.
 var /* const */ elementExemptedExtensions = map[string]string{"amp-accordion": "", "amp-ad": "", "amp-anim": "", "amp-apester-media": "", "amp-audio": "", "amp-brid-player": "", "amp-brightcove": "", "amp-call-tracking": "", "amp-carousel": "", "amp-dailymotion": "", "amp-experiment": "", "amp-facebook": "", "amp-fit-text": "", "amp-font": "", "amp-fx-flying-carpet": "", "amp-gfycat": "", "amp-iframe": "", "amp-image-lightbox": "", "amp-instagram": "", "amp-install-serviceworker": "", "amp-izlesene": "", "amp-jwplayer": "", "amp-kaltura-player": "", "amp-lightbox": "", "amp-list": "", "amp-live-list": "", "amp-o2-player": "", "amp-pinterest": "", "amp-reach-player": "", "amp-selector": "", "amp-sidebar": "", "amp-social-share": "", "amp-soundcloud": "", "amp-springboard-player": "", "amp-sticky-ad": "", "amp-twitter": "", "amp-user-notification": "", "amp-vimeo": "", "amp-vine": "", "amp-youtube": ""}
 
 // differentElementExemptedExtensions are names of extensions that indicate
@@ -32,7 +32,93 @@ var /* const */ elementExemptedExtensions = map[string]string{"amp-accordion": "
 // element is present, then the amp-form extension is in use.
 var /* const */ differentElementExemptedExtensions = map[string]string{"amp-access": "", "amp-form": "", "amp-mustache": ""}
 
+// extensionElements maps the names of extensions to the names of the
+// elements that indicate their usage, e.g. amp-story-interactive to
+// amp-story-interactive-poll, among others. Context.PruneUnusedExtensions only
+// removes the scripts of extensions listed here; it keeps those of unknown
+// extensions, as well as of those that may be in use without any element
+// indicating it, e.g. amp-bind, which is activated by [attr] bindings on any
+// element.
+var /* const */ extensionElements = map[string][]string{
+	"amp-3d-gltf":               {"amp-3d-gltf"},
+	"amp-addthis":               {"amp-addthis"},
+	"amp-analytics":             {"amp-analytics"},
+	"amp-animation":             {"amp-animation"},
+	"amp-app-banner":            {"amp-app-banner"},
+	"amp-autocomplete":          {"amp-autocomplete"},
+	"amp-base-carousel":         {"amp-base-carousel"},
+	"amp-beopinion":             {"amp-beopinion"},
+	"amp-bodymovin-animation":   {"amp-bodymovin-animation"},
+	"amp-consent":               {"amp-consent"},
+	"amp-date-countdown":        {"amp-date-countdown"},
+	"amp-date-display":          {"amp-date-display"},
+	"amp-date-picker":           {"amp-date-picker"},
+	"amp-embedly-card":          {"amp-embedly-card", "amp-embedly-key"},
+	"amp-facebook-comments":     {"amp-facebook-comments"},
+	"amp-facebook-like":         {"amp-facebook-like"},
+	"amp-facebook-page":         {"amp-facebook-page"},
+	"amp-geo":                   {"amp-geo"},
+	"amp-gist":                  {"amp-gist"},
+	"amp-google-document-embed": {"amp-google-document-embed"},
+	"amp-hulu":                  {"amp-hulu"},
+	"amp-ima-video":             {"amp-ima-video"},
+	"amp-image-slider":          {"amp-image-slider"},
+	"amp-imgur":                 {"amp-imgur"},
+	"amp-inline-gallery":        {"amp-inline-gallery", "amp-inline-gallery-pagination", "amp-inline-gallery-thumbnails"},
+	"amp-link-rewriter":         {"amp-link-rewriter"},
+	"amp-mathml":                {"amp-mathml"},
+	"amp-mega-menu":             {"amp-mega-menu"},
+	"amp-nested-menu":           {"amp-nested-menu"},
+	"amp-next-page":             {"amp-next-page"},
+	"amp-orientation-observer":  {"amp-orientation-observer"},
+	"amp-pan-zoom":              {"amp-pan-zoom"},
+	"amp-position-observer":     {"amp-position-observer"},
+	"amp-recaptcha-input":       {"amp-recaptcha-input"},
+	"amp-reddit":                {"amp-reddit"},
+	"amp-render":                {"amp-render"},
+	"amp-script":                {"amp-script"},
+	"amp-skimlinks":             {"amp-skimlinks"},
+	"amp-smartlinks":            {"amp-smartlinks"},
+	"amp-story":                 {"amp-story"},
+	"amp-story-auto-ads":        {"amp-story-auto-ads"},
+	"amp-story-auto-analytics":  {"amp-story-auto-analytics"},
+	"amp-story-captions":        {"amp-story-captions"},
+	"amp-story-interactive":     {"amp-story-interactive-binary-poll", "amp-story-interactive-img-poll", "amp-story-interactive-img-quiz", "amp-story-interactive-poll", "amp-story-interactive-quiz", "amp-story-interactive-results", "amp-story-interactive-slider"},
+	"amp-story-panning-media":   {"amp-story-panning-media"},
+	"amp-story-player":          {"amp-story-player"},
+	"amp-story-shopping":        {"amp-story-shopping-attachment", "amp-story-shopping-config", "amp-story-shopping-tag"},
+	"amp-stream-gallery":        {"amp-stream-gallery"},
+	"amp-timeago":               {"amp-timeago"},
+	"amp-truncate-text":         {"amp-truncate-text"},
+	"amp-video":                 {"amp-video"},
+	"amp-video-iframe":          {"amp-video-iframe"},
+	"amp-vk":                    {"amp-vk"},
+	"amp-web-push":              {"amp-web-push", "amp-web-push-widget"},
+	"amp-wistia-player":         {"amp-wistia-player"},
+	"amp-wordpress-embed":       {"amp-wordpress-embed"},
+}
+
+// elementExtensions maps the names of the elements in extensionElements to
+// the names of their extensions.
+var /* const */ elementExtensions = func() map[string]string {
+	m := make(map[string]string)
+	for ext, elements := range extensionElements {
+		for _, el := range elements {
+			m[el] = ext
+		}
+	}
+	return m
+}()
+
+// templateRenderingElements are names of elements that may render a template
+// referenced by id, rather than one among their children.
+var /* const */ templateRenderingElements = map[string]string{"amp-autocomplete": "", "amp-date-picker": "", "amp-list": "", "amp-render": ""}
+
 // UnusedExtensions removes script tags for unused legacy-exempted extensions.
+// If Context.PruneUnusedExtensions is true, it also removes the
+// custom-element and custom-template script tags of any other extension in
+// extensionElements that is unused. The runtime and host-service scripts are
+// never removed.
 func UnusedExtensions(e *Context) error {
 	extensionsUsed := make(map[string]string)
 	for n := e.DOM.RootNode; n != nil; n = htmlnode.Next(n) {
@@ -40,7 +126,7 @@ func UnusedExtensions(e *Context) error {
 	}
 	for c := e.DOM.HeadNode.FirstChild; c != nil; c = c.NextSibling {
 		if ext, ok := amphtml.AMPExtensionName(c); ok {
-			if len(ext) > 0 && (isStringKeyInMap(ext, elementExemptedExtensions) || isStringKeyInMap(ext, differentElementExemptedExtensions)) && !isStringKeyInMap(ext, extensionsUsed) {
+			if len(ext) > 0 && (isStringKeyInMap(ext, elementExemptedExtensions) || isStringKeyInMap(ext, differentElementExemptedExtensions) || e.PruneUnusedExtensions && isPrunableExtension(c, ext)) && !isStringKeyInMap(ext, extensionsUsed) {
 				htmlnode.RemoveNode(&c)
 			}
 		}
@@ -48,6 +134,16 @@ func UnusedExtensions(e *Context) error {
 	return nil
 }
 
+// isPrunableExtension returns true if the script tag n for the extension ext
+// may be removed by Context.PruneUnusedExtensions, if ext is unused.
+func isPrunableExtension(n *html.Node, ext string) bool {
+	if !htmlnode.HasAttribute(n, "", amphtml.AMPCustomElement) && !htmlnode.HasAttribute(n, "", amphtml.AMPCustomTemplate) {
+		return false
+	}
+	_, ok := extensionElements[ext]
+	return ok
+}
+
 // insertMatchingExtensions inserts all extensions that might be activated
 // by the inclusion of this element. It's okay if it has false positives
 // (that just means we won't be as aggressive about removing their script
@@ -75,9 +171,15 @@ func insertMatchingExtensions(n *html.Node, e map[string]string) {
 	case "template":
 		e["amp-mustache"] = ""
 	default:
-		if _, ok := elementExemptedExtensions[n.Data]; ok {
+		if strings.HasPrefix(n.Data, "amp-") {
 			e[n.Data] = ""
 		}
+		if ext, ok := elementExtensions[n.Data]; ok {
+			e[ext] = ""
+		}
+		if _, ok := templateRenderingElements[n.Data]; ok {
+			e["amp-mustache"] = ""
+		}
 	}
 	return
 }
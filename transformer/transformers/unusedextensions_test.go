@@ -279,3 +279,124 @@ func TestUnusedExtensions(t *testing.T) {
 		}
 	}
 }
+
+const (
+	scriptAMPStoryInteractive = "<script async custom-element=amp-story-interactive src=https://cdn.ampproject.org/v0/amp-story-interactive-0.1.js></script>"
+	scriptAMPStoryShopping    = "<script async custom-element=amp-story-shopping src=https://cdn.ampproject.org/v0/amp-story-shopping-0.1.js></script>"
+	scriptAMPUnknown          = "<script async custom-element=amp-unknown src=https://cdn.ampproject.org/v0/amp-unknown-0.1.js></script>"
+)
+
+func TestPruneUnusedExtensions(t *testing.T) {
+	tcs := []struct {
+		desc, head, body, expectedHead string
+	}{
+		{
+			desc:         "removes unused extension",
+			head:         tt.ScriptAMPAnalytics + tt.ScriptAMPStory,
+			body:         "<amp-story></amp-story>",
+			expectedHead: tt.ScriptAMPStory,
+		},
+		{
+			desc:         "keeps used extension",
+			head:         tt.ScriptAMPAnalytics,
+			body:         "<amp-analytics></amp-analytics>",
+			expectedHead: tt.ScriptAMPAnalytics,
+		},
+		{
+			desc:         "keeps used extension within template",
+			head:         tt.ScriptAMPMustache + tt.ScriptAMPAnalytics,
+			body:         "<template type=amp-mustache><amp-analytics></amp-analytics></template>",
+			expectedHead: tt.ScriptAMPMustache + tt.ScriptAMPAnalytics,
+		},
+		{
+			desc: "removes unused amp-mustache",
+			head: tt.ScriptAMPMustache,
+		},
+		{
+			desc:         "keeps amp-mustache for template",
+			head:         tt.ScriptAMPMustache,
+			body:         "<template type=amp-mustache>{{title}}</template>",
+			expectedHead: tt.ScriptAMPMustache,
+		},
+		{
+			desc:         "keeps amp-mustache for amp-list referencing template by id",
+			head:         tt.ScriptAMPMustache,
+			body:         "<amp-list src=https://example.com/items.json template=item-template layout=fill></amp-list>",
+			expectedHead: tt.ScriptAMPMustache,
+		},
+		{
+			desc:         "keeps extension used by differently named element",
+			head:         scriptAMPStoryInteractive,
+			body:         "<amp-story-interactive-poll></amp-story-interactive-poll>",
+			expectedHead: scriptAMPStoryInteractive,
+		},
+		{
+			desc:         "keeps extension used by one of several elements",
+			head:         scriptAMPStoryShopping,
+			body:         "<amp-story-shopping-tag></amp-story-shopping-tag>",
+			expectedHead: scriptAMPStoryShopping,
+		},
+		{
+			desc: "removes unused extension with differently named elements",
+			head: scriptAMPStoryInteractive + scriptAMPStoryShopping,
+			body: "<amp-story></amp-story>",
+		},
+		{
+			desc:         "keeps unknown extension",
+			head:         scriptAMPUnknown,
+			expectedHead: scriptAMPUnknown,
+		},
+		{
+			desc:         "keeps unknown extension used by differently named element",
+			head:         scriptAMPUnknown,
+			body:         "<amp-unknown-widget></amp-unknown-widget>",
+			expectedHead: scriptAMPUnknown,
+		},
+		{
+			desc:         "keeps elementless extension",
+			head:         tt.ScriptAMPDynamicCSSClasses,
+			expectedHead: tt.ScriptAMPDynamicCSSClasses,
+		},
+		{
+			desc:         "keeps host service",
+			head:         tt.ScriptAMPMraid,
+			expectedHead: tt.ScriptAMPMraid,
+		},
+	}
+	for _, tc := range tcs {
+		input := tt.Concat("<html ⚡><head>", tt.ScriptAMPRuntime, tc.head, "</head><body>", tc.body, "</body></html>")
+		expected := tt.Concat("<html ⚡><head>", tt.ScriptAMPRuntime, tc.expectedHead, "</head><body>", tc.body, "</body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if err := transformers.UnusedExtensions(&transformers.Context{DOM: inputDOM, PruneUnusedExtensions: true}); err != nil {
+			t.Errorf("%s: UnusedExtensions() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		expectedDoc, err := html.Parse(strings.NewReader(expected))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, expected, err)
+			continue
+		}
+		var expectedOutput strings.Builder
+		if err := html.Render(&expectedOutput, expectedDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, expected, err)
+			continue
+		}
+		if output.String() != expectedOutput.String() {
+			t.Errorf("%s: UnusedExtensions=\n%q\nwant=\n%q", tc.desc, &output, &expectedOutput)
+		}
+	}
+}
@@ -30,7 +30,7 @@ import (
 
 type rewritable interface {
 	// Rewrite the URLs within
-	rewrite(string, *url.URL, string, nodeMap)
+	rewrite(string, *url.URL, string, preconnectMap)
 }
 
 type urlRewriteContext []rewritable
@@ -55,10 +55,71 @@ type textNodeContext struct {
 	offsets []amphtml.SubresourceOffset
 }
 
-// nodeMap is map of string to Node pointer
-type nodeMap map[string]*html.Node
+// preconnectPriority ranks preconnect hints, for when more are needed than
+// Context.MaxPreconnects (or Context.MaxResourceHints) allows. Lower values are
+// kept in preference.
+type preconnectPriority int
+
+const (
+	// The origin serves the AMP runtime. Only used by ResourceHints.
+	preconnectRuntime preconnectPriority = iota
+	// The origin serves images, e.g. an AMP Cache image CDN.
+	preconnectImage
+	// The origin serves other subresources, e.g. fonts.
+	preconnectOther
+	// The origin is not referenced by any rewritten URL; the hint was
+	// already in <head>, e.g. for an analytics vendor.
+	preconnectExisting
+)
+
+// preconnect is a hint to be emitted for an origin.
+type preconnect struct {
+	// The existing <link> for the origin, if any.
+	node     *html.Node
+	priority preconnectPriority
+}
+
+// preconnectMap is map of origin to preconnect hint.
+type preconnectMap map[string]*preconnect
+
+// add records that origin needs a preconnect hint with the given priority,
+// keeping the highest priority across calls.
+func (this preconnectMap) add(origin string, priority preconnectPriority) *preconnect {
+	p, ok := this[origin]
+	if !ok {
+		p = &preconnect{priority: priority}
+		this[origin] = p
+	}
+	if priority < p.priority {
+		p.priority = priority
+	}
+	return p
+}
 
-// URLRewrite rewrites links to point to the AMP Cache and adds DNS preconnects to the <head>
+// selectPreconnects returns the origins of the preconnects, sorted, keeping
+// only the max highest priority ones (breaking ties by origin) if max is
+// positive.
+func (this preconnectMap) selectPreconnects(max int) []string {
+	origins := make([]string, 0, len(this))
+	for k := range this {
+		origins = append(origins, k)
+	}
+	if max > 0 && len(origins) > max {
+		sort.Slice(origins, func(i, j int) bool {
+			pi, pj := this[origins[i]].priority, this[origins[j]].priority
+			if pi != pj {
+				return pi < pj
+			}
+			return origins[i] < origins[j]
+		})
+		origins = origins[:max]
+	}
+	sort.Strings(origins)
+	return origins
+}
+
+// URLRewrite rewrites links to point to the AMP Cache and adds DNS preconnects to the <head>,
+// up to Context.MaxPreconnects, if set.
 // Affected links:
 //  * <amp-img/amp-anim/img src>
 //  * <amp-img/amp-anim/img srcset>
@@ -168,7 +229,7 @@ func URLRewrite(e *Context) error {
 // - rewrites all the necessary URLs to point to the AMP Cache
 // - adds any preconnects, unless they exist already.
 func convertToAMPCacheURLs(ctx urlRewriteContext, documentURL string, e *Context) {
-	preconnects := make(nodeMap)
+	preconnects := make(preconnectMap)
 	mainSubdomain := amphtml.ToCacheURLSubdomain(e.BaseURL.Hostname())
 	for _, rw := range ctx {
 		rw.rewrite(documentURL, e.BaseURL, mainSubdomain, preconnects)
@@ -188,26 +249,26 @@ func convertToAMPCacheURLs(ctx urlRewriteContext, documentURL string, e *Context
 				}
 				if containsKey(m, "dns-prefetch") && containsKey(m, "preconnect") {
 					// Remove the link as it will be added back later
-					preconnects[href] = htmlnode.RemoveNode(&c)
+					preconnects.add(href, preconnectExisting).node = htmlnode.RemoveNode(&c)
 				}
 			}
 		}
 	}
 
-	sortedPreconnects := make([]string, 0, len(preconnects))
-	for k := range preconnects {
-		sortedPreconnects = append(sortedPreconnects, k)
-	}
-	sort.Strings(sortedPreconnects)
-	for _, k := range sortedPreconnects {
-		n, ok := preconnects[k]
-		if !ok || n == nil {
-			n = htmlnode.Element("link", html.Attribute{Key: "href", Val: k}, html.Attribute{Key: "rel", Val: "dns-prefetch preconnect"})
+	for _, k := range preconnects.selectPreconnects(e.MaxPreconnects) {
+		n := preconnects[k].node
+		if n == nil {
+			n = preconnectLink(k)
 		}
 		e.DOM.HeadNode.AppendChild(n)
 	}
 }
 
+// preconnectLink returns a new resource hint <link> for origin.
+func preconnectLink(origin string) *html.Node {
+	return htmlnode.Element("link", html.Attribute{Key: "href", Val: origin}, html.Attribute{Key: "rel", Val: "dns-prefetch preconnect"})
+}
+
 func containsKey(m map[string]struct{}, k string) bool {
 	_, ok := m[k]
 	return ok
@@ -215,7 +276,7 @@ func containsKey(m map[string]struct{}, k string) bool {
 
 // rewrite the URLs described by the elementNodeContext. rewriteable implementation.
 func (nc *elementNodeContext) rewrite(documentURL string, baseURL *url.URL,
-	mainSubdomain string, preconnects nodeMap) {
+	mainSubdomain string, preconnects preconnectMap) {
 	if len(nc.attrName) == 0 || len(nc.offsets) == 0 {
 		return
 	}
@@ -230,7 +291,7 @@ func (nc *elementNodeContext) rewrite(documentURL string, baseURL *url.URL,
 
 // rewrite the URLs described by the textNodeContext. rewriteable implementation.
 func (nc *textNodeContext) rewrite(documentURL string, baseURL *url.URL,
-	mainSubdomain string, preconnects nodeMap) {
+	mainSubdomain string, preconnects preconnectMap) {
 	nc.node.Data = replaceURLs(nc.node.Data, nc.offsets, documentURL, baseURL,
 		mainSubdomain, preconnects)
 }
@@ -239,7 +300,7 @@ func (nc *textNodeContext) rewrite(documentURL string, baseURL *url.URL,
 // offsets with their AMP Cache equivalent, returning a new data string.
 func replaceURLs(data string, offsets []amphtml.SubresourceOffset,
 	documentURL string, baseURL *url.URL, mainSubdomain string,
-	preconnects nodeMap) string {
+	preconnects preconnectMap) string {
 	if len(offsets) == 0 {
 		// noop
 		return data
@@ -260,7 +321,11 @@ func replaceURLs(data string, offsets []amphtml.SubresourceOffset,
 		sb.WriteString(cu.String())
 		pos = so.End
 		if len(mainSubdomain) > 0 && mainSubdomain != cu.Subdomain {
-			preconnects[cu.OriginDomain()] = nil
+			priority := preconnectOther
+			if so.SubType == amphtml.ImageType {
+				priority = preconnectImage
+			}
+			preconnects.add(cu.OriginDomain(), priority)
 		}
 	}
 	// Append any remaining non-URL text
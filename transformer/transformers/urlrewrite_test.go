@@ -7,6 +7,8 @@ import (
 	"testing"
 
 	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
 	"github.com/ampproject/amppackager/transformer/transformers"
 	"github.com/google/go-cmp/cmp"
 	"golang.org/x/net/html"
@@ -319,6 +321,90 @@ func TestURLRewrite_preconnect(t *testing.T) {
 	runURLRewriteTestcases(t, tcs)
 }
 
+func TestURLRewrite_maxPreconnects(t *testing.T) {
+	input := tt.Concat(
+		`<head><link href="https://analytics.example" rel="dns-prefetch preconnect"/>`,
+		`<style amp-custom>@font-face { src: url('https://fonts.example/a.woff') }</style></head>`,
+		`<body><amp-img src=http://b.example/1.jpg width=92 height=10 srcset="http://a.example/1.jpg 50w">`)
+	tcs := []struct {
+		desc     string
+		max      int
+		expected []string
+	}{
+		{
+			desc: "unlimited",
+			expected: []string{
+				"https://a-example.cdn.ampproject.org",
+				"https://analytics.example",
+				"https://b-example.cdn.ampproject.org",
+				"https://fonts-example.cdn.ampproject.org",
+			},
+		},
+		{
+			desc: "below limit",
+			max:  4,
+			expected: []string{
+				"https://a-example.cdn.ampproject.org",
+				"https://analytics.example",
+				"https://b-example.cdn.ampproject.org",
+				"https://fonts-example.cdn.ampproject.org",
+			},
+		},
+		{
+			desc: "drops existing hints first",
+			max:  3,
+			expected: []string{
+				"https://a-example.cdn.ampproject.org",
+				"https://b-example.cdn.ampproject.org",
+				"https://fonts-example.cdn.ampproject.org",
+			},
+		},
+		{
+			desc: "keeps image CDNs",
+			max:  2,
+			expected: []string{
+				"https://a-example.cdn.ampproject.org",
+				"https://b-example.cdn.ampproject.org",
+			},
+		},
+		{
+			desc:     "breaks ties by origin",
+			max:      1,
+			expected: []string{"https://a-example.cdn.ampproject.org"},
+		},
+	}
+	documentURL, _ := url.Parse("https://example.com/")
+	for _, tc := range tcs {
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("html.Parse failed %q", err)
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Fatalf("amphtml.NewDOM failed %q", err)
+		}
+		if err := transformers.URLRewrite(&transformers.Context{
+			DOM:            inputDOM,
+			BaseURL:        documentURL,
+			DocumentURL:    documentURL,
+			MaxPreconnects: tc.max,
+		}); err != nil {
+			t.Errorf("%s: URLRewrite() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var hrefs []string
+		for c := inputDOM.HeadNode.FirstChild; c != nil; c = c.NextSibling {
+			if rel, ok := htmlnode.GetAttributeVal(c, "", "rel"); ok && rel == "dns-prefetch preconnect" {
+				href, _ := htmlnode.GetAttributeVal(c, "", "href")
+				hrefs = append(hrefs, href)
+			}
+		}
+		if diff := cmp.Diff(tc.expected, hrefs); diff != "" {
+			t.Errorf("%s: URLRewrite() preconnects differ (-want +got):\n%s", tc.desc, diff)
+		}
+	}
+}
+
 func TestURLRewrite_style(t *testing.T) {
 	baseTcs := []struct{ desc, input, replacement string }{
 		{
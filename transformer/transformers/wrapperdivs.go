@@ -0,0 +1,96 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"strings"
+
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// WrapperDivs collapses chains of <div>s that each wrap a single <div> into
+// one <div>, as long as at most one <div> in the chain has (non-empty)
+// attributes, which are kept.
+//
+// <div><div class="card"><div><p>a</p></div></div></div>
+//            transforms to
+// <div class="card"><p>a</p></div>
+//
+// Whitespace between the wrappers is dropped. <div>s within <template> are
+// left unmodified, as their markup may be bound at runtime. Note that this
+// may change the rendering of CSS selectors that depend on the nesting, e.g.
+// "div > div".
+//
+// This is opt-in; it does nothing unless Context.CollapseWrapperDivs is true.
+func WrapperDivs(e *Context) error {
+	if !e.CollapseWrapperDivs {
+		return nil
+	}
+	for n := e.DOM.BodyNode; n != nil; n = htmlnode.Next(n) {
+		if !isWrapperDiv(n) || htmlnode.IsDescendantOf(n, atom.Template) {
+			continue
+		}
+		for child := soleDivChild(n); child != nil; child = soleDivChild(n) {
+			if hasWrapperAttributes(n) {
+				if hasWrapperAttributes(child) {
+					break
+				}
+			} else {
+				n.Attr = child.Attr
+			}
+			htmlnode.RemoveAllChildren(n)
+			for c := child.FirstChild; c != nil; c = child.FirstChild {
+				child.RemoveChild(c)
+				n.AppendChild(c)
+			}
+		}
+	}
+	return nil
+}
+
+// isWrapperDiv returns true if n is an HTML <div>.
+func isWrapperDiv(n *html.Node) bool {
+	return n.Type == html.ElementNode && n.DataAtom == atom.Div && n.Namespace == ""
+}
+
+// soleDivChild returns the only child of n, if it is a <div>, ignoring
+// whitespace-only text. Otherwise, it returns nil.
+func soleDivChild(n *html.Node) *html.Node {
+	var div *html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch {
+		case c.Type == html.TextNode && strings.Trim(c.Data, whitespace) == "":
+			continue
+		case div == nil && isWrapperDiv(c):
+			div = c
+		default:
+			return nil
+		}
+	}
+	return div
+}
+
+// hasWrapperAttributes returns true if n has any attribute that distinguishes
+// it from a bare <div>, i.e. other than an empty class or style.
+func hasWrapperAttributes(n *html.Node) bool {
+	for _, a := range n.Attr {
+		if a.Namespace != "" || (a.Key != "class" && a.Key != "style") || strings.Trim(a.Val, whitespace) != "" {
+			return true
+		}
+	}
+	return false
+}
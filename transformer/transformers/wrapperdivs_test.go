@@ -0,0 +1,95 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+func TestWrapperDivs(t *testing.T) {
+	tcs := []struct {
+		desc, input, expected string
+		disabled              bool
+	}{
+		{
+			desc:     "collapses a three-deep chain",
+			input:    "<div>\n  <div>\n    <div><p>a</p><p>b</p></div>\n  </div>\n</div>",
+			expected: "<div><p>a</p><p>b</p></div>",
+		},
+		{
+			desc:     "keeps the attributes of the chain",
+			input:    "<div><div class=\"card\" id=\"c\"><div class=\"\"><p>a</p></div></div></div>",
+			expected: "<div class=\"card\" id=\"c\"><p>a</p></div>",
+		},
+		{
+			desc:     "stops at a second distinguished div",
+			input:    "<div class=\"a\"><div><div class=\"b\"><div><p>a</p></div></div></div></div>",
+			expected: "<div class=\"a\"><div class=\"b\"><p>a</p></div></div>",
+		},
+		{
+			desc:     "keeps wrappers with several children",
+			input:    "<div><div><p>a</p></div><div><p>b</p></div></div>",
+			expected: "<div><div><p>a</p></div><div><p>b</p></div></div>",
+		},
+		{
+			desc:     "keeps wrappers around text",
+			input:    "<div>a<div><p>b</p></div></div>",
+			expected: "<div>a<div><p>b</p></div></div>",
+		},
+		{
+			desc:     "leaves templates alone",
+			input:    "<template><div><div>{{a}}</div></div></template>",
+			expected: "<template><div><div>{{a}}</div></div></template>",
+		},
+		{
+			desc:     "disabled",
+			input:    "<div><div><p>a</p></div></div>",
+			expected: "<div><div><p>a</p></div></div>",
+			disabled: true,
+		},
+	}
+	for _, tc := range tcs {
+		input := tt.Concat("<html><head></head><body>", tc.input, "</body></html>")
+		expected := tt.Concat("<html><head></head><body>", tc.expected, "</body></html>")
+		inputDoc, err := html.Parse(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if err := transformers.WrapperDivs(&transformers.Context{DOM: inputDOM, CollapseWrapperDivs: !tc.disabled}); err != nil {
+			t.Errorf("%s: WrapperDivs() unexpectedly failed %q", tc.desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.desc, input, err)
+			continue
+		}
+		if output.String() != expected {
+			t.Errorf("%s: WrapperDivs()=\n%q\nwant=\n%q", tc.desc, &output, expected)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers
+
+import (
+	"strings"
+
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+const (
+	cdataPrefix = "[CDATA["
+	cdataSuffix = "]]"
+)
+
+// XMLCleanup removes artifacts of documents produced by XML pipelines, which
+// the HTML parser treats as bogus comments:
+//  - processing instructions, e.g. <?xml version="1.0"?>, are stripped.
+//  - CDATA sections within <body>, e.g. <![CDATA[a < b]]>, are unwrapped into
+//    (escaped) text, preserving the author's intended content. Elsewhere, they
+//    are left to NodeCleanup to strip.
+// Within SVG and MathML, CDATA sections are meaningful, and are already parsed
+// as text, so they are untouched.
+//
+// This must run before NodeCleanup, which strips (most) comment nodes.
+func XMLCleanup(e *Context) error {
+	for n := e.DOM.RootNode; n != nil; n = htmlnode.Next(n) {
+		if n.Type != html.CommentNode {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(n.Data, "?"):
+			htmlnode.RemoveNode(&n)
+		case strings.HasPrefix(n.Data, cdataPrefix) && n.Parent.Namespace == "" && htmlnode.IsDescendantOf(n, atom.Body):
+			if text, ok := unwrapCDATA(n); ok {
+				n.Parent.InsertBefore(htmlnode.Text(text), n)
+				htmlnode.RemoveNode(&n)
+			}
+		}
+	}
+	return nil
+}
+
+// unwrapCDATA returns the contents of the CDATA section that begins with the
+// bogus comment n. Since a bogus comment ends at the first '>', the section
+// may continue into the following siblings, which were parsed as markup; these
+// are consumed, up to the text node containing the terminating "]]>", and
+// re-serialized. Returns false, consuming nothing, if the section is not
+// terminated within n's parent.
+func unwrapCDATA(n *html.Node) (string, bool) {
+	contents := strings.TrimPrefix(n.Data, cdataPrefix)
+	if strings.HasSuffix(contents, cdataSuffix) {
+		return strings.TrimSuffix(contents, cdataSuffix), true
+	}
+	var b strings.Builder
+	b.WriteString(contents)
+	b.WriteString(">")
+	for c := n.NextSibling; c != nil; c = c.NextSibling {
+		if c.Type != html.TextNode {
+			if err := html.Render(&b, c); err != nil {
+				return "", false
+			}
+			continue
+		}
+		end := strings.Index(c.Data, cdataSuffix+">")
+		if end == -1 {
+			b.WriteString(c.Data)
+			continue
+		}
+		b.WriteString(c.Data[:end])
+		// Consume everything up to the terminator.
+		for n.NextSibling != c {
+			n.Parent.RemoveChild(n.NextSibling)
+		}
+		c.Data = c.Data[end+len(cdataSuffix)+1:]
+		if c.Data == "" {
+			c.Parent.RemoveChild(c)
+		}
+		return b.String(), true
+	}
+	return "", false
+}
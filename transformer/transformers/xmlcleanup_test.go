@@ -0,0 +1,89 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transformers_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	tt "github.com/ampproject/amppackager/transformer/internal/testing"
+	"github.com/ampproject/amppackager/transformer/transformers"
+	"golang.org/x/net/html"
+)
+
+func TestXMLCleanup(t *testing.T) {
+	tcs := []tt.TestCase{
+		{
+			Desc:     "strips processing instructions",
+			Input:    `<?xml version="1.0" encoding="UTF-8"?><html><head><?php echo 1 ?></head><body><p>a<?pi b?>c</p></body></html>`,
+			Expected: "<html><head></head><body><p>ac</p></body></html>",
+		},
+		{
+			Desc:     "strips processing instructions in svg",
+			Input:    `<html><head></head><body><svg><?pi x?><circle></circle></svg></body></html>`,
+			Expected: "<html><head></head><body><svg><circle></circle></svg></body></html>",
+		},
+		{
+			Desc:     "unwraps CDATA outside svg",
+			Input:    "<html><head></head><body><p><![CDATA[a & b]]></p></body></html>",
+			Expected: "<html><head></head><body><p>a &amp; b</p></body></html>",
+		},
+		{
+			Desc:     "unwraps CDATA containing markup",
+			Input:    "<html><head></head><body><p><![CDATA[a > b <i>c</i>]]> d</p></body></html>",
+			Expected: "<html><head></head><body><p>a &gt; b &lt;i&gt;c&lt;/i&gt; d</p></body></html>",
+		},
+		{
+			Desc:     "leaves CDATA in svg and math as text",
+			Input:    "<html><head></head><body><svg><text><![CDATA[a < b]]></text></svg><math><mi><![CDATA[x]]></mi></math></body></html>",
+			Expected: "<html><head></head><body><svg><text>a &lt; b</text></svg><math><mi>x</mi></math></body></html>",
+		},
+		{
+			Desc:     "leaves unterminated CDATA",
+			Input:    "<html><head></head><body><p><![CDATA[a > b</p></body></html>",
+			Expected: "<html><head></head><body><p><!--[CDATA[a --> b</p></body></html>",
+		},
+		{
+			Desc:     "leaves comments",
+			Input:    "<html><head></head><body><!-- comment --></body></html>",
+			Expected: "<html><head></head><body><!-- comment --></body></html>",
+		},
+	}
+	for _, tc := range tcs {
+		inputDoc, err := html.Parse(strings.NewReader(tc.Input))
+		if err != nil {
+			t.Errorf("%s: html.Parse for %s failed %q", tc.Desc, tc.Input, err)
+			continue
+		}
+		inputDOM, err := amphtml.NewDOM(inputDoc)
+		if err != nil {
+			t.Errorf("%s: amphtml.NewDOM for %s failed %q", tc.Desc, tc.Input, err)
+			continue
+		}
+		if err := transformers.XMLCleanup(&transformers.Context{DOM: inputDOM}); err != nil {
+			t.Errorf("%s: XMLCleanup() unexpectedly failed %q", tc.Desc, err)
+			continue
+		}
+		var output strings.Builder
+		if err := html.Render(&output, inputDoc); err != nil {
+			t.Errorf("%s: html.Render for %s failed %q", tc.Desc, tc.Input, err)
+			continue
+		}
+		if output.String() != tc.Expected {
+			t.Errorf("%s: XMLCleanup()=\n%q\nwant=\n%q", tc.Desc, &output, tc.Expected)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package validator checks a (transformed) AMP document against the AMP
+// requirements that AMP Caches most commonly reject documents for. It is not
+// a full implementation of the AMP validator
+// (https://github.com/ampproject/amphtml/tree/master/validator), which
+// additionally checks each AMP component's attributes and structure, so a
+// document it accepts may still be invalid AMP.
+package validator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ampproject/amppackager/transformer/internal/amphtml"
+	"github.com/ampproject/amppackager/transformer/internal/htmlnode"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html"
+)
+
+// maxAMPCustomStyleBytes is the maximum size of the <style amp-custom>
+// stylesheet, per
+// https://amp.dev/documentation/guides-and-tutorials/develop/style_and_layout/style_pages/.
+const maxAMPCustomStyleBytes = 75000
+
+// disallowedElements are the elements that AMP documents may not contain,
+// in favor of AMP components (e.g. amp-iframe).
+var disallowedElements = map[atom.Atom]bool{
+	atom.Applet:   true,
+	atom.Embed:    true,
+	atom.Frame:    true,
+	atom.Frameset: true,
+	atom.Iframe:   true,
+	atom.Object:   true,
+	atom.Param:    true,
+}
+
+// noscriptOnlyElements are the elements that AMP documents may only contain
+// within <noscript>, as fallbacks for their AMP components.
+var noscriptOnlyElements = map[atom.Atom]bool{
+	atom.Audio: true,
+	atom.Img:   true,
+	atom.Video: true,
+}
+
+// allowedScriptTypes are the types of the non-runtime scripts that AMP
+// documents may contain, as data for AMP components.
+var allowedScriptTypes = map[string]bool{
+	"application/json":    true,
+	"application/ld+json": true,
+	"text/plain":          true,
+}
+
+// allowedStyleAttributes are the attributes of which each <style> in an AMP
+// document must have one.
+var allowedStyleAttributes = []string{
+	amphtml.AMPCustom,
+	amphtml.AMPBoilerplate,
+	amphtml.AMP4AdsBoilerplate,
+	amphtml.AMP4EmailBoilerplate,
+	amphtml.AMPRuntime,
+	"amp-keyframes",
+	"amp-extension",
+}
+
+// Validate returns the AMP validation errors of the document, in document
+// order, or nil if it is valid. The error is non-nil only if the document
+// couldn't be checked at all, so that callers may decide whether to trust it
+// regardless.
+func Validate(doc string) (problems []string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			problems, err = nil, errors.Errorf("validator panicked: %v", r)
+		}
+	}()
+	root, err := html.Parse(strings.NewReader(doc))
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing document")
+	}
+	dom, err := amphtml.NewDOM(root)
+	if err != nil {
+		return nil, errors.Wrap(err, "building DOM")
+	}
+	v := validation{}
+	v.checkHTML(dom.HTMLNode)
+	v.checkHead(dom)
+	for n := dom.HTMLNode; n != nil; n = htmlnode.Next(n) {
+		if n.Type == html.ElementNode {
+			v.checkElement(n)
+		}
+	}
+	return v.problems, nil
+}
+
+// validation accumulates the problems found by Validate.
+type validation struct {
+	problems []string
+	// The AMP format declared by the <html> element, e.g. "amp4ads", or
+	// empty if none is.
+	format          string
+	ampCustomStyles int
+}
+
+func (this *validation) fail(format string, args ...interface{}) {
+	this.problems = append(this.problems, fmt.Sprintf(format, args...))
+}
+
+// checkHTML checks that the <html> element declares an AMP format.
+func (this *validation) checkHTML(n *html.Node) {
+	for _, attr := range n.Attr {
+		switch attr.Key {
+		case "amp", "⚡":
+			this.format = "amp"
+		case "amp4ads", "⚡4ads":
+			this.format = "amp4ads"
+		case "amp4email", "⚡4email":
+			this.format = "amp4email"
+		default:
+			continue
+		}
+		return
+	}
+	this.fail("<html> lacks the ⚡ attribute")
+}
+
+// checkHead checks that the head has the required charset, viewport, runtime
+// script, and boilerplate.
+func (this *validation) checkHead(dom *amphtml.DOM) {
+	var charset, viewport, runtime, boilerplate bool
+	for c := dom.HeadNode.FirstChild; c != nil; c = c.NextSibling {
+		switch c.DataAtom {
+		case atom.Meta:
+			if val, ok := htmlnode.GetAttributeVal(c, "", "charset"); ok && strings.EqualFold(val, "utf-8") {
+				charset = true
+			}
+			if val, ok := htmlnode.GetAttributeVal(c, "", "name"); ok && strings.EqualFold(val, "viewport") {
+				viewport = true
+			}
+		case atom.Script:
+			if amphtml.IsScriptAMPRuntime(c) {
+				runtime = true
+			}
+		case atom.Style:
+			if htmlnode.HasAttribute(c, "", amphtml.AMPBoilerplate) || htmlnode.HasAttribute(c, "", amphtml.AMP4AdsBoilerplate) || htmlnode.HasAttribute(c, "", amphtml.AMP4EmailBoilerplate) {
+				boilerplate = true
+			}
+		}
+	}
+	if !charset {
+		this.fail(`<head> lacks <meta charset="utf-8">`)
+	}
+	if !viewport && this.format == "amp" {
+		this.fail(`<head> lacks <meta name="viewport">`)
+	}
+	if !runtime {
+		this.fail("<head> lacks the AMP runtime script")
+	}
+	// Server-side rendering removes the boilerplate, marking the document.
+	if !boilerplate && !htmlnode.HasAttribute(dom.HTMLNode, "", "i-amphtml-no-boilerplate") {
+		this.fail("<head> lacks the AMP boilerplate <style>")
+	}
+}
+
+// checkElement checks the element's tag and attributes.
+func (this *validation) checkElement(n *html.Node) {
+	switch {
+	case disallowedElements[n.DataAtom]:
+		this.fail("<%s> is not allowed", n.Data)
+	case noscriptOnlyElements[n.DataAtom] && !htmlnode.IsDescendantOf(n, atom.Noscript):
+		this.fail("<%s> is only allowed within <noscript>; use <amp-%s>", n.Data, n.Data)
+	case n.DataAtom == atom.Script:
+		this.checkScript(n)
+	case n.DataAtom == atom.Style:
+		this.checkStyle(n)
+	}
+	for _, attr := range n.Attr {
+		// "on" itself is AMP's action attribute.
+		if attr.Namespace == "" && len(attr.Key) > 2 && strings.HasPrefix(strings.ToLower(attr.Key), "on") {
+			this.fail("<%s> has event handler attribute %s", n.Data, attr.Key)
+		}
+	}
+}
+
+// checkScript checks that the script is AMP JS or JSON data.
+func (this *validation) checkScript(n *html.Node) {
+	if src, ok := htmlnode.GetAttributeVal(n, "", "src"); ok {
+		if !strings.HasPrefix(src, amphtml.AMPCacheRootURL) {
+			this.fail("<script src=%q> is not AMP JS", src)
+		}
+		return
+	}
+	if scriptType, ok := htmlnode.GetAttributeVal(n, "", "type"); ok && allowedScriptTypes[strings.ToLower(scriptType)] {
+		return
+	}
+	this.fail("inline <script> is not allowed, except JSON data")
+}
+
+// checkStyle checks that the stylesheet is one of the AMP ones, and within the
+// size limit.
+func (this *validation) checkStyle(n *html.Node) {
+	for _, key := range allowedStyleAttributes {
+		if htmlnode.HasAttribute(n, "", key) {
+			if key == amphtml.AMPCustom {
+				this.checkAMPCustomStyle(n)
+			}
+			return
+		}
+	}
+	this.fail("<style> must be <style amp-custom>; found a <style> without an AMP attribute")
+}
+
+func (this *validation) checkAMPCustomStyle(n *html.Node) {
+	this.ampCustomStyles++
+	if this.ampCustomStyles == 2 {
+		this.fail("there may be only one <style amp-custom>")
+	}
+	if n.Parent == nil || n.Parent.DataAtom != atom.Head {
+		this.fail("<style amp-custom> must be in <head>")
+	}
+	size := 0
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			size += len(c.Data)
+		}
+	}
+	if size > maxAMPCustomStyleBytes {
+		this.fail("<style amp-custom> is %d bytes, exceeding the limit of %d", size, maxAMPCustomStyleBytes)
+	}
+}
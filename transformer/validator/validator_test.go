@@ -0,0 +1,106 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const head = `<meta charset=utf-8><meta name=viewport content="width=device-width"><script async src=https://cdn.ampproject.org/v0.js></script><style amp-boilerplate>body{visibility:hidden}</style>`
+
+func TestValidate(t *testing.T) {
+	tcs := []struct {
+		desc     string
+		input    string
+		expected []string
+	}{
+		{
+			desc:  "valid",
+			input: `<html ⚡><head>` + head + `<style amp-custom>p{color:red}</style><script type=application/ld+json>{}</script></head><body><amp-img src=a.png width=1 height=1><noscript><img src=a.png></noscript></amp-img><button on="tap:x.hide">x</button></body></html>`,
+		},
+		{
+			desc:  "valid, transformed",
+			input: `<html ⚡ i-amphtml-no-boilerplate transformed="google;v=1"><head><meta charset=utf-8><meta name=viewport content="width=device-width"><style amp-runtime i-amphtml-version=011907161753560>x{}</style><script async src=https://cdn.ampproject.org/rtv/011907161753560/v0.js></script></head><body></body></html>`,
+		},
+		{
+			desc:  "valid, amp4ads",
+			input: `<html ⚡4ads><head><meta charset=utf-8><script async src=https://cdn.ampproject.org/amp4ads-v0.js></script><style amp4ads-boilerplate>body{visibility:hidden}</style></head><body></body></html>`,
+		},
+		{
+			desc:  "missing head requirements",
+			input: `<html><head></head><body></body></html>`,
+			expected: []string{
+				"<html> lacks the ⚡ attribute",
+				`<head> lacks <meta charset="utf-8">`,
+				"<head> lacks the AMP runtime script",
+				"<head> lacks the AMP boilerplate <style>",
+			},
+		},
+		{
+			desc:  "missing viewport",
+			input: `<html amp><head><meta charset=utf-8><script async src=https://cdn.ampproject.org/v0.js></script><style amp-boilerplate></style></head><body></body></html>`,
+			expected: []string{
+				`<head> lacks <meta name="viewport">`,
+			},
+		},
+		{
+			desc:  "disallowed elements",
+			input: `<html ⚡><head>` + head + `</head><body><iframe src=a.html></iframe><img src=a.png><object></object></body></html>`,
+			expected: []string{
+				"<iframe> is not allowed",
+				"<img> is only allowed within <noscript>; use <amp-img>",
+				"<object> is not allowed",
+			},
+		},
+		{
+			desc:  "disallowed scripts and attributes",
+			input: `<html ⚡><head>` + head + `<script src=https://example.com/a.js></script></head><body onload="f()"><script>alert(1)</script></body></html>`,
+			expected: []string{
+				`<script src="https://example.com/a.js"> is not AMP JS`,
+				"<body> has event handler attribute onload",
+				"inline <script> is not allowed, except JSON data",
+			},
+		},
+		{
+			desc:  "disallowed styles",
+			input: `<html ⚡><head>` + head + `<style amp-custom></style><style amp-custom></style><style>p{}</style></head><body></body></html>`,
+			expected: []string{
+				"there may be only one <style amp-custom>",
+				"<style> must be <style amp-custom>; found a <style> without an AMP attribute",
+			},
+		},
+		{
+			desc:  "oversized amp-custom",
+			input: `<html ⚡><head>` + head + `<style amp-custom>` + strings.Repeat("p{}", 25001) + `</style></head><body></body></html>`,
+			expected: []string{
+				"<style amp-custom> is 75003 bytes, exceeding the limit of 75000",
+			},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			problems, err := Validate(tc.input)
+			if err != nil {
+				t.Fatalf("Validate(%q) unexpected error %q", tc.input, err)
+			}
+			if diff := cmp.Diff(tc.expected, problems); diff != "" {
+				t.Errorf("Validate(%q) problems differ (-want +got):\n%s", tc.input, diff)
+			}
+		})
+	}
+}